@@ -0,0 +1,138 @@
+// +build !windows
+
+package rulerender
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"go.aporeto.io/enforcerd/trireme-lib/controller/constants"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/fqconfig"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/rulerender"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/runtime"
+	"go.aporeto.io/enforcerd/trireme-lib/policy"
+)
+
+// Generic command line arguments
+// Assumes a command like that:
+// usage = `Trireme Rule Renderer
+//
+// Usage: rulerender -h | --help
+// 		 rulerender
+// 			[--pu=<file>]
+// 			[--mode=<mode>]
+// 			[--queues=<num>]
+// 			[[--dns-server=<ip>]...]
+// 			[[--tcp-network=<cidr>]...]
+// 			[[--udp-network=<cidr>]...]
+// 			[[--excluded-network=<cidr>]...]
+// 			[--istio]
+// 			[--ipv6]
+//
+// Options:
+// 	--pu=<file>                   JSON definition of the PU (contextID, policy, runtime). Only the global rules are rendered if missing.
+// 	--mode=<mode>                 Supervisor mode: container or server [default: container].
+// 	--queues=<num>                Number of nfqueues [default: 4].
+// 	--dns-server=<ip>             DNS servers of the DNS proxy.
+// 	--tcp-network=<cidr>          TCP target networks.
+// 	--udp-network=<cidr>          UDP target networks.
+// 	--excluded-network=<cidr>     Excluded networks.
+// 	--istio                       Render the rules for an Istio service mesh [default: false].
+// 	--ipv6                        Render the ip6tables rules as well [default: false].
+// `
+
+// ExecuteCommandFromArguments renders the rules described by the arguments
+// and writes them to the standard output.
+func ExecuteCommandFromArguments(arguments map[string]interface{}) error {
+	return RenderFromArguments(arguments, os.Stdout)
+}
+
+// RenderFromArguments renders the rules described by the arguments and
+// writes them to w.
+func RenderFromArguments(arguments map[string]interface{}, w io.Writer) error {
+
+	cfg, err := ParseConfig(arguments)
+	if err != nil {
+		return err
+	}
+
+	var puInfo *policy.PUInfo
+	if value, ok := arguments["--pu"]; ok && value != nil && value.(string) != "" {
+		f, err := os.Open(value.(string))
+		if err != nil {
+			return fmt.Errorf("unable to open pu definition: %s", err)
+		}
+		defer f.Close() // nolint: errcheck
+
+		if puInfo, err = rulerender.LoadPUInfo(f); err != nil {
+			return err
+		}
+	}
+
+	r, err := rulerender.Render(cfg, puInfo)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, r.String())
+	return err
+}
+
+// ParseConfig parses the renderer configuration based on the above specification.
+func ParseConfig(arguments map[string]interface{}) (*rulerender.Config, error) {
+
+	cfg := &rulerender.Config{
+		Mode:        constants.RemoteContainer,
+		Networks:    &runtime.Configuration{},
+		ServiceMesh: policy.None,
+	}
+
+	if value, ok := arguments["--mode"]; ok && value != nil {
+		switch value.(string) {
+		case "", "container":
+			cfg.Mode = constants.RemoteContainer
+		case "server":
+			cfg.Mode = constants.LocalServer
+		default:
+			return nil, fmt.Errorf("invalid mode: %s", value.(string))
+		}
+	}
+
+	queues := 4
+	if value, ok := arguments["--queues"]; ok && value != nil {
+		if _, err := fmt.Sscanf(value.(string), "%d", &queues); err != nil || queues <= 0 {
+			return nil, errors.New("number of queues must be a positive integer")
+		}
+	}
+
+	var dnsServers []string
+	if value, ok := arguments["--dns-server"]; ok && value != nil {
+		dnsServers = value.([]string)
+	}
+
+	cfg.FilterQueue = fqconfig.NewFilterQueue(queues, dnsServers)
+
+	if value, ok := arguments["--tcp-network"]; ok && value != nil {
+		cfg.Networks.TCPTargetNetworks = value.([]string)
+	}
+
+	if value, ok := arguments["--udp-network"]; ok && value != nil {
+		cfg.Networks.UDPTargetNetworks = value.([]string)
+	}
+
+	if value, ok := arguments["--excluded-network"]; ok && value != nil {
+		cfg.Networks.ExcludedNetworks = value.([]string)
+	}
+
+	if value, ok := arguments["--istio"]; ok && value != nil && value.(bool) {
+		cfg.ServiceMesh = policy.Istio
+	}
+
+	if value, ok := arguments["--ipv6"]; ok && value != nil {
+		cfg.IPv6Enabled = value.(bool)
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,619 @@
+package systemdutil
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"go.aporeto.io/enforcerd/trireme-lib/common"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/management"
+	"go.aporeto.io/enforcerd/trireme-lib/policy"
+)
+
+// Output formats of the operator requests.
+const (
+	// OutputTable formats the output as tables.
+	OutputTable = "table"
+	// OutputJSON formats the output as JSON.
+	OutputJSON = "json"
+)
+
+const (
+	// defaultPingWait is the default time the ping reports are waited for.
+	defaultPingWait = 5 * time.Second
+	// defaultTraceDuration is the default duration of the packet tracing.
+	defaultTraceDuration = 30 * time.Second
+	// pingPollInterval is the interval at which the ping reports are polled.
+	pingPollInterval = 200 * time.Millisecond
+)
+
+// Operator command line arguments
+// Assumes a command like that:
+// 		 trireme pu list [--output=<format>] [--management-socket=<path>]
+// 		 trireme pu show <puid> [--output=<format>] [--management-socket=<path>]
+// 		 trireme pu connections <puid> [--output=<format>] [--management-socket=<path>]
+// 		 trireme pu ping <puid> <ip>
+// 			[--port=<port>]
+// 			[--iterations=<n>]
+// 			[--wait=<duration>]
+// 			[--output=<format>]
+// 			[--management-socket=<path>]
+// 		 trireme pu debug <puid>
+// 			[--exec=<command>]
+// 			[--pcap=<file>]
+// 			[--pcap-filter=<filter>]
+// 			[--native]
+// 			[--duration=<duration>]
+// 			[--output=<format>]
+// 			[--management-socket=<path>]
+// 		 trireme pu trace <puid>
+// 			[--network]
+// 			[--application]
+// 			[--iptables]
+// 			[--duration=<duration>]
+// 			[--management-socket=<path>]
+// 		 trireme flows [--pu=<puid>] [--output=<format>] [--management-socket=<path>]
+//
+// Operator Options:
+// 	--output=<format>                   Output format, table or json [default: table].
+// 	--management-socket=<path>          Path of the management socket of the controller.
+// 	--port=<port>                       Destination port of the ping [default: 0].
+// 	--iterations=<n>                    Number of iterations of the ping [default: 1].
+// 	--wait=<duration>                   Time the ping reports are waited for [default: 5s].
+// 	--exec=<command>                    Command to run in the namespace of the PU.
+// 	--pcap=<file>                       File where the packets of the PU are captured.
+// 	--pcap-filter=<filter>              Filter of the packet capture.
+// 	--native                            Capture the packets in the datapath to pcapng files.
+// 	--network                           Trace the packets received from the network.
+// 	--application                       Trace the packets sent by the application.
+// 	--iptables                          Trace the packets with iptables.
+// 	--duration=<duration>               Duration of the tracing or of the native capture [default: 30s].
+// 	--pu=<puid>                         Only show the flows of this PU.
+
+// parseOperatorCommand parses the arguments of the operator commands. It
+// returns nil if the arguments are not an operator command.
+func parseOperatorCommand(arguments map[string]interface{}) (*CLIRequest, error) {
+
+	c := &CLIRequest{
+		Output: OutputTable,
+	}
+
+	switch {
+	case isSet(arguments, "flows"):
+		c.Request = FlowsRequest
+		c.PUID = stringArgument(arguments, "--pu")
+	case isSet(arguments, "pu"):
+		c.PUID = stringArgument(arguments, "<puid>")
+		switch {
+		case isSet(arguments, "list"):
+			c.Request = ListPUsRequest
+		case isSet(arguments, "show"):
+			c.Request = ShowPURequest
+		case isSet(arguments, "connections"):
+			c.Request = ConnectionsRequest
+		case isSet(arguments, "ping"):
+			c.Request = PingRequest
+		case isSet(arguments, "debug"):
+			c.Request = DebugRequest
+		case isSet(arguments, "trace"):
+			c.Request = TraceRequest
+		default:
+			return nil, errors.New("invalid pu command")
+		}
+		if c.Request != ListPUsRequest && c.PUID == "" {
+			return nil, errors.New("pu id must be provided")
+		}
+	default:
+		return nil, nil
+	}
+
+	if value := stringArgument(arguments, "--output"); value != "" {
+		if value != OutputTable && value != OutputJSON {
+			return nil, fmt.Errorf("invalid output format %s: expected table or json", value)
+		}
+		c.Output = value
+	}
+
+	c.ManagementSocket = stringArgument(arguments, "--management-socket")
+
+	switch c.Request {
+	case PingRequest:
+		c.PingIP = stringArgument(arguments, "<ip>")
+		if net.ParseIP(c.PingIP) == nil {
+			return nil, fmt.Errorf("invalid ip %s", c.PingIP)
+		}
+
+		if value := stringArgument(arguments, "--port"); value != "" {
+			port, err := strconv.ParseUint(value, 10, 16)
+			if err != nil {
+				return nil, fmt.Errorf("invalid port %s", value)
+			}
+			c.PingPort = uint16(port)
+		}
+
+		c.PingIterations = 1
+		if value := stringArgument(arguments, "--iterations"); value != "" {
+			iterations, err := strconv.Atoi(value)
+			if err != nil || iterations <= 0 {
+				return nil, fmt.Errorf("invalid iterations %s", value)
+			}
+			c.PingIterations = iterations
+		}
+
+		wait, err := durationArgument(arguments, "--wait", defaultPingWait)
+		if err != nil {
+			return nil, err
+		}
+		c.Duration = wait
+
+	case DebugRequest:
+		c.DebugCommand = stringArgument(arguments, "--exec")
+		c.PcapFile = stringArgument(arguments, "--pcap")
+		c.PcapFilter = stringArgument(arguments, "--pcap-filter")
+		if c.DebugCommand == "" && c.PcapFile == "" {
+			return nil, errors.New("a command or a pcap file must be provided")
+		}
+
+		if isSet(arguments, "--native") {
+			if c.PcapFile == "" {
+				return nil, errors.New("a pcap file must be provided for a native capture")
+			}
+
+			duration, err := durationArgument(arguments, "--duration", defaultTraceDuration)
+			if err != nil {
+				return nil, err
+			}
+			c.PcapNative = true
+			c.Duration = duration
+		}
+
+	case TraceRequest:
+		c.TraceNetwork = isSet(arguments, "--network")
+		c.TraceApplication = isSet(arguments, "--application")
+		c.TraceIPTables = isSet(arguments, "--iptables")
+		if !c.TraceNetwork && !c.TraceApplication && !c.TraceIPTables {
+			c.TraceNetwork = true
+			c.TraceApplication = true
+		}
+
+		duration, err := durationArgument(arguments, "--duration", defaultTraceDuration)
+		if err != nil {
+			return nil, err
+		}
+		c.Duration = duration
+	}
+
+	return c, nil
+}
+
+// executeOperatorRequest executes an operator request with the management API.
+func (r *RequestProcessor) executeOperatorRequest(c *CLIRequest) error {
+
+	address := r.managementAddress
+	if c.ManagementSocket != "" {
+		address = c.ManagementSocket
+	}
+
+	client := management.NewClient(address)
+	ctx := context.Background()
+
+	switch c.Request {
+	case ListPUsRequest:
+		pus, err := client.PUs(ctx)
+		if err != nil {
+			return err
+		}
+		return r.print(c, pus, func(w io.Writer) { writePUs(w, pus) })
+
+	case ShowPURequest:
+		pu, err := client.PU(ctx, c.PUID)
+		if err != nil {
+			return err
+		}
+		return r.print(c, pu, func(w io.Writer) { writePU(w, pu) })
+
+	case ConnectionsRequest:
+		connections, err := client.Connections(ctx, c.PUID)
+		if err != nil {
+			return err
+		}
+		return r.print(c, connections, func(w io.Writer) { writeConnections(w, connections) })
+
+	case PingRequest:
+		result, err := r.ping(ctx, client, c)
+		if err != nil {
+			return err
+		}
+		return r.print(c, result, func(w io.Writer) { writePingResult(w, result) })
+
+	case DebugRequest:
+		req := &management.DebugRequest{
+			CommandExec: c.DebugCommand,
+			FilePath:    c.PcapFile,
+			PcapFilter:  c.PcapFilter,
+			Native:      c.PcapNative,
+		}
+		if c.PcapNative {
+			req.Duration = c.Duration.String()
+		}
+
+		resp, err := client.DebugCollect(ctx, c.PUID, req)
+		if err != nil {
+			return err
+		}
+		return r.print(c, resp, func(w io.Writer) { writeDebugResponse(w, c, resp) })
+
+	case TraceRequest:
+		if err := client.Trace(ctx, c.PUID, &management.TraceRequest{
+			Network:     c.TraceNetwork,
+			Application: c.TraceApplication,
+			IPTables:    c.TraceIPTables,
+			Duration:    c.Duration.String(),
+		}); err != nil {
+			return err
+		}
+		fmt.Fprintf(r.output, "Tracing the packets of %s for %s\n", c.PUID, c.Duration) // nolint: errcheck
+		return nil
+
+	case FlowsRequest:
+		return r.tailFlows(client, c)
+
+	default:
+		return fmt.Errorf("unknown request: %d", c.Request)
+	}
+}
+
+// ping starts a ping and waits for its reports.
+func (r *RequestProcessor) ping(ctx context.Context, client *management.Client, c *CLIRequest) (*management.PingResult, error) {
+
+	pingID, err := client.Ping(ctx, c.PUID, &management.PingRequest{
+		IP:         c.PingIP,
+		Port:       c.PingPort,
+		Iterations: c.PingIterations,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(c.Duration)
+	for {
+		result, err := client.PingResult(ctx, c.PUID, pingID)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(result.Reports) >= c.PingIterations || time.Now().After(deadline) {
+			return result, nil
+		}
+
+		time.Sleep(pingPollInterval)
+	}
+}
+
+// tailFlows prints the flows until the process is interrupted.
+func (r *RequestProcessor) tailFlows(client *management.Client, c *CLIRequest) error {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	go func() {
+		select {
+		case <-signals:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	if c.Output == OutputJSON {
+		encoder := json.NewEncoder(r.output)
+		return client.Flows(ctx, c.PUID, func(flow *management.Flow) {
+			encoder.Encode(flow) // nolint: errcheck
+		})
+	}
+
+	w := tabwriter.NewWriter(r.output, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tPU\tSOURCE\tDESTINATION\tPROTOCOL\tACTION\tPOLICY\tREASON") // nolint: errcheck
+	w.Flush()                                                                          // nolint: errcheck
+
+	return client.Flows(ctx, c.PUID, func(flow *management.Flow) {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", // nolint: errcheck
+			flow.Time.Format(time.RFC3339),
+			flow.PUID,
+			endpoint(flow.SourceIP, flow.SourceID, 0),
+			endpoint(flow.DestinationIP, flow.DestinationID, flow.DestinationPort),
+			protocolString(flow.Protocol),
+			flow.Action.ActionString(),
+			flow.PolicyID,
+			flow.DropReason,
+		)
+		w.Flush() // nolint: errcheck
+	})
+}
+
+// print writes the result of a request as JSON or with the table writer.
+func (r *RequestProcessor) print(c *CLIRequest, v interface{}, table func(w io.Writer)) error {
+
+	if c.Output == OutputJSON {
+		encoder := json.NewEncoder(r.output)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(v)
+	}
+
+	w := tabwriter.NewWriter(r.output, 0, 8, 2, ' ', 0)
+	table(w)
+	return w.Flush()
+}
+
+func writePUs(w io.Writer, pus []*management.PU) {
+
+	fmt.Fprintln(w, "ID\tNAME\tTYPE\tPID\tIPS\tCREATED") // nolint: errcheck
+	for _, pu := range pus {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\n", // nolint: errcheck
+			pu.ID,
+			pu.Name,
+			puTypeString(pu.Type),
+			pu.PID,
+			ipsString(pu.IPs),
+			pu.Created.Format(time.RFC3339),
+		)
+	}
+}
+
+func writePU(w io.Writer, pu *management.PUDetails) {
+
+	fmt.Fprintf(w, "ID:\t%s\n", pu.ID)                                // nolint: errcheck
+	fmt.Fprintf(w, "Name:\t%s\n", pu.Name)                            // nolint: errcheck
+	fmt.Fprintf(w, "Type:\t%s\n", puTypeString(pu.Type))              // nolint: errcheck
+	fmt.Fprintf(w, "PID:\t%d\n", pu.PID)                              // nolint: errcheck
+	fmt.Fprintf(w, "IPs:\t%s\n", ipsString(pu.IPs))                   // nolint: errcheck
+	fmt.Fprintf(w, "Updated:\t%s\n", pu.Updated.Format(time.RFC3339)) // nolint: errcheck
+
+	writeList(w, "Tags", pu.Tags)
+
+	if pu.Policy == nil {
+		return
+	}
+
+	fmt.Fprintf(w, "Action: %s\n", puActionString(pu.Policy.TriremeAction)) // nolint: errcheck
+
+	writeList(w, "Identity", sortedCopy(pu.Policy.Identity))
+	writeList(w, "Annotations", sortedCopy(pu.Policy.Annotations))
+
+	writeACLs(w, "Application ACLs", pu.Policy.ApplicationACLs)
+	writeACLs(w, "Network ACLs", pu.Policy.NetworkACLs)
+	writeTagSelectors(w, "Transmitter rules", pu.Policy.TransmitterRules)
+	writeTagSelectors(w, "Receiver rules", pu.Policy.ReceiverRules)
+}
+
+func writeList(w io.Writer, title string, values []string) {
+
+	fmt.Fprintf(w, "%s:\n", title) // nolint: errcheck
+	for _, value := range values {
+		fmt.Fprintf(w, "  %s\n", value) // nolint: errcheck
+	}
+}
+
+func writeACLs(w io.Writer, title string, rules policy.IPRuleList) {
+
+	fmt.Fprintf(w, "%s:\n", title) // nolint: errcheck
+	if len(rules) == 0 {
+		return
+	}
+
+	fmt.Fprintln(w, "\tADDRESSES\tPORTS\tPROTOCOLS\tACTION\tPOLICY") // nolint: errcheck
+	for _, rule := range rules {
+		action, policyID := flowPolicyStrings(rule.Policy)
+		fmt.Fprintf(w, "\t%s\t%s\t%s\t%s\t%s\n", // nolint: errcheck
+			strings.Join(rule.Addresses, ","),
+			strings.Join(rule.Ports, ","),
+			strings.Join(rule.Protocols, ","),
+			action,
+			policyID,
+		)
+	}
+}
+
+func writeTagSelectors(w io.Writer, title string, selectors policy.TagSelectorList) {
+
+	fmt.Fprintf(w, "%s:\n", title) // nolint: errcheck
+	if len(selectors) == 0 {
+		return
+	}
+
+	fmt.Fprintln(w, "\tCLAUSE\tACTION\tPOLICY") // nolint: errcheck
+	for _, selector := range selectors {
+		clause := []string{}
+		for _, kv := range selector.Clause {
+			clause = append(clause, kv.Key+string(kv.Operator)+strings.Join(kv.Value, "|"))
+		}
+		action, policyID := flowPolicyStrings(selector.Policy)
+		fmt.Fprintf(w, "\t%s\t%s\t%s\n", strings.Join(clause, " and "), action, policyID) // nolint: errcheck
+	}
+}
+
+func writeConnections(w io.Writer, connections []*management.Connection) {
+
+	fmt.Fprintln(w, "SOURCE\tDESTINATION\tPROTOCOL\tACTION\tPOLICY\tCOUNT\tLAST SEEN\tREASON") // nolint: errcheck
+	for _, conn := range connections {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\t%s\t%s\n", // nolint: errcheck
+			endpoint(conn.SourceIP, conn.SourceID, 0),
+			endpoint(conn.DestinationIP, conn.DestinationID, conn.DestinationPort),
+			protocolString(conn.Protocol),
+			conn.Action.ActionString(),
+			conn.PolicyID,
+			conn.Count,
+			conn.LastSeen.Format(time.RFC3339),
+			conn.DropReason,
+		)
+	}
+}
+
+func writePingResult(w io.Writer, result *management.PingResult) {
+
+	fmt.Fprintf(w, "Ping %s: %d reports\n", result.PingID, len(result.Reports)) // nolint: errcheck
+	if len(result.Reports) == 0 {
+		return
+	}
+
+	fmt.Fprintln(w, "ITERATION\tFLOW\tRTT\tACTION\tPOLICY\tREMOTE\tERROR") // nolint: errcheck
+	for _, report := range result.Reports {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s\n", // nolint: errcheck
+			report.IterationID,
+			report.FourTuple,
+			report.RTT,
+			report.PolicyAction.ActionString(),
+			report.PolicyID,
+			report.RemotePUID,
+			report.Error,
+		)
+	}
+}
+
+func writeDebugResponse(w io.Writer, c *CLIRequest, resp *management.DebugResponse) {
+
+	if c.PcapNative {
+		fmt.Fprintf(w, "Capturing the packets in %s for %s (pid %d)\n", c.PcapFile, c.Duration, resp.PID) // nolint: errcheck
+		return
+	}
+
+	if c.PcapFile != "" {
+		fmt.Fprintf(w, "Capturing the packets in %s (pid %d)\n", c.PcapFile, resp.PID) // nolint: errcheck
+		return
+	}
+
+	fmt.Fprint(w, resp.CommandOutput) // nolint: errcheck
+}
+
+// flowPolicyStrings returns the action and policy ID of a flow policy.
+func flowPolicyStrings(p *policy.FlowPolicy) (string, string) {
+
+	if p == nil {
+		return "", ""
+	}
+
+	return p.Action.ActionString(), p.PolicyID
+}
+
+// endpoint formats an endpoint of a flow.
+func endpoint(ip, id string, port uint16) string {
+
+	s := ip
+	if port != 0 {
+		s = net.JoinHostPort(ip, strconv.Itoa(int(port)))
+	}
+
+	if id != "" && id != ip {
+		s += " (" + id + ")"
+	}
+
+	return s
+}
+
+func protocolString(protocol uint8) string {
+
+	switch protocol {
+	case 1:
+		return "icmp"
+	case 6:
+		return "tcp"
+	case 17:
+		return "udp"
+	case 58:
+		return "icmpv6"
+	default:
+		return strconv.Itoa(int(protocol))
+	}
+}
+
+func puTypeString(puType common.PUType) string {
+
+	switch puType {
+	case common.ContainerPU:
+		return "container"
+	case common.LinuxProcessPU:
+		return "linux-process"
+	case common.WindowsProcessPU:
+		return "windows-process"
+	case common.HostPU:
+		return "host"
+	case common.HostNetworkPU:
+		return "host-network"
+	case common.KubernetesPU:
+		return "kubernetes"
+	default:
+		return strconv.Itoa(int(puType))
+	}
+}
+
+func puActionString(action policy.PUAction) string {
+
+	switch action {
+	case policy.AllowAll:
+		return "allow-all"
+	case policy.Police:
+		return "police"
+	default:
+		return strconv.Itoa(int(action))
+	}
+}
+
+func ipsString(ips policy.ExtendedMap) string {
+
+	values := []string{}
+	for name, ip := range ips {
+		values = append(values, name+"="+ip)
+	}
+	sort.Strings(values)
+
+	return strings.Join(values, ",")
+}
+
+func sortedCopy(values []string) []string {
+
+	sorted := append([]string{}, values...)
+	sort.Strings(sorted)
+
+	return sorted
+}
+
+func isSet(arguments map[string]interface{}, name string) bool {
+
+	value, ok := arguments[name].(bool)
+	return ok && value
+}
+
+func stringArgument(arguments map[string]interface{}, name string) string {
+
+	value, _ := arguments[name].(string)
+	return value
+}
+
+func durationArgument(arguments map[string]interface{}, name string, defaultValue time.Duration) (time.Duration, error) {
+
+	value := stringArgument(arguments, name)
+	if value == "" {
+		return defaultValue, nil
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		return 0, fmt.Errorf("invalid duration %s", value)
+	}
+
+	return duration, nil
+}
@@ -4,13 +4,16 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path"
 	"regexp"
 	"strings"
+	"time"
 
 	"go.aporeto.io/enforcerd/trireme-lib/common"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/management"
 	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/packet"
 	"go.aporeto.io/enforcerd/trireme-lib/monitor/extractors"
 	"go.aporeto.io/enforcerd/trireme-lib/monitor/remoteapi/client"
@@ -40,6 +43,20 @@ const (
 	DeleteCgroupRequest
 	// DeleteServiceRequest requests deletion by the service ID
 	DeleteServiceRequest
+	// ListPUsRequest lists the PUs enforced by the controller
+	ListPUsRequest
+	// ShowPURequest shows the policy and the tags of a PU
+	ShowPURequest
+	// ConnectionsRequest shows the connections of a PU
+	ConnectionsRequest
+	// PingRequest runs a ping from a PU
+	PingRequest
+	// DebugRequest collects debug information for a PU
+	DebugRequest
+	// TraceRequest enables the packet tracing of a PU
+	TraceRequest
+	// FlowsRequest tails the flows reported by the datapath
+	FlowsRequest
 )
 
 // CLIRequest captures all CLI parameters
@@ -64,17 +81,49 @@ type CLIRequest struct {
 	NetworkOnly bool
 	// AutoPort indicates that auto port feature is enabled for the PU
 	AutoPort bool
+	// PUID is the ID of the PU of the operator requests
+	PUID string
+	// Output is the output format of the operator requests, table or json
+	Output string
+	// ManagementSocket is the path of the management socket of the controller
+	ManagementSocket string
+	// PingIP is the destination IP of a ping
+	PingIP string
+	// PingPort is the destination port of a ping
+	PingPort uint16
+	// PingIterations is the number of iterations of a ping
+	PingIterations int
+	// Duration is the time the ping reports are waited for or the duration of the tracing or of the native capture
+	Duration time.Duration
+	// TraceNetwork traces the packets received from the network
+	TraceNetwork bool
+	// TraceApplication traces the packets sent by the application
+	TraceApplication bool
+	// TraceIPTables traces the packets with iptables
+	TraceIPTables bool
+	// DebugCommand is the command run in the namespace of the PU
+	DebugCommand string
+	// PcapFile is the file where the packets of the PU are captured
+	PcapFile string
+	// PcapFilter is the filter of the packet capture
+	PcapFilter string
+	// PcapNative captures the packets in the datapath instead of running tcpdump
+	PcapNative bool
 }
 
 // RequestProcessor is an instance of the processor
 type RequestProcessor struct {
-	address string
+	address           string
+	managementAddress string
+	output            io.Writer
 }
 
 // NewRequestProcessor creates a default request processor
 func NewRequestProcessor() *RequestProcessor {
 	return &RequestProcessor{
-		address: common.TriremeSocket,
+		address:           common.TriremeSocket,
+		managementAddress: management.DefaultSocketPath,
+		output:            os.Stdout,
 	}
 }
 
@@ -108,6 +157,8 @@ func NewCustomRequestProcessor(address string) *RequestProcessor {
 // 			[--hostpolicy]
 //          [--uidpolicy]
 // 		 trireme <cgroup>
+// 		 trireme pu (list | show | connections | ping | debug | trace) ...
+// 		 trireme flows ...
 //
 // Run Client Options:
 // 	--service-name=<sname>              Service name for the executed command [default ].
@@ -117,6 +168,7 @@ func NewCustomRequestProcessor(address string) *RequestProcessor {
 // 	--hostpolicy                        Default control of the base namespace [default false].
 // 	--uidpolicy                         Default control of the base namespace [default false].
 //
+// The arguments of the pu and flows operator commands are described in operator.go.
 // `
 
 // ParseCommand parses a command based on the above specification
@@ -124,6 +176,11 @@ func NewCustomRequestProcessor(address string) *RequestProcessor {
 // Proper use is through the CLIRequest structure
 func (r *RequestProcessor) ParseCommand(arguments map[string]interface{}) (*CLIRequest, error) {
 
+	// The operator commands talk to the management API of the controller
+	if c, err := parseOperatorCommand(arguments); err != nil || c != nil {
+		return c, err
+	}
+
 	c := &CLIRequest{}
 
 	// First parse a command that only provides the cgroup
@@ -313,6 +370,8 @@ func (r *RequestProcessor) ExecuteRequest(c *CLIRequest) error {
 		return r.DeleteCgroup(c)
 	case DeleteServiceRequest:
 		return r.DeleteService(c)
+	case ListPUsRequest, ShowPURequest, ConnectionsRequest, PingRequest, DebugRequest, TraceRequest, FlowsRequest:
+		return r.executeOperatorRequest(c)
 	default:
 		return fmt.Errorf("unknown request: %d", c.Request)
 	}
@@ -337,6 +396,10 @@ func executableTags(c *CLIRequest) []string {
 		tags = append(tags, fmt.Sprintf("@app:%s:filechecksum=%s", extractors.OSHostString, hex.EncodeToString(fileMd5)))
 	}
 
+	if fileSha256, err := extractors.ComputeFileSha256(c.Executable); err == nil {
+		tags = append(tags, fmt.Sprintf("@app:%s:filechecksum:sha256=%s", extractors.OSHostString, hex.EncodeToString(fileSha256)))
+	}
+
 	depends := extractors.Libs(c.ServiceName)
 	for _, lib := range depends {
 		tags = append(tags, fmt.Sprintf("@app:%s:lib:%s=true", extractors.OSHostString, lib))
@@ -42,6 +42,9 @@ func (d *DefaultCollector) CollectPingEvent(report *PingReport) {}
 // CollectConnectionExceptionReport collects the connection exception report
 func (d *DefaultCollector) CollectConnectionExceptionReport(report *ConnectionExceptionReport) {}
 
+// CollectCertificateEvent collects the certificate events
+func (d *DefaultCollector) CollectCertificateEvent(report *CertificateReport) {}
+
 // StatsFlowHash is a hash function to hash flows. Ignores source ports. Returns two hashes
 // flowhash - minimal with SIP/DIP/Dport
 // contenthash - hash with all contents to compare quickly and report when changes are observed
@@ -47,6 +47,20 @@ const (
 	DatapathVersionMismatch = "datapathversionmismatch"
 	// PacketDrop indicate a single packet drop
 	PacketDrop = "packetdrop"
+	// ReplayedToken indicates that a syn or synack token was received more than once
+	ReplayedToken = "replayedtoken"
+	// RevokedCertificate indicates that the certificate of the peer is revoked
+	RevokedCertificate = "revokedcertificate"
+	// RevocationUnknown indicates that the revocation status of the certificate of the peer is unknown
+	RevocationUnknown = "revocationunknown"
+)
+
+// Certificate event description
+const (
+	// CertificateExpiring indicates that a certificate expires soon
+	CertificateExpiring = "expiring"
+	// CertificateExpired indicates that a certificate has expired
+	CertificateExpired = "expired"
 )
 
 // Container event description
@@ -109,6 +123,14 @@ type EventCollector interface {
 	CollectConnectionExceptionReport(report *ConnectionExceptionReport)
 }
 
+// CertificateEventCollector is an optional interface of the event collectors
+// that collect the certificate events.
+type CertificateEventCollector interface {
+
+	// CollectCertificateEvent collects the certificate events
+	CollectCertificateEvent(report *CertificateReport)
+}
+
 // EndPointType is the type of an endpoint (PU or an external IP address )
 type EndPointType byte
 
@@ -166,6 +188,11 @@ type FlowRecord struct {
 	SourceController      string
 	DestinationController string
 	RuleName              string
+	// BytesSent and BytesReceived are the bytes sent and received by the
+	// source of the flows that carry a stream, like the upgraded HTTP
+	// connections.
+	BytesSent     uint64
+	BytesReceived uint64
 }
 
 func (f *FlowRecord) String() string {
@@ -321,3 +348,14 @@ type ConnectionExceptionReport struct {
 	Reason          string
 	Value           uint32
 }
+
+// CertificateReport represents a certificate of the enforcer that expires soon
+// or has expired.
+type CertificateReport struct {
+	Timestamp  time.Time
+	Path       string
+	Subject    string
+	Serial     string
+	Expiration time.Time
+	Reason     string
+}
@@ -163,3 +163,44 @@ func (mr *MockEventCollectorMockRecorder) CollectConnectionExceptionReport(repor
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CollectConnectionExceptionReport", reflect.TypeOf((*MockEventCollector)(nil).CollectConnectionExceptionReport), report)
 }
+
+// MockCertificateEventCollector is a mock of CertificateEventCollector interface
+// nolint
+type MockCertificateEventCollector struct {
+	ctrl     *gomock.Controller
+	recorder *MockCertificateEventCollectorMockRecorder
+}
+
+// MockCertificateEventCollectorMockRecorder is the mock recorder for MockCertificateEventCollector
+// nolint
+type MockCertificateEventCollectorMockRecorder struct {
+	mock *MockCertificateEventCollector
+}
+
+// NewMockCertificateEventCollector creates a new mock instance
+// nolint
+func NewMockCertificateEventCollector(ctrl *gomock.Controller) *MockCertificateEventCollector {
+	mock := &MockCertificateEventCollector{ctrl: ctrl}
+	mock.recorder = &MockCertificateEventCollectorMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+// nolint
+func (m *MockCertificateEventCollector) EXPECT() *MockCertificateEventCollectorMockRecorder {
+	return m.recorder
+}
+
+// CollectCertificateEvent mocks base method
+// nolint
+func (m *MockCertificateEventCollector) CollectCertificateEvent(report *collector.CertificateReport) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "CollectCertificateEvent", report)
+}
+
+// CollectCertificateEvent indicates an expected call of CollectCertificateEvent
+// nolint
+func (mr *MockCertificateEventCollectorMockRecorder) CollectCertificateEvent(report interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CollectCertificateEvent", reflect.TypeOf((*MockCertificateEventCollector)(nil).CollectCertificateEvent), report)
+}
@@ -2,6 +2,7 @@ package common
 
 import (
 	"context"
+	"time"
 )
 
 // TriremeSocket is the standard API server Trireme socket path
@@ -39,6 +40,9 @@ const (
 	// TriremeCgroupPath is the standard Trireme cgroup path
 	TriremeCgroupPath = "/trireme/"
 
+	// TriremeUIDCgroupPath is the path for UID based activations
+	TriremeUIDCgroupPath = "/trireme_uid/"
+
 	// TriremeDockerHostNetwork is the path for Docker HostNetwork container based activations
 	TriremeDockerHostNetwork = "/trireme_docker_hostnet/"
 )
@@ -91,6 +95,42 @@ type EventInfo struct {
 
 	// Root indicates that this request is coming from a roor user. Its overwritten by the enforcer
 	Root bool `json:"root,omitempty"`
+
+	// SSHCertificate is the OpenSSH user certificate the session was authenticated with.
+	SSHCertificate *SSHCertificateInfo `json:"sshcertificate,omitempty"`
+}
+
+// SSHCertificateInfo holds the attributes of an OpenSSH user certificate.
+type SSHCertificateInfo struct {
+
+	// KeyID is the key ID of the certificate.
+	KeyID string `json:"keyid,omitempty"`
+
+	// Serial is the serial number of the certificate.
+	Serial uint64 `json:"serial,omitempty"`
+
+	// Principals are the principals the certificate is valid for.
+	Principals []string `json:"principals,omitempty"`
+
+	// CriticalOptions are the critical options of the certificate, like force-command.
+	CriticalOptions map[string]string `json:"criticaloptions,omitempty"`
+
+	// ValidAfter is the start of the validity of the certificate.
+	ValidAfter time.Time `json:"validafter,omitempty"`
+
+	// ValidBefore is the end of the validity of the certificate. It is zero
+	// if the certificate never expires.
+	ValidBefore time.Time `json:"validbefore,omitempty"`
+}
+
+// Valid returns true if the certificate is valid at the given time.
+func (c *SSHCertificateInfo) Valid(now time.Time) bool {
+
+	if !c.ValidAfter.IsZero() && now.Before(c.ValidAfter) {
+		return false
+	}
+
+	return c.ValidBefore.IsZero() || now.Before(c.ValidBefore)
 }
 
 // Event represents the event picked up by the monitor.
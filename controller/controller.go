@@ -205,6 +205,7 @@ func (t *trireme) UpdateConfiguration(cfg *runtime.Configuration) error {
 // doHandleCreate is the detailed implementation of the create event.
 func (t *trireme) doHandleCreate(ctx context.Context, contextID string, policyInfo *policy.PUPolicy, runtimeInfo *policy.PURuntime) error {
 
+	policyInfo = quarantine(contextID, policyInfo, runtimeInfo)
 	containerInfo := policy.PUInfoFromPolicyAndRuntime(contextID, policyInfo, runtimeInfo)
 
 	logEvent := &collector.ContainerRecord{
@@ -271,6 +272,7 @@ func (t *trireme) doHandleDelete(ctx context.Context, contextID string, policyIn
 // doUpdatePolicy is the detailed implementation of the update policy event.
 func (t *trireme) doUpdatePolicy(ctx context.Context, contextID string, newPolicy *policy.PUPolicy, runtime *policy.PURuntime) error {
 
+	newPolicy = quarantine(contextID, newPolicy, runtime)
 	containerInfo := policy.PUInfoFromPolicyAndRuntime(contextID, newPolicy, runtime)
 
 	addTransmitterLabel(contextID, containerInfo)
@@ -29,6 +29,19 @@ func addTransmitterLabel(contextID string, containerInfo *policy.PUInfo) {
 	}
 }
 
+// quarantine returns the policy to enforce for a PU. A quarantined PU gets a
+// policy that rejects all its traffic.
+func quarantine(contextID string, policyInfo *policy.PUPolicy, runtime *policy.PURuntime) *policy.PUPolicy {
+
+	if runtime == nil || !runtime.Options().Quarantined {
+		return policyInfo
+	}
+
+	zap.L().Warn("PU is quarantined, rejecting all its traffic", zap.String("contextID", contextID))
+
+	return policyInfo.Quarantine()
+}
+
 // MustEnforce returns true if the Policy should go Through the Enforcer/internal/supervisor.
 // Return false if:
 //   - PU is in host namespace.
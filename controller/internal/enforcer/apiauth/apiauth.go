@@ -14,6 +14,7 @@ import (
 	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/packet"
 	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/secrets"
 	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/servicetokens"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/spiffe"
 	"go.aporeto.io/enforcerd/trireme-lib/policy"
 	"go.uber.org/zap"
 )
@@ -326,7 +327,10 @@ func (p *Processor) NetworkRequest(ctx context.Context, r *Request) (*NetworkAut
 
 	// We can now validate the API authorization. This is the final step
 	// before forwarding.
+	// The SPIFFE ID of the peer is part of the claims, so that the API
+	// policies can match on it.
 	allClaims := append(aporetoClaims, d.UserAttributes...)
+	allClaims = append(allClaims, peerSPIFFEClaims(r)...)
 	accept, public := pctx.Authorizer.Check(r.Method, r.URL.Path, allClaims)
 	if !accept && !public {
 		// If the authorization check returns reject, we need to validate
@@ -427,6 +431,27 @@ func userCredentials(ctx context.Context, pctx *serviceregistry.PortContext, r *
 	d.Redirect = redirect
 }
 
+// peerSPIFFEClaims returns the claims of the SPIFFE ID of the peer, if it
+// has one.
+func peerSPIFFEClaims(r *Request) []string {
+
+	if r.SPIFFEID != "" {
+		id, err := spiffe.ParseID(r.SPIFFEID)
+		if err != nil {
+			zap.L().Debug("Ignoring invalid peer SPIFFE ID", zap.Error(err))
+			return nil
+		}
+		return id.Claims()
+	}
+
+	id, err := spiffe.PeerID(r.TLS)
+	if err != nil {
+		return nil
+	}
+
+	return id.Claims()
+}
+
 func processHeaders(r *Request) (string, string) {
 	token := r.Header.Get("X-APORETO-AUTH")
 	if token != "" {
@@ -5,6 +5,7 @@ package apiauth
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"net"
 	"net/http"
@@ -887,3 +888,34 @@ func Test_UserCredentials(t *testing.T) {
 		})
 	})
 }
+
+func Test_PeerSPIFFEClaims(t *testing.T) {
+
+	Convey("Given requests with peer SPIFFE IDs", t, func() {
+
+		u, _ := url.Parse("spiffe://example.org/web")
+		cert := &x509.Certificate{URIs: []*url.URL{u}}
+
+		Convey("The SPIFFE ID of the verified peer certificate should be claimed", func() {
+			r := &Request{TLS: &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}}
+			So(peerSPIFFEClaims(r), ShouldResemble, []string{
+				"spiffeid=spiffe://example.org/web",
+				"spiffetrustdomain=example.org",
+			})
+		})
+
+		Convey("The SPIFFE ID provided with the request should be claimed", func() {
+			r := &Request{SPIFFEID: "spiffe://example.org/db"}
+			So(peerSPIFFEClaims(r), ShouldResemble, []string{
+				"spiffeid=spiffe://example.org/db",
+				"spiffetrustdomain=example.org",
+			})
+		})
+
+		Convey("An invalid or missing SPIFFE ID should not be claimed", func() {
+			So(peerSPIFFEClaims(&Request{SPIFFEID: "https://example.org/db"}), ShouldBeEmpty)
+			So(peerSPIFFEClaims(&Request{TLS: &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}}), ShouldBeEmpty)
+			So(peerSPIFFEClaims(&Request{}), ShouldBeEmpty)
+		})
+	})
+}
@@ -31,6 +31,11 @@ type Request struct {
 	// TLS information. This is optional if mutual TLS based authorization
 	// must be supported.
 	TLS *tls.ConnectionState
+
+	// SPIFFEID is the SPIFFE ID of the peer when TLS has been terminated
+	// before the request reached us, like by an envoy sidecar. Otherwise
+	// the SPIFFE ID is taken from the TLS information.
+	SPIFFEID string
 }
 
 // NetworkAuthResponse is the decision of the authorization process.
@@ -27,6 +27,7 @@ import (
 	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/ipsetmanager"
 	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/pucontext"
 	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/secrets"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/spiffe"
 	"go.aporeto.io/enforcerd/trireme-lib/policy"
 	"go.aporeto.io/enforcerd/trireme-lib/utils/cache"
 	"go.uber.org/zap"
@@ -330,6 +331,11 @@ func (p *AppProxy) processCertificateUpdates(puInfo *policy.PUInfo, client *clie
 		return false, fmt.Errorf("Invalid certificates: %s", err)
 	}
 
+	// The certificate must hold the SPIFFE ID of the PU when it has one.
+	if err := spiffe.VerifyTLSCertificate(&tlsCert, puInfo.Policy.SPIFFEID()); err != nil {
+		return false, fmt.Errorf("Invalid certificates: %s", err)
+	}
+
 	for _, server := range client.netserver {
 		server.UpdateSecrets(&tlsCert, caPool, p.secrets, certPEM, keyPEM)
 	}
@@ -39,6 +39,11 @@ func (e TriremeHTTPErrHandler) ServeHTTP(w http.ResponseWriter, req *http.Reques
 		statusCode = StatusClientClosedRequest
 	}
 
+	if isGRPCRequest(req) {
+		grpcError(w, statusText(statusCode), statusCode)
+		return
+	}
+
 	w.WriteHeader(statusCode)
 	w.Write([]byte(statusText(statusCode))) // nolint errcheck
 }
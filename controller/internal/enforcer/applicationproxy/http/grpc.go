@@ -0,0 +1,156 @@
+package httpproxy
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/http2"
+	"google.golang.org/grpc/codes"
+)
+
+const (
+	grpcContentType = "application/grpc"
+)
+
+// isGRPCRequest returns true if the request is a gRPC call. The gRPC calls
+// are HTTP/2 requests with a gRPC content type.
+func isGRPCRequest(r *http.Request) bool {
+
+	if r.ProtoMajor != 2 {
+		return false
+	}
+
+	contentType := r.Header.Get("Content-Type")
+
+	return contentType == grpcContentType ||
+		strings.HasPrefix(contentType, grpcContentType+"+") ||
+		strings.HasPrefix(contentType, grpcContentType+";")
+}
+
+// grpcCode returns the gRPC status code of an HTTP status code as defined
+// by the gRPC HTTP to gRPC status code mapping.
+func grpcCode(status int) codes.Code {
+
+	switch status {
+	case http.StatusBadRequest, http.StatusInternalServerError:
+		return codes.Internal
+	case http.StatusUnauthorized, http.StatusNetworkAuthenticationRequired:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.Unimplemented
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return codes.Unavailable
+	case StatusClientClosedRequest:
+		return codes.Canceled
+	}
+
+	return codes.Unknown
+}
+
+// grpcEncodeMessage percent encodes the status message of a gRPC response.
+func grpcEncodeMessage(msg string) string {
+
+	var b strings.Builder
+	for i := 0; i < len(msg); i++ {
+		c := msg[i]
+		if c >= ' ' && c <= '~' && c != '%' {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+
+	return b.String()
+}
+
+// grpcError replies to a gRPC call with a trailers only response. The gRPC
+// clients ignore the HTTP status, so the error is carried by the gRPC status
+// matching the HTTP status.
+func grpcError(w http.ResponseWriter, msg string, status int) {
+
+	w.Header().Set("Content-Type", grpcContentType)
+	w.Header().Set("Grpc-Status", strconv.Itoa(int(grpcCode(status))))
+	w.Header().Set("Grpc-Message", grpcEncodeMessage(msg))
+	w.WriteHeader(http.StatusOK)
+}
+
+// httpError replies to the request with the error. The gRPC calls get the
+// corresponding gRPC status.
+func httpError(w http.ResponseWriter, r *http.Request, msg string, status int) {
+
+	if isGRPCRequest(r) {
+		grpcError(w, msg, status)
+		return
+	}
+
+	http.Error(w, msg, status)
+}
+
+// grpcForwarder forwards the gRPC calls. Unlike the forwarders of the other
+// requests, the messages are flushed as soon as they are written so that the
+// streams are not buffered in either direction, and the trailers that carry
+// the gRPC status are forwarded. The calls are forwarded over HTTP/2 with TLS
+// or over h2c, the cleartext HTTP/2 with prior knowledge used by the gRPC
+// clients, depending on the scheme of the target.
+type grpcForwarder struct {
+	tls http.RoundTripper
+	h2c http.RoundTripper
+}
+
+// newGRPCForwarder creates a gRPC forwarder. The TLS transport must be able
+// to negotiate HTTP/2 and the h2c connections are created with the dialer.
+func newGRPCForwarder(tlsTransport http.RoundTripper, dial func(network, addr string) (net.Conn, error)) *grpcForwarder {
+
+	return &grpcForwarder{
+		tls: tlsTransport,
+		h2c: &http2.Transport{
+			AllowHTTP: true,
+			DialTLS: func(network, addr string, _ *tls.Config) (net.Conn, error) {
+				return dial(network, addr)
+			},
+		},
+	}
+}
+
+// ServeHTTP forwards the call to the target of the request URL. The path of
+// the call is taken from the request URI.
+func (f *grpcForwarder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	path, err := url.ParseRequestURI(r.RequestURI)
+	if err != nil {
+		grpcError(w, fmt.Sprintf("Invalid gRPC method: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	transport := f.h2c
+	if r.URL.Scheme == "https" {
+		transport = f.tls
+	}
+
+	target := &url.URL{
+		Scheme:   r.URL.Scheme,
+		Host:     r.URL.Host,
+		Path:     path.Path,
+		RawPath:  path.RawPath,
+		RawQuery: path.RawQuery,
+	}
+
+	proxy := &httputil.ReverseProxy{
+		Director: func(req *http.Request) {
+			req.URL = target
+		},
+		Transport:     transport,
+		FlushInterval: -1,
+		ErrorHandler:  TriremeHTTPErrHandler{}.ServeHTTP,
+	}
+
+	proxy.ServeHTTP(w, r)
+}
@@ -0,0 +1,146 @@
+package httpproxy
+
+import (
+	"bufio"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/grpc/codes"
+)
+
+func newH2CClient() *http.Client {
+	return &http.Client{
+		Transport: &http2.Transport{
+			AllowHTTP: true,
+			DialTLS: func(network, addr string, _ *tls.Config) (net.Conn, error) {
+				return net.Dial(network, addr)
+			},
+		},
+	}
+}
+
+func TestGRPCHelpers(t *testing.T) {
+
+	Convey("Given requests", t, func() {
+
+		Convey("Only the HTTP/2 requests with a gRPC content type should be gRPC calls", func() {
+			r := httptest.NewRequest(http.MethodPost, "/pkg.Service/Method", nil)
+			r.Header.Set("Content-Type", "application/grpc+proto")
+			So(isGRPCRequest(r), ShouldBeFalse)
+
+			r.ProtoMajor = 2
+			So(isGRPCRequest(r), ShouldBeTrue)
+
+			r.Header.Set("Content-Type", "application/grpc-web")
+			So(isGRPCRequest(r), ShouldBeFalse)
+		})
+
+		Convey("The HTTP status codes should be mapped to gRPC status codes", func() {
+			So(grpcCode(http.StatusForbidden), ShouldEqual, codes.PermissionDenied)
+			So(grpcCode(http.StatusUnauthorized), ShouldEqual, codes.Unauthenticated)
+			So(grpcCode(http.StatusNetworkAuthenticationRequired), ShouldEqual, codes.Unauthenticated)
+			So(grpcCode(http.StatusBadGateway), ShouldEqual, codes.Unavailable)
+			So(grpcCode(http.StatusTeapot), ShouldEqual, codes.Unknown)
+		})
+
+		Convey("The gRPC status messages should be percent encoded", func() {
+			So(grpcEncodeMessage("Access denied: 100%\n"), ShouldEqual, "Access denied: 100%25%0A")
+		})
+
+		Convey("The denials of gRPC calls should have a gRPC status", func() {
+			r := httptest.NewRequest(http.MethodPost, "/pkg.Service/Method", nil)
+			r.ProtoMajor = 2
+			r.Header.Set("Content-Type", grpcContentType)
+
+			w := httptest.NewRecorder()
+			httpError(w, r, "Access denied", http.StatusForbidden)
+			So(w.Code, ShouldEqual, http.StatusOK)
+			So(w.Header().Get("Grpc-Status"), ShouldEqual, "7")
+			So(w.Header().Get("Grpc-Message"), ShouldEqual, "Access denied")
+		})
+	})
+}
+
+func TestGRPCForwarder(t *testing.T) {
+
+	Convey("Given a gRPC forwarder in front of an h2c service", t, func() {
+
+		service := httptest.NewServer(h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", grpcContentType)
+			w.Header().Set("Trailer", "Grpc-Status")
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+
+			// Echo the messages of the stream as they come.
+			scanner := bufio.NewScanner(r.Body)
+			for scanner.Scan() {
+				w.Write([]byte(r.URL.Path + " " + scanner.Text() + "\n")) // nolint errcheck
+				w.(http.Flusher).Flush()
+			}
+
+			w.Header().Set("Grpc-Status", "0")
+		}), &http2.Server{}))
+		defer service.Close()
+
+		serviceURL, err := url.Parse(service.URL)
+		So(err, ShouldBeNil)
+
+		fwd := newGRPCForwarder(nil, net.Dial)
+		proxy := httptest.NewServer(h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.URL = &url.URL{Scheme: "http", Host: serviceURL.Host}
+			fwd.ServeHTTP(w, r)
+		}), &http2.Server{}))
+		defer proxy.Close()
+
+		Convey("The messages of a bidirectional stream should be forwarded as they come", func() {
+			body, stream := io.Pipe()
+
+			req, err := http.NewRequest(http.MethodPost, proxy.URL+"/pkg.Service/Method", body)
+			So(err, ShouldBeNil)
+			req.Header.Set("Content-Type", grpcContentType)
+
+			resp, err := newH2CClient().Do(req)
+			So(err, ShouldBeNil)
+			defer resp.Body.Close() // nolint errcheck
+
+			reader := bufio.NewReader(resp.Body)
+			for _, msg := range []string{"ping1", "ping2"} {
+				_, err := stream.Write([]byte(msg + "\n"))
+				So(err, ShouldBeNil)
+
+				line, err := reader.ReadString('\n')
+				So(err, ShouldBeNil)
+				So(line, ShouldEqual, "/pkg.Service/Method "+msg+"\n")
+			}
+
+			So(stream.Close(), ShouldBeNil)
+
+			_, err = reader.ReadString('\n')
+			So(err, ShouldEqual, io.EOF)
+			So(resp.Trailer.Get("Grpc-Status"), ShouldEqual, "0")
+		})
+
+		Convey("When the service can not be reached, the call should fail with a gRPC status", func() {
+			service.Close()
+
+			req, err := http.NewRequest(http.MethodPost, proxy.URL+"/pkg.Service/Method", nil)
+			So(err, ShouldBeNil)
+			req.Header.Set("Content-Type", grpcContentType)
+
+			resp, err := newH2CClient().Do(req)
+			So(err, ShouldBeNil)
+			defer resp.Body.Close() // nolint errcheck
+
+			So(resp.StatusCode, ShouldEqual, http.StatusOK)
+			So(resp.Header.Get("Grpc-Status"), ShouldEqual, "14")
+		})
+	})
+}
@@ -30,11 +30,15 @@ import (
 	"go.aporeto.io/enforcerd/trireme-lib/controller/internal/enforcer/metadata"
 	"go.aporeto.io/enforcerd/trireme-lib/controller/internal/enforcer/utils/ephemeralkeys"
 	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/bufferpool"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/counters"
 	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/secrets"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/secrets/revocation"
 	"go.aporeto.io/enforcerd/trireme-lib/policy"
 	"go.aporeto.io/gaia"
 	"go.aporeto.io/gaia/x509extensions"
 	"go.uber.org/zap"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 )
 
 type statsContextKeyType string
@@ -74,12 +78,19 @@ type Config struct {
 	server           *http.Server
 	fwd              *forward.Forwarder
 	fwdTLS           *forward.Forwarder
+	fwdGRPC          *grpcForwarder
+	fwdGRPCTLS       *grpcForwarder
+	fwdUpgrade       *upgradeForwarder
+	fwdUpgradeTLS    *upgradeForwarder
 	tlsClientConfig  *tls.Config
 	auth             *apiauth.Processor
 	metadata         *metadata.Client
 	tokenIssuer      common.ServiceTokenIssuer
 	hooks            map[string]hookFunc
 	agentVersion     semver.Version
+	revocation       *revocation.Checker
+	stapler          *revocation.Stapler
+	issuers          []*x509.Certificate
 
 	sync.RWMutex
 }
@@ -113,6 +124,12 @@ func NewHTTPProxy(
 		tokenIssuer:     tokenIssuer,
 		datapathKeyPair: datapathKeyPair,
 		agentVersion:    agentVersion,
+		stapler:         revocation.NewStapler(),
+	}
+
+	if secrets != nil {
+		h.revocation = secrets.Revocation()
+		h.issuers = revocation.ParseCertificates(secrets.CertAuthority())
 	}
 
 	hooks := map[string]hookFunc{
@@ -152,6 +169,7 @@ func (p *Config) clientTLSConfiguration(conn net.Conn, originalConfig *tls.Confi
 			config := p.newBaseTLSConfig()
 			config.ClientAuth = tls.VerifyClientCertIfGiven
 			config.ClientCAs = clientCAs
+			config.VerifyPeerCertificate = p.verifyRevocation
 			return config, nil
 		}
 		return originalConfig, nil
@@ -162,8 +180,8 @@ func (p *Config) clientTLSConfiguration(conn net.Conn, originalConfig *tls.Confi
 // newBaseTLSConfig creates the new basic TLS configuration for the server.
 func (p *Config) newBaseTLSConfig() *tls.Config {
 	c := tlshelper.NewBaseTLSServerConfig()
-	c.NextProtos = []string{"h2"}
-	c.GetCertificate = p.GetCertificateFunc
+	c.NextProtos = []string{"h2", "http/1.1"}
+	c.GetCertificate = p.getStapledCertificate
 	c.ClientCAs = p.ca
 	return c
 }
@@ -171,12 +189,38 @@ func (p *Config) newBaseTLSConfig() *tls.Config {
 // newBaseTLSClientConfig creates the new basic TLS configuration for the client.
 func (p *Config) newBaseTLSClientConfig() *tls.Config {
 	c := tlshelper.NewBaseTLSClientConfig()
-	c.NextProtos = []string{"h2"}
+	c.NextProtos = []string{"h2", "http/1.1"}
 	c.GetCertificate = p.GetCertificateFunc
 	c.GetClientCertificate = p.GetClientCertificateFunc
+	c.VerifyPeerCertificate = p.verifyRevocation
 	return c
 }
 
+// verifyRevocation checks the revocation of the certificates of the peer
+// against the CRLs of the secrets.
+func (p *Config) verifyRevocation(_ [][]byte, verifiedChains [][]*x509.Certificate) error {
+	p.RLock()
+	checker := p.revocation
+	p.RUnlock()
+
+	return checker.VerifyChains(verifiedChains)
+}
+
+// getStapledCertificate returns the certificate of GetCertificateFunc with
+// its OCSP response stapled when there is one.
+func (p *Config) getStapledCertificate(clientHello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cert, err := p.GetCertificateFunc(clientHello)
+	if err != nil {
+		return nil, err
+	}
+
+	p.RLock()
+	issuers := p.issuers
+	p.RUnlock()
+
+	return p.stapler.Staple(cert, issuers), nil
+}
+
 // GetClientCertificateFunc returns the certificate that will be used by the Proxy as a client during the TLS
 func (p *Config) GetClientCertificateFunc(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
 	p.RLock()
@@ -295,7 +339,7 @@ func (p *Config) RunNetworkServer(ctx context.Context, l net.Listener, encrypted
 		return conn, nil
 	}
 
-	// Dial functions for the websockets.
+	// Dial functions for the h2c connections.
 	netDial := func(network, addr string) (net.Conn, error) {
 		raddr, err := net.ResolveTCPAddr(network, addr)
 		if err != nil {
@@ -368,8 +412,6 @@ func (p *Config) RunNetworkServer(ctx context.Context, l net.Listener, encrypted
 	var err error
 	p.fwdTLS, err = forward.New(
 		forward.RoundTripper(encryptedTransport),
-		forward.WebsocketTLSClientConfig(&tls.Config{RootCAs: p.ca}),
-		forward.WebSocketNetDial(netDial),
 		forward.BufferPool(bufferpool.NewPool(32*1204)),
 		forward.ErrorHandler(TriremeHTTPErrHandler{}),
 	)
@@ -377,10 +419,31 @@ func (p *Config) RunNetworkServer(ctx context.Context, l net.Listener, encrypted
 		return fmt.Errorf("Cannot initialize encrypted transport: %s", err)
 	}
 
+	// The gRPC calls are forwarded over HTTP/2 only. The transport towards
+	// the application gets its own TLS configuration since HTTP/2 is added
+	// to its protocols.
+	grpcTransport := &http.Transport{
+		TLSClientConfig:     transport.TLSClientConfig.Clone(),
+		DialContext:         appDialerWithContext,
+		MaxIdleConns:        2000,
+		MaxIdleConnsPerHost: 2000,
+		ForceAttemptHTTP2:   true,
+	}
+
+	p.fwdGRPCTLS = newGRPCForwarder(encryptedTransport, netDial)
+	p.fwdGRPC = newGRPCForwarder(grpcTransport, appDial)
+
+	// The upgraded connections are proxied with the same dialers and TLS
+	// configurations as the other requests.
+	p.fwdUpgradeTLS = newUpgradeForwarder(networkDialerWithContext, func() *tls.Config {
+		p.RLock()
+		defer p.RUnlock()
+		return p.tlsClientConfig.Clone()
+	})
+	p.fwdUpgrade = newUpgradeForwarder(appDialerWithContext, transport.TLSClientConfig.Clone)
+
 	p.fwd, err = forward.New(
 		forward.RoundTripper(NewTriremeRoundTripper(transport)),
-		forward.WebsocketTLSClientConfig(&tls.Config{InsecureSkipVerify: true}),
-		forward.WebSocketNetDial(appDial),
 		forward.BufferPool(bufferpool.NewPool(32*1204)),
 		forward.ErrorHandler(TriremeHTTPErrHandler{}),
 	)
@@ -393,8 +456,10 @@ func (p *Config) RunNetworkServer(ctx context.Context, l net.Listener, encrypted
 		processor = p.processNetRequest
 	}
 
+	// The cleartext connections can be HTTP/2 with prior knowledge, like the
+	// ones of the gRPC clients. HTTP/2 over TLS is negotiated with ALPN.
 	p.server = &http.Server{
-		Handler: http.HandlerFunc(processor),
+		Handler: h2c.NewHandler(http.HandlerFunc(processor), &http2.Server{}),
 	}
 
 	go func() {
@@ -420,6 +485,10 @@ func (p *Config) UpdateSecrets(cert *tls.Certificate, caPool *x509.CertPool, s s
 	p.certPEM = certPEM
 	p.keyPEM = keyPEM
 	p.tlsClientConfig.RootCAs = caPool
+	if s != nil {
+		p.revocation = s.Revocation()
+		p.issuers = revocation.ParseCertificates(s.CertAuthority())
+	}
 	p.Unlock()
 
 	p.metadata.UpdateSecrets([]byte(certPEM), []byte(keyPEM))
@@ -565,7 +634,7 @@ func (p *Config) processAppRequest(w http.ResponseWriter, r *http.Request) {
 			state.Stats.PolicyID = resp.NetworkPolicyID
 			p.collector.CollectFlowEvent(state.Stats)
 		}
-		http.Error(w, err.Error(), err.(*apiauth.AuthError).Status())
+		httpError(w, r, err.Error(), err.(*apiauth.AuthError).Status())
 		return
 	}
 
@@ -584,7 +653,7 @@ func (p *Config) processAppRequest(w http.ResponseWriter, r *http.Request) {
 				return
 			}
 		} else {
-			http.Error(w, "Invalid hook configuration", http.StatusInternalServerError)
+			httpError(w, r, "Invalid hook configuration", http.StatusInternalServerError)
 			return
 		}
 	}
@@ -594,10 +663,16 @@ func (p *Config) processAppRequest(w http.ResponseWriter, r *http.Request) {
 		httpScheme = "https://"
 	}
 
-	// Create the new target URL based on the Host parameter that we had.
-	r.URL, err = url.ParseRequestURI(httpScheme + r.Host)
+	// Create the new target URL based on the Host parameter that we had. The
+	// cleartext gRPC calls are dialed by address.
+	host := r.Host
+	if isGRPCRequest(r) && !resp.TLSListener {
+		host = originalDestination.String()
+	}
+
+	r.URL, err = url.ParseRequestURI(httpScheme + host)
 	if err != nil {
-		http.Error(w, "Invalid destination host name", http.StatusUnprocessableEntity)
+		httpError(w, r, "Invalid destination host name", http.StatusUnprocessableEntity)
 		return
 	}
 
@@ -610,7 +685,14 @@ func (p *Config) processAppRequest(w http.ResponseWriter, r *http.Request) {
 
 	contextWithStats := context.WithValue(r.Context(), statsContextKey, state)
 	// Forward the request.
-	p.fwdTLS.ServeHTTP(w, r.WithContext(contextWithStats))
+	switch {
+	case isUpgradeRequest(r):
+		p.fwdUpgradeTLS.ServeHTTP(w, r.WithContext(contextWithStats))
+	case isGRPCRequest(r):
+		p.fwdGRPCTLS.ServeHTTP(w, r.WithContext(contextWithStats))
+	default:
+		p.fwdTLS.ServeHTTP(w, r.WithContext(contextWithStats))
+	}
 }
 
 func (p *Config) processNetRequest(w http.ResponseWriter, r *http.Request) {
@@ -621,7 +703,7 @@ func (p *Config) processNetRequest(w http.ResponseWriter, r *http.Request) {
 	sourceAddress, err := net.ResolveTCPAddr("tcp", r.RemoteAddr)
 	if err != nil {
 		zap.L().Error("Internal server error - cannot determine source address information", zap.Error(err))
-		http.Error(w, "Invalid network information", http.StatusForbidden)
+		httpError(w, r, "Invalid network information", http.StatusForbidden)
 		return
 	}
 
@@ -710,13 +792,13 @@ func (p *Config) processNetRequest(w http.ResponseWriter, r *http.Request) {
 		)
 		authError, ok := err.(*apiauth.AuthError)
 		if !ok {
-			http.Error(w, "Internal type error", http.StatusInternalServerError)
+			httpError(w, r, "Internal type error", http.StatusInternalServerError)
 			return
 		}
 
 		if response == nil {
 			// Basic errors are captured here.
-			http.Error(w, authError.Message(), authError.Status())
+			httpError(w, r, authError.Message(), authError.Status())
 			return
 		}
 
@@ -724,9 +806,10 @@ func (p *Config) processNetRequest(w http.ResponseWriter, r *http.Request) {
 			pr.Error = response.DropReason
 		}
 
-		if !response.Redirect {
-			// If there is no redirect, we also return an error.
-			http.Error(w, authError.Message(), authError.Status())
+		if !response.Redirect || isGRPCRequest(r) {
+			// If there is no redirect, we also return an error. The gRPC
+			// clients can not follow redirects.
+			httpError(w, r, authError.Message(), authError.Status())
 			return
 		}
 
@@ -741,22 +824,43 @@ func (p *Config) processNetRequest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The certificates of the clients are checked again in case the CRLs
+	// have been updated since the handshake.
+	if r.TLS != nil {
+		p.RLock()
+		checker := p.revocation
+		p.RUnlock()
+
+		if rerr := checker.VerifyChains(r.TLS.VerifiedChains); rerr != nil {
+			state.Stats.Action = policy.Reject | policy.Log
+			if rerr == revocation.ErrRevoked {
+				state.Stats.DropReason = collector.RevokedCertificate
+				response.PUContext.Counters().IncrementCounter(counters.ErrProxyCertificateRevoked)
+			} else {
+				state.Stats.DropReason = collector.RevocationUnknown
+				response.PUContext.Counters().IncrementCounter(counters.ErrProxyRevocationUnknown)
+			}
+			httpError(w, r, fmt.Sprintf("Access denied: %s", rerr), http.StatusForbidden)
+			return
+		}
+	}
+
 	// Select as http or https for communication with listening service.
 	httpPrefix := "http://"
 	if response.TLSListener {
 		httpPrefix = "https://"
 	}
 
-	// Create the target URI. Websocket Gorilla proxy takes it from the URL. For normal
-	// connections we don't want that.
-	if forward.IsWebsocketRequest(r) {
+	// Create the target URI. The upgraded connections and the gRPC calls are dialed
+	// by address. For normal connections we don't want that.
+	if isUpgradeRequest(r) || isGRPCRequest(r) {
 		r.URL, err = url.ParseRequestURI(httpPrefix + originalDestination.String())
 	} else {
 		r.URL, err = url.ParseRequestURI(httpPrefix + r.Host)
 	}
 	if err != nil {
 		state.Stats.DropReason = collector.InvalidFormat
-		http.Error(w, fmt.Sprintf("Invalid HTTP Host parameter: %s", err), http.StatusBadRequest)
+		httpError(w, r, fmt.Sprintf("Invalid HTTP Host parameter: %s", err), http.StatusBadRequest)
 		return
 	}
 
@@ -782,7 +886,15 @@ func (p *Config) processNetRequest(w http.ResponseWriter, r *http.Request) {
 	// }
 
 	contextWithStats := context.WithValue(r.Context(), statsContextKey, state)
-	p.fwd.ServeHTTP(w, r.WithContext(contextWithStats))
+	switch {
+	case isUpgradeRequest(r):
+		// The flow is reported once the upgraded connection is closed.
+		p.fwdUpgrade.ServeHTTP(w, r.WithContext(contextWithStats))
+	case isGRPCRequest(r):
+		p.fwdGRPC.ServeHTTP(w, r.WithContext(contextWithStats))
+	default:
+		p.fwd.ServeHTTP(w, r.WithContext(contextWithStats))
+	}
 	zap.L().Debug("Forwarding Request", zap.String("URI", r.RequestURI), zap.String("Host", r.Host))
 }
 
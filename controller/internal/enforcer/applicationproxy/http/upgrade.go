@@ -0,0 +1,270 @@
+package httpproxy
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.aporeto.io/enforcerd/trireme-lib/controller/internal/enforcer/flowstats"
+	"go.uber.org/zap"
+	"golang.org/x/net/http/httpguts"
+)
+
+const (
+	// upgradeIdleTimeout is the time after which an upgraded connection that
+	// has been idle in both directions is closed.
+	upgradeIdleTimeout = 30 * time.Minute
+
+	upgradeBufferSize = 32 * 1024
+)
+
+// isUpgradeRequest returns true if the request asks to switch the connection
+// to another protocol, like the WebSocket handshakes.
+func isUpgradeRequest(r *http.Request) bool {
+	return r.ProtoMajor == 1 &&
+		httpguts.HeaderValuesContainsToken(r.Header["Connection"], "Upgrade") &&
+		r.Header.Get("Upgrade") != ""
+}
+
+// upgradeForwarder forwards the requests that upgrade their connection. The
+// requests are authorized before they are forwarded like any other request.
+// Once the target switches protocols, the connection is hijacked and the
+// stream is proxied in both directions until either side closes it or it
+// is idle for the idle timeout. The bytes of the stream are accounted in the
+// flow record of the request, which is reported when the stream is closed.
+type upgradeForwarder struct {
+	dial        func(ctx context.Context, network, addr string) (net.Conn, error)
+	tlsConfig   func() *tls.Config
+	idleTimeout time.Duration
+}
+
+// newUpgradeForwarder creates an upgrade forwarder. The connections to the
+// targets with the https scheme are wrapped with a copy of the current TLS
+// configuration returned by tlsConfig.
+func newUpgradeForwarder(dial func(ctx context.Context, network, addr string) (net.Conn, error), tlsConfig func() *tls.Config) *upgradeForwarder {
+
+	return &upgradeForwarder{
+		dial:        dial,
+		tlsConfig:   tlsConfig,
+		idleTimeout: upgradeIdleTimeout,
+	}
+}
+
+// ServeHTTP forwards the request to the target of the request URL and proxies
+// the upgraded stream. The path of the request is taken from the request URI.
+func (f *upgradeForwarder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "Connection upgrade not supported", http.StatusInternalServerError)
+		return
+	}
+
+	path, err := url.ParseRequestURI(r.RequestURI)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request URI: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	target, err := f.dialTarget(r)
+	if err != nil {
+		TriremeHTTPErrHandler{}.ServeHTTP(w, r, err)
+		return
+	}
+	defer target.Close() // nolint errcheck
+
+	outreq := new(http.Request)
+	*outreq = *r
+	outreq.URL = &url.URL{
+		Scheme:   r.URL.Scheme,
+		Host:     r.URL.Host,
+		Path:     path.Path,
+		RawPath:  path.RawPath,
+		RawQuery: path.RawQuery,
+	}
+
+	if err := outreq.Write(target); err != nil {
+		TriremeHTTPErrHandler{}.ServeHTTP(w, r, err)
+		return
+	}
+
+	targetReader := bufio.NewReader(target)
+	resp, err := http.ReadResponse(targetReader, outreq)
+	if err != nil {
+		TriremeHTTPErrHandler{}.ServeHTTP(w, r, err)
+		return
+	}
+	defer resp.Body.Close() // nolint errcheck
+
+	// The target refused to switch protocols and answered like for any
+	// other request.
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		for k, v := range resp.Header {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body) // nolint errcheck
+		return
+	}
+
+	client, clientBuf, err := hijacker.Hijack()
+	if err != nil {
+		zap.L().Error("Unable to hijack upgraded connection", zap.Error(err))
+		return
+	}
+	defer client.Close() // nolint errcheck
+
+	if err := writeResponseHeader(clientBuf.Writer, resp); err != nil {
+		zap.L().Debug("Unable to send upgrade response", zap.Error(err))
+		return
+	}
+
+	sent, received := f.proxy(client, clientBuf.Reader, target, targetReader)
+
+	if data := r.Context().Value(statsContextKey); data != nil {
+		if state, ok := data.(*flowstats.ConnectionState); ok {
+			state.Stats.BytesSent = sent
+			state.Stats.BytesReceived = received
+		}
+	}
+}
+
+// dialTarget dials the target of the request.
+func (f *upgradeForwarder) dialTarget(r *http.Request) (net.Conn, error) {
+
+	conn, err := f.dial(r.Context(), "tcp", r.URL.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.URL.Scheme != "https" {
+		return conn, nil
+	}
+
+	// The upgrades are only defined for HTTP/1.1.
+	config := f.tlsConfig()
+	config.NextProtos = []string{"http/1.1"}
+	if config.ServerName == "" {
+		config.ServerName = r.URL.Hostname()
+	}
+
+	tlsConn := tls.Client(conn, config)
+	if err := tlsConn.Handshake(); err != nil {
+		conn.Close() // nolint errcheck
+		return nil, err
+	}
+
+	return tlsConn, nil
+}
+
+// proxy copies the stream in both directions until one side closes it or
+// it is idle for the idle timeout. The readers hold the data that has been
+// buffered while reading the upgrade request and response. It returns the
+// bytes sent by the client and the bytes received by the client.
+func (f *upgradeForwarder) proxy(client net.Conn, clientReader io.Reader, target net.Conn, targetReader io.Reader) (uint64, uint64) {
+
+	s := &upgradedStream{
+		idleTimeout: f.idleTimeout,
+	}
+	s.touch()
+
+	var sent, received uint64
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	// The first direction to end closes both connections, which ends the
+	// other direction.
+	go func() {
+		defer wg.Done()
+		sent = s.copy(target, client, clientReader)
+		client.Close() // nolint errcheck
+		target.Close() // nolint errcheck
+	}()
+
+	go func() {
+		defer wg.Done()
+		received = s.copy(client, target, targetReader)
+		client.Close() // nolint errcheck
+		target.Close() // nolint errcheck
+	}()
+
+	wg.Wait()
+
+	return sent, received
+}
+
+// upgradedStream tracks the activity of an upgraded connection in both
+// directions.
+type upgradedStream struct {
+	idleTimeout  time.Duration
+	lastActivity int64
+}
+
+// touch records activity on the connection.
+func (s *upgradedStream) touch() {
+	atomic.StoreInt64(&s.lastActivity, time.Now().UnixNano())
+}
+
+// idle returns true if there has been no activity in either direction for
+// the idle timeout.
+func (s *upgradedStream) idle() bool {
+	last := time.Unix(0, atomic.LoadInt64(&s.lastActivity))
+	return time.Since(last) >= s.idleTimeout
+}
+
+// copy copies one direction of the stream and returns the number of bytes
+// copied. A read deadline is only an idle timeout if the other direction
+// has been idle too.
+func (s *upgradedStream) copy(dst net.Conn, srcConn net.Conn, src io.Reader) uint64 {
+
+	var copied uint64
+	buf := make([]byte, upgradeBufferSize)
+
+	for {
+		srcConn.SetReadDeadline(time.Now().Add(s.idleTimeout)) // nolint errcheck
+
+		n, err := src.Read(buf)
+		if n > 0 {
+			s.touch()
+			dst.SetWriteDeadline(time.Now().Add(s.idleTimeout)) // nolint errcheck
+			if _, werr := dst.Write(buf[:n]); werr != nil {
+				return copied
+			}
+			copied += uint64(n)
+		}
+
+		if err != nil {
+			if nerr, ok := err.(net.Error); ok && nerr.Timeout() && !s.idle() {
+				continue
+			}
+			return copied
+		}
+	}
+}
+
+// writeResponseHeader writes the status line and the headers of the response.
+// The upgraded stream follows them.
+func writeResponseHeader(w *bufio.Writer, resp *http.Response) error {
+
+	if _, err := fmt.Fprintf(w, "HTTP/1.1 %s\r\n", resp.Status); err != nil {
+		return err
+	}
+
+	if err := resp.Header.Write(w); err != nil {
+		return err
+	}
+
+	if _, err := w.WriteString("\r\n"); err != nil {
+		return err
+	}
+
+	return w.Flush()
+}
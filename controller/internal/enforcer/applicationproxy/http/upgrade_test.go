@@ -0,0 +1,138 @@
+package httpproxy
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"go.aporeto.io/enforcerd/trireme-lib/collector"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/internal/enforcer/flowstats"
+)
+
+func TestIsUpgradeRequest(t *testing.T) {
+
+	Convey("Given requests", t, func() {
+
+		Convey("Only the HTTP/1.1 requests with an upgrade should be upgrade requests", func() {
+			r := httptest.NewRequest(http.MethodGet, "/ws", nil)
+			So(isUpgradeRequest(r), ShouldBeFalse)
+
+			r.Header.Set("Connection", "keep-alive, Upgrade")
+			So(isUpgradeRequest(r), ShouldBeFalse)
+
+			r.Header.Set("Upgrade", "websocket")
+			So(isUpgradeRequest(r), ShouldBeTrue)
+
+			r.ProtoMajor = 2
+			So(isUpgradeRequest(r), ShouldBeFalse)
+		})
+	})
+}
+
+func TestUpgradeForwarder(t *testing.T) {
+
+	Convey("Given an upgrade forwarder in front of a service", t, func() {
+
+		service := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/ws" {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+
+			conn, buf, err := w.(http.Hijacker).Hijack()
+			if err != nil {
+				return
+			}
+			defer conn.Close() // nolint errcheck
+
+			buf.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n") // nolint errcheck
+			if err := buf.Flush(); err != nil {
+				return
+			}
+
+			// Echo the stream as it comes.
+			io.Copy(conn, buf) // nolint errcheck
+		}))
+		defer service.Close()
+
+		serviceURL, err := url.Parse(service.URL)
+		So(err, ShouldBeNil)
+
+		state := &flowstats.ConnectionState{Stats: &collector.FlowRecord{}}
+		done := make(chan struct{}, 1)
+
+		fwd := newUpgradeForwarder((&net.Dialer{}).DialContext, func() *tls.Config { return &tls.Config{} })
+		proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.URL = &url.URL{Scheme: "http", Host: serviceURL.Host}
+			fwd.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), statsContextKey, state)))
+			done <- struct{}{}
+		}))
+		defer proxy.Close()
+
+		upgrade := func(path string) (net.Conn, *bufio.Reader, *http.Response) {
+			conn, err := net.Dial("tcp", proxy.Listener.Addr().String())
+			So(err, ShouldBeNil)
+
+			_, err = conn.Write([]byte("GET " + path + " HTTP/1.1\r\nHost: service\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n"))
+			So(err, ShouldBeNil)
+
+			reader := bufio.NewReader(conn)
+			resp, err := http.ReadResponse(reader, nil)
+			So(err, ShouldBeNil)
+
+			return conn, reader, resp
+		}
+
+		Convey("The upgraded stream should be proxied in both directions and accounted", func() {
+			conn, reader, resp := upgrade("/ws")
+			defer conn.Close() // nolint errcheck
+
+			So(resp.StatusCode, ShouldEqual, http.StatusSwitchingProtocols)
+			So(resp.Header.Get("Upgrade"), ShouldEqual, "echo")
+
+			for _, msg := range []string{"ping1\n", "ping2\n"} {
+				_, err := conn.Write([]byte(msg))
+				So(err, ShouldBeNil)
+
+				line, err := reader.ReadString('\n')
+				So(err, ShouldBeNil)
+				So(line, ShouldEqual, msg)
+			}
+
+			So(conn.Close(), ShouldBeNil)
+			<-done
+
+			So(state.Stats.BytesSent, ShouldEqual, 12)
+			So(state.Stats.BytesReceived, ShouldEqual, 12)
+		})
+
+		Convey("When the service refuses the upgrade, its response should be forwarded", func() {
+			conn, _, resp := upgrade("/other")
+			defer conn.Close() // nolint errcheck
+
+			So(resp.StatusCode, ShouldEqual, http.StatusForbidden)
+		})
+
+		Convey("When the upgraded stream is idle, it should be closed", func() {
+			fwd.idleTimeout = 100 * time.Millisecond
+
+			conn, reader, resp := upgrade("/ws")
+			defer conn.Close() // nolint errcheck
+
+			So(resp.StatusCode, ShouldEqual, http.StatusSwitchingProtocols)
+
+			conn.SetReadDeadline(time.Now().Add(5 * time.Second)) // nolint errcheck
+			_, err := reader.ReadByte()
+			So(err, ShouldEqual, io.EOF)
+			<-done
+		})
+	})
+}
@@ -19,8 +19,10 @@ import (
 	"go.aporeto.io/enforcerd/trireme-lib/controller/internal/enforcer/applicationproxy/serviceregistry"
 	"go.aporeto.io/enforcerd/trireme-lib/controller/internal/enforcer/applicationproxy/tcp/verifier"
 	"go.aporeto.io/enforcerd/trireme-lib/controller/internal/enforcer/applicationproxy/tlshelper"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/counters"
 	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/pucontext"
 	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/secrets"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/secrets/revocation"
 	"go.aporeto.io/enforcerd/trireme-lib/policy"
 	"go.uber.org/zap"
 )
@@ -40,6 +42,13 @@ type Proxy struct {
 	// Verfier implements ID and IP ACL rules using the Peer Certificate Validation Handler
 	verifier verifier.Verifier
 
+	// revocation checks the certificates of the peers against the CRLs of the secrets
+	revocation *revocation.Checker
+	// stapler staples the OCSP responses of the certificate
+	stapler *revocation.Stapler
+	// issuers are the authorities of the secrets used to request the OCSP responses
+	issuers []*x509.Certificate
+
 	// List of local IP's
 	localIPs map[string]struct{}
 
@@ -64,6 +73,7 @@ func NewTCPProxy(
 		collector:    c,
 		puID:         puID,
 		verifier:     verifier.New(caPool),
+		stapler:      revocation.NewStapler(),
 		localIPs:     localIPs,
 		certificate:  certificate,
 		caPool:       caPool,
@@ -111,6 +121,11 @@ func (p *Proxy) UpdateSecrets(
 	p.certificate = cert
 	p.caPool = caPool
 
+	if s != nil {
+		p.revocation = s.Revocation()
+		p.issuers = revocation.ParseCertificates(s.CertAuthority())
+	}
+
 	p.verifier.TrustCAs(caPool)
 }
 
@@ -286,6 +301,7 @@ func (p *Proxy) startEncryptedClientDataPath(
 	if p.certificate != nil {
 		certs = append(certs, *p.certificate)
 	}
+	checker := p.revocation
 	p.RUnlock()
 
 	t, err := getClientTLSConfig(ca, certs, serverName, service.External)
@@ -294,6 +310,9 @@ func (p *Proxy) startEncryptedClientDataPath(
 	}
 
 	t.VerifyPeerCertificate = func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+		if err := reportRevocation(checker.VerifyChains(verifiedChains), pr); err != nil {
+			return err
+		}
 		return p.verifier.VerifyPeerCertificate(rawCerts, verifiedChains, pr, false)
 	}
 
@@ -302,6 +321,16 @@ func (p *Proxy) startEncryptedClientDataPath(
 	defer tlsConn.Close() // nolint errcheck
 	downConn = tlsConn
 
+	// The handshake is done before any data is sent so that the OCSP
+	// response stapled by the server is checked.
+	if err := tlsConn.Handshake(); err != nil {
+		return err
+	}
+
+	if err := reportRevocation(verifyStapledResponse(checker, tlsConn.ConnectionState()), pr); err != nil {
+		return err
+	}
+
 	zap.L().Debug(
 		"Handle client connection",
 		zap.String("src", upConn.RemoteAddr().String()),
@@ -347,8 +376,9 @@ func (p *Proxy) startEncryptedServerDataPath(
 	caPool := p.caPool
 	clientCerts := []tls.Certificate{}
 	if p.certificate != nil {
-		clientCerts = []tls.Certificate{*p.certificate}
+		clientCerts = []tls.Certificate{*p.stapler.Staple(p.certificate, p.issuers)}
 	}
+	checker := p.revocation
 	p.RUnlock()
 
 	tlsConfig, err := getServerTLSConfig(
@@ -364,6 +394,9 @@ func (p *Proxy) startEncryptedServerDataPath(
 	if tlsConfig != nil {
 		// Register Peer Certificate Verification so we can apply policies.
 		tlsConfig.VerifyPeerCertificate = func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+			if err := reportRevocation(checker.VerifyChains(verifiedChains), pr); err != nil {
+				return err
+			}
 			return p.verifier.VerifyPeerCertificate(rawCerts, verifiedChains, pr, tlsConfig.ClientAuth == tls.RequireAndVerifyClientCert)
 		}
 
@@ -506,6 +539,40 @@ func (p *Proxy) isLocal(conn net.Conn) bool {
 	return false
 }
 
+// verifyStapledResponse checks the OCSP response stapled by the server, if
+// there is one, against the verified chain of the server.
+func verifyStapledResponse(checker *revocation.Checker, state tls.ConnectionState) error {
+
+	if len(state.OCSPResponse) == 0 {
+		return nil
+	}
+
+	for _, chain := range state.VerifiedChains {
+		if len(chain) < 2 {
+			continue
+		}
+		return checker.CheckOCSP(state.OCSPResponse, chain[0], chain[1])
+	}
+
+	return nil
+}
+
+// reportRevocation reports and counts the connections rejected because of the
+// revocation of the certificate of the peer.
+func reportRevocation(err error, pr *lookup) error {
+
+	switch err {
+	case nil:
+		return nil
+	case revocation.ErrRevoked:
+		pr.ReportStats(collector.EndPointTypePU, "", "default", collector.RevokedCertificate, nil, nil, false)
+		return pr.puContext.Counters().CounterError(counters.ErrProxyCertificateRevoked, err)
+	default:
+		pr.ReportStats(collector.EndPointTypePU, "", "default", collector.RevocationUnknown, nil, nil, false)
+		return pr.puContext.Counters().CounterError(counters.ErrProxyRevocationUnknown, err)
+	}
+}
+
 func logErr(err error) bool {
 	switch err.(type) {
 	case syscall.Errno:
@@ -17,6 +17,7 @@ import (
 	"go.aporeto.io/enforcerd/trireme-lib/controller/internal/enforcer/nfqdatapath/tokenaccessor"
 
 	"go.aporeto.io/enforcerd/trireme-lib/controller/internal/enforcer/utils/ephemeralkeys"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/connection"
 	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/ebpf"
 	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/fqconfig"
 	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/packettracing"
@@ -77,6 +78,10 @@ type DebugInfo interface {
 
 	// DebugCollect collects debug information, such as packet capture
 	DebugCollect(ctx context.Context, contextID string, debugConfig *policy.DebugConfig) error
+
+	// ConnectionTable returns a snapshot of the connections tracked by the datapath
+	// that match the filter. An empty contextID selects the connections of all the PUs.
+	ConnectionTable(ctx context.Context, contextID string, filter *connection.TableFilter) ([]*connection.TableEntry, error)
 }
 
 // enforcer holds all the active implementations of the enforcer
@@ -251,9 +256,20 @@ func (e *enforcer) Ping(ctx context.Context, contextID string, pingConfig *polic
 	}
 }
 
+// DebugCollect starts the native packet capture of the transport path. The other
+// debug collections are handled in remoteenforcer.
 func (e *enforcer) DebugCollect(ctx context.Context, contextID string, debugConfig *policy.DebugConfig) error {
-	// this is handled in remoteenforcer
-	return nil
+
+	if e.transport == nil {
+		return nil
+	}
+
+	return e.transport.DebugCollect(ctx, contextID, debugConfig)
+}
+
+// ConnectionTable returns a snapshot of the connection tables of the transport path.
+func (e *enforcer) ConnectionTable(ctx context.Context, contextID string, filter *connection.TableFilter) ([]*connection.TableEntry, error) {
+	return e.transport.ConnectionTable(ctx, contextID, filter)
 }
 
 // New returns a new policy enforcer that implements both the data paths.
@@ -15,11 +15,13 @@ import (
 	enforcerconstants "go.aporeto.io/enforcerd/trireme-lib/controller/internal/enforcer/constants"
 	"go.aporeto.io/enforcerd/trireme-lib/controller/internal/enforcer/envoyauthorizer/envoyproxy"
 	"go.aporeto.io/enforcerd/trireme-lib/controller/internal/enforcer/metadata"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/connection"
 	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/ebpf"
 	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/fqconfig"
 	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/packettracing"
 	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/pucontext"
 	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/secrets"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/spiffe"
 	"go.aporeto.io/enforcerd/trireme-lib/controller/runtime"
 	"go.aporeto.io/enforcerd/trireme-lib/policy"
 	"go.aporeto.io/enforcerd/trireme-lib/utils/cache"
@@ -39,7 +41,6 @@ type Enforcer struct {
 	clients      cache.DataStore
 	systemCAPool *x509.CertPool
 
-	metadata *metadata.Client
 	sync.RWMutex
 }
 
@@ -48,6 +49,11 @@ type envoyServers struct {
 	ingress *envoyproxy.AuthServer
 	egress  *envoyproxy.AuthServer
 	sds     *envoyproxy.SdsServer
+
+	// metadata holds the SVID and the trust bundle served by the workload
+	// API server.
+	metadata *metadata.Client
+	workload *envoyproxy.WorkloadServer
 }
 
 // NewEnvoyAuthorizerEnforcer creates a new envoy authorizer
@@ -99,7 +105,7 @@ func (e *Enforcer) Secrets() (secrets.Secrets, func()) {
 // here we do the following:
 // 1. create a new PU always and instantiate a new apiAuth, as we want to be as stateless as possible.
 // 2. create a PUcontext as this will be used in auth code.
-// 3. If envoy servers are not present then create all 3 envoy servers.
+// 3. If envoy servers are not present then create all 3 envoy servers and the SPIFFE workload API server.
 // 4. If the servers are already present under policy update then update the service certs.
 func (e *Enforcer) Enforce(ctx context.Context, contextID string, puInfo *policy.PUInfo) error {
 	e.Lock()
@@ -144,11 +150,25 @@ func (e *Enforcer) Enforce(ctx context.Context, contextID string, puInfo *policy
 			zap.L().Error("Cannot create and run SdsServer", zap.Error(err))
 			return err
 		}
+		// The workload API serves the service certificate of the PU as its SVID.
+		metadataClient := metadata.NewClient(contextID, e.tokenIssuer)
+		if err := e.updateWorkloadSecrets(puInfo, metadataClient); err != nil {
+			zap.L().Warn("Service certificates will not be served by the workload API", zap.String("puID", contextID), zap.Error(err))
+		}
+		workloadServer, err := envoyproxy.NewWorkloadServer(contextID, envoyproxy.WorkloadSocketPath(envoyproxy.WorkloadSocketDir, contextID), netNSPath(puInfo.Runtime), metadataClient)
+		if err != nil {
+			zap.L().Error("Cannot create and run WorkloadServer", zap.Error(err))
+			ingressServer.Stop()
+			egressServer.Stop()
+			sdsServer.Stop()
+			return err
+		}
 		// Add the EnvoyServers to our cache
-		if err := e.clients.Add(contextID, &envoyServers{ingress: ingressServer, egress: egressServer, sds: sdsServer}); err != nil {
+		if err := e.clients.Add(contextID, &envoyServers{ingress: ingressServer, egress: egressServer, sds: sdsServer, metadata: metadataClient, workload: workloadServer}); err != nil {
 			ingressServer.Stop()
 			egressServer.Stop()
 			sdsServer.Stop()
+			workloadServer.Stop()
 			return err
 		}
 
@@ -171,6 +191,21 @@ func (e *Enforcer) Enforce(ctx context.Context, contextID string, puInfo *policy
 	return nil
 }
 
+// netNSPath returns the path of the network namespace of a PU, the callers of
+// its workload API must run in it.
+func netNSPath(runtime *policy.PURuntime) string {
+
+	if nsPath := runtime.NSPath(); nsPath != "" {
+		return nsPath
+	}
+
+	if pid := runtime.Pid(); pid > 0 {
+		return fmt.Sprintf("/proc/%d/ns/net", pid)
+	}
+
+	return ""
+}
+
 // processCertificateUpdates processes the certificate information and updates
 // the servers.
 func (e *Enforcer) processCertificateUpdates(puInfo *policy.PUInfo, server *envoyServers, caPool *x509.CertPool) (bool, error) {
@@ -194,6 +229,10 @@ func (e *Enforcer) processCertificateUpdates(puInfo *policy.PUInfo, server *envo
 	if err != nil {
 		return false, fmt.Errorf("Invalid certificates: %s", err)
 	}
+
+	if err := spiffe.VerifyTLSCertificate(&tlsCert, puInfo.Policy.SPIFFEID()); err != nil {
+		return false, fmt.Errorf("Invalid certificates: %s", err)
+	}
 	// Here update the enforcer secrets because we are using the LockedSecrets.
 	// Also, send a update event to the SDS server so it can send a new cert to the envoy Sidecar.
 	// // update all the server certs, the Write lock has already been acquired by the Enforce function, so no need to lock again.
@@ -201,12 +240,50 @@ func (e *Enforcer) processCertificateUpdates(puInfo *policy.PUInfo, server *envo
 	server.egress.UpdateSecrets(&tlsCert, caPool, e.secrets, certPEM, keyPEM)
 	server.sds.UpdateSecrets(&tlsCert, caPool, e.secrets, certPEM, keyPEM)
 
-	if e.metadata != nil {
-		e.metadata.UpdateSecrets([]byte(certPEM), []byte(keyPEM))
-	}
+	// The workload API streams the rotated SVID to the workloads.
+	server.metadata.UpdateSecrets([]byte(certPEM), []byte(keyPEM))
+	server.metadata.UpdateBundle(e.trustBundle(caPEM))
+
 	return true, nil
 }
 
+// updateWorkloadSecrets provides the service certificates of the PU to the
+// metadata client of the workload API.
+func (e *Enforcer) updateWorkloadSecrets(puInfo *policy.PUInfo, m *metadata.Client) error {
+
+	certPEM, keyPEM, caPEM := puInfo.Policy.ServiceCertificates()
+	m.UpdateBundle(e.trustBundle(caPEM))
+	if certPEM == "" || keyPEM == "" {
+		return nil
+	}
+
+	tlsCert, err := tls.X509KeyPair([]byte(certPEM), []byte(keyPEM))
+	if err != nil {
+		return fmt.Errorf("Invalid certificates: %s", err)
+	}
+
+	if err := spiffe.VerifyTLSCertificate(&tlsCert, puInfo.Policy.SPIFFEID()); err != nil {
+		return fmt.Errorf("Invalid certificates: %s", err)
+	}
+
+	m.UpdateSecrets([]byte(certPEM), []byte(keyPEM))
+
+	return nil
+}
+
+// trustBundle returns the authorities that the workloads must trust, that is
+// the CA of the enforcer and the CA of the services.
+func (e *Enforcer) trustBundle(caPEM string) []byte {
+
+	bundle := append([]byte{}, e.secrets.CertAuthority()...)
+	if caPEM != "" {
+		bundle = append(bundle, '\n')
+		bundle = append(bundle, caPEM...)
+	}
+
+	return bundle
+}
+
 func (e *Enforcer) expandCAPool(externalCAs [][]byte) *x509.CertPool {
 	systemPool, err := x509.SystemCertPool()
 	if err != nil {
@@ -242,7 +319,7 @@ func (e *Enforcer) Unenforce(ctx context.Context, contextID string) error {
 
 	var wg sync.WaitGroup
 	shutdownCh := make(chan struct{})
-	wg.Add(3)
+	wg.Add(4)
 	go func() {
 		server.ingress.GracefulStop()
 		wg.Done()
@@ -255,6 +332,10 @@ func (e *Enforcer) Unenforce(ctx context.Context, contextID string) error {
 		server.sds.GracefulStop()
 		wg.Done()
 	}()
+	go func() {
+		server.workload.GracefulStop()
+		wg.Done()
+	}()
 	go func() {
 		wg.Wait()
 		shutdownCh <- struct{}{}
@@ -264,7 +345,7 @@ func (e *Enforcer) Unenforce(ctx context.Context, contextID string) error {
 	case <-shutdownCtx.Done():
 		zap.L().Warn("Graceful shutdown of envoy server did not finish in time. Shutting down hard now...", zap.String("puID", contextID), zap.Error(shutdownCtx.Err()))
 		var wg sync.WaitGroup
-		wg.Add(3)
+		wg.Add(4)
 		go func() {
 			server.ingress.Stop()
 			wg.Done()
@@ -277,6 +358,10 @@ func (e *Enforcer) Unenforce(ctx context.Context, contextID string) error {
 			server.sds.Stop()
 			wg.Done()
 		}()
+		go func() {
+			server.workload.Stop()
+			wg.Done()
+		}()
 		wg.Wait()
 	case <-shutdownCh:
 	}
@@ -350,3 +435,8 @@ func (e *Enforcer) Ping(ctx context.Context, contextID string, pingConfig *polic
 func (e *Enforcer) DebugCollect(ctx context.Context, contextID string, debugConfig *policy.DebugConfig) error {
 	return nil
 }
+
+// ConnectionTable is unimplemented in the envoy authorizer
+func (e *Enforcer) ConnectionTable(ctx context.Context, contextID string, filter *connection.TableFilter) ([]*connection.TableEntry, error) {
+	return nil, nil
+}
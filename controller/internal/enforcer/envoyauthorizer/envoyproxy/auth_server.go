@@ -259,6 +259,7 @@ func (s *AuthServer) ingressCheck(ctx context.Context, checkRequest *ext_auth.Ch
 		RequestURI:          "",
 		Cookie:              requestCookie,
 		TLS:                 nil,
+		SPIFFEID:            source.GetPrincipal(),
 	}
 
 	response, err := s.auth.NetworkRequest(ctx, request)
@@ -0,0 +1,350 @@
+package envoyproxy
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/spiffe/go-spiffe/v2/proto/spiffe/workload"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/internal/enforcer/metadata"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/spiffe"
+	"go.aporeto.io/enforcerd/trireme-lib/monitor/remoteapi/server"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	grpcmetadata "google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// WorkloadSocketDir is the directory of the SPIFFE Workload API sockets
+	// of the PUs. Each PU has its own sub directory that can be mounted in
+	// its workloads.
+	WorkloadSocketDir = "/var/run/aporeto/spiffe"
+
+	workloadSocketName = "agent.sock"
+
+	// workloadSecurityHeader is the metadata that the clients of the
+	// Workload API must send to prove that the request is not forwarded
+	// from somewhere else.
+	workloadSecurityHeader = "workload.spiffe.io"
+)
+
+// WorkloadSocketPath returns the path of the Workload API socket of a PU.
+func WorkloadSocketPath(dir, contextID string) string {
+
+	name := strings.Replace(strings.Trim(contextID, "/"), "/", "_", -1)
+
+	return filepath.Join(dir, name, workloadSocketName)
+}
+
+// WorkloadServer serves the SPIFFE Workload API of a PU over a unix socket.
+// The X.509-SVID of the PU is its service certificate and the trust bundle
+// holds the authorities of the enforcer and of the services. Both are taken
+// from the metadata client of the PU, and they are streamed again to the
+// workloads whenever they are rotated. The JWT-SVIDs are not supported.
+//
+// The socket can be reached by any local user, so the credentials of the
+// callers are recovered from the socket and only the processes in the network
+// namespace of the PU are served.
+type WorkloadServer struct {
+	workload.UnimplementedSpiffeWorkloadAPIServer
+
+	contextID  string
+	socketPath string
+	nsPath     string
+	metadata   *metadata.Client
+
+	grpcServer *grpc.Server
+	listener   net.Listener
+
+	// done ends the streams, since they never end by themselves.
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+var _ workload.SpiffeWorkloadAPIServer = &WorkloadServer{}
+
+// NewWorkloadServer creates the Workload API socket of a PU and starts
+// serving it. The nsPath is the path of the network namespace of the PU.
+func NewWorkloadServer(contextID string, socketPath string, nsPath string, m *metadata.Client) (*WorkloadServer, error) {
+
+	if m == nil {
+		return nil, fmt.Errorf("the metadata client cannot be nil")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(socketPath), 0755); err != nil {
+		return nil, fmt.Errorf("unable to create workload api socket directory: %s", err)
+	}
+
+	if err := os.Remove(socketPath); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("unable to remove stale workload api socket: %s", err)
+	}
+
+	addr, _ := net.ResolveUnixAddr("unix", socketPath)
+	nl, err := net.ListenUnix("unix", addr)
+	if err != nil {
+		return nil, fmt.Errorf("unable to listen on workload api socket: %s", err)
+	}
+	listener := server.NewUIDListener(nl)
+
+	// The workloads of the PU do not run with our user, the callers are
+	// authorized with their credentials.
+	if err := os.Chmod(socketPath, 0666); err != nil {
+		listener.Close() // nolint
+		return nil, fmt.Errorf("unable to update workload api socket permissions: %s", err)
+	}
+
+	s := &WorkloadServer{
+		contextID:  contextID,
+		socketPath: socketPath,
+		nsPath:     nsPath,
+		metadata:   m,
+		grpcServer: grpc.NewServer(),
+		listener:   listener,
+		done:       make(chan struct{}),
+	}
+
+	workload.RegisterSpiffeWorkloadAPIServer(s.grpcServer, s)
+
+	go func() {
+		if err := s.grpcServer.Serve(listener); err != nil {
+			zap.L().Error("Workload API: Error while serving", zap.String("puID", contextID), zap.Error(err))
+		}
+	}()
+
+	zap.L().Debug("Workload API: serving", zap.String("puID", contextID), zap.String("socketPath", socketPath))
+
+	return s, nil
+}
+
+// Stop stops the server and removes its socket.
+func (s *WorkloadServer) Stop() {
+	s.endStreams()
+	s.grpcServer.Stop()
+	os.Remove(s.socketPath) // nolint
+}
+
+// GracefulStop ends the streams, stops the server once the pending requests
+// are done and removes its socket.
+func (s *WorkloadServer) GracefulStop() {
+	s.endStreams()
+	s.grpcServer.GracefulStop()
+	os.Remove(s.socketPath) // nolint
+}
+
+// endStreams ends the pending streams.
+func (s *WorkloadServer) endStreams() {
+	s.stopOnce.Do(func() {
+		close(s.done)
+	})
+}
+
+// FetchX509SVID streams the X.509-SVID of the PU and its trust bundle. A new
+// response is sent every time they are rotated.
+func (s *WorkloadServer) FetchX509SVID(_ *workload.X509SVIDRequest, stream workload.SpiffeWorkloadAPI_FetchX509SVIDServer) error {
+
+	ctx := stream.Context()
+	if err := checkWorkloadSecurityHeader(ctx); err != nil {
+		return err
+	}
+
+	if err := s.authorize(ctx); err != nil {
+		return err
+	}
+
+	updates, cancel := s.metadata.Watch()
+	defer cancel()
+
+	for {
+		svid, err := s.x509SVID()
+		if err != nil {
+			return err
+		}
+
+		if err := stream.Send(&workload.X509SVIDResponse{Svids: []*workload.X509SVID{svid}}); err != nil {
+			zap.L().Debug("Workload API: Unable to send x509 svid", zap.String("puID", s.contextID), zap.Error(err))
+			return err
+		}
+
+		select {
+		case <-updates:
+		case <-ctx.Done():
+			return nil
+		case <-s.done:
+			return nil
+		}
+	}
+}
+
+// FetchX509Bundles streams the trust bundle of the PU. A new response is
+// sent every time it is rotated.
+func (s *WorkloadServer) FetchX509Bundles(_ *workload.X509BundlesRequest, stream workload.SpiffeWorkloadAPI_FetchX509BundlesServer) error {
+
+	ctx := stream.Context()
+	if err := checkWorkloadSecurityHeader(ctx); err != nil {
+		return err
+	}
+
+	if err := s.authorize(ctx); err != nil {
+		return err
+	}
+
+	updates, cancel := s.metadata.Watch()
+	defer cancel()
+
+	for {
+		svid, err := s.x509SVID()
+		if err != nil {
+			return err
+		}
+
+		id, err := spiffe.ParseID(svid.SpiffeId)
+		if err != nil {
+			return status.Error(codes.Internal, err.Error())
+		}
+
+		if err := stream.Send(&workload.X509BundlesResponse{Bundles: map[string][]byte{id.TrustDomain: svid.Bundle}}); err != nil {
+			zap.L().Debug("Workload API: Unable to send x509 bundles", zap.String("puID", s.contextID), zap.Error(err))
+			return err
+		}
+
+		select {
+		case <-updates:
+		case <-ctx.Done():
+			return nil
+		case <-s.done:
+			return nil
+		}
+	}
+}
+
+// x509SVID builds the X.509-SVID of the PU from its service certificate.
+func (s *WorkloadServer) x509SVID() (*workload.X509SVID, error) {
+
+	certPEM := s.metadata.GetCertificate()
+	keyPEM := s.metadata.GetPrivateKey()
+	if len(certPEM) == 0 || len(keyPEM) == 0 {
+		return nil, status.Error(codes.PermissionDenied, "no svid issued for the workload")
+	}
+
+	id, err := spiffe.IDFromCertificatePEM(certPEM)
+	if err != nil {
+		return nil, status.Errorf(codes.PermissionDenied, "service certificate is not an svid: %s", err)
+	}
+
+	keyPair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "invalid service certificate: %s", err)
+	}
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(keyPair.PrivateKey)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unable to encode private key: %s", err)
+	}
+
+	return &workload.X509SVID{
+		SpiffeId:    id.String(),
+		X509Svid:    concatDER(keyPair.Certificate),
+		X509SvidKey: keyDER,
+		Bundle:      certificatesDER(s.metadata.GetBundle()),
+	}, nil
+}
+
+// checkWorkloadSecurityHeader verifies that the request has the security
+// header required by the SPIFFE Workload API specification.
+func checkWorkloadSecurityHeader(ctx context.Context) error {
+
+	md, ok := grpcmetadata.FromIncomingContext(ctx)
+	if !ok || len(md.Get(workloadSecurityHeader)) != 1 || md.Get(workloadSecurityHeader)[0] != "true" {
+		return status.Errorf(codes.InvalidArgument, "security header %s is missing", workloadSecurityHeader)
+	}
+
+	return nil
+}
+
+// authorize validates that the caller runs in the network namespace of the
+// PU. The remote address of the callers is uid:gid:pid.
+func (s *WorkloadServer) authorize(ctx context.Context) error {
+
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return status.Error(codes.PermissionDenied, "unknown caller")
+	}
+
+	parts := strings.Split(p.Addr.String(), ":")
+	if len(parts) != 3 {
+		return status.Error(codes.PermissionDenied, "invalid caller credentials")
+	}
+
+	pid, err := strconv.Atoi(parts[2])
+	if err != nil || pid <= 0 {
+		return status.Error(codes.PermissionDenied, "invalid caller credentials")
+	}
+
+	if !sameNetNS(fmt.Sprintf("/proc/%d/ns/net", pid), s.nsPath) {
+		zap.L().Warn("Workload API: caller does not belong to the PU", zap.String("puID", s.contextID), zap.Int("pid", pid))
+		return status.Error(codes.PermissionDenied, "caller does not belong to the workload")
+	}
+
+	return nil
+}
+
+// sameNetNS returns true if the two paths are the same network namespace.
+func sameNetNS(path, nsPath string) bool {
+
+	if nsPath == "" {
+		return false
+	}
+
+	ns, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+
+	puNS, err := os.Stat(nsPath)
+	if err != nil {
+		return false
+	}
+
+	return os.SameFile(ns, puNS)
+}
+
+// certificatesDER returns the concatenated DER encoding of the certificates
+// of a PEM bundle.
+func certificatesDER(bundle []byte) []byte {
+
+	ders := [][]byte{}
+
+	for {
+		var block *pem.Block
+		block, bundle = pem.Decode(bundle)
+		if block == nil {
+			return concatDER(ders)
+		}
+
+		if block.Type == typeCertificate {
+			ders = append(ders, block.Bytes)
+		}
+	}
+}
+
+// concatDER concatenates DER encoded certificates.
+func concatDER(ders [][]byte) []byte {
+
+	out := []byte{}
+	for _, der := range ders {
+		out = append(out, der...)
+	}
+
+	return out
+}
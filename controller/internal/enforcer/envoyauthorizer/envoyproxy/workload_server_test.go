@@ -0,0 +1,196 @@
+package envoyproxy
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/spiffe/go-spiffe/v2/proto/spiffe/workload"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/internal/enforcer/metadata"
+	"go.aporeto.io/enforcerd/trireme-lib/monitor/remoteapi/server"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	grpcmetadata "google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+type testSVIDStream struct {
+	grpc.ServerStream
+	ctx       context.Context
+	responses chan *workload.X509SVIDResponse
+}
+
+func (s *testSVIDStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *testSVIDStream) Send(r *workload.X509SVIDResponse) error {
+	s.responses <- r
+	return nil
+}
+
+func createSVID(t *testing.T, id string) ([]byte, []byte, []byte) {
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := url.Parse(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "workload"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		URIs:         []*url.URL{u},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, caTemplate, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER})
+}
+
+func TestWorkloadSocketPath(t *testing.T) {
+
+	Convey("The socket paths of the PUs should be in their own directories", t, func() {
+		So(WorkloadSocketPath("/run", "/docker/abc"), ShouldEqual, "/run/docker_abc/agent.sock")
+		So(WorkloadSocketPath("/run", "abc"), ShouldEqual, "/run/abc/agent.sock")
+	})
+}
+
+func TestWorkloadServer(t *testing.T) {
+
+	Convey("Given a workload API server", t, func() {
+
+		dir, err := ioutil.TempDir("", "workload")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir) // nolint
+
+		m := metadata.NewClient("pu", nil)
+		socketPath := WorkloadSocketPath(dir, "pu")
+
+		s, err := NewWorkloadServer("pu", socketPath, "/proc/self/ns/net", m)
+		So(err, ShouldBeNil)
+
+		_, err = os.Stat(socketPath)
+		So(err, ShouldBeNil)
+
+		caller := &peer.Peer{Addr: &server.UIDAddr{Address: fmt.Sprintf("1000:1000:%d", os.Getpid())}}
+		ctx := grpcmetadata.NewIncomingContext(peer.NewContext(context.Background(), caller), grpcmetadata.Pairs(workloadSecurityHeader, "true"))
+		stream := &testSVIDStream{ctx: ctx, responses: make(chan *workload.X509SVIDResponse, 10)}
+
+		Convey("When the security header is missing, the request should be rejected", func() {
+			stream.ctx = context.Background()
+			err := s.FetchX509SVID(&workload.X509SVIDRequest{}, stream)
+			So(status.Code(err), ShouldEqual, codes.InvalidArgument)
+		})
+
+		Convey("When the caller is unknown, the request should be denied", func() {
+			stream.ctx = grpcmetadata.NewIncomingContext(context.Background(), grpcmetadata.Pairs(workloadSecurityHeader, "true"))
+			err := s.FetchX509SVID(&workload.X509SVIDRequest{}, stream)
+			So(status.Code(err), ShouldEqual, codes.PermissionDenied)
+		})
+
+		Convey("When the caller is not in the network namespace of the PU, the request should be denied", func() {
+			certPEM, keyPEM, _ := createSVID(t, "spiffe://example.org/web")
+			m.UpdateSecrets(certPEM, keyPEM)
+			s.nsPath = dir
+
+			err := s.FetchX509SVID(&workload.X509SVIDRequest{}, stream)
+			So(status.Code(err), ShouldEqual, codes.PermissionDenied)
+			So(stream.responses, ShouldBeEmpty)
+		})
+
+		Convey("When there is no service certificate, the request should be denied", func() {
+			err := s.FetchX509SVID(&workload.X509SVIDRequest{}, stream)
+			So(status.Code(err), ShouldEqual, codes.PermissionDenied)
+		})
+
+		Convey("When there is a service certificate, the SVID should be streamed", func() {
+			certPEM, keyPEM, caPEM := createSVID(t, "spiffe://example.org/web")
+			m.UpdateSecrets(certPEM, keyPEM)
+			m.UpdateBundle(caPEM)
+
+			done := make(chan error, 1)
+			go func() {
+				done <- s.FetchX509SVID(&workload.X509SVIDRequest{}, stream)
+			}()
+
+			r := <-stream.responses
+			So(r.Svids, ShouldHaveLength, 1)
+			So(r.Svids[0].SpiffeId, ShouldEqual, "spiffe://example.org/web")
+
+			block, _ := pem.Decode(certPEM)
+			So(r.Svids[0].X509Svid, ShouldResemble, block.Bytes)
+
+			block, _ = pem.Decode(caPEM)
+			So(r.Svids[0].Bundle, ShouldResemble, block.Bytes)
+
+			_, err := x509.ParsePKCS8PrivateKey(r.Svids[0].X509SvidKey)
+			So(err, ShouldBeNil)
+
+			Convey("The rotated SVID should be streamed", func() {
+				newCertPEM, newKeyPEM, _ := createSVID(t, "spiffe://example.org/web")
+				m.UpdateSecrets(newCertPEM, newKeyPEM)
+
+				r := <-stream.responses
+				block, _ := pem.Decode(newCertPEM)
+				So(r.Svids[0].X509Svid, ShouldResemble, block.Bytes)
+
+				s.Stop()
+				So(<-done, ShouldBeNil)
+			})
+		})
+
+		Reset(func() {
+			s.Stop()
+		})
+	})
+}
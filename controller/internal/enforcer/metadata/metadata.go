@@ -1,6 +1,7 @@
 package metadata
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"sync"
@@ -19,6 +20,8 @@ type Client struct {
 	tokenIssuer common.ServiceTokenIssuer
 	certPEM     []byte
 	keyPEM      []byte
+	bundlePEM   []byte
+	watchers    map[chan struct{}]struct{}
 
 	sync.RWMutex
 }
@@ -28,6 +31,7 @@ func NewClient(puContext string, t common.ServiceTokenIssuer) *Client {
 	return &Client{
 		puContext:   puContext,
 		tokenIssuer: t,
+		watchers:    map[chan struct{}]struct{}{},
 	}
 }
 
@@ -36,8 +40,58 @@ func (c *Client) UpdateSecrets(cert, key []byte) {
 	c.Lock()
 	defer c.Unlock()
 
+	if bytes.Equal(c.certPEM, cert) && bytes.Equal(c.keyPEM, key) {
+		return
+	}
+
 	c.certPEM = cert
 	c.keyPEM = key
+	c.notify()
+}
+
+// UpdateBundle updates the trust bundle of the client, that is the
+// authorities that the services of the PU must trust.
+func (c *Client) UpdateBundle(bundle []byte) {
+	c.Lock()
+	defer c.Unlock()
+
+	if bytes.Equal(c.bundlePEM, bundle) {
+		return
+	}
+
+	c.bundlePEM = bundle
+	c.notify()
+}
+
+// Watch returns a channel that is signaled whenever the secrets or the trust
+// bundle of the client are updated, and a function that stops the watch.
+// The updates that happen while the previous one has not been received are
+// coalesced.
+func (c *Client) Watch() (<-chan struct{}, func()) {
+	c.Lock()
+	defer c.Unlock()
+
+	ch := make(chan struct{}, 1)
+	c.watchers[ch] = struct{}{}
+
+	return ch, func() {
+		c.Lock()
+		defer c.Unlock()
+
+		delete(c.watchers, ch)
+	}
+}
+
+// notify signals the watchers of the client. It must be called with the
+// lock held.
+func (c *Client) notify() {
+
+	for ch := range c.watchers {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
 }
 
 // GetCertificate returns back the certificate.
@@ -56,6 +110,14 @@ func (c *Client) GetPrivateKey() []byte {
 	return c.keyPEM
 }
 
+// GetBundle returns the trust bundle of the client.
+func (c *Client) GetBundle() []byte {
+	c.RLock()
+	defer c.RUnlock()
+
+	return c.bundlePEM
+}
+
 // GetCurrentPolicy returns the current policy of the datapath. It returns
 // the marshalled policy as well as the original object for any farther processing.
 func (c *Client) GetCurrentPolicy() ([]byte, *policy.PUPolicyPublic, error) {
@@ -11,6 +11,7 @@ import (
 
 	gomock "github.com/golang/mock/gomock"
 	constants "go.aporeto.io/enforcerd/trireme-lib/controller/constants"
+	connection "go.aporeto.io/enforcerd/trireme-lib/controller/pkg/connection"
 	ebpf "go.aporeto.io/enforcerd/trireme-lib/controller/pkg/ebpf"
 	fqconfig "go.aporeto.io/enforcerd/trireme-lib/controller/pkg/fqconfig"
 	packettracing "go.aporeto.io/enforcerd/trireme-lib/controller/pkg/packettracing"
@@ -270,6 +271,23 @@ func (mr *MockEnforcerMockRecorder) DebugCollect(ctx, contextID, debugConfig int
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DebugCollect", reflect.TypeOf((*MockEnforcer)(nil).DebugCollect), ctx, contextID, debugConfig)
 }
 
+// ConnectionTable mocks base method
+// nolint
+func (m *MockEnforcer) ConnectionTable(ctx context.Context, contextID string, filter *connection.TableFilter) ([]*connection.TableEntry, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ConnectionTable", ctx, contextID, filter)
+	ret0, _ := ret[0].([]*connection.TableEntry)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ConnectionTable indicates an expected call of ConnectionTable
+// nolint
+func (mr *MockEnforcerMockRecorder) ConnectionTable(ctx, contextID, filter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConnectionTable", reflect.TypeOf((*MockEnforcer)(nil).ConnectionTable), ctx, contextID, filter)
+}
+
 // MockDebugInfo is a mock of DebugInfo interface
 // nolint
 type MockDebugInfo struct {
@@ -360,3 +378,20 @@ func (mr *MockDebugInfoMockRecorder) DebugCollect(ctx, contextID, debugConfig in
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DebugCollect", reflect.TypeOf((*MockDebugInfo)(nil).DebugCollect), ctx, contextID, debugConfig)
 }
+
+// ConnectionTable mocks base method
+// nolint
+func (m *MockDebugInfo) ConnectionTable(ctx context.Context, contextID string, filter *connection.TableFilter) ([]*connection.TableEntry, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ConnectionTable", ctx, contextID, filter)
+	ret0, _ := ret[0].([]*connection.TableEntry)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ConnectionTable indicates an expected call of ConnectionTable
+// nolint
+func (mr *MockDebugInfoMockRecorder) ConnectionTable(ctx, contextID, filter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConnectionTable", reflect.TypeOf((*MockDebugInfo)(nil).ConnectionTable), ctx, contextID, filter)
+}
@@ -0,0 +1,369 @@
+package nfqdatapath
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	enforcerconstants "go.aporeto.io/enforcerd/trireme-lib/controller/internal/enforcer/constants"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/packet"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/pcapng"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/pucontext"
+	"go.aporeto.io/enforcerd/trireme-lib/policy"
+	"go.uber.org/zap"
+)
+
+// Defaults of the native packet captures.
+const (
+	defaultCaptureDuration = time.Minute
+	defaultCaptureFileSize = 16 * 1024 * 1024
+	defaultCaptureFiles    = 4
+	captureSnapLength      = 65535
+)
+
+// packetCapture is a native capture of the packets of a PU.
+type packetCapture struct {
+	filter   captureFilter
+	writer   *pcapng.RotatingWriter
+	maxSize  int64
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+func (c *packetCapture) stopCapture() {
+	c.stopOnce.Do(func() {
+		close(c.stop)
+	})
+}
+
+// startPacketCapture starts capturing the packets of a PU to rotating pcapng
+// files. The capture stops when its duration or its size budget is exhausted,
+// or when the PU is unenforced.
+func (d *Datapath) startPacketCapture(contextID string, debugConfig *policy.DebugConfig) error {
+
+	if _, err := d.puFromContextID.Get(contextID); err != nil {
+		return fmt.Errorf("contextID %s does not exist", contextID)
+	}
+
+	if debugConfig.FilePath == "" {
+		return fmt.Errorf("no file path for the capture of %s", contextID)
+	}
+
+	filter, err := parseCaptureFilter(debugConfig.PcapFilter)
+	if err != nil {
+		return err
+	}
+
+	duration := debugConfig.PcapDuration
+	if duration <= 0 && debugConfig.PcapMaxSize <= 0 {
+		duration = defaultCaptureDuration
+	}
+
+	fileSize := debugConfig.PcapFileSize
+	if fileSize <= 0 {
+		fileSize = defaultCaptureFileSize
+	}
+
+	files := debugConfig.PcapFiles
+	if files <= 0 {
+		files = defaultCaptureFiles
+	}
+
+	if _, err := d.packetCaptureCache.Get(contextID); err == nil {
+		return fmt.Errorf("a capture is already running for %s", contextID)
+	}
+
+	writer, err := pcapng.NewRotatingWriter(debugConfig.FilePath, fileSize, files, captureSnapLength)
+	if err != nil {
+		return err
+	}
+
+	c := &packetCapture{
+		filter:  filter,
+		writer:  writer,
+		maxSize: debugConfig.PcapMaxSize,
+		stop:    make(chan struct{}),
+	}
+
+	if err := d.packetCaptureCache.Add(contextID, c); err != nil {
+		writer.Close() // nolint: errcheck
+		return fmt.Errorf("a capture is already running for %s", contextID)
+	}
+	atomic.AddInt32(&d.packetCaptures, 1)
+
+	go func() {
+		var timeout <-chan time.Time
+		if duration > 0 {
+			timer := time.NewTimer(duration)
+			defer timer.Stop()
+			timeout = timer.C
+		}
+
+		select {
+		case <-timeout:
+		case <-c.stop:
+		}
+
+		d.packetCaptureCache.Remove(contextID) // nolint
+		atomic.AddInt32(&d.packetCaptures, -1)
+
+		if err := writer.Close(); err != nil {
+			zap.L().Warn("Unable to close packet capture", zap.String("contextID", contextID), zap.Error(err))
+		}
+
+		zap.L().Info("Packet capture done",
+			zap.String("contextID", contextID),
+			zap.Strings("files", writer.Files()),
+			zap.Int64("bytes", writer.Written()),
+		)
+	}()
+
+	return nil
+}
+
+// stopPacketCapture stops the capture of a PU if there is one.
+func (d *Datapath) stopPacketCapture(contextID string) {
+
+	item, err := d.packetCaptureCache.Get(contextID)
+	if err != nil {
+		return
+	}
+
+	item.(*packetCapture).stopCapture()
+}
+
+// isCapturing returns true if packets are captured for at least one PU.
+func (d *Datapath) isCapturing() bool {
+	return atomic.LoadInt32(&d.packetCaptures) > 0
+}
+
+// capturePacket writes the packet to the capture of its PU.
+func (d *Datapath) capturePacket(msg *debugpacketmessage) {
+
+	if !d.isCapturing() {
+		return
+	}
+
+	var context *pucontext.PUContext
+	switch {
+	case msg.tcpConn != nil:
+		context = msg.tcpConn.Context
+	case msg.udpConn != nil:
+		context = msg.udpConn.Context
+	default:
+		context = d.puFromIP
+	}
+
+	if context == nil {
+		return
+	}
+
+	item, err := d.packetCaptureCache.Get(context.ID())
+	if err != nil {
+		return
+	}
+
+	c := item.(*packetCapture)
+	if !c.filter.matches(msg.p) {
+		return
+	}
+
+	direction := pcapng.DirectionOutbound
+	if msg.network {
+		direction = pcapng.DirectionInbound
+	}
+
+	if err := c.writer.WritePacket(&pcapng.Packet{
+		Timestamp: time.Now(),
+		Data:      msg.p.GetBuffer(0),
+		Length:    int(msg.p.IPTotalLen()),
+		Direction: direction,
+		Comment:   captureComment(msg),
+	}); err != nil {
+		zap.L().Debug("Unable to write captured packet", zap.String("contextID", context.ID()), zap.Error(err))
+		return
+	}
+
+	if c.maxSize > 0 && c.writer.Written() >= c.maxSize {
+		c.stopCapture()
+	}
+}
+
+// captureComment returns the comment of a captured packet with the verdict of
+// the datapath.
+func captureComment(msg *debugpacketmessage) string {
+
+	if msg.err != nil {
+		return fmt.Sprintf("verdict=drop handshake=%t reason=%s", msg.handshake, msg.err.Error())
+	}
+
+	return fmt.Sprintf("verdict=accept handshake=%t", msg.handshake)
+}
+
+// isHandshakePacket returns true if the packet carries a Trireme token.
+func isHandshakePacket(p *packet.Packet) bool {
+
+	switch p.IPProto() {
+	case packet.IPProtocolTCP:
+		if p.GetTCPFlags()&(packet.TCPSynMask|packet.TCPAckMask) == 0 {
+			return false
+		}
+		return p.CheckTCPAuthenticationOption(enforcerconstants.TCPAuthenticationOptionBaseLen) == nil
+
+	case packet.IPProtocolUDP:
+		return p.GetUDPType() != 0
+
+	default:
+		return false
+	}
+}
+
+// captureFilter is a filter of the captured packets. It supports a subset of
+// the pcap filter syntax: the primitives tcp, udp, icmp, host, net and port,
+// optionally qualified by src or dst and negated by not, joined by and.
+type captureFilter []captureTerm
+
+type captureTerm struct {
+	negate    bool
+	kind      string
+	direction string
+	protocol  uint8
+	network   *net.IPNet
+	port      uint16
+}
+
+// parseCaptureFilter parses a filter. An empty filter matches all the packets.
+func parseCaptureFilter(expression string) (captureFilter, error) {
+
+	filter := captureFilter{}
+
+	fields := strings.Fields(expression)
+	for len(fields) > 0 {
+
+		term := captureTerm{}
+
+		if fields[0] == "not" || fields[0] == "!" {
+			term.negate = true
+			fields = fields[1:]
+		}
+
+		if len(fields) > 0 && (fields[0] == "src" || fields[0] == "dst") {
+			term.direction = fields[0]
+			fields = fields[1:]
+		}
+
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("invalid capture filter %q: missing primitive", expression)
+		}
+
+		term.kind = fields[0]
+		fields = fields[1:]
+
+		switch term.kind {
+		case "tcp", "udp", "icmp":
+			if term.direction != "" {
+				return nil, fmt.Errorf("invalid capture filter %q: %s cannot be qualified by %s", expression, term.kind, term.direction)
+			}
+			term.protocol = map[string]uint8{"tcp": packet.IPProtocolTCP, "udp": packet.IPProtocolUDP, "icmp": packet.IPProtocolICMP}[term.kind]
+
+		case "host", "net", "port":
+			if len(fields) == 0 {
+				return nil, fmt.Errorf("invalid capture filter %q: missing value for %s", expression, term.kind)
+			}
+			if err := term.parseValue(fields[0]); err != nil {
+				return nil, fmt.Errorf("invalid capture filter %q: %s", expression, err)
+			}
+			fields = fields[1:]
+
+		default:
+			return nil, fmt.Errorf("invalid capture filter %q: unsupported primitive %s", expression, term.kind)
+		}
+
+		filter = append(filter, term)
+
+		if len(fields) > 0 {
+			if fields[0] != "and" && fields[0] != "&&" {
+				return nil, fmt.Errorf("invalid capture filter %q: only and is supported between primitives", expression)
+			}
+			fields = fields[1:]
+			if len(fields) == 0 {
+				return nil, fmt.Errorf("invalid capture filter %q: missing primitive after and", expression)
+			}
+		}
+	}
+
+	return filter, nil
+}
+
+func (t *captureTerm) parseValue(value string) error {
+
+	switch t.kind {
+	case "host":
+		ip := net.ParseIP(value)
+		if ip == nil {
+			return fmt.Errorf("invalid host %s", value)
+		}
+		bits := 8 * net.IPv6len
+		if ip.To4() != nil {
+			ip = ip.To4()
+			bits = 8 * net.IPv4len
+		}
+		t.network = &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+
+	case "net":
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return fmt.Errorf("invalid net %s", value)
+		}
+		t.network = network
+
+	case "port":
+		port, err := strconv.ParseUint(value, 10, 16)
+		if err != nil {
+			return fmt.Errorf("invalid port %s", value)
+		}
+		t.port = uint16(port)
+	}
+
+	return nil
+}
+
+// matches returns true if the packet matches all the terms of the filter.
+func (f captureFilter) matches(p *packet.Packet) bool {
+
+	for i := range f {
+		if f[i].matches(p) == f[i].negate {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (t *captureTerm) matches(p *packet.Packet) bool {
+
+	switch t.kind {
+	case "tcp", "udp", "icmp":
+		return p.IPProto() == t.protocol
+
+	case "host", "net":
+		src := t.direction != "dst" && t.network.Contains(p.SourceAddress())
+		dst := t.direction != "src" && t.network.Contains(p.DestinationAddress())
+		return src || dst
+
+	case "port":
+		if p.IPProto() != packet.IPProtocolTCP && p.IPProto() != packet.IPProtocolUDP {
+			return false
+		}
+		src := t.direction != "dst" && p.SourcePort() == t.port
+		dst := t.direction != "src" && p.DestPort() == t.port
+		return src || dst
+
+	default:
+		return false
+	}
+}
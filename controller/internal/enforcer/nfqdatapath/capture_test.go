@@ -0,0 +1,196 @@
+// +build linux
+
+package nfqdatapath
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.aporeto.io/enforcerd/trireme-lib/common"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/constants"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/packet"
+	"go.aporeto.io/enforcerd/trireme-lib/policy"
+)
+
+func TestCaptureFilter(t *testing.T) {
+
+	Convey("Given a TCP packet", t, func() {
+		p, err := packet.NewIpv4TCPPacket(1, packet.TCPSynMask, "10.1.1.1", "10.2.2.2", 43758, 443)
+		So(err, ShouldBeNil)
+
+		Convey("An empty filter should match it", func() {
+			filter, err := parseCaptureFilter("")
+			So(err, ShouldBeNil)
+			So(filter.matches(p), ShouldBeTrue)
+		})
+
+		Convey("A filter with the protocol, host and port should match it", func() {
+			filter, err := parseCaptureFilter("tcp and src host 10.1.1.1 and dst port 443 and net 10.2.0.0/16")
+			So(err, ShouldBeNil)
+			So(filter.matches(p), ShouldBeTrue)
+		})
+
+		Convey("A filter with another direction should not match it", func() {
+			filter, err := parseCaptureFilter("dst host 10.1.1.1")
+			So(err, ShouldBeNil)
+			So(filter.matches(p), ShouldBeFalse)
+		})
+
+		Convey("A negated filter should not match it", func() {
+			filter, err := parseCaptureFilter("not port 443")
+			So(err, ShouldBeNil)
+			So(filter.matches(p), ShouldBeFalse)
+
+			filter, err = parseCaptureFilter("! udp")
+			So(err, ShouldBeNil)
+			So(filter.matches(p), ShouldBeTrue)
+		})
+
+		Convey("It should not be a handshake packet without a token", func() {
+			So(isHandshakePacket(p), ShouldBeFalse)
+		})
+	})
+
+	Convey("Given invalid filters", t, func() {
+		for _, expression := range []string{
+			"host",
+			"host 10.1.1",
+			"port 70000",
+			"net 10.0.0.0",
+			"src tcp",
+			"tcp or udp",
+			"tcp and",
+			"portrange 1-10",
+		} {
+			_, err := parseCaptureFilter(expression)
+			So(err, ShouldNotBeNil)
+		}
+	})
+}
+
+func TestCaptureComment(t *testing.T) {
+
+	Convey("Given a packet accepted by the datapath", t, func() {
+		msg := &debugpacketmessage{handshake: true}
+
+		Convey("The comment should have the verdict", func() {
+			So(captureComment(msg), ShouldEqual, "verdict=accept handshake=true")
+		})
+	})
+
+	Convey("Given a packet dropped by the datapath", t, func() {
+		msg := &debugpacketmessage{err: errors.New("no policy")}
+
+		Convey("The comment should have the drop reason", func() {
+			So(captureComment(msg), ShouldEqual, "verdict=drop handshake=false reason=no policy")
+		})
+	})
+}
+
+func TestPacketCapture(t *testing.T) {
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	waitCapture := func(enforcer *Datapath) bool {
+		for i := 0; i < 100; i++ {
+			if !enforcer.isCapturing() {
+				return true
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		return false
+	}
+
+	Convey("Given I setup an enforcer with a connection of a PU", t, func() {
+
+		defer MockGetUDPRawSocket()()
+
+		enforcer, secrets, mockTokenAccessor, _, _ := NewWithMocks(ctrl, "serverID1", constants.LocalServer, []string{"0.0.0.0/0"}, true)
+
+		secrets.EXPECT().TransmittedKey().Return([]byte("dummy")).AnyTimes()
+		secrets.EXPECT().EncodingKey().Return(&ecdsa.PrivateKey{}).AnyTimes()
+		mockTokenAccessor.EXPECT().Sign(gomock.Any(), gomock.Any()).Times(1).Return([]byte("token"), nil).AnyTimes()
+		mockTokenAccessor.EXPECT().CreateSynPacketToken(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return([]byte("token"), nil)
+
+		err := CreatePortPolicy(enforcer, "123456", "/ns1", common.LinuxProcessPU, mockTokenAccessor, "2", 9000, 9000)
+		So(err, ShouldBeNil)
+
+		p, err := packet.NewIpv4TCPPacket(1, packet.TCPSynMask, "10.1.1.1", "127.0.0.1", 43758, 9000)
+		So(err, ShouldBeNil)
+
+		conn, err := enforcer.netSynRetrieveState(p)
+		So(err, ShouldBeNil)
+
+		dir, err := ioutil.TempDir("", "capture")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir) // nolint: errcheck
+
+		debugConfig := &policy.DebugConfig{
+			DebugConfigInput: policy.DebugConfigInput{
+				FilePath:     filepath.Join(dir, "capture.pcapng"),
+				PcapNative:   true,
+				PcapDuration: time.Minute,
+				PcapFiles:    1,
+			},
+		}
+
+		Convey("When I start a capture with a size budget", func() {
+			debugConfig.PcapMaxSize = 1
+			So(enforcer.DebugCollect(context.Background(), "123456", debugConfig), ShouldBeNil)
+			So(enforcer.isCapturing(), ShouldBeTrue)
+
+			Convey("A second capture of the PU should fail", func() {
+				So(enforcer.DebugCollect(context.Background(), "123456", debugConfig), ShouldNotBeNil)
+				enforcer.stopPacketCapture("123456")
+				So(waitCapture(enforcer), ShouldBeTrue)
+			})
+
+			Convey("The packet should be captured and the capture should stop", func() {
+				enforcer.collectTCPPacket(&debugpacketmessage{
+					p:       p,
+					tcpConn: conn,
+					err:     errors.New("dropped"),
+					network: true,
+				})
+				So(waitCapture(enforcer), ShouldBeTrue)
+
+				data, err := ioutil.ReadFile(debugConfig.FilePath)
+				So(err, ShouldBeNil)
+				So(string(data), ShouldContainSubstring, "verdict=drop handshake=false reason=dropped")
+			})
+		})
+
+		Convey("When I start a capture and unenforce the PU", func() {
+			So(enforcer.DebugCollect(context.Background(), "123456", debugConfig), ShouldBeNil)
+			So(enforcer.Unenforce(context.Background(), "123456"), ShouldBeNil)
+
+			Convey("The capture should stop", func() {
+				So(waitCapture(enforcer), ShouldBeTrue)
+			})
+		})
+
+		Convey("When I start a capture with an invalid filter", func() {
+			debugConfig.PcapFilter = "tcp or udp"
+
+			Convey("I should get an error", func() {
+				So(enforcer.DebugCollect(context.Background(), "123456", debugConfig), ShouldNotBeNil)
+				So(enforcer.isCapturing(), ShouldBeFalse)
+			})
+		})
+
+		Convey("When I start a capture of an unknown PU", func() {
+			Convey("I should get an error", func() {
+				So(enforcer.DebugCollect(context.Background(), "unknown", debugConfig), ShouldNotBeNil)
+			})
+		})
+	})
+}
@@ -1,6 +1,7 @@
 package nfqdatapath
 
 import (
+	"go.aporeto.io/enforcerd/trireme-lib/collector"
 	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/counters"
 	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/tokens"
 )
@@ -78,6 +79,10 @@ func netSynCounterFromError(err error) counters.CounterType {
 		return counters.ErrSynTokenExpired
 	case tokens.ErrPublicKeyFailed:
 		return counters.ErrSynPublicKeyFailed
+	case tokens.ErrPublicKeyRevoked:
+		return counters.ErrSynPublicKeyRevoked
+	case tokens.ErrRevocationUnknown:
+		return counters.ErrSynRevocationUnknown
 	case tokens.ErrSharedKeyHashFailed:
 		return counters.ErrSynSharedKeyHashFailed
 	default:
@@ -102,6 +107,10 @@ func netSynAckCounterFromError(err error) counters.CounterType {
 		return counters.ErrSynAckTokenExpired
 	case tokens.ErrPublicKeyFailed:
 		return counters.ErrSynAckPublicKeyFailed
+	case tokens.ErrPublicKeyRevoked:
+		return counters.ErrSynAckPublicKeyRevoked
+	case tokens.ErrRevocationUnknown:
+		return counters.ErrSynAckRevocationUnknown
 	case tokens.ErrSharedKeyHashFailed:
 		return counters.ErrSynAckSharedKeyHashFailed
 	default:
@@ -207,6 +216,10 @@ func netUDPSynCounterFromError(err error) counters.CounterType {
 		return counters.ErrUDPSynTokenExpired
 	case tokens.ErrPublicKeyFailed:
 		return counters.ErrUDPSynPublicKeyFailed
+	case tokens.ErrPublicKeyRevoked:
+		return counters.ErrUDPSynPublicKeyRevoked
+	case tokens.ErrRevocationUnknown:
+		return counters.ErrUDPSynRevocationUnknown
 	case tokens.ErrSharedKeyHashFailed:
 		return counters.ErrUDPSynSharedKeyHashFailed
 	default:
@@ -231,6 +244,10 @@ func netUDPSynAckCounterFromError(err error) counters.CounterType {
 		return counters.ErrUDPSynAckTokenExpired
 	case tokens.ErrPublicKeyFailed:
 		return counters.ErrUDPSynAckPublicKeyFailed
+	case tokens.ErrPublicKeyRevoked:
+		return counters.ErrUDPSynAckPublicKeyRevoked
+	case tokens.ErrRevocationUnknown:
+		return counters.ErrUDPSynAckRevocationUnknown
 	case tokens.ErrSharedKeyHashFailed:
 		return counters.ErrUDPSynAckSharedKeyHashFailed
 	default:
@@ -262,3 +279,18 @@ func netUDPAckCounterFromError(err error) counters.CounterType {
 		return counters.ErrUDPAckInvalidToken
 	}
 }
+
+// dropReasonFromError returns the reason reported for a token that is
+// rejected because of the revocation of the certificate of the peer, or the
+// given reason otherwise.
+func dropReasonFromError(err error, reason string) string {
+
+	switch err {
+	case tokens.ErrPublicKeyRevoked:
+		return collector.RevokedCertificate
+	case tokens.ErrRevocationUnknown:
+		return collector.RevocationUnknown
+	default:
+		return reason
+	}
+}
@@ -19,6 +19,7 @@ import (
 	"go.aporeto.io/enforcerd/trireme-lib/controller/internal/enforcer/dnsproxy"
 	"go.aporeto.io/enforcerd/trireme-lib/controller/internal/enforcer/nfqdatapath/afinetrawsocket"
 	"go.aporeto.io/enforcerd/trireme-lib/controller/internal/enforcer/nfqdatapath/nflog"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/internal/enforcer/nfqdatapath/replaycache"
 	"go.aporeto.io/enforcerd/trireme-lib/controller/internal/enforcer/nfqdatapath/tokenaccessor"
 	"go.aporeto.io/enforcerd/trireme-lib/controller/internal/enforcer/utils/ephemeralkeys"
 	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/connection"
@@ -49,12 +50,13 @@ var collectCounterInterval = 30 * time.Second
 var GetUDPRawSocket = afinetrawsocket.CreateSocket
 
 type debugpacketmessage struct {
-	Mark    int
-	p       *packet.Packet
-	tcpConn *connection.TCPConnection
-	udpConn *connection.UDPConnection
-	err     error
-	network bool
+	Mark      int
+	p         *packet.Packet
+	tcpConn   *connection.TCPConnection
+	udpConn   *connection.UDPConnection
+	err       error
+	network   bool
+	handshake bool
 }
 
 // Datapath is the structure holding all information about a connection filter
@@ -107,6 +109,28 @@ type Datapath struct {
 	// Packettracing Cache :: We don't mark this in pucontext since it gets recreated on every policy update and we need to persist across them
 	packetTracingCache cache.DataStore
 
+	// Packet captures of the PUs, and the number of running captures to
+	// skip the captures quickly when there is none
+	packetCaptureCache cache.DataStore
+	packetCaptures     int32
+
+	// datapathVersions holds the remote IPs that have advertised the datapath
+	// version 2 in their tokens
+	datapathVersions cache.DataStore
+
+	// replayCache records the signed data of the tokens received by the PUs
+	// that detect the replayed tokens. It remembers them for the validity of the
+	// tokens.
+	replayCache     *replaycache.Cache
+	replayCacheOnce sync.Once
+	replayWindow    time.Duration
+
+	// serviceOnce creates the encryption processor, the service, when the
+	// policy of a PU encrypts flows for the first time. serviceEnabled is set
+	// once it is created.
+	serviceOnce    sync.Once
+	serviceEnabled int32
+
 	// mode captures the mode of the enforcer
 	mode constants.ModeType
 
@@ -185,6 +209,14 @@ func (d *Datapath) cacheRemove(cache connection.TCPCache, key string) {
 
 const waitBeforeRemovingConn = 5 * time.Second
 
+// datapathVersionTimeout is the time the datapath version advertised by a
+// remote is remembered.
+const datapathVersionTimeout = 10 * time.Minute
+
+// serviceConnectionTimeout is the idle timeout of the connections that stay
+// in the datapath, like the encrypted connections.
+const serviceConnectionTimeout = time.Hour
+
 // New will create a new data path structure. It instantiates the data stores
 // needed to track sessions. The data path is started with a different call.
 // Only required parameters must be provided. Rest a pre-populated with defaults.
@@ -265,6 +297,9 @@ func New(
 	d.udpNatConnectionTracker = cache.NewCacheWithExpiration("udpNatConnectionTracker", time.Second*60)
 	d.udpFinPacketTracker = cache.NewCacheWithExpiration("udpFinPacketTracker", time.Second*60)
 	d.packetTracingCache = cache.NewCache("PacketTracingCache")
+	d.packetCaptureCache = cache.NewCache("PacketCaptureCache")
+	d.datapathVersions = cache.NewCacheWithExpiration("datapathVersions", datapathVersionTimeout)
+	d.replayWindow = validity
 	d.targetNetworks = acls.NewACLCache()
 	d.ExternalIPCacheTimeout = ExternalIPCacheTimeout
 	d.filterQueue = filterQueue
@@ -354,6 +389,10 @@ func (d *Datapath) Enforce(ctx context.Context, contextID string, puInfo *policy
 		return fmt.Errorf("error creating new pu: %s", err)
 	}
 
+	if encryptionRequired(puInfo.Policy) {
+		d.enableEncryption()
+	}
+
 	// Cache PUs for retrieval based on packet information
 	if pu.Type() != common.ContainerPU {
 
@@ -440,6 +479,9 @@ func (d *Datapath) Unenforce(ctx context.Context, contextID string) error {
 	// this context pointer is about to get lost. reclaims its counters
 	d.reportErrorCounters(pu)
 
+	// Stop the packet capture of the PU
+	d.stopPacketCapture(contextID)
+
 	// Cleanup the mark information
 	if pu.Mark() != "" {
 		if err = d.puFromMark.Remove(pu.Mark()); err != nil {
@@ -639,6 +681,7 @@ func (d *Datapath) reportFlow(p *packet.Packet, src, dst *collector.EndPoint, co
 		SourceController:      sourceController,
 		DestinationController: destinationController,
 		RuleName:              actual.RuleName,
+		ServiceID:             dependentServiceID(context, dst),
 	}
 
 	if context.Annotations() != nil {
@@ -737,15 +780,23 @@ func (d *Datapath) EnableIPTablesPacketTracing(ctx context.Context, contextID st
 	return nil
 }
 
-// DebugCollect collects debug information for remote enforcers
+// DebugCollect starts the native packet capture of a PU. The other debug
+// collections are handled in remoteenforcer.
 func (d *Datapath) DebugCollect(ctx context.Context, contextID string, debugConfig *policy.DebugConfig) error {
-	// this is handled in remoteenforcer
-	return nil
+
+	if debugConfig == nil || !debugConfig.PcapNative {
+		return nil
+	}
+
+	return d.startPacketCapture(contextID, debugConfig)
 }
 
 func (d *Datapath) collectUDPPacket(msg *debugpacketmessage) {
 	var value interface{}
 	var err error
+
+	d.capturePacket(msg)
+
 	report := &collector.PacketReport{
 		Payload: make([]byte, 64),
 	}
@@ -810,6 +861,8 @@ func (d *Datapath) collectTCPPacket(msg *debugpacketmessage) {
 	var err error
 	var report *collector.PacketReport
 
+	d.capturePacket(msg)
+
 	if msg.tcpConn == nil {
 		if d.puFromIP == nil {
 			return
@@ -897,6 +950,77 @@ func (d *Datapath) Ping(ctx context.Context, contextID string, pingConfig *polic
 	return d.initiatePingHandshake(ctx, context, pingConfig)
 }
 
+// ConnectionTable returns a snapshot of the TCP and UDP connections tracked by
+// the datapath that match the filter. If the contextID is not empty, only the
+// connections of this PU are returned.
+func (d *Datapath) ConnectionTable(ctx context.Context, contextID string, filter *connection.TableFilter) ([]*connection.TableEntry, error) {
+
+	if contextID != "" {
+		if _, err := d.puFromContextID.Get(contextID); err != nil {
+			return nil, fmt.Errorf("unable to find context with ID %s in cache: %v", contextID, err)
+		}
+	}
+
+	now := time.Now()
+	entries := []*connection.TableEntry{}
+
+	add := func(entry *connection.TableEntry) {
+		if contextID != "" && entry.ContextID != contextID {
+			return
+		}
+		if filter.Matches(entry) {
+			entries = append(entries, entry)
+		}
+	}
+
+	tcpCaches := []struct {
+		cache  connection.TCPCache
+		client bool
+	}{
+		{cache: d.tcpClient, client: true},
+		{cache: d.tcpServer, client: false},
+	}
+
+	for _, c := range tcpCaches {
+		if c.cache == nil {
+			continue
+		}
+		for _, key := range c.cache.KeyList() {
+			if conn, exists := c.cache.Get(key); exists {
+				add(conn.TableEntry(key, c.client, now))
+			}
+		}
+	}
+
+	udpCaches := []struct {
+		cache  cache.DataStore
+		client bool
+	}{
+		{cache: d.udpAppOrigConnectionTracker, client: true},
+		{cache: d.udpNetOrigConnectionTracker, client: false},
+	}
+
+	for _, c := range udpCaches {
+		if c.cache == nil {
+			continue
+		}
+		for _, key := range c.cache.KeyList() {
+			item, err := c.cache.Get(key)
+			if err != nil {
+				continue
+			}
+			conn, ok := item.(*connection.UDPConnection)
+			if !ok {
+				continue
+			}
+			hash, _ := key.(string)
+			add(conn.TableEntry(hash, c.client, now))
+		}
+	}
+
+	return entries, nil
+}
+
 // tcpConnectionExpirationNotifier handles processing the expiration of an element
 func (d *Datapath) tcpConnectionExpirationFunc(conn *connection.TCPConnection) {
 
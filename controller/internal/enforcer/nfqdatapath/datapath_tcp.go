@@ -17,6 +17,7 @@ import (
 	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/pucontext"
 	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/tokens"
 	"go.aporeto.io/enforcerd/trireme-lib/policy"
+	markconstants "go.aporeto.io/enforcerd/trireme-lib/utils/constants"
 	"go.uber.org/zap"
 )
 
@@ -102,11 +103,26 @@ func (d *Datapath) processNetworkTCPPackets(p *packet.Packet) (*connection.TCPCo
 		return conn, f, nil
 	}
 
+	if d.packetProcessor() != nil {
+		if !d.packetProcessor().PreProcessTCPNetPacket(p, conn.Context, conn) {
+			p.Print(packet.PacketFailureService, d.PacketLogsEnabled())
+			return conn, nil, conn.Context.Counters().CounterError(counters.ErrNetServicePreProcessorFailed, errors.New("pre service processing failed for network packet"))
+		}
+	}
+
 	f, err = d.processNetworkTCPPacket(p, conn.Context, conn)
 	if err != nil {
 		debugLogs("Rejecting packet")
 		return conn, nil, err
 	}
+
+	if d.packetProcessor() != nil {
+		if !d.packetProcessor().PostProcessTCPNetPacket(p, nil, &conn.Auth.ConnectionClaims, conn.Context, conn) {
+			p.Print(packet.PacketFailureService, d.PacketLogsEnabled())
+			return conn, nil, conn.Context.Counters().CounterError(counters.ErrNetServicePostProcessorFailed, errors.New("post service processing failed for network packet"))
+		}
+	}
+
 	return conn, f, nil
 }
 
@@ -188,12 +204,26 @@ func (d *Datapath) processApplicationTCPPackets(p *packet.Packet) (conn *connect
 		return conn, nil
 	}
 
+	if d.packetProcessor() != nil {
+		if !d.packetProcessor().PreProcessTCPAppPacket(p, conn.Context, conn) {
+			p.Print(packet.PacketFailureService, d.PacketLogsEnabled())
+			return conn, conn.Context.Counters().CounterError(counters.ErrAppServicePreProcessorFailed, errors.New("pre service processing failed for application packet"))
+		}
+	}
+
 	err = d.processApplicationTCPPacket(p, conn.Context, conn)
 	if err != nil {
 		debugLogs("Dropping packet")
 		return conn, err
 	}
 
+	if d.packetProcessor() != nil {
+		if !d.packetProcessor().PostProcessTCPAppPacket(p, nil, conn.Context, conn) {
+			p.Print(packet.PacketFailureService, d.PacketLogsEnabled())
+			return conn, conn.Context.Counters().CounterError(counters.ErrAppServicePostProcessorFailed, errors.New("post service processing failed for application packet"))
+		}
+	}
+
 	return conn, nil
 }
 
@@ -229,7 +259,12 @@ func (d *Datapath) processApplicationSynPacket(tcpPacket *packet.Packet, context
 
 	var tcpData []byte
 
-	conn.Secrets, conn.Auth.LocalDatapathPrivateKey, tcpData = context.GetSynToken(nil, conn.Auth.Nonce, nil)
+	conn.Auth.DatapathVersion = d.synDatapathVersion(tcpPacket, conn)
+	claimsHeader := claimsheader.NewClaimsHeader(
+		claimsheader.OptionDatapathVersion(conn.Auth.DatapathVersion),
+	)
+
+	conn.Secrets, conn.Auth.LocalDatapathPrivateKey, tcpData = context.GetSynToken(nil, conn.Auth.Nonce, claimsHeader)
 
 	buffer := append(tcpPacket.GetBuffer(0), []byte{packet.TCPAuthenticationOption, enforcerconstants.TCPAuthenticationOptionBaseLen, 0, 0}...)
 	buffer = append(buffer, tcpData...)
@@ -303,11 +338,18 @@ func (d *Datapath) processApplicationAckPacket(tcpPacket *packet.Packet, context
 
 		conn.SetState(connection.TCPAckSend)
 
+		if conn.ServiceConnection {
+			d.markEncryptedFlow(tcpPacket, false)
+		}
+
 		return nil
 	}
 
 	// If we are already in the connection.TCPData connection just forward the packet
 	if conn.GetState() == connection.TCPData {
+		if conn.ServiceConnection {
+			conn.ResetTimer(serviceConnectionTimeout)
+		}
 		return nil
 	}
 
@@ -344,6 +386,14 @@ func (d *Datapath) processApplicationAckPacket(tcpPacket *packet.Packet, context
 	// state. We will not release the caches though to deal with re-transmissions.
 	// We will let the caches expire.
 	if conn.GetState() == connection.TCPAckSend {
+		// Encrypted connections stay in the datapath.
+		if conn.ServiceConnection {
+			conn.ResetTimer(serviceConnectionTimeout)
+			conn.SetState(connection.TCPData)
+			conn.Context.Counters().IncrementCounter(counters.ErrEncrConnectionsProcessed)
+			return nil
+		}
+
 		if tcpPacket.SourceAddress().String() != tcpPacket.DestinationAddress().String() &&
 			!(tcpPacket.SourceAddress().IsLoopback() && tcpPacket.DestinationAddress().IsLoopback()) {
 
@@ -391,15 +441,24 @@ func (d *Datapath) clientIdentityAllowed(context *pucontext.PUContext, token []b
 
 	if err != nil {
 		zap.L().Error("Syn token Parse Error", zap.String("flow", tcpPacket.L4FlowHash()), zap.Error(err))
-		d.reportRejectedFlow(tcpPacket, conn, collector.DefaultEndPoint, context.ManagementID(), context, collector.InvalidToken, nil, nil, false)
+		d.reportRejectedFlow(tcpPacket, conn, collector.DefaultEndPoint, context.ManagementID(), context, dropReasonFromError(err, collector.InvalidToken), nil, nil, false)
 		return conn.Context.Counters().CounterError(netSynCounterFromError(err), err)
 	}
 
+	if d.tokenReplayed(context, tcpPacket, token, conn.GetStateString()) {
+		return conn.Context.Counters().CounterError(counters.ErrSynReplayed, errors.New("syn token replayed"))
+	}
+
 	conn.Auth.SecretKey = secretKey
 	conn.Auth.RemoteNonce = remoteNonce
 	conn.Auth.RemoteContextID = remoteContextID
 	conn.Auth.Proto314 = proto314
 
+	// The syn/ack token uses the datapath version of the syn token.
+	if claimsHeader != nil {
+		conn.Auth.DatapathVersion = claimsHeader.DatapathVersion()
+	}
+
 	if controller != nil &&
 		((!controller.SameController) ||
 			(claimsHeader != nil && claimsHeader.Ping())) {
@@ -448,6 +507,8 @@ func (d *Datapath) clientIdentityAllowed(context *pucontext.PUContext, token []b
 	}
 
 	if !pkt.Action.Rejected() || allow {
+		// The payload of the connection is encrypted if our policy requires it.
+		conn.ServiceConnection = d.packetProcessor() != nil && !allow && pkt.Action.Encrypted()
 		return nil
 	}
 
@@ -485,19 +546,27 @@ func (d *Datapath) processNetworkSynPacket(context *pucontext.PUContext, conn *c
 			claimsHeader.SetPing(true)
 		}
 
+		claimsHeader.SetEncrypt(conn.ServiceConnection)
+
 		claims := &tokens.ConnectionClaims{
 			CT:       context.CompressedTags(),
 			LCL:      conn.Auth.Nonce[:],
 			RMT:      conn.Auth.RemoteNonce,
-			DEKV1:    conn.Auth.LocalDatapathPublicKeyV1,
-			SDEKV1:   conn.Auth.LocalDatapathPublicKeySignV1,
-			DEKV2:    conn.Auth.LocalDatapathPublicKeyV2,
-			SDEKV2:   conn.Auth.LocalDatapathPublicKeySignV2,
 			ID:       context.ManagementID(),
 			RemoteID: conn.Auth.RemoteContextID,
 			P:        pingPayload,
 		}
 
+		if conn.Auth.DatapathVersion == claimsheader.DatapathVersion2 {
+			claims.DEKV3 = conn.Auth.LocalDatapathPublicKeyV3
+			claims.SDEKV3 = conn.Auth.LocalDatapathPublicKeySignV3
+		} else {
+			claims.DEKV1 = conn.Auth.LocalDatapathPublicKeyV1
+			claims.SDEKV1 = conn.Auth.LocalDatapathPublicKeySignV1
+			claims.DEKV2 = conn.Auth.LocalDatapathPublicKeyV2
+			claims.SDEKV2 = conn.Auth.LocalDatapathPublicKeySignV2
+		}
+
 		if conn.Auth.SynAckToken, err = d.tokenAccessor.CreateSynAckPacketToken(conn.Auth.Proto314, claims, conn.EncodedBuf[:], conn.Auth.Nonce[:], claimsHeader, conn.Secrets, conn.Auth.SecretKey); err != nil {
 			zap.L().Error("Syn/Ack token create failed", zap.String("flow", tcpPacket.L4FlowHash()), zap.Error(err))
 			conn.Context.Counters().CounterError(appSynCounterFromError(err), err) //nolint
@@ -685,15 +754,21 @@ func (d *Datapath) serverIdentityAllowed(context *pucontext.PUContext, token []b
 
 	if err != nil {
 		zap.L().Error("Syn/Ack token parse error", zap.String("flow", tcpPacket.L4FlowHash()), zap.Error(err))
-		d.reportRejectedFlow(tcpPacket, conn, collector.DefaultEndPoint, context.ManagementID(), context, collector.InvalidToken, nil, nil, true)
+		d.reportRejectedFlow(tcpPacket, conn, collector.DefaultEndPoint, context.ManagementID(), context, dropReasonFromError(err, collector.InvalidToken), nil, nil, true)
 		return context.Counters().CounterError(netSynAckCounterFromError(err), err)
 	}
 
+	if d.tokenReplayed(context, tcpPacket, token, conn.GetStateString()) {
+		return context.Counters().CounterError(counters.ErrSynAckReplayed, errors.New("synack token replayed"))
+	}
+
 	conn.Auth.SecretKey = secretKey
 	conn.Auth.RemoteNonce = remoteNonce
 	conn.Auth.RemoteContextID = remoteContextID
 	conn.Auth.Proto314 = proto314
 
+	d.updateDatapathVersion(tcpPacket.SourceAddress().String(), claimsHeader)
+
 	if controller != nil && ((conn.PingEnabled()) || (!controller.SameController)) {
 		conn.DestinationController = controller.Controller
 	}
@@ -736,6 +811,16 @@ func (d *Datapath) serverIdentityAllowed(context *pucontext.PUContext, token []b
 		return context.Counters().CounterError(counters.ErrSynAckRejected, fmt.Errorf("ErrSynAckRejected"))
 	}
 
+	// The server decides if the payload is encrypted. Reject the connection if
+	// our policy requires encryption and the server does not encrypt, or if we
+	// can not encrypt.
+	encrypt := claimsHeader != nil && claimsHeader.Encrypt()
+	if (pkt.Action.Encrypted() && !encrypt) || (encrypt && d.packetProcessor() == nil) {
+		d.reportRejectedFlow(tcpPacket, conn, conn.Auth.RemoteContextID, context.ManagementID(), context, collector.EncryptionMismatch, report, pkt, true)
+		return context.Counters().CounterError(counters.ErrSynAckEncryptionMismatch, fmt.Errorf("ErrSynAckEncryptionMismatch"))
+	}
+	conn.ServiceConnection = encrypt
+
 	return nil
 }
 
@@ -752,6 +837,12 @@ func (d *Datapath) processNetworkAckPacket(context *pucontext.PUContext, conn *c
 			return conn.Context.Counters().CounterError(counters.ErrDuplicateAckDrop, fmt.Errorf("ErrDuplicateAckDrop"))
 		}
 
+		// Encrypted connections stay in the datapath.
+		if conn.ServiceConnection {
+			conn.ResetTimer(serviceConnectionTimeout)
+			return nil
+		}
+
 		conn.ResetTimer(waitBeforeRemovingConn)
 		tcpPacket.SetConnmark = true
 		return nil
@@ -791,6 +882,12 @@ func (d *Datapath) processNetworkAckPacket(context *pucontext.PUContext, conn *c
 
 		conn.SetState(connection.TCPData)
 
+		if conn.ServiceConnection {
+			d.markEncryptedFlow(tcpPacket, true)
+			conn.Context.Counters().IncrementCounter(counters.ErrEncrConnectionsProcessed)
+			return nil
+		}
+
 		if err := d.ignoreFlow(tcpPacket); err != nil {
 			zap.L().Error("Failed to ignore flow", zap.Error(err))
 		}
@@ -851,6 +948,59 @@ func (d *Datapath) processNetworkAckPacket(context *pucontext.PUContext, conn *c
 	return conn.Context.Counters().CounterError(counters.ErrInvalidNetAckState, fmt.Errorf("ErrInvalidNetAckState"))
 }
 
+// markEncryptedFlow sets the connmark of an encrypted connection. The packets
+// of the connection, FIN packets included, keep going through the datapath.
+func (d *Datapath) markEncryptedFlow(tcpPacket *packet.Packet, network bool) {
+
+	if err := d.conntrack.UpdateMark(
+		tcpPacket.SourceAddress(),
+		tcpPacket.DestinationAddress(),
+		tcpPacket.IPProto(),
+		tcpPacket.SourcePort(),
+		tcpPacket.DestPort(),
+		markconstants.EncryptConnmark,
+		network,
+	); err != nil {
+		zap.L().Error("Failed to update conntrack table for encrypted flow",
+			zap.String("flow", tcpPacket.L4FlowHash()),
+			zap.Error(err),
+		)
+	}
+}
+
+// synDatapathVersion returns the datapath version of the token of an
+// application syn. The version 2 is only used with the remotes that have
+// advertised it. A retransmitted version 2 syn falls back to the version 1
+// in case the remote does not support the version 2 anymore.
+func (d *Datapath) synDatapathVersion(tcpPacket *packet.Packet, conn *connection.TCPConnection) claimsheader.DatapathVersion {
+
+	remoteIP := tcpPacket.DestinationAddress().String()
+
+	if conn.Auth.DatapathVersion == claimsheader.DatapathVersion2 {
+		d.datapathVersions.Remove(remoteIP) // nolint
+		return claimsheader.DatapathVersion1
+	}
+
+	if _, err := d.datapathVersions.Get(remoteIP); err == nil {
+		return claimsheader.DatapathVersion2
+	}
+
+	return claimsheader.DatapathVersion1
+}
+
+// updateDatapathVersion records the datapath version advertised by a remote
+// in its syn/ack token. Remotes that do not advertise it only support the
+// version 1.
+func (d *Datapath) updateDatapathVersion(remoteIP string, claimsHeader *claimsheader.ClaimsHeader) {
+
+	if claimsHeader != nil && claimsHeader.MaxDatapathVersion() == claimsheader.DatapathVersion2 {
+		d.datapathVersions.AddOrUpdate(remoteIP, claimsheader.DatapathVersion2)
+		return
+	}
+
+	d.datapathVersions.Remove(remoteIP) // nolint
+}
+
 // appSynRetrieveState retrieves state for the the application Syn packet.
 // It creates a new connection by default
 func (d *Datapath) appSynRetrieveState(p *packet.Packet) (*connection.TCPConnection, error) {
@@ -952,7 +1102,7 @@ func (d *Datapath) netSynRetrieveState(p *packet.Packet) (*connection.TCPConnect
 
 	conn = connection.NewTCPConnection(context, p)
 
-	conn.Secrets, conn.Auth.LocalDatapathPrivateKey, conn.Auth.LocalDatapathPublicKeyV1, conn.Auth.LocalDatapathPublicKeySignV1, conn.Auth.LocalDatapathPublicKeyV2, conn.Auth.LocalDatapathPublicKeySignV2 = context.GetSecrets()
+	conn.Secrets, conn.Auth.LocalDatapathPrivateKey, conn.Auth.LocalDatapathPublicKeyV1, conn.Auth.LocalDatapathPublicKeySignV1, conn.Auth.LocalDatapathPublicKeyV2, conn.Auth.LocalDatapathPublicKeySignV2, conn.Auth.LocalDatapathPublicKeyV3, conn.Auth.LocalDatapathPublicKeySignV3 = context.GetSecrets()
 	return conn, nil
 }
 
@@ -2294,3 +2294,61 @@ func TestProcessNetworkSynAckPacket(t *testing.T) {
 
 	})
 }
+
+func TestConnectionTable(t *testing.T) {
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	Convey("Given I setup an enforcer with a connection of a PU", t, func() {
+
+		defer MockGetUDPRawSocket()()
+
+		enforcer, secrets, mockTokenAccessor, _, _ := NewWithMocks(ctrl, "serverID1", constants.LocalServer, []string{"0.0.0.0/0"}, true)
+
+		secrets.EXPECT().TransmittedKey().Return([]byte("dummy")).AnyTimes()
+		secrets.EXPECT().EncodingKey().Return(&ecdsa.PrivateKey{}).AnyTimes()
+		mockTokenAccessor.EXPECT().Sign(gomock.Any(), gomock.Any()).Times(1).Return([]byte("token"), nil).AnyTimes()
+		mockTokenAccessor.EXPECT().CreateSynPacketToken(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return([]byte("token"), nil)
+
+		err := CreatePortPolicy(enforcer, "123456", "/ns1", common.LinuxProcessPU, mockTokenAccessor, "2", 9000, 9000)
+		So(err, ShouldBeNil)
+
+		p, err := packet.NewIpv4TCPPacket(1, 0x2, "10.1.1.1", "127.0.0.1", 43758, 9000)
+		So(err, ShouldBeNil)
+
+		conn, err := enforcer.netSynRetrieveState(p)
+		So(err, ShouldBeNil)
+		conn.SetState(connection.TCPSynAckSend)
+		enforcer.tcpServer.Put(p.L4FlowHash(), conn)
+
+		Convey("I should get the connection of the PU", func() {
+			entries, err := enforcer.ConnectionTable(context.Background(), "123456", nil)
+			So(err, ShouldBeNil)
+			So(len(entries), ShouldEqual, 1)
+			So(entries[0].Key, ShouldEqual, p.L4FlowHash())
+			So(entries[0].ContextID, ShouldEqual, "123456")
+			So(entries[0].Client, ShouldBeFalse)
+			So(entries[0].PeerIP(), ShouldEqual, "10.1.1.1")
+			So(entries[0].DestinationPort, ShouldEqual, 9000)
+			So(entries[0].TCPFlowState, ShouldEqual, connection.TCPSynAckSend)
+		})
+
+		Convey("I should get the connection for all the PUs", func() {
+			entries, err := enforcer.ConnectionTable(context.Background(), "", &connection.TableFilter{PeerIP: "10.1.1.1", State: "TCPSynAckSend"})
+			So(err, ShouldBeNil)
+			So(len(entries), ShouldEqual, 1)
+		})
+
+		Convey("The filter should exclude the connections that do not match", func() {
+			entries, err := enforcer.ConnectionTable(context.Background(), "123456", &connection.TableFilter{Port: 80})
+			So(err, ShouldBeNil)
+			So(len(entries), ShouldEqual, 0)
+		})
+
+		Convey("I should get an error for an unknown PU", func() {
+			_, err := enforcer.ConnectionTable(context.Background(), "unknown", nil)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -140,8 +140,8 @@ func (d *Datapath) ProcessNetworkUDPPacket(p *packet.Packet) (conn *connection.U
 
 	p.Print(packet.PacketStageIncoming, d.PacketLogsEnabled())
 
-	if d.service != nil {
-		if !d.service.PreProcessUDPNetPacket(p, conn.Context, conn) {
+	if d.packetProcessor() != nil {
+		if !d.packetProcessor().PreProcessUDPNetPacket(p, conn.Context, conn) {
 			p.Print(packet.PacketFailureService, d.PacketLogsEnabled())
 			return conn, conn.Context.Counters().CounterError(counters.ErrUDPNetPreProcessingFailed, errors.New("pre  processing failed for network packet"))
 		}
@@ -158,8 +158,8 @@ func (d *Datapath) ProcessNetworkUDPPacket(p *packet.Packet) (conn *connection.U
 	}
 
 	// Process the packet by any external services.
-	if d.service != nil {
-		if !d.service.PostProcessUDPNetPacket(p, action, claims, conn.Context, conn) {
+	if d.packetProcessor() != nil {
+		if !d.packetProcessor().PostProcessUDPNetPacket(p, action, claims, conn.Context, conn) {
 			p.Print(packet.PacketFailureService, d.PacketLogsEnabled())
 			return conn, conn.Context.Counters().CounterError(counters.ErrUDPNetPostProcessingFailed, errors.New("post service processing failed for network packet"))
 		}
@@ -169,18 +169,22 @@ func (d *Datapath) ProcessNetworkUDPPacket(p *packet.Packet) (conn *connection.U
 	if conn.GetState() == connection.UDPClientSendAck {
 		conn.SetState(connection.UDPData)
 		for udpPacket := conn.ReadPacket(); udpPacket != nil; udpPacket = conn.ReadPacket() {
-			if d.service != nil {
+			if d.packetProcessor() != nil {
 				// PostProcessServiceInterface
 				// We call it for all outgoing packets.
-				if !d.service.PostProcessUDPAppPacket(udpPacket, nil, conn.Context, conn) {
+				if !d.packetProcessor().PostProcessUDPAppPacket(udpPacket, nil, conn.Context, conn) {
 					udpPacket.Print(packet.PacketFailureService, d.PacketLogsEnabled())
-					zap.L().Error("Failed to encrypt queued packet")
+					conn.Context.Counters().IncrementCounter(counters.ErrUDPAppPostProcessingFailed)
+					zap.L().Error("Failed to encrypt queued packet, dropping it")
+					continue
 				}
 			}
 
-			err = d.ignoreFlow(udpPacket)
-			if err != nil {
-				zap.L().Error("Unable to ignore the flow", zap.Error(err))
+			if !conn.ServiceConnection {
+				err = d.ignoreFlow(udpPacket)
+				if err != nil {
+					zap.L().Error("Unable to ignore the flow", zap.Error(err))
+				}
 			}
 
 			err = d.writeUDPSocket(udpPacket.GetBuffer(0), udpPacket)
@@ -215,7 +219,7 @@ func (d *Datapath) netSynUDPRetrieveState(p *packet.Packet) (*connection.UDPConn
 	conn, cerr := d.udpNetOrigConnectionTracker.Get(p.L4FlowHash())
 	if cerr != nil {
 		conn := connection.NewUDPConnection(context, d.udpSocketWriter)
-		conn.Secrets, conn.Auth.LocalDatapathPrivateKey, conn.Auth.LocalDatapathPublicKeyV1, conn.Auth.LocalDatapathPublicKeySignV1, conn.Auth.LocalDatapathPublicKeyV2, conn.Auth.LocalDatapathPublicKeySignV2 = context.GetSecrets()
+		conn.Secrets, conn.Auth.LocalDatapathPrivateKey, conn.Auth.LocalDatapathPublicKeyV1, conn.Auth.LocalDatapathPublicKeySignV1, conn.Auth.LocalDatapathPublicKeyV2, conn.Auth.LocalDatapathPublicKeySignV2, conn.Auth.LocalDatapathPublicKeyV3, conn.Auth.LocalDatapathPublicKeySignV3 = context.GetSecrets()
 		return conn, nil
 	}
 	return conn.(*connection.UDPConnection), nil
@@ -346,9 +350,9 @@ func (d *Datapath) ProcessApplicationUDPPacket(p *packet.Packet) (conn *connecti
 	defer conn.Unlock()
 
 	// do some pre processing.
-	if d.service != nil {
+	if d.packetProcessor() != nil {
 		// PreProcessServiceInterface
-		if !d.service.PreProcessUDPAppPacket(p, conn.Context, conn, packet.UDPSynMask) {
+		if !d.packetProcessor().PreProcessUDPAppPacket(p, conn.Context, conn, packet.UDPSynMask) {
 			p.Print(packet.PacketFailureService, d.PacketLogsEnabled())
 			return nil, conn.Context.Counters().CounterError(counters.ErrUDPAppPreProcessingFailed, errors.New("pre service processing failed for UDP application packet"))
 		}
@@ -380,9 +384,9 @@ func (d *Datapath) ProcessApplicationUDPPacket(p *packet.Packet) (conn *connecti
 		return conn, conn.Context.Counters().CounterError(counters.ErrUDPDropInNfQueue, errDropQueuedPacket)
 	}
 
-	if d.service != nil {
+	if d.packetProcessor() != nil {
 		// PostProcessServiceInterface
-		if !d.service.PostProcessUDPAppPacket(p, nil, conn.Context, conn) {
+		if !d.packetProcessor().PostProcessUDPAppPacket(p, nil, conn.Context, conn) {
 			p.Print(packet.PacketFailureService, d.PacketLogsEnabled())
 			return conn, conn.Context.Counters().CounterError(counters.ErrUDPAppPostProcessingFailed, errors.New("Encryption failed for application packet"))
 		}
@@ -490,12 +494,14 @@ func (d *Datapath) triggerNegotiation(udpPacket *packet.Packet, context *puconte
 
 			}
 			for udpPacket := conn.ReadPacket(); udpPacket != nil; udpPacket = conn.ReadPacket() {
-				if d.service != nil {
+				if d.packetProcessor() != nil {
 					// PostProcessServiceInterface
 					// We call it for all outgoing packets.
-					if !d.service.PostProcessUDPAppPacket(udpPacket, nil, conn.Context, conn) {
+					if !d.packetProcessor().PostProcessUDPAppPacket(udpPacket, nil, conn.Context, conn) {
 						udpPacket.Print(packet.PacketFailureService, d.PacketLogsEnabled())
-						zap.L().Error("Failed to encrypt queued packet")
+						conn.Context.Counters().IncrementCounter(counters.ErrUDPAppPostProcessingFailed)
+						zap.L().Error("Failed to encrypt queued packet, dropping it")
+						continue
 					}
 				}
 
@@ -525,6 +531,7 @@ func (d *Datapath) triggerNegotiation(udpPacket *packet.Packet, context *puconte
 
 	// Populate the caches to track the connection
 	hash := udpPacket.L4FlowHash()
+	conn.SetTuple(udpPacket)
 	d.udpAppOrigConnectionTracker.AddOrUpdate(hash, conn)
 	d.udpSourcePortConnectionCache.AddOrUpdate(newPacket.SourcePortHash(packet.PacketTypeApplication), conn)
 
@@ -584,6 +591,8 @@ func (d *Datapath) clonePacketHeaders(p *packet.Packet) (*packet.Packet, error)
 func (d *Datapath) sendUDPSynAckPacket(udpPacket *packet.Packet, context *pucontext.PUContext, conn *connection.UDPConnection) (err error) {
 
 	claimsHeader := claimsheader.NewClaimsHeader()
+	claimsHeader.SetEncrypt(conn.ServiceConnection)
+
 	claims := &tokens.ConnectionClaims{
 		CT:       context.CompressedTags(),
 		LCL:      conn.Auth.Nonce[:],
@@ -665,18 +674,22 @@ func (d *Datapath) sendUDPAckPacket(udpPacket *packet.Packet, context *pucontext
 
 	<-time.After(40 * time.Millisecond) //Arbitrary number give receiver chance to plumb conntrack
 	for udpPacket := conn.ReadPacket(); udpPacket != nil; udpPacket = conn.ReadPacket() {
-		if d.service != nil {
+		if d.packetProcessor() != nil {
 			// PostProcessServiceInterface
 			// We call it for all outgoing packets.
-			if !d.service.PostProcessUDPAppPacket(udpPacket, nil, conn.Context, conn) {
+			if !d.packetProcessor().PostProcessUDPAppPacket(udpPacket, nil, conn.Context, conn) {
 				udpPacket.Print(packet.PacketFailureService, d.PacketLogsEnabled())
-				zap.L().Error("Failed to encrypt queued packet")
+				conn.Context.Counters().IncrementCounter(counters.ErrUDPAppPostProcessingFailed)
+				zap.L().Error("Failed to encrypt queued packet, dropping it")
+				continue
 			}
 		}
 
-		err = d.ignoreFlow(udpPacket)
-		if err != nil {
-			zap.L().Error("Unable to ignore the flow", zap.Error(err))
+		if !conn.ServiceConnection {
+			err = d.ignoreFlow(udpPacket)
+			if err != nil {
+				zap.L().Error("Unable to ignore the flow", zap.Error(err))
+			}
 		}
 
 		err = d.writeUDPSocket(udpPacket.GetBuffer(0), udpPacket)
@@ -685,6 +698,31 @@ func (d *Datapath) sendUDPAckPacket(udpPacket *packet.Packet, context *pucontext
 		}
 	}
 
+	// Encrypted connections get the encrypt connmark, so that all their
+	// packets are queued to the datapath.
+	if conn.ServiceConnection {
+		if err = d.conntrack.UpdateApplicationFlowMark(
+			udpPacket.SourceAddress(),
+			udpPacket.DestinationAddress(),
+			udpPacket.IPProto(),
+			udpPacket.SourcePort(),
+			udpPacket.DestPort(),
+			markconstants.EncryptConnmark,
+		); err != nil {
+			zap.L().Error("Failed to update conntrack table for encrypted UDP flow at transmitter",
+				zap.String("app-conn", udpPacket.L4FlowHash()),
+				zap.Error(err),
+			)
+			return err
+		}
+		conn.SetState(connection.UDPData)
+		conn.Context.Counters().IncrementCounter(counters.ErrEncrConnectionsProcessed)
+		if err := d.udpFinPacketTracker.Remove(udpPacket.L4FlowHash()); err != nil {
+			zap.L().Debug("Unable to remove entry from udp finack cache")
+		}
+		return nil
+	}
+
 	// When server and client are the same machine, we can't ignore the
 	// flow until the server side receives the Ack packet
 	if !udpPacket.SourceAddress().Equal(udpPacket.DestinationAddress()) {
@@ -738,13 +776,18 @@ func (d *Datapath) processNetworkUDPSynPacket(context *pucontext.PUContext, conn
 		return nil, nil, context.Counters().CounterError(counters.ErrUDPSynDroppedPolicy, fmt.Errorf("packet had identity: incoming connection dropped:due to reject acl %s", perr))
 	}
 	claims = &conn.Auth.ConnectionClaims
-	secretKey, _, controller, remoteNonce, remoteContextID, proto314, err := d.tokenAccessor.ParsePacketToken(conn.Auth.LocalDatapathPrivateKey, udpPacket.ReadUDPToken(), conn.Secrets, claims, false)
+	token := udpPacket.ReadUDPToken()
+	secretKey, _, controller, remoteNonce, remoteContextID, proto314, err := d.tokenAccessor.ParsePacketToken(conn.Auth.LocalDatapathPrivateKey, token, conn.Secrets, claims, false)
 
 	if err != nil {
-		d.reportUDPRejectedFlow(udpPacket, conn, collector.DefaultEndPoint, context.ManagementID(), context, collector.InvalidToken, nil, nil, false)
+		d.reportUDPRejectedFlow(udpPacket, conn, collector.DefaultEndPoint, context.ManagementID(), context, dropReasonFromError(err, collector.InvalidToken), nil, nil, false)
 		return nil, nil, conn.Context.Counters().CounterError(netUDPSynCounterFromError(err), fmt.Errorf("UDP Syn packet dropped because of invalid token: %s", err))
 	}
 
+	if d.tokenReplayed(context, udpPacket, token, conn.GetState().String()) {
+		return nil, nil, conn.Context.Counters().CounterError(counters.ErrUDPSynReplayed, errors.New("UDP Syn packet dropped because of replayed token"))
+	}
+
 	if controller != nil && !controller.SameController {
 		conn.SourceController = controller.Controller
 	}
@@ -771,6 +814,7 @@ func (d *Datapath) processNetworkUDPSynPacket(context *pucontext.PUContext, conn
 	hash := udpPacket.L4FlowHash()
 
 	// conntrack
+	conn.SetTuple(udpPacket)
 	d.udpNetOrigConnectionTracker.AddOrUpdate(hash, conn)
 	d.udpAppReplyConnectionTracker.AddOrUpdate(udpPacket.L4ReverseFlowHash(), conn)
 
@@ -779,6 +823,9 @@ func (d *Datapath) processNetworkUDPSynPacket(context *pucontext.PUContext, conn
 	conn.Auth.RemoteContextID = remoteContextID
 	conn.Auth.Proto314 = proto314
 
+	// The payload of the connection is encrypted if our policy requires it.
+	conn.ServiceConnection = d.packetProcessor() != nil && pkt.Action.Encrypted()
+
 	// Record actions
 	conn.ReportFlowPolicy = report
 	conn.PacketFlowPolicy = pkt
@@ -789,12 +836,17 @@ func (d *Datapath) processNetworkUDPSynPacket(context *pucontext.PUContext, conn
 func (d *Datapath) processNetworkUDPSynAckPacket(udpPacket *packet.Packet, context *pucontext.PUContext, conn *connection.UDPConnection) (action interface{}, claims *tokens.ConnectionClaims, err error) {
 	conn.SynStop()
 	claims = &conn.Auth.ConnectionClaims
-	secretKey, _, controller, remoteNonce, remoteContextID, proto314, err := d.tokenAccessor.ParsePacketToken(conn.Auth.LocalDatapathPrivateKey, udpPacket.ReadUDPToken(), conn.Secrets, claims, true)
+	token := udpPacket.ReadUDPToken()
+	secretKey, claimsHeader, controller, remoteNonce, remoteContextID, proto314, err := d.tokenAccessor.ParsePacketToken(conn.Auth.LocalDatapathPrivateKey, token, conn.Secrets, claims, true)
 	if err != nil {
-		d.reportUDPRejectedFlow(udpPacket, conn, context.ManagementID(), collector.DefaultEndPoint, context, collector.MissingToken, nil, nil, true)
+		d.reportUDPRejectedFlow(udpPacket, conn, context.ManagementID(), collector.DefaultEndPoint, context, dropReasonFromError(err, collector.MissingToken), nil, nil, true)
 		return nil, nil, conn.Context.Counters().CounterError(netUDPSynAckCounterFromError(err), errors.New("SynAck packet dropped because of bad claims"))
 	}
 
+	if d.tokenReplayed(context, udpPacket, token, conn.GetState().String()) {
+		return nil, nil, conn.Context.Counters().CounterError(counters.ErrUDPSynAckReplayed, errors.New("SynAck packet dropped because of replayed token"))
+	}
+
 	if controller != nil && !controller.SameController {
 		conn.DestinationController = controller.Controller
 	}
@@ -814,6 +866,16 @@ func (d *Datapath) processNetworkUDPSynAckPacket(udpPacket *packet.Packet, conte
 		return nil, nil, conn.Context.Counters().CounterError(counters.ErrUDPSynAckPolicy, fmt.Errorf("dropping because of reject rule on transmitter: %s", claims.T.String()))
 	}
 
+	// The server decides if the payload is encrypted. Reject the connection if
+	// our policy requires encryption and the server does not encrypt, or if we
+	// can not encrypt.
+	encrypt := claimsHeader != nil && claimsHeader.Encrypt()
+	if (pkt.Action.Encrypted() && !encrypt) || (encrypt && d.packetProcessor() == nil) {
+		d.reportUDPRejectedFlow(udpPacket, conn, remoteContextID, context.ManagementID(), context, collector.EncryptionMismatch, report, pkt, true)
+		return nil, nil, conn.Context.Counters().CounterError(counters.ErrSynAckEncryptionMismatch, fmt.Errorf("dropping because of encryption mismatch: %s", claims.T.String()))
+	}
+	conn.ServiceConnection = encrypt
+
 	// conntrack
 	d.udpNetReplyConnectionTracker.AddOrUpdate(udpPacket.L4FlowHash(), conn)
 	conn.Auth.SecretKey = secretKey
@@ -831,9 +893,16 @@ func (d *Datapath) processNetworkUDPAckPacket(udpPacket *packet.Packet, context
 		return conn.Context.Counters().CounterError(netUDPAckCounterFromError(err), fmt.Errorf("ack packet dropped because signature validation failed: %s", err))
 	}
 
-	// For Windows, we allow the flow
-	if err := d.setFlowState(udpPacket, true); err != nil {
-		zap.L().Error("Failed to ignore flow", zap.Error(err))
+	// Encrypted connections get the encrypt connmark, so that all their
+	// packets are queued to the datapath.
+	mark := markconstants.DefaultConnMark
+	if conn.ServiceConnection {
+		mark = markconstants.EncryptConnmark
+	} else {
+		// For Windows, we allow the flow
+		if err := d.setFlowState(udpPacket, true); err != nil {
+			zap.L().Error("Failed to ignore flow", zap.Error(err))
+		}
 	}
 
 	// Plumb connmark rule here.
@@ -843,7 +912,7 @@ func (d *Datapath) processNetworkUDPAckPacket(udpPacket *packet.Packet, context
 		udpPacket.IPProto(),
 		udpPacket.SourcePort(),
 		udpPacket.DestPort(),
-		markconstants.DefaultConnMark,
+		mark,
 	); err != nil {
 		zap.L().Error("Failed to update conntrack table after ack packet")
 	}
@@ -0,0 +1,49 @@
+package nfqdatapath
+
+import (
+	"sync/atomic"
+
+	"go.aporeto.io/enforcerd/trireme-lib/controller/internal/enforcer/nfqdatapath/encryption"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/packetprocessor"
+	"go.aporeto.io/enforcerd/trireme-lib/policy"
+)
+
+// packetProcessor returns the encryption processor, or nil as long as no PU
+// encrypts flows.
+func (d *Datapath) packetProcessor() packetprocessor.PacketProcessor {
+
+	if atomic.LoadInt32(&d.serviceEnabled) == 0 {
+		return nil
+	}
+
+	return d.service
+}
+
+// enableEncryption creates the encryption processor. It is only created once,
+// and it stays enabled for the lifetime of the datapath.
+func (d *Datapath) enableEncryption() {
+
+	d.serviceOnce.Do(func() {
+		d.service = encryption.New()
+		atomic.StoreInt32(&d.serviceEnabled, 1)
+	})
+}
+
+// encryptionRequired returns true if a tag selector of the policy encrypts the
+// flows with the other PUs.
+func encryptionRequired(p *policy.PUPolicy) bool {
+
+	if p == nil {
+		return false
+	}
+
+	for _, rules := range []policy.TagSelectorList{p.TransmitterRules(), p.ReceiverRules()} {
+		for _, rule := range rules {
+			if rule.Policy != nil && rule.Policy.Action.Encrypted() {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,345 @@
+package encryption
+
+import (
+	"encoding/binary"
+	"errors"
+
+	provider "go.aporeto.io/enforcerd/trireme-lib/controller/pkg/aclprovider"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/connection"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/fqconfig"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/packet"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/packetprocessor"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/pucontext"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/tokens"
+	"go.uber.org/zap"
+)
+
+const (
+	// tcpOptionLength is the length of the encryption option. It carries the
+	// counter and the tag of the packet.
+	tcpOptionLength  = 2 + tcpCounterLength + tagLength
+	tcpCounterLength = 6
+	maxTCPCounter    = 1<<(8*tcpCounterLength) - 1
+
+	// udpCounterLength is the length of the counter in front of the
+	// encrypted UDP payload.
+	udpCounterLength = 8
+	maxUDPCounter    = 1<<64 - 1
+
+	tcpOptionMSS  = uint8(2)
+	tcpOptionSACK = uint8(5)
+)
+
+var errMissingOption = errors.New("missing encryption option")
+
+// Processor encrypts the payload of the connections that are accepted by an
+// encrypt policy. The key of a connection is derived from the secret that
+// both ends have negotiated during the handshake. TCP packets carry the
+// counter and the tag of the payload in a TCP option, UDP packets carry them
+// around the payload.
+type Processor struct{}
+
+// New returns the built-in encryption packet processor.
+func New() packetprocessor.PacketProcessor {
+	return &Processor{}
+}
+
+// Initialize implements the PacketProcessor interface. The processor does
+// not need any ACLs.
+func (e *Processor) Initialize(fq fqconfig.FilterQueue, p []provider.IptablesProvider) {}
+
+// Stop implements the PacketProcessor interface.
+func (e *Processor) Stop() error {
+	return nil
+}
+
+// PreProcessTCPAppPacket implements the PacketProcessor interface.
+func (e *Processor) PreProcessTCPAppPacket(p *packet.Packet, context *pucontext.PUContext, conn *connection.TCPConnection) bool {
+	return true
+}
+
+// PostProcessTCPAppPacket encrypts the payload of the application packets
+// of an encrypted connection.
+func (e *Processor) PostProcessTCPAppPacket(p *packet.Packet, action interface{}, context *pucontext.PUContext, conn *connection.TCPConnection) bool {
+
+	if !conn.ServiceConnection || skipTCPPacket(p) {
+		return true
+	}
+
+	s, err := tcpSession(conn)
+	if err != nil {
+		zap.L().Debug("Unable to create encryption session", zap.String("flow", p.L4FlowHash()), zap.Error(err))
+		return false
+	}
+
+	if err := sealTCP(s, p); err != nil {
+		zap.L().Debug("Unable to encrypt packet", zap.String("flow", p.L4FlowHash()), zap.Error(err))
+		return false
+	}
+
+	return true
+}
+
+// PreProcessTCPNetPacket decrypts the payload of the network packets of an
+// encrypted connection. Packets with a payload and without the encryption
+// option are dropped.
+func (e *Processor) PreProcessTCPNetPacket(p *packet.Packet, context *pucontext.PUContext, conn *connection.TCPConnection) bool {
+
+	if !conn.ServiceConnection || p.GetTCPFlags()&packet.TCPSynMask != 0 {
+		return true
+	}
+
+	if _, ok := p.TCPOption(packet.TCPEncryptionOption); !ok {
+		return skipTCPPacket(p)
+	}
+
+	s, err := tcpSession(conn)
+	if err != nil {
+		zap.L().Debug("Unable to create encryption session", zap.String("flow", p.L4FlowHash()), zap.Error(err))
+		return false
+	}
+
+	if err := openTCP(s, p); err != nil {
+		zap.L().Debug("Unable to decrypt packet", zap.String("flow", p.L4FlowHash()), zap.Error(err))
+		return false
+	}
+
+	return true
+}
+
+// PostProcessTCPNetPacket lowers the MSS announced by the peer of an
+// encrypted connection, so that the application leaves room for the
+// encryption option.
+func (e *Processor) PostProcessTCPNetPacket(p *packet.Packet, action interface{}, claims *tokens.ConnectionClaims, context *pucontext.PUContext, conn *connection.TCPConnection) bool {
+
+	if !conn.ServiceConnection || p.GetTCPFlags()&packet.TCPSynMask == 0 {
+		return true
+	}
+
+	clampMSS(p)
+
+	return true
+}
+
+// PreProcessUDPAppPacket implements the PacketProcessor interface.
+func (e *Processor) PreProcessUDPAppPacket(p *packet.Packet, context *pucontext.PUContext, conn *connection.UDPConnection, packetType uint8) bool {
+	return true
+}
+
+// PostProcessUDPAppPacket encrypts the payload of the application packets
+// of an encrypted connection.
+func (e *Processor) PostProcessUDPAppPacket(p *packet.Packet, action interface{}, context *pucontext.PUContext, conn *connection.UDPConnection) bool {
+
+	if !conn.ServiceConnection || p.GetUDPType() != 0 {
+		return true
+	}
+
+	s, err := udpSession(conn)
+	if err != nil {
+		zap.L().Debug("Unable to create encryption session", zap.String("flow", p.L4FlowHash()), zap.Error(err))
+		return false
+	}
+
+	if err := sealUDP(s, p); err != nil {
+		zap.L().Debug("Unable to encrypt packet", zap.String("flow", p.L4FlowHash()), zap.Error(err))
+		return false
+	}
+
+	return true
+}
+
+// PreProcessUDPNetPacket decrypts the payload of the network packets of an
+// encrypted connection.
+func (e *Processor) PreProcessUDPNetPacket(p *packet.Packet, context *pucontext.PUContext, conn *connection.UDPConnection) bool {
+
+	if !conn.ServiceConnection || p.GetUDPType() != 0 {
+		return true
+	}
+
+	s, err := udpSession(conn)
+	if err != nil {
+		zap.L().Debug("Unable to create encryption session", zap.String("flow", p.L4FlowHash()), zap.Error(err))
+		return false
+	}
+
+	if err := openUDP(s, p); err != nil {
+		zap.L().Debug("Unable to decrypt packet", zap.String("flow", p.L4FlowHash()), zap.Error(err))
+		return false
+	}
+
+	return true
+}
+
+// PostProcessUDPNetPacket implements the PacketProcessor interface.
+func (e *Processor) PostProcessUDPNetPacket(p *packet.Packet, action interface{}, claims *tokens.ConnectionClaims, context *pucontext.PUContext, conn *connection.UDPConnection) bool {
+	return true
+}
+
+// tcpSession returns the session of a connection and creates it with the
+// first packet.
+func tcpSession(conn *connection.TCPConnection) (*session, error) {
+
+	if s, ok := conn.ServiceData.(*session); ok {
+		return s, nil
+	}
+
+	s, err := newSession(&conn.Auth)
+	if err != nil {
+		return nil, err
+	}
+	conn.ServiceData = s
+
+	return s, nil
+}
+
+// udpSession returns the session of a connection and creates it with the
+// first packet.
+func udpSession(conn *connection.UDPConnection) (*session, error) {
+
+	if s, ok := conn.ServiceData.(*session); ok {
+		return s, nil
+	}
+
+	s, err := newSession(&conn.Auth)
+	if err != nil {
+		return nil, err
+	}
+	conn.ServiceData = s
+
+	return s, nil
+}
+
+// skipTCPPacket returns true for the packets that are not encrypted. These
+// are the packets without payload and the handshake packets that carry a
+// token.
+func skipTCPPacket(p *packet.Packet) bool {
+
+	if p.GetTCPFlags()&packet.TCPSynMask != 0 || p.IsEmptyTCPPayload() {
+		return true
+	}
+
+	_, ok := p.TCPOption(packet.TCPAuthenticationOption)
+
+	return ok
+}
+
+// sealTCP encrypts the payload in place and inserts the encryption option.
+// The sequence number is authenticated with the payload. If there is no room
+// for the option the SACK option is removed.
+func sealTCP(s *session, p *packet.Packet) error {
+
+	var aad [4]byte
+	binary.BigEndian.PutUint32(aad[:], p.TCPSequenceNumber())
+
+	counter, tag, err := s.seal(p.ReadTCPData(), aad[:], maxTCPCounter)
+	if err != nil {
+		return err
+	}
+
+	option := make([]byte, tcpOptionLength)
+	option[0] = packet.TCPEncryptionOption
+	option[1] = tcpOptionLength
+	putCounter(option[2:2+tcpCounterLength], counter)
+	copy(option[2+tcpCounterLength:], tag)
+
+	if err := p.InsertTCPOption(option); err != nil {
+		if rerr := p.RemoveTCPOption(tcpOptionSACK); rerr != nil {
+			return err
+		}
+		return p.InsertTCPOption(option)
+	}
+
+	return nil
+}
+
+// openTCP authenticates and decrypts the payload in place and removes the
+// encryption option.
+func openTCP(s *session, p *packet.Packet) error {
+
+	option, ok := p.TCPOption(packet.TCPEncryptionOption)
+	if !ok || len(option) != tcpOptionLength {
+		return errMissingOption
+	}
+
+	var aad [4]byte
+	binary.BigEndian.PutUint32(aad[:], p.TCPSequenceNumber())
+
+	counter := getCounter(option[2 : 2+tcpCounterLength])
+	if err := s.open(counter, p.ReadTCPData(), option[2+tcpCounterLength:], aad[:]); err != nil {
+		return err
+	}
+
+	return p.RemoveTCPOption(packet.TCPEncryptionOption)
+}
+
+// sealUDP encrypts the payload and frames it with the counter and the tag.
+func sealUDP(s *session, p *packet.Packet) error {
+
+	data := p.GetUDPData()
+
+	counter, tag, err := s.seal(data, nil, maxUDPCounter)
+	if err != nil {
+		return err
+	}
+
+	payload := make([]byte, udpCounterLength, udpCounterLength+len(data)+tagLength)
+	binary.BigEndian.PutUint64(payload, counter)
+	payload = append(payload, data...)
+	payload = append(payload, tag...)
+
+	p.SetUDPData(payload)
+
+	return nil
+}
+
+// openUDP authenticates and decrypts a framed payload.
+func openUDP(s *session, p *packet.Packet) error {
+
+	data := p.GetUDPData()
+	if len(data) < udpCounterLength+tagLength {
+		return errMissingOption
+	}
+
+	counter := binary.BigEndian.Uint64(data)
+	payload := data[udpCounterLength : len(data)-tagLength]
+
+	if err := s.open(counter, payload, data[len(data)-tagLength:], nil); err != nil {
+		return err
+	}
+
+	p.SetUDPData(payload)
+
+	return nil
+}
+
+// clampMSS lowers the MSS option by the length of the encryption option.
+func clampMSS(p *packet.Packet) {
+
+	option, ok := p.TCPOption(tcpOptionMSS)
+	if !ok || len(option) != 4 {
+		return
+	}
+
+	mss := binary.BigEndian.Uint16(option[2:])
+	if mss <= tcpOptionLength {
+		return
+	}
+
+	binary.BigEndian.PutUint16(option[2:], mss-tcpOptionLength)
+	p.UpdateTCPChecksum()
+}
+
+func putCounter(b []byte, counter uint64) {
+	for i := len(b) - 1; i >= 0; i-- {
+		b[i] = byte(counter)
+		counter >>= 8
+	}
+}
+
+func getCounter(b []byte) uint64 {
+	var counter uint64
+	for _, v := range b {
+		counter = counter<<8 | uint64(v)
+	}
+	return counter
+}
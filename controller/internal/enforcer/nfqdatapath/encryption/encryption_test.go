@@ -0,0 +1,351 @@
+package encryption
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/connection"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/packet"
+)
+
+func testAuth() (*connection.AuthInfo, *connection.AuthInfo) {
+
+	client := &connection.AuthInfo{SecretKey: []byte("a secret negotiated by the ends")}
+	server := &connection.AuthInfo{SecretKey: client.SecretKey}
+
+	copy(client.Nonce[:], bytes.Repeat([]byte{1}, len(client.Nonce)))
+	copy(server.Nonce[:], bytes.Repeat([]byte{2}, len(server.Nonce)))
+	client.RemoteNonce = server.Nonce[:]
+	server.RemoteNonce = client.Nonce[:]
+
+	return client, server
+}
+
+func testTCPConnections() (*connection.TCPConnection, *connection.TCPConnection) {
+
+	clientAuth, serverAuth := testAuth()
+
+	client := &connection.TCPConnection{Auth: *clientAuth, ServiceConnection: true}
+	server := &connection.TCPConnection{Auth: *serverAuth, ServiceConnection: true}
+
+	return client, server
+}
+
+func testTCPPacket(flags uint8, seq uint32, options []byte, payload []byte) *packet.Packet {
+
+	tcpLength := 20 + len(options)
+	buffer := make([]byte, 20+tcpLength+len(payload))
+
+	buffer[0] = 0x45
+	binary.BigEndian.PutUint16(buffer[2:4], uint16(len(buffer)))
+	buffer[8] = 64
+	buffer[9] = packet.IPProtocolTCP
+	copy(buffer[12:16], []byte{10, 0, 0, 1})
+	copy(buffer[16:20], []byte{10, 0, 0, 2})
+
+	tcp := buffer[20:]
+	binary.BigEndian.PutUint16(tcp[0:2], 2000)
+	binary.BigEndian.PutUint16(tcp[2:4], 80)
+	binary.BigEndian.PutUint32(tcp[4:8], seq)
+	tcp[12] = uint8(tcpLength/4) << 4
+	tcp[13] = flags
+	copy(tcp[20:], options)
+	copy(tcp[tcpLength:], payload)
+
+	p, err := packet.New(packet.PacketTypeApplication, buffer, "0", true)
+	So(err, ShouldBeNil)
+
+	p.UpdateIPv4Checksum()
+	p.UpdateTCPChecksum()
+
+	return p
+}
+
+func testUDPPacket(payload []byte) *packet.Packet {
+
+	buffer := make([]byte, 28+len(payload))
+
+	buffer[0] = 0x45
+	binary.BigEndian.PutUint16(buffer[2:4], uint16(len(buffer)))
+	buffer[8] = 64
+	buffer[9] = packet.IPProtocolUDP
+	copy(buffer[12:16], []byte{10, 0, 0, 1})
+	copy(buffer[16:20], []byte{10, 0, 0, 2})
+
+	udp := buffer[20:]
+	binary.BigEndian.PutUint16(udp[0:2], 2000)
+	binary.BigEndian.PutUint16(udp[2:4], 53)
+	binary.BigEndian.PutUint16(udp[4:6], uint16(8+len(payload)))
+	copy(udp[8:], payload)
+
+	p, err := packet.New(packet.PacketTypeApplication, buffer, "0", true)
+	So(err, ShouldBeNil)
+
+	return p
+}
+
+func TestTCPEncryption(t *testing.T) {
+
+	Convey("Given an encrypted TCP connection", t, func() {
+
+		processor := New()
+		client, server := testTCPConnections()
+		payload := []byte("GET / HTTP/1.1\r\n\r\n")
+
+		Convey("When the client sends a packet", func() {
+
+			p := testTCPPacket(packet.TCPAckMask|packet.TCPPshMask, 1000, nil, payload)
+			So(processor.PostProcessTCPAppPacket(p, nil, nil, client), ShouldBeTrue)
+
+			Convey("Then the payload should be encrypted and carry the option", func() {
+				So(p.ReadTCPData(), ShouldNotResemble, payload)
+				So(p.TCPDataStartBytes(), ShouldEqual, 20+tcpOptionLength)
+				So(p.VerifyTCPChecksum(), ShouldBeTrue)
+				_, ok := p.TCPOption(packet.TCPEncryptionOption)
+				So(ok, ShouldBeTrue)
+			})
+
+			Convey("Then the server should decrypt it", func() {
+				So(processor.PreProcessTCPNetPacket(p, nil, server), ShouldBeTrue)
+				So(p.ReadTCPData(), ShouldResemble, payload)
+				So(p.TCPDataStartBytes(), ShouldEqual, 20)
+				So(p.VerifyTCPChecksum(), ShouldBeTrue)
+			})
+
+			Convey("Then the server should drop a replay", func() {
+				replay, err := packet.New(packet.PacketTypeNetwork, append([]byte{}, p.GetBuffer(0)...), "0", true)
+				So(err, ShouldBeNil)
+
+				So(processor.PreProcessTCPNetPacket(p, nil, server), ShouldBeTrue)
+				So(processor.PreProcessTCPNetPacket(replay, nil, server), ShouldBeFalse)
+			})
+
+			Convey("Then the server should drop a modified payload", func() {
+				p.ReadTCPData()[0] ^= 1
+				So(processor.PreProcessTCPNetPacket(p, nil, server), ShouldBeFalse)
+			})
+
+			Convey("Then the server should drop a modified sequence number", func() {
+				p.SetTCPSeq(1001)
+				So(processor.PreProcessTCPNetPacket(p, nil, server), ShouldBeFalse)
+			})
+		})
+
+		Convey("When a packet has no payload", func() {
+
+			p := testTCPPacket(packet.TCPAckMask, 1000, nil, nil)
+			So(processor.PostProcessTCPAppPacket(p, nil, nil, client), ShouldBeTrue)
+
+			Convey("Then it should not be modified", func() {
+				So(p.TCPDataStartBytes(), ShouldEqual, 20)
+				So(processor.PreProcessTCPNetPacket(p, nil, server), ShouldBeTrue)
+			})
+		})
+
+		Convey("When a packet carries a payload in clear", func() {
+
+			p := testTCPPacket(packet.TCPAckMask, 1000, nil, payload)
+
+			Convey("Then the server should drop it", func() {
+				So(processor.PreProcessTCPNetPacket(p, nil, server), ShouldBeFalse)
+			})
+		})
+
+		Convey("When a packet has no room for the option", func() {
+
+			sack := []byte{1, 1, 5, 10, 0, 0, 0, 1, 0, 0, 0, 2}
+			options := append(bytes.Repeat([]byte{1}, 16), sack...)
+			p := testTCPPacket(packet.TCPAckMask, 1000, options, payload)
+			So(processor.PostProcessTCPAppPacket(p, nil, nil, client), ShouldBeTrue)
+
+			Convey("Then the SACK option should be removed", func() {
+				_, ok := p.TCPOption(5)
+				So(ok, ShouldBeFalse)
+				So(processor.PreProcessTCPNetPacket(p, nil, server), ShouldBeTrue)
+				So(p.ReadTCPData(), ShouldResemble, payload)
+			})
+		})
+
+		Convey("When the connection is not encrypted", func() {
+
+			client.ServiceConnection = false
+			p := testTCPPacket(packet.TCPAckMask, 1000, nil, payload)
+			So(processor.PostProcessTCPAppPacket(p, nil, nil, client), ShouldBeTrue)
+
+			Convey("Then the packet should not be modified", func() {
+				So(p.ReadTCPData(), ShouldResemble, payload)
+				So(client.ServiceData, ShouldBeNil)
+			})
+		})
+
+		Convey("When the peer sends a SYN with an MSS", func() {
+
+			p := testTCPPacket(packet.TCPSynAckMask, 1000, []byte{2, 4, 0x05, 0xb4}, nil)
+			So(processor.PostProcessTCPNetPacket(p, nil, nil, nil, client), ShouldBeTrue)
+
+			Convey("Then the MSS should leave room for the option", func() {
+				option, ok := p.TCPOption(tcpOptionMSS)
+				So(ok, ShouldBeTrue)
+				So(binary.BigEndian.Uint16(option[2:]), ShouldEqual, 1460-tcpOptionLength)
+				So(p.VerifyTCPChecksum(), ShouldBeTrue)
+			})
+		})
+	})
+}
+
+func TestUDPEncryption(t *testing.T) {
+
+	Convey("Given an encrypted UDP connection", t, func() {
+
+		processor := New()
+		clientAuth, serverAuth := testAuth()
+		client := &connection.UDPConnection{Auth: *clientAuth, ServiceConnection: true}
+		server := &connection.UDPConnection{Auth: *serverAuth, ServiceConnection: true}
+		payload := []byte("a datagram")
+
+		Convey("When the client sends a packet", func() {
+
+			p := testUDPPacket(payload)
+			So(processor.PostProcessUDPAppPacket(p, nil, nil, client), ShouldBeTrue)
+
+			Convey("Then the payload should be framed", func() {
+				So(len(p.GetUDPData()), ShouldEqual, udpCounterLength+len(payload)+tagLength)
+			})
+
+			Convey("Then the server should decrypt it", func() {
+				So(processor.PreProcessUDPNetPacket(p, nil, server), ShouldBeTrue)
+				So(p.GetUDPData(), ShouldResemble, payload)
+			})
+
+			Convey("Then the server should drop a replay", func() {
+				replay, err := packet.New(packet.PacketTypeNetwork, append([]byte{}, p.GetBuffer(0)...), "0", true)
+				So(err, ShouldBeNil)
+
+				So(processor.PreProcessUDPNetPacket(p, nil, server), ShouldBeTrue)
+				So(processor.PreProcessUDPNetPacket(replay, nil, server), ShouldBeFalse)
+			})
+
+			Convey("Then the server should drop a modified payload", func() {
+				p.GetUDPData()[udpCounterLength] ^= 1
+				So(processor.PreProcessUDPNetPacket(p, nil, server), ShouldBeFalse)
+			})
+		})
+
+		Convey("When the server receives a short packet", func() {
+
+			p := testUDPPacket([]byte{1, 2, 3})
+
+			Convey("Then it should drop it", func() {
+				So(processor.PreProcessUDPNetPacket(p, nil, server), ShouldBeFalse)
+			})
+		})
+	})
+}
+
+func TestSession(t *testing.T) {
+
+	Convey("Given two sessions", t, func() {
+
+		clientAuth, serverAuth := testAuth()
+		client, err := newSession(clientAuth)
+		So(err, ShouldBeNil)
+		server, err := newSession(serverAuth)
+		So(err, ShouldBeNil)
+
+		Convey("When packets cross an epoch", func() {
+
+			client.counter = 1<<rekeyShift - 2
+
+			var packets [][]byte
+			var counters []uint64
+			var tags [][]byte
+			for i := 0; i < 4; i++ {
+				data := []byte{byte(i), 1, 2, 3}
+				counter, tag, err := client.seal(data, nil, maxUDPCounter)
+				So(err, ShouldBeNil)
+				packets = append(packets, data)
+				counters = append(counters, counter)
+				tags = append(tags, append([]byte{}, tag...))
+			}
+
+			Convey("Then they should be decrypted in any order", func() {
+				for _, i := range []int{3, 0, 2, 1} {
+					So(server.open(counters[i], packets[i], tags[i], nil), ShouldBeNil)
+					So(packets[i], ShouldResemble, []byte{byte(i), 1, 2, 3})
+				}
+			})
+		})
+
+		Convey("When the directions are swapped", func() {
+
+			data := []byte{1, 2, 3}
+			counter, tag, err := client.seal(data, nil, maxUDPCounter)
+			So(err, ShouldBeNil)
+
+			Convey("Then the sender should not decrypt its own packet", func() {
+				So(client.open(counter, data, tag, nil), ShouldNotBeNil)
+			})
+		})
+
+		Convey("When the counter is exhausted", func() {
+
+			client.counter = maxTCPCounter
+			_, _, err := client.seal([]byte{1}, nil, maxTCPCounter)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldEqual, errCounterExhausted)
+			})
+		})
+
+		Convey("When there is no secret", func() {
+
+			_, err := newSession(&connection.AuthInfo{})
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldEqual, errNoSecret)
+			})
+		})
+	})
+}
+
+func TestReplayWindow(t *testing.T) {
+
+	Convey("Given a replay window", t, func() {
+
+		var w replayWindow
+
+		Convey("Then counter 0 should be rejected", func() {
+			So(w.check(0), ShouldBeFalse)
+		})
+
+		Convey("When counters are received out of order", func() {
+
+			for _, c := range []uint64{1, 5, 3} {
+				So(w.check(c), ShouldBeTrue)
+				w.update(c)
+			}
+
+			Convey("Then the missing counters should be accepted once", func() {
+				So(w.check(2), ShouldBeTrue)
+				So(w.check(4), ShouldBeTrue)
+				So(w.check(3), ShouldBeFalse)
+				So(w.check(5), ShouldBeFalse)
+			})
+		})
+
+		Convey("When the window slides", func() {
+
+			w.update(10)
+			w.update(10 + replayWindowSize)
+
+			Convey("Then old counters should be rejected", func() {
+				So(w.check(10), ShouldBeFalse)
+				So(w.check(11), ShouldBeTrue)
+				So(w.check(10+replayWindowSize), ShouldBeFalse)
+				So(w.check(10+replayWindowSize+1), ShouldBeTrue)
+			})
+		})
+	})
+}
@@ -0,0 +1,64 @@
+package encryption
+
+// replayWindowSize is the number of counters tracked below the highest
+// counter received.
+const replayWindowSize = 1024
+
+// replayWindow is a sliding window of the counters received on a connection
+// like the one of IPsec. A counter below the window or already received is a
+// replay.
+type replayWindow struct {
+	highest uint64
+	bitmap  [replayWindowSize / 64]uint64
+}
+
+// check returns true if the counter has not been received yet. The window is
+// only updated once the packet has been authenticated.
+func (w *replayWindow) check(counter uint64) bool {
+
+	if counter == 0 {
+		return false
+	}
+
+	if counter > w.highest {
+		return true
+	}
+
+	if w.highest-counter >= replayWindowSize {
+		return false
+	}
+
+	return !w.isSet(counter)
+}
+
+// update records an authenticated counter and slides the window.
+func (w *replayWindow) update(counter uint64) {
+
+	if counter > w.highest {
+		if counter-w.highest >= replayWindowSize {
+			w.bitmap = [replayWindowSize / 64]uint64{}
+		} else {
+			for c := w.highest + 1; c < counter; c++ {
+				w.clear(c)
+			}
+		}
+		w.highest = counter
+	}
+
+	w.set(counter)
+}
+
+func (w *replayWindow) isSet(counter uint64) bool {
+	bit := counter % replayWindowSize
+	return w.bitmap[bit/64]&(1<<(bit%64)) != 0
+}
+
+func (w *replayWindow) set(counter uint64) {
+	bit := counter % replayWindowSize
+	w.bitmap[bit/64] |= 1 << (bit % 64)
+}
+
+func (w *replayWindow) clear(counter uint64) {
+	bit := counter % replayWindowSize
+	w.bitmap[bit/64] &^= 1 << (bit % 64)
+}
@@ -0,0 +1,190 @@
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+
+	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/connection"
+)
+
+const (
+	// tagLength is the length of the authentication tag of a packet.
+	tagLength = 12
+
+	// rekeyShift is the log2 of the number of packets encrypted with a key.
+	// The key of a direction changes when the counter enters a new epoch.
+	rekeyShift = 24
+)
+
+// keyLabel is the label of the expansion of the keys.
+var keyLabel = []byte("trireme payload encryption")
+
+var (
+	errNoSecret         = errors.New("no secret negotiated for the connection")
+	errCounterExhausted = errors.New("packet counter exhausted")
+	errReplay           = errors.New("replayed packet")
+)
+
+// session is the encryption state of a connection. Each direction has its
+// own key derived from the secret of the connection and the nonces of both
+// ends, so that the nonce of the sender comes first.
+type session struct {
+	send    *keySchedule
+	receive *keySchedule
+	counter uint64
+	window  replayWindow
+	scratch []byte
+}
+
+func newSession(auth *connection.AuthInfo) (*session, error) {
+
+	if len(auth.SecretKey) == 0 || len(auth.RemoteNonce) == 0 {
+		return nil, errNoSecret
+	}
+
+	return &session{
+		send:    newKeySchedule(auth.SecretKey, auth.Nonce[:], auth.RemoteNonce),
+		receive: newKeySchedule(auth.SecretKey, auth.RemoteNonce, auth.Nonce[:]),
+	}, nil
+}
+
+// seal encrypts the data in place and returns the counter and the tag of
+// the packet. The counter must not exceed the max counter.
+func (s *session) seal(data []byte, aad []byte, maxCounter uint64) (uint64, []byte, error) {
+
+	if s.counter >= maxCounter {
+		return 0, nil, errCounterExhausted
+	}
+	s.counter++
+
+	aead, err := s.send.aead(s.counter >> rekeyShift)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	nonce := packetNonce(s.counter)
+	sealed := aead.Seal(s.scratch[:0], nonce[:], data, aad)
+	s.scratch = sealed[:0]
+
+	copy(data, sealed[:len(data)])
+
+	return s.counter, sealed[len(data):], nil
+}
+
+// open checks the counter against the replay window, authenticates the data
+// and decrypts it in place.
+func (s *session) open(counter uint64, data []byte, tag []byte, aad []byte) error {
+
+	if !s.window.check(counter) {
+		return errReplay
+	}
+
+	aead, err := s.receive.aead(counter >> rekeyShift)
+	if err != nil {
+		return err
+	}
+
+	sealed := append(s.scratch[:0], data...)
+	sealed = append(sealed, tag...)
+	s.scratch = sealed[:0]
+
+	nonce := packetNonce(counter)
+	plaintext, err := aead.Open(sealed[:0], nonce[:], sealed, aad)
+	if err != nil {
+		return err
+	}
+
+	copy(data, plaintext)
+	s.window.update(counter)
+
+	return nil
+}
+
+// keySchedule derives the keys of one direction of a connection. It keeps
+// the key of the current epoch and of the previous one for the packets that
+// are reordered around a key change.
+type keySchedule struct {
+	prk      []byte
+	epoch    uint64
+	current  cipher.AEAD
+	previous cipher.AEAD
+}
+
+func newKeySchedule(secret, senderNonce, receiverNonce []byte) *keySchedule {
+
+	salt := make([]byte, 0, len(senderNonce)+len(receiverNonce))
+	salt = append(salt, senderNonce...)
+	salt = append(salt, receiverNonce...)
+
+	// HKDF extract step.
+	mac := hmac.New(sha256.New, salt)
+	mac.Write(secret) // nolint: errcheck
+
+	return &keySchedule{
+		prk: mac.Sum(nil),
+	}
+}
+
+// aead returns the cipher of an epoch.
+func (k *keySchedule) aead(epoch uint64) (cipher.AEAD, error) {
+
+	if k.current != nil {
+		if epoch == k.epoch {
+			return k.current, nil
+		}
+		if epoch+1 == k.epoch && k.previous != nil {
+			return k.previous, nil
+		}
+	}
+
+	aead, err := k.derive(epoch)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only move forward. Older epochs are derived again if they are needed.
+	if k.current == nil || epoch > k.epoch {
+		k.previous = nil
+		if k.current != nil && epoch == k.epoch+1 {
+			k.previous = k.current
+		}
+		k.current = aead
+		k.epoch = epoch
+	}
+
+	return aead, nil
+}
+
+// derive expands the key of an epoch. The key is the first block of the HKDF
+// expand step with the label and the epoch as info.
+func (k *keySchedule) derive(epoch uint64) (cipher.AEAD, error) {
+
+	info := make([]byte, len(keyLabel)+9)
+	copy(info, keyLabel)
+	binary.BigEndian.PutUint64(info[len(keyLabel):], epoch)
+	info[len(info)-1] = 1
+
+	mac := hmac.New(sha256.New, k.prk)
+	mac.Write(info) // nolint: errcheck
+
+	block, err := aes.NewCipher(mac.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCMWithTagSize(block, tagLength)
+}
+
+// packetNonce returns the nonce of a packet. Counters are never reused with
+// a key, so the nonces are unique.
+func packetNonce(counter uint64) [12]byte {
+
+	var nonce [12]byte
+	binary.BigEndian.PutUint64(nonce[4:], counter)
+
+	return nonce
+}
@@ -0,0 +1,49 @@
+// +build linux
+
+package nfqdatapath
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"go.aporeto.io/enforcerd/trireme-lib/policy"
+)
+
+func TestEncryptionRequired(t *testing.T) {
+
+	Convey("Given a policy without encrypted rules", t, func() {
+		p := policy.NewPUPolicyWithDefaults()
+		p.AddTransmitterRules(policy.TagSelector{Policy: &policy.FlowPolicy{Action: policy.Accept}})
+		p.AddReceiverRules(policy.TagSelector{})
+
+		Convey("Encryption should not be required", func() {
+			So(encryptionRequired(p), ShouldBeFalse)
+			So(encryptionRequired(nil), ShouldBeFalse)
+		})
+
+		Convey("A receiver rule that encrypts should require encryption", func() {
+			p.AddReceiverRules(policy.TagSelector{Policy: &policy.FlowPolicy{Action: policy.Accept | policy.Encrypt}})
+			So(encryptionRequired(p), ShouldBeTrue)
+		})
+	})
+}
+
+func TestEnableEncryption(t *testing.T) {
+
+	Convey("Given a datapath", t, func() {
+		d := &Datapath{}
+
+		Convey("There should be no packet processor until encryption is enabled", func() {
+			So(d.packetProcessor(), ShouldBeNil)
+
+			d.enableEncryption()
+			service := d.packetProcessor()
+			So(service, ShouldNotBeNil)
+
+			Convey("Enabling it again should keep the same processor", func() {
+				d.enableEncryption()
+				So(d.packetProcessor(), ShouldEqual, service)
+			})
+		})
+	})
+}
@@ -197,6 +197,9 @@ func recordFromNFLogData(payload []byte, prefix string, protocol uint8, srcIP, d
 		record.Source.ID = pu.ManagementID()
 		record.Destination.Type = collector.EndPointTypeExternalIP
 		record.Destination.ID = extNetworkID
+		if protocol == packet.IPProtocolTCP {
+			record.ServiceID = pu.DependentServiceID(dstIP, dstPort)
+		}
 	} else {
 		record.Source.Type = collector.EndPointTypeExternalIP
 		record.Source.ID = extNetworkID
@@ -71,6 +71,7 @@ func (d *Datapath) processNetworkPacketsFromNFQ(p *nfqueue.NFPacket) {
 	var tcpConn *connection.TCPConnection
 	var udpConn *connection.UDPConnection
 	var processAfterVerdict func()
+	var handshake bool
 
 	netPacket := &packet.Packet{}
 	err := netPacket.NewPacket(packet.PacketTypeNetwork, p.Buffer, strconv.Itoa(p.Mark), true)
@@ -80,8 +81,11 @@ func (d *Datapath) processNetworkPacketsFromNFQ(p *nfqueue.NFPacket) {
 		p.QueueHandle.SetVerdict2(uint32(p.QueueHandle.QueueNum), drop, 0, 0, uint32(p.ID), []byte{0})
 		return
 	} else if netPacket.IPProto() == packet.IPProtocolTCP {
+		// The token is detached while processing the packet
+		handshake = d.isCapturing() && isHandshakePacket(netPacket)
 		tcpConn, processAfterVerdict, processError = d.processNetworkTCPPackets(netPacket)
 	} else if netPacket.IPProto() == packet.IPProtocolUDP {
+		handshake = d.isCapturing() && isHandshakePacket(netPacket)
 		udpConn, processError = d.ProcessNetworkUDPPacket(netPacket)
 	} else if netPacket.IPProto() == packet.IPProtocolICMP {
 		icmpType, icmpCode := netPacket.GetICMPTypeCode()
@@ -128,21 +132,23 @@ func (d *Datapath) processNetworkPacketsFromNFQ(p *nfqueue.NFPacket) {
 		if processError != errDropPingNetSynAck {
 			if netPacket.IPProto() == packet.IPProtocolTCP {
 				d.collectTCPPacket(&debugpacketmessage{
-					Mark:    p.Mark,
-					p:       netPacket,
-					tcpConn: tcpConn,
-					udpConn: nil,
-					err:     processError,
-					network: true,
+					Mark:      p.Mark,
+					p:         netPacket,
+					tcpConn:   tcpConn,
+					udpConn:   nil,
+					err:       processError,
+					network:   true,
+					handshake: handshake,
 				})
 			} else if netPacket.IPProto() == packet.IPProtocolUDP {
 				d.collectUDPPacket(&debugpacketmessage{
-					Mark:    p.Mark,
-					p:       netPacket,
-					tcpConn: nil,
-					udpConn: udpConn,
-					err:     processError,
-					network: true,
+					Mark:      p.Mark,
+					p:         netPacket,
+					tcpConn:   nil,
+					udpConn:   udpConn,
+					err:       processError,
+					network:   true,
+					handshake: handshake,
 				})
 			}
 		}
@@ -170,21 +176,23 @@ func (d *Datapath) processNetworkPacketsFromNFQ(p *nfqueue.NFPacket) {
 
 	if netPacket.IPProto() == packet.IPProtocolTCP {
 		d.collectTCPPacket(&debugpacketmessage{
-			Mark:    p.Mark,
-			p:       netPacket,
-			tcpConn: tcpConn,
-			udpConn: nil,
-			err:     nil,
-			network: true,
+			Mark:      p.Mark,
+			p:         netPacket,
+			tcpConn:   tcpConn,
+			udpConn:   nil,
+			err:       nil,
+			network:   true,
+			handshake: handshake,
 		})
 	} else if netPacket.IPProto() == packet.IPProtocolUDP {
 		d.collectUDPPacket(&debugpacketmessage{
-			Mark:    p.Mark,
-			p:       netPacket,
-			tcpConn: nil,
-			udpConn: udpConn,
-			err:     nil,
-			network: true,
+			Mark:      p.Mark,
+			p:         netPacket,
+			tcpConn:   nil,
+			udpConn:   udpConn,
+			err:       nil,
+			network:   true,
+			handshake: handshake,
 		})
 	}
 
@@ -196,6 +204,7 @@ func (d *Datapath) processApplicationPacketsFromNFQ(p *nfqueue.NFPacket) {
 	var processError error
 	var tcpConn *connection.TCPConnection
 	var udpConn *connection.UDPConnection
+	var handshake bool
 
 	appPacket := &packet.Packet{}
 	err := appPacket.NewPacket(packet.PacketTypeApplication, p.Buffer, strconv.Itoa(p.Mark), true)
@@ -206,9 +215,12 @@ func (d *Datapath) processApplicationPacketsFromNFQ(p *nfqueue.NFPacket) {
 		p.QueueHandle.SetVerdict2(uint32(p.QueueHandle.QueueNum), drop, 0, 0, uint32(p.ID), []byte{0})
 		return
 	} else if appPacket.IPProto() == packet.IPProtocolTCP {
+		// The token is attached while processing the packet
 		tcpConn, processError = d.processApplicationTCPPackets(appPacket)
+		handshake = d.isCapturing() && isHandshakePacket(appPacket)
 	} else if appPacket.IPProto() == packet.IPProtocolUDP {
 		udpConn, processError = d.ProcessApplicationUDPPacket(appPacket)
+		handshake = d.isCapturing() && isHandshakePacket(appPacket)
 	} else if appPacket.IPProto() == packet.IPProtocolICMP {
 		icmpType, icmpCode := appPacket.GetICMPTypeCode()
 		context, err := d.contextFromIP(true, appPacket.Mark, 0, packet.IPProtocolICMP)
@@ -251,22 +263,24 @@ func (d *Datapath) processApplicationPacketsFromNFQ(p *nfqueue.NFPacket) {
 
 		if appPacket.IPProto() == packet.IPProtocolTCP {
 			d.collectTCPPacket(&debugpacketmessage{
-				Mark:    p.Mark,
-				p:       appPacket,
-				tcpConn: tcpConn,
-				udpConn: nil,
-				err:     processError,
-				network: false,
+				Mark:      p.Mark,
+				p:         appPacket,
+				tcpConn:   tcpConn,
+				udpConn:   nil,
+				err:       processError,
+				network:   false,
+				handshake: handshake,
 			})
 
 		} else if appPacket.IPProto() == packet.IPProtocolUDP {
 			d.collectUDPPacket(&debugpacketmessage{
-				Mark:    p.Mark,
-				p:       appPacket,
-				tcpConn: nil,
-				udpConn: udpConn,
-				err:     processError,
-				network: false,
+				Mark:      p.Mark,
+				p:         appPacket,
+				tcpConn:   nil,
+				udpConn:   udpConn,
+				err:       processError,
+				network:   false,
+				handshake: handshake,
 			})
 		}
 		return
@@ -294,25 +308,27 @@ func (d *Datapath) processApplicationPacketsFromNFQ(p *nfqueue.NFPacket) {
 			id = d.puFromIP.ID()
 		}
 
-		if _, err = d.packetTracingCache.Get(id); err == nil {
+		if _, err = d.packetTracingCache.Get(id); err == nil || d.isCapturing() {
 			d.collectTCPPacket(&debugpacketmessage{
-				Mark:    p.Mark,
-				p:       appPacket,
-				tcpConn: tcpConn,
-				udpConn: nil,
-				err:     nil,
-				network: false,
+				Mark:      p.Mark,
+				p:         appPacket,
+				tcpConn:   tcpConn,
+				udpConn:   nil,
+				err:       nil,
+				network:   false,
+				handshake: handshake,
 			})
 		}
 
 	} else if appPacket.IPProto() == packet.IPProtocolUDP {
 		d.collectUDPPacket(&debugpacketmessage{
-			Mark:    p.Mark,
-			p:       appPacket,
-			tcpConn: nil,
-			udpConn: udpConn,
-			err:     nil,
-			network: false,
+			Mark:      p.Mark,
+			p:         appPacket,
+			tcpConn:   nil,
+			udpConn:   udpConn,
+			err:       nil,
+			network:   false,
+			handshake: handshake,
 		})
 	}
 }
@@ -68,24 +68,30 @@ func (d *Datapath) startFrontmanPacketFilter(_ context.Context, nflogger nflog.N
 		var tcpConn *connection.TCPConnection
 		var udpConn *connection.UDPConnection
 		var f func()
+		var handshake bool
 
 		if err != nil {
 			parsedPacket.Print(packet.PacketFailureCreate, d.packetLogs)
 		} else if parsedPacket.IPProto() == packet.IPProtocolTCP {
 			if packetType == packet.PacketTypeNetwork {
+				// The token is detached while processing the packet
+				handshake = d.isCapturing() && isHandshakePacket(parsedPacket)
 				tcpConn, f, processError = d.processNetworkTCPPackets(parsedPacket)
 				if f != nil {
 					f()
 				}
 			} else {
 				tcpConn, processError = d.processApplicationTCPPackets(parsedPacket)
+				handshake = d.isCapturing() && isHandshakePacket(parsedPacket)
 			}
 		} else if parsedPacket.IPProto() == packet.IPProtocolUDP {
 			// process udp packet
 			if packetType == packet.PacketTypeNetwork {
+				handshake = d.isCapturing() && isHandshakePacket(parsedPacket)
 				udpConn, processError = d.ProcessNetworkUDPPacket(parsedPacket)
 			} else {
 				udpConn, processError = d.ProcessApplicationUDPPacket(parsedPacket)
+				handshake = d.isCapturing() && isHandshakePacket(parsedPacket)
 			}
 		} else {
 			processError = fmt.Errorf("invalid ip protocol: %d", parsedPacket.IPProto())
@@ -94,21 +100,23 @@ func (d *Datapath) startFrontmanPacketFilter(_ context.Context, nflogger nflog.N
 		if processError != nil {
 			if parsedPacket.IPProto() == packet.IPProtocolTCP {
 				d.collectTCPPacket(&debugpacketmessage{
-					Mark:    mark,
-					p:       parsedPacket,
-					tcpConn: tcpConn,
-					udpConn: nil,
-					err:     processError,
-					network: packetType == packet.PacketTypeNetwork,
+					Mark:      mark,
+					p:         parsedPacket,
+					tcpConn:   tcpConn,
+					udpConn:   nil,
+					err:       processError,
+					network:   packetType == packet.PacketTypeNetwork,
+					handshake: handshake,
 				})
 			} else if parsedPacket.IPProto() == packet.IPProtocolUDP {
 				d.collectUDPPacket(&debugpacketmessage{
-					Mark:    mark,
-					p:       parsedPacket,
-					tcpConn: nil,
-					udpConn: udpConn,
-					err:     processError,
-					network: packetType == packet.PacketTypeNetwork,
+					Mark:      mark,
+					p:         parsedPacket,
+					tcpConn:   nil,
+					udpConn:   udpConn,
+					err:       processError,
+					network:   packetType == packet.PacketTypeNetwork,
+					handshake: handshake,
 				})
 			}
 			// drop packet by not forwarding it
@@ -139,21 +147,23 @@ func (d *Datapath) startFrontmanPacketFilter(_ context.Context, nflogger nflog.N
 
 		if parsedPacket.IPProto() == packet.IPProtocolTCP {
 			d.collectTCPPacket(&debugpacketmessage{
-				Mark:    mark,
-				p:       parsedPacket,
-				tcpConn: tcpConn,
-				udpConn: nil,
-				err:     nil,
-				network: packetType == packet.PacketTypeNetwork,
+				Mark:      mark,
+				p:         parsedPacket,
+				tcpConn:   tcpConn,
+				udpConn:   nil,
+				err:       nil,
+				network:   packetType == packet.PacketTypeNetwork,
+				handshake: handshake,
 			})
 		} else if parsedPacket.IPProto() == packet.IPProtocolUDP {
 			d.collectUDPPacket(&debugpacketmessage{
-				Mark:    mark,
-				p:       parsedPacket,
-				tcpConn: nil,
-				udpConn: udpConn,
-				err:     nil,
-				network: packetType == packet.PacketTypeNetwork,
+				Mark:      mark,
+				p:         parsedPacket,
+				tcpConn:   nil,
+				udpConn:   udpConn,
+				err:       nil,
+				network:   packetType == packet.PacketTypeNetwork,
+				handshake: handshake,
 			})
 		}
 
@@ -0,0 +1,60 @@
+package nfqdatapath
+
+import (
+	"time"
+
+	"go.aporeto.io/enforcerd/trireme-lib/collector"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/internal/enforcer/nfqdatapath/replaycache"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/packet"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/pucontext"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/tokens"
+	"go.uber.org/zap"
+)
+
+// tokenReplayed returns true if the PU detects the replayed tokens and the
+// token has already been received from another address. The tokens are keyed
+// on their signed data, since their nonce can be changed without invalidating
+// them. The replay is reported as a connection exception.
+func (d *Datapath) tokenReplayed(context *pucontext.PUContext, p *packet.Packet, token []byte, state string) bool {
+
+	if !context.ReplayProtection() {
+		return false
+	}
+
+	signed, err := tokens.SignedData(token)
+	if err != nil || len(signed) == 0 {
+		return false
+	}
+
+	// The cache is only allocated once a PU detects the replayed tokens.
+	d.replayCacheOnce.Do(func() {
+		d.replayCache = replaycache.New(d.replayWindow, replaycache.DefaultCapacity, replaycache.DefaultFalsePositiveRate)
+	})
+
+	if !d.replayCache.Replayed(signed, p.SourceAddress().String()) {
+		return false
+	}
+
+	zap.L().Warn("Replayed token",
+		zap.String("contextID", context.ManagementID()),
+		zap.String("flow", p.L4FlowHash()),
+		zap.String("state", state),
+	)
+
+	if d.collector != nil {
+		d.collector.CollectConnectionExceptionReport(&collector.ConnectionExceptionReport{
+			Timestamp:       time.Now(),
+			PUID:            context.ManagementID(),
+			Namespace:       context.ManagementNamespace(),
+			Protocol:        int(p.IPProto()),
+			SourceIP:        p.SourceAddress().String(),
+			DestinationIP:   p.DestinationAddress().String(),
+			DestinationPort: p.DestPort(),
+			State:           state,
+			Reason:          collector.ReplayedToken,
+			Value:           1,
+		})
+	}
+
+	return true
+}
@@ -0,0 +1,85 @@
+// +build linux
+
+package nfqdatapath
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.aporeto.io/enforcerd/trireme-lib/collector"
+	"go.aporeto.io/enforcerd/trireme-lib/collector/mockcollector"
+	"go.aporeto.io/enforcerd/trireme-lib/common"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/claimsheader"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/packet"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/pucontext"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/secrets/mocksecrets"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/tokens"
+	"go.aporeto.io/enforcerd/trireme-lib/policy"
+)
+
+func TestTokenReplayed(t *testing.T) {
+
+	Convey("Given a PU that detects the replayed tokens and a syn token", t, func() {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+		So(err, ShouldBeNil)
+
+		scrts := mocksecrets.NewMockSecrets(ctrl)
+		scrts.EXPECT().EncodingKey().Return(privateKey).AnyTimes()
+		scrts.EXPECT().TransmittedKey().Return([]byte("transmittedkey")).AnyTimes()
+
+		jwtConfig, err := tokens.NewBinaryJWT(time.Minute, "server")
+		So(err, ShouldBeNil)
+
+		var encodedBuf [tokens.ClaimsEncodedBufSize]byte
+		token, err := jwtConfig.CreateSynToken(&tokens.ConnectionClaims{
+			ID:  "5c5baa93d5f54a3019bede4e",
+			LCL: []byte("0123456789abcdef"),
+		}, encodedBuf[:], []byte("0123456789abcdef"), claimsheader.NewClaimsHeader(), scrts)
+		So(err, ShouldBeNil)
+
+		puInfo := policy.NewPUInfo("pu", "/ns", common.ContainerPU)
+		puInfo.Policy.SetReplayProtection(true)
+		context, err := pucontext.NewPU("pu", puInfo, nil, time.Minute)
+		So(err, ShouldBeNil)
+
+		mockCollector := mockcollector.NewMockEventCollector(ctrl)
+		d := &Datapath{collector: mockCollector, replayWindow: time.Minute}
+
+		peer := packet.TestGetTCPPacket(net.ParseIP("1.1.1.1"), net.ParseIP("2.2.2.2"), 2000, 80)
+		So(d.tokenReplayed(context, peer, token, "syn"), ShouldBeFalse)
+
+		Convey("The token of a new connection of the same peer should not be a replay", func() {
+			So(jwtConfig.Randomize(token, []byte("fedcba9876543210")), ShouldBeNil)
+			p := packet.TestGetTCPPacket(net.ParseIP("1.1.1.1"), net.ParseIP("2.2.2.2"), 2001, 80)
+			So(d.tokenReplayed(context, p, token, "syn"), ShouldBeFalse)
+		})
+
+		Convey("The token sent from another address with its nonce changed should be a replay", func() {
+			mockCollector.EXPECT().CollectConnectionExceptionReport(gomock.Any()).Do(func(r *collector.ConnectionExceptionReport) {
+				So(r.Reason, ShouldEqual, collector.ReplayedToken)
+				So(r.SourceIP, ShouldEqual, "3.3.3.3")
+			}).Times(1)
+
+			So(jwtConfig.Randomize(token, []byte("fedcba9876543210")), ShouldBeNil)
+			p := packet.TestGetTCPPacket(net.ParseIP("3.3.3.3"), net.ParseIP("2.2.2.2"), 2000, 80)
+			So(d.tokenReplayed(context, p, token, "syn"), ShouldBeTrue)
+		})
+
+		Convey("The tokens of a PU that does not detect the replays should be accepted", func() {
+			puInfo.Policy.SetReplayProtection(false)
+			other, err := pucontext.NewPU("other", puInfo, nil, time.Minute)
+			So(err, ShouldBeNil)
+
+			p := packet.TestGetTCPPacket(net.ParseIP("3.3.3.3"), net.ParseIP("2.2.2.2"), 2000, 80)
+			So(d.tokenReplayed(other, p, token, "syn"), ShouldBeFalse)
+		})
+	})
+}
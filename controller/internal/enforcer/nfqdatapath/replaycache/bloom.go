@@ -0,0 +1,76 @@
+package replaycache
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"math"
+)
+
+// bloomFilter is a Bloom filter with k bits per key. The bit positions are
+// derived from a single sha256 hash with double hashing.
+type bloomFilter struct {
+	bits []uint64
+	m    uint64
+	k    uint64
+	seed []byte
+}
+
+// newBloomFilter creates a filter sized for capacity keys at the given false
+// positive rate.
+func newBloomFilter(capacity int, falsePositiveRate float64, seed []byte) *bloomFilter {
+
+	n := float64(capacity)
+	m := math.Ceil(-n * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2))
+	k := math.Round(m / n * math.Ln2)
+	if k < 1 {
+		k = 1
+	}
+
+	words := (uint64(m) + 63) / 64
+
+	return &bloomFilter{
+		bits: make([]uint64, words),
+		m:    words * 64,
+		k:    uint64(k),
+		seed: seed,
+	}
+}
+
+// hash returns the two hashes of the key used to derive its bit positions.
+func (b *bloomFilter) hash(key ...[]byte) (uint64, uint64) {
+
+	h := sha256.New()
+	h.Write(b.seed) // nolint: errcheck
+	for _, k := range key {
+		h.Write(k) // nolint: errcheck
+	}
+	sum := h.Sum(nil)
+
+	return binary.BigEndian.Uint64(sum[:8]), binary.BigEndian.Uint64(sum[8:16]) | 1
+}
+
+// add adds the key to the filter.
+func (b *bloomFilter) add(h1, h2 uint64) {
+	for i := uint64(0); i < b.k; i++ {
+		bit := (h1 + i*h2) % b.m
+		b.bits[bit/64] |= 1 << (bit % 64)
+	}
+}
+
+// test returns true if the key may have been added to the filter.
+func (b *bloomFilter) test(h1, h2 uint64) bool {
+	for i := uint64(0); i < b.k; i++ {
+		bit := (h1 + i*h2) % b.m
+		if b.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// reset removes all the keys of the filter.
+func (b *bloomFilter) reset() {
+	for i := range b.bits {
+		b.bits[i] = 0
+	}
+}
@@ -0,0 +1,156 @@
+package replaycache
+
+import (
+	"crypto/rand"
+	"sync"
+	"time"
+)
+
+const (
+	// numBuckets is the number of time buckets of the cache. The oldest bucket
+	// is dropped when a new one starts.
+	numBuckets = 4
+
+	// DefaultWindow is the default time the tokens are remembered.
+	DefaultWindow = time.Minute
+
+	// DefaultCapacity is the default number of tokens recorded per bucket.
+	DefaultCapacity = 100000
+
+	// DefaultFalsePositiveRate is the default false positive rate of the
+	// filters of a bucket.
+	DefaultFalsePositiveRate = 1e-6
+)
+
+// bucket records the tokens received during an interval of the window.
+type bucket struct {
+	keys  *bloomFilter
+	peers *bloomFilter
+	start time.Time
+	count int
+}
+
+// Cache detects the tokens received more than once. A token is identified by
+// a key, the data covered by its signature, and is recorded with the address
+// of the peer that sent it. The tokens sent again by the same peer, like the
+// retransmissions or the syn tokens that a PU reuses for its connections, are
+// not replays. A token sent from another address is.
+//
+// The tokens are recorded in rotating Bloom filters, so that the memory of
+// the cache is bounded whatever the rate of connections. A token is
+// remembered for at least the window of the cache. A bucket that is full
+// rotates before its time, which shortens the window under a flood of
+// connections instead of raising the false positive rate. A false positive
+// on the key that is a false negative on the peer is reported as a replay,
+// which is why the default rate is low.
+type Cache struct {
+	buckets  [numBuckets]*bucket
+	current  int
+	interval time.Duration
+	capacity int
+	now      func() time.Time
+
+	sync.Mutex
+}
+
+// New creates a cache that remembers the tokens for window. Each bucket
+// records up to capacity tokens at the given false positive rate.
+func New(window time.Duration, capacity int, falsePositiveRate float64) *Cache {
+
+	if window <= 0 {
+		window = DefaultWindow
+	}
+
+	if capacity <= 0 {
+		capacity = DefaultCapacity
+	}
+
+	if falsePositiveRate <= 0 || falsePositiveRate >= 1 {
+		falsePositiveRate = DefaultFalsePositiveRate
+	}
+
+	// A random seed prevents keys crafted to collide in the filters.
+	seed := make([]byte, 16)
+	rand.Read(seed) // nolint: errcheck
+
+	c := &Cache{
+		interval: window / (numBuckets - 1),
+		capacity: capacity,
+		now:      time.Now,
+	}
+
+	now := c.now()
+	for i := range c.buckets {
+		c.buckets[i] = &bucket{
+			keys:  newBloomFilter(capacity, falsePositiveRate, seed),
+			peers: newBloomFilter(capacity, falsePositiveRate, seed),
+			start: now,
+		}
+	}
+
+	return c
+}
+
+// Replayed records the token with the given key received from peer and
+// returns true if the same key was received from another peer.
+func (c *Cache) Replayed(key []byte, peer string) bool {
+
+	c.Lock()
+	defer c.Unlock()
+
+	c.rotate()
+
+	keys := c.buckets[c.current].keys
+	k1, k2 := keys.hash(key)
+	p1, p2 := keys.hash(key, []byte(peer))
+
+	seen := false
+	for _, b := range c.buckets {
+		if b.peers.test(p1, p2) {
+			return false
+		}
+		if !seen && b.keys.test(k1, k2) {
+			seen = true
+		}
+	}
+
+	if seen {
+		return true
+	}
+
+	b := c.buckets[c.current]
+	b.keys.add(k1, k2)
+	b.peers.add(p1, p2)
+	b.count++
+
+	return false
+}
+
+// rotate drops the buckets that are older than the window and starts a new
+// bucket when the current one is full or its interval has elapsed.
+func (c *Cache) rotate() {
+
+	now := c.now()
+	b := c.buckets[c.current]
+
+	if b.count < c.capacity && now.Sub(b.start) < c.interval {
+		return
+	}
+
+	elapsed := 1
+	if c.interval > 0 && b.count < c.capacity {
+		elapsed = int(now.Sub(b.start) / c.interval)
+	}
+	if elapsed > numBuckets {
+		elapsed = numBuckets
+	}
+
+	for i := 0; i < elapsed; i++ {
+		c.current = (c.current + 1) % numBuckets
+		next := c.buckets[c.current]
+		next.keys.reset()
+		next.peers.reset()
+		next.count = 0
+		next.start = now
+	}
+}
@@ -0,0 +1,99 @@
+package replaycache
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestReplayed(t *testing.T) {
+
+	Convey("Given a replay cache", t, func() {
+
+		now := time.Now()
+		c := New(3*time.Minute, 1000, 0)
+		c.now = func() time.Time { return now }
+
+		key := []byte("0123456789abcdef")
+
+		Convey("A new token should not be a replay", func() {
+			So(c.Replayed(key, "10.1.1.1"), ShouldBeFalse)
+
+			Convey("A retransmission from the same peer should not be a replay", func() {
+				So(c.Replayed(key, "10.1.1.1"), ShouldBeFalse)
+			})
+
+			Convey("The same key from another peer should be a replay", func() {
+				So(c.Replayed(key, "10.1.1.3"), ShouldBeTrue)
+			})
+
+			Convey("Another key from the same peer should not be a replay", func() {
+				So(c.Replayed([]byte("fedcba9876543210"), "10.1.1.1"), ShouldBeFalse)
+			})
+		})
+
+		Convey("A token should be remembered for the window", func() {
+			So(c.Replayed(key, "10.1.1.1"), ShouldBeFalse)
+
+			now = now.Add(2*time.Minute + 59*time.Second)
+			So(c.Replayed(key, "10.1.1.3"), ShouldBeTrue)
+		})
+
+		Convey("A token should be forgotten after the window", func() {
+			So(c.Replayed(key, "10.1.1.1"), ShouldBeFalse)
+
+			now = now.Add(5 * time.Minute)
+			So(c.Replayed(key, "10.1.1.3"), ShouldBeFalse)
+		})
+
+		Convey("A token should be forgotten after the buckets are filled", func() {
+			So(c.Replayed(key, "10.1.1.1"), ShouldBeFalse)
+
+			for i := 0; i < numBuckets*1000; i++ {
+				c.Replayed([]byte(fmt.Sprintf("key-%d", i)), "10.1.1.1")
+			}
+
+			So(c.Replayed(key, "10.1.1.3"), ShouldBeFalse)
+		})
+
+		Convey("The false positives should stay below the rate", func() {
+			for i := 0; i < 1000; i++ {
+				c.Replayed([]byte(fmt.Sprintf("key-%d", i)), fmt.Sprintf("10.1.%d.%d", i/256, i%256))
+			}
+
+			replays := 0
+			for i := 0; i < 1000; i++ {
+				if c.Replayed([]byte(fmt.Sprintf("other-%d", i)), "10.1.1.1") {
+					replays++
+				}
+			}
+			So(replays, ShouldEqual, 0)
+		})
+	})
+}
+
+func TestBloomFilter(t *testing.T) {
+
+	Convey("Given a bloom filter", t, func() {
+
+		b := newBloomFilter(1000, 0.01, []byte("seed"))
+
+		Convey("It should be sized for the capacity", func() {
+			So(b.m, ShouldEqual, 9600)
+			So(b.k, ShouldEqual, 7)
+		})
+
+		Convey("It should contain the keys added", func() {
+			h1, h2 := b.hash([]byte("key"))
+			So(b.test(h1, h2), ShouldBeFalse)
+
+			b.add(h1, h2)
+			So(b.test(h1, h2), ShouldBeTrue)
+
+			b.reset()
+			So(b.test(h1, h2), ShouldBeFalse)
+		})
+	})
+}
@@ -1,7 +1,6 @@
 package tokenaccessor
 
 import (
-	"crypto/ecdsa"
 	"time"
 
 	"go.aporeto.io/enforcerd/trireme-lib/controller/internal/enforcer/utils/ephemeralkeys"
@@ -26,5 +25,5 @@ type TokenAccessor interface {
 	ParseAckToken(proto314 bool, secretKey []byte, nonce []byte, data []byte, connClaims *tokens.ConnectionClaims) error
 
 	Randomize([]byte, []byte) error
-	Sign([]byte, *ecdsa.PrivateKey) ([]byte, error)
+	Sign([]byte, interface{}) ([]byte, error)
 }
@@ -5,7 +5,6 @@
 package mocktokenaccessor
 
 import (
-	ecdsa "crypto/ecdsa"
 	reflect "reflect"
 	time "time"
 
@@ -146,7 +145,7 @@ func (mr *MockTokenAccessorMockRecorder) Randomize(arg0, arg1 interface{}) *gomo
 }
 
 // Sign mocks base method
-func (m *MockTokenAccessor) Sign(arg0 []byte, arg1 *ecdsa.PrivateKey) ([]byte, error) {
+func (m *MockTokenAccessor) Sign(arg0 []byte, arg1 interface{}) ([]byte, error) {
 	ret := m.ctrl.Call(m, "Sign", arg0, arg1)
 	ret0, _ := ret[0].([]byte)
 	ret1, _ := ret[1].(error)
@@ -2,7 +2,6 @@ package tokenaccessor
 
 import (
 	"bytes"
-	"crypto/ecdsa"
 	"errors"
 	"fmt"
 	"time"
@@ -65,7 +64,7 @@ func (t *tokenAccessor) Randomize(token []byte, nonce []byte) error {
 	return t.tokens.Randomize(token, nonce)
 }
 
-func (t *tokenAccessor) Sign(buf []byte, key *ecdsa.PrivateKey) ([]byte, error) {
+func (t *tokenAccessor) Sign(buf []byte, key interface{}) ([]byte, error) {
 	return t.tokens.Sign(buf, key)
 }
 
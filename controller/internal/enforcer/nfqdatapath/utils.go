@@ -1,6 +1,8 @@
 package nfqdatapath
 
 import (
+	"net"
+
 	"go.aporeto.io/enforcerd/trireme-lib/collector"
 	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/connection"
 	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/packet"
@@ -101,6 +103,7 @@ func (d *Datapath) reportExternalServiceFlowCommon(context *pucontext.PUContext,
 		Namespace:   context.ManagementNamespace(),
 		Count:       1,
 		RuleName:    actual.RuleName,
+		ServiceID:   dependentServiceID(context, dst),
 	}
 
 	if context.Annotations() != nil {
@@ -191,3 +194,16 @@ func getUDPConnectionInfo(conn *connection.UDPConnection) (string, string) {
 	}
 	return sourceController, destinationController
 }
+
+// dependentServiceID returns the ID of the dependent service of the PU that is
+// the destination of a flow, like a Kubernetes service reached with its
+// ClusterIP or with the address of one of its endpoints.
+func dependentServiceID(context *pucontext.PUContext, dst *collector.EndPoint) string {
+
+	ip := net.ParseIP(dst.IP)
+	if ip == nil {
+		return ""
+	}
+
+	return context.DependentServiceID(ip, dst.Port)
+}
@@ -16,6 +16,7 @@ import (
 	"go.aporeto.io/enforcerd/trireme-lib/controller/internal/enforcer"
 	"go.aporeto.io/enforcerd/trireme-lib/controller/internal/enforcer/utils/rpcwrapper"
 	"go.aporeto.io/enforcerd/trireme-lib/controller/internal/processmon"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/connection"
 	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/ebpf"
 	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/env"
 	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/fqconfig"
@@ -312,6 +313,14 @@ func (s *ProxyInfo) GetServiceMeshType() policy.ServiceMesh {
 	return policy.None
 }
 
+// currentSecrets returns the current secrets.
+func (s *ProxyInfo) currentSecrets() secrets.Secrets {
+	s.RLock()
+	defer s.RUnlock()
+
+	return s.Secrets
+}
+
 // GetFilterQueue returns the current FilterQueueConfig.
 func (s *ProxyInfo) GetFilterQueue() fqconfig.FilterQueue {
 	return s.filterQueue
@@ -325,6 +334,7 @@ func (s *ProxyInfo) Run(ctx context.Context) error {
 		collector:   s.collector,
 		secret:      s.statsServerSecret,
 		tokenIssuer: s.tokenIssuer,
+		secrets:     s.currentSecrets,
 		ctx:         ctx,
 	}
 
@@ -365,6 +375,11 @@ func (s *ProxyInfo) DebugCollect(ctx context.Context, contextID string, debugCon
 			PcapFilePath: debugConfig.FilePath,
 			PcapFilter:   debugConfig.PcapFilter,
 			CommandExec:  debugConfig.CommandExec,
+			PcapNative:   debugConfig.PcapNative,
+			PcapDuration: debugConfig.PcapDuration,
+			PcapMaxSize:  debugConfig.PcapMaxSize,
+			PcapFileSize: debugConfig.PcapFileSize,
+			PcapFiles:    debugConfig.PcapFiles,
 		},
 	}
 
@@ -379,6 +394,39 @@ func (s *ProxyInfo) DebugCollect(ctx context.Context, contextID string, debugCon
 	return nil
 }
 
+// ConnectionTable returns a snapshot of the connection tables of the remote enforcer
+// of the given PU. The contextID is required to find the remote enforcer.
+func (s *ProxyInfo) ConnectionTable(ctx context.Context, contextID string, filter *connection.TableFilter) ([]*connection.TableEntry, error) {
+
+	if contextID == "" {
+		return nil, fmt.Errorf("unable to get connection table: no context ID")
+	}
+
+	resp := &rpcwrapper.Response{}
+
+	payload := &rpcwrapper.ConnectionTablePayload{
+		ContextID: contextID,
+	}
+	if filter != nil {
+		payload.Filter = *filter
+	}
+
+	request := &rpcwrapper.Request{
+		Payload: payload,
+	}
+
+	if err := s.rpchdl.RemoteCall(contextID, remoteenforcer.ConnectionTable, request, resp); err != nil {
+		return nil, fmt.Errorf("unable to get connection table %s -- %s", err, resp.Status)
+	}
+
+	responsePayload, ok := resp.Payload.(rpcwrapper.ConnectionTableResponsePayload)
+	if !ok {
+		return nil, fmt.Errorf("unable to get connection table: invalid response payload")
+	}
+
+	return responsePayload.Entries, nil
+}
+
 // initRemoteEnforcer method makes a RPC call to the remote enforcer
 func (s *ProxyInfo) initRemoteEnforcer(contextID string) error {
 
@@ -2,7 +2,12 @@ package enforcerproxy
 
 import (
 	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/asn1"
 	"fmt"
+	"math/big"
 	"testing"
 	"time"
 
@@ -14,6 +19,7 @@ import (
 	"go.aporeto.io/enforcerd/trireme-lib/controller/internal/enforcer/utils/rpcwrapper"
 	"go.aporeto.io/enforcerd/trireme-lib/controller/internal/enforcer/utils/rpcwrapper/mockrpcwrapper"
 	"go.aporeto.io/enforcerd/trireme-lib/controller/internal/processmon/mockprocessmon"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/connection"
 	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/env"
 	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/fqconfig"
 	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/packettracing"
@@ -397,6 +403,53 @@ func TestEnableIPTablesPacketTracing(t *testing.T) {
 	})
 }
 
+func TestConnectionTable(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	Convey("When I try to start a proxy enforcer with defaults", t, func() {
+		rpchdl := mockrpcwrapper.NewMockRPCClient(ctrl)
+		prochdl := mockprocessmon.NewMockProcessManager(ctrl)
+		policyEnf := setupProxyEnforcer()
+		e := policyEnf.(*ProxyInfo)
+		e.rpchdl = rpchdl
+		e.prochdl = prochdl
+
+		Convey("When I try to get the connection table", func() {
+			rpchdl.EXPECT().RemoteCall("testServerID", remoteenforcer.ConnectionTable, gomock.Any(), gomock.Any()).Times(1).DoAndReturn(
+				func(contextID string, method string, req *rpcwrapper.Request, resp *rpcwrapper.Response) error {
+					So(req.Payload.(*rpcwrapper.ConnectionTablePayload).Filter.Port, ShouldEqual, 443)
+					resp.Payload = rpcwrapper.ConnectionTableResponsePayload{
+						ContextID: contextID,
+						Entries:   []*connection.TableEntry{{Key: "key"}},
+					}
+					return nil
+				})
+			entries, err := e.ConnectionTable(context.TODO(), "testServerID", &connection.TableFilter{Port: 443})
+			So(err, ShouldBeNil)
+			So(len(entries), ShouldEqual, 1)
+			So(entries[0].Key, ShouldEqual, "key")
+		})
+
+		Convey("When I try to get the connection table and there is a failure", func() {
+			rpchdl.EXPECT().RemoteCall("testServerID", remoteenforcer.ConnectionTable, gomock.Any(), gomock.Any()).Times(1).Return(fmt.Errorf("error"))
+			_, err := e.ConnectionTable(context.TODO(), "testServerID", nil)
+
+			Convey("Then I should get an error", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When I try to get the connection table without a context ID", func() {
+			_, err := e.ConnectionTable(context.TODO(), "", nil)
+
+			Convey("Then I should get an error", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
 func TestSetTargetNetworks(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -466,3 +519,48 @@ func TestPostReportEvent(t *testing.T) {
 		So(err, ShouldBeNil)
 	})
 }
+
+func TestSign(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	rpchdl := mockrpcwrapper.NewMockRPCServer(ctrl)
+	s := secretGen()
+
+	digest := sha256.Sum256([]byte("token"))
+	request := rpcwrapper.Request{
+		Payload: rpcwrapper.SignRequestPayload{
+			Digest: digest[:],
+			Hash:   crypto.SHA256,
+		},
+	}
+	statsserver := &ProxyRPCServer{
+		rpchdl:  rpchdl,
+		secret:  "test",
+		secrets: func() secrets.Secrets { return s },
+		ctx:     context.Background(),
+	}
+	response := &rpcwrapper.Response{}
+
+	Convey("Given i receive a invalid sign request from the remote enforcer ", t, func() {
+		rpchdl.EXPECT().ProcessMessage(gomock.Any(), gomock.Any()).Times(1).Return(false)
+		err := statsserver.Sign(request, response)
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Given i receive a valid sign request from the remote enforcer ", t, func() {
+		rpchdl.EXPECT().ProcessMessage(gomock.Any(), gomock.Any()).Times(1).Return(true)
+		err := statsserver.Sign(request, response)
+		So(err, ShouldBeNil)
+
+		payload, ok := response.Payload.(*rpcwrapper.SignResponsePayload)
+		So(ok, ShouldBeTrue)
+
+		key := s.EncodingKey().(*ecdsa.PrivateKey)
+		var sig struct {
+			R, S *big.Int
+		}
+		_, err = asn1.Unmarshal(payload.Signature, &sig)
+		So(err, ShouldBeNil)
+		So(ecdsa.Verify(&key.PublicKey, digest[:], sig.R, sig.S), ShouldBeTrue)
+	})
+}
@@ -2,6 +2,8 @@ package enforcerproxy
 
 import (
 	"context"
+	"crypto"
+	"crypto/rand"
 	"errors"
 	"fmt"
 	"time"
@@ -9,6 +11,7 @@ import (
 	"go.aporeto.io/enforcerd/trireme-lib/collector"
 	"go.aporeto.io/enforcerd/trireme-lib/common"
 	"go.aporeto.io/enforcerd/trireme-lib/controller/internal/enforcer/utils/rpcwrapper"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/secrets"
 )
 
 // ProxyRPCServer This struct is a receiver for Statsserver and maintains a handle to the RPC ProxyRPCServer.
@@ -17,6 +20,7 @@ type ProxyRPCServer struct {
 	rpchdl      rpcwrapper.RPCServer
 	secret      string
 	tokenIssuer common.ServiceTokenIssuer
+	secrets     func() secrets.Secrets
 	ctx         context.Context
 }
 
@@ -71,6 +75,39 @@ func (r *ProxyRPCServer) RetrieveToken(req rpcwrapper.Request, resp *rpcwrapper.
 	return nil
 }
 
+// Sign signs a digest with the key of the enforcer for the remoteenforcer
+// when the key is not transmitted to it.
+func (r *ProxyRPCServer) Sign(req rpcwrapper.Request, resp *rpcwrapper.Response) error {
+
+	if !r.rpchdl.ProcessMessage(&req, r.secret) {
+		return errors.New("message sender cannot be verified")
+	}
+
+	payload, ok := req.Payload.(rpcwrapper.SignRequestPayload)
+	if !ok {
+		return errors.New("invalid request payload for sign request")
+	}
+
+	signer, ok := r.secrets().EncodingKey().(crypto.Signer)
+	if !ok {
+		resp.Status = "error"
+		return errors.New("secrets can not sign")
+	}
+
+	signature, err := signer.Sign(rand.Reader, payload.Digest, payload.Hash)
+	if err != nil {
+		resp.Status = "error"
+		return fmt.Errorf("unable to sign: %s", err)
+	}
+
+	resp.Status = "ok"
+	resp.Payload = &rpcwrapper.SignResponsePayload{
+		Signature: signature,
+	}
+
+	return nil
+}
+
 // PostReportEvent posts report events to the listener.
 func (r *ProxyRPCServer) PostReportEvent(req rpcwrapper.Request, resp *rpcwrapper.Response) error {
 
@@ -9,18 +9,22 @@ import (
 
 	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/secrets"
 	"go.aporeto.io/enforcerd/trireme-lib/utils/crypto"
+	"golang.org/x/crypto/curve25519"
 )
 
 //PrivateKey struct holds the ecdsa private key and its encoded string
 type PrivateKey struct {
 	*ecdsa.PrivateKey
 	PrivateKeyString string
+	// X25519 is the private key of the X25519 key exchange
+	X25519 []byte
 }
 
 type ephemeralKey struct {
-	privateKey  *PrivateKey
-	publicKeyV1 []byte
-	publicKeyV2 []byte
+	privateKey      *PrivateKey
+	publicKeyV1     []byte
+	publicKeyV2     []byte
+	publicKeyX25519 []byte
 	sync.RWMutex
 }
 
@@ -37,10 +41,16 @@ func New() (KeyAccessor, error) {
 	publicKeyBytesV2 := crypto.EncodePublicKeyV2(&privateKey.PublicKey)
 	pvtKeyBytes := crypto.EncodePrivateKey(privateKey)
 
+	x25519PrivateKey, x25519PublicKey, err := newX25519Key()
+	if err != nil {
+		return nil, err
+	}
+
 	keys := &ephemeralKey{
-		privateKey:  &PrivateKey{privateKey, string(pvtKeyBytes)},
-		publicKeyV1: publicKeyBytesV1,
-		publicKeyV2: publicKeyBytesV2,
+		privateKey:      &PrivateKey{privateKey, string(pvtKeyBytes), x25519PrivateKey},
+		publicKeyV1:     publicKeyBytesV1,
+		publicKeyV2:     publicKeyBytesV2,
+		publicKeyX25519: x25519PublicKey,
 	}
 
 	return keys, nil
@@ -57,10 +67,16 @@ func NewWithRenewal() (KeyAccessor, error) {
 	publicKeyBytesV2 := crypto.EncodePublicKeyV2(&privateKey.PublicKey)
 	pvtKeyBytes := crypto.EncodePrivateKey(privateKey)
 
+	x25519PrivateKey, x25519PublicKey, err := newX25519Key()
+	if err != nil {
+		return nil, err
+	}
+
 	keys := &ephemeralKey{
-		privateKey:  &PrivateKey{privateKey, string(pvtKeyBytes)},
-		publicKeyV1: publicKeyBytesV1,
-		publicKeyV2: publicKeyBytesV2,
+		privateKey:      &PrivateKey{privateKey, string(pvtKeyBytes), x25519PrivateKey},
+		publicKeyV1:     publicKeyBytesV1,
+		publicKeyV2:     publicKeyBytesV2,
+		publicKeyX25519: x25519PublicKey,
 	}
 
 	go func() {
@@ -75,10 +91,16 @@ func NewWithRenewal() (KeyAccessor, error) {
 				publicKeyBytesV2 := crypto.EncodePublicKeyV2(&privateKey.PublicKey)
 				pvtKeyBytes := crypto.EncodePrivateKey(privateKey)
 
+				x25519PrivateKey, x25519PublicKey, err := newX25519Key()
+				if err != nil {
+					continue
+				}
+
 				keys.Lock()
-				keys.privateKey = &PrivateKey{privateKey, string(pvtKeyBytes)}
+				keys.privateKey = &PrivateKey{privateKey, string(pvtKeyBytes), x25519PrivateKey}
 				keys.publicKeyV1 = publicKeyBytesV1
 				keys.publicKeyV2 = publicKeyBytesV2
+				keys.publicKeyX25519 = x25519PublicKey
 				keys.Unlock()
 				break
 			}
@@ -107,6 +129,28 @@ func (k *ephemeralKey) DecodingKeyV2() []byte {
 	return k.publicKeyV2
 }
 
+func (k *ephemeralKey) DecodingKeyX25519() []byte {
+	k.RLock()
+	defer k.RUnlock()
+	return k.publicKeyX25519
+}
+
+// newX25519Key generates the key pair of the X25519 key exchange
+func newX25519Key() ([]byte, []byte, error) {
+
+	privateKey := make([]byte, curve25519.ScalarSize)
+	if _, err := rand.Read(privateKey); err != nil {
+		return nil, nil, err
+	}
+
+	publicKey, err := curve25519.X25519(privateKey, curve25519.Basepoint)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return privateKey, publicKey, nil
+}
+
 var secret secrets.Secrets
 var lock sync.RWMutex
 
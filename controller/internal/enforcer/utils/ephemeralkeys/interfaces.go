@@ -5,4 +5,5 @@ type KeyAccessor interface {
 	PrivateKey() *PrivateKey
 	DecodingKeyV1() []byte
 	DecodingKeyV2() []byte
+	DecodingKeyX25519() []byte
 }
@@ -1,11 +1,13 @@
 package rpcwrapper
 
 import (
+	"crypto"
 	"time"
 
 	"go.aporeto.io/enforcerd/trireme-lib/collector"
 	"go.aporeto.io/enforcerd/trireme-lib/common"
 	"go.aporeto.io/enforcerd/trireme-lib/controller/constants"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/connection"
 	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/packettracing"
 	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/secrets"
 	"go.aporeto.io/enforcerd/trireme-lib/controller/runtime"
@@ -135,6 +137,17 @@ type TokenResponsePayload struct {
 	Token string `json:",omitempty"`
 }
 
+// SignRequestPayload carries the digest to sign with the key of the enforcer.
+type SignRequestPayload struct {
+	Digest []byte      `json:",omitempty"`
+	Hash   crypto.Hash `json:",omitempty"`
+}
+
+// SignResponsePayload returns the signature of the digest.
+type SignResponsePayload struct {
+	Signature []byte `json:",omitempty"`
+}
+
 // PingPayload represents the payload for ping config.
 type PingPayload struct {
 	ContextID  string
@@ -147,6 +160,11 @@ type DebugCollectPayload struct {
 	PcapFilePath string
 	PcapFilter   string
 	CommandExec  string
+	PcapNative   bool
+	PcapDuration time.Duration
+	PcapMaxSize  int64
+	PcapFileSize int64
+	PcapFiles    int
 }
 
 // DebugCollectResponsePayload is the payload for the DebugCollect response.
@@ -155,3 +173,15 @@ type DebugCollectResponsePayload struct {
 	PID           int
 	CommandOutput string
 }
+
+// ConnectionTablePayload is the payload for the ConnectionTable request.
+type ConnectionTablePayload struct {
+	ContextID string
+	Filter    connection.TableFilter
+}
+
+// ConnectionTableResponsePayload is the payload for the ConnectionTable response.
+type ConnectionTableResponsePayload struct {
+	ContextID string
+	Entries   []*connection.TableEntry
+}
@@ -13,6 +13,7 @@ import (
 	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/ipsetmanager"
 	"go.aporeto.io/enforcerd/trireme-lib/controller/runtime"
 	"go.aporeto.io/enforcerd/trireme-lib/policy"
+	"go.aporeto.io/enforcerd/trireme-lib/utils/cgnetcls"
 	"go.uber.org/zap"
 )
 
@@ -216,6 +217,23 @@ func NewInstance(fqc fqconfig.FilterQueue, mode constants.ModeType, ipv6Enabled
 	ipsetV6 := ipsetmanager.V6()
 	iptInstanceV6 := createIPInstance(ipv6Impl, ipsetV6, fqc, mode, ebpf, serviceMeshType)
 
+	// Without the net_cls controller the cgroups are matched on their path.
+	if cgnetcls.IsCgroupV2() {
+		enforcerCgroup, err := cgnetcls.EnforcerCgroupV2Path()
+		if err != nil {
+			return nil, fmt.Errorf("unable to find the cgroup of the enforcer: %s", err)
+		}
+
+		if enforcerCgroup == "/" {
+			zap.L().Warn("The enforcer is in the root cgroup. Host mode PUs will not match any process")
+		}
+
+		for _, ipt := range []*iptables{iptInstanceV4, iptInstanceV6} {
+			ipt.cgroupV2 = true
+			ipt.enforcerCgroup = enforcerCgroup
+		}
+	}
+
 	return newInstanceWithProviders(iptInstanceV4, iptInstanceV6)
 }
 
@@ -16,6 +16,7 @@ import (
 	"go.aporeto.io/enforcerd/trireme-lib/controller/runtime"
 	"go.aporeto.io/enforcerd/trireme-lib/monitor/extractors"
 	"go.aporeto.io/enforcerd/trireme-lib/policy"
+	"go.aporeto.io/enforcerd/trireme-lib/utils/cgnetcls"
 	"go.uber.org/zap"
 )
 
@@ -66,6 +67,8 @@ type iptables struct {
 	ipsetmanager    ipsetmanager.IPSetManager
 	bpf             ebpf.BPFModule
 	serviceMeshType policy.ServiceMesh
+	cgroupV2        bool
+	enforcerCgroup  string
 }
 
 // IPImpl interface is to be used by the iptable implentors like ipv4 and ipv6.
@@ -192,6 +195,14 @@ func (i *iptables) ConfigureRules(version int, contextID string, pu *policy.PUIn
 		return err
 	}
 
+	// The iptables cgroup match requires the cgroup to exist. The monitor
+	// places the processes in the cgroup after the rules are installed.
+	if cfg.cgroupPath != "" && i.mode == constants.LocalServer {
+		if err = cgnetcls.EnsureCgroupV2Path(cfg.cgroupPath); err != nil {
+			return err
+		}
+	}
+
 	// At this point we can install all the ACL rules that will direct
 	// traffic to user space, allow for external access or direct
 	// traffic towards the proxies
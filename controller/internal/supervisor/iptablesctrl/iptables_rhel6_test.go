@@ -183,7 +183,7 @@ var (
 			"-p UDP -m set --match-set TRI-v4-ext-IuSLsD1R-mE= src -m string ! --string n30njxq7bmiwr6dtxq --algo bm --to 128 --match multiport --dports 443 -j ACCEPT",
 			"-p icmp -j NFQUEUE --queue-balance 0:3",
 			"-p tcp -m set --match-set TRI-v4-TargetTCP src -m tcp --tcp-flags SYN NONE -j TRI-Nfq-IN",
-			"-p udp -m set --match-set TRI-v4-TargetUDP src --match limit --limit 1000/s -j TRI-Nfq-IN",
+			"-p udp -m set --match-set TRI-v4-TargetUDP src -m connmark --mark 61163 -j TRI-Nfq-IN", "-p udp -m set --match-set TRI-v4-TargetUDP src --match limit --limit 1000/s -j TRI-Nfq-IN",
 			"-p tcp -m state --state ESTABLISHED -m comment --comment TCP-Established-Connections -j ACCEPT",
 			"-p ALL -m set --match-set TRI-v4-ext-_qhcdC8NcJc= src -j NFLOG --nflog-group 11 --nflog-prefix 913787369:123a:a3:6",
 			"-p ALL -m set --match-set TRI-v4-ext-_qhcdC8NcJc= src -j DROP",
@@ -199,7 +199,7 @@ var (
 			"-p UDP -m set --match-set TRI-v4-ext-6zlJIvP3B68= dst -m string ! --string n30njxq7bmiwr6dtxq --algo bm --to 128 -m set ! --match-set TRI-v4-TargetUDP dst --match multiport --dports 443 -j ACCEPT",
 			"-p UDP -m set --match-set TRI-v4-ext-IuSLsD1R-mE= dst -m state --state ESTABLISHED -m connmark --mark 61167 -j ACCEPT",
 			"-p icmp -j NFQUEUE --queue-balance 0:3",
-			"-m set --match-set TRI-v4-TargetTCP dst -p tcp -m tcp --tcp-flags FIN FIN -j ACCEPT",
+			"-m set --match-set TRI-v4-TargetTCP dst -p tcp -m tcp --tcp-flags FIN FIN -m connmark ! --mark 61163 -j ACCEPT",
 			"-m set --match-set TRI-v4-TargetTCP dst -p tcp -j MARK --set-mark 40",
 			"-p udp -m set --match-set TRI-v4-TargetUDP dst -j MARK --set-mark 40",
 			"-m mark --mark 40 -j NFQUEUE --queue-balance 0:3 --queue-bypass",
@@ -306,7 +306,7 @@ var (
 			"-p TCP -m set --match-set TRI-v4-ext-w5frVvhsnpU= src -m state --state NEW --match multiport --dports 80 -j DROP",
 			"-p icmp -j NFQUEUE --queue-balance 0:3",
 			"-p tcp -m set --match-set TRI-v4-TargetTCP src -m tcp --tcp-flags SYN NONE -j TRI-Nfq-IN",
-			"-p udp -m set --match-set TRI-v4-TargetUDP src --match limit --limit 1000/s -j TRI-Nfq-IN",
+			"-p udp -m set --match-set TRI-v4-TargetUDP src -m connmark --mark 61163 -j TRI-Nfq-IN", "-p udp -m set --match-set TRI-v4-TargetUDP src --match limit --limit 1000/s -j TRI-Nfq-IN",
 			"-p tcp -m state --state ESTABLISHED -m comment --comment TCP-Established-Connections -j ACCEPT",
 			"-s 0.0.0.0/0 -m state --state NEW -j NFLOG --nflog-group 11 --nflog-prefix 913787369:default:default:6",
 			"-s 0.0.0.0/0 -m state ! --state NEW -j NFLOG --nflog-group 11 --nflog-prefix 913787369:default:default:10",
@@ -316,7 +316,7 @@ var (
 		"TRI-App-pu1N7uS6--1": {
 			"-p TCP -m set --match-set TRI-v4-ext-uNdc0vdcFZA= dst -m state --state NEW --match multiport --dports 80 -j DROP",
 			"-p icmp -j NFQUEUE --queue-balance 0:3",
-			"-m set --match-set TRI-v4-TargetTCP dst -p tcp -m tcp --tcp-flags FIN FIN -j ACCEPT",
+			"-m set --match-set TRI-v4-TargetTCP dst -p tcp -m tcp --tcp-flags FIN FIN -m connmark ! --mark 61163 -j ACCEPT",
 			"-m set --match-set TRI-v4-TargetTCP dst -p tcp -j MARK --set-mark 40",
 			"-p udp -m set --match-set TRI-v4-TargetUDP dst -j MARK --set-mark 40",
 			"-m mark --mark 40 -j NFQUEUE --queue-balance 0:3 --queue-bypass",
@@ -810,7 +810,7 @@ var (
 			"-p UDP -m set --match-set TRI-v6-ext-IuSLsD1R-mE= src -m string ! --string n30njxq7bmiwr6dtxq --algo bm --to 128 --match multiport --dports 443 -j ACCEPT",
 			"-p icmp -j NFQUEUE --queue-balance 0:3",
 			"-p tcp -m set --match-set TRI-v6-TargetTCP src -m tcp --tcp-flags SYN NONE -j TRI-Nfq-IN",
-			"-p udp -m set --match-set TRI-v6-TargetUDP src --match limit --limit 1000/s -j TRI-Nfq-IN",
+			"-p udp -m set --match-set TRI-v6-TargetUDP src -m connmark --mark 61163 -j TRI-Nfq-IN", "-p udp -m set --match-set TRI-v6-TargetUDP src --match limit --limit 1000/s -j TRI-Nfq-IN",
 			"-p tcp -m state --state ESTABLISHED -m comment --comment TCP-Established-Connections -j ACCEPT",
 			"-s ::/0 -m state --state NEW -j NFLOG --nflog-group 11 --nflog-prefix 913787369:default:default:6",
 			"-s ::/0 -m state ! --state NEW -j NFLOG --nflog-group 11 --nflog-prefix 913787369:default:default:10",
@@ -823,7 +823,7 @@ var (
 			"-p icmpv6 -m set --match-set TRI-v6-ext-w5frVvhsnpU= dst -j ACCEPT",
 			"-p UDP -m set --match-set TRI-v6-ext-IuSLsD1R-mE= dst -m state --state ESTABLISHED -m connmark --mark 61167 -j ACCEPT",
 			"-p icmp -j NFQUEUE --queue-balance 0:3",
-			"-m set --match-set TRI-v6-TargetTCP dst -p tcp -m tcp --tcp-flags FIN FIN -j ACCEPT",
+			"-m set --match-set TRI-v6-TargetTCP dst -p tcp -m tcp --tcp-flags FIN FIN -m connmark ! --mark 61163 -j ACCEPT",
 			"-m set --match-set TRI-v6-TargetTCP dst -p tcp -j MARK --set-mark 40",
 			"-p udp -m set --match-set TRI-v6-TargetUDP dst -j MARK --set-mark 40",
 			"-m mark --mark 40 -j NFQUEUE --queue-balance 0:3 --queue-bypass",
@@ -927,7 +927,7 @@ var (
 			"-p TCP -m set --match-set TRI-v6-ext-w5frVvhsnpU= src -m state --state NEW --match multiport --dports 80 -j DROP",
 			"-p icmp -j NFQUEUE --queue-balance 0:3",
 			"-p tcp -m set --match-set TRI-v6-TargetTCP src -m tcp --tcp-flags SYN NONE -j TRI-Nfq-IN",
-			"-p udp -m set --match-set TRI-v6-TargetUDP src --match limit --limit 1000/s -j TRI-Nfq-IN",
+			"-p udp -m set --match-set TRI-v6-TargetUDP src -m connmark --mark 61163 -j TRI-Nfq-IN", "-p udp -m set --match-set TRI-v6-TargetUDP src --match limit --limit 1000/s -j TRI-Nfq-IN",
 			"-p tcp -m state --state ESTABLISHED -m comment --comment TCP-Established-Connections -j ACCEPT",
 			"-s ::/0 -m state --state NEW -j NFLOG --nflog-group 11 --nflog-prefix 913787369:default:default:6",
 			"-s ::/0 -m state ! --state NEW -j NFLOG --nflog-group 11 --nflog-prefix 913787369:default:default:10",
@@ -936,7 +936,7 @@ var (
 		"TRI-App-pu1N7uS6--1": {
 			"-p TCP -m set --match-set TRI-v6-ext-uNdc0vdcFZA= dst -m state --state NEW --match multiport --dports 80 -j DROP",
 			"-p icmp -j NFQUEUE --queue-balance 0:3",
-			"-m set --match-set TRI-v6-TargetTCP dst -p tcp -m tcp --tcp-flags FIN FIN -j ACCEPT",
+			"-m set --match-set TRI-v6-TargetTCP dst -p tcp -m tcp --tcp-flags FIN FIN -m connmark ! --mark 61163 -j ACCEPT",
 			"-m set --match-set TRI-v6-TargetTCP dst -p tcp -j MARK --set-mark 40",
 			"-p udp -m set --match-set TRI-v6-TargetUDP dst -j MARK --set-mark 40",
 			"-m mark --mark 40 -j NFQUEUE --queue-balance 0:3 --queue-bypass",
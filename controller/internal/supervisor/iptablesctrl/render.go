@@ -0,0 +1,558 @@
+// +build !windows
+
+package iptablesctrl
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aporeto-inc/go-ipset/ipset"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/constants"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/fqconfig"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/ipsetmanager"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/runtime"
+	"go.aporeto.io/enforcerd/trireme-lib/policy"
+)
+
+// RenderConfig holds the parameters of the controller that affect the
+// generated rules.
+type RenderConfig struct {
+	// Mode is the mode of the supervisor (LocalServer or RemoteContainer).
+	Mode constants.ModeType
+	// FilterQueue is the filter queue configuration. If nil, a configuration
+	// with no queues and no DNS servers is used.
+	FilterQueue fqconfig.FilterQueue
+	// Networks are the target, UDP target and excluded networks.
+	Networks *runtime.Configuration
+	// ServiceMesh is the service mesh type of the PUs.
+	ServiceMesh policy.ServiceMesh
+	// IPv6Enabled renders the ip6tables rules as well.
+	IPv6Enabled bool
+}
+
+// RenderedRules are the commands the controller executes for one ip version.
+type RenderedRules struct {
+	// Restore is the iptables-restore input for the batched tables.
+	Restore string
+	// Commands are the iptables commands that are executed directly, in order,
+	// for the tables that are not batched.
+	Commands []string
+	// IPSets is the ipset restore input that creates all the sets.
+	IPSets string
+}
+
+// Rendering holds the rendered rules for both ip versions.
+type Rendering struct {
+	IPv4 *RenderedRules
+	IPv6 *RenderedRules
+}
+
+// String returns the rendering in a stable text form that can be used in
+// golden files or diffed against the rendering of another policy.
+func (r *Rendering) String() string {
+
+	buf := bytes.NewBuffer([]byte{})
+
+	write := func(name string, rules *RenderedRules) {
+		if rules == nil {
+			return
+		}
+		fmt.Fprintf(buf, "# %s iptables-restore\n%s", name, rules.Restore)
+		fmt.Fprintf(buf, "# %s iptables\n", name)
+		for _, c := range rules.Commands {
+			fmt.Fprintf(buf, "%s\n", c)
+		}
+		fmt.Fprintf(buf, "# %s ipset restore\n%s", name, rules.IPSets)
+	}
+
+	write("ipv4", r.IPv4)
+	write("ipv6", r.IPv6)
+
+	return buf.String()
+}
+
+// Render renders the iptables and ipset commands that the controller would
+// execute to start and to enforce the given PU, without touching the kernel.
+// The PU can be nil, in which case only the global rules are rendered.
+func Render(cfg *RenderConfig, contextID string, puInfo *policy.PUInfo) (*Rendering, error) {
+
+	if cfg == nil {
+		return nil, fmt.Errorf("render configuration cannot be nil")
+	}
+
+	if puInfo != nil && (puInfo.Policy == nil || puInfo.Runtime == nil) {
+		return nil, fmt.Errorf("pu policy and runtime cannot be nil")
+	}
+
+	r := &Rendering{}
+	var err error
+
+	if r.IPv4, err = render(cfg, IPV4, contextID, puInfo); err != nil {
+		return nil, fmt.Errorf("unable to render ipv4 rules: %s", err)
+	}
+
+	if cfg.IPv6Enabled {
+		if r.IPv6, err = render(cfg, IPV6, contextID, puInfo); err != nil {
+			return nil, fmt.Errorf("unable to render ipv6 rules: %s", err)
+		}
+	}
+
+	return r, nil
+}
+
+// render follows the same steps as Run and ConfigureRules on a fresh system,
+// with providers that only record the operations.
+func render(cfg *RenderConfig, version int, contextID string, puInfo *policy.PUInfo) (*RenderedRules, error) {
+
+	ipt := newRenderIptables(version, []string{"mangle"})
+	ips := newRenderIpsets()
+
+	var impl IPImpl
+	var ipsetmgr ipsetmanager.IPSetManager
+	if version == IPV4 {
+		impl = &ipv4{ipt: ipt}
+		ipsetmgr = ipsetmanager.NewWithProvider(ipsetmanager.IPsetV4, ips)
+	} else {
+		impl = &ipv6{ipt: ipt, ipv6Enabled: true}
+		ipsetmgr = ipsetmanager.NewWithProvider(ipsetmanager.IPsetV6, ips)
+	}
+
+	fqc := cfg.FilterQueue
+	if fqc == nil {
+		fqc = fqconfig.NewFilterQueue(0, nil)
+	}
+
+	i := createIPInstance(impl, ipsetmgr, fqc, cfg.Mode, nil, cfg.ServiceMesh)
+
+	if err := i.ipsetmanager.CreateIPsetsForTargetAndExcludedNetworks(); err != nil {
+		return nil, err
+	}
+
+	if err := i.platformInit(); err != nil {
+		return nil, err
+	}
+
+	if err := i.initializeChains(); err != nil {
+		return nil, err
+	}
+
+	if err := i.setGlobalRules(); err != nil {
+		return nil, err
+	}
+
+	if err := i.impl.Commit(); err != nil {
+		return nil, err
+	}
+
+	networks := cfg.Networks
+	if networks == nil {
+		networks = &runtime.Configuration{}
+	}
+
+	if err := i.SetTargetNetworks(networks); err != nil {
+		return nil, err
+	}
+
+	if puInfo != nil {
+		var iprules policy.IPRuleList
+		iprules = append(iprules, puInfo.Policy.ApplicationACLs()...)
+		iprules = append(iprules, puInfo.Policy.NetworkACLs()...)
+
+		if err := i.ipsetmanager.RegisterExternalNets(contextID, iprules); err != nil {
+			return nil, err
+		}
+
+		if err := i.ConfigureRules(0, contextID, puInfo); err != nil {
+			return nil, err
+		}
+	}
+
+	return &RenderedRules{
+		Restore:  ipt.restore(),
+		Commands: ipt.commands,
+		IPSets:   ips.restore(),
+	}, nil
+}
+
+// renderIptables is an iptables provider that keeps the batched tables in
+// memory, like the batch provider does, and records the commands of all the
+// other tables instead of executing them.
+type renderIptables struct {
+	cmd         string
+	batchTables map[string]bool
+	rules       map[string]map[string][]string
+	commands    []string
+}
+
+func newRenderIptables(version int, batchTables []string) *renderIptables {
+
+	r := &renderIptables{
+		cmd:         "iptables",
+		batchTables: map[string]bool{},
+		rules:       map[string]map[string][]string{},
+		commands:    []string{},
+	}
+
+	if version == IPV6 {
+		r.cmd = "ip6tables"
+	}
+
+	for _, t := range batchTables {
+		r.batchTables[t] = true
+	}
+
+	return r
+}
+
+func (r *renderIptables) record(table string, args ...string) {
+	r.commands = append(r.commands, strings.Join(append([]string{r.cmd, "--wait", "-t", table}, args...), " "))
+}
+
+func (r *renderIptables) chain(table, chain string) []string {
+
+	if _, ok := r.rules[table]; !ok {
+		r.rules[table] = map[string][]string{}
+	}
+
+	return r.rules[table][chain]
+}
+
+func quoteRuleSpec(rulespec []string) string {
+
+	quoted := make([]string, len(rulespec))
+	for i, rule := range rulespec {
+		if len(rule) > 0 && rule[0] == '"' {
+			quoted[i] = rule
+			continue
+		}
+		quoted[i] = fmt.Sprintf("\"%s\"", rule)
+	}
+
+	return strings.Join(quoted, " ")
+}
+
+func (r *renderIptables) Append(table, chain string, rulespec ...string) error {
+
+	if len(rulespec) == 0 {
+		return nil
+	}
+
+	if !r.batchTables[table] {
+		r.record(table, append([]string{"-A", chain}, rulespec...)...)
+		return nil
+	}
+
+	rules := r.chain(table, chain)
+	r.rules[table][chain] = append(rules, quoteRuleSpec(rulespec))
+	return nil
+}
+
+func (r *renderIptables) Insert(table, chain string, pos int, rulespec ...string) error {
+
+	if !r.batchTables[table] {
+		r.record(table, append([]string{"-I", chain, fmt.Sprintf("%d", pos)}, rulespec...)...)
+		return nil
+	}
+
+	rules := r.chain(table, chain)
+	rule := quoteRuleSpec(rulespec)
+
+	if pos < 1 {
+		pos = 1
+	}
+
+	if pos > len(rules) {
+		r.rules[table][chain] = append(rules, rule)
+		return nil
+	}
+
+	rules = append(rules, "")
+	copy(rules[pos:], rules[pos-1:])
+	rules[pos-1] = rule
+	r.rules[table][chain] = rules
+
+	return nil
+}
+
+func (r *renderIptables) Delete(table, chain string, rulespec ...string) error {
+
+	if !r.batchTables[table] {
+		r.record(table, append([]string{"-D", chain}, rulespec...)...)
+		return nil
+	}
+
+	rules := r.chain(table, chain)
+	rule := quoteRuleSpec(rulespec)
+
+	for index, existing := range rules {
+		if existing == rule {
+			r.rules[table][chain] = append(rules[:index:index], rules[index+1:]...)
+			break
+		}
+	}
+
+	return nil
+}
+
+func (r *renderIptables) ListChains(table string) ([]string, error) {
+
+	chains := []string{}
+	for chain := range r.rules[table] {
+		chains = append(chains, chain)
+	}
+	sort.Strings(chains)
+
+	return chains, nil
+}
+
+func (r *renderIptables) ClearChain(table, chain string) error {
+
+	if !r.batchTables[table] {
+		r.record(table, "-F", chain)
+		return nil
+	}
+
+	if _, ok := r.rules[table][chain]; ok {
+		r.rules[table][chain] = []string{}
+	}
+
+	return nil
+}
+
+func (r *renderIptables) DeleteChain(table, chain string) error {
+
+	if !r.batchTables[table] {
+		r.record(table, "-X", chain)
+		return nil
+	}
+
+	delete(r.rules[table], chain)
+	return nil
+}
+
+func (r *renderIptables) NewChain(table, chain string) error {
+
+	if !r.batchTables[table] {
+		r.record(table, "-N", chain)
+		return nil
+	}
+
+	if _, ok := r.rules[table]; !ok {
+		r.rules[table] = map[string][]string{}
+	}
+
+	r.rules[table][chain] = []string{}
+	return nil
+}
+
+func (r *renderIptables) ListRules(table, chain string) ([]string, error) {
+	return append([]string{}, r.rules[table][chain]...), nil
+}
+
+func (r *renderIptables) Commit() error {
+	return nil
+}
+
+func (r *renderIptables) RetrieveTable() map[string]map[string][]string {
+	return r.rules
+}
+
+func (r *renderIptables) ResetRules(subs string) error {
+
+	for table := range r.rules {
+		for chain, rules := range r.rules[table] {
+			if strings.Contains(chain, subs) {
+				delete(r.rules[table], chain)
+				continue
+			}
+			kept := []string{}
+			for _, rule := range rules {
+				if !strings.Contains(rule, subs) {
+					kept = append(kept, rule)
+				}
+			}
+			r.rules[table][chain] = kept
+		}
+	}
+
+	return nil
+}
+
+// restore returns the iptables-restore input of the batched tables. Tables
+// and chains are sorted so that the output is stable.
+func (r *renderIptables) restore() string {
+
+	buf := bytes.NewBuffer([]byte{})
+
+	tables := []string{}
+	for table := range r.rules {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+
+	for _, table := range tables {
+		chains, _ := r.ListChains(table) // nolint: errcheck
+
+		fmt.Fprintf(buf, "*%s\n", table)
+		for _, chain := range chains {
+			fmt.Fprintf(buf, ":%s - [0:0]\n", chain)
+		}
+		for _, chain := range chains {
+			for _, rule := range r.rules[table][chain] {
+				fmt.Fprintf(buf, "-A %s %s\n", chain, rule)
+			}
+		}
+		fmt.Fprintf(buf, "COMMIT\n")
+	}
+
+	return buf.String()
+}
+
+// renderIpsets is an ipset provider that keeps all the sets in memory.
+type renderIpsets struct {
+	sets map[string]*renderIpset
+}
+
+type renderIpset struct {
+	name    string
+	owner   *renderIpsets
+	create  string
+	entries map[string]string
+}
+
+func newRenderIpsets() *renderIpsets {
+	return &renderIpsets{
+		sets: map[string]*renderIpset{},
+	}
+}
+
+func (r *renderIpsets) NewIpset(name string, ipsetType string, p *ipset.Params) (ipsetmanager.Ipset, error) {
+
+	if _, ok := r.sets[name]; ok {
+		return nil, fmt.Errorf("set with the same name already exists: %s", name)
+	}
+
+	create := []string{"create", name}
+	if ipsetType == "" {
+		create = append(create, "bitmap:port", "range", "0-65535", "timeout", "0")
+	} else {
+		create = append(create, ipsetType)
+		if p != nil && p.HashFamily != "" {
+			create = append(create, "family", p.HashFamily)
+		}
+	}
+
+	s := &renderIpset{
+		name:    name,
+		owner:   r,
+		create:  strings.Join(create, " "),
+		entries: map[string]string{},
+	}
+	r.sets[name] = s
+
+	return s, nil
+}
+
+func (r *renderIpsets) GetIpset(name string) ipsetmanager.Ipset {
+
+	if s, ok := r.sets[name]; ok {
+		return s
+	}
+
+	// The sets that are not created by the controller itself are never
+	// rendered, but operations on them must still succeed.
+	return &renderIpset{entries: map[string]string{}}
+}
+
+func (r *renderIpsets) DestroyAll(prefix string) error {
+
+	for name := range r.sets {
+		if strings.HasPrefix(name, prefix) {
+			delete(r.sets, name)
+		}
+	}
+
+	return nil
+}
+
+func (r *renderIpsets) ListIPSets() ([]string, error) {
+
+	names := []string{}
+	for name := range r.sets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// restore returns the ipset restore input of all the sets. Sets and entries
+// are sorted so that the output is stable.
+func (r *renderIpsets) restore() string {
+
+	buf := bytes.NewBuffer([]byte{})
+
+	names, _ := r.ListIPSets() // nolint: errcheck
+	for _, name := range names {
+		s := r.sets[name]
+		fmt.Fprintf(buf, "%s\n", s.create)
+
+		entries := []string{}
+		for entry := range s.entries {
+			entries = append(entries, entry)
+		}
+		sort.Strings(entries)
+
+		for _, entry := range entries {
+			if option := s.entries[entry]; option != "" {
+				fmt.Fprintf(buf, "add %s %s %s\n", name, entry, option)
+				continue
+			}
+			fmt.Fprintf(buf, "add %s %s\n", name, entry)
+		}
+	}
+
+	return buf.String()
+}
+
+func (s *renderIpset) Add(entry string, timeout int) error {
+	s.entries[entry] = ""
+	return nil
+}
+
+func (s *renderIpset) AddOption(entry string, option string, timeout int) error {
+	s.entries[entry] = option
+	return nil
+}
+
+func (s *renderIpset) Del(entry string) error {
+
+	if _, ok := s.entries[entry]; !ok {
+		return fmt.Errorf("element is missing from the set: %s", entry)
+	}
+
+	delete(s.entries, entry)
+	return nil
+}
+
+func (s *renderIpset) Destroy() error {
+
+	if s.owner != nil {
+		delete(s.owner.sets, s.name)
+	}
+
+	s.entries = map[string]string{}
+	return nil
+}
+
+func (s *renderIpset) Flush() error {
+	s.entries = map[string]string{}
+	return nil
+}
+
+func (s *renderIpset) Test(entry string) (bool, error) {
+	_, ok := s.entries[entry]
+	return ok, nil
+}
@@ -0,0 +1,134 @@
+// +build !windows,!rhel6
+
+package iptablesctrl
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"go.aporeto.io/enforcerd/trireme-lib/common"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/constants"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/fqconfig"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/runtime"
+	"go.aporeto.io/enforcerd/trireme-lib/policy"
+)
+
+func testRenderPU() *policy.PUInfo {
+
+	iprules := policy.IPRuleList{
+		policy.IPRule{
+			Addresses: []string{"30.0.0.0/24"},
+			Ports:     []string{"80"},
+			Protocols: []string{constants.TCPProtoNum},
+			Policy: &policy.FlowPolicy{
+				Action:    policy.Accept,
+				ServiceID: "s1",
+				PolicyID:  "1",
+			},
+		},
+	}
+
+	policyrules := policy.NewPUPolicy(
+		"Context",
+		"/ns1",
+		policy.Police,
+		iprules,
+		nil,
+		nil,
+		nil,
+		nil,
+		nil,
+		nil,
+		nil,
+		policy.ExtendedMap{},
+		0,
+		0,
+		nil,
+		nil,
+		[]string{},
+		policy.EnforcerMapping,
+		policy.Reject|policy.Log,
+		policy.Reject|policy.Log,
+	)
+
+	puInfo := policy.NewPUInfo("Context", "/ns1", common.ContainerPU)
+	puInfo.Policy = policyrules
+	puInfo.Runtime = policy.NewPURuntimeWithDefaults()
+	puInfo.Runtime.SetPUType(common.ContainerPU)
+
+	return puInfo
+}
+
+func TestRender(t *testing.T) {
+
+	icmpAllow = testICMPAllow
+
+	cfg := &RenderConfig{
+		Mode:        constants.RemoteContainer,
+		FilterQueue: fqconfig.NewFilterQueue(4, nil),
+		Networks: &runtime.Configuration{
+			TCPTargetNetworks: []string{"0.0.0.0/0"},
+			ExcludedNetworks:  []string{"10.0.0.0/8"},
+		},
+		ServiceMesh: policy.None,
+	}
+
+	Convey("When I render the rules without a PU", t, func() {
+		r, err := Render(cfg, "", nil)
+		So(err, ShouldBeNil)
+		So(r.IPv6, ShouldBeNil)
+
+		Convey("Then I should get the global chains and sets", func() {
+			So(r.IPv4.Restore, ShouldContainSubstring, "*mangle\n")
+			So(r.IPv4.Restore, ShouldContainSubstring, ":"+mainAppChain+" - [0:0]")
+			So(r.IPv4.IPSets, ShouldContainSubstring, "create TRI-v4-TargetTCP hash:net")
+			So(r.IPv4.IPSets, ShouldContainSubstring, "add TRI-v4-TargetTCP 0.0.0.0/1")
+			So(r.IPv4.IPSets, ShouldContainSubstring, "add TRI-v4-Excluded 10.0.0.0/8")
+			So(len(r.IPv4.Commands), ShouldBeGreaterThan, 0)
+			So(r.IPv4.Commands[0], ShouldStartWith, "iptables --wait -t nat -N ")
+		})
+	})
+
+	Convey("When I render the rules of a PU", t, func() {
+		r, err := Render(cfg, "Context", testRenderPU())
+		So(err, ShouldBeNil)
+
+		appChain, netChain, err := chainName("Context", 0)
+		So(err, ShouldBeNil)
+
+		Convey("Then I should get the PU chains and the ACL sets", func() {
+			So(r.IPv4.Restore, ShouldContainSubstring, ":"+appChain+" - [0:0]")
+			So(r.IPv4.Restore, ShouldContainSubstring, ":"+netChain+" - [0:0]")
+			So(r.IPv4.IPSets, ShouldContainSubstring, "30.0.0.0/24")
+		})
+
+		Convey("Then rendering again should give the exact same output", func() {
+			again, err := Render(cfg, "Context", testRenderPU())
+			So(err, ShouldBeNil)
+			So(again.String(), ShouldEqual, r.String())
+		})
+	})
+
+	Convey("When I render the rules with ipv6 enabled", t, func() {
+		ipv6cfg := *cfg
+		ipv6cfg.IPv6Enabled = true
+
+		r, err := Render(&ipv6cfg, "Context", testRenderPU())
+		So(err, ShouldBeNil)
+
+		Convey("Then I should get both versions", func() {
+			So(r.IPv6, ShouldNotBeNil)
+			So(r.IPv6.IPSets, ShouldContainSubstring, "create TRI-v6-TargetTCP hash:net family inet6")
+			So(strings.Contains(r.String(), "# ipv6 iptables-restore"), ShouldBeTrue)
+		})
+	})
+
+	Convey("When I render with a PU that has no policy", t, func() {
+		_, err := Render(cfg, "Context", &policy.PUInfo{ContextID: "Context"})
+
+		Convey("Then I should get an error", func() {
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
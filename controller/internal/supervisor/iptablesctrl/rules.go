@@ -2,14 +2,6 @@
 
 package iptablesctrl
 
-import (
-	"strconv"
-
-	markconstants "go.aporeto.io/enforcerd/trireme-lib/utils/constants"
-)
-
-var enforcerCgroupMark = strconv.Itoa(markconstants.EnforcerCgroupMark)
-
 var triremChains = `
 {{if isLocalServer}}
 -t {{.MangleTable}} -N {{.HostInput}}
@@ -82,7 +74,7 @@ var globalRules = `
 {{.MangleTable}} {{.MainAppChain}} -p tcp -m mark --mark {{.PacketMarkToSetConnmark}} -j ACCEPT
 
 {{/* enforcer rules */}}
-{{.MangleTable}} {{.MainAppChain}}  -p udp --dport 53 -m mark --mark 0x40 -m cgroup --cgroup ` + enforcerCgroupMark + ` -j CONNMARK --set-mark {{.DefaultExternalConnmark}}
+{{.MangleTable}} {{.MainAppChain}}  -p udp --dport 53 -m mark --mark 0x40 -m cgroup {{.EnforcerCgroupMatch}} -j CONNMARK --set-mark {{.DefaultExternalConnmark}}
 {{.MangleTable}} {{.MainAppChain}}  -p udp --dport 53 -m mark --mark 0x40 -j CONNMARK --set-mark {{.DefaultExternalConnmark}}
 {{/* enforcer rules ends */}}
 
@@ -121,7 +113,7 @@ var cgroupCaptureTemplate = `
 
 {{if isHostPU}}
 {{/* UDP response traffic needs to be accepted */}}
-{{.MangleTable}} {{.NetSection}} -p udp -m udp -m state --state ESTABLISHED -m connmark ! --mark {{.DefaultHandShakeMark}} -j ACCEPT
+{{.MangleTable}} {{.NetSection}} -p udp -m udp -m state --state ESTABLISHED -m connmark ! --mark {{.DefaultHandShakeMark}} -m connmark ! --mark {{.DefaultEncryptConnmark}} -j ACCEPT
 {{/* Traffic to systemd resolver/dnsmasq gets accepted */}}
 {{.MangleTable}} {{.NetSection}} -p udp -m udp --dport 53 -j ACCEPT
 {{.MangleTable}} {{.NetSection}} -m comment --comment PU-Chain -j {{.NetChain}}
@@ -132,10 +124,10 @@ var cgroupCaptureTemplate = `
 {{end}}
 
 {{if isHostPU}}
-{{.MangleTable}} {{.AppSection}} -m cgroup ! --cgroup ` + enforcerCgroupMark + ` -m comment --comment PU-Chain -j MARK --set-mark {{.Mark}}
+{{.MangleTable}} {{.AppSection}} -m cgroup ! {{.EnforcerCgroupMatch}} -m comment --comment PU-Chain -j MARK --set-mark {{.Mark}}
 {{.MangleTable}} {{.AppSection}} -m mark --mark {{.Mark}} -m comment --comment PU-Chain -j {{.AppChain}}
 {{else}}
-{{.MangleTable}} {{.AppSection}} -m cgroup --cgroup {{.Mark}} -m comment --comment PU-Chain -j MARK --set-mark {{.Mark}}
+{{.MangleTable}} {{.AppSection}} -m cgroup {{.CgroupMatch}} -m comment --comment PU-Chain -j MARK --set-mark {{.Mark}}
 {{.MangleTable}} {{.AppSection}} -m mark --mark {{.Mark}} -m comment --comment PU-Chain -j {{.AppChain}}
 {{end}}
 
@@ -201,7 +193,7 @@ var packetCaptureTemplate = `
 
 {{if isNotContainerPU}}
 
-{{$.MangleTable}} {{$.AppChain}} -m set --match-set {{$.TargetTCPNetSet}} dst -p tcp -m tcp --tcp-flags FIN FIN -j ACCEPT
+{{$.MangleTable}} {{$.AppChain}} -m set --match-set {{$.TargetTCPNetSet}} dst -p tcp -m tcp --tcp-flags FIN FIN -m connmark ! --mark {{.DefaultEncryptConnmark}} -j ACCEPT
 {{$.MangleTable}} {{$.AppChain}} -m set --match-set {{$.TargetTCPNetSet}} dst -p tcp -j HMARK --hmark-tuple sport,dport --hmark-mod {{.NumNFQueues}} --hmark-offset {{packetMark}} --hmark-rnd 0xdeadbeef
 {{$.MangleTable}} {{$.AppChain}} -p udp -m set --match-set {{$.TargetUDPNetSet}} dst -j HMARK --hmark-tuple sport,dport --hmark-mod {{.NumNFQueues}} --hmark-offset {{packetMark}} --hmark-rnd 0xdeadbeef
 
@@ -210,7 +202,7 @@ var packetCaptureTemplate = `
 {{end}}
 
 {{else}}
-{{$.MangleTable}} {{$.AppChain}} -m set --match-set {{$.TargetTCPNetSet}} dst -p tcp -m tcp --tcp-flags FIN FIN -j ACCEPT
+{{$.MangleTable}} {{$.AppChain}} -m set --match-set {{$.TargetTCPNetSet}} dst -p tcp -m tcp --tcp-flags FIN FIN -m connmark ! --mark {{.DefaultEncryptConnmark}} -j ACCEPT
 {{$.MangleTable}} {{$.AppChain}} -m set --match-set {{$.TargetTCPNetSet}} dst -p tcp -j {{.NfqueueOutput}}
 {{$.MangleTable}} {{$.AppChain}} -p udp -m set --match-set {{$.TargetUDPNetSet}} dst -j {{.NfqueueOutput}}
 {{end}}
@@ -234,6 +226,7 @@ var packetCaptureTemplate = `
 
 
 {{.MangleTable}} {{.NetChain}} -p tcp -m set --match-set {{$.TargetTCPNetSet}} src -m tcp --tcp-flags SYN NONE -j {{.NfqueueInput}}
+{{.MangleTable}} {{.NetChain}} -p udp -m set --match-set {{.TargetUDPNetSet}} src -m connmark --mark {{.DefaultEncryptConnmark}} -j {{.NfqueueInput}}
 {{.MangleTable}} {{.NetChain}} -p udp -m set --match-set {{.TargetUDPNetSet}} src --match limit --limit 1000/s -j {{.NfqueueInput}}
 
 {{.MangleTable}} {{.NetChain}} -p tcp -m state --state ESTABLISHED -m comment --comment TCP-Established-Connections -j ACCEPT
@@ -254,8 +247,8 @@ var proxyDNSChainTemplate = `
 {{.MangleTable}} {{.MangleProxyAppChain}} -p udp -m udp --sport {{.DNSProxyPort}} -j ACCEPT
 {{.MangleTable}} {{.MangleProxyNetChain}} -p udp -m udp --dport {{.DNSProxyPort}} -j ACCEPT
 {{if isCgroupSet}}
-{{.NatTable}} {{.NatProxyAppChain}} -d {{.DNSServerIP}} -p udp --dport 53 -m mark ! --mark {{.ProxyMark}} -m cgroup --cgroup {{.CgroupMark}} -j CONNMARK --save-mark
-{{.NatTable}} {{.NatProxyAppChain}} -d {{.DNSServerIP}} -p udp --dport 53 -m mark ! --mark {{.ProxyMark}} -m cgroup --cgroup {{.CgroupMark}} -j REDIRECT --to-ports {{.DNSProxyPort}}
+{{.NatTable}} {{.NatProxyAppChain}} -d {{.DNSServerIP}} -p udp --dport 53 -m mark ! --mark {{.ProxyMark}} -m cgroup {{.CgroupMatch}} -j CONNMARK --save-mark
+{{.NatTable}} {{.NatProxyAppChain}} -d {{.DNSServerIP}} -p udp --dport 53 -m mark ! --mark {{.ProxyMark}} -m cgroup {{.CgroupMatch}} -j REDIRECT --to-ports {{.DNSProxyPort}}
 {{else}}
 {{.NatTable}} {{.NatProxyAppChain}} -d {{.DNSServerIP}} -p udp --dport 53 -m mark ! --mark {{.ProxyMark}} -j REDIRECT --to-ports {{.DNSProxyPort}}
 {{end}}
@@ -271,7 +264,7 @@ var proxyChainTemplate = `
 {{.MangleTable}} {{.MangleProxyNetChain}} -p tcp -m tcp --dport {{.ProxyPort}} -j ACCEPT
 
 {{if isCgroupSet}}
-{{.NatTable}} {{.NatProxyAppChain}} -p tcp -m set --match-set {{.DestIPSet}} dst,dst -m mark ! --mark {{.ProxyMark}} -m cgroup --cgroup {{.CgroupMark}} -j REDIRECT --to-ports {{.ProxyPort}}
+{{.NatTable}} {{.NatProxyAppChain}} -p tcp -m set --match-set {{.DestIPSet}} dst,dst -m mark ! --mark {{.ProxyMark}} -m cgroup {{.CgroupMatch}} -j REDIRECT --to-ports {{.ProxyPort}}
 {{else}}
 {{.NatTable}} {{.NatProxyAppChain}} -p tcp -m set --match-set {{.DestIPSet}} dst,dst -m mark ! --mark {{.ProxyMark}} -j REDIRECT --to-ports {{.ProxyPort}}
 {{end}}
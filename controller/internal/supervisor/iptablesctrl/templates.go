@@ -17,6 +17,7 @@ import (
 	"go.aporeto.io/enforcerd/trireme-lib/controller/internal/enforcer/nfqdatapath/afinetrawsocket"
 	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/packet"
 	"go.aporeto.io/enforcerd/trireme-lib/policy"
+	"go.aporeto.io/enforcerd/trireme-lib/utils/cgnetcls"
 	"go.aporeto.io/enforcerd/trireme-lib/utils/constants"
 )
 
@@ -88,6 +89,7 @@ type ACLInfo struct {
 	PacketMarkToSetConnmark string
 	DefaultInputMark        string
 	DefaultHandShakeMark    string
+	DefaultEncryptConnmark  string
 
 	RawSocketMark   string
 	TargetTCPNetSet string
@@ -122,6 +124,12 @@ type ACLInfo struct {
 	Mark       string
 	PortSet    string
 
+	// Cgroup matches. On cgroup v2 hosts the cgroups are matched on their
+	// path since there is no net_cls classid.
+	CgroupMatch         string
+	EnforcerCgroupMatch string
+	cgroupPath          string
+
 	AppNFLOGPrefix              string
 	AppNFLOGDropPacketLogPrefix string
 	AppDefaultAction            string
@@ -197,7 +205,7 @@ func (i *iptables) newACLInfo(version int, contextID string, p *policy.PUInfo, p
 	netDefaultAction := policy.Reject | policy.Log
 
 	var tcpPorts, udpPorts string
-	var servicePort, mark, dnsProxyPort, packetMark string
+	var servicePort, mark, dnsProxyPort, packetMark, runtimeCgroupPath string
 	if p != nil {
 		tcpPorts, udpPorts = common.ConvertServicesToProtocolPortList(p.Runtime.Options().Services)
 		puType = p.Runtime.PUType()
@@ -205,6 +213,7 @@ func (i *iptables) newACLInfo(version int, contextID string, p *policy.PUInfo, p
 		dnsProxyPort = p.Policy.DNSProxyPort()
 		mark = p.Runtime.Options().CgroupMark
 		packetMark = mark
+		runtimeCgroupPath = p.Runtime.Options().CgroupPath
 		appDefaultAction = p.Policy.AppDefaultPolicyAction()
 		netDefaultAction = p.Policy.NetDefaultPolicyAction()
 	}
@@ -232,6 +241,24 @@ func (i *iptables) newACLInfo(version int, contextID string, p *policy.PUInfo, p
 
 	portSetName := i.ipsetmanager.GetServerPortSetName(contextID)
 
+	cgroupMatch := "--cgroup " + mark
+	enforcerCgroupMatch := "--cgroup " + strconv.Itoa(constants.EnforcerCgroupMark)
+	cgroupPath := ""
+	if i.cgroupV2 {
+		enforcerCgroupMatch = "--path " + i.enforcerCgroup
+		if puType == common.HostPU {
+			cgroupMatch = "! " + enforcerCgroupMatch
+		} else if contextID != "" && mark != "" {
+			// The monitors set the path of the cgroups they create. The
+			// others are the cgroups of the linux processes.
+			cgroupPath = runtimeCgroupPath
+			if cgroupPath == "" {
+				cgroupPath = cgnetcls.CgroupV2Path(common.TriremeCgroupPath, contextID)
+			}
+			cgroupMatch = "--path " + cgroupPath
+		}
+	}
+
 	for i := 0; i < numQueues; i++ {
 		nfqueues = append(nfqueues, i)
 	}
@@ -274,6 +301,7 @@ func (i *iptables) newACLInfo(version int, contextID string, p *policy.PUInfo, p
 		DefaultInputMark:        strconv.Itoa(int(constants.DefaultInputMark)),
 		RawSocketMark:           strconv.Itoa(afinetrawsocket.ApplicationRawSocketMark),
 		DefaultHandShakeMark:    strconv.Itoa(int(constants.HandshakeConnmark)),
+		DefaultEncryptConnmark:  strconv.Itoa(int(constants.EncryptConnmark)),
 		CgroupMark:              mark,
 		TargetTCPNetSet:         tcpTargetSetName,
 		TargetUDPNetSet:         udpTargetSetName,
@@ -305,6 +333,10 @@ func (i *iptables) newACLInfo(version int, contextID string, p *policy.PUInfo, p
 		Mark:       mark,
 		PortSet:    portSetName,
 
+		CgroupMatch:         cgroupMatch,
+		EnforcerCgroupMatch: enforcerCgroupMatch,
+		cgroupPath:          cgroupPath,
+
 		AppNFLOGPrefix:              policy.DefaultLogPrefix(contextID, appDefaultAction),
 		AppNFLOGDropPacketLogPrefix: policy.DefaultDropPacketLogPrefix(contextID),
 		AppDefaultAction:            policy.DefaultAction(appDefaultAction),
@@ -6,6 +6,11 @@ import (
 	"testing"
 
 	. "github.com/smartystreets/goconvey/convey"
+	"go.aporeto.io/enforcerd/trireme-lib/common"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/constants"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/fqconfig"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/ipsetmanager"
+	"go.aporeto.io/enforcerd/trireme-lib/policy"
 )
 
 func TestChainName(t *testing.T) {
@@ -24,3 +29,63 @@ func TestChainName(t *testing.T) {
 		})
 	})
 }
+
+func TestCgroupMatch(t *testing.T) {
+	Convey("Given an iptables instance for Linux processes", t, func() {
+
+		i := createIPInstance(
+			&ipv4{ipt: newRenderIptables(IPV4, []string{"mangle"})},
+			ipsetmanager.NewWithProvider(ipsetmanager.IPsetV4, ipsetmanager.NewMemoryIpsetProvider()),
+			fqconfig.NewFilterQueue(4, nil),
+			constants.LocalServer,
+			nil,
+			policy.None,
+		)
+
+		puInfo := func(puType common.PUType) *policy.PUInfo {
+			p := policy.NewPUInfo("pu1", "/ns", puType)
+			p.Runtime.SetOptions(policy.OptionsType{CgroupMark: "10"})
+			return p
+		}
+
+		Convey("With cgroup v1, the cgroups should be matched on their classid", func() {
+			cfg, err := i.newACLInfo(0, "pu1", puInfo(common.LinuxProcessPU), common.LinuxProcessPU)
+			So(err, ShouldBeNil)
+			So(cfg.CgroupMatch, ShouldEqual, "--cgroup 10")
+			So(cfg.EnforcerCgroupMatch, ShouldEqual, "--cgroup 1536")
+			So(cfg.cgroupPath, ShouldBeEmpty)
+		})
+
+		Convey("With cgroup v2", func() {
+			i.cgroupV2 = true
+			i.enforcerCgroup = "/system.slice/enforcerd.service"
+
+			Convey("A Linux process PU should be matched on the path of its cgroup", func() {
+				cfg, err := i.newACLInfo(0, "pu1", puInfo(common.LinuxProcessPU), common.LinuxProcessPU)
+				So(err, ShouldBeNil)
+				So(cfg.CgroupMatch, ShouldEqual, "--path /trireme/pu1")
+				So(cfg.EnforcerCgroupMatch, ShouldEqual, "--path /system.slice/enforcerd.service")
+				So(cfg.cgroupPath, ShouldEqual, "/trireme/pu1")
+
+				rules := i.cgroupChainRules(cfg)
+				So(rules, ShouldContain, []string{"mangle", TriremeOutput, "-m", "cgroup", "--path", "/trireme/pu1", "-m", "comment", "--comment", "PU-Chain", "-j", "MARK", "--set-mark", "10"})
+			})
+
+			Convey("A Linux process PU with an existing cgroup should be matched on the path of that cgroup", func() {
+				p := puInfo(common.LinuxProcessPU)
+				p.Runtime.SetOptions(policy.OptionsType{CgroupMark: "10", CgroupPath: "/system.slice/nginx.service"})
+				cfg, err := i.newACLInfo(0, "pu1", p, common.LinuxProcessPU)
+				So(err, ShouldBeNil)
+				So(cfg.CgroupMatch, ShouldEqual, "--path /system.slice/nginx.service")
+				So(cfg.cgroupPath, ShouldEqual, "/system.slice/nginx.service")
+			})
+
+			Convey("A host PU should match everything but the enforcer", func() {
+				cfg, err := i.newACLInfo(0, "pu1", puInfo(common.HostPU), common.HostPU)
+				So(err, ShouldBeNil)
+				So(cfg.CgroupMatch, ShouldEqual, "! --path /system.slice/enforcerd.service")
+				So(cfg.cgroupPath, ShouldBeEmpty)
+			})
+		})
+	})
+}
@@ -11,6 +11,7 @@ func (h HeaderBytes) ToClaimsHeader() *ClaimsHeader {
 	}
 
 	compressionTypeMask := compressionTypeMask(h.extractHeaderAttribute(h[0], compressionTypeBitMask.toUint8()))
+	maxDatapathVersionMask := datapathVersionMask(h.extractHeaderAttribute(h[1], maxDatapathVersionBitMask) >> maxDatapathVersionShift)
 	datapathVersionMask := datapathVersionMask(h.extractHeaderAttribute(h[0], datapathVersionBitMask.toUint8()))
 
 	return &ClaimsHeader{
@@ -18,6 +19,9 @@ func (h HeaderBytes) ToClaimsHeader() *ClaimsHeader {
 		encrypt:         uint8ToBool(encrypt, h.extractHeaderAttribute(h[1], encryptionEnabledBit)),
 		ping:            uint8ToBool(ping, h.extractHeaderAttribute(h[1], pingEnabledBit)),
 		datapathVersion: datapathVersionMask.toType(),
+		// Peers that do not advertise a version leave the reserved bits
+		// empty which reads as the first version.
+		maxDatapathVersion: maxDatapathVersionMask.toType(),
 	}
 }
 
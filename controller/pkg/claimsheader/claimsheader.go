@@ -16,13 +16,14 @@ func NewClaimsHeader(opts ...Option) *ClaimsHeader {
 //    0             1              2               3               4
 //  0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
 //  +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
-//  |     D     |CT |E|P|            R (reserved)                   |
+//  |     D     |CT |E|P|     M     |        R (reserved)           |
 //  +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
 //  D  [0:5]   - Datapath version
 //  CT [6,7]   - Compressed tag type
 //  E  [8]     - Encryption enabled
 //  P  [9]     - Ping enabled
-//  R  [10:31] - Reserved
+//  M  [10:15] - Max datapath version supported
+//  R  [16:31] - Reserved
 func (c *ClaimsHeader) ToBytes() HeaderBytes {
 
 	claimsHeaderData := make([]byte, maxHeaderLen)
@@ -30,6 +31,7 @@ func (c *ClaimsHeader) ToBytes() HeaderBytes {
 	claimsHeaderData[0] |= c.compressionType.toMask().toUint8()
 	claimsHeaderData[1] |= boolToUint8(encrypt, c.encrypt)
 	claimsHeaderData[1] |= boolToUint8(ping, c.ping)
+	claimsHeaderData[1] |= c.maxDatapathVersion.toMask().toUint8() << maxDatapathVersionShift
 
 	return claimsHeaderData
 }
@@ -52,6 +54,12 @@ func (c *ClaimsHeader) DatapathVersion() DatapathVersion {
 	return c.datapathVersion
 }
 
+// MaxDatapathVersion is the highest datapath version supported by the sender
+func (c *ClaimsHeader) MaxDatapathVersion() DatapathVersion {
+
+	return c.maxDatapathVersion
+}
+
 // Ping returns the ping in bool
 func (c *ClaimsHeader) Ping() bool {
 
@@ -76,6 +84,12 @@ func (c *ClaimsHeader) SetDatapathVersion(dv DatapathVersion) {
 	c.datapathVersion = dv
 }
 
+// SetMaxDatapathVersion sets the highest datapath version supported
+func (c *ClaimsHeader) SetMaxDatapathVersion(dv DatapathVersion) {
+
+	c.maxDatapathVersion = dv
+}
+
 // SetPing sets the ping
 func (c *ClaimsHeader) SetPing(ping bool) {
 
@@ -150,4 +150,46 @@ func TestHeader(t *testing.T) {
 			So(ch.DatapathVersion(), ShouldEqual, DatapathVersion1)
 		})
 	})
+
+	Convey("Given I create a new claims header with datapath version 2", t, func() {
+		header := NewClaimsHeader(
+			OptionEncrypt(true),
+			OptionPing(true),
+			OptionCompressionType(CompressionTypeV1),
+			OptionDatapathVersion(DatapathVersion2),
+			OptionMaxDatapathVersion(DatapathVersion2),
+		).ToBytes()
+
+		Convey("Given I convert bytes to claims header", func() {
+			ch := header.ToClaimsHeader()
+
+			Convey("Then it should be equal", func() {
+				So(ch.CompressionType(), ShouldEqual, CompressionTypeV1)
+				So(ch.Encrypt(), ShouldEqual, true)
+				So(ch.Ping(), ShouldEqual, true)
+				So(ch.DatapathVersion(), ShouldEqual, DatapathVersion2)
+				So(ch.MaxDatapathVersion(), ShouldEqual, DatapathVersion2)
+			})
+		})
+	})
+
+	Convey("Given I receive a header without the max datapath version", t, func() {
+		header := HeaderBytes([]byte{0x00, 0x01, 0x00, 0x00})
+
+		Convey("Then the max datapath version should be version 1", func() {
+			ch := header.ToClaimsHeader()
+			So(ch.Encrypt(), ShouldEqual, true)
+			So(ch.DatapathVersion(), ShouldEqual, DatapathVersion1)
+			So(ch.MaxDatapathVersion(), ShouldEqual, DatapathVersion1)
+		})
+	})
+
+	Convey("Given I receive a header with an unknown datapath version", t, func() {
+		header := HeaderBytes([]byte{0x3F, 0x00, 0x00, 0x00})
+
+		Convey("Then the datapath version should be invalid", func() {
+			ch := header.ToClaimsHeader()
+			So(ch.DatapathVersion(), ShouldEqual, DatapathVersion(-1))
+		})
+	})
 }
@@ -9,4 +9,8 @@ const (
 	encryptionEnabledBit = 0x01
 	// pingEnabledBit that is set in the bytes
 	pingEnabledBit = 0x02
+	// maxDatapathVersionBitMask is the mask of the max datapath version in the bytes
+	maxDatapathVersionBitMask = 0xFC
+	// maxDatapathVersionShift is the position of the max datapath version in the bytes
+	maxDatapathVersionShift = 2
 )
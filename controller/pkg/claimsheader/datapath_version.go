@@ -11,29 +11,35 @@ const (
 
 func (dv DatapathVersion) toMask() datapathVersionMask { // nolint
 
-	if dv == DatapathVersion1 {
-		return datapathVersion
+	switch dv {
+	case DatapathVersion1:
+		return datapathVersion1
+	case DatapathVersion2:
+		return datapathVersion2
+	default:
+		return zeroBit
 	}
-
-	return zeroBit
 }
 
 // datapathVersion is the enforcer version
-// TODO: Enable this in datapath
 type datapathVersionMask uint8
 
 const (
-	datapathVersion        datapathVersionMask = 0x00
+	datapathVersion1       datapathVersionMask = 0x00
+	datapathVersion2       datapathVersionMask = 0x01
 	datapathVersionBitMask datapathVersionMask = 0x3F
 )
 
 func (dm datapathVersionMask) toType() DatapathVersion {
 
-	if dm == datapathVersion {
+	switch dm {
+	case datapathVersion1:
 		return DatapathVersion1
+	case datapathVersion2:
+		return DatapathVersion2
+	default:
+		return -1
 	}
-
-	return -1
 }
 
 // toUint8 returns uint8 from datapathVersionMask
@@ -34,3 +34,11 @@ func OptionPing(ping bool) Option {
 		c.ping = ping
 	}
 }
+
+// OptionMaxDatapathVersion sets the highest supported datapath version
+func OptionMaxDatapathVersion(datapathVersion DatapathVersion) Option {
+
+	return func(c *ClaimsHeader) {
+		c.maxDatapathVersion = datapathVersion
+	}
+}
@@ -10,6 +10,8 @@ type ClaimsHeader struct {
 	datapathVersion DatapathVersion
 	// Ping represents ping is set
 	ping bool
+	// MaxDatapathVersion represents the highest datapath version supported
+	maxDatapathVersion DatapathVersion
 }
 
 type boolType int
@@ -10,6 +10,7 @@ import (
 
 	"go.aporeto.io/enforcerd/trireme-lib/controller/internal/enforcer/nfqdatapath/afinetrawsocket"
 	"go.aporeto.io/enforcerd/trireme-lib/controller/internal/enforcer/utils/ephemeralkeys"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/claimsheader"
 	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/counters"
 	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/packet"
 	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/pingconfig"
@@ -117,10 +118,13 @@ type AuthInfo struct {
 	LocalDatapathPublicKeySignV1 []byte
 	LocalDatapathPublicKeyV2     []byte
 	LocalDatapathPublicKeySignV2 []byte
+	LocalDatapathPublicKeyV3     []byte
+	LocalDatapathPublicKeySignV3 []byte
 	ConnectionClaims             tokens.ConnectionClaims
 	SynAckToken                  []byte
 	AckToken                     []byte
 	Proto314                     bool
+	DatapathVersion              claimsheader.DatapathVersion
 }
 
 //TCPTuple contains the 4 tuple for tcp connection
@@ -183,6 +187,7 @@ type TCPConnection struct {
 	counter               uint32
 	reportReason          string
 	connectionTimeout     time.Duration
+	created               time.Time
 	EncodedBuf            [tokens.ClaimsEncodedBufSize]byte
 }
 
@@ -234,8 +239,13 @@ func (c *TCPConnection) GetState() TCPFlowState {
 
 // GetStateString is used to return the state as string
 func (c *TCPConnection) GetStateString() string {
+	return c.state.String()
+}
+
+// String returns the name of the state.
+func (s TCPFlowState) String() string {
 
-	switch c.state {
+	switch s {
 	case TCPSynSend:
 		return "TCPSynSend"
 
@@ -367,6 +377,7 @@ func NewTCPConnection(context *pucontext.PUContext, p *packet.Packet) *TCPConnec
 		initialSequenceNumber: initialSeqNumber,
 		TCPtuple:              tuple,
 		connectionTimeout:     DefaultConnectionTimeout,
+		created:               time.Now(),
 	}
 
 	crypto.Nonce().GenerateNonce16Bytes(tcp.Auth.Nonce[:])
@@ -439,6 +450,8 @@ type UDPConnection struct {
 	ServiceConnection bool
 	// LoopbackConnection indicates that this connections is within the same pu context.
 	loopbackConnection bool
+	// UDPtuple is the 4 tuple of the flow that started the connection.
+	UDPtuple *TCPTuple
 	// Stop channels for restransmissions
 	synStop    chan bool
 	synAckStop chan bool
@@ -452,6 +465,7 @@ type UDPConnection struct {
 
 	SourceController      string
 	DestinationController string
+	created               time.Time
 	EncodedBuf            [tokens.ClaimsEncodedBufSize]byte
 }
 
@@ -468,6 +482,7 @@ func NewUDPConnection(context *pucontext.PUContext, writer afinetrawsocket.Socke
 		synAckStop:  make(chan bool),
 		ackStop:     make(chan bool),
 		TestIgnore:  true,
+		created:     time.Now(),
 	}
 
 	crypto.Nonce().GenerateNonce16Bytes(u.Auth.Nonce[:])
@@ -529,6 +544,46 @@ func (c *UDPConnection) SetState(state UDPFlowState) {
 	c.state = state
 }
 
+// SetTuple records the 4 tuple of the packet that started the connection.
+func (c *UDPConnection) SetTuple(p *packet.Packet) {
+	c.UDPtuple = &TCPTuple{
+		SourceAddress:      p.SourceAddress(),
+		DestinationAddress: p.DestinationAddress(),
+		SourcePort:         p.SourcePort(),
+		DestinationPort:    p.DestPort(),
+	}
+}
+
+// String returns the name of the state.
+func (s UDPFlowState) String() string {
+
+	switch s {
+	case UDPStart:
+		return "UDPStart"
+
+	case UDPClientSendSyn:
+		return "UDPClientSendSyn"
+
+	case UDPClientSendAck:
+		return "UDPClientSendAck"
+
+	case UDPReceiverSendSynAck:
+		return "UDPReceiverSendSynAck"
+
+	case UDPReceiverProcessedAck:
+		return "UDPReceiverProcessedAck"
+
+	case UDPData:
+		return "UDPData"
+
+	case UDPRST:
+		return "UDPRST"
+
+	default:
+		return "UnknownState"
+	}
+}
+
 // QueuePackets queues UDP packets till the flow is authenticated.
 func (c *UDPConnection) QueuePackets(udpPacket *packet.Packet) (err error) {
 	buffer := make([]byte, len(udpPacket.GetBuffer(0)))
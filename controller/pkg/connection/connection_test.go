@@ -1,3 +1,86 @@
 // +build !windows
 
 package connection
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/packet"
+	"go.aporeto.io/enforcerd/trireme-lib/policy"
+)
+
+func TestTableEntry(t *testing.T) {
+
+	Convey("Given an established TCP connection initiated by the PU", t, func() {
+		conn := NewTCPConnection(nil, nil)
+		conn.TCPtuple = &TCPTuple{
+			SourceAddress:      net.ParseIP("10.0.0.1"),
+			DestinationAddress: net.ParseIP("10.0.0.2"),
+			SourcePort:         34000,
+			DestinationPort:    443,
+		}
+		conn.SetState(TCPData)
+		conn.PacketFlowPolicy = &policy.FlowPolicy{Action: policy.Accept, PolicyID: "actual"}
+		conn.ReportFlowPolicy = &policy.FlowPolicy{Action: policy.Reject, PolicyID: "observed"}
+		conn.DestinationController = "remote"
+		conn.Auth.RemoteContextID = "/server"
+		conn.Auth.ConnectionClaims.T = policy.NewTagStoreFromSlice([]string{"app=server"})
+
+		Convey("Its entry should describe the connection", func() {
+			e := conn.TableEntry("key", true, conn.created.Add(time.Minute))
+			So(e.Key, ShouldEqual, "key")
+			So(e.Protocol, ShouldEqual, packet.IPProtocolTCP)
+			So(e.SourceIP, ShouldEqual, "10.0.0.1")
+			So(e.DestinationIP, ShouldEqual, "10.0.0.2")
+			So(e.PeerIP(), ShouldEqual, "10.0.0.2")
+			So(e.DestinationPort, ShouldEqual, 443)
+			So(e.TCPFlowState, ShouldEqual, TCPData)
+			So(e.State, ShouldEqual, "TCPData")
+			So(e.Action, ShouldEqual, policy.Accept)
+			So(e.PolicyID, ShouldEqual, "actual")
+			So(e.ObservedAction, ShouldEqual, policy.Reject)
+			So(e.ObservedPolicyID, ShouldEqual, "observed")
+			So(e.Claims.RemoteContextID, ShouldEqual, "/server")
+			So(e.Claims.Controller, ShouldEqual, "remote")
+			So(e.Claims.Tags, ShouldResemble, []string{"app=server"})
+			So(e.Age, ShouldEqual, time.Minute)
+		})
+
+		Convey("The filter should select it by peer, port and state", func() {
+			e := conn.TableEntry("key", true, time.Now())
+			So((*TableFilter)(nil).Matches(e), ShouldBeTrue)
+			So((&TableFilter{}).Matches(e), ShouldBeTrue)
+			So((&TableFilter{PeerIP: "10.0.0.2", Port: 443, State: "tcpdata"}).Matches(e), ShouldBeTrue)
+			So((&TableFilter{Port: 34000}).Matches(e), ShouldBeTrue)
+			So((&TableFilter{PeerIP: "10.0.0.1"}).Matches(e), ShouldBeFalse)
+			So((&TableFilter{Port: 80}).Matches(e), ShouldBeFalse)
+			So((&TableFilter{State: "TCPSynSend"}).Matches(e), ShouldBeFalse)
+		})
+	})
+
+	Convey("Given a UDP connection accepted by the PU", t, func() {
+		conn := NewUDPConnection(nil, nil)
+		conn.UDPtuple = &TCPTuple{
+			SourceAddress:      net.ParseIP("10.0.0.3"),
+			DestinationAddress: net.ParseIP("10.0.0.1"),
+			SourcePort:         5000,
+			DestinationPort:    53,
+		}
+		conn.SetState(UDPReceiverSendSynAck)
+		conn.SourceController = "remote"
+
+		Convey("Its entry should have the UDP state and the source as peer", func() {
+			e := conn.TableEntry("key", false, time.Now())
+			So(e.Protocol, ShouldEqual, packet.IPProtocolUDP)
+			So(e.UDPFlowState, ShouldEqual, UDPReceiverSendSynAck)
+			So(e.State, ShouldEqual, "UDPReceiverSendSynAck")
+			So(e.PeerIP(), ShouldEqual, "10.0.0.3")
+			So(e.Claims.Controller, ShouldEqual, "remote")
+			So(e.Claims.Tags, ShouldBeNil)
+			So((&TableFilter{PeerIP: "10.0.0.3", Port: 53}).Matches(e), ShouldBeTrue)
+		})
+	})
+}
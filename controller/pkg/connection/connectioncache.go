@@ -11,6 +11,7 @@ type TCPCache interface {
 	Get(string) (*TCPConnection, bool)
 	Remove(string)
 	Len() int
+	KeyList() []string
 }
 
 type tcpCache struct {
@@ -53,3 +54,15 @@ func (c *tcpCache) Len() int {
 
 	return size
 }
+
+//KeyList returns the keys of all the connections in the cache
+func (c *tcpCache) KeyList() []string {
+	c.RLock()
+	keys := make([]string, 0, len(c.m))
+	for key := range c.m {
+		keys = append(keys, key)
+	}
+	c.RUnlock()
+
+	return keys
+}
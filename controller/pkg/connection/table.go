@@ -0,0 +1,204 @@
+package connection
+
+import (
+	"strings"
+	"time"
+
+	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/packet"
+	"go.aporeto.io/enforcerd/trireme-lib/policy"
+)
+
+// TableFilter selects the entries of a snapshot of the connection tables.
+// Fields with their zero value match all the connections.
+type TableFilter struct {
+	// PeerIP is the address of the remote end of the connection.
+	PeerIP string
+	// Port matches the source or the destination port of the connection.
+	Port uint16
+	// State is the name of a TCP or UDP flow state, like TCPData or UDPData.
+	State string
+}
+
+// ClaimsSummary summarizes the identity received from the peer of a connection.
+type ClaimsSummary struct {
+	RemoteContextID string
+	Controller      string
+	Tags            []string
+}
+
+// TableEntry is a snapshot of a connection of the datapath.
+type TableEntry struct {
+	// Key is the key of the connection in its cache.
+	Key       string
+	ContextID string
+	Protocol  uint8
+	// Client is true for the connections initiated by the processing unit.
+	Client          bool
+	SourceIP        string
+	DestinationIP   string
+	SourcePort      uint16
+	DestinationPort uint16
+	// TCPFlowState is only valid for TCP connections and UDPFlowState only
+	// for UDP connections. State is the name of the valid one.
+	TCPFlowState      TCPFlowState
+	UDPFlowState      UDPFlowState
+	State             string
+	Action            policy.ActionType
+	PolicyID          string
+	ObservedAction    policy.ActionType
+	ObservedPolicyID  string
+	ServiceConnection bool
+	Loopback          bool
+	Claims            ClaimsSummary
+	Age               time.Duration
+}
+
+// PeerIP returns the address of the remote end of the connection.
+func (e *TableEntry) PeerIP() string {
+
+	if e.Client {
+		return e.DestinationIP
+	}
+
+	return e.SourceIP
+}
+
+// Matches returns true if the entry is selected by the filter.
+func (f *TableFilter) Matches(e *TableEntry) bool {
+
+	if f == nil {
+		return true
+	}
+
+	if f.PeerIP != "" && f.PeerIP != e.PeerIP() {
+		return false
+	}
+
+	if f.Port != 0 && f.Port != e.SourcePort && f.Port != e.DestinationPort {
+		return false
+	}
+
+	if f.State != "" && !strings.EqualFold(f.State, e.State) {
+		return false
+	}
+
+	return true
+}
+
+// TableEntry returns a snapshot of the connection stored with the given key.
+func (c *TCPConnection) TableEntry(key string, client bool, now time.Time) *TableEntry {
+
+	c.RLock()
+	defer c.RUnlock()
+
+	controller := c.DestinationController
+	if !client {
+		controller = c.SourceController
+	}
+
+	e := &TableEntry{
+		Key:               key,
+		Protocol:          packet.IPProtocolTCP,
+		Client:            client,
+		TCPFlowState:      c.state,
+		State:             c.state.String(),
+		ServiceConnection: c.ServiceConnection,
+		Loopback:          c.loopbackConnection,
+		Claims:            claimsSummary(&c.Auth, controller),
+		Age:               age(c.created, now),
+	}
+
+	if c.Context != nil {
+		e.ContextID = c.Context.ID()
+	}
+
+	setTuple(e, c.TCPtuple)
+	setPolicies(e, c.PacketFlowPolicy, c.ReportFlowPolicy)
+
+	return e
+}
+
+// TableEntry returns a snapshot of the connection stored with the given key.
+func (c *UDPConnection) TableEntry(key string, client bool, now time.Time) *TableEntry {
+
+	c.RLock()
+	defer c.RUnlock()
+
+	controller := c.DestinationController
+	if !client {
+		controller = c.SourceController
+	}
+
+	e := &TableEntry{
+		Key:               key,
+		Protocol:          packet.IPProtocolUDP,
+		Client:            client,
+		UDPFlowState:      c.state,
+		State:             c.state.String(),
+		ServiceConnection: c.ServiceConnection,
+		Loopback:          c.loopbackConnection,
+		Claims:            claimsSummary(&c.Auth, controller),
+		Age:               age(c.created, now),
+	}
+
+	if c.Context != nil {
+		e.ContextID = c.Context.ID()
+	}
+
+	setTuple(e, c.UDPtuple)
+	setPolicies(e, c.PacketFlowPolicy, c.ReportFlowPolicy)
+
+	return e
+}
+
+func setTuple(e *TableEntry, tuple *TCPTuple) {
+
+	if tuple == nil {
+		return
+	}
+
+	if tuple.SourceAddress != nil {
+		e.SourceIP = tuple.SourceAddress.String()
+	}
+	if tuple.DestinationAddress != nil {
+		e.DestinationIP = tuple.DestinationAddress.String()
+	}
+	e.SourcePort = tuple.SourcePort
+	e.DestinationPort = tuple.DestinationPort
+}
+
+func setPolicies(e *TableEntry, actual *policy.FlowPolicy, report *policy.FlowPolicy) {
+
+	if actual != nil {
+		e.Action = actual.Action
+		e.PolicyID = actual.PolicyID
+	}
+
+	if report != nil {
+		e.ObservedAction = report.Action
+		e.ObservedPolicyID = report.PolicyID
+	}
+}
+
+func claimsSummary(auth *AuthInfo, controller string) ClaimsSummary {
+
+	summary := ClaimsSummary{
+		RemoteContextID: auth.RemoteContextID,
+		Controller:      controller,
+	}
+
+	if auth.ConnectionClaims.T != nil {
+		summary.Tags = auth.ConnectionClaims.T.GetSlice()
+	}
+
+	return summary
+}
+
+func age(created time.Time, now time.Time) time.Duration {
+
+	if created.IsZero() || now.Before(created) {
+		return 0
+	}
+
+	return now.Sub(created)
+}
@@ -178,12 +178,26 @@ func _() {
 	_ = x[ErrNonPUUDPTraffic-167]
 	_ = x[ErrIPTablesReset-168]
 	_ = x[ErrDNSInvalidRequest-169]
-	_ = x[errMax-170]
+	_ = x[ErrSynReplayed-170]
+	_ = x[ErrSynAckReplayed-171]
+	_ = x[ErrUDPSynReplayed-172]
+	_ = x[ErrUDPSynAckReplayed-173]
+	_ = x[ErrSynPublicKeyRevoked-174]
+	_ = x[ErrSynRevocationUnknown-175]
+	_ = x[ErrSynAckPublicKeyRevoked-176]
+	_ = x[ErrSynAckRevocationUnknown-177]
+	_ = x[ErrUDPSynPublicKeyRevoked-178]
+	_ = x[ErrUDPSynRevocationUnknown-179]
+	_ = x[ErrUDPSynAckPublicKeyRevoked-180]
+	_ = x[ErrUDPSynAckRevocationUnknown-181]
+	_ = x[ErrProxyCertificateRevoked-182]
+	_ = x[ErrProxyRevocationUnknown-183]
+	_ = x[errMax-184]
 }
 
-const _CounterType_name = "UnknownErrorNonPUTrafficNoConnFoundRejectPacketMarkNotFoundPortNotFoundContextIDNotFoundInvalidProtocolConnectionsProcessedEncrConnectionsProcessedUDPDropFinUDPSynDroppedInvalidTokenUDPSynAckInvalidTokenUDPAckInvalidTokenUDPConnectionsProcessedUDPContextIDNotFoundUDPDropQueueFullUDPDropInNfQueueAppServicePreProcessorFailedAppServicePostProcessorFailedNetServicePreProcessorFailedNetServicePostProcessorFailedSynTokenFailedSynDroppedInvalidTokenSynDroppedTCPOptionSynDroppedInvalidFormatSynRejectPacketSynUnexpectedPacketInvalidNetSynStateNetSynNotSeenSynToExtNetAcceptSynFromExtNetAcceptSynToExtNetRejectSynFromExtNetRejectSynAckTokenFailedOutOfOrderSynAckInvalidSynAckSynAckInvalidTokenSynAckMissingTokenSynAckNoTCPAuthOptionSynAckInvalidFormatSynAckEncryptionMismatchSynAckRejectedSynAckToExtNetAcceptSynAckFromExtNetAcceptSynAckFromExtNetRejectAckTokenFailedAckRejectedAckTCPNoTCPAuthOptionAckInvalidFormatAckInvalidTokenAckInUnknownStateAckFromExtNetAcceptAckFromExtNetRejectUDPAppPreProcessingFailedUDPAppPostProcessingFailedUDPNetPreProcessingFailedUDPNetPostProcessingFailedUDPSynInvalidTokenUDPSynMissingClaimsUDPSynDroppedPolicyUDPSynAckNoConnectionUDPSynAckPolicyDroppedTCPPacketsDroppedUDPPacketsDroppedICMPPacketsDroppedDNSPacketsDroppedDHCPPacketsDroppedNTPPacketsTCPConnectionsExpiredUDPConnectionsExpiredSynTokenEncodeFailedSynTokenHashFailedSynTokenSignFailedSynSharedSecretMissingSynInvalidSecretSynInvalidTokenLengthSynMissingSignatureSynInvalidSignatureSynCompressedTagMismatchSynDatapathVersionMismatchSynTokenDecodeFailedSynTokenExpiredSynSharedKeyHashFailedSynPublicKeyFailedSynAckTokenEncodeFailedSynAckTokenHashFailedSynAckTokenSignFailedSynAckSharedSecretMissingSynAckInvalidSecretSynAckInvalidTokenLengthSynAckMissingSignatureSynAckInvalidSignatureSynAckCompressedTagMismatchSynAckDatapathVersionMismatchSynAckTokenDecodeFailedSynAckTokenExpiredSynAckSharedKeyHashFailedSynAckPublicKeyFailedAckTokenEncodeFailedAckTokenHashFailedAckTokenSignFailedAckSharedSecretMissingAckInvalidSecretAckInvalidTokenLengthAckMissingSignatureAckCompressedTagMismatchAckDatapathVersionMismatchAckTokenDecodeFailedAckTokenExpiredAckSignatureMismatchUDPSynTokenFailedUDPSynTokenEncodeFailedUDPSynTokenHashFailedUDPSynTokenSignFailedUDPSynSharedSecretMissingUDPSynInvalidSecretUDPSynInvalidTokenLengthUDPSynMissingSignatureUDPSynInvalidSignatureUDPSynCompressedTagMismatchUDPSynDatapathVersionMismatchUDPSynTokenDecodeFailedUDPSynTokenExpiredUDPSynSharedKeyHashFailedUDPSynPublicKeyFailedUDPSynAckTokenFailedUDPSynAckTokenEncodeFailedUDPSynAckTokenHashFailedUDPSynAckTokenSignFailedUDPSynAckSharedSecretMissingUDPSynAckInvalidSecretUDPSynAckInvalidTokenLengthUDPSynAckMissingSignatureUDPSynAckInvalidSignatureUDPSynAckCompressedTagMismatchUDPSynAckDatapathVersionMismatchUDPSynAckTokenDecodeFailedUDPSynAckTokenExpiredUDPSynAckSharedKeyHashFailedUDPSynAckPublicKeyFailedUDPAckTokenFailedUDPAckTokenEncodeFailedUDPAckTokenHashFailedUDPAckSharedSecretMissingUDPAckInvalidSecretUDPAckInvalidTokenLengthUDPAckMissingSignatureUDPAckCompressedTagMismatchUDPAckDatapathVersionMismatchUDPAckTokenDecodeFailedUDPAckTokenExpiredUDPAckSignatureMismatchAppSynAuthOptionSetAckToFinAckIgnoreFinInvalidNetStateInvalidNetAckStateAppSynAckAuthOptionSetDuplicateAckDropDNSForwardFailedDNSResponseFailedNfLogErrorSegmentServerContainerEventExceedsProcessingTimeCorruptPacketSynMissingTCPOptionUDPDropRstNonPUUDPTrafficIPTablesResetDNSInvalidRequesterrMax"
+const _CounterType_name = "UnknownErrorNonPUTrafficNoConnFoundRejectPacketMarkNotFoundPortNotFoundContextIDNotFoundInvalidProtocolConnectionsProcessedEncrConnectionsProcessedUDPDropFinUDPSynDroppedInvalidTokenUDPSynAckInvalidTokenUDPAckInvalidTokenUDPConnectionsProcessedUDPContextIDNotFoundUDPDropQueueFullUDPDropInNfQueueAppServicePreProcessorFailedAppServicePostProcessorFailedNetServicePreProcessorFailedNetServicePostProcessorFailedSynTokenFailedSynDroppedInvalidTokenSynDroppedTCPOptionSynDroppedInvalidFormatSynRejectPacketSynUnexpectedPacketInvalidNetSynStateNetSynNotSeenSynToExtNetAcceptSynFromExtNetAcceptSynToExtNetRejectSynFromExtNetRejectSynAckTokenFailedOutOfOrderSynAckInvalidSynAckSynAckInvalidTokenSynAckMissingTokenSynAckNoTCPAuthOptionSynAckInvalidFormatSynAckEncryptionMismatchSynAckRejectedSynAckToExtNetAcceptSynAckFromExtNetAcceptSynAckFromExtNetRejectAckTokenFailedAckRejectedAckTCPNoTCPAuthOptionAckInvalidFormatAckInvalidTokenAckInUnknownStateAckFromExtNetAcceptAckFromExtNetRejectUDPAppPreProcessingFailedUDPAppPostProcessingFailedUDPNetPreProcessingFailedUDPNetPostProcessingFailedUDPSynInvalidTokenUDPSynMissingClaimsUDPSynDroppedPolicyUDPSynAckNoConnectionUDPSynAckPolicyDroppedTCPPacketsDroppedUDPPacketsDroppedICMPPacketsDroppedDNSPacketsDroppedDHCPPacketsDroppedNTPPacketsTCPConnectionsExpiredUDPConnectionsExpiredSynTokenEncodeFailedSynTokenHashFailedSynTokenSignFailedSynSharedSecretMissingSynInvalidSecretSynInvalidTokenLengthSynMissingSignatureSynInvalidSignatureSynCompressedTagMismatchSynDatapathVersionMismatchSynTokenDecodeFailedSynTokenExpiredSynSharedKeyHashFailedSynPublicKeyFailedSynAckTokenEncodeFailedSynAckTokenHashFailedSynAckTokenSignFailedSynAckSharedSecretMissingSynAckInvalidSecretSynAckInvalidTokenLengthSynAckMissingSignatureSynAckInvalidSignatureSynAckCompressedTagMismatchSynAckDatapathVersionMismatchSynAckTokenDecodeFailedSynAckTokenExpiredSynAckSharedKeyHashFailedSynAckPublicKeyFailedAckTokenEncodeFailedAckTokenHashFailedAckTokenSignFailedAckSharedSecretMissingAckInvalidSecretAckInvalidTokenLengthAckMissingSignatureAckCompressedTagMismatchAckDatapathVersionMismatchAckTokenDecodeFailedAckTokenExpiredAckSignatureMismatchUDPSynTokenFailedUDPSynTokenEncodeFailedUDPSynTokenHashFailedUDPSynTokenSignFailedUDPSynSharedSecretMissingUDPSynInvalidSecretUDPSynInvalidTokenLengthUDPSynMissingSignatureUDPSynInvalidSignatureUDPSynCompressedTagMismatchUDPSynDatapathVersionMismatchUDPSynTokenDecodeFailedUDPSynTokenExpiredUDPSynSharedKeyHashFailedUDPSynPublicKeyFailedUDPSynAckTokenFailedUDPSynAckTokenEncodeFailedUDPSynAckTokenHashFailedUDPSynAckTokenSignFailedUDPSynAckSharedSecretMissingUDPSynAckInvalidSecretUDPSynAckInvalidTokenLengthUDPSynAckMissingSignatureUDPSynAckInvalidSignatureUDPSynAckCompressedTagMismatchUDPSynAckDatapathVersionMismatchUDPSynAckTokenDecodeFailedUDPSynAckTokenExpiredUDPSynAckSharedKeyHashFailedUDPSynAckPublicKeyFailedUDPAckTokenFailedUDPAckTokenEncodeFailedUDPAckTokenHashFailedUDPAckSharedSecretMissingUDPAckInvalidSecretUDPAckInvalidTokenLengthUDPAckMissingSignatureUDPAckCompressedTagMismatchUDPAckDatapathVersionMismatchUDPAckTokenDecodeFailedUDPAckTokenExpiredUDPAckSignatureMismatchAppSynAuthOptionSetAckToFinAckIgnoreFinInvalidNetStateInvalidNetAckStateAppSynAckAuthOptionSetDuplicateAckDropDNSForwardFailedDNSResponseFailedNfLogErrorSegmentServerContainerEventExceedsProcessingTimeCorruptPacketSynMissingTCPOptionUDPDropRstNonPUUDPTrafficIPTablesResetDNSInvalidRequestSynReplayedSynAckReplayedUDPSynReplayedUDPSynAckReplayedSynPublicKeyRevokedSynRevocationUnknownSynAckPublicKeyRevokedSynAckRevocationUnknownUDPSynPublicKeyRevokedUDPSynRevocationUnknownUDPSynAckPublicKeyRevokedUDPSynAckRevocationUnknownProxyCertificateRevokedProxyRevocationUnknownerrMax"
 
-var _CounterType_index = [...]uint16{0, 12, 24, 35, 47, 59, 71, 88, 103, 123, 147, 157, 182, 203, 221, 244, 264, 280, 296, 324, 353, 381, 410, 424, 446, 465, 488, 503, 522, 540, 553, 570, 589, 606, 625, 642, 658, 671, 689, 707, 728, 747, 771, 785, 805, 827, 849, 863, 874, 895, 911, 926, 943, 962, 981, 1006, 1032, 1057, 1083, 1101, 1120, 1139, 1160, 1175, 1192, 1209, 1227, 1244, 1262, 1279, 1300, 1321, 1341, 1359, 1377, 1399, 1415, 1436, 1455, 1474, 1498, 1524, 1544, 1559, 1581, 1599, 1622, 1643, 1664, 1689, 1708, 1732, 1754, 1776, 1803, 1832, 1855, 1873, 1898, 1919, 1939, 1957, 1975, 1997, 2013, 2034, 2053, 2077, 2103, 2123, 2138, 2158, 2175, 2198, 2219, 2240, 2265, 2284, 2308, 2330, 2352, 2379, 2408, 2431, 2449, 2474, 2495, 2515, 2541, 2565, 2589, 2617, 2639, 2666, 2691, 2716, 2746, 2778, 2804, 2825, 2853, 2877, 2894, 2917, 2938, 2963, 2982, 3006, 3028, 3055, 3084, 3107, 3125, 3148, 3167, 3178, 3187, 3202, 3220, 3242, 3258, 3274, 3291, 3301, 3349, 3362, 3381, 3391, 3406, 3419, 3436, 3442}
+var _CounterType_index = [...]uint16{0, 12, 24, 35, 47, 59, 71, 88, 103, 123, 147, 157, 182, 203, 221, 244, 264, 280, 296, 324, 353, 381, 410, 424, 446, 465, 488, 503, 522, 540, 553, 570, 589, 606, 625, 642, 658, 671, 689, 707, 728, 747, 771, 785, 805, 827, 849, 863, 874, 895, 911, 926, 943, 962, 981, 1006, 1032, 1057, 1083, 1101, 1120, 1139, 1160, 1175, 1192, 1209, 1227, 1244, 1262, 1279, 1300, 1321, 1341, 1359, 1377, 1399, 1415, 1436, 1455, 1474, 1498, 1524, 1544, 1559, 1581, 1599, 1622, 1643, 1664, 1689, 1708, 1732, 1754, 1776, 1803, 1832, 1855, 1873, 1898, 1919, 1939, 1957, 1975, 1997, 2013, 2034, 2053, 2077, 2103, 2123, 2138, 2158, 2175, 2198, 2219, 2240, 2265, 2284, 2308, 2330, 2352, 2379, 2408, 2431, 2449, 2474, 2495, 2515, 2541, 2565, 2589, 2617, 2639, 2666, 2691, 2716, 2746, 2778, 2804, 2825, 2853, 2877, 2894, 2917, 2938, 2963, 2982, 3006, 3028, 3055, 3084, 3107, 3125, 3148, 3167, 3178, 3187, 3202, 3220, 3242, 3258, 3274, 3291, 3301, 3349, 3362, 3381, 3391, 3406, 3419, 3436, 3447, 3461, 3475, 3492, 3511, 3531, 3553, 3576, 3598, 3621, 3646, 3672, 3695, 3717, 3723}
 
 func (i CounterType) String() string {
 	if i < 0 || i >= CounterType(len(_CounterType_index)-1) {
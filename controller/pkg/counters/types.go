@@ -178,6 +178,20 @@ const (
 	ErrNonPUUDPTraffic
 	ErrIPTablesReset
 	ErrDNSInvalidRequest
+	ErrSynReplayed
+	ErrSynAckReplayed
+	ErrUDPSynReplayed
+	ErrUDPSynAckReplayed
+	ErrSynPublicKeyRevoked
+	ErrSynRevocationUnknown
+	ErrSynAckPublicKeyRevoked
+	ErrSynAckRevocationUnknown
+	ErrUDPSynPublicKeyRevoked
+	ErrUDPSynRevocationUnknown
+	ErrUDPSynAckPublicKeyRevoked
+	ErrUDPSynAckRevocationUnknown
+	ErrProxyCertificateRevoked
+	ErrProxyRevocationUnknown
 	// !!!! ADD NEW ERRORS ABOVE THIS LINE !!!!
 	// errMax must be the last error counter defined.
 	errMax
@@ -0,0 +1,80 @@
+package ipsetmanager
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// BatchIpset is implemented by the ipsets that can apply many updates
+// in one operation. The helpers of this package use it when available
+// and fall back to one operation per entry otherwise.
+type BatchIpset interface {
+	Ipset
+	// AddBatch adds all the entries to the set. The entries in nomatch
+	// are added with the nomatch option. A *BatchError is returned when
+	// some entries could not be added. The other entries are added.
+	AddBatch(entries []string, nomatch []string, timeout int) error
+	// DelBatch deletes all the entries from the set. A *BatchError is
+	// returned when some entries could not be deleted. The other entries
+	// are deleted.
+	DelBatch(entries []string) error
+}
+
+// BatchError is returned by the batch updates when some entries could
+// not be applied to a set.
+type BatchError struct {
+	// Failed maps the entries that could not be applied to their error.
+	Failed map[string]error
+}
+
+func (e *BatchError) Error() string {
+
+	entries := make([]string, 0, len(e.Failed))
+	for entry := range e.Failed {
+		entries = append(entries, entry)
+	}
+	sort.Strings(entries)
+
+	msgs := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		msgs = append(msgs, fmt.Sprintf("%s: %s", entry, e.Failed[entry]))
+	}
+
+	return fmt.Sprintf("%d entries failed: %s", len(entries), strings.Join(msgs, ", "))
+}
+
+// failedEntries returns the entries of data that were not applied by an
+// update of the set that returned err. All of them failed when err is not
+// a *BatchError.
+func failedEntries(err error, data []string) map[string]bool {
+
+	failed := map[string]bool{}
+	if err == nil {
+		return failed
+	}
+
+	batchErr, ok := err.(*BatchError)
+	for _, d := range data {
+		if !ok {
+			failed[d] = true
+			continue
+		}
+		if _, found := batchErr.Failed[d]; found {
+			failed[d] = true
+		}
+	}
+
+	return failed
+}
+
+// entryError returns the error of a single entry update that was applied
+// as a batch.
+func entryError(entry string, err error) error {
+
+	if batchErr, ok := err.(*BatchError); ok {
+		return batchErr.Failed[entry]
+	}
+
+	return err
+}
@@ -51,3 +51,140 @@ func delFromIPset(set Ipset, data string) error {
 
 	return set.Del(strings.TrimPrefix(data, "!"))
 }
+
+// expandEntry returns the entries that must be programmed in a set for
+// data and whether they must be added with the nomatch option.
+func expandEntry(data string) ([]string, bool) {
+
+	// ipset can not program these rules
+	switch data {
+	case IPv4DefaultIP:
+		return []string{"0.0.0.0/1", "128.0.0.0/1"}, false
+	case IPv6DefaultIP:
+		return []string{"::/1", "8000::/1"}, false
+	}
+
+	if strings.HasPrefix(data, "!") {
+		return []string{data[1:]}, true
+	}
+
+	return []string{data}, false
+}
+
+// addToIPsetBatch adds all the data to the set. All the data is processed
+// even when some of it fails. A *BatchError keyed by data is returned
+// when some data could not be added.
+func addToIPsetBatch(set Ipset, data []string) error {
+
+	if len(data) == 0 {
+		return nil
+	}
+
+	failed := map[string]error{}
+
+	batch, ok := set.(BatchIpset)
+	if !ok {
+		for _, d := range data {
+			if err := addToIPset(set, d); err != nil {
+				failed[d] = err
+			}
+		}
+		return batchError(failed)
+	}
+
+	origin := map[string]string{}
+	entries := []string{}
+	nomatch := []string{}
+	for _, d := range data {
+		expanded, isNomatch := expandEntry(d)
+		for _, entry := range expanded {
+			origin[entry] = d
+		}
+		if isNomatch {
+			nomatch = append(nomatch, expanded...)
+			continue
+		}
+		entries = append(entries, expanded...)
+	}
+
+	if err := batch.AddBatch(entries, nomatch, 0); err != nil {
+		return originError(err, origin, data)
+	}
+
+	return nil
+}
+
+// delFromIPsetBatch deletes all the data from the set. All the data is
+// processed even when some of it fails. A *BatchError keyed by data is
+// returned when some data could not be deleted.
+func delFromIPsetBatch(set Ipset, data []string) error {
+
+	if len(data) == 0 {
+		return nil
+	}
+
+	failed := map[string]error{}
+
+	batch, ok := set.(BatchIpset)
+	if !ok {
+		for _, d := range data {
+			if err := delFromIPset(set, d); err != nil {
+				failed[d] = err
+			}
+		}
+		return batchError(failed)
+	}
+
+	origin := map[string]string{}
+	entries := []string{}
+	for _, d := range data {
+		expanded, _ := expandEntry(d)
+		for _, entry := range expanded {
+			origin[entry] = d
+		}
+		entries = append(entries, expanded...)
+	}
+
+	if err := batch.DelBatch(entries); err != nil {
+		return originError(err, origin, data)
+	}
+
+	return nil
+}
+
+// batchError returns a *BatchError for the failed entries, or nil when
+// there are none.
+func batchError(failed map[string]error) error {
+
+	if len(failed) == 0 {
+		return nil
+	}
+
+	return &BatchError{Failed: failed}
+}
+
+// originError maps the failed entries of a batch update back to the data
+// they were expanded from. All the data failed when err is not a
+// *BatchError.
+func originError(err error, origin map[string]string, data []string) error {
+
+	failed := map[string]error{}
+
+	batchErr, ok := err.(*BatchError)
+	if !ok {
+		for _, d := range data {
+			failed[d] = err
+		}
+		return batchError(failed)
+	}
+
+	for entry, entryErr := range batchErr.Failed {
+		d, ok := origin[entry]
+		if !ok {
+			d = entry
+		}
+		failed[d] = entryErr
+	}
+
+	return batchError(failed)
+}
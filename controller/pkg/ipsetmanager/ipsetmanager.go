@@ -150,6 +150,10 @@ type handler struct {
 	en  excludedNetwork
 
 	dynamicUpdates map[string][]string
+
+	// provider is the ipset provider of this handler. When it is nil
+	// the package provider is used.
+	provider IpsetProvider
 }
 
 const (
@@ -189,19 +193,68 @@ var ipv6Handler = &handler{
 	dynamicUpdates: map[string][]string{},
 }
 
+// defaultProvider selects the ipset provider of the package the first time
+// the V4 or V6 instances are requested.
+var defaultProvider sync.Once
+
 //V4 returns the ipv4 instance of ipsetmanager
 func V4() IPSetManager {
+	defaultProvider.Do(setDefaultProvider)
 	return ipv4Handler
 }
 
 //V6 returns the ipv6 instance of ipsetmanager
 func V6() IPSetManager {
+	defaultProvider.Do(setDefaultProvider)
 	return ipv6Handler
 }
 
+// NewWithProvider returns a standalone instance of ipsetmanager for the given
+// ip version (IPsetV4 or IPsetV6) that programs all the sets through the given
+// provider. It shares no state with the V4/V6 instances and is used when the
+// ipsets must not be programmed in the system, like for rendering the rules.
+func NewWithProvider(ipVersion int, provider IpsetProvider) IPSetManager {
+
+	h := &handler{
+		ipsetPrefix: constants.ChainPrefix + ipv4String,
+		ipFilter: func(ip net.IP) bool {
+			return (ip.To4() != nil)
+		},
+		ipsetParams: &ipsetpackage.Params{},
+
+		acl: aclHandler{
+			serviceIDtoACLIPset:   map[string]*ipsetInfo{},
+			contextIDtoServiceIDs: map[string]map[string]bool{},
+		},
+		tn:             targetNetwork{tcp: []string{}, udp: []string{}},
+		en:             excludedNetwork{excluded: []string{}},
+		dynamicUpdates: map[string][]string{},
+		provider:       provider,
+	}
+
+	if ipVersion == IPsetV6 {
+		h.ipsetPrefix = constants.ChainPrefix + ipv6String
+		h.ipFilter = func(ip net.IP) bool {
+			return (ip.To4() == nil)
+		}
+		h.ipsetParams = &ipsetpackage.Params{HashFamily: "inet6"}
+	}
+
+	return h
+}
+
+// ipsetProvider returns the provider used to program the sets of this handler.
+func (ipHandler *handler) ipsetProvider() IpsetProvider {
+	if ipHandler.provider != nil {
+		return ipHandler.provider
+	}
+
+	return instance
+}
+
 func (ipHandler *handler) DestroyAllIPsets() error {
 
-	if err := destroyAll(ipHandler.ipsetPrefix); err != nil {
+	if err := ipHandler.ipsetProvider().DestroyAll(ipHandler.ipsetPrefix); err != nil {
 		return err
 	}
 
@@ -228,7 +281,7 @@ func (ipHandler *handler) CreateIPsetsForTargetAndExcludedNetworks() error {
 	targetUDPName := ipHandler.ipsetPrefix + targetUDPSuffix
 	excludedName := ipHandler.ipsetPrefix + excludedSuffix
 
-	existingSets, err := listIPSets()
+	existingSets, err := ipHandler.ipsetProvider().ListIPSets()
 	if err != nil {
 		return fmt.Errorf("unable to read current sets: %s", err)
 	}
@@ -243,12 +296,12 @@ func (ipHandler *handler) CreateIPsetsForTargetAndExcludedNetworks() error {
 		var err error
 
 		if _, ok := setIndex[name]; !ok {
-			ipset, err = newIpset(name, "hash:net", ipHandler.ipsetParams)
+			ipset, err = ipHandler.ipsetProvider().NewIpset(name, "hash:net", ipHandler.ipsetParams)
 			if err != nil {
 				return err
 			}
 		} else {
-			ipset = getIpset(name)
+			ipset = ipHandler.ipsetProvider().GetIpset(name)
 		}
 
 		if err = ipset.Flush(); err != nil {
@@ -291,22 +344,28 @@ func updateIPSets(ipset Ipset, old []string, new []string) error {
 		addMap[net] = true
 	}
 
+	toDelete := []string{}
 	for net, delete := range deleteMap {
 		if delete {
-			if err := delFromIPset(ipset, net); err != nil {
-				zap.L().Debug("unable to remove network from set", zap.Error(err))
-			}
+			toDelete = append(toDelete, net)
 		}
 	}
 
+	if err := delFromIPsetBatch(ipset, toDelete); err != nil {
+		zap.L().Debug("unable to remove network from set", zap.Error(err))
+	}
+
+	toAdd := []string{}
 	for net, add := range addMap {
 		if add {
-			if err := addToIPset(ipset, net); err != nil {
-				return fmt.Errorf("unable to update target set: %s", err)
-			}
+			toAdd = append(toAdd, net)
 		}
 	}
 
+	if err := addToIPsetBatch(ipset, toAdd); err != nil {
+		return fmt.Errorf("unable to update target set: %s", err)
+	}
+
 	return nil
 }
 
@@ -333,9 +392,9 @@ func (ipHandler *handler) UpdateIPsetsForTargetAndExcludedNetworks(tcp []string,
 		return filteredIPs
 	}
 
-	tcpSet := getIpset(ipHandler.ipsetPrefix + targetTCPSuffix)
-	udpSet := getIpset(ipHandler.ipsetPrefix + targetUDPSuffix)
-	excludedSet := getIpset(ipHandler.ipsetPrefix + excludedSuffix)
+	tcpSet := ipHandler.ipsetProvider().GetIpset(ipHandler.ipsetPrefix + targetTCPSuffix)
+	udpSet := ipHandler.ipsetProvider().GetIpset(ipHandler.ipsetPrefix + targetUDPSuffix)
+	excludedSet := ipHandler.ipsetProvider().GetIpset(ipHandler.ipsetPrefix + excludedSuffix)
 
 	tcpFilterIPs := filterIPs(tcp)
 	if err := updateIPSets(tcpSet, ipHandler.tn.tcp, tcpFilterIPs); err != nil {
@@ -384,12 +443,12 @@ func (ipHandler *handler) GetProxySetNames(contextID string) (string, string) {
 func (ipHandler *handler) DestroyProxySets(contextID string) {
 	destSetName, srvSetName := ipHandler.getProxyIPSetNames(contextID)
 
-	ips := getIpset(destSetName)
+	ips := ipHandler.ipsetProvider().GetIpset(destSetName)
 	if err := ips.Destroy(); err != nil {
 		zap.L().Warn("Failed to destroy proxyPortSet", zap.String("SetName", destSetName), zap.Error(err))
 	}
 
-	ips = getIpset(srvSetName)
+	ips = ipHandler.ipsetProvider().GetIpset(srvSetName)
 	if err := ips.Destroy(); err != nil {
 		zap.L().Warn("Failed to clear proxy port set", zap.String("set name", srvSetName), zap.Error(err))
 	}
@@ -400,12 +459,12 @@ func (ipHandler *handler) CreateProxySets(contextID string) error {
 
 	destSetName, srvSetName := ipHandler.getProxyIPSetNames(contextID)
 
-	if _, err := newIpset(destSetName, "hash:net,port", ipHandler.ipsetParams); err != nil {
+	if _, err := ipHandler.ipsetProvider().NewIpset(destSetName, "hash:net,port", ipHandler.ipsetParams); err != nil {
 		return fmt.Errorf("unable to create ipset for %s: %s", destSetName, err)
 	}
 
 	// create ipset for port match
-	if _, err := newIpset(srvSetName, proxySetPortIpsetType, nil); err != nil {
+	if _, err := ipHandler.ipsetProvider().NewIpset(srvSetName, proxySetPortIpsetType, nil); err != nil {
 		return fmt.Errorf("unable to create ipset for %s: %s", srvSetName, err)
 	}
 
@@ -415,12 +474,12 @@ func (ipHandler *handler) CreateProxySets(contextID string) error {
 func (ipHandler *handler) FlushProxySets(contextID string) {
 	destSetName, srvSetName := ipHandler.getProxyIPSetNames(contextID)
 
-	ips := getIpset(destSetName)
+	ips := ipHandler.ipsetProvider().GetIpset(destSetName)
 	if err := ips.Flush(); err != nil {
 		zap.L().Warn("Failed to flush dest proxy port set", zap.String("SetName", destSetName), zap.Error(err))
 	}
 
-	ips = getIpset(srvSetName)
+	ips = ipHandler.ipsetProvider().GetIpset(srvSetName)
 	if err := ips.Flush(); err != nil {
 		zap.L().Warn("Failed to flush server proxy port set", zap.String("set name", srvSetName), zap.Error(err))
 	}
@@ -429,7 +488,7 @@ func (ipHandler *handler) FlushProxySets(contextID string) {
 func (ipHandler *handler) AddIPPortToDependentService(contextID string, addr *net.IPNet, port string) error {
 
 	destSetName, _ := ipHandler.getProxyIPSetNames(contextID)
-	ips := getIpset(destSetName)
+	ips := ipHandler.ipsetProvider().GetIpset(destSetName)
 
 	if ipHandler.ipFilter(addr.IP) {
 		pair := addr.String() + "," + port
@@ -443,7 +502,7 @@ func (ipHandler *handler) AddIPPortToDependentService(contextID string, addr *ne
 
 func (ipHandler *handler) AddPortToExposedService(contextID string, port string) error {
 	_, srvSetName := ipHandler.getProxyIPSetNames(contextID)
-	ips := getIpset(srvSetName)
+	ips := ipHandler.ipsetProvider().GetIpset(srvSetName)
 
 	if err := ips.Add(port, 0); err != nil {
 		return fmt.Errorf("unable to add port %s to exposed service %s", port, err)
@@ -458,7 +517,7 @@ func (ipHandler *handler) GetServerPortSetName(contextID string) string {
 
 func (ipHandler *handler) CreateServerPortSet(contextID string) error {
 
-	if _, err := newIpset(ipHandler.getServerPortSetName(contextID), portSetIpsetType, nil); err != nil {
+	if _, err := ipHandler.ipsetProvider().NewIpset(ipHandler.getServerPortSetName(contextID), portSetIpsetType, nil); err != nil {
 		return err
 	}
 
@@ -468,7 +527,7 @@ func (ipHandler *handler) CreateServerPortSet(contextID string) error {
 func (ipHandler *handler) DestroyServerPortSet(contextID string) error {
 
 	portSetName := ipHandler.getServerPortSetName(contextID)
-	ips := getIpset(portSetName)
+	ips := ipHandler.ipsetProvider().GetIpset(portSetName)
 
 	if err := ips.Destroy(); err != nil {
 		return fmt.Errorf("Failed to delete pu port set "+portSetName, zap.Error(err))
@@ -479,7 +538,7 @@ func (ipHandler *handler) DestroyServerPortSet(contextID string) error {
 
 func (ipHandler *handler) AddPortToServerPortSet(contextID string, port string) error {
 
-	ips := getIpset(ipHandler.getServerPortSetName(contextID))
+	ips := ipHandler.ipsetProvider().GetIpset(ipHandler.getServerPortSetName(contextID))
 
 	if err := ips.Add(port, 0); err != nil {
 		return fmt.Errorf("unable to add port to portset: %s", err)
@@ -490,7 +549,7 @@ func (ipHandler *handler) AddPortToServerPortSet(contextID string, port string)
 
 func (ipHandler *handler) DeletePortFromServerPortSet(contextID string, port string) error {
 
-	ips := getIpset(ipHandler.getServerPortSetName(contextID))
+	ips := ipHandler.ipsetProvider().GetIpset(ipHandler.getServerPortSetName(contextID))
 
 	if err := ips.Del(port); err != nil {
 		return fmt.Errorf("unable to delete port from portset: %s", err)
@@ -598,7 +657,7 @@ func (ipHandler *handler) DeleteEntryFromIPset(ips []string, serviceID string) {
 			netIP, _, _ = net.ParseCIDR(parsableAddress)
 		}
 		if ipset := ipHandler.acl.serviceIDtoACLIPset[serviceID]; ipset != nil {
-			ipsetHandler := getIpset(ipset.name)
+			ipsetHandler := ipHandler.ipsetProvider().GetIpset(ipset.name)
 			delFromIPset(ipsetHandler, netIP.String()) // nolint
 			delete(ipset.addresses, address)
 
@@ -637,6 +696,12 @@ func (ipHandler *handler) UpdateACLIPsets(addresses []string, serviceID string)
 
 	ipHandler.updateDynamicAddresses(addresses, serviceID)
 
+	ipset := ipHandler.acl.serviceIDtoACLIPset[serviceID]
+	if ipset == nil {
+		return
+	}
+
+	toAdd := []string{}
 	for _, address := range addresses {
 		parsableAddress := address
 		if strings.HasPrefix(address, "!") {
@@ -652,12 +717,22 @@ func (ipHandler *handler) UpdateACLIPsets(addresses []string, serviceID string)
 			continue
 		}
 
-		if ipset := ipHandler.acl.serviceIDtoACLIPset[serviceID]; ipset != nil {
-			ipsetHandler := getIpset(ipset.name)
-			if err := addToIPset(ipsetHandler, address); err != nil {
-				zap.L().Error("Error adding IPs to ipset", zap.String("ipset", ipset.name), zap.String("address", address))
-			}
+		toAdd = append(toAdd, address)
+	}
+
+	// The DNS proxy can send many addresses at once. They are all
+	// programmed in one batch when the provider supports it. Only the
+	// addresses that were added are recorded, so that the others are
+	// added again by the next update.
+	ipsetHandler := ipHandler.ipsetProvider().GetIpset(ipset.name)
+	err := addToIPsetBatch(ipsetHandler, toAdd)
+	if err != nil {
+		zap.L().Error("Error adding IPs to ipset", zap.String("ipset", ipset.name), zap.Strings("addresses", toAdd), zap.Error(err))
+	}
 
+	failed := failedEntries(err, toAdd)
+	for _, address := range toAdd {
+		if !failed[address] {
 			ipset.addresses[address] = true
 		}
 	}
@@ -674,7 +749,7 @@ func hashServiceID(serviceID string) string {
 
 func (ipHandler *handler) synchronizeIPsinIpset(ipsetInfo *ipsetInfo, addresses []string) {
 	newips := map[string]bool{}
-	ipsetHandler := getIpset(ipsetInfo.name)
+	ipsetHandler := ipHandler.ipsetProvider().GetIpset(ipsetInfo.name)
 
 	var addrToAdd, addrToDelete []string
 
@@ -707,16 +782,26 @@ func (ipHandler *handler) synchronizeIPsinIpset(ipsetInfo *ipsetInfo, addresses
 		}
 	}
 
-	if err := updateIPSets(ipsetHandler, addrToDelete, addrToAdd); err != nil {
+	// We need to delete first, because of nomatch.
+	if err := delFromIPsetBatch(ipsetHandler, addrToDelete); err != nil {
+		zap.L().Debug("unable to remove addresses from ipset during sync", zap.Error(err))
+	}
+
+	err := addToIPsetBatch(ipsetHandler, addrToAdd)
+	if err != nil {
 		zap.L().Error("Error updating ipset during sync", zap.Error(err))
 	}
 
+	for address := range failedEntries(err, addrToAdd) {
+		delete(newips, address)
+	}
+
 	ipsetInfo.addresses = newips
 }
 
 func (ipHandler *handler) createACLIPset(serviceID string) (*ipsetInfo, error) {
 	ipsetName := ipHandler.ipsetPrefix + "ext-" + hashServiceID(serviceID)
-	if _, err := newIpset(ipsetName, "hash:net", ipHandler.ipsetParams); err != nil {
+	if _, err := ipHandler.ipsetProvider().NewIpset(ipsetName, "hash:net", ipHandler.ipsetParams); err != nil {
 		return nil, err
 	}
 
@@ -755,7 +840,7 @@ func (ipHandler *handler) DestroyUnusedIPsets() {
 	defer ipHandler.Unlock()
 
 	for _, ipsetName := range ipHandler.acl.toDestroy {
-		ipsetHandler := getIpset(ipsetName)
+		ipsetHandler := ipHandler.ipsetProvider().GetIpset(ipsetName)
 		if err := ipsetHandler.Destroy(); err != nil {
 			zap.L().Warn("Failed to destroy ipset", zap.String("ipset", ipsetName), zap.Error(err))
 		}
@@ -95,22 +95,6 @@ func (i *goIpsetProvider) ListIPSets() ([]string, error) {
 	return strings.Split(string(out), "\n"), nil
 }
 
-func newIpset(name string, ipsetType string, p *ipset.Params) (Ipset, error) {
-	return instance.NewIpset(name, ipsetType, p)
-}
-
-func getIpset(name string) Ipset {
-	return instance.GetIpset(name)
-}
-
-func destroyAll(prefix string) error {
-	return instance.DestroyAll(prefix)
-}
-
-func listIPSets() ([]string, error) {
-	return instance.ListIPSets()
-}
-
 //SetIpsetTestInstance sets a test instance of ipsetprovider
 func SetIpsetTestInstance(ipsetprovider IpsetProvider) {
 	instance = ipsetprovider
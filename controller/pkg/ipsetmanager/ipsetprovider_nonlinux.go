@@ -0,0 +1,7 @@
+// +build !linux
+
+package ipsetmanager
+
+// setDefaultProvider keeps the default ipset provider. The netlink
+// implementation is only available on linux.
+func setDefaultProvider() {}
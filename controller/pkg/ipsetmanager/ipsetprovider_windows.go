@@ -99,22 +99,6 @@ func (w *winIPSet) Test(entry string) (bool, error) {
 	return frontman.Wrapper.IpsetTest(w.handle, entry)
 }
 
-func newIpset(name string, ipsetType string, p *ipset.Params) (Ipset, error) {
-	return IPsetProvider().NewIpset(name, ipsetType, p)
-}
-
-func getIpset(name string) Ipset {
-	return IPsetProvider().GetIpset(name)
-}
-
-func destroyAll(prefix string) error {
-	return IPsetProvider().DestroyAll(prefix)
-}
-
-func listIPSets() ([]string, error) {
-	return IPsetProvider().ListIPSets()
-}
-
 //SetIpsetTestInstance sets the test instance for ipsets
 func SetIpsetTestInstance(ipsetprovider IpsetProvider) {
 	instance = ipsetprovider
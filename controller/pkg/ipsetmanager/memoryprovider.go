@@ -0,0 +1,253 @@
+package ipsetmanager
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aporeto-inc/go-ipset/ipset"
+)
+
+// MemoryIpsetProvider is an in-memory IpsetProvider. It keeps the sets
+// and their entries in maps and is meant to be used in unit tests.
+type MemoryIpsetProvider struct {
+	sets map[string]*memoryIpset
+	sync.Mutex
+}
+
+// NewMemoryIpsetProvider returns a new in-memory IpsetProvider.
+func NewMemoryIpsetProvider() *MemoryIpsetProvider {
+	return &MemoryIpsetProvider{
+		sets: map[string]*memoryIpset{},
+	}
+}
+
+// NewIpset creates a new set. An existing set with the same name is
+// flushed.
+func (p *MemoryIpsetProvider) NewIpset(name string, ipsetType string, params *ipset.Params) (Ipset, error) {
+
+	p.Lock()
+	defer p.Unlock()
+
+	if set, ok := p.sets[name]; ok {
+		if set.ipsetType != ipsetType {
+			return nil, fmt.Errorf("set %s already exists with type %s", name, set.ipsetType)
+		}
+		set.entries = map[string]string{}
+		return set, nil
+	}
+
+	p.sets[name] = &memoryIpset{
+		name:      name,
+		ipsetType: ipsetType,
+		entries:   map[string]string{},
+		owner:     p,
+	}
+
+	return p.sets[name], nil
+}
+
+// GetIpset gets the ipset object from the name.
+func (p *MemoryIpsetProvider) GetIpset(name string) Ipset {
+
+	p.Lock()
+	defer p.Unlock()
+
+	if set, ok := p.sets[name]; ok {
+		return set
+	}
+
+	return &memoryIpset{name: name, owner: p}
+}
+
+// DestroyAll destroys all the ipsets with the given prefix
+func (p *MemoryIpsetProvider) DestroyAll(prefix string) error {
+
+	p.Lock()
+	defer p.Unlock()
+
+	for name := range p.sets {
+		if strings.HasPrefix(name, prefix) {
+			delete(p.sets, name)
+		}
+	}
+
+	return nil
+}
+
+// ListIPSets returns the names of all the ipsets.
+func (p *MemoryIpsetProvider) ListIPSets() ([]string, error) {
+
+	p.Lock()
+	defer p.Unlock()
+
+	names := make([]string, 0, len(p.sets))
+	for name := range p.sets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// Entries returns the sorted entries of a set and whether the set exists.
+// The entries added with the nomatch option are prefixed with "!".
+func (p *MemoryIpsetProvider) Entries(name string) ([]string, bool) {
+
+	p.Lock()
+	defer p.Unlock()
+
+	set, ok := p.sets[name]
+	if !ok {
+		return nil, false
+	}
+
+	entries := make([]string, 0, len(set.entries))
+	for entry, option := range set.entries {
+		if option == "nomatch" {
+			entry = "!" + entry
+		}
+		entries = append(entries, entry)
+	}
+	sort.Strings(entries)
+
+	return entries, true
+}
+
+// memoryIpset implements BatchIpset on top of a MemoryIpsetProvider.
+type memoryIpset struct {
+	name      string
+	ipsetType string
+	entries   map[string]string
+	owner     *MemoryIpsetProvider
+}
+
+// set must be called with the owner lock held.
+func (s *memoryIpset) set() (*memoryIpset, error) {
+
+	set, ok := s.owner.sets[s.name]
+	if !ok {
+		return nil, fmt.Errorf("set %s does not exist", s.name)
+	}
+
+	return set, nil
+}
+
+func (s *memoryIpset) Add(entry string, timeout int) error {
+	return entryError(entry, s.AddBatch([]string{entry}, nil, timeout))
+}
+
+func (s *memoryIpset) AddOption(entry string, option string, timeout int) error {
+	return entryError(entry, s.AddBatch(nil, []string{entry}, timeout))
+}
+
+func (s *memoryIpset) Del(entry string) error {
+	return s.DelBatch([]string{entry})
+}
+
+func (s *memoryIpset) Destroy() error {
+
+	s.owner.Lock()
+	defer s.owner.Unlock()
+
+	if _, err := s.set(); err != nil {
+		return err
+	}
+
+	delete(s.owner.sets, s.name)
+	return nil
+}
+
+func (s *memoryIpset) Flush() error {
+
+	s.owner.Lock()
+	defer s.owner.Unlock()
+
+	set, err := s.set()
+	if err != nil {
+		return err
+	}
+
+	set.entries = map[string]string{}
+	return nil
+}
+
+func (s *memoryIpset) Test(entry string) (bool, error) {
+
+	s.owner.Lock()
+	defer s.owner.Unlock()
+
+	set, err := s.set()
+	if err != nil {
+		return false, err
+	}
+
+	_, ok := set.entries[entry]
+	return ok, nil
+}
+
+// validate returns an error when the address of an entry of a hash set can
+// not be parsed, like the kernel does.
+func (s *memoryIpset) validate(entry string) error {
+
+	if !strings.HasPrefix(s.ipsetType, "hash:") {
+		return nil
+	}
+
+	address := strings.SplitN(entry, ",", 2)[0]
+	if net.ParseIP(address) != nil {
+		return nil
+	}
+
+	if _, _, err := net.ParseCIDR(address); err != nil {
+		return fmt.Errorf("invalid address %s", address)
+	}
+
+	return nil
+}
+
+func (s *memoryIpset) AddBatch(entries []string, nomatch []string, timeout int) error {
+
+	s.owner.Lock()
+	defer s.owner.Unlock()
+
+	set, err := s.set()
+	if err != nil {
+		return err
+	}
+
+	failed := map[string]error{}
+	add := func(entries []string, option string) {
+		for _, entry := range entries {
+			if err := set.validate(entry); err != nil {
+				failed[entry] = err
+				continue
+			}
+			set.entries[entry] = option
+		}
+	}
+
+	add(entries, "")
+	add(nomatch, "nomatch")
+
+	return batchError(failed)
+}
+
+func (s *memoryIpset) DelBatch(entries []string) error {
+
+	s.owner.Lock()
+	defer s.owner.Unlock()
+
+	set, err := s.set()
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		delete(set.entries, entry)
+	}
+
+	return nil
+}
@@ -0,0 +1,165 @@
+package ipsetmanager
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMemoryIpsetProvider(t *testing.T) {
+
+	p := NewMemoryIpsetProvider()
+
+	set, err := p.NewIpset("TRI-v4-test", "hash:net", nil)
+	if err != nil {
+		t.Fatalf("NewIpset() error = %v", err)
+	}
+
+	if err := set.Add("10.0.0.0/8", 0); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	if err := set.AddOption("10.1.0.0/16", "nomatch", 0); err != nil {
+		t.Fatalf("AddOption() error = %v", err)
+	}
+
+	if err := p.GetIpset("TRI-v4-test").(BatchIpset).AddBatch([]string{"20.0.0.1", "20.0.0.2"}, nil, 0); err != nil {
+		t.Fatalf("AddBatch() error = %v", err)
+	}
+
+	if ok, _ := set.Test("20.0.0.1"); !ok {
+		t.Errorf("Test() = false, want true")
+	}
+
+	if err := set.Del("20.0.0.2"); err != nil {
+		t.Fatalf("Del() error = %v", err)
+	}
+
+	want := []string{"!10.1.0.0/16", "10.0.0.0/8", "20.0.0.1"}
+	if got, _ := p.Entries("TRI-v4-test"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Entries() = %v, want %v", got, want)
+	}
+
+	if _, err := p.NewIpset("TRI-v4-test", "bitmap:port", nil); err == nil {
+		t.Errorf("NewIpset() with a different type should fail")
+	}
+
+	if err := p.DestroyAll("TRI-"); err != nil {
+		t.Fatalf("DestroyAll() error = %v", err)
+	}
+
+	if names, _ := p.ListIPSets(); len(names) != 0 {
+		t.Errorf("ListIPSets() = %v, want none", names)
+	}
+
+	if err := set.Add("10.0.0.0/8", 0); err == nil {
+		t.Errorf("Add() on a destroyed set should fail")
+	}
+}
+
+func Test_handler_UpdateIPsetsForTargetAndExcludedNetworks(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		initial     []string
+		updated     []string
+		wantEntries []string
+	}{
+		{
+			name:        "default route",
+			updated:     []string{IPv4DefaultIP},
+			wantEntries: []string{"0.0.0.0/1", "128.0.0.0/1"},
+		},
+		{
+			name:        "nomatch replaces a match",
+			initial:     []string{"10.0.0.0/8", "10.1.0.0/16"},
+			updated:     []string{"10.0.0.0/8", "!10.1.0.0/16"},
+			wantEntries: []string{"!10.1.0.0/16", "10.0.0.0/8"},
+		},
+		{
+			name:        "ipv6 networks are filtered",
+			initial:     []string{"10.0.0.0/8"},
+			updated:     []string{"20.0.0.0/8", "2001:db8::/32"},
+			wantEntries: []string{"20.0.0.0/8"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewMemoryIpsetProvider()
+			ipHandler := NewWithProvider(IPsetV4, p)
+
+			if err := ipHandler.CreateIPsetsForTargetAndExcludedNetworks(); err != nil {
+				t.Fatalf("CreateIPsetsForTargetAndExcludedNetworks() error = %v", err)
+			}
+
+			if err := ipHandler.UpdateIPsetsForTargetAndExcludedNetworks(tt.initial, nil, nil); err != nil {
+				t.Fatalf("UpdateIPsetsForTargetAndExcludedNetworks() error = %v", err)
+			}
+
+			if err := ipHandler.UpdateIPsetsForTargetAndExcludedNetworks(tt.updated, nil, nil); err != nil {
+				t.Fatalf("UpdateIPsetsForTargetAndExcludedNetworks() error = %v", err)
+			}
+
+			tcp, _, _ := ipHandler.GetIPsetNamesForTargetAndExcludedNetworks()
+			if got, _ := p.Entries(tcp); !reflect.DeepEqual(got, tt.wantEntries) {
+				t.Errorf("Entries() = %v, want %v", got, tt.wantEntries)
+			}
+		})
+	}
+}
+
+func Test_addToIPsetBatch(t *testing.T) {
+
+	p := NewMemoryIpsetProvider()
+
+	set, err := p.NewIpset("TRI-v4-test", "hash:net", nil)
+	if err != nil {
+		t.Fatalf("NewIpset() error = %v", err)
+	}
+
+	err = addToIPsetBatch(set, []string{IPv4DefaultIP, "10.0.0.0/33", "!10.1.0.0/16", "20.0.0.1"})
+	batchErr, ok := err.(*BatchError)
+	if !ok {
+		t.Fatalf("addToIPsetBatch() error = %v, want a *BatchError", err)
+	}
+
+	if _, ok := batchErr.Failed["10.0.0.0/33"]; !ok || len(batchErr.Failed) != 1 {
+		t.Errorf("Failed = %v, want only 10.0.0.0/33", batchErr.Failed)
+	}
+
+	want := []string{"!10.1.0.0/16", "0.0.0.0/1", "128.0.0.0/1", "20.0.0.1"}
+	if got, _ := p.Entries("TRI-v4-test"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Entries() = %v, want %v", got, want)
+	}
+
+	err = delFromIPsetBatch(set, []string{IPv4DefaultIP, "!10.1.0.0/16", "20.0.0.1"})
+	if err != nil {
+		t.Fatalf("delFromIPsetBatch() error = %v", err)
+	}
+
+	if got, _ := p.Entries("TRI-v4-test"); len(got) != 0 {
+		t.Errorf("Entries() = %v, want none", got)
+	}
+}
+
+func Test_handler_UpdateACLIPsets(t *testing.T) {
+
+	p := NewMemoryIpsetProvider()
+	ipHandler := NewWithProvider(IPsetV6, p).(*handler)
+
+	set, err := ipHandler.createACLIPset(service)
+	if err != nil {
+		t.Fatalf("createACLIPset() error = %v", err)
+	}
+
+	ipHandler.UpdateACLIPsets([]string{"2001:db8::1", "2001:db8::/129", "2001:db8::2"}, service)
+
+	wantAddresses := map[string]bool{"2001:db8::1": true, "2001:db8::2": true}
+	if !reflect.DeepEqual(set.addresses, wantAddresses) {
+		t.Errorf("addresses = %v, want %v", set.addresses, wantAddresses)
+	}
+
+	want := []string{"2001:db8::1", "2001:db8::2"}
+	if got, _ := p.Entries(set.name); !reflect.DeepEqual(got, want) {
+		t.Errorf("Entries() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,506 @@
+// +build linux
+
+package ipsetmanager
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+// The constants of the ipset netlink protocol as defined in
+// include/uapi/linux/netfilter/ipset/ip_set.h.
+const (
+	nfnlSubsysIPSet = 6
+	nfnetlinkV0     = 0
+
+	ipsetProtocol = 6
+
+	ipsetCmdProtocol = 1
+	ipsetCmdCreate   = 2
+	ipsetCmdDestroy  = 3
+	ipsetCmdFlush    = 4
+	ipsetCmdList     = 7
+	ipsetCmdAdd      = 9
+	ipsetCmdDel      = 10
+	ipsetCmdTest     = 11
+	ipsetCmdType     = 13
+
+	// Command level attributes
+	ipsetAttrProtocol    = 1
+	ipsetAttrSetName     = 2
+	ipsetAttrTypeName    = 3
+	ipsetAttrRevision    = 4
+	ipsetAttrFamily      = 5
+	ipsetAttrFlags       = 6
+	ipsetAttrData        = 7
+	ipsetAttrADT         = 8
+	ipsetAttrLineNo      = 9
+	ipsetAttrRevisionMin = 10
+
+	// Data attributes
+	ipsetAttrIP        = 1
+	ipsetAttrCIDR      = 3
+	ipsetAttrPort      = 4
+	ipsetAttrPortTo    = 5
+	ipsetAttrTimeout   = 6
+	ipsetAttrProto     = 7
+	ipsetAttrCadtFlags = 8
+
+	// IP address attributes
+	ipsetAttrIPAddrIPv4 = 1
+	ipsetAttrIPAddrIPv6 = 2
+
+	// ipsetFlagExist makes the kernel ignore the entries that are already
+	// in the set on add, and the entries that are missing on del.
+	ipsetFlagExist       = 1 << 0
+	ipsetFlagListSetName = 1 << 1
+	ipsetFlagNomatch     = 1 << 2
+
+	ipsetErrProtocol = 4097
+	ipsetErrFindType = 4098
+	ipsetErrExist    = 4103
+
+	nlaFNested       = 0x8000
+	nlaFNetByteOrder = 0x4000
+	nlaHdrLen        = 4
+
+	nfprotoUnspec = 0
+	nfprotoIPv4   = 2
+	nfprotoIPv6   = 10
+
+	// maxBatchEntries is the maximum number of entries sent in one message.
+	maxBatchEntries = 256
+)
+
+var nativeEndian binary.ByteOrder
+
+func init() {
+	i := uint16(1)
+	if (*[2]byte)(unsafe.Pointer(&i))[0] == 1 {
+		nativeEndian = binary.LittleEndian
+	} else {
+		nativeEndian = binary.BigEndian
+	}
+}
+
+// ipsetError is an error returned by the kernel for an ipset request.
+type ipsetError struct {
+	errno int
+}
+
+func (e *ipsetError) Error() string {
+
+	switch e.errno {
+	case ipsetErrProtocol:
+		return "kernel error received: ipset protocol error"
+	case ipsetErrFindType:
+		return "kernel error received: set type not supported"
+	case ipsetErrExist:
+		return "kernel error received: element exists or is missing"
+	case int(syscall.ENOENT):
+		return "kernel error received: the set does not exist"
+	}
+
+	if e.errno < 4096 {
+		return fmt.Sprintf("kernel error received: %s", syscall.Errno(e.errno))
+	}
+
+	return fmt.Sprintf("kernel error received: ipset error %d", e.errno)
+}
+
+func nlaAlign(l int) int {
+	return (l + 3) &^ 3
+}
+
+// nlAttr encodes a netlink attribute.
+func nlAttr(typ uint16, data []byte) []byte {
+
+	l := nlaHdrLen + len(data)
+	b := make([]byte, nlaAlign(l))
+	nativeEndian.PutUint16(b[0:2], uint16(l))
+	nativeEndian.PutUint16(b[2:4], typ)
+	copy(b[nlaHdrLen:], data)
+
+	return b
+}
+
+func nlAttrNested(typ uint16, children ...[]byte) []byte {
+	return nlAttr(typ|nlaFNested, bytes.Join(children, nil))
+}
+
+func nlAttrU8(typ uint16, v uint8) []byte {
+	return nlAttr(typ, []byte{v})
+}
+
+func nlAttrU32(typ uint16, v uint32) []byte {
+	b := make([]byte, 4)
+	nativeEndian.PutUint32(b, v)
+	return nlAttr(typ, b)
+}
+
+func nlAttrString(typ uint16, s string) []byte {
+	return nlAttr(typ, append([]byte(s), 0))
+}
+
+func nlAttrBE16(typ uint16, v uint16) []byte {
+	b := make([]byte, 2)
+	binary.BigEndian.PutUint16(b, v)
+	return nlAttr(typ|nlaFNetByteOrder, b)
+}
+
+func nlAttrBE32(typ uint16, v uint32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, v)
+	return nlAttr(typ|nlaFNetByteOrder, b)
+}
+
+// parseAttrs parses a buffer of netlink attributes. The nested and byte
+// order flags are removed from the types.
+func parseAttrs(b []byte) (map[uint16][]byte, error) {
+
+	attrs := map[uint16][]byte{}
+
+	for len(b) >= nlaHdrLen {
+		l := int(nativeEndian.Uint16(b[0:2]))
+		typ := nativeEndian.Uint16(b[2:4]) &^ (nlaFNested | nlaFNetByteOrder)
+		if l < nlaHdrLen || l > len(b) {
+			return nil, fmt.Errorf("invalid attribute length %d", l)
+		}
+		attrs[typ] = b[nlaHdrLen:l]
+		if nlaAlign(l) >= len(b) {
+			break
+		}
+		b = b[nlaAlign(l):]
+	}
+
+	return attrs, nil
+}
+
+// ipsetMessage builds the payload of an ipset command. The payload
+// starts with the nfgenmsg header followed by the protocol attribute.
+func ipsetMessage(family uint8, attrs ...[]byte) []byte {
+
+	b := []byte{family, nfnetlinkV0, 0, 0}
+	b = append(b, nlAttrU8(ipsetAttrProtocol, ipsetProtocol)...)
+	for _, a := range attrs {
+		b = append(b, a...)
+	}
+
+	return b
+}
+
+// ipsetEntryAttrs encodes an entry in the ipset command line format as
+// data attributes. The supported formats are ip, ip/cidr, port, port-port
+// and ip[/cidr],[proto:]port.
+func ipsetEntryAttrs(entry string) ([][]byte, error) {
+
+	if entry == "" {
+		return nil, fmt.Errorf("empty entry")
+	}
+
+	if strings.Contains(entry, ",") {
+		parts := strings.SplitN(entry, ",", 2)
+
+		attrs, err := ipsetAddressAttrs(parts[0])
+		if err != nil {
+			return nil, err
+		}
+
+		proto := uint8(syscall.IPPROTO_TCP)
+		port := parts[1]
+		if i := strings.Index(port, ":"); i >= 0 {
+			switch strings.ToLower(port[:i]) {
+			case "tcp":
+			case "udp":
+				proto = syscall.IPPROTO_UDP
+			default:
+				return nil, fmt.Errorf("unsupported protocol in entry %s", entry)
+			}
+			port = port[i+1:]
+		}
+
+		portAttrs, err := ipsetPortAttrs(port)
+		if err != nil {
+			return nil, err
+		}
+
+		attrs = append(attrs, portAttrs...)
+		return append(attrs, nlAttrU8(ipsetAttrProto, proto)), nil
+	}
+
+	if strings.Contains(entry, ".") || strings.Contains(entry, ":") {
+		return ipsetAddressAttrs(entry)
+	}
+
+	return ipsetPortAttrs(entry)
+}
+
+func ipsetAddressAttrs(address string) ([][]byte, error) {
+
+	var ip net.IP
+	cidr := -1
+
+	if strings.Contains(address, "/") {
+		addr, ipnet, err := net.ParseCIDR(address)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network %s: %s", address, err)
+		}
+		ip = addr.Mask(ipnet.Mask)
+		cidr, _ = ipnet.Mask.Size()
+	} else {
+		if ip = net.ParseIP(address); ip == nil {
+			return nil, fmt.Errorf("invalid ip address %s", address)
+		}
+	}
+
+	var ipAttr []byte
+	if ip4 := ip.To4(); ip4 != nil {
+		ipAttr = nlAttr(ipsetAttrIPAddrIPv4|nlaFNetByteOrder, ip4)
+	} else {
+		ipAttr = nlAttr(ipsetAttrIPAddrIPv6|nlaFNetByteOrder, ip.To16())
+	}
+
+	attrs := [][]byte{nlAttrNested(ipsetAttrIP, ipAttr)}
+	if cidr >= 0 {
+		attrs = append(attrs, nlAttrU8(ipsetAttrCIDR, uint8(cidr)))
+	}
+
+	return attrs, nil
+}
+
+func ipsetPortAttrs(port string) ([][]byte, error) {
+
+	parsePort := func(s string) (uint16, error) {
+		p, err := strconv.ParseUint(s, 10, 16)
+		if err != nil {
+			return 0, fmt.Errorf("invalid port %s", s)
+		}
+		return uint16(p), nil
+	}
+
+	parts := strings.SplitN(port, "-", 2)
+
+	from, err := parsePort(parts[0])
+	if err != nil {
+		return nil, err
+	}
+
+	attrs := [][]byte{nlAttrBE16(ipsetAttrPort, from)}
+
+	if len(parts) == 2 {
+		to, err := parsePort(parts[1])
+		if err != nil {
+			return nil, err
+		}
+		attrs = append(attrs, nlAttrBE16(ipsetAttrPortTo, to))
+	}
+
+	return attrs, nil
+}
+
+// ipsetDataAttr encodes the data attribute of an entry.
+func ipsetDataAttr(entry string, nomatch bool, timeout int) ([]byte, error) {
+
+	attrs, err := ipsetEntryAttrs(entry)
+	if err != nil {
+		return nil, err
+	}
+
+	if timeout > 0 {
+		attrs = append(attrs, nlAttrBE32(ipsetAttrTimeout, uint32(timeout)))
+	}
+
+	if nomatch {
+		attrs = append(attrs, nlAttrBE32(ipsetAttrCadtFlags, ipsetFlagNomatch))
+	}
+
+	return nlAttrNested(ipsetAttrData, attrs...), nil
+}
+
+// nlConn is a netlink netfilter socket. Requests are serialized.
+type nlConn struct {
+	fd  int
+	seq uint32
+	sync.Mutex
+}
+
+func newNLConn() (*nlConn, error) {
+
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, syscall.NETLINK_NETFILTER)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open netlink socket: %s", err)
+	}
+
+	if err := syscall.Bind(fd, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+		syscall.Close(fd) // nolint: errcheck
+		return nil, fmt.Errorf("unable to bind netlink socket: %s", err)
+	}
+
+	return &nlConn{fd: fd}, nil
+}
+
+func (c *nlConn) close() error {
+	return syscall.Close(c.fd)
+}
+
+// request sends all the ipset commands of cmd in one write and waits for
+// all the acknowledgements. The data messages received before the
+// acknowledgements are returned. The first error is returned.
+func (c *nlConn) request(cmd int, dump bool, payloads ...[]byte) ([][]byte, error) {
+
+	data, errs, err := c.exchange(cmd, dump, payloads...)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, err := range errs {
+		if err != nil {
+			return data, err
+		}
+	}
+
+	return data, nil
+}
+
+// exchange sends all the ipset commands of cmd in one write and waits for
+// all the acknowledgements. The data messages received before the
+// acknowledgements are returned with the error of each command. The
+// requests never carry NLM_F_EXCL, so that the kernel accepts the
+// existing sets and entries when asked to.
+func (c *nlConn) exchange(cmd int, dump bool, payloads ...[]byte) ([][]byte, []error, error) {
+
+	c.Lock()
+	defer c.Unlock()
+
+	flags := syscall.NLM_F_REQUEST | syscall.NLM_F_ACK
+	if dump {
+		flags |= syscall.NLM_F_DUMP
+	}
+
+	buf := bytes.NewBuffer([]byte{})
+	pending := map[uint32]int{}
+
+	for i, payload := range payloads {
+		c.seq++
+		hdr := make([]byte, syscall.NLMSG_HDRLEN)
+		nativeEndian.PutUint32(hdr[0:4], uint32(syscall.NLMSG_HDRLEN+len(payload)))
+		nativeEndian.PutUint16(hdr[4:6], uint16(nfnlSubsysIPSet<<8|cmd))
+		nativeEndian.PutUint16(hdr[6:8], uint16(flags))
+		nativeEndian.PutUint32(hdr[8:12], c.seq)
+		buf.Write(hdr)     // nolint: errcheck
+		buf.Write(payload) // nolint: errcheck
+		if pad := nlaAlign(len(payload)) - len(payload); pad > 0 {
+			buf.Write(make([]byte, pad)) // nolint: errcheck
+		}
+		pending[c.seq] = i
+	}
+
+	if err := syscall.Sendto(c.fd, buf.Bytes(), 0, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+		return nil, nil, fmt.Errorf("unable to send netlink request: %s", err)
+	}
+
+	var data [][]byte
+	errs := make([]error, len(payloads))
+	rb := make([]byte, 1<<16)
+
+	for len(pending) > 0 {
+		n, _, err := syscall.Recvfrom(c.fd, rb, 0)
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to receive netlink response: %s", err)
+		}
+
+		msgs, err := syscall.ParseNetlinkMessage(rb[:n])
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to parse netlink response: %s", err)
+		}
+
+		for _, m := range msgs {
+			i, ok := pending[m.Header.Seq]
+			if !ok {
+				continue
+			}
+
+			switch m.Header.Type {
+			case syscall.NLMSG_ERROR:
+				if len(m.Data) < 4 {
+					return nil, nil, fmt.Errorf("short netlink error message")
+				}
+				if errno := -int32(nativeEndian.Uint32(m.Data[0:4])); errno != 0 {
+					errs[i] = &ipsetError{errno: int(errno)}
+				}
+				delete(pending, m.Header.Seq)
+			case syscall.NLMSG_DONE:
+				delete(pending, m.Header.Seq)
+			default:
+				data = append(data, append([]byte{}, m.Data...))
+			}
+		}
+	}
+
+	return data, errs, nil
+}
+
+// typeRevision returns the highest revision of a set type supported by
+// the kernel.
+func (c *nlConn) typeRevision(typeName string, family uint8) (uint8, error) {
+
+	data, err := c.request(ipsetCmdType, false, ipsetMessage(family,
+		nlAttrString(ipsetAttrTypeName, typeName),
+		nlAttrU8(ipsetAttrFamily, family),
+	))
+	if err != nil {
+		return 0, err
+	}
+
+	for _, d := range data {
+		if len(d) < 4 {
+			continue
+		}
+		attrs, err := parseAttrs(d[4:])
+		if err != nil {
+			return 0, err
+		}
+		if rev, ok := attrs[ipsetAttrRevision]; ok && len(rev) > 0 {
+			return rev[0], nil
+		}
+	}
+
+	return 0, fmt.Errorf("unable to find revision of set type %s", typeName)
+}
+
+// setNames returns the names of all the sets.
+func (c *nlConn) setNames() ([]string, error) {
+
+	data, err := c.request(ipsetCmdList, true, ipsetMessage(nfprotoUnspec,
+		nlAttrBE32(ipsetAttrFlags, ipsetFlagListSetName),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	seen := map[string]bool{}
+	for _, d := range data {
+		if len(d) < 4 {
+			continue
+		}
+		attrs, err := parseAttrs(d[4:])
+		if err != nil {
+			return nil, err
+		}
+		name := strings.TrimRight(string(attrs[ipsetAttrSetName]), "\x00")
+		if name != "" && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+
+	return names, nil
+}
@@ -0,0 +1,171 @@
+// +build linux
+
+package ipsetmanager
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+func Test_ipsetEntryAttrs(t *testing.T) {
+
+	ipv4 := func(a, b, c, d byte) []byte {
+		return nlAttrNested(ipsetAttrIP, nlAttr(ipsetAttrIPAddrIPv4|nlaFNetByteOrder, []byte{a, b, c, d}))
+	}
+
+	tests := []struct {
+		name    string
+		entry   string
+		want    [][]byte
+		wantErr bool
+	}{
+		{
+			name:  "ipv4 address",
+			entry: "10.1.1.1",
+			want:  [][]byte{ipv4(10, 1, 1, 1)},
+		},
+		{
+			name:  "ipv4 network is masked",
+			entry: "10.1.1.1/24",
+			want:  [][]byte{ipv4(10, 1, 1, 0), nlAttrU8(ipsetAttrCIDR, 24)},
+		},
+		{
+			name:  "ipv6 network",
+			entry: "::/1",
+			want: [][]byte{
+				nlAttrNested(ipsetAttrIP, nlAttr(ipsetAttrIPAddrIPv6|nlaFNetByteOrder, make([]byte, 16))),
+				nlAttrU8(ipsetAttrCIDR, 1),
+			},
+		},
+		{
+			name:  "port",
+			entry: "8080",
+			want:  [][]byte{nlAttrBE16(ipsetAttrPort, 8080)},
+		},
+		{
+			name:  "port range",
+			entry: "80-90",
+			want:  [][]byte{nlAttrBE16(ipsetAttrPort, 80), nlAttrBE16(ipsetAttrPortTo, 90)},
+		},
+		{
+			name:  "network and port defaults to tcp",
+			entry: "10.1.1.1,443",
+			want:  [][]byte{ipv4(10, 1, 1, 1), nlAttrBE16(ipsetAttrPort, 443), nlAttrU8(ipsetAttrProto, 6)},
+		},
+		{
+			name:  "network and udp port",
+			entry: "10.1.1.0/24,udp:53",
+			want: [][]byte{
+				ipv4(10, 1, 1, 0),
+				nlAttrU8(ipsetAttrCIDR, 24),
+				nlAttrBE16(ipsetAttrPort, 53),
+				nlAttrU8(ipsetAttrProto, 17),
+			},
+		},
+		{
+			name:    "empty entry",
+			entry:   "",
+			wantErr: true,
+		},
+		{
+			name:    "invalid address",
+			entry:   "10.1.1",
+			wantErr: true,
+		},
+		{
+			name:    "invalid port",
+			entry:   "70000",
+			wantErr: true,
+		},
+		{
+			name:    "invalid protocol",
+			entry:   "10.1.1.1,sctp:80",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ipsetEntryAttrs(tt.entry)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ipsetEntryAttrs() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ipsetEntryAttrs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_nlAttr(t *testing.T) {
+
+	tests := []struct {
+		name string
+		attr []byte
+		want []byte
+	}{
+		{
+			name: "u8 is padded",
+			attr: nlAttrU8(ipsetAttrProtocol, ipsetProtocol),
+			want: []byte{5, 0, 1, 0, 6, 0, 0, 0},
+		},
+		{
+			name: "string is null terminated",
+			attr: nlAttrString(ipsetAttrSetName, "abc"),
+			want: []byte{8, 0, 2, 0, 'a', 'b', 'c', 0},
+		},
+		{
+			name: "be32 is in network order",
+			attr: nlAttrBE32(ipsetAttrTimeout, 1),
+			want: []byte{8, 0, 6, 0x40, 0, 0, 0, 1},
+		},
+		{
+			name: "nested",
+			attr: nlAttrNested(ipsetAttrData, nlAttrU8(ipsetAttrCIDR, 8)),
+			want: []byte{12, 0, 7, 0x80, 5, 0, 3, 0, 8, 0, 0, 0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The expected values are written in little endian.
+			if nativeEndian != binary.LittleEndian {
+				t.Skip("big endian host")
+			}
+			if !bytes.Equal(tt.attr, tt.want) {
+				t.Errorf("nlAttr() = %v, want %v", tt.attr, tt.want)
+			}
+		})
+	}
+}
+
+func Test_parseAttrs(t *testing.T) {
+
+	b := bytes.Join([][]byte{
+		nlAttrString(ipsetAttrSetName, "set"),
+		nlAttrU8(ipsetAttrRevision, 3),
+		nlAttrNested(ipsetAttrData, nlAttrU8(ipsetAttrCIDR, 8)),
+	}, nil)
+
+	attrs, err := parseAttrs(b)
+	if err != nil {
+		t.Fatalf("parseAttrs() error = %v", err)
+	}
+
+	if got := string(attrs[ipsetAttrSetName]); got != "set\x00" {
+		t.Errorf("parseAttrs() setname = %q", got)
+	}
+
+	if got := attrs[ipsetAttrRevision]; !bytes.Equal(got, []byte{3}) {
+		t.Errorf("parseAttrs() revision = %v", got)
+	}
+
+	if got := attrs[ipsetAttrData]; !bytes.Equal(got, nlAttrU8(ipsetAttrCIDR, 8)) {
+		t.Errorf("parseAttrs() data = %v", got)
+	}
+
+	if _, err := parseAttrs([]byte{2, 0, 1, 0}); err == nil {
+		t.Errorf("parseAttrs() expected an error for an invalid length")
+	}
+}
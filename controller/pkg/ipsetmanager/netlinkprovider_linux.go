@@ -0,0 +1,369 @@
+// +build linux
+
+package ipsetmanager
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/aporeto-inc/go-ipset/ipset"
+	"go.uber.org/zap"
+)
+
+type netlinkIpsetProvider struct {
+	conn      *nlConn
+	revisions map[string]uint8
+	sync.Mutex
+}
+
+// NewNetlinkIpsetProvider returns an IpsetProvider that programs the sets
+// directly through the ipset netlink protocol instead of executing the
+// ipset binary.
+func NewNetlinkIpsetProvider() (IpsetProvider, error) {
+
+	conn, err := newNLConn()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := conn.request(ipsetCmdProtocol, false, ipsetMessage(nfprotoUnspec)); err != nil {
+		conn.close() // nolint: errcheck
+		return nil, fmt.Errorf("ipset netlink protocol not supported: %s", err)
+	}
+
+	return &netlinkIpsetProvider{
+		conn:      conn,
+		revisions: map[string]uint8{},
+	}, nil
+}
+
+// setDefaultProvider switches the ipset provider used by the package to
+// the netlink implementation when the kernel supports it. The ipset
+// binary is used otherwise. A provider set with SetIpsetTestInstance is
+// kept.
+func setDefaultProvider() {
+
+	if _, ok := instance.(*goIpsetProvider); !ok {
+		return
+	}
+
+	p, err := NewNetlinkIpsetProvider()
+	if err != nil {
+		zap.L().Warn("Unable to use the ipset netlink protocol. Falling back to the ipset binary", zap.Error(err))
+		return
+	}
+
+	instance = p
+}
+
+func (p *netlinkIpsetProvider) revision(typeName string, family uint8) (uint8, error) {
+
+	p.Lock()
+	defer p.Unlock()
+
+	key := fmt.Sprintf("%s/%d", typeName, family)
+	if rev, ok := p.revisions[key]; ok {
+		return rev, nil
+	}
+
+	rev, err := p.conn.typeRevision(typeName, family)
+	if err != nil {
+		return 0, err
+	}
+
+	p.revisions[key] = rev
+	return rev, nil
+}
+
+// NewIpset creates a new set. The request does not carry NLM_F_EXCL, so
+// the kernel accepts a set that already exists with the same name and
+// type instead of failing with EEXIST. That set is flushed. A set that
+// already exists with another type is an error.
+func (p *netlinkIpsetProvider) NewIpset(name string, ipsetType string, params *ipset.Params) (Ipset, error) {
+
+	family := uint8(nfprotoIPv4)
+	if params != nil && params.HashFamily == "inet6" {
+		family = nfprotoIPv6
+	}
+
+	var data [][]byte
+	if !strings.HasPrefix(ipsetType, "hash:") {
+		family = nfprotoUnspec
+		data = append(data,
+			nlAttrBE16(ipsetAttrPort, 0),
+			nlAttrBE16(ipsetAttrPortTo, 65535),
+			nlAttrBE32(ipsetAttrTimeout, 0),
+		)
+	}
+
+	rev, err := p.revision(ipsetType, family)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create set %s: %s", name, err)
+	}
+
+	if _, err := p.conn.request(ipsetCmdCreate, false, ipsetMessage(family,
+		nlAttrString(ipsetAttrSetName, name),
+		nlAttrString(ipsetAttrTypeName, ipsetType),
+		nlAttrU8(ipsetAttrRevision, rev),
+		nlAttrU8(ipsetAttrFamily, family),
+		nlAttrNested(ipsetAttrData, data...),
+	)); err != nil {
+		return nil, fmt.Errorf("unable to create set %s: %s", name, err)
+	}
+
+	set := &netlinkIpset{name: name, family: family, conn: p.conn}
+	if err := set.Flush(); err != nil {
+		return nil, err
+	}
+
+	return set, nil
+}
+
+// GetIpset gets the ipset object from the name.
+func (p *netlinkIpsetProvider) GetIpset(name string) Ipset {
+	return &netlinkIpset{name: name, family: nfprotoUnspec, conn: p.conn}
+}
+
+// DestroyAll destroys all the ipsets with the given prefix
+func (p *netlinkIpsetProvider) DestroyAll(prefix string) error {
+
+	names, err := p.conn.setNames()
+	if err != nil {
+		return fmt.Errorf("unable to list ipsets: %s", err)
+	}
+
+	var lastErr error
+	for _, name := range names {
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		if err := p.GetIpset(name).Destroy(); err != nil {
+			lastErr = err
+		}
+	}
+
+	return lastErr
+}
+
+// ListIPSets returns the names of all the ipsets.
+func (p *netlinkIpsetProvider) ListIPSets() ([]string, error) {
+
+	names, err := p.conn.setNames()
+	if err != nil {
+		return nil, fmt.Errorf("unable to list ipsets:%s", err)
+	}
+
+	return names, nil
+}
+
+// netlinkIpset implements BatchIpset over the ipset netlink protocol.
+type netlinkIpset struct {
+	name   string
+	family uint8
+	conn   *nlConn
+}
+
+func (s *netlinkIpset) Add(entry string, timeout int) error {
+	return entryError(entry, s.AddBatch([]string{entry}, nil, timeout))
+}
+
+func (s *netlinkIpset) AddOption(entry string, option string, timeout int) error {
+
+	if option != "nomatch" {
+		return fmt.Errorf("unsupported option %s", option)
+	}
+
+	return entryError(entry, s.AddBatch(nil, []string{entry}, timeout))
+}
+
+func (s *netlinkIpset) Del(entry string) error {
+	return entryError(entry, s.DelBatch([]string{entry}))
+}
+
+func (s *netlinkIpset) Destroy() error {
+
+	if _, err := s.conn.request(ipsetCmdDestroy, false, ipsetMessage(nfprotoUnspec,
+		nlAttrString(ipsetAttrSetName, s.name),
+	)); err != nil {
+		return fmt.Errorf("unable to destroy set %s: %s", s.name, err)
+	}
+
+	return nil
+}
+
+func (s *netlinkIpset) Flush() error {
+
+	if _, err := s.conn.request(ipsetCmdFlush, false, ipsetMessage(nfprotoUnspec,
+		nlAttrString(ipsetAttrSetName, s.name),
+	)); err != nil {
+		return fmt.Errorf("unable to flush set %s: %s", s.name, err)
+	}
+
+	return nil
+}
+
+func (s *netlinkIpset) Test(entry string) (bool, error) {
+
+	data, err := ipsetDataAttr(entry, false, 0)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = s.conn.request(ipsetCmdTest, false, ipsetMessage(s.family,
+		nlAttrString(ipsetAttrSetName, s.name),
+		data,
+	))
+
+	if ipsetErr, ok := err.(*ipsetError); ok && ipsetErr.errno == ipsetErrExist {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, fmt.Errorf("unable to test entry %s in set %s: %s", entry, s.name, err)
+	}
+
+	return true, nil
+}
+
+// AddBatch adds all the entries to the set. The entries in nomatch are
+// added with the nomatch option. The entries already in the set are not
+// errors.
+func (s *netlinkIpset) AddBatch(entries []string, nomatch []string, timeout int) error {
+
+	b := newNetlinkBatch(len(entries) + len(nomatch))
+
+	for _, entry := range entries {
+		b.add(entry, false, timeout)
+	}
+
+	for _, entry := range nomatch {
+		b.add(entry, true, timeout)
+	}
+
+	return s.batch(ipsetCmdAdd, b, "unable to add entry to set")
+}
+
+// DelBatch deletes all the entries from the set. The entries missing from
+// the set are not errors.
+func (s *netlinkIpset) DelBatch(entries []string) error {
+
+	b := newNetlinkBatch(len(entries))
+
+	for _, entry := range entries {
+		b.add(entry, false, 0)
+	}
+
+	return s.batch(ipsetCmdDel, b, "unable to delete entry from set")
+}
+
+// netlinkBatch holds the data attributes of the entries of a batch update
+// and the entries that could not be encoded.
+type netlinkBatch struct {
+	entries []string
+	data    [][]byte
+	failed  map[string]error
+}
+
+func newNetlinkBatch(size int) *netlinkBatch {
+	return &netlinkBatch{
+		entries: make([]string, 0, size),
+		data:    make([][]byte, 0, size),
+		failed:  map[string]error{},
+	}
+}
+
+func (b *netlinkBatch) add(entry string, nomatch bool, timeout int) {
+
+	d, err := ipsetDataAttr(entry, nomatch, timeout)
+	if err != nil {
+		b.failed[entry] = err
+		return
+	}
+
+	b.entries = append(b.entries, entry)
+	b.data = append(b.data, d)
+}
+
+// batch sends the data attributes in messages of at most maxBatchEntries
+// entries. All the messages are sent in one write. The kernel requires a
+// line number with a list of entries, and stops at the first entry that
+// fails. The entries of a failed message are then sent again in one
+// message each to find the ones that failed. This is safe because the
+// messages carry IPSET_FLAG_EXIST.
+func (s *netlinkIpset) batch(cmd int, b *netlinkBatch, msg string) error {
+
+	if len(b.data) > 0 {
+		payloads := [][]byte{}
+		for start := 0; start < len(b.data); start += maxBatchEntries {
+			end := start + maxBatchEntries
+			if end > len(b.data) {
+				end = len(b.data)
+			}
+
+			payloads = append(payloads, ipsetMessage(s.family,
+				nlAttrString(ipsetAttrSetName, s.name),
+				nlAttrBE32(ipsetAttrFlags, ipsetFlagExist),
+				nlAttrU32(ipsetAttrLineNo, 0),
+				nlAttrNested(ipsetAttrADT, b.data[start:end]...),
+			))
+		}
+
+		_, errs, err := s.conn.exchange(cmd, false, payloads...)
+		if err != nil {
+			return fmt.Errorf("%s %s: %s", msg, s.name, err)
+		}
+
+		var retry []int
+		for i, err := range errs {
+			if err == nil {
+				continue
+			}
+
+			for j := i * maxBatchEntries; j < len(b.data) && j < (i+1)*maxBatchEntries; j++ {
+				retry = append(retry, j)
+			}
+		}
+
+		if err := s.retry(cmd, b, retry, msg); err != nil {
+			return err
+		}
+	}
+
+	if len(b.failed) > 0 {
+		return &BatchError{Failed: b.failed}
+	}
+
+	return nil
+}
+
+// retry sends the given entries of the batch in one message each and
+// records the entries that fail.
+func (s *netlinkIpset) retry(cmd int, b *netlinkBatch, indexes []int, msg string) error {
+
+	if len(indexes) == 0 {
+		return nil
+	}
+
+	payloads := make([][]byte, 0, len(indexes))
+	for _, i := range indexes {
+		payloads = append(payloads, ipsetMessage(s.family,
+			nlAttrString(ipsetAttrSetName, s.name),
+			nlAttrBE32(ipsetAttrFlags, ipsetFlagExist),
+			b.data[i],
+		))
+	}
+
+	_, errs, err := s.conn.exchange(cmd, false, payloads...)
+	if err != nil {
+		return fmt.Errorf("%s %s: %s", msg, s.name, err)
+	}
+
+	for k, err := range errs {
+		if err != nil {
+			b.failed[b.entries[indexes[k]]] = fmt.Errorf("%s %s: %s", msg, s.name, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,147 @@
+// +build linux
+
+package ipsetmanager
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/aporeto-inc/go-ipset/ipset"
+)
+
+const benchmarkSet = "TRI-bench"
+
+func benchmarkEntries(n int) []string {
+
+	entries := make([]string, n)
+	for i := range entries {
+		entries[i] = fmt.Sprintf("10.%d.%d.%d", i>>16&0xff, i>>8&0xff, i&0xff)
+	}
+
+	return entries
+}
+
+func netlinkBenchmarkProvider(b *testing.B) IpsetProvider {
+
+	if os.Geteuid() != 0 {
+		b.Skip("netlink benchmarks require root")
+	}
+
+	p, err := NewNetlinkIpsetProvider()
+	if err != nil {
+		b.Skipf("ipset netlink not available: %s", err)
+	}
+
+	return p
+}
+
+func TestNetlinkIpsetBatch(t *testing.T) {
+
+	if os.Geteuid() != 0 {
+		t.Skip("netlink tests require root")
+	}
+
+	p, err := NewNetlinkIpsetProvider()
+	if err != nil {
+		t.Skipf("ipset netlink not available: %s", err)
+	}
+
+	set, err := p.NewIpset(benchmarkSet, "hash:net", &ipset.Params{})
+	if err != nil {
+		t.Fatalf("NewIpset() error = %v", err)
+	}
+	defer set.Destroy() // nolint: errcheck
+
+	entries := benchmarkEntries(2 * maxBatchEntries)
+	if err := addToIPsetBatch(set, entries[:10]); err != nil {
+		t.Fatalf("addToIPsetBatch() error = %v", err)
+	}
+
+	// The entries already in the set are not errors, and the entries
+	// that fail do not stop the others.
+	err = addToIPsetBatch(set, append([]string{"2001:db8::1", "10.0.0.0/40"}, entries...))
+	batchErr, ok := err.(*BatchError)
+	if !ok {
+		t.Fatalf("addToIPsetBatch() error = %v, want a *BatchError", err)
+	}
+
+	if len(batchErr.Failed) != 2 || batchErr.Failed["2001:db8::1"] == nil || batchErr.Failed["10.0.0.0/40"] == nil {
+		t.Errorf("Failed = %v, want 2001:db8::1 and 10.0.0.0/40", batchErr.Failed)
+	}
+
+	for _, entry := range []string{entries[0], entries[len(entries)-1]} {
+		if ok, err := set.Test(entry); !ok || err != nil {
+			t.Errorf("Test(%s) = %v, %v, want true", entry, ok, err)
+		}
+	}
+
+	// The entries missing from the set are not errors.
+	if err := delFromIPsetBatch(set, []string{entries[0], "192.0.2.1"}); err != nil {
+		t.Errorf("delFromIPsetBatch() error = %v", err)
+	}
+
+	if _, err := p.NewIpset(benchmarkSet, "hash:net", &ipset.Params{}); err != nil {
+		t.Errorf("NewIpset() of an existing set error = %v", err)
+	}
+
+	if _, err := p.NewIpset(benchmarkSet, "hash:ip", &ipset.Params{}); err == nil {
+		t.Errorf("NewIpset() of an existing set with another type should fail")
+	}
+}
+
+func runAddBenchmark(b *testing.B, p IpsetProvider, entries []string, batch bool) {
+
+	set, err := p.NewIpset(benchmarkSet, "hash:net", &ipset.Params{})
+	if err != nil {
+		b.Fatalf("unable to create set: %s", err)
+	}
+	defer set.Destroy() // nolint: errcheck
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if batch {
+			if err := addToIPsetBatch(set, entries); err != nil {
+				b.Fatal(err)
+			}
+		} else {
+			for _, entry := range entries {
+				if err := addToIPset(set, entry); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+
+		b.StopTimer()
+		if err := set.Flush(); err != nil {
+			b.Fatal(err)
+		}
+		b.StartTimer()
+	}
+}
+
+func BenchmarkAddExec(b *testing.B) {
+
+	if os.Geteuid() != 0 {
+		b.Skip("exec benchmarks require root")
+	}
+
+	SetIPsetPath()
+	if ipsetBinPath == "" {
+		b.Skip("ipset binary not found")
+	}
+
+	runAddBenchmark(b, &goIpsetProvider{}, benchmarkEntries(100), false)
+}
+
+func BenchmarkAddNetlink(b *testing.B) {
+	runAddBenchmark(b, netlinkBenchmarkProvider(b), benchmarkEntries(100), false)
+}
+
+func BenchmarkAddNetlinkBatch(b *testing.B) {
+	runAddBenchmark(b, netlinkBenchmarkProvider(b), benchmarkEntries(100), true)
+}
+
+func BenchmarkAddNetlinkBatchLarge(b *testing.B) {
+	runAddBenchmark(b, netlinkBenchmarkProvider(b), benchmarkEntries(10000), true)
+}
@@ -0,0 +1,235 @@
+package management
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Client is a client of the management API.
+type Client struct {
+	httpc *http.Client
+}
+
+// NewClient returns a client of the management API listening on the given socket.
+func NewClient(socketPath string) *Client {
+
+	if socketPath == "" {
+		socketPath = DefaultSocketPath
+	}
+
+	return &Client{
+		httpc: &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					d := net.Dialer{}
+					return d.DialContext(ctx, "unix", socketPath)
+				},
+				MaxIdleConns:    10,
+				IdleConnTimeout: 10 * time.Second,
+			},
+		},
+	}
+}
+
+// PUs returns the enforced PUs.
+func (c *Client) PUs(ctx context.Context) ([]*PU, error) {
+
+	pus := []*PU{}
+	if err := c.do(ctx, http.MethodGet, "/pus", nil, &pus); err != nil {
+		return nil, err
+	}
+
+	return pus, nil
+}
+
+// PU returns a PU with its runtime and its policy.
+func (c *Client) PU(ctx context.Context, puID string) (*PUDetails, error) {
+
+	pu := &PUDetails{}
+	if err := c.do(ctx, http.MethodGet, puPath(puID), nil, pu); err != nil {
+		return nil, err
+	}
+
+	return pu, nil
+}
+
+// Counters returns the counters of a PU.
+func (c *Client) Counters(ctx context.Context, puID string) (map[string]uint64, error) {
+
+	counters := map[string]uint64{}
+	if err := c.do(ctx, http.MethodGet, puPath(puID)+"/counters", nil, &counters); err != nil {
+		return nil, err
+	}
+
+	return counters, nil
+}
+
+// Connections returns the connections of a PU.
+func (c *Client) Connections(ctx context.Context, puID string) ([]*Connection, error) {
+
+	connections := []*Connection{}
+	if err := c.do(ctx, http.MethodGet, puPath(puID)+"/connections", nil, &connections); err != nil {
+		return nil, err
+	}
+
+	return connections, nil
+}
+
+// Ping starts a ping from a PU and returns its ID.
+func (c *Client) Ping(ctx context.Context, puID string, req *PingRequest) (string, error) {
+
+	resp := &PingResponse{}
+	if err := c.do(ctx, http.MethodPost, puPath(puID)+"/ping", req, resp); err != nil {
+		return "", err
+	}
+
+	return resp.PingID, nil
+}
+
+// PingResult returns the reports received for a ping.
+func (c *Client) PingResult(ctx context.Context, puID string, pingID string) (*PingResult, error) {
+
+	result := &PingResult{}
+	if err := c.do(ctx, http.MethodGet, puPath(puID)+"/ping/"+url.PathEscape(pingID), nil, result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Trace traces the packets of a PU.
+func (c *Client) Trace(ctx context.Context, puID string, req *TraceRequest) error {
+	return c.do(ctx, http.MethodPost, puPath(puID)+"/trace", req, nil)
+}
+
+// DebugCollect collects debug information for a PU.
+func (c *Client) DebugCollect(ctx context.Context, puID string, req *DebugRequest) (*DebugResponse, error) {
+
+	resp := &DebugResponse{}
+	if err := c.do(ctx, http.MethodPost, puPath(puID)+"/debug", req, resp); err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// SetLogLevel changes the log level.
+func (c *Client) SetLogLevel(ctx context.Context, level string) error {
+	return c.do(ctx, http.MethodPut, "/loglevel", &LogLevelRequest{Level: level}, nil)
+}
+
+// Configuration returns the runtime configuration.
+func (c *Client) Configuration(ctx context.Context) (*Configuration, error) {
+
+	cfg := &Configuration{}
+	if err := c.do(ctx, http.MethodGet, "/configuration", nil, cfg); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// UpdateConfiguration updates the runtime configuration.
+func (c *Client) UpdateConfiguration(ctx context.Context, cfg *Configuration) error {
+	return c.do(ctx, http.MethodPut, "/configuration", cfg, nil)
+}
+
+// Flows calls the handler for every flow of a PU, or of all the PUs if the PU
+// ID is empty, until the context is done.
+func (c *Client) Flows(ctx context.Context, puID string, handler func(*Flow)) error {
+
+	path := "/flows"
+	if puID != "" {
+		path += "?pu=" + url.QueryEscape(puID)
+	}
+
+	resp, err := c.send(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close() // nolint: errcheck
+
+	decoder := json.NewDecoder(bufio.NewReader(resp.Body))
+	for {
+		flow := &Flow{}
+		if err := decoder.Decode(flow); err != nil {
+			if ctx.Err() != nil || err == io.EOF {
+				return nil
+			}
+			return fmt.Errorf("unable to read flows: %s", err)
+		}
+		handler(flow)
+	}
+}
+
+// do sends a request and decodes the response in out if it is not nil.
+func (c *Client) do(ctx context.Context, method, path string, in interface{}, out interface{}) error {
+
+	resp, err := c.send(ctx, method, path, in)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close() // nolint: errcheck
+
+	if out == nil {
+		return nil
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("invalid response: %s", err)
+	}
+
+	return nil
+}
+
+// send sends a request and returns the response if it is successful.
+func (c *Client) send(ctx context.Context, method, path string, in interface{}) (*http.Response, error) {
+
+	body := new(bytes.Buffer)
+	if in != nil {
+		if err := json.NewEncoder(body).Encode(in); err != nil {
+			return nil, fmt.Errorf("unable to encode request: %s", err)
+		}
+	}
+
+	req, err := http.NewRequest(method, "http://unix/"+APIVersion+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpc.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("unable to reach the management API: %s", err)
+	}
+
+	if resp.StatusCode >= http.StatusOK && resp.StatusCode < http.StatusMultipleChoices {
+		return resp, nil
+	}
+
+	defer resp.Body.Close() // nolint: errcheck
+
+	apiErr := &Error{}
+	if err := json.NewDecoder(resp.Body).Decode(apiErr); err != nil || apiErr.Error == "" {
+		return nil, fmt.Errorf("request failed: %s", resp.Status)
+	}
+
+	return nil, fmt.Errorf("request failed: %s", apiErr.Error)
+}
+
+// puPath returns the path of a PU.
+func puPath(puID string) string {
+	return "/pus/" + url.PathEscape(puID)
+}
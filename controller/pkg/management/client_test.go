@@ -0,0 +1,107 @@
+// +build linux
+
+package management
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.aporeto.io/enforcerd/trireme-lib/collector"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/mockcontroller"
+)
+
+func TestClient(t *testing.T) {
+	Convey("Given a management server with an enforced PU", t, func() {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		dir, err := ioutil.TempDir("", "management")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir) // nolint: errcheck
+
+		mockTrireme := mockcontroller.NewMockTriremeController(ctrl)
+
+		socket := filepath.Join(dir, "management.sock")
+		s, err := NewServer(socket)
+		So(err, ShouldBeNil)
+		trireme := s.Controller(mockTrireme)
+		col := s.Collector(collector.NewDefaultCollector())
+
+		plc, rt := testPU()
+		mockTrireme.EXPECT().Enforce(gomock.Any(), "/web", plc, rt).Return(nil)
+		So(trireme.Enforce(context.Background(), "/web", plc, rt), ShouldBeNil)
+
+		// Serve as root, the credentials are only available on the sockets
+		// of the UID listener.
+		listener, err := net.Listen("unix", socket)
+		So(err, ShouldBeNil)
+		server := &http.Server{
+			Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				r.RemoteAddr = "0:0:1"
+				s.ServeHTTP(w, r)
+			}),
+		}
+		go server.Serve(listener) // nolint: errcheck
+		defer server.Close()      // nolint: errcheck
+
+		client := NewClient(socket)
+
+		Convey("I should get the PUs", func() {
+			pus, err := client.PUs(context.Background())
+			So(err, ShouldBeNil)
+			So(len(pus), ShouldEqual, 1)
+			So(pus[0].ID, ShouldEqual, "/web")
+
+			pu, err := client.PU(context.Background(), "/web")
+			So(err, ShouldBeNil)
+			So(pu.Name, ShouldEqual, "web")
+		})
+
+		Convey("I should get the error of the server for an unknown PU", func() {
+			_, err := client.PU(context.Background(), "/unknown")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "request failed: unknown pu /unknown")
+		})
+
+		Convey("I should get the flows of the PU until the context is done", func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			go func() {
+				for {
+					s.RLock()
+					subscribed := len(s.subscribers) > 0
+					s.RUnlock()
+					if subscribed {
+						break
+					}
+					time.Sleep(10 * time.Millisecond)
+				}
+				col.CollectFlowEvent(&collector.FlowRecord{ContextID: "/other"})
+				col.CollectFlowEvent(&collector.FlowRecord{
+					ContextID:   "/web",
+					Destination: collector.EndPoint{IP: "10.0.0.2", Port: 443},
+					Count:       1,
+				})
+			}()
+
+			flows := []*Flow{}
+			err := client.Flows(ctx, "/web", func(flow *Flow) {
+				flows = append(flows, flow)
+				cancel()
+			})
+			So(err, ShouldBeNil)
+			So(len(flows), ShouldEqual, 1)
+			So(flows[0].PUID, ShouldEqual, "/web")
+			So(flows[0].DestinationPort, ShouldEqual, 443)
+		})
+	})
+}
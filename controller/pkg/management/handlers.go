@@ -0,0 +1,626 @@
+package management
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"go.aporeto.io/enforcerd/trireme-lib/controller/constants"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/packettracing"
+	"go.aporeto.io/enforcerd/trireme-lib/policy"
+	"go.aporeto.io/gaia"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// ServeHTTP is called for every request.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	if err := s.authorize(r); err != nil {
+		zap.L().Warn("Unauthorized management request", zap.String("caller", r.RemoteAddr), zap.Error(err))
+		writeError(w, http.StatusForbidden, err)
+		return
+	}
+
+	path, err := splitPath(r.URL)
+	if err != nil || len(path) < 2 || path[0] != APIVersion {
+		writeError(w, http.StatusNotFound, fmt.Errorf("unknown path %s", r.URL.Path))
+		return
+	}
+
+	switch {
+	case len(path) == 2 && path[1] == "openapi.yaml":
+		s.handleOpenAPI(w, r)
+	case len(path) == 2 && path[1] == "pus":
+		s.handleListPUs(w, r)
+	case len(path) == 2 && path[1] == "loglevel":
+		s.handleLogLevel(w, r)
+	case len(path) == 2 && path[1] == "configuration":
+		s.handleConfiguration(w, r)
+	case len(path) == 2 && path[1] == "flows":
+		s.handleFlows(w, r)
+	case len(path) == 3 && path[1] == "pus":
+		s.handleGetPU(w, r, path[2])
+	case len(path) == 4 && path[1] == "pus" && path[3] == "counters":
+		s.handleCounters(w, r, path[2])
+	case len(path) == 4 && path[1] == "pus" && path[3] == "connections":
+		s.handleConnections(w, r, path[2])
+	case len(path) == 4 && path[1] == "pus" && path[3] == "ping":
+		s.handlePing(w, r, path[2])
+	case len(path) == 5 && path[1] == "pus" && path[3] == "ping":
+		s.handlePingResult(w, r, path[2], path[4])
+	case len(path) == 4 && path[1] == "pus" && path[3] == "trace":
+		s.handleTrace(w, r, path[2])
+	case len(path) == 4 && path[1] == "pus" && path[3] == "debug":
+		s.handleDebug(w, r, path[2])
+	default:
+		writeError(w, http.StatusNotFound, fmt.Errorf("unknown path %s", r.URL.Path))
+	}
+}
+
+func (s *Server) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/yaml")
+	w.Write([]byte(OpenAPISpec)) // nolint: errcheck
+}
+
+func (s *Server) handleListPUs(w http.ResponseWriter, r *http.Request) {
+
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	s.RLock()
+	pus := make([]*PU, 0, len(s.pus))
+	for puID, pu := range s.pus {
+		pus = append(pus, pu.summary(puID))
+	}
+	s.RUnlock()
+
+	sort.Slice(pus, func(i, j int) bool { return pus[i].ID < pus[j].ID })
+
+	writeJSON(w, http.StatusOK, pus)
+}
+
+func (s *Server) handleGetPU(w http.ResponseWriter, r *http.Request, puID string) {
+
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	s.RLock()
+	pu, ok := s.pus[puID]
+	var details *PUDetails
+	if ok {
+		details = &PUDetails{
+			PU:      *pu.summary(puID),
+			Runtime: pu.runtime,
+		}
+		if pu.policy != nil {
+			details.Policy = pu.policy.ToPublicPolicy()
+			details.Policy.ServicesPrivateKey = ""
+		}
+	}
+	s.RUnlock()
+
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("unknown pu %s", puID))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, details)
+}
+
+func (s *Server) handleCounters(w http.ResponseWriter, r *http.Request, puID string) {
+
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	s.RLock()
+	pu, ok := s.pus[puID]
+	counters := map[string]uint64{}
+	if ok {
+		for name, value := range pu.counters {
+			counters[name] = value
+		}
+	}
+	s.RUnlock()
+
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("unknown pu %s", puID))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, counters)
+}
+
+func (s *Server) handleConnections(w http.ResponseWriter, r *http.Request, puID string) {
+
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	now := time.Now()
+
+	s.RLock()
+	pu, ok := s.pus[puID]
+	connections := []*Connection{}
+	if ok {
+		for _, conn := range pu.connections {
+			if now.Sub(conn.LastSeen) > connectionTimeout {
+				continue
+			}
+			c := *conn
+			connections = append(connections, &c)
+		}
+	}
+	s.RUnlock()
+
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("unknown pu %s", puID))
+		return
+	}
+
+	sort.Slice(connections, func(i, j int) bool { return connections[i].LastSeen.After(connections[j].LastSeen) })
+
+	writeJSON(w, http.StatusOK, connections)
+}
+
+func (s *Server) handlePing(w http.ResponseWriter, r *http.Request, puID string) {
+
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	req := &PingRequest{}
+	if err := readJSON(r, req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ip := net.ParseIP(req.IP)
+	if ip == nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid ip %s", req.IP))
+		return
+	}
+
+	if req.Iterations <= 0 {
+		req.Iterations = 1
+	}
+
+	plc, rt, err := s.lookup(puID)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+
+	pingID, err := newPingID()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	s.expectPing(pingID)
+
+	pingConfig := &policy.PingConfig{
+		Mode:              gaia.ProcessingUnitRefreshPingModeAuto,
+		ID:                pingID,
+		IP:                ip,
+		Port:              req.Port,
+		Iterations:        req.Iterations,
+		TargetTCPNetworks: req.TargetTCPNetworks,
+		ExcludedNetworks:  req.ExcludedNetworks,
+	}
+
+	if err := s.controller.Ping(context.Background(), puID, plc, rt, pingConfig); err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("unable to run ping: %s", err))
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, &PingResponse{PingID: pingID})
+}
+
+func (s *Server) handlePingResult(w http.ResponseWriter, r *http.Request, puID string, pingID string) {
+
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	s.RLock()
+	reports, ok := s.pings[pingID]
+	pu := s.pus[puID]
+	result := &PingResult{PingID: pingID}
+	for _, report := range reports {
+		if report.PUID == puID || (pu != nil && pu.policy != nil && report.PUID == pu.policy.ManagementID()) {
+			result.Reports = append(result.Reports, report)
+		}
+	}
+	s.RUnlock()
+
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("unknown ping %s", pingID))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (s *Server) handleTrace(w http.ResponseWriter, r *http.Request, puID string) {
+
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	req := &TraceRequest{}
+	if err := readJSON(r, req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	interval, err := time.ParseDuration(req.Duration)
+	if err != nil || interval <= 0 {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid duration %s", req.Duration))
+		return
+	}
+
+	direction := packettracing.Disabled
+	if req.Network {
+		direction |= packettracing.NetworkOnly
+	}
+	if req.Application {
+		direction |= packettracing.ApplicationOnly
+	}
+
+	if direction == packettracing.Disabled && !req.IPTables {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("no tracing requested"))
+		return
+	}
+
+	plc, rt, err := s.lookup(puID)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+
+	if direction != packettracing.Disabled {
+		if err := s.controller.EnableDatapathPacketTracing(context.Background(), puID, plc, rt, direction, interval); err != nil {
+			writeError(w, http.StatusInternalServerError, fmt.Errorf("unable to enable datapath tracing: %s", err))
+			return
+		}
+	}
+
+	if req.IPTables {
+		if err := s.controller.EnableIPTablesPacketTracing(context.Background(), puID, plc, rt, interval); err != nil {
+			writeError(w, http.StatusInternalServerError, fmt.Errorf("unable to enable iptables tracing: %s", err))
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (s *Server) handleDebug(w http.ResponseWriter, r *http.Request, puID string) {
+
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	req := &DebugRequest{}
+	if err := readJSON(r, req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var duration time.Duration
+	if req.Duration != "" {
+		parsed, err := time.ParseDuration(req.Duration)
+		if err != nil || parsed <= 0 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid duration %s", req.Duration))
+			return
+		}
+		duration = parsed
+	}
+
+	plc, rt, err := s.lookup(puID)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+
+	debugConfig := &policy.DebugConfig{
+		DebugConfigInput: policy.DebugConfigInput{
+			DebugType:    gaia.EnforcerRefreshDebugValue(req.Type),
+			NativeID:     puID,
+			FilePath:     req.FilePath,
+			PcapFilter:   req.PcapFilter,
+			CommandExec:  req.CommandExec,
+			PcapNative:   req.Native,
+			PcapDuration: duration,
+			PcapMaxSize:  req.MaxSize,
+			PcapFileSize: req.FileSize,
+			PcapFiles:    req.Files,
+		},
+	}
+
+	if err := s.controller.DebugCollect(r.Context(), puID, plc, rt, debugConfig); err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("unable to collect debug information: %s", err))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, &DebugResponse{
+		PID:           debugConfig.PID,
+		CommandOutput: debugConfig.CommandOutput,
+	})
+}
+
+func (s *Server) handleFlows(w http.ResponseWriter, r *http.Request) {
+
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("streaming not supported"))
+		return
+	}
+
+	ch := s.subscribeFlows(r.URL.Query().Get("pu"))
+	defer s.unsubscribeFlows(ch)
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	encoder := json.NewEncoder(w)
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case flow := <-ch:
+			if err := encoder.Encode(flow); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+func (s *Server) handleLogLevel(w http.ResponseWriter, r *http.Request) {
+
+	if !allowMethod(w, r, http.MethodPut) {
+		return
+	}
+
+	req := &LogLevelRequest{}
+	if err := readJSON(r, req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := s.setLogLevel(req.Level); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleConfiguration(w http.ResponseWriter, r *http.Request) {
+
+	switch r.Method {
+	case http.MethodGet:
+		s.RLock()
+		cfg := s.configuration.DeepCopy()
+		s.RUnlock()
+
+		writeJSON(w, http.StatusOK, &Configuration{
+			TCPTargetNetworks: cfg.TCPTargetNetworks,
+			UDPTargetNetworks: cfg.UDPTargetNetworks,
+			ExcludedNetworks:  cfg.ExcludedNetworks,
+			LogLevel:          string(cfg.LogLevel),
+		})
+
+	case http.MethodPut:
+		req := &Configuration{}
+		if err := readJSON(r, req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		for _, network := range append(append(append([]string{}, req.TCPTargetNetworks...), req.UDPTargetNetworks...), req.ExcludedNetworks...) {
+			if _, _, err := net.ParseCIDR(network); err != nil {
+				writeError(w, http.StatusBadRequest, fmt.Errorf("invalid network %s", network))
+				return
+			}
+		}
+
+		if req.LogLevel != "" {
+			if err := s.setLogLevel(req.LogLevel); err != nil {
+				writeError(w, http.StatusBadRequest, err)
+				return
+			}
+		}
+
+		s.RLock()
+		cfg := s.configuration.DeepCopy()
+		s.RUnlock()
+
+		if req.TCPTargetNetworks != nil {
+			cfg.TCPTargetNetworks = req.TCPTargetNetworks
+		}
+		if req.UDPTargetNetworks != nil {
+			cfg.UDPTargetNetworks = req.UDPTargetNetworks
+		}
+		if req.ExcludedNetworks != nil {
+			cfg.ExcludedNetworks = req.ExcludedNetworks
+		}
+
+		if err := s.updateConfiguration(cfg); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		w.Header().Set("Allow", http.MethodGet+", "+http.MethodPut)
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+	}
+}
+
+// setLogLevel changes the log level of the enforcers, and of the process if
+// its level is managed.
+func (s *Server) setLogLevel(level string) error {
+
+	logLevel, zapLevel, err := parseLogLevel(level)
+	if err != nil {
+		return err
+	}
+
+	s.RLock()
+	cfg := s.configuration.DeepCopy()
+	s.RUnlock()
+
+	cfg.LogLevel = logLevel
+	if err := s.updateConfiguration(cfg); err != nil {
+		return err
+	}
+
+	if s.level != nil {
+		s.level.SetLevel(zapLevel)
+	}
+
+	zap.L().Info("Log level changed", zap.String("level", level))
+	return nil
+}
+
+// lookup returns the policy and runtime of a PU.
+func (s *Server) lookup(puID string) (*policy.PUPolicy, *policy.PURuntime, error) {
+
+	s.RLock()
+	defer s.RUnlock()
+
+	pu, ok := s.pus[puID]
+	if !ok {
+		return nil, nil, fmt.Errorf("unknown pu %s", puID)
+	}
+
+	return pu.policy, pu.runtime, nil
+}
+
+// summary returns the summary of a PU.
+func (p *puRecord) summary(puID string) *PU {
+
+	pu := &PU{
+		ID:      puID,
+		Created: p.created,
+		Updated: p.updated,
+	}
+
+	if p.runtime != nil {
+		pu.Name = p.runtime.Name()
+		pu.Type = p.runtime.PUType()
+		pu.PID = p.runtime.Pid()
+		pu.Tags = p.runtime.Tags().GetSlice()
+		pu.IPs = p.runtime.IPAddresses().Copy()
+		sort.Strings(pu.Tags)
+	}
+
+	return pu
+}
+
+// parseLogLevel parses a log level.
+func parseLogLevel(level string) (constants.LogLevel, zapcore.Level, error) {
+
+	switch strings.ToLower(level) {
+	case "trace":
+		return constants.Trace, zapcore.DebugLevel, nil
+	case "debug":
+		return constants.Debug, zapcore.DebugLevel, nil
+	case "info":
+		return constants.Info, zapcore.InfoLevel, nil
+	case "warn":
+		return constants.Warn, zapcore.WarnLevel, nil
+	case "error":
+		return constants.Error, zapcore.ErrorLevel, nil
+	default:
+		return "", zapcore.InfoLevel, fmt.Errorf("invalid log level %s", level)
+	}
+}
+
+// splitPath returns the unescaped segments of the path of a URL. The PU IDs
+// can contain slashes, so they are escaped by the clients.
+func splitPath(u *url.URL) ([]string, error) {
+
+	segments := strings.Split(strings.Trim(u.EscapedPath(), "/"), "/")
+	for i, segment := range segments {
+		unescaped, err := url.PathUnescape(segment)
+		if err != nil {
+			return nil, err
+		}
+		segments[i] = unescaped
+	}
+
+	return segments, nil
+}
+
+// newPingID returns a random ping ID.
+func newPingID() (string, error) {
+
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("unable to generate ping id: %s", err)
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+func allowMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+
+	if r.Method == method {
+		return true
+	}
+
+	w.Header().Set("Allow", method)
+	writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+	return false
+}
+
+func readJSON(r *http.Request, v interface{}) error {
+
+	defer r.Body.Close() // nolint: errcheck
+
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		return fmt.Errorf("invalid request: %s", err)
+	}
+
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		zap.L().Debug("Unable to write management response", zap.Error(err))
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, &Error{Error: err.Error()})
+}
@@ -0,0 +1,98 @@
+// +build linux
+
+package management
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+
+	"go.aporeto.io/enforcerd/trireme-lib/monitor/remoteapi/server"
+)
+
+// makeListener creates a listener that exposes the credentials of the
+// callers as their remote address.
+func makeListener(socketPath string) (net.Listener, error) {
+
+	addr, _ := net.ResolveUnixAddr("unix", socketPath)
+	nl, err := net.ListenUnix("unix", addr)
+	if err != nil {
+		return nil, fmt.Errorf("unable to start management API server: %s", err)
+	}
+
+	// The authorized groups must be able to connect, the credentials of the
+	// callers are checked for every request.
+	if err := os.Chmod(socketPath, 0660); err != nil {
+		nl.Close() // nolint: errcheck
+		return nil, fmt.Errorf("cannot set the permissions of the management socket: %s", err)
+	}
+
+	return server.NewUIDListener(nl), nil
+}
+
+// groupIDs returns the ids of the groups of a user, including its
+// supplementary groups.
+var groupIDs = func(uid string) ([]string, error) {
+
+	u, err := user.LookupId(uid)
+	if err != nil {
+		return nil, err
+	}
+
+	return u.GroupIds()
+}
+
+// authorize validates that the caller is an authorized user or a member of
+// an authorized group. The remote address of the request is uid:gid:pid. The
+// credentials only carry the primary group of the caller, so its supplementary
+// groups are looked up.
+func (s *Server) authorize(r *http.Request) error {
+
+	parts := strings.Split(r.RemoteAddr, ":")
+	if len(parts) != 3 {
+		return fmt.Errorf("invalid user context")
+	}
+
+	uid, err := strconv.ParseUint(parts[0], 10, 32)
+	if err != nil {
+		return fmt.Errorf("invalid user context")
+	}
+
+	gid, err := strconv.ParseUint(parts[1], 10, 32)
+	if err != nil {
+		return fmt.Errorf("invalid user context")
+	}
+
+	if _, ok := s.uids[uint32(uid)]; ok {
+		return nil
+	}
+
+	if _, ok := s.gids[uint32(gid)]; ok {
+		return nil
+	}
+
+	if len(s.gids) == 0 {
+		return fmt.Errorf("user %d is not authorized", uid)
+	}
+
+	groups, err := groupIDs(parts[0])
+	if err != nil {
+		return fmt.Errorf("unable to find the groups of user %d: %s", uid, err)
+	}
+
+	for _, group := range groups {
+		gid, err := strconv.ParseUint(group, 10, 32)
+		if err != nil {
+			continue
+		}
+		if _, ok := s.gids[uint32(gid)]; ok {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("user %d is not authorized", uid)
+}
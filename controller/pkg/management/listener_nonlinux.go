@@ -0,0 +1,34 @@
+// +build !linux
+
+package management
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+)
+
+// makeListener creates a listener on the management socket. The credentials
+// of the callers are not available, so only the owner can use the socket.
+func makeListener(socketPath string) (net.Listener, error) {
+
+	nl, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to start management API server: %s", err)
+	}
+
+	if err := os.Chmod(socketPath, 0600); err != nil {
+		nl.Close() // nolint: errcheck
+		return nil, fmt.Errorf("cannot set the permissions of the management socket: %s", err)
+	}
+
+	return nl, nil
+}
+
+// authorize accepts all the requests, the access is restricted by the
+// permissions of the socket.
+// TODO: check the credentials of the callers on these platforms.
+func (s *Server) authorize(r *http.Request) error {
+	return nil
+}
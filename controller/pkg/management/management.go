@@ -0,0 +1,467 @@
+package management
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"go.aporeto.io/enforcerd/trireme-lib/collector"
+	"go.aporeto.io/enforcerd/trireme-lib/controller"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/counters"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/runtime"
+	"go.aporeto.io/enforcerd/trireme-lib/policy"
+	"go.uber.org/zap"
+)
+
+// DefaultSocketPath is the default path of the management socket.
+const DefaultSocketPath = "/var/run/trireme-management.sock"
+
+const (
+	// maxConnections is the maximum number of connections kept per PU.
+	maxConnections = 1024
+	// connectionTimeout is the time after which a connection is not active anymore.
+	connectionTimeout = 5 * time.Minute
+	// maxPings is the maximum number of pings whose reports are kept.
+	maxPings = 64
+	// flowBacklog is the number of flows buffered for a slow subscriber.
+	flowBacklog = 128
+)
+
+// Option is an option of the management server.
+type Option func(*Server)
+
+// OptionAuthorizedUIDs authorizes the given users to use the API. The root
+// user is always authorized.
+func OptionAuthorizedUIDs(uids ...uint32) Option {
+	return func(s *Server) {
+		for _, uid := range uids {
+			s.uids[uid] = struct{}{}
+		}
+	}
+}
+
+// OptionAuthorizedGIDs authorizes the members of the given groups to use the API.
+func OptionAuthorizedGIDs(gids ...uint32) Option {
+	return func(s *Server) {
+		for _, gid := range gids {
+			s.gids[gid] = struct{}{}
+		}
+	}
+}
+
+// OptionRuntimeConfiguration sets the runtime configuration the controller
+// was started with. The updates of the configuration are applied on top of it.
+func OptionRuntimeConfiguration(cfg *runtime.Configuration) Option {
+	return func(s *Server) {
+		s.configuration = cfg.DeepCopy()
+	}
+}
+
+// OptionAtomicLevel sets the level of the logger of the process, so that the
+// log level changes apply to the process too and not only to the enforcers.
+func OptionAtomicLevel(level zap.AtomicLevel) Option {
+	return func(s *Server) {
+		s.level = &level
+	}
+}
+
+// puRecord is the state of a PU known by the server.
+type puRecord struct {
+	runtime     *policy.PURuntime
+	policy      *policy.PUPolicy
+	created     time.Time
+	updated     time.Time
+	counters    map[string]uint64
+	connections map[string]*Connection
+}
+
+// Server is the local management API of a controller. It records the PUs
+// enforced by the controller, and the counters, flows and ping reports of the
+// collector, and serves them over a unix socket. Only the callers with
+// authorized credentials can use it.
+type Server struct {
+	socketPath    string
+	server        *http.Server
+	controller    controller.TriremeController
+	configuration *runtime.Configuration
+	level         *zap.AtomicLevel
+	uids          map[uint32]struct{}
+	gids          map[uint32]struct{}
+	pus           map[string]*puRecord
+	pings         map[string][]*collector.PingReport
+	pingOrder     []string
+	subscribers   map[chan *Flow]string
+	sync.RWMutex
+}
+
+// NewServer creates a new management server listening on the given socket.
+func NewServer(socketPath string, opts ...Option) (*Server, error) {
+
+	if err := cleanupSocket(socketPath); err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		socketPath:    socketPath,
+		configuration: &runtime.Configuration{},
+		uids:          map[uint32]struct{}{0: {}},
+		gids:          map[uint32]struct{}{},
+		pus:           map[string]*puRecord{},
+		pings:         map[string][]*collector.PingReport{},
+		subscribers:   map[chan *Flow]string{},
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s, nil
+}
+
+// Controller returns a controller that records the PUs enforced by the given
+// controller. It must be used in place of the given controller.
+func (s *Server) Controller(c controller.TriremeController) controller.TriremeController {
+
+	s.Lock()
+	s.controller = c
+	s.Unlock()
+
+	return &managedController{TriremeController: c, server: s}
+}
+
+// Collector returns a collector that records the counters, flows and ping
+// reports before sending them to the given collector. It must be given to the
+// controller in place of the given collector.
+func (s *Server) Collector(c collector.EventCollector) collector.EventCollector {
+	return &managedCollector{EventCollector: c, server: s}
+}
+
+// Run runs the server in the background. It stops with the context.
+func (s *Server) Run(ctx context.Context) error {
+
+	s.RLock()
+	ctrl := s.controller
+	s.RUnlock()
+
+	if ctrl == nil {
+		return fmt.Errorf("no controller to manage")
+	}
+
+	listener, err := makeListener(s.socketPath)
+	if err != nil {
+		return err
+	}
+
+	s.server = &http.Server{
+		Handler: s,
+	}
+
+	go s.server.Serve(listener) // nolint
+
+	go func() {
+		<-ctx.Done()
+		s.server.Close() // nolint
+	}()
+
+	return nil
+}
+
+// enforced records the policy and runtime of an enforced PU.
+func (s *Server) enforced(puID string, plc *policy.PUPolicy, rt *policy.PURuntime) {
+
+	s.Lock()
+	defer s.Unlock()
+
+	now := time.Now()
+
+	pu, ok := s.pus[puID]
+	if !ok {
+		pu = &puRecord{
+			created:     now,
+			counters:    map[string]uint64{},
+			connections: map[string]*Connection{},
+		}
+		s.pus[puID] = pu
+	}
+
+	pu.runtime = rt
+	pu.policy = plc
+	pu.updated = now
+}
+
+// unenforced forgets a PU.
+func (s *Server) unenforced(puID string) {
+
+	s.Lock()
+	defer s.Unlock()
+
+	delete(s.pus, puID)
+}
+
+// recordCounters adds the reported counters to the counters of the PU.
+func (s *Server) recordCounters(report *collector.CounterReport) {
+
+	s.Lock()
+	defer s.Unlock()
+
+	pu := s.find(report.PUID)
+	if pu == nil {
+		return
+	}
+
+	names := counters.CounterNames()
+	for i, value := range report.Counters {
+		if i >= len(names) || value == 0 {
+			continue
+		}
+		pu.counters[names[i]] += uint64(value)
+	}
+}
+
+// find returns the PU with the given context ID or management ID. The
+// counters and pings are reported with the management ID of the PUs.
+func (s *Server) find(id string) *puRecord {
+
+	if pu, ok := s.pus[id]; ok {
+		return pu
+	}
+
+	for _, pu := range s.pus {
+		if pu.policy != nil && pu.policy.ManagementID() == id {
+			return pu
+		}
+	}
+
+	return nil
+}
+
+// recordFlow records the connection of a flow and sends the flow to the
+// subscribers.
+func (s *Server) recordFlow(record *collector.FlowRecord) {
+
+	s.Lock()
+	defer s.Unlock()
+
+	s.publishFlow(record)
+
+	pu, ok := s.pus[record.ContextID]
+	if !ok {
+		return
+	}
+
+	key := fmt.Sprintf("%s/%s/%d/%d", record.Source.IP, record.Destination.IP, record.Destination.Port, record.L4Protocol)
+
+	conn, ok := pu.connections[key]
+	if !ok {
+		if len(pu.connections) >= maxConnections {
+			evictOldestConnection(pu.connections)
+		}
+		conn = &Connection{
+			SourceIP:        record.Source.IP,
+			SourceID:        record.Source.ID,
+			DestinationIP:   record.Destination.IP,
+			DestinationID:   record.Destination.ID,
+			DestinationPort: record.Destination.Port,
+			Protocol:        record.L4Protocol,
+		}
+		pu.connections[key] = conn
+	}
+
+	conn.Action = record.Action
+	conn.PolicyID = record.PolicyID
+	conn.DropReason = record.DropReason
+	conn.Count += record.Count
+	conn.LastSeen = time.Now()
+}
+
+// publishFlow sends a flow to the subscribers. The flows are dropped for the
+// subscribers that do not keep up.
+func (s *Server) publishFlow(record *collector.FlowRecord) {
+
+	if len(s.subscribers) == 0 {
+		return
+	}
+
+	flow := &Flow{
+		Time:            time.Now(),
+		PUID:            record.ContextID,
+		SourceIP:        record.Source.IP,
+		SourceID:        record.Source.ID,
+		DestinationIP:   record.Destination.IP,
+		DestinationID:   record.Destination.ID,
+		DestinationPort: record.Destination.Port,
+		Protocol:        record.L4Protocol,
+		Action:          record.Action,
+		PolicyID:        record.PolicyID,
+		DropReason:      record.DropReason,
+		Count:           record.Count,
+	}
+
+	for ch, puID := range s.subscribers {
+		if puID != "" && puID != flow.PUID {
+			continue
+		}
+		select {
+		case ch <- flow:
+		default:
+		}
+	}
+}
+
+// subscribeFlows returns a channel that receives the flows of a PU, or of all
+// the PUs if the PU ID is empty.
+func (s *Server) subscribeFlows(puID string) chan *Flow {
+
+	s.Lock()
+	defer s.Unlock()
+
+	ch := make(chan *Flow, flowBacklog)
+	s.subscribers[ch] = puID
+
+	return ch
+}
+
+// unsubscribeFlows stops sending the flows to the channel.
+func (s *Server) unsubscribeFlows(ch chan *Flow) {
+
+	s.Lock()
+	defer s.Unlock()
+
+	delete(s.subscribers, ch)
+}
+
+// recordPing records the report of a ping started through the API.
+func (s *Server) recordPing(report *collector.PingReport) {
+
+	s.Lock()
+	defer s.Unlock()
+
+	if reports, ok := s.pings[report.PingID]; ok {
+		s.pings[report.PingID] = append(reports, report)
+	}
+}
+
+// expectPing prepares the recording of the reports of a ping.
+func (s *Server) expectPing(pingID string) {
+
+	s.Lock()
+	defer s.Unlock()
+
+	if len(s.pingOrder) >= maxPings {
+		delete(s.pings, s.pingOrder[0])
+		s.pingOrder = s.pingOrder[1:]
+	}
+
+	s.pings[pingID] = []*collector.PingReport{}
+	s.pingOrder = append(s.pingOrder, pingID)
+}
+
+// updateConfiguration updates the runtime configuration of the controller.
+func (s *Server) updateConfiguration(cfg *runtime.Configuration) error {
+
+	if err := s.controller.UpdateConfiguration(cfg); err != nil {
+		return err
+	}
+
+	s.Lock()
+	s.configuration = cfg.DeepCopy()
+	s.Unlock()
+
+	return nil
+}
+
+// cleanupSocket removes a leftover socket.
+func cleanupSocket(socketPath string) error {
+
+	if _, err := os.Stat(socketPath); err == nil {
+		if err := os.Remove(socketPath); err != nil {
+			return fmt.Errorf("cannot clean up management socket: %s", err)
+		}
+	}
+
+	return nil
+}
+
+// evictOldestConnection removes the connection that was seen last.
+func evictOldestConnection(connections map[string]*Connection) {
+
+	oldest := ""
+	var oldestSeen time.Time
+
+	for key, conn := range connections {
+		if oldest == "" || conn.LastSeen.Before(oldestSeen) {
+			oldest = key
+			oldestSeen = conn.LastSeen
+		}
+	}
+
+	delete(connections, oldest)
+}
+
+// managedController records the PUs enforced by a controller.
+type managedController struct {
+	controller.TriremeController
+	server *Server
+}
+
+// Enforce implements the TriremeController interface.
+func (m *managedController) Enforce(ctx context.Context, puID string, plc *policy.PUPolicy, rt *policy.PURuntime) error {
+
+	if err := m.TriremeController.Enforce(ctx, puID, plc, rt); err != nil {
+		return err
+	}
+
+	m.server.enforced(puID, plc, rt)
+	return nil
+}
+
+// UnEnforce implements the TriremeController interface.
+func (m *managedController) UnEnforce(ctx context.Context, puID string, plc *policy.PUPolicy, rt *policy.PURuntime) error {
+
+	m.server.unenforced(puID)
+	return m.TriremeController.UnEnforce(ctx, puID, plc, rt)
+}
+
+// UpdatePolicy implements the TriremeController interface.
+func (m *managedController) UpdatePolicy(ctx context.Context, puID string, plc *policy.PUPolicy, rt *policy.PURuntime) error {
+
+	if err := m.TriremeController.UpdatePolicy(ctx, puID, plc, rt); err != nil {
+		return err
+	}
+
+	m.server.enforced(puID, plc, rt)
+	return nil
+}
+
+// UpdateConfiguration implements the TriremeController interface.
+func (m *managedController) UpdateConfiguration(cfg *runtime.Configuration) error {
+
+	return m.server.updateConfiguration(cfg)
+}
+
+// managedCollector records the events of a collector.
+type managedCollector struct {
+	collector.EventCollector
+	server *Server
+}
+
+// CollectFlowEvent implements the EventCollector interface.
+func (m *managedCollector) CollectFlowEvent(record *collector.FlowRecord) {
+	m.server.recordFlow(record)
+	m.EventCollector.CollectFlowEvent(record)
+}
+
+// CollectCounterEvent implements the EventCollector interface.
+func (m *managedCollector) CollectCounterEvent(report *collector.CounterReport) {
+	m.server.recordCounters(report)
+	m.EventCollector.CollectCounterEvent(report)
+}
+
+// CollectPingEvent implements the EventCollector interface.
+func (m *managedCollector) CollectPingEvent(report *collector.PingReport) {
+	m.server.recordPing(report)
+	m.EventCollector.CollectPingEvent(report)
+}
@@ -0,0 +1,308 @@
+// +build linux
+
+package management
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.aporeto.io/enforcerd/trireme-lib/collector"
+	"go.aporeto.io/enforcerd/trireme-lib/common"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/constants"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/mockcontroller"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/counters"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/runtime"
+	"go.aporeto.io/enforcerd/trireme-lib/policy"
+)
+
+func testRequest(s *Server, caller, method, path string, body interface{}) *httptest.ResponseRecorder {
+
+	b := new(bytes.Buffer)
+	if body != nil {
+		json.NewEncoder(b).Encode(body) // nolint: errcheck
+	}
+
+	r := httptest.NewRequest(method, "http://unix"+path, b)
+	r.RemoteAddr = caller
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	return w
+}
+
+func testPU() (*policy.PUPolicy, *policy.PURuntime) {
+
+	plc := policy.NewPUPolicyWithDefaults()
+	plc.UpdateServiceCertificates("cert", "key")
+
+	tags := policy.NewTagStoreFromSlice([]string{"app=web"})
+	rt := policy.NewPURuntime("web", 1234, "", tags, policy.ExtendedMap{"bridge": "10.0.0.1"}, common.LinuxProcessPU, policy.None, nil)
+
+	return plc, rt
+}
+
+func TestNewServer(t *testing.T) {
+	Convey("When I create a new server", t, func() {
+		s, err := NewServer("/tmp/trireme-management.sock", OptionAuthorizedUIDs(1000), OptionAuthorizedGIDs(100))
+		Convey("The object should be correct", func() {
+			So(err, ShouldBeNil)
+			So(s.socketPath, ShouldEqual, "/tmp/trireme-management.sock")
+			So(s.uids, ShouldContainKey, uint32(0))
+			So(s.uids, ShouldContainKey, uint32(1000))
+			So(s.gids, ShouldContainKey, uint32(100))
+		})
+
+		Convey("It should not run without a controller", func() {
+			So(s.Run(context.Background()), ShouldNotBeNil)
+		})
+	})
+}
+
+func TestAuthorization(t *testing.T) {
+	Convey("Given a management server", t, func() {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		s, err := NewServer("/tmp/trireme-management.sock", OptionAuthorizedGIDs(100))
+		So(err, ShouldBeNil)
+		s.Controller(mockcontroller.NewMockTriremeController(ctrl))
+
+		lookup := groupIDs
+		defer func() { groupIDs = lookup }()
+		groupIDs = func(uid string) ([]string, error) {
+			if uid == "1001" {
+				return []string{"1001", "100"}, nil
+			}
+			return []string{uid}, nil
+		}
+
+		Convey("The root user should be authorized", func() {
+			w := testRequest(s, "0:0:1", http.MethodGet, "/v1/pus", nil)
+			So(w.Code, ShouldEqual, http.StatusOK)
+		})
+
+		Convey("The members of an authorized group should be authorized", func() {
+			w := testRequest(s, "1000:100:1", http.MethodGet, "/v1/pus", nil)
+			So(w.Code, ShouldEqual, http.StatusOK)
+		})
+
+		Convey("The members of an authorized supplementary group should be authorized", func() {
+			w := testRequest(s, "1001:1001:1", http.MethodGet, "/v1/pus", nil)
+			So(w.Code, ShouldEqual, http.StatusOK)
+		})
+
+		Convey("The other users should not be authorized", func() {
+			w := testRequest(s, "1000:1000:1", http.MethodGet, "/v1/pus", nil)
+			So(w.Code, ShouldEqual, http.StatusForbidden)
+		})
+
+		Convey("The callers without credentials should not be authorized", func() {
+			w := testRequest(s, "NotAvailable", http.MethodGet, "/v1/pus", nil)
+			So(w.Code, ShouldEqual, http.StatusForbidden)
+		})
+
+		Convey("The unversioned paths should not be found", func() {
+			w := testRequest(s, "0:0:1", http.MethodGet, "/pus", nil)
+			So(w.Code, ShouldEqual, http.StatusNotFound)
+		})
+	})
+}
+
+func TestPUs(t *testing.T) {
+	Convey("Given a management server with an enforced PU", t, func() {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockTrireme := mockcontroller.NewMockTriremeController(ctrl)
+
+		s, err := NewServer("/tmp/trireme-management.sock")
+		So(err, ShouldBeNil)
+		trireme := s.Controller(mockTrireme)
+		col := s.Collector(collector.NewDefaultCollector())
+
+		plc, rt := testPU()
+		path := "/v1/pus/" + url.PathEscape("/web")
+
+		mockTrireme.EXPECT().Enforce(gomock.Any(), "/web", plc, rt).Return(nil)
+		So(trireme.Enforce(context.Background(), "/web", plc, rt), ShouldBeNil)
+
+		Convey("It should be listed", func() {
+			w := testRequest(s, "0:0:1", http.MethodGet, "/v1/pus", nil)
+			So(w.Code, ShouldEqual, http.StatusOK)
+
+			pus := []*PU{}
+			So(json.NewDecoder(w.Body).Decode(&pus), ShouldBeNil)
+			So(len(pus), ShouldEqual, 1)
+			So(pus[0].ID, ShouldEqual, "/web")
+			So(pus[0].Name, ShouldEqual, "web")
+			So(pus[0].PID, ShouldEqual, 1234)
+			So(pus[0].Tags, ShouldResemble, []string{"app=web"})
+		})
+
+		Convey("I should get its policy without its private key", func() {
+			w := testRequest(s, "0:0:1", http.MethodGet, path, nil)
+			So(w.Code, ShouldEqual, http.StatusOK)
+
+			details := &PUDetails{}
+			So(json.NewDecoder(w.Body).Decode(details), ShouldBeNil)
+			So(details.Runtime.Name(), ShouldEqual, "web")
+			So(details.Policy.ServicesCertificate, ShouldEqual, "cert")
+			So(details.Policy.ServicesPrivateKey, ShouldBeEmpty)
+		})
+
+		Convey("I should get its counters", func() {
+			report := make([]collector.Counters, len(counters.CounterNames()))
+			report[0] = 2
+			col.CollectCounterEvent(&collector.CounterReport{PUID: "/web", Counters: report})
+			col.CollectCounterEvent(&collector.CounterReport{PUID: "/web", Counters: report})
+
+			w := testRequest(s, "0:0:1", http.MethodGet, path+"/counters", nil)
+			So(w.Code, ShouldEqual, http.StatusOK)
+
+			values := map[string]uint64{}
+			So(json.NewDecoder(w.Body).Decode(&values), ShouldBeNil)
+			So(values, ShouldResemble, map[string]uint64{counters.CounterNames()[0]: 4})
+		})
+
+		Convey("I should get its connections", func() {
+			record := &collector.FlowRecord{
+				ContextID:   "/web",
+				Source:      collector.EndPoint{IP: "10.0.0.1"},
+				Destination: collector.EndPoint{IP: "10.0.0.2", Port: 443},
+				L4Protocol:  6,
+				Count:       1,
+				Action:      policy.Accept,
+			}
+			col.CollectFlowEvent(record)
+			col.CollectFlowEvent(record)
+
+			w := testRequest(s, "0:0:1", http.MethodGet, path+"/connections", nil)
+			So(w.Code, ShouldEqual, http.StatusOK)
+
+			connections := []*Connection{}
+			So(json.NewDecoder(w.Body).Decode(&connections), ShouldBeNil)
+			So(len(connections), ShouldEqual, 1)
+			So(connections[0].DestinationPort, ShouldEqual, 443)
+			So(connections[0].Count, ShouldEqual, 2)
+		})
+
+		Convey("I should be able to ping from it and get the reports", func() {
+			mockTrireme.EXPECT().Ping(gomock.Any(), "/web", plc, rt, gomock.Any()).Return(nil)
+
+			w := testRequest(s, "0:0:1", http.MethodPost, path+"/ping", &PingRequest{IP: "10.0.0.2", Port: 443})
+			So(w.Code, ShouldEqual, http.StatusAccepted)
+
+			resp := &PingResponse{}
+			So(json.NewDecoder(w.Body).Decode(resp), ShouldBeNil)
+			So(resp.PingID, ShouldNotBeEmpty)
+
+			col.CollectPingEvent(&collector.PingReport{PingID: resp.PingID, PUID: "/web", RTT: "1ms"})
+
+			w = testRequest(s, "0:0:1", http.MethodGet, path+"/ping/"+resp.PingID, nil)
+			So(w.Code, ShouldEqual, http.StatusOK)
+
+			result := &PingResult{}
+			So(json.NewDecoder(w.Body).Decode(result), ShouldBeNil)
+			So(len(result.Reports), ShouldEqual, 1)
+			So(result.Reports[0].RTT, ShouldEqual, "1ms")
+		})
+
+		Convey("I should not be able to ping an invalid IP", func() {
+			w := testRequest(s, "0:0:1", http.MethodPost, path+"/ping", &PingRequest{IP: "invalid"})
+			So(w.Code, ShouldEqual, http.StatusBadRequest)
+		})
+
+		Convey("I should be able to trace its packets", func() {
+			mockTrireme.EXPECT().EnableIPTablesPacketTracing(gomock.Any(), "/web", plc, rt, gomock.Any()).Return(nil)
+
+			w := testRequest(s, "0:0:1", http.MethodPost, path+"/trace", &TraceRequest{IPTables: true, Duration: "10s"})
+			So(w.Code, ShouldEqual, http.StatusAccepted)
+		})
+
+		Convey("I should be able to collect debug information", func() {
+			mockTrireme.EXPECT().DebugCollect(gomock.Any(), "/web", plc, rt, gomock.Any()).DoAndReturn(
+				func(ctx context.Context, puID string, plc *policy.PUPolicy, rt *policy.PURuntime, debugConfig *policy.DebugConfig) error {
+					debugConfig.CommandOutput = "output"
+					return nil
+				},
+			)
+
+			w := testRequest(s, "0:0:1", http.MethodPost, path+"/debug", &DebugRequest{CommandExec: "ip addr"})
+			So(w.Code, ShouldEqual, http.StatusOK)
+
+			resp := &DebugResponse{}
+			So(json.NewDecoder(w.Body).Decode(resp), ShouldBeNil)
+			So(resp.CommandOutput, ShouldEqual, "output")
+		})
+
+		Convey("When it is unenforced, it should not be found", func() {
+			mockTrireme.EXPECT().UnEnforce(gomock.Any(), "/web", plc, rt).Return(nil)
+			So(trireme.UnEnforce(context.Background(), "/web", plc, rt), ShouldBeNil)
+
+			w := testRequest(s, "0:0:1", http.MethodGet, path, nil)
+			So(w.Code, ShouldEqual, http.StatusNotFound)
+		})
+	})
+}
+
+func TestConfiguration(t *testing.T) {
+	Convey("Given a management server", t, func() {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockTrireme := mockcontroller.NewMockTriremeController(ctrl)
+
+		s, err := NewServer("/tmp/trireme-management.sock", OptionRuntimeConfiguration(&runtime.Configuration{
+			TCPTargetNetworks: []string{"10.0.0.0/8"},
+		}))
+		So(err, ShouldBeNil)
+		s.Controller(mockTrireme)
+
+		Convey("When I change the log level, the configuration should be updated", func() {
+			mockTrireme.EXPECT().UpdateConfiguration(&runtime.Configuration{
+				TCPTargetNetworks: []string{"10.0.0.0/8"},
+				UDPTargetNetworks: []string{},
+				ExcludedNetworks:  []string{},
+				LogLevel:          constants.Debug,
+			}).Return(nil)
+
+			w := testRequest(s, "0:0:1", http.MethodPut, "/v1/loglevel", &LogLevelRequest{Level: "debug"})
+			So(w.Code, ShouldEqual, http.StatusNoContent)
+		})
+
+		Convey("When I set an invalid log level, I should get an error", func() {
+			w := testRequest(s, "0:0:1", http.MethodPut, "/v1/loglevel", &LogLevelRequest{Level: "verbose"})
+			So(w.Code, ShouldEqual, http.StatusBadRequest)
+		})
+
+		Convey("When I update the networks, the other fields should not change", func() {
+			mockTrireme.EXPECT().UpdateConfiguration(&runtime.Configuration{
+				TCPTargetNetworks: []string{"10.0.0.0/8"},
+				UDPTargetNetworks: []string{},
+				ExcludedNetworks:  []string{"10.1.0.0/16"},
+			}).Return(nil)
+
+			w := testRequest(s, "0:0:1", http.MethodPut, "/v1/configuration", &Configuration{ExcludedNetworks: []string{"10.1.0.0/16"}})
+			So(w.Code, ShouldEqual, http.StatusNoContent)
+
+			w = testRequest(s, "0:0:1", http.MethodGet, "/v1/configuration", nil)
+			So(w.Code, ShouldEqual, http.StatusOK)
+
+			cfg := &Configuration{}
+			So(json.NewDecoder(w.Body).Decode(cfg), ShouldBeNil)
+			So(cfg.ExcludedNetworks, ShouldResemble, []string{"10.1.0.0/16"})
+		})
+
+		Convey("When I update the networks with an invalid network, I should get an error", func() {
+			w := testRequest(s, "0:0:1", http.MethodPut, "/v1/configuration", &Configuration{ExcludedNetworks: []string{"invalid"}})
+			So(w.Code, ShouldEqual, http.StatusBadRequest)
+		})
+	})
+}
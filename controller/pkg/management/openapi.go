@@ -0,0 +1,412 @@
+package management
+
+// OpenAPISpec is the OpenAPI description of the management API. It is served
+// at /v1/openapi.yaml.
+const OpenAPISpec = `openapi: 3.0.3
+info:
+  title: Trireme management API
+  version: v1
+  description: >
+    Local management API of the Trireme controller. It is served over a unix
+    socket, and only the root user and the authorized users and groups can use
+    it. The PU IDs must be path escaped.
+paths:
+  /v1/openapi.yaml:
+    get:
+      summary: Returns this description.
+      responses:
+        "200":
+          description: The OpenAPI description.
+          content:
+            application/yaml: {}
+  /v1/pus:
+    get:
+      summary: Lists the enforced PUs.
+      responses:
+        "200":
+          description: The PUs.
+          content:
+            application/json:
+              schema:
+                type: array
+                items:
+                  $ref: "#/components/schemas/PU"
+  /v1/pus/{id}:
+    parameters:
+      - $ref: "#/components/parameters/id"
+    get:
+      summary: Returns a PU with its runtime and its policy.
+      responses:
+        "200":
+          description: The PU.
+          content:
+            application/json:
+              schema:
+                $ref: "#/components/schemas/PUDetails"
+        "404":
+          $ref: "#/components/responses/Error"
+  /v1/pus/{id}/counters:
+    parameters:
+      - $ref: "#/components/parameters/id"
+    get:
+      summary: Returns the counters of a PU since it is enforced.
+      responses:
+        "200":
+          description: The counters by name.
+          content:
+            application/json:
+              schema:
+                type: object
+                additionalProperties:
+                  type: integer
+        "404":
+          $ref: "#/components/responses/Error"
+  /v1/pus/{id}/connections:
+    parameters:
+      - $ref: "#/components/parameters/id"
+    get:
+      summary: Returns the connections of a PU reported in the last minutes.
+      responses:
+        "200":
+          description: The connections, the most recent first.
+          content:
+            application/json:
+              schema:
+                type: array
+                items:
+                  $ref: "#/components/schemas/Connection"
+        "404":
+          $ref: "#/components/responses/Error"
+  /v1/pus/{id}/ping:
+    parameters:
+      - $ref: "#/components/parameters/id"
+    post:
+      summary: Runs a ping from a PU.
+      requestBody:
+        required: true
+        content:
+          application/json:
+            schema:
+              $ref: "#/components/schemas/PingRequest"
+      responses:
+        "202":
+          description: The ping is started, its reports are available with its ID.
+          content:
+            application/json:
+              schema:
+                type: object
+                properties:
+                  pingID:
+                    type: string
+        "400":
+          $ref: "#/components/responses/Error"
+        "404":
+          $ref: "#/components/responses/Error"
+  /v1/pus/{id}/ping/{pingID}:
+    parameters:
+      - $ref: "#/components/parameters/id"
+      - name: pingID
+        in: path
+        required: true
+        schema:
+          type: string
+    get:
+      summary: Returns the reports received for a ping.
+      responses:
+        "200":
+          description: The reports.
+          content:
+            application/json:
+              schema:
+                type: object
+                properties:
+                  pingID:
+                    type: string
+                  reports:
+                    type: array
+                    items:
+                      type: object
+        "404":
+          $ref: "#/components/responses/Error"
+  /v1/pus/{id}/trace:
+    parameters:
+      - $ref: "#/components/parameters/id"
+    post:
+      summary: Traces the packets of a PU for a duration.
+      requestBody:
+        required: true
+        content:
+          application/json:
+            schema:
+              $ref: "#/components/schemas/TraceRequest"
+      responses:
+        "202":
+          description: The tracing is enabled.
+        "400":
+          $ref: "#/components/responses/Error"
+        "404":
+          $ref: "#/components/responses/Error"
+  /v1/pus/{id}/debug:
+    parameters:
+      - $ref: "#/components/parameters/id"
+    post:
+      summary: Collects debug information for a PU.
+      requestBody:
+        required: true
+        content:
+          application/json:
+            schema:
+              $ref: "#/components/schemas/DebugRequest"
+      responses:
+        "200":
+          description: The result of the collection.
+          content:
+            application/json:
+              schema:
+                type: object
+                properties:
+                  pid:
+                    type: integer
+                  commandOutput:
+                    type: string
+        "404":
+          $ref: "#/components/responses/Error"
+  /v1/flows:
+    get:
+      summary: Streams the flows reported by the datapath.
+      parameters:
+        - name: pu
+          in: query
+          required: false
+          description: Only stream the flows of this PU.
+          schema:
+            type: string
+      responses:
+        "200":
+          description: The flows, one JSON object per line, until the request is closed.
+          content:
+            application/x-ndjson:
+              schema:
+                $ref: "#/components/schemas/Flow"
+  /v1/loglevel:
+    put:
+      summary: Changes the log level.
+      requestBody:
+        required: true
+        content:
+          application/json:
+            schema:
+              type: object
+              required: [level]
+              properties:
+                level:
+                  type: string
+                  enum: [trace, debug, info, warn, error]
+      responses:
+        "204":
+          description: The log level is changed.
+        "400":
+          $ref: "#/components/responses/Error"
+  /v1/configuration:
+    get:
+      summary: Returns the runtime configuration.
+      responses:
+        "200":
+          description: The configuration.
+          content:
+            application/json:
+              schema:
+                $ref: "#/components/schemas/Configuration"
+    put:
+      summary: Updates the runtime configuration. Only the fields that are set are updated.
+      requestBody:
+        required: true
+        content:
+          application/json:
+            schema:
+              $ref: "#/components/schemas/Configuration"
+      responses:
+        "204":
+          description: The configuration is updated.
+        "400":
+          $ref: "#/components/responses/Error"
+components:
+  parameters:
+    id:
+      name: id
+      in: path
+      required: true
+      schema:
+        type: string
+  responses:
+    Error:
+      description: The request failed.
+      content:
+        application/json:
+          schema:
+            type: object
+            properties:
+              error:
+                type: string
+  schemas:
+    PU:
+      type: object
+      properties:
+        id:
+          type: string
+        name:
+          type: string
+        type:
+          type: integer
+        pid:
+          type: integer
+        tags:
+          type: array
+          items:
+            type: string
+        ips:
+          type: object
+          additionalProperties:
+            type: string
+        created:
+          type: string
+          format: date-time
+        updated:
+          type: string
+          format: date-time
+    PUDetails:
+      allOf:
+        - $ref: "#/components/schemas/PU"
+        - type: object
+          properties:
+            runtime:
+              type: object
+            policy:
+              type: object
+    Connection:
+      type: object
+      properties:
+        sourceIP:
+          type: string
+        sourceID:
+          type: string
+        destinationIP:
+          type: string
+        destinationID:
+          type: string
+        destinationPort:
+          type: integer
+        protocol:
+          type: integer
+        action:
+          type: integer
+        policyID:
+          type: string
+        dropReason:
+          type: string
+        count:
+          type: integer
+        lastSeen:
+          type: string
+          format: date-time
+    Flow:
+      type: object
+      properties:
+        time:
+          type: string
+          format: date-time
+        puID:
+          type: string
+        sourceIP:
+          type: string
+        sourceID:
+          type: string
+        destinationIP:
+          type: string
+        destinationID:
+          type: string
+        destinationPort:
+          type: integer
+        protocol:
+          type: integer
+        action:
+          type: integer
+        policyID:
+          type: string
+        dropReason:
+          type: string
+        count:
+          type: integer
+    PingRequest:
+      type: object
+      required: [ip]
+      properties:
+        ip:
+          type: string
+        port:
+          type: integer
+        iterations:
+          type: integer
+        targetTCPNetworks:
+          type: boolean
+        excludedNetworks:
+          type: boolean
+    TraceRequest:
+      type: object
+      required: [duration]
+      properties:
+        network:
+          type: boolean
+        application:
+          type: boolean
+        iptables:
+          type: boolean
+        duration:
+          type: string
+          example: 30s
+    DebugRequest:
+      type: object
+      properties:
+        type:
+          type: string
+        filePath:
+          type: string
+          description: The file where the packets are captured.
+        pcapFilter:
+          type: string
+        commandExec:
+          type: string
+          description: The command to run in the namespace of the PU.
+        native:
+          type: boolean
+          description: Capture the packets in the datapath to rotating pcapng files.
+        duration:
+          type: string
+          description: The duration of the native capture, like 30s.
+        maxSize:
+          type: integer
+          description: The number of bytes after which the native capture stops.
+        fileSize:
+          type: integer
+          description: The size of the files of the native capture.
+        files:
+          type: integer
+          description: The number of files of the native capture.
+    Configuration:
+      type: object
+      properties:
+        tcpTargetNetworks:
+          type: array
+          items:
+            type: string
+        udpTargetNetworks:
+          type: array
+          items:
+            type: string
+        excludedNetworks:
+          type: array
+          items:
+            type: string
+        logLevel:
+          type: string
+`
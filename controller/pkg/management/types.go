@@ -0,0 +1,131 @@
+package management
+
+import (
+	"time"
+
+	"go.aporeto.io/enforcerd/trireme-lib/collector"
+	"go.aporeto.io/enforcerd/trireme-lib/common"
+	"go.aporeto.io/enforcerd/trireme-lib/policy"
+)
+
+// APIVersion is the version of the management API. It prefixes all the paths.
+const APIVersion = "v1"
+
+// PU is a processing unit enforced by the controller.
+type PU struct {
+	ID      string             `json:"id"`
+	Name    string             `json:"name"`
+	Type    common.PUType      `json:"type"`
+	PID     int                `json:"pid"`
+	Tags    []string           `json:"tags"`
+	IPs     policy.ExtendedMap `json:"ips,omitempty"`
+	Created time.Time          `json:"created"`
+	Updated time.Time          `json:"updated"`
+}
+
+// PUDetails is a processing unit with its runtime and its policy.
+type PUDetails struct {
+	PU
+	Runtime *policy.PURuntime      `json:"runtime"`
+	Policy  *policy.PUPolicyPublic `json:"policy,omitempty"`
+}
+
+// Connection is a connection of a processing unit seen by the datapath.
+type Connection struct {
+	SourceIP        string            `json:"sourceIP"`
+	SourceID        string            `json:"sourceID,omitempty"`
+	DestinationIP   string            `json:"destinationIP"`
+	DestinationID   string            `json:"destinationID,omitempty"`
+	DestinationPort uint16            `json:"destinationPort"`
+	Protocol        uint8             `json:"protocol"`
+	Action          policy.ActionType `json:"action"`
+	PolicyID        string            `json:"policyID,omitempty"`
+	DropReason      string            `json:"dropReason,omitempty"`
+	Count           int               `json:"count"`
+	LastSeen        time.Time         `json:"lastSeen"`
+}
+
+// Flow is a flow reported by the datapath.
+type Flow struct {
+	Time            time.Time         `json:"time"`
+	PUID            string            `json:"puID"`
+	SourceIP        string            `json:"sourceIP"`
+	SourceID        string            `json:"sourceID,omitempty"`
+	DestinationIP   string            `json:"destinationIP"`
+	DestinationID   string            `json:"destinationID,omitempty"`
+	DestinationPort uint16            `json:"destinationPort"`
+	Protocol        uint8             `json:"protocol"`
+	Action          policy.ActionType `json:"action"`
+	PolicyID        string            `json:"policyID,omitempty"`
+	DropReason      string            `json:"dropReason,omitempty"`
+	Count           int               `json:"count"`
+}
+
+// PingRequest is the request to run a ping from a processing unit.
+type PingRequest struct {
+	IP                string `json:"ip"`
+	Port              uint16 `json:"port"`
+	Iterations        int    `json:"iterations,omitempty"`
+	TargetTCPNetworks bool   `json:"targetTCPNetworks,omitempty"`
+	ExcludedNetworks  bool   `json:"excludedNetworks,omitempty"`
+}
+
+// PingResponse is the response to a ping request.
+type PingResponse struct {
+	PingID string `json:"pingID"`
+}
+
+// PingResult contains the reports received for a ping.
+type PingResult struct {
+	PingID  string                  `json:"pingID"`
+	Reports []*collector.PingReport `json:"reports"`
+}
+
+// DebugRequest is the request to collect debug information for a processing unit.
+// A native capture writes the packets seen by the datapath to rotating pcapng
+// files. Its duration is a Go duration like 30s.
+type DebugRequest struct {
+	Type        string `json:"type,omitempty"`
+	FilePath    string `json:"filePath,omitempty"`
+	PcapFilter  string `json:"pcapFilter,omitempty"`
+	CommandExec string `json:"commandExec,omitempty"`
+	Native      bool   `json:"native,omitempty"`
+	Duration    string `json:"duration,omitempty"`
+	MaxSize     int64  `json:"maxSize,omitempty"`
+	FileSize    int64  `json:"fileSize,omitempty"`
+	Files       int    `json:"files,omitempty"`
+}
+
+// DebugResponse is the result of a debug collect.
+type DebugResponse struct {
+	PID           int    `json:"pid,omitempty"`
+	CommandOutput string `json:"commandOutput,omitempty"`
+}
+
+// TraceRequest is the request to trace the packets of a processing unit. The
+// duration is a Go duration like 30s.
+type TraceRequest struct {
+	Network     bool   `json:"network,omitempty"`
+	Application bool   `json:"application,omitempty"`
+	IPTables    bool   `json:"iptables,omitempty"`
+	Duration    string `json:"duration"`
+}
+
+// LogLevelRequest is the request to change the log level.
+type LogLevelRequest struct {
+	Level string `json:"level"`
+}
+
+// Configuration is the runtime configuration of the controller. Only the
+// fields that are set are updated.
+type Configuration struct {
+	TCPTargetNetworks []string `json:"tcpTargetNetworks,omitempty"`
+	UDPTargetNetworks []string `json:"udpTargetNetworks,omitempty"`
+	ExcludedNetworks  []string `json:"excludedNetworks,omitempty"`
+	LogLevel          string   `json:"logLevel,omitempty"`
+}
+
+// Error is the body of the responses of failed requests.
+type Error struct {
+	Error string `json:"error"`
+}
@@ -15,6 +15,9 @@ const (
 
 	// minTCPHeaderLen is the min TCP header length
 	minTCPHeaderLen = 20
+
+	// maxTCPHeaderLen is the max TCP header length
+	maxTCPHeaderLen = 60
 )
 
 // IP Header field position constants
@@ -137,6 +140,16 @@ const (
 
 	// TCPMssOptionLen is the type for MSS option
 	TCPMssOptionLen = uint8(4)
+
+	// TCPEncryptionOption is the experimental option number that carries the
+	// authentication data of encrypted payloads
+	TCPEncryptionOption = uint8(253)
+
+	// tcpOptionEnd is the end of option list
+	tcpOptionEnd = uint8(0)
+
+	// tcpOptionNop is the no operation option used for padding
+	tcpOptionNop = uint8(1)
 )
 
 // UDP related constants.
@@ -352,6 +352,23 @@ func (p *Packet) UDPDataDetach() {
 	p.ipHdr.Buffer = p.ipHdr.Buffer[:p.ipHdr.ipHeaderLen+UDPDataPos]
 }
 
+// SetUDPData replaces the UDP payload and updates the lengths and the checksums.
+// The data can be a slice of the current payload.
+func (p *Packet) SetUDPData(data []byte) {
+
+	oldLength := p.ipHdr.ipTotalLength
+	p.ipHdr.Buffer = append(p.ipHdr.Buffer[:int(p.ipHdr.ipHeaderLen)+UDPDataPos], data...)
+
+	// IP Header Processing
+	p.FixupIPHdrOnDataModify(oldLength, uint16(len(p.ipHdr.Buffer)))
+
+	buffer := p.ipHdr.Buffer[p.ipHdr.ipHeaderLen:]
+	p.udpHdr.udpLength = uint16(len(buffer))
+	binary.BigEndian.PutUint16(buffer[udpLengthPos:udpLengthPos+2], p.udpHdr.udpLength)
+
+	p.fixupUDPChecksum()
+}
+
 // CreateReverseFlowPacket modifies the packet for reverse flow.
 func (p *Packet) CreateReverseFlowPacket() {
 
@@ -594,6 +594,121 @@ func (p *Packet) FixuptcpHdrOnTCPDataAttach(tcpOptionsLen uint16) {
 	p.tcpHdr.tcpTotalLength = uint16(len(p.ipHdr.Buffer[p.ipHdr.ipHeaderLen:]))
 }
 
+// TCPOption returns the TCP option of the given kind including its kind and
+// length bytes. The option is not copied and can be modified in place.
+func (p *Packet) TCPOption(kind uint8) ([]byte, bool) {
+
+	start, length, ok := p.findTCPOption(kind)
+	if !ok {
+		return nil, false
+	}
+
+	return p.ipHdr.Buffer[start : start+length], true
+}
+
+// InsertTCPOption inserts an option in front of the TCP options and updates
+// the lengths and the checksums. The option length must be a multiple of 4.
+func (p *Packet) InsertTCPOption(option []byte) error {
+
+	if len(option) == 0 || len(option)%4 != 0 {
+		return fmt.Errorf("invalid tcp option length: %d", len(option))
+	}
+
+	if int(p.TCPDataStartBytes())+len(option) > maxTCPHeaderLen {
+		return fmt.Errorf("no room for tcp option: headerlength=%d optionlength=%d", p.TCPDataStartBytes(), len(option))
+	}
+
+	offset := int(p.ipHdr.ipHeaderLen) + minTCPHeaderLen
+
+	buffer := make([]byte, 0, len(p.ipHdr.Buffer)+len(option))
+	buffer = append(buffer, p.ipHdr.Buffer[:offset]...)
+	buffer = append(buffer, option...)
+	buffer = append(buffer, p.ipHdr.Buffer[offset:]...)
+
+	p.updateTCPHeaderLength(buffer, int(p.tcpHdr.tcpDataOffset)+len(option)/4)
+
+	return nil
+}
+
+// RemoveTCPOption removes the TCP option of the given kind and updates the
+// lengths and the checksums. The options that follow are moved up and padded
+// with no-op options to keep the header length a multiple of 4.
+func (p *Packet) RemoveTCPOption(kind uint8) error {
+
+	start, length, ok := p.findTCPOption(kind)
+	if !ok {
+		return fmt.Errorf("tcp option %d not found", kind)
+	}
+
+	end := int(p.ipHdr.ipHeaderLen) + int(p.TCPDataStartBytes())
+	removed := length &^ 3
+
+	copy(p.ipHdr.Buffer[start:], p.ipHdr.Buffer[start+length:end])
+	for i := end - length; i < end-removed; i++ {
+		p.ipHdr.Buffer[i] = tcpOptionNop
+	}
+
+	buffer := append(p.ipHdr.Buffer[:end-removed:end-removed], p.ipHdr.Buffer[end:]...)
+
+	p.updateTCPHeaderLength(buffer, int(p.tcpHdr.tcpDataOffset)-removed/4)
+
+	return nil
+}
+
+// findTCPOption returns the position and the length of an option in the buffer.
+func (p *Packet) findTCPOption(kind uint8) (int, int, bool) {
+
+	start := int(p.ipHdr.ipHeaderLen) + minTCPHeaderLen
+	end := int(p.ipHdr.ipHeaderLen) + int(p.TCPDataStartBytes())
+	if end > len(p.ipHdr.Buffer) {
+		return 0, 0, false
+	}
+
+	for i := start; i < end; {
+		switch p.ipHdr.Buffer[i] {
+		case tcpOptionEnd:
+			return 0, 0, false
+		case tcpOptionNop:
+			i++
+			continue
+		}
+
+		if i+1 >= end {
+			return 0, 0, false
+		}
+
+		length := int(p.ipHdr.Buffer[i+1])
+		if length < 2 || i+length > end {
+			return 0, 0, false
+		}
+
+		if p.ipHdr.Buffer[i] == kind {
+			return i, length, true
+		}
+
+		i += length
+	}
+
+	return 0, 0, false
+}
+
+// updateTCPHeaderLength replaces the buffer after the TCP header length has
+// changed and fixes the IP and TCP headers.
+func (p *Packet) updateTCPHeaderLength(buffer []byte, dataOffset int) {
+
+	oldLength := p.ipHdr.ipTotalLength
+	p.ipHdr.Buffer = buffer
+
+	p.FixupIPHdrOnDataModify(oldLength, uint16(len(buffer)))
+
+	tcpBuffer := p.ipHdr.Buffer[p.ipHdr.ipHeaderLen:]
+	p.tcpHdr.tcpDataOffset = uint8(dataOffset)
+	tcpBuffer[tcpDataOffsetPos] = p.tcpHdr.tcpDataOffset<<4 | tcpBuffer[tcpDataOffsetPos]&^tcpDataOffsetMask
+	p.tcpHdr.tcpTotalLength = uint16(len(tcpBuffer))
+
+	p.UpdateTCPChecksum()
+}
+
 // L4FlowHash calculate a hash string based on the 4-tuple. It returns the cached
 // value and does not re-calculate it. This leads to performance gains.
 func (p *Packet) L4FlowHash() string {
@@ -592,3 +592,77 @@ func TestNewIpv6TCPPacket(t *testing.T) {
 		assert.Equal(t, tcpFlags, p.tcpHdr.tcpFlags, "TCP flags should equal")
 	}
 }
+
+func TestTCPOptions(t *testing.T) {
+
+	p, err := NewIpv4TCPPacket(0, TCPAckMask, "10.0.0.30", "10.0.0.25", 3000, 80)
+	assert.NoError(t, err)
+
+	payload := []byte("payload")
+	err = p.UpdatePacketBuffer(append(p.GetBuffer(0), payload...), 0)
+	assert.NoError(t, err)
+
+	original := append([]byte{}, p.GetBuffer(0)...)
+
+	_, ok := p.TCPOption(TCPEncryptionOption)
+	assert.False(t, ok, "option should not be found")
+
+	option := []byte{TCPEncryptionOption, 8, 1, 2, 3, 4, 5, 6}
+	err = p.InsertTCPOption(option)
+	assert.NoError(t, err)
+
+	found, ok := p.TCPOption(TCPEncryptionOption)
+	assert.True(t, ok, "option should be found")
+	assert.Equal(t, option, found, "option should equal")
+	assert.Equal(t, uint16(minTCPHeaderLen+8), p.TCPDataStartBytes(), "TCP header length should include the option")
+	assert.Equal(t, uint16(len(original)+8), p.IPTotalLen(), "IP length should include the option")
+	assert.Equal(t, payload, p.ReadTCPData(), "payload should not change")
+	assert.True(t, p.VerifyIPv4Checksum(), "IP checksum should be valid")
+	assert.True(t, p.VerifyTCPChecksum(), "TCP checksum should be valid")
+
+	err = p.InsertTCPOption(make([]byte, 36))
+	assert.Error(t, err, "options should not exceed the TCP header")
+
+	err = p.InsertTCPOption([]byte{TCPEncryptionOption, 3, 0})
+	assert.Error(t, err, "option length should be a multiple of 4")
+
+	err = p.RemoveTCPOption(TCPEncryptionOption)
+	assert.NoError(t, err)
+	assert.Equal(t, original, p.GetBuffer(0), "packet should be restored")
+
+	err = p.RemoveTCPOption(TCPEncryptionOption)
+	assert.Error(t, err, "option should not be found")
+
+	err = p.InsertTCPOption([]byte{TCPMssOption, TCPMssOptionLen, 5, 180, TCPEncryptionOption, 6, 1, 2, 3, 4, 1, 1})
+	assert.NoError(t, err)
+
+	err = p.RemoveTCPOption(TCPEncryptionOption)
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(minTCPHeaderLen+8), p.TCPDataStartBytes(), "TCP header length should stay aligned")
+	assert.Equal(t, payload, p.ReadTCPData(), "payload should not change")
+	assert.True(t, p.VerifyTCPChecksum(), "TCP checksum should be valid")
+
+	mss, ok := p.TCPOption(TCPMssOption)
+	assert.True(t, ok, "option should be found")
+	assert.Equal(t, []byte{TCPMssOption, TCPMssOptionLen, 5, 180}, mss, "option should equal")
+}
+
+func TestSetUDPData(t *testing.T) {
+
+	udpPacket, _ := hex.DecodeString("4500004b1a294000401108b90a8080800a0c82b400350e1700371e316e4f8180000100010000000003617069066272616e636802696f0000010001c00c000100010000003b00046354e9fa")
+
+	pkt, err := New(0, udpPacket, "0", true)
+	assert.NoError(t, err)
+
+	data := append([]byte("prefix"), pkt.GetUDPData()...)
+	pkt.SetUDPData(data)
+	assert.Equal(t, data, pkt.GetUDPData(), "payload should equal")
+	assert.True(t, pkt.VerifyIPv4Checksum(), "IP checksum should be valid")
+
+	pkt.SetUDPData(pkt.GetUDPData()[6:])
+	assert.Equal(t, udpPacket[28:], pkt.GetUDPData(), "payload should be restored")
+
+	parsed, err := New(0, pkt.GetBuffer(0), "0", true)
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(len(udpPacket)), parsed.IPTotalLen(), "IP length should equal")
+}
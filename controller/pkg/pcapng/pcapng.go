@@ -0,0 +1,173 @@
+// Package pcapng writes packets in the pcapng format. The packets are raw IP
+// packets, like the ones seen by the datapath, and each packet can carry a
+// comment and a direction.
+package pcapng
+
+import (
+	"encoding/binary"
+	"io"
+	"time"
+)
+
+// Direction is the direction of a packet.
+type Direction uint32
+
+// Directions of the packets, as defined for the epb_flags option.
+const (
+	DirectionUnknown  Direction = 0
+	DirectionInbound  Direction = 1
+	DirectionOutbound Direction = 2
+)
+
+// LinkTypeRaw is the link type of raw IPv4 and IPv6 packets.
+const LinkTypeRaw = 101
+
+// Block types and options used by the writer.
+const (
+	blockTypeSectionHeader    = 0x0A0D0D0A
+	blockTypeInterface        = 0x00000001
+	blockTypeEnhancedPacket   = 0x00000006
+	byteOrderMagic            = 0x1A2B3C4D
+	optionEndOfOpt            = 0
+	optionComment             = 1
+	optionShbUserApplication  = 4
+	optionEpbFlags            = 2
+	sectionLengthUnspecified  = 0xFFFFFFFFFFFFFFFF
+	userApplication           = "trireme"
+	maxOptionLength           = 0xFFFF
+	enhancedPacketBlockLength = 32
+)
+
+// Packet is a packet written to a pcapng file.
+type Packet struct {
+	Timestamp time.Time
+	Data      []byte
+	// Length is the original length of the packet. The length of the data
+	// is used if it is zero.
+	Length    int
+	Direction Direction
+	Comment   string
+}
+
+// Writer writes a pcapng section with a single raw IP interface.
+type Writer struct {
+	w       io.Writer
+	snapLen uint32
+}
+
+// NewWriter writes the section header and the interface description blocks
+// and returns a writer of packets. A snap length of 0 means no limit.
+func NewWriter(w io.Writer, snapLen uint32) (*Writer, error) {
+
+	pw := &Writer{
+		w:       w,
+		snapLen: snapLen,
+	}
+
+	if err := pw.writeHeader(); err != nil {
+		return nil, err
+	}
+
+	return pw, nil
+}
+
+// WritePacket writes a packet as an enhanced packet block and returns the
+// number of bytes written.
+func (w *Writer) WritePacket(p *Packet) (int, error) {
+
+	data := p.Data
+	if w.snapLen > 0 && uint32(len(data)) > w.snapLen {
+		data = data[:w.snapLen]
+	}
+
+	length := p.Length
+	if length < len(p.Data) {
+		length = len(p.Data)
+	}
+
+	comment := p.Comment
+	if len(comment) > maxOptionLength {
+		comment = comment[:maxOptionLength]
+	}
+
+	options := []byte{}
+	if comment != "" {
+		options = appendOption(options, optionComment, []byte(comment))
+	}
+	if p.Direction != DirectionUnknown {
+		flags := make([]byte, 4)
+		binary.LittleEndian.PutUint32(flags, uint32(p.Direction))
+		options = appendOption(options, optionEpbFlags, flags)
+	}
+	if len(options) > 0 {
+		options = appendOption(options, optionEndOfOpt, nil)
+	}
+
+	blockLength := enhancedPacketBlockLength + pad(len(data)) + len(options)
+
+	ts := uint64(p.Timestamp.UnixNano() / int64(time.Microsecond))
+
+	buf := make([]byte, blockLength)
+	binary.LittleEndian.PutUint32(buf[0:], blockTypeEnhancedPacket)
+	binary.LittleEndian.PutUint32(buf[4:], uint32(blockLength))
+	binary.LittleEndian.PutUint32(buf[8:], 0)
+	binary.LittleEndian.PutUint32(buf[12:], uint32(ts>>32))
+	binary.LittleEndian.PutUint32(buf[16:], uint32(ts))
+	binary.LittleEndian.PutUint32(buf[20:], uint32(len(data)))
+	binary.LittleEndian.PutUint32(buf[24:], uint32(length))
+	copy(buf[28:], data)
+	copy(buf[28+pad(len(data)):], options)
+	binary.LittleEndian.PutUint32(buf[blockLength-4:], uint32(blockLength))
+
+	return w.w.Write(buf)
+}
+
+const interfaceLength = 20
+
+func (w *Writer) writeHeader() error {
+
+	options := appendOption(nil, optionShbUserApplication, []byte(userApplication))
+	options = appendOption(options, optionEndOfOpt, nil)
+
+	shbLength := 28 + len(options)
+	shb := make([]byte, shbLength)
+	binary.LittleEndian.PutUint32(shb[0:], blockTypeSectionHeader)
+	binary.LittleEndian.PutUint32(shb[4:], uint32(shbLength))
+	binary.LittleEndian.PutUint32(shb[8:], byteOrderMagic)
+	binary.LittleEndian.PutUint16(shb[12:], 1)
+	binary.LittleEndian.PutUint16(shb[14:], 0)
+	binary.LittleEndian.PutUint64(shb[16:], sectionLengthUnspecified)
+	copy(shb[24:], options)
+	binary.LittleEndian.PutUint32(shb[shbLength-4:], uint32(shbLength))
+
+	idb := make([]byte, interfaceLength)
+	binary.LittleEndian.PutUint32(idb[0:], blockTypeInterface)
+	binary.LittleEndian.PutUint32(idb[4:], interfaceLength)
+	binary.LittleEndian.PutUint16(idb[8:], LinkTypeRaw)
+	binary.LittleEndian.PutUint16(idb[10:], 0)
+	binary.LittleEndian.PutUint32(idb[12:], w.snapLen)
+	binary.LittleEndian.PutUint32(idb[16:], interfaceLength)
+
+	if _, err := w.w.Write(shb); err != nil {
+		return err
+	}
+
+	_, err := w.w.Write(idb)
+	return err
+}
+
+// appendOption appends an option padded to 32 bits.
+func appendOption(b []byte, code uint16, value []byte) []byte {
+
+	option := make([]byte, 4+pad(len(value)))
+	binary.LittleEndian.PutUint16(option[0:], code)
+	binary.LittleEndian.PutUint16(option[2:], uint16(len(value)))
+	copy(option[4:], value)
+
+	return append(b, option...)
+}
+
+// pad returns the length rounded up to 32 bits.
+func pad(length int) int {
+	return (length + 3) &^ 3
+}
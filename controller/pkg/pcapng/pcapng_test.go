@@ -0,0 +1,165 @@
+package pcapng
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// block is a block read back from a pcapng file.
+type block struct {
+	blockType uint32
+	body      []byte
+}
+
+func readBlocks(b []byte) []block {
+
+	blocks := []block{}
+	for len(b) >= 12 {
+		length := binary.LittleEndian.Uint32(b[4:])
+		blocks = append(blocks, block{
+			blockType: binary.LittleEndian.Uint32(b[0:]),
+			body:      b[8 : length-4],
+		})
+		b = b[length:]
+	}
+
+	return blocks
+}
+
+func readOptions(b []byte) map[uint16][]byte {
+
+	options := map[uint16][]byte{}
+	for len(b) >= 4 {
+		code := binary.LittleEndian.Uint16(b[0:])
+		length := int(binary.LittleEndian.Uint16(b[2:]))
+		if code == optionEndOfOpt {
+			break
+		}
+		options[code] = b[4 : 4+length]
+		b = b[4+pad(length):]
+	}
+
+	return options
+}
+
+func TestWriter(t *testing.T) {
+
+	Convey("Given a pcapng writer", t, func() {
+		buf := new(bytes.Buffer)
+		w, err := NewWriter(buf, 0)
+		So(err, ShouldBeNil)
+
+		Convey("The section and the interface should be written", func() {
+			blocks := readBlocks(buf.Bytes())
+			So(len(blocks), ShouldEqual, 2)
+			So(blocks[0].blockType, ShouldEqual, blockTypeSectionHeader)
+			So(binary.LittleEndian.Uint32(blocks[0].body), ShouldEqual, byteOrderMagic)
+			So(blocks[1].blockType, ShouldEqual, blockTypeInterface)
+			So(binary.LittleEndian.Uint16(blocks[1].body), ShouldEqual, LinkTypeRaw)
+		})
+
+		Convey("When I write a packet with a comment and a direction", func() {
+			ts := time.Unix(1600000000, 123456000)
+			n, err := w.WritePacket(&Packet{
+				Timestamp: ts,
+				Data:      []byte{0x45, 0x00, 0x00, 0x14, 0x01},
+				Length:    20,
+				Direction: DirectionInbound,
+				Comment:   "verdict=accept",
+			})
+			So(err, ShouldBeNil)
+
+			blocks := readBlocks(buf.Bytes())
+			So(len(blocks), ShouldEqual, 3)
+			So(n, ShouldEqual, len(blocks[2].body)+12)
+
+			epb := blocks[2].body
+			So(blocks[2].blockType, ShouldEqual, blockTypeEnhancedPacket)
+			tsValue := uint64(binary.LittleEndian.Uint32(epb[4:]))<<32 | uint64(binary.LittleEndian.Uint32(epb[8:]))
+			So(tsValue, ShouldEqual, uint64(ts.UnixNano()/int64(time.Microsecond)))
+			So(binary.LittleEndian.Uint32(epb[12:]), ShouldEqual, 5)
+			So(binary.LittleEndian.Uint32(epb[16:]), ShouldEqual, 20)
+			So(epb[20:25], ShouldResemble, []byte{0x45, 0x00, 0x00, 0x14, 0x01})
+
+			options := readOptions(epb[20+pad(5):])
+			So(string(options[optionComment]), ShouldEqual, "verdict=accept")
+			So(binary.LittleEndian.Uint32(options[optionEpbFlags]), ShouldEqual, uint32(DirectionInbound))
+		})
+	})
+
+	Convey("Given a pcapng writer with a snap length", t, func() {
+		buf := new(bytes.Buffer)
+		w, err := NewWriter(buf, 2)
+		So(err, ShouldBeNil)
+
+		Convey("The packets should be truncated", func() {
+			_, err := w.WritePacket(&Packet{Data: []byte{1, 2, 3, 4}})
+			So(err, ShouldBeNil)
+
+			epb := readBlocks(buf.Bytes())[2].body
+			So(binary.LittleEndian.Uint32(epb[12:]), ShouldEqual, 2)
+			So(binary.LittleEndian.Uint32(epb[16:]), ShouldEqual, 4)
+			So(len(epb), ShouldEqual, 24)
+		})
+	})
+}
+
+func TestRotatingWriter(t *testing.T) {
+
+	Convey("Given a temporary directory", t, func() {
+		dir, err := ioutil.TempDir("", "pcapng")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir) // nolint: errcheck
+
+		path := filepath.Join(dir, "capture.pcapng")
+
+		Convey("I should not create a ring without files", func() {
+			_, err := NewRotatingWriter(path, 100, 0, 0)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("A ring of one file should be written to the path", func() {
+			r, err := NewRotatingWriter(path, 0, 1, 0)
+			So(err, ShouldBeNil)
+			So(r.WritePacket(&Packet{Data: make([]byte, 100)}), ShouldBeNil)
+			So(r.Close(), ShouldBeNil)
+
+			data, err := ioutil.ReadFile(path)
+			So(err, ShouldBeNil)
+			So(len(readBlocks(data)), ShouldEqual, 3)
+			So(r.Written(), ShouldEqual, len(data))
+		})
+
+		Convey("A ring of two files should rotate and overwrite the oldest file", func() {
+			r, err := NewRotatingWriter(path, 150, 2, 0)
+			So(err, ShouldBeNil)
+			So(r.Files(), ShouldResemble, []string{
+				filepath.Join(dir, "capture.0.pcapng"),
+				filepath.Join(dir, "capture.1.pcapng"),
+			})
+
+			for i := 0; i < 3; i++ {
+				So(r.WritePacket(&Packet{Data: make([]byte, 100)}), ShouldBeNil)
+			}
+			So(r.Close(), ShouldBeNil)
+			So(r.WritePacket(&Packet{}), ShouldNotBeNil)
+
+			first, err := ioutil.ReadFile(r.Files()[0])
+			So(err, ShouldBeNil)
+			second, err := ioutil.ReadFile(r.Files()[1])
+			So(err, ShouldBeNil)
+
+			// The third packet is written to the first file again.
+			So(len(readBlocks(first)), ShouldEqual, 3)
+			So(len(readBlocks(second)), ShouldEqual, 3)
+			So(r.Written(), ShouldBeGreaterThan, len(first)+len(second))
+		})
+	})
+}
@@ -0,0 +1,162 @@
+package pcapng
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// RotatingWriter writes packets to a ring of pcapng files. When the current
+// file reaches the file size, the writer moves to the next file of the ring
+// and overwrites it. The files are named after the path with their index
+// before the extension, like capture.0.pcapng, capture.1.pcapng and so on.
+type RotatingWriter struct {
+	path     string
+	fileSize int64
+	files    int
+	snapLen  uint32
+
+	file    *os.File
+	writer  *Writer
+	index   int
+	current int64
+	written int64
+	sync.Mutex
+}
+
+// NewRotatingWriter creates the first file of the ring. A ring of one file
+// is written to the path itself and is never rotated.
+func NewRotatingWriter(path string, fileSize int64, files int, snapLen uint32) (*RotatingWriter, error) {
+
+	if files < 1 {
+		return nil, fmt.Errorf("invalid number of files: %d", files)
+	}
+
+	if files > 1 && fileSize <= 0 {
+		return nil, fmt.Errorf("invalid file size: %d", fileSize)
+	}
+
+	r := &RotatingWriter{
+		path:     path,
+		fileSize: fileSize,
+		files:    files,
+		snapLen:  snapLen,
+	}
+
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// WritePacket writes a packet to the current file and rotates it if needed.
+func (r *RotatingWriter) WritePacket(p *Packet) error {
+
+	r.Lock()
+	defer r.Unlock()
+
+	if r.file == nil {
+		return fmt.Errorf("writer is closed")
+	}
+
+	if r.files > 1 && r.current >= r.fileSize {
+		if err := r.file.Close(); err != nil {
+			return err
+		}
+		r.index = (r.index + 1) % r.files
+		if err := r.open(); err != nil {
+			return err
+		}
+	}
+
+	n, err := r.writer.WritePacket(p)
+	r.current += int64(n)
+	r.written += int64(n)
+
+	return err
+}
+
+// Written returns the number of bytes written to all the files.
+func (r *RotatingWriter) Written() int64 {
+
+	r.Lock()
+	defer r.Unlock()
+
+	return r.written
+}
+
+// Files returns the names of the files of the ring.
+func (r *RotatingWriter) Files() []string {
+
+	names := make([]string, r.files)
+	for i := range names {
+		names[i] = r.name(i)
+	}
+
+	return names
+}
+
+// Close closes the current file.
+func (r *RotatingWriter) Close() error {
+
+	r.Lock()
+	defer r.Unlock()
+
+	if r.file == nil {
+		return nil
+	}
+
+	err := r.file.Close()
+	r.file = nil
+
+	return err
+}
+
+func (r *RotatingWriter) open() error {
+
+	file, err := os.OpenFile(r.name(r.index), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("unable to create capture file: %s", err)
+	}
+
+	counter := &countingWriter{file: file}
+	writer, err := NewWriter(counter, r.snapLen)
+	if err != nil {
+		file.Close() // nolint: errcheck
+		return fmt.Errorf("unable to write capture file header: %s", err)
+	}
+
+	r.file = file
+	r.writer = writer
+	r.current = counter.n
+	r.written += counter.n
+
+	return nil
+}
+
+func (r *RotatingWriter) name(index int) string {
+
+	if r.files == 1 {
+		return r.path
+	}
+
+	ext := filepath.Ext(r.path)
+
+	return fmt.Sprintf("%s.%d%s", strings.TrimSuffix(r.path, ext), index, ext)
+}
+
+type countingWriter struct {
+	file *os.File
+	n    int64
+}
+
+func (c *countingWriter) Write(b []byte) (int, error) {
+
+	n, err := c.file.Write(b)
+	c.n += int64(n)
+
+	return n, err
+}
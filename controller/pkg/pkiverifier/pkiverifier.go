@@ -1,14 +1,20 @@
 package pkiverifier
 
 import (
+	"crypto"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/elliptic"
 	"crypto/x509"
 	"errors"
+	"fmt"
 	"math/big"
+	"path"
+	"strings"
 	"time"
 
 	jwt "github.com/dgrijalva/jwt-go"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/secrets/signer"
 	"go.aporeto.io/enforcerd/trireme-lib/utils/cache"
 	"go.uber.org/zap"
 )
@@ -16,6 +22,9 @@ import (
 const (
 	// defaultValidity is the default cache validity in seconds
 	defaultValidity = 1
+
+	// namespaceTagKey is the key of the namespace tags.
+	namespaceTagKey = "$namespace"
 )
 
 // PKITokenIssuer is the interface of an object that can issue a PKI token.
@@ -29,51 +38,139 @@ type PKITokenVerifier interface {
 }
 
 type verifierClaims struct {
-	X    *big.Int
-	Y    *big.Int
+	// X and Y are the coordinates of an ECDSA P-256 public key.
+	X *big.Int `json:"X,omitempty"`
+	Y *big.Int `json:"Y,omitempty"`
+	// Key is an Ed25519 public key.
+	Key  []byte   `json:"k,omitempty"`
 	Tags []string `json:"tags,omitempty"`
+	// Serial is the serial number of the certificate and AuthorityKeyID is
+	// the key identifier of its issuer. They are used to check its revocation
+	// against the CRL of its issuer.
+	Serial         *big.Int `json:"sn,omitempty"`
+	AuthorityKeyID []byte   `json:"ak,omitempty"`
 	jwt.StandardClaims
 }
 
 // PKIControllerInfo holds the controller information about public keys
 type PKIControllerInfo struct {
-	Namespace      string // The namespace of the public key.
-	Controller     string // The controller or control plane of the public key.
-	SameController bool   // Does the public key come from the same controller
+	Namespace      string         // The namespace of the public key.
+	Controller     string         // The controller or control plane of the public key.
+	SameController bool           // Does the public key come from the same controller
+	Federation     *PKIFederation // The policy of the federated trust domain of the public key, if any.
 }
 
-// PKIPublicKey holds information about public keys
+// PKIPublicKey holds information about public keys. The public key is an
+// *ecdsa.PublicKey or an ed25519.PublicKey.
 type PKIPublicKey struct {
-	PublicKey  *ecdsa.PublicKey
+	PublicKey  crypto.PublicKey
 	Controller *PKIControllerInfo
+	// Federation is set when the public key belongs to a federated trust
+	// domain. The tags of its tokens are rewritten with the policy of the
+	// domain.
+	Federation *PKIFederation
+}
+
+// PKIFederation holds the policy applied to the tags of the tokens signed by
+// the controllers of a federated trust domain, and to the tags carried by the
+// tokens of its processing units, so that they can not be mistaken for the
+// tags of the local controllers.
+type PKIFederation struct {
+	// TrustDomain is the name of the federated trust domain. It is reported
+	// as the controller of the tokens.
+	TrustDomain string
+	// NamespacePrefix is prepended to the values of the namespace tags.
+	NamespacePrefix string
+	// TagRewrites maps the tag keys of the trust domain to local tag keys.
+	// The tags that are not mapped, or mapped to an empty key, are dropped.
+	TagRewrites map[string]string
+}
+
+// Rewrite returns the tags rewritten with the policy of the trust domain. Only
+// the tags with a mapped key, and the namespace tags when there is a namespace
+// prefix, are kept. All the other tags are dropped.
+func (f *PKIFederation) Rewrite(tags []string) []string {
+
+	rewritten := make([]string, 0, len(tags))
+
+	for _, tag := range tags {
+
+		parts := strings.SplitN(tag, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		key, value := parts[0], parts[1]
+		newKey, ok := f.TagRewrites[key]
+		switch {
+		case ok && newKey == "":
+			continue
+		case ok:
+			key = newKey
+		case key != namespaceTagKey || f.NamespacePrefix == "":
+			continue
+		}
+
+		if key == namespaceTagKey && f.NamespacePrefix != "" {
+			value = path.Join(f.NamespacePrefix, value)
+		}
+
+		rewritten = append(rewritten, key+"="+value)
+	}
+
+	return rewritten
+}
+
+// controllerInfo returns the controller information of the tokens of the
+// trust domain. They never come from the same controller.
+func (f *PKIFederation) controllerInfo() *PKIControllerInfo {
+	return &PKIControllerInfo{
+		Namespace:  f.NamespacePrefix,
+		Controller: f.TrustDomain,
+		Federation: f,
+	}
 }
 
 type tokenManager struct {
 	publicKeys []*PKIPublicKey
-	privateKey *ecdsa.PrivateKey
+	privateKey crypto.Signer
 	signMethod jwt.SigningMethod
 	keycache   cache.DataStore
 	validity   time.Duration
 }
 
-// DatapathKey holds the data path key with the corresponding claims.
+// DatapathKey holds the data path key with the corresponding claims. The
+// public key is an *ecdsa.PublicKey or an ed25519.PublicKey.
 type DatapathKey struct {
-	PublicKey  *ecdsa.PublicKey
+	PublicKey  crypto.PublicKey
 	Tags       []string
 	Expiration time.Time
 	Controller *PKIControllerInfo
+	// Serial and AuthorityKeyID identify the certificate of the public key
+	// and its issuer.
+	Serial         *big.Int
+	AuthorityKeyID []byte
 }
 
-// NewPKIIssuer initializes a new signer structure
-func NewPKIIssuer(privateKey *ecdsa.PrivateKey) PKITokenIssuer {
+// NewPKIIssuer initializes a new signer structure. The private key can be an
+// *ecdsa.PrivateKey, an ed25519.PrivateKey or any crypto.Signer holding a
+// P-256 or an Ed25519 key.
+func NewPKIIssuer(privateKey crypto.Signer) PKITokenIssuer {
+
+	signMethod := signer.SigningMethodES256
+	if _, ok := privateKey.Public().(ed25519.PublicKey); ok {
+		signMethod = signer.SigningMethodEdDSA
+	}
 
 	return &tokenManager{
 		privateKey: privateKey,
-		signMethod: jwt.SigningMethodES256,
+		signMethod: signMethod,
 	}
 }
 
-// NewPKIVerifier returns a new PKIConfiguration.
+// NewPKIVerifier returns a new PKIConfiguration. The public keys of the
+// federated trust domains are accepted along with the local ones, and the tags
+// of their tokens are rewritten with the policy of their domain.
 func NewPKIVerifier(publicKeys []*PKIPublicKey, cacheValidity time.Duration) PKITokenVerifier {
 
 	validity := defaultValidity * time.Second
@@ -106,23 +203,31 @@ func (p *tokenManager) Verify(token []byte) (*DatapathKey, error) {
 			continue
 		}
 
-		t, err = jwt.ParseWithClaims(tokenString, claims, func(*jwt.Token) (interface{}, error) { // nolint
-			return pk.PublicKey, nil
+		t, err = jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (interface{}, error) { // nolint
+			return verifyingKey(t.Method, pk.PublicKey)
 		})
 		if err != nil || !t.Valid {
 			continue
 		}
 
+		publicKey, err := claims.publicKey()
+		if err != nil {
+			return nil, err
+		}
+
 		expTime := time.Unix(claims.ExpiresAt, 0)
 		dp := &DatapathKey{
-			PublicKey: &ecdsa.PublicKey{
-				Curve: elliptic.P256(),
-				X:     claims.X,
-				Y:     claims.Y,
-			},
-			Tags:       claims.Tags,
-			Expiration: expTime,
-			Controller: pk.Controller,
+			PublicKey:      publicKey,
+			Tags:           claims.Tags,
+			Expiration:     expTime,
+			Controller:     pk.Controller,
+			Serial:         claims.Serial,
+			AuthorityKeyID: claims.AuthorityKeyID,
+		}
+
+		if pk.Federation != nil {
+			dp.Tags = pk.Federation.Rewrite(claims.Tags)
+			dp.Controller = pk.Federation.controllerInfo()
 		}
 
 		p.keycache.AddOrUpdate(tokenString, dp)
@@ -146,12 +251,22 @@ func (p *tokenManager) CreateTokenFromCertificate(cert *x509.Certificate, tags [
 
 	// Combine the application claims with the standard claims
 	claims := &verifierClaims{
-		X:    cert.PublicKey.(*ecdsa.PublicKey).X,
-		Y:    cert.PublicKey.(*ecdsa.PublicKey).Y,
-		Tags: tags,
+		Tags:           tags,
+		Serial:         cert.SerialNumber,
+		AuthorityKeyID: cert.AuthorityKeyId,
 	}
 	claims.ExpiresAt = cert.NotAfter.Unix()
 
+	switch publicKey := cert.PublicKey.(type) {
+	case *ecdsa.PublicKey:
+		claims.X = publicKey.X
+		claims.Y = publicKey.Y
+	case ed25519.PublicKey:
+		claims.Key = publicKey
+	default:
+		return []byte{}, fmt.Errorf("unsupported public key type %T", publicKey)
+	}
+
 	// Create the token and sign with our key
 	strtoken, err := jwt.NewWithClaims(p.signMethod, claims).SignedString(p.privateKey)
 	if err != nil {
@@ -160,3 +275,44 @@ func (p *tokenManager) CreateTokenFromCertificate(cert *x509.Certificate, tags [
 
 	return []byte(strtoken), nil
 }
+
+// publicKey returns the public key of the claims.
+func (c *verifierClaims) publicKey() (crypto.PublicKey, error) {
+
+	if len(c.Key) > 0 {
+		if len(c.Key) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid ed25519 public key size")
+		}
+		return ed25519.PublicKey(c.Key), nil
+	}
+
+	if c.X == nil || c.Y == nil {
+		return nil, errors.New("public key missing")
+	}
+
+	return &ecdsa.PublicKey{
+		Curve: elliptic.P256(),
+		X:     c.X,
+		Y:     c.Y,
+	}, nil
+}
+
+// verifyingKey returns the public key that verifies a token signed with the
+// method, so that a token is only verified with the algorithm of the key.
+func verifyingKey(method jwt.SigningMethod, publicKey crypto.PublicKey) (interface{}, error) {
+
+	switch publicKey.(type) {
+	case *ecdsa.PublicKey:
+		if _, ok := method.(*jwt.SigningMethodECDSA); ok {
+			return publicKey, nil
+		}
+	case ed25519.PublicKey:
+		if method == signer.SigningMethodEdDSA {
+			return publicKey, nil
+		}
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T", publicKey)
+	}
+
+	return nil, fmt.Errorf("unexpected signing method %s", method.Alg())
+}
@@ -4,6 +4,11 @@ package pkiverifier
 
 import (
 	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"math/big"
 	"testing"
 	"time"
 
@@ -100,10 +105,12 @@ func TestCreateAndVerify(t *testing.T) {
 			So(err1, ShouldBeNil)
 			rxtoken, err2 := v.Verify(token)
 			So(err2, ShouldBeNil)
-			So(*rxtoken.PublicKey.X, ShouldResemble, *cert.PublicKey.(*ecdsa.PublicKey).X)
-			So(*rxtoken.PublicKey.Y, ShouldResemble, *cert.PublicKey.(*ecdsa.PublicKey).Y)
-			So(rxtoken.PublicKey.Curve, ShouldResemble, cert.PublicKey.(*ecdsa.PublicKey).Curve)
+			rxPublicKey := rxtoken.PublicKey.(*ecdsa.PublicKey)
+			So(*rxPublicKey.X, ShouldResemble, *cert.PublicKey.(*ecdsa.PublicKey).X)
+			So(*rxPublicKey.Y, ShouldResemble, *cert.PublicKey.(*ecdsa.PublicKey).Y)
+			So(rxPublicKey.Curve, ShouldResemble, cert.PublicKey.(*ecdsa.PublicKey).Curve)
 			So(rxtoken.Tags, ShouldResemble, []string{"sometag"})
+			So(rxtoken.Serial.Cmp(cert.SerialNumber), ShouldEqual, 0)
 		})
 	})
 
@@ -139,6 +146,71 @@ func TestCreateAndVerify(t *testing.T) {
 	})
 }
 
+func TestCreateAndVerifyEd25519(t *testing.T) {
+	Convey("Given an ed25519 issuer and a verifier with its public key", t, func() {
+		publicKey, key, err := ed25519.GenerateKey(rand.Reader)
+		So(err, ShouldBeNil)
+		p := NewPKIIssuer(key)
+		v := NewPKIVerifier([]*PKIPublicKey{{PublicKey: publicKey}}, -1)
+
+		certPublicKey, certKey, err := ed25519.GenerateKey(rand.Reader)
+		So(err, ShouldBeNil)
+		template := &x509.Certificate{
+			SerialNumber:   big.NewInt(42),
+			NotBefore:      time.Now().Add(-time.Hour),
+			NotAfter:       time.Now().Add(time.Hour),
+			SubjectKeyId:   []byte{1, 2, 3, 4},
+			AuthorityKeyId: []byte{1, 2, 3, 4},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, template, certPublicKey, certKey)
+		So(err, ShouldBeNil)
+		cert, err := x509.ParseCertificate(der)
+		So(err, ShouldBeNil)
+
+		Convey("When I create a token for an ed25519 certificate, it should be verified", func() {
+			token, err := p.CreateTokenFromCertificate(cert, []string{"sometag"})
+			So(err, ShouldBeNil)
+
+			rxtoken, err := v.Verify(token)
+			So(err, ShouldBeNil)
+			So(rxtoken.PublicKey, ShouldResemble, certPublicKey)
+			So(rxtoken.Tags, ShouldResemble, []string{"sometag"})
+			So(rxtoken.Serial.Cmp(cert.SerialNumber), ShouldEqual, 0)
+			So(rxtoken.AuthorityKeyID, ShouldResemble, []byte{1, 2, 3, 4})
+		})
+
+		Convey("When I create a token for an ecdsa certificate, it should be verified", func() {
+			ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+			So(err, ShouldBeNil)
+			der, err := x509.CreateCertificate(rand.Reader, template, template, &ecKey.PublicKey, ecKey)
+			So(err, ShouldBeNil)
+			ecCert, err := x509.ParseCertificate(der)
+			So(err, ShouldBeNil)
+
+			token, err := p.CreateTokenFromCertificate(ecCert, nil)
+			So(err, ShouldBeNil)
+
+			rxtoken, err := v.Verify(token)
+			So(err, ShouldBeNil)
+			So(rxtoken.PublicKey.(*ecdsa.PublicKey).X.Cmp(ecCert.PublicKey.(*ecdsa.PublicKey).X), ShouldEqual, 0)
+		})
+
+		Convey("When the token is signed by an ecdsa key, it should be rejected", func() {
+			ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+			So(err, ShouldBeNil)
+
+			token, err := NewPKIIssuer(ecKey).CreateTokenFromCertificate(cert, nil)
+			So(err, ShouldBeNil)
+
+			_, err = v.Verify(token)
+			So(err, ShouldNotBeNil)
+
+			_, err = NewPKIVerifier([]*PKIPublicKey{{PublicKey: &ecKey.PublicKey}}, -1).Verify(token)
+			So(err, ShouldBeNil)
+		})
+	})
+}
+
 func TestCaching(t *testing.T) {
 	Convey("Given a valid verifier with a zero timer for the cache", t, func() {
 		key, cert, _, err := crypto.LoadAndVerifyECSecrets([]byte(keyPEM), []byte(certPEM), []byte(caPool))
@@ -170,3 +242,70 @@ func TestCaching(t *testing.T) {
 		})
 	})
 }
+
+func TestFederation(t *testing.T) {
+	Convey("Given a verifier with a local and a federated controller", t, func() {
+		localKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		So(err, ShouldBeNil)
+		remoteKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		So(err, ShouldBeNil)
+		otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		So(err, ShouldBeNil)
+
+		cert := &x509.Certificate{
+			PublicKey:    &otherKey.PublicKey,
+			SerialNumber: big.NewInt(1),
+			NotAfter:     time.Now().Add(time.Hour),
+		}
+
+		local := &PKIControllerInfo{Controller: "local", SameController: true}
+		federation := &PKIFederation{
+			TrustDomain:     "cluster-b",
+			NamespacePrefix: "/cluster-b",
+			TagRewrites: map[string]string{
+				"app":    "remote:app",
+				"secret": "",
+			},
+		}
+
+		v := NewPKIVerifier([]*PKIPublicKey{
+			{PublicKey: &localKey.PublicKey, Controller: local},
+			{PublicKey: &remoteKey.PublicKey, Federation: federation},
+		}, -1)
+
+		tags := []string{"$namespace=/apps", "app=web", "secret=yes", "env=prod", "sometag"}
+
+		Convey("The tokens of the local controller should not be rewritten", func() {
+			token, err := NewPKIIssuer(localKey).CreateTokenFromCertificate(cert, tags)
+			So(err, ShouldBeNil)
+			dp, err := v.Verify(token)
+			So(err, ShouldBeNil)
+			So(dp.Tags, ShouldResemble, tags)
+			So(dp.Controller, ShouldEqual, local)
+		})
+
+		Convey("The tokens of the federated controller should be rewritten", func() {
+			token, err := NewPKIIssuer(remoteKey).CreateTokenFromCertificate(cert, tags)
+			So(err, ShouldBeNil)
+			dp, err := v.Verify(token)
+			So(err, ShouldBeNil)
+			So(dp.Tags, ShouldResemble, []string{"$namespace=/cluster-b/apps", "remote:app=web"})
+			So(dp.Controller, ShouldResemble, &PKIControllerInfo{Namespace: "/cluster-b", Controller: "cluster-b", Federation: federation})
+		})
+
+		Convey("Without a namespace prefix, the namespace tags should only be kept when mapped", func() {
+			federation.NamespacePrefix = ""
+			So(federation.Rewrite(tags), ShouldResemble, []string{"remote:app=web"})
+
+			federation.TagRewrites[namespaceTagKey] = "remote:namespace"
+			So(federation.Rewrite(tags), ShouldResemble, []string{"remote:namespace=/apps", "remote:app=web"})
+		})
+
+		Convey("The tokens of an unknown controller should be rejected", func() {
+			token, err := NewPKIIssuer(otherKey).CreateTokenFromCertificate(cert, tags)
+			So(err, ShouldBeNil)
+			_, err = v.Verify(token)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
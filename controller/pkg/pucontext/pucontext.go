@@ -2,7 +2,6 @@ package pucontext
 
 import (
 	"context"
-	"crypto/ecdsa"
 	"fmt"
 	"net"
 	"strconv"
@@ -46,7 +45,10 @@ type synTokenInfo struct {
 	publicKeySignV1 []byte
 	publicKeyV2     []byte
 	publicKeySignV2 []byte
+	publicKeyV3     []byte
+	publicKeySignV3 []byte
 	token           []byte
+	tokenV2         []byte
 }
 
 // PUContext holds data indexed by the PU ID
@@ -55,6 +57,7 @@ type PUContext struct {
 	hashID                  string
 	username                string
 	autoport                bool
+	replayProtection        bool
 	managementID            string
 	managementNamespace     string
 	managementNamespaceHash string
@@ -99,6 +102,7 @@ func NewPU(contextID string, puInfo *policy.PUInfo, tokenAccessor tokenaccessor.
 		hashID:               hashID,
 		username:             puInfo.Runtime.Options().UserID,
 		autoport:             puInfo.Runtime.Options().AutoPort,
+		replayProtection:     puInfo.Policy.ReplayProtection(),
 		managementID:         puInfo.Policy.ManagementID(),
 		managementNamespace:  puInfo.Policy.ManagementNamespace(),
 		puType:               puInfo.Runtime.PUType(),
@@ -213,13 +217,37 @@ func (p *PUContext) createSynToken(pingPayload *policy.PingPayload, claimsHeader
 		return nil
 	}
 
-	ephKeySignV1, err := p.tokenAccessor.Sign(datapathKeyPair.DecodingKeyV1(), datapathSecret.EncodingKey().(*ecdsa.PrivateKey))
+	// The version 2 token is sent to the peers that have advertised the
+	// datapath version 2. It only carries the X25519 ephemeral key.
+	var tokenV2 []byte
+	if pingPayload == nil {
+		claimsV2 := &tokens.ConnectionClaims{
+			LCL:   nonce,
+			DEKV3: datapathKeyPair.DecodingKeyX25519(),
+			CT:    p.CompressedTags(),
+			ID:    p.ManagementID(),
+		}
+
+		tokenV2, err = p.tokenAccessor.CreateSynPacketToken(claimsV2, encodedBuf[:], nonce, claimsheader.NewClaimsHeader(), datapathSecret)
+		if err != nil {
+			zap.L().Error("Can not create syn packet token", zap.Error(err))
+			return nil
+		}
+	}
+
+	ephKeySignV1, err := p.tokenAccessor.Sign(datapathKeyPair.DecodingKeyV1(), datapathSecret.EncodingKey())
+	if err != nil {
+		zap.L().Error("Can not sign the ephemeral public key", zap.Error(err))
+		return nil
+	}
+
+	ephKeySignV2, err := p.tokenAccessor.Sign(datapathKeyPair.DecodingKeyV2(), datapathSecret.EncodingKey())
 	if err != nil {
 		zap.L().Error("Can not sign the ephemeral public key", zap.Error(err))
 		return nil
 	}
 
-	ephKeySignV2, err := p.tokenAccessor.Sign(datapathKeyPair.DecodingKeyV2(), datapathSecret.EncodingKey().(*ecdsa.PrivateKey))
+	ephKeySignV3, err := p.tokenAccessor.Sign(datapathKeyPair.DecodingKeyX25519(), datapathSecret.EncodingKey())
 	if err != nil {
 		zap.L().Error("Can not sign the ephemeral public key", zap.Error(err))
 		return nil
@@ -232,7 +260,10 @@ func (p *PUContext) createSynToken(pingPayload *policy.PingPayload, claimsHeader
 		publicKeySignV1: ephKeySignV1,
 		publicKeyV2:     datapathKeyPair.DecodingKeyV2(),
 		publicKeySignV2: ephKeySignV2,
-		token:           token}
+		publicKeyV3:     datapathKeyPair.DecodingKeyX25519(),
+		publicKeySignV3: ephKeySignV3,
+		token:           token,
+		tokenV2:         tokenV2}
 }
 
 //StopProcessing cancels the context such that all the goroutines can return.
@@ -241,6 +272,7 @@ func (p *PUContext) StopProcessing() {
 }
 
 //GetSynToken returns the cached syntoken if the datapath secret has not changed or the ping payload is present.
+//The version 2 token is returned if the claims header asks for the datapath version 2.
 func (p *PUContext) GetSynToken(pingPayload *policy.PingPayload, nonce [16]byte, claimsHeader *claimsheader.ClaimsHeader) (secrets.Secrets, *ephemeralkeys.PrivateKey, []byte) {
 
 	if pingPayload != nil {
@@ -259,13 +291,18 @@ func (p *PUContext) GetSynToken(pingPayload *policy.PingPayload, nonce [16]byte,
 		p.Unlock()
 	}
 
-	p.tokenAccessor.Randomize(synToken.token, nonce[:]) //nolint
+	token := synToken.token
+	if claimsHeader != nil && claimsHeader.DatapathVersion() == claimsheader.DatapathVersion2 && synToken.tokenV2 != nil {
+		token = synToken.tokenV2
+	}
+
+	p.tokenAccessor.Randomize(token, nonce[:]) //nolint
 
-	return synToken.datapathSecret, synToken.privateKey, synToken.token
+	return synToken.datapathSecret, synToken.privateKey, token
 }
 
 //GetSecrets returns the datapath secret and ephemeral public and private key
-func (p *PUContext) GetSecrets() (secrets.Secrets, *ephemeralkeys.PrivateKey, []byte, []byte, []byte, []byte) {
+func (p *PUContext) GetSecrets() (secrets.Secrets, *ephemeralkeys.PrivateKey, []byte, []byte, []byte, []byte, []byte, []byte) {
 	p.RLock()
 	synToken := p.synToken
 	p.RUnlock()
@@ -277,7 +314,7 @@ func (p *PUContext) GetSecrets() (secrets.Secrets, *ephemeralkeys.PrivateKey, []
 		p.Unlock()
 	}
 
-	return ephemeralkeys.GetDatapathSecret(), synToken.privateKey, synToken.publicKeyV1, synToken.publicKeySignV1, synToken.publicKeyV2, synToken.publicKeySignV2
+	return ephemeralkeys.GetDatapathSecret(), synToken.privateKey, synToken.publicKeyV1, synToken.publicKeySignV1, synToken.publicKeyV2, synToken.publicKeySignV2, synToken.publicKeyV3, synToken.publicKeySignV3
 }
 
 // GetPolicyFromFQDN gets the list of policies that are mapped with the hostname
@@ -319,6 +356,48 @@ func (p *PUContext) DependentServices(fqdn string) []*policy.ApplicationService
 	return dependentServices
 }
 
+// DependentServiceID returns the ID of the dependent service that is reached
+// with the given destination. The destination can be the public address of the
+// service, like a Kubernetes ClusterIP, or the address of one of its endpoints.
+// It returns an empty string if the destination is not a dependent service.
+func (p *PUContext) DependentServiceID(ip net.IP, port uint16) string {
+	p.RLock()
+	defer p.RUnlock()
+
+	if p.puInfo == nil || p.puInfo.Policy == nil {
+		return ""
+	}
+
+	for _, dependentService := range p.puInfo.Policy.DependentServices() {
+		if serviceIncludes(dependentService.NetworkInfo, ip, port) || serviceIncludes(dependentService.PrivateNetworkInfo, ip, port) {
+			return dependentService.ID
+		}
+	}
+
+	return ""
+}
+
+// serviceIncludes returns true if the addresses and the ports of the service
+// include the given destination.
+func serviceIncludes(service *common.Service, ip net.IP, port uint16) bool {
+
+	if service == nil || service.Ports == nil || !service.Ports.IsIncluded(int(port)) {
+		return false
+	}
+
+	for addr := range service.Addresses {
+		_, ipnet, err := net.ParseCIDR(addr)
+		if err != nil {
+			continue
+		}
+		if ipnet.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
 // UsesFQDN indicates whether this PU policy has an ACL or Service that uses an FQDN
 func (p *PUContext) UsesFQDN() bool {
 	p.RLock()
@@ -359,6 +438,11 @@ func (p *PUContext) Autoport() bool {
 	return p.autoport
 }
 
+// ReplayProtection returns true if the replayed tokens must be detected for the PU
+func (p *PUContext) ReplayProtection() bool {
+	return p.replayProtection
+}
+
 // ManagementID returns the management ID
 func (p *PUContext) ManagementID() string {
 	return p.managementID
@@ -5,10 +5,12 @@ package pucontext
 import (
 	"crypto/ecdsa"
 	"crypto/x509"
+	"net"
 	"testing"
 	"time"
 
 	. "github.com/smartystreets/goconvey/convey"
+	"go.aporeto.io/enforcerd/trireme-lib/common"
 	"go.aporeto.io/enforcerd/trireme-lib/controller/constants"
 	"go.aporeto.io/enforcerd/trireme-lib/controller/internal/enforcer/nfqdatapath/tokenaccessor"
 	"go.aporeto.io/enforcerd/trireme-lib/controller/internal/enforcer/utils/ephemeralkeys"
@@ -593,3 +595,72 @@ func Test_PUSearch(t *testing.T) {
 
 	})
 }
+
+func Test_PUDependentServiceID(t *testing.T) {
+
+	Convey("When I call DependentServiceID", t, func() {
+
+		ports, _ := portspec.NewPortSpec(80, 80, nil)
+		targetPorts, _ := portspec.NewPortSpec(8080, 8080, nil)
+
+		d := policy.NewPUPolicy(
+			"id",
+			"/abc",
+			policy.AllowAll,
+			nil,
+			nil,
+			nil,
+			nil,
+			nil,
+			nil,
+			nil,
+			nil,
+			nil,
+			0,
+			0,
+			nil,
+			policy.ApplicationServicesList{
+				{
+					ID: "default/web",
+					NetworkInfo: &common.Service{
+						Ports:     ports,
+						Protocol:  6,
+						Addresses: map[string]struct{}{"10.96.0.10/32": {}},
+					},
+					PrivateNetworkInfo: &common.Service{
+						Ports:     targetPorts,
+						Protocol:  6,
+						Addresses: map[string]struct{}{"172.17.0.2/32": {}},
+					},
+				},
+			},
+			[]string{},
+			policy.EnforcerMapping,
+			policy.Reject|policy.Log,
+			policy.Reject|policy.Log,
+		)
+
+		fp := &policy.PUInfo{
+			Runtime: policy.NewPURuntimeWithDefaults(),
+			Policy:  d,
+		}
+
+		pu, _ := NewPU("pu1", fp, nil, 24*time.Hour)
+
+		Convey("The service should be found with its cluster IP", func() {
+			So(pu.DependentServiceID(net.ParseIP("10.96.0.10"), 80), ShouldEqual, "default/web")
+		})
+
+		Convey("The service should be found with the address of an endpoint", func() {
+			So(pu.DependentServiceID(net.ParseIP("172.17.0.2"), 8080), ShouldEqual, "default/web")
+		})
+
+		Convey("The service should not be found with another port", func() {
+			So(pu.DependentServiceID(net.ParseIP("10.96.0.10"), 8080), ShouldEqual, "")
+		})
+
+		Convey("The service should not be found with another address", func() {
+			So(pu.DependentServiceID(net.ParseIP("10.96.0.11"), 80), ShouldEqual, "")
+		})
+	})
+}
@@ -27,6 +27,8 @@ const (
 	Ping = "RemoteEnforcer.Ping"
 	// DebugCollect is the string for invoking DebugCollect RPC
 	DebugCollect = "RemoteEnforcer.DebugCollect"
+	// ConnectionTable is the string for invoking ConnectionTable RPC
+	ConnectionTable = "RemoteEnforcer.ConnectionTable"
 )
 
 // RemoteIntf is the interface implemented by the remote enforcer
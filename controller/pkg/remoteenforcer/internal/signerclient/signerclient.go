@@ -0,0 +1,112 @@
+package signerclient
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+
+	"go.aporeto.io/enforcerd/trireme-lib/controller/constants"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/internal/enforcer/utils/rpcwrapper"
+	"go.uber.org/zap"
+)
+
+// SignerClient interface provides a start function. The client is used to
+// request signatures with the key of the enforcer.
+type SignerClient interface {
+	Run(ctx context.Context) error
+	Signer(pub crypto.PublicKey) crypto.Signer
+}
+
+const (
+	signerContextID = "UNUSED_SIGNER"
+	signCommand     = "ProxyRPCServer.Sign"
+)
+
+// Client represents the remote API client.
+type Client struct {
+	rpchdl     rpcwrapper.RPCClient
+	secret     string
+	socketPath string
+}
+
+// NewClient returns a remote API client that can be used for
+// requesting signatures to the master enforcer.
+func NewClient() (SignerClient, error) {
+	c := &Client{
+		rpchdl:     rpcwrapper.NewRPCWrapper(),
+		secret:     os.Getenv(constants.EnvStatsSecret),
+		socketPath: os.Getenv(constants.EnvStatsChannel),
+	}
+	if c.socketPath == "" {
+		return nil, errors.New("no path to socket provided")
+	}
+	if c.secret == "" {
+		return nil, errors.New("no secret provided for  channel")
+	}
+
+	return c, nil
+}
+
+// Run will initialize the client.
+func (c *Client) Run(ctx context.Context) error {
+	if err := c.rpchdl.NewRPCClient(signerContextID, c.socketPath, c.secret); err != nil {
+		zap.L().Error("SignerClient RPC client cannot connect", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// Signer returns a crypto.Signer with the given public key that requests the
+// signatures to the master enforcer over the RPC channel.
+func (c *Client) Signer(pub crypto.PublicKey) crypto.Signer {
+	return &remoteSigner{
+		client: c,
+		public: pub,
+	}
+}
+
+// sign requests the signature of the digest to the master enforcer.
+func (c *Client) sign(digest []byte, hash crypto.Hash) ([]byte, error) {
+
+	request := &rpcwrapper.Request{
+		Payload: &rpcwrapper.SignRequestPayload{
+			Digest: digest,
+			Hash:   hash,
+		},
+	}
+
+	response := &rpcwrapper.Response{}
+
+	if err := c.rpchdl.RemoteCall(signerContextID, signCommand, request, response); err != nil {
+		return nil, err
+	}
+
+	payload, ok := response.Payload.(rpcwrapper.SignResponsePayload)
+	if !ok {
+		return nil, fmt.Errorf("unrecognized response payload. Received payload is %s", reflect.TypeOf(response.Payload))
+	}
+
+	return payload.Signature, nil
+}
+
+// remoteSigner implements the crypto.Signer interface with the key of the
+// master enforcer.
+type remoteSigner struct {
+	client *Client
+	public crypto.PublicKey
+}
+
+// Public implements the crypto.Signer interface.
+func (s *remoteSigner) Public() crypto.PublicKey {
+	return s.public
+}
+
+// Sign implements the crypto.Signer interface. The master enforcer uses its
+// own source of randomness.
+func (s *remoteSigner) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	return s.client.sign(digest, opts.HashFunc())
+}
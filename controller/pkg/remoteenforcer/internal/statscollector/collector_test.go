@@ -64,15 +64,19 @@ func TestCollectFlowEvent(t *testing.T) {
 						Type: collector.EndPointTypePU,
 						Port: 80,
 					},
-					Count:      10,
-					Tags:       []string{},
-					L4Protocol: packet.IPProtocolTCP,
+					Count:         10,
+					Tags:          []string{},
+					L4Protocol:    packet.IPProtocolTCP,
+					BytesSent:     100,
+					BytesReceived: 200,
 				}
 				c.CollectFlowEvent(r)
 				Convey("The flow should be in the cache", func() {
 					So(len(c.Flows), ShouldEqual, 1)
 					So(c.Flows[collector.StatsFlowContentHash(r)], ShouldNotBeNil)
 					So(c.Flows[collector.StatsFlowContentHash(r)].Count, ShouldEqual, 11)
+					So(c.Flows[collector.StatsFlowContentHash(r)].BytesSent, ShouldEqual, 100)
+					So(c.Flows[collector.StatsFlowContentHash(r)].BytesReceived, ShouldEqual, 200)
 				})
 			})
 
@@ -20,6 +20,8 @@ func (c *collectorImpl) CollectFlowEvent(record *collector.FlowRecord) {
 
 	if r, ok := c.Flows[hash]; ok {
 		r.Count = r.Count + record.Count
+		r.BytesSent = r.BytesSent + record.BytesSent
+		r.BytesReceived = r.BytesReceived + record.BytesReceived
 		return
 	}
 
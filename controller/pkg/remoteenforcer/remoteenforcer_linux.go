@@ -30,10 +30,13 @@ import (
 	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/remoteenforcer/internal/client"
 	reports "go.aporeto.io/enforcerd/trireme-lib/controller/pkg/remoteenforcer/internal/client/reportsclient"
 	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/remoteenforcer/internal/client/statsclient"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/remoteenforcer/internal/signerclient"
 	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/remoteenforcer/internal/statscollector"
 	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/remoteenforcer/internal/tokenissuer"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/secrets"
 	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/secrets/rpc"
 	"go.aporeto.io/enforcerd/trireme-lib/policy"
+	"go.aporeto.io/enforcerd/trireme-lib/utils/crypto"
 	"go.uber.org/zap"
 	"golang.org/x/sys/unix"
 )
@@ -43,6 +46,8 @@ var (
 	createEnforcer = enforcer.New
 
 	createSupervisor = supervisor.NewSupervisor
+
+	createSignerClient = signerclient.NewClient
 )
 
 var cmdLock sync.Mutex
@@ -360,7 +365,7 @@ func (s *RemoteEnforcer) UpdateSecrets(req rpcwrapper.Request, resp *rpcwrapper.
 	}()
 
 	payload := req.Payload.(rpcwrapper.UpdateSecretsPayload)
-	s.secrets, err = rpc.NewSecrets(payload.Secrets)
+	s.secrets, err = s.newSecrets(payload.Secrets)
 	if err != nil {
 		return err
 	}
@@ -462,6 +467,31 @@ func (s *RemoteEnforcer) DebugCollect(req rpcwrapper.Request, resp *rpcwrapper.R
 			}
 			commandOutput = string(output)
 		}
+	} else if payload.PcapNative {
+		// the packets are captured by the datapath of the remote enforcer
+		if s.enforcer == nil {
+			resp.Status = "enforcer not initialized - cannot capture packets"
+			return fmt.Errorf(resp.Status)
+		}
+
+		debugConfig := &policy.DebugConfig{
+			DebugConfigInput: policy.DebugConfigInput{
+				FilePath:     payload.PcapFilePath,
+				PcapFilter:   payload.PcapFilter,
+				PcapNative:   true,
+				PcapDuration: payload.PcapDuration,
+				PcapMaxSize:  payload.PcapMaxSize,
+				PcapFileSize: payload.PcapFileSize,
+				PcapFiles:    payload.PcapFiles,
+			},
+		}
+
+		if err := s.enforcer.DebugCollect(s.ctx, payload.ContextID, debugConfig); err != nil {
+			resp.Status = err.Error()
+			return err
+		}
+
+		pid = os.Getpid()
 	} else if payload.PcapFilePath != "" {
 		cmd, err := diagnostics.StartTcpdump(s.ctx, payload.PcapFilePath, payload.PcapFilter)
 		if err != nil {
@@ -491,6 +521,33 @@ func (s *RemoteEnforcer) DebugCollect(req rpcwrapper.Request, resp *rpcwrapper.R
 	return nil
 }
 
+// ConnectionTable returns a snapshot of the connection tables of the enforcer
+func (s *RemoteEnforcer) ConnectionTable(req rpcwrapper.Request, resp *rpcwrapper.Response) error {
+
+	if !s.rpcHandle.CheckValidity(&req, s.rpcSecret) {
+		resp.Status = "connection table auth failed"
+		return fmt.Errorf(resp.Status)
+	}
+
+	cmdLock.Lock()
+	defer cmdLock.Unlock()
+
+	payload := req.Payload.(rpcwrapper.ConnectionTablePayload)
+
+	entries, err := s.enforcer.ConnectionTable(s.ctx, payload.ContextID, &payload.Filter)
+	if err != nil {
+		resp.Status = err.Error()
+		return err
+	}
+
+	resp.Status = ""
+	resp.Payload = rpcwrapper.ConnectionTableResponsePayload{
+		ContextID: payload.ContextID,
+		Entries:   entries,
+	}
+	return nil
+}
+
 // SetLogLevel sets log level.
 func (s *RemoteEnforcer) SetLogLevel(req rpcwrapper.Request, resp *rpcwrapper.Response) error {
 
@@ -544,7 +601,7 @@ func (s *RemoteEnforcer) setupEnforcer(payload *rpcwrapper.InitRequestPayload) e
 
 	var err error
 
-	s.secrets, err = rpc.NewSecrets(payload.Secrets)
+	s.secrets, err = s.newSecrets(payload.Secrets)
 	if err != nil {
 		return err
 	}
@@ -579,6 +636,35 @@ func (s *RemoteEnforcer) setupEnforcer(payload *rpcwrapper.InitRequestPayload) e
 	return nil
 }
 
+// newSecrets creates the secrets from the RPC secrets. When the key is not
+// transmitted, the signatures are requested to the master enforcer.
+func (s *RemoteEnforcer) newSecrets(r secrets.RPCSecrets) (secrets.Secrets, error) {
+
+	if !r.RemoteSigner {
+		return rpc.NewSecrets(r)
+	}
+
+	if s.signerClient == nil {
+		signerClient, err := createSignerClient()
+		if err != nil {
+			return nil, fmt.Errorf("unable to create signer client: %s", err)
+		}
+
+		if err := signerClient.Run(s.ctx); err != nil {
+			return nil, fmt.Errorf("unable to start signer client: %s", err)
+		}
+
+		s.signerClient = signerClient
+	}
+
+	cert, err := crypto.LoadCertificate(r.Certificate)
+	if err != nil {
+		return nil, err
+	}
+
+	return rpc.NewSecretsWithSigner(r, s.signerClient.Signer(cert.PublicKey))
+}
+
 func (s *RemoteEnforcer) setupSupervisor(payload *rpcwrapper.InitRequestPayload) error {
 
 	// we are usually always starting RemoteContainer enforcers,
@@ -761,6 +761,81 @@ func Test_EnableDatapathPacketTracing(t *testing.T) {
 	})
 }
 
+func Test_ConnectionTable(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	Convey("Given a new server", t, func() {
+		rpcHdl := mockrpcwrapper.NewMockRPCServer(ctrl)
+		mockEnf := mockenforcer.NewMockEnforcer(ctrl)
+		ctx, cancel := context.WithCancel(context.TODO())
+
+		Convey("With proper initialization", func() {
+
+			server := &RemoteEnforcer{
+				rpcHandle: rpcHdl,
+				enforcer:  mockEnf,
+				ctx:       ctx,
+				cancel:    cancel,
+			}
+
+			Convey("When I try to get the connection table and the validity fails, it should fail", func() {
+				rpcHdl.EXPECT().CheckValidity(gomock.Any(), gomock.Any()).Times(1).Return(false)
+				var rpcwrperreq rpcwrapper.Request
+				var rpcwrperres rpcwrapper.Response
+
+				rpcwrperreq.Payload = rpcwrapper.ConnectionTablePayload{}
+
+				err := server.ConnectionTable(rpcwrperreq, &rpcwrperres)
+
+				Convey("Then I should get error", func() {
+					So(err, ShouldNotBeNil)
+					So(err, ShouldResemble, errors.New("connection table auth failed"))
+				})
+			})
+
+			Convey("When I try to get the connection table and the enforcer fails, it should fail", func() {
+				rpcHdl.EXPECT().CheckValidity(gomock.Any(), gomock.Any()).Times(1).Return(true)
+				mockEnf.EXPECT().ConnectionTable(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, fmt.Errorf("error"))
+
+				var rpcwrperreq rpcwrapper.Request
+				var rpcwrperres rpcwrapper.Response
+
+				rpcwrperreq.Payload = rpcwrapper.ConnectionTablePayload{}
+
+				err := server.ConnectionTable(rpcwrperreq, &rpcwrperres)
+
+				Convey("Then I should get error", func() {
+					So(err, ShouldNotBeNil)
+					So(err, ShouldResemble, errors.New("error"))
+				})
+			})
+
+			Convey("When the enforcer returns the connections, I should get them in the response", func() {
+				rpcHdl.EXPECT().CheckValidity(gomock.Any(), gomock.Any()).Times(1).Return(true)
+				mockEnf.EXPECT().ConnectionTable(gomock.Any(), "pu", &connection.TableFilter{State: "TCPData"}).Return([]*connection.TableEntry{{Key: "key"}}, nil)
+
+				var rpcwrperreq rpcwrapper.Request
+				var rpcwrperres rpcwrapper.Response
+
+				rpcwrperreq.Payload = rpcwrapper.ConnectionTablePayload{
+					ContextID: "pu",
+					Filter:    connection.TableFilter{State: "TCPData"},
+				}
+
+				err := server.ConnectionTable(rpcwrperreq, &rpcwrperres)
+
+				Convey("Then I should not get an error ", func() {
+					So(err, ShouldBeNil)
+					payload := rpcwrperres.Payload.(rpcwrapper.ConnectionTableResponsePayload)
+					So(payload.ContextID, ShouldEqual, "pu")
+					So(len(payload.Entries), ShouldEqual, 1)
+				})
+			})
+		})
+	})
+}
+
 func Test_EnableIPTablesPacketTracing(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
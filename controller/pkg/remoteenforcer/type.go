@@ -12,6 +12,7 @@ import (
 	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/fqconfig"
 	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/packetprocessor"
 	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/remoteenforcer/internal/client"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/remoteenforcer/internal/signerclient"
 	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/remoteenforcer/internal/statscollector"
 	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/remoteenforcer/internal/tokenissuer"
 	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/secrets"
@@ -44,9 +45,10 @@ type RemoteEnforcer struct {
 	ctx            context.Context
 	cancel         context.CancelFunc
 	exit           chan bool
-	config         logConfig               // nolint:structcheck,unused
-	tokenIssuer    tokenissuer.TokenClient // nolint:structcheck,unused
-	enforcerType   policy.EnforcerType     // nolint:structcheck,unused
-	agentVersion   semver.Version          // nolint:structcheck,unused
-	fqConfig       fqconfig.FilterQueue    // nolint:structcheck,unused
+	config         logConfig                 // nolint:structcheck,unused
+	tokenIssuer    tokenissuer.TokenClient   // nolint:structcheck,unused
+	signerClient   signerclient.SignerClient // nolint:structcheck,unused
+	enforcerType   policy.EnforcerType       // nolint:structcheck,unused
+	agentVersion   semver.Version            // nolint:structcheck,unused
+	fqConfig       fqconfig.FilterQueue      // nolint:structcheck,unused
 }
@@ -0,0 +1,73 @@
+// +build !windows
+
+// Package rulerender renders the iptables and ipset commands that the
+// supervisor programs for a processing unit, without touching the kernel.
+// The output is stable and can be used for golden file tests or for
+// comparing the rules of two versions of a policy.
+package rulerender
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"go.aporeto.io/enforcerd/trireme-lib/controller/internal/supervisor/iptablesctrl"
+	"go.aporeto.io/enforcerd/trireme-lib/policy"
+)
+
+// Config holds the parameters of the controller that affect the rules.
+type Config = iptablesctrl.RenderConfig
+
+// Rendering holds the rendered rules for both ip versions.
+type Rendering = iptablesctrl.Rendering
+
+// RenderedRules are the commands the controller executes for one ip version.
+type RenderedRules = iptablesctrl.RenderedRules
+
+// PUDefinition is the serialized form of a processing unit that can be
+// given to the renderer.
+type PUDefinition struct {
+	ContextID string                 `json:"contextID"`
+	Policy    *policy.PUPolicyPublic `json:"policy"`
+	Runtime   *policy.PURuntime      `json:"runtime"`
+}
+
+// Render renders the iptables and ipset commands for the given processing
+// unit. If the processing unit is nil only the global rules are rendered.
+func Render(cfg *Config, puInfo *policy.PUInfo) (*Rendering, error) {
+
+	contextID := ""
+	if puInfo != nil {
+		contextID = puInfo.ContextID
+	}
+
+	return iptablesctrl.Render(cfg, contextID, puInfo)
+}
+
+// LoadPUInfo reads a PUDefinition in JSON from the reader and converts
+// it to a PUInfo.
+func LoadPUInfo(r io.Reader) (*policy.PUInfo, error) {
+
+	def := &PUDefinition{}
+	if err := json.NewDecoder(r).Decode(def); err != nil {
+		return nil, fmt.Errorf("unable to decode pu definition: %s", err)
+	}
+
+	if def.ContextID == "" {
+		return nil, fmt.Errorf("pu definition must have a contextID")
+	}
+
+	if def.Policy == nil || def.Runtime == nil {
+		return nil, fmt.Errorf("pu definition must have a policy and a runtime")
+	}
+
+	// We only render the rules, so there is no need to initialize the
+	// authorization handlers of the services.
+	p, err := def.Policy.ToPrivatePolicy(context.Background(), false)
+	if err != nil {
+		return nil, fmt.Errorf("unable to convert policy: %s", err)
+	}
+
+	return policy.PUInfoFromPolicyAndRuntime(def.ContextID, p, def.Runtime), nil
+}
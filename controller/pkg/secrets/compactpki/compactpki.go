@@ -1,14 +1,19 @@
 package compactpki
 
 import (
+	"bytes"
+	gocrypto "crypto"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/x509"
 	"errors"
+	"fmt"
 	"time"
 
 	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/claimsheader"
 	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/pkiverifier"
 	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/secrets"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/secrets/revocation"
 	"go.aporeto.io/enforcerd/trireme-lib/utils/crypto"
 )
 
@@ -23,10 +28,12 @@ type CompactPKI struct {
 	authorityPEM       []byte
 	trustedControllers []*secrets.ControllerInfo
 	compressed         claimsheader.CompressionType
-	privateKey         *ecdsa.PrivateKey
+	privateKey         gocrypto.Signer
 	publicKey          *x509.Certificate
 	txKey              []byte
 	verifier           pkiverifier.PKITokenVerifier
+	revocation         *revocation.Checker
+	federatedDomains   []*secrets.FederatedDomain
 }
 
 // NewCompactPKIWithTokenCA creates new secrets for PKI implementation based on compact encoding.
@@ -37,24 +44,59 @@ type CompactPKI struct {
 //    compressionType: is packed with the secrets to indicate compression.
 func NewCompactPKIWithTokenCA(keyPEM []byte, certPEM []byte, caPEM []byte, trustedControllers []*secrets.ControllerInfo, txKey []byte, compress claimsheader.CompressionType) (*CompactPKI, error) {
 
-	key, cert, _, err := crypto.LoadAndVerifyECSecrets(keyPEM, certPEM, caPEM)
+	key, cert, _, err := crypto.LoadAndVerifySecrets(keyPEM, certPEM, caPEM)
 	if err != nil {
 		return nil, err
 	}
 
-	tokenKeys := make([]*pkiverifier.PKIPublicKey, len(trustedControllers))
-	for _, tokenKey := range trustedControllers {
-		caCert, err := crypto.LoadCertificate(tokenKey.PublicKey)
-		if err != nil {
-			return nil, err
-		}
+	p, err := newCompactPKI(key, cert, certPEM, caPEM, trustedControllers, txKey, compress)
+	if err != nil {
+		return nil, err
+	}
 
-		namespaceKey := &pkiverifier.PKIPublicKey{
-			PublicKey:  caCert.PublicKey.(*ecdsa.PublicKey),
-			Controller: tokenKey.Controller,
-		}
+	p.privateKeyPEM = keyPEM
 
-		tokenKeys = append(tokenKeys, namespaceKey)
+	return p, nil
+}
+
+// NewCompactPKIWithSigner creates new secrets for PKI implementation based on compact encoding
+// where the private key is never loaded. The tokens are signed by the signer, which can be a
+// key held by an agent or a PKCS#11 module. The private key is not part of the RPC secrets,
+// so the remote enforcers request their signatures over the RPC channel.
+//    signer: is the signer of the tokens. Its public key must be the one of the certificate.
+//    certPEM: is the public key that will be used formated as a PEM file.
+//    trustedControllers: is a list of trusted controllers.
+//    txKey: is the public key that is send over the wire.
+//    compressionType: is packed with the secrets to indicate compression.
+func NewCompactPKIWithSigner(signer gocrypto.Signer, certPEM []byte, caPEM []byte, trustedControllers []*secrets.ControllerInfo, txKey []byte, compress claimsheader.CompressionType) (*CompactPKI, error) {
+
+	if signer == nil {
+		return nil, errors.New("signer missing")
+	}
+
+	rootCertPool := crypto.LoadRootCertificates(caPEM)
+	if rootCertPool == nil {
+		return nil, errors.New("unable to load root certificate pool")
+	}
+
+	cert, err := crypto.LoadAndVerifyCertificate(certPEM, rootCertPool)
+	if err != nil {
+		return nil, err
+	}
+
+	if !samePublicKey(signer.Public(), cert.PublicKey) {
+		return nil, errors.New("public key of the signer does not match the certificate")
+	}
+
+	return newCompactPKI(signer, cert, certPEM, caPEM, trustedControllers, txKey, compress)
+}
+
+// newCompactPKI creates the secrets with a verified certificate.
+func newCompactPKI(key gocrypto.Signer, cert *x509.Certificate, certPEM []byte, caPEM []byte, trustedControllers []*secrets.ControllerInfo, txKey []byte, compress claimsheader.CompressionType) (*CompactPKI, error) {
+
+	tokenKeys, err := trustedKeys(trustedControllers)
+	if err != nil {
+		return nil, err
 	}
 
 	if len(txKey) == 0 {
@@ -62,7 +104,6 @@ func NewCompactPKIWithTokenCA(keyPEM []byte, certPEM []byte, caPEM []byte, trust
 	}
 
 	p := &CompactPKI{
-		privateKeyPEM:      keyPEM,
 		publicKeyPEM:       certPEM,
 		authorityPEM:       caPEM,
 		trustedControllers: trustedControllers,
@@ -76,7 +117,8 @@ func NewCompactPKIWithTokenCA(keyPEM []byte, certPEM []byte, caPEM []byte, trust
 	return p, nil
 }
 
-// EncodingKey returns the private key
+// EncodingKey returns the private key. It is a crypto.Signer when the
+// secrets are created with a signer.
 func (p *CompactPKI) EncodingKey() interface{} {
 	return p.privateKey
 }
@@ -97,6 +139,13 @@ func (p *CompactPKI) KeyAndClaims(pkey []byte) (interface{}, []string, time.Time
 	if err != nil {
 		return nil, nil, time.Unix(0, 0), nil, err
 	}
+	// The CRLs are the ones of the local CA, so they cannot tell the status of
+	// the tokens of the federated domains.
+	if kc.Controller == nil || kc.Controller.Federation == nil {
+		if err := p.revocation.CheckSerial(kc.Serial, kc.AuthorityKeyID); err != nil {
+			return nil, nil, time.Unix(0, 0), nil, err
+		}
+	}
 	return kc.PublicKey, kc.Tags, kc.Expiration, kc.Controller, nil
 }
 
@@ -112,13 +161,142 @@ func (p *CompactPKI) AckSize() uint32 {
 }
 
 // RPCSecrets returns the secrets that are marshallable over the RPC interface.
+// The key is not part of them when the secrets are created with a signer.
 func (p *CompactPKI) RPCSecrets() secrets.RPCSecrets {
 	return secrets.RPCSecrets{
 		Key:                p.privateKeyPEM,
+		RemoteSigner:       len(p.privateKeyPEM) == 0,
 		Certificate:        p.publicKeyPEM,
 		CA:                 p.authorityPEM,
 		Token:              p.txKey,
 		TrustedControllers: p.trustedControllers,
 		Compressed:         p.compressed,
+		CRLs:               p.revocation.CRLs(),
+		RevocationMode:     p.revocation.Mode(),
+		FederatedDomains:   p.federatedDomains,
+	}
+}
+
+// SetRevocation loads the CRLs of the CA. They must be signed by one of the
+// certificates of the CA. The peer tokens and certificates that are revoked
+// are rejected from then on.
+//    crls: are the PEM or DER encoded CRLs.
+//    mode: is the behavior when the revocation status is unknown.
+func (p *CompactPKI) SetRevocation(crls [][]byte, mode revocation.Mode) error {
+
+	checker, err := revocation.NewChecker(crls, revocation.ParseCertificates(p.authorityPEM), mode)
+	if err != nil {
+		return err
+	}
+
+	p.revocation = checker
+
+	return nil
+}
+
+// Revocation returns the revocation checker. It is nil when no CRL is set.
+func (p *CompactPKI) Revocation() *revocation.Checker {
+	return p.revocation
+}
+
+// SetFederatedDomains trusts the tokens signed by the controllers of the
+// federated trust domains along with the ones of the trusted controllers.
+// The tags of their tokens are rewritten with the policy of their domain,
+// and their domain is returned as the controller of the tokens. Their tokens
+// are not checked against the CRLs of the CA.
+//    domains: are the federated trust domains.
+func (p *CompactPKI) SetFederatedDomains(domains []*secrets.FederatedDomain) error {
+
+	tokenKeys, err := trustedKeys(p.trustedControllers)
+	if err != nil {
+		return err
+	}
+
+	for _, domain := range domains {
+
+		if domain.Name == "" {
+			return errors.New("federated domain name missing")
+		}
+
+		certs := revocation.ParseCertificates(domain.Bundle)
+		if len(certs) == 0 {
+			return fmt.Errorf("no certificate in the bundle of federated domain %s", domain.Name)
+		}
+
+		federation := &pkiverifier.PKIFederation{
+			TrustDomain:     domain.Name,
+			NamespacePrefix: domain.NamespacePrefix,
+			TagRewrites:     domain.TagRewrites,
+		}
+
+		for _, cert := range certs {
+			publicKey, err := tokenPublicKey(cert)
+			if err != nil {
+				return fmt.Errorf("certificate %s of federated domain %s: %s", cert.Subject.String(), domain.Name, err)
+			}
+
+			tokenKeys = append(tokenKeys, &pkiverifier.PKIPublicKey{
+				PublicKey:  publicKey,
+				Federation: federation,
+			})
+		}
+	}
+
+	p.verifier = pkiverifier.NewPKIVerifier(tokenKeys, 5*time.Minute)
+	p.federatedDomains = domains
+
+	return nil
+}
+
+// trustedKeys returns the public keys of the trusted controllers.
+func trustedKeys(trustedControllers []*secrets.ControllerInfo) ([]*pkiverifier.PKIPublicKey, error) {
+
+	tokenKeys := make([]*pkiverifier.PKIPublicKey, 0, len(trustedControllers))
+	for _, tokenKey := range trustedControllers {
+		caCert, err := crypto.LoadCertificate(tokenKey.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+
+		publicKey, err := tokenPublicKey(caCert)
+		if err != nil {
+			return nil, fmt.Errorf("certificate %s of trusted controller: %s", caCert.Subject.String(), err)
+		}
+
+		namespaceKey := &pkiverifier.PKIPublicKey{
+			PublicKey:  publicKey,
+			Controller: tokenKey.Controller,
+		}
+
+		tokenKeys = append(tokenKeys, namespaceKey)
+	}
+
+	return tokenKeys, nil
+}
+
+// tokenPublicKey returns the public key of a certificate that signs the
+// tokens. It must be an ECDSA or an Ed25519 key.
+func tokenPublicKey(cert *x509.Certificate) (gocrypto.PublicKey, error) {
+
+	switch publicKey := cert.PublicKey.(type) {
+	case *ecdsa.PublicKey, ed25519.PublicKey:
+		return publicKey, nil
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T", publicKey)
+	}
+}
+
+// samePublicKey returns true if both keys are the same ECDSA or Ed25519 key.
+func samePublicKey(a, b gocrypto.PublicKey) bool {
+
+	switch ka := a.(type) {
+	case *ecdsa.PublicKey:
+		kb, ok := b.(*ecdsa.PublicKey)
+		return ok && ka.Curve == kb.Curve && ka.X.Cmp(kb.X) == 0 && ka.Y.Cmp(kb.Y) == 0
+	case ed25519.PublicKey:
+		kb, ok := b.(ed25519.PublicKey)
+		return ok && bytes.Equal(ka, kb)
+	default:
+		return false
 	}
 }
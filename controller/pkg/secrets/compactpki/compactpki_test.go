@@ -4,13 +4,21 @@ package compactpki
 
 import (
 	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
 	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
 	"testing"
+	"time"
 
 	. "github.com/smartystreets/goconvey/convey"
 	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/claimsheader"
 	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/pkiverifier"
 	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/secrets"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/secrets/revocation"
 	"go.aporeto.io/enforcerd/trireme-lib/utils/crypto"
 )
 
@@ -138,3 +146,254 @@ func TestBasicInterfaceFunctions(t *testing.T) {
 		})
 	})
 }
+
+func TestNewCompactPKIWithSigner(t *testing.T) {
+	txKey := createTxtToken()
+	Convey("Given a signer holding the private key", t, func() {
+		tokenKey := &secrets.ControllerInfo{
+			PublicKey: []byte(caPEM),
+		}
+		controllerInfo := []*secrets.ControllerInfo{tokenKey}
+
+		key, err := crypto.LoadEllipticCurveKey([]byte(privateKeyPEM))
+		So(err, ShouldBeNil)
+
+		Convey("When I create a new compact PKI, it should succeed", func() {
+			p, err := NewCompactPKIWithSigner(key, []byte(publicPEM), []byte(caPEM), controllerInfo, txKey, claimsheader.CompressionTypeV1)
+			So(err, ShouldBeNil)
+			So(p, ShouldNotBeNil)
+			So(p.EncodingKey(), ShouldEqual, key)
+
+			Convey("The key should not be part of the RPC secrets", func() {
+				r := p.RPCSecrets()
+				So(r.Key, ShouldBeEmpty)
+				So(r.RemoteSigner, ShouldBeTrue)
+				So(r.Certificate, ShouldResemble, []byte(publicPEM))
+			})
+		})
+
+		Convey("When the signer does not match the certificate, it should fail", func() {
+			caKey, err := crypto.LoadEllipticCurveKey([]byte(caKeyPEM))
+			So(err, ShouldBeNil)
+
+			p, err := NewCompactPKIWithSigner(caKey, []byte(publicPEM), []byte(caPEM), controllerInfo, txKey, claimsheader.CompressionTypeV1)
+			So(err, ShouldNotBeNil)
+			So(p, ShouldBeNil)
+		})
+
+		Convey("When the certificate is not signed by the CA, it should fail", func() {
+			p, err := NewCompactPKIWithSigner(key, []byte(caPEM), []byte(publicPEM), controllerInfo, txKey, claimsheader.CompressionTypeV1)
+			So(err, ShouldNotBeNil)
+			So(p, ShouldBeNil)
+		})
+	})
+
+	Convey("Given secrets created with the key", t, func() {
+		tokenKey := &secrets.ControllerInfo{
+			PublicKey: []byte(caPEM),
+		}
+		controllerInfo := []*secrets.ControllerInfo{tokenKey}
+		p, err := NewCompactPKIWithTokenCA([]byte(privateKeyPEM), []byte(publicPEM), []byte(caPEM), controllerInfo, txKey, claimsheader.CompressionTypeV1)
+		So(err, ShouldBeNil)
+
+		Convey("The key should be part of the RPC secrets", func() {
+			r := p.RPCSecrets()
+			So(r.Key, ShouldResemble, []byte(privateKeyPEM))
+			So(r.RemoteSigner, ShouldBeFalse)
+		})
+	})
+}
+
+func TestSetFederatedDomains(t *testing.T) {
+	txKey := createTxtToken()
+	Convey("Given a valid CompactPKI and the CA of a federated domain", t, func() {
+		tokenKey := &secrets.ControllerInfo{
+			PublicKey: []byte(caPEM),
+		}
+		controllerInfo := []*secrets.ControllerInfo{tokenKey}
+		p, err := NewCompactPKIWithTokenCA([]byte(privateKeyPEM), []byte(publicPEM), []byte(caPEM), controllerInfo, txKey, claimsheader.CompressionTypeV1)
+		So(err, ShouldBeNil)
+
+		remoteKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		So(err, ShouldBeNil)
+
+		template := &x509.Certificate{
+			SerialNumber:          big.NewInt(1),
+			Subject:               pkix.Name{CommonName: "cluster-b"},
+			NotBefore:             time.Now().Add(-time.Hour),
+			NotAfter:              time.Now().Add(time.Hour),
+			KeyUsage:              x509.KeyUsageCertSign,
+			BasicConstraintsValid: true,
+			IsCA:                  true,
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, template, &remoteKey.PublicKey, remoteKey)
+		So(err, ShouldBeNil)
+
+		domain := &secrets.FederatedDomain{
+			Name:            "cluster-b",
+			Bundle:          pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+			NamespacePrefix: "/cluster-b",
+			TagRewrites:     map[string]string{"app": "remote:app"},
+		}
+
+		clientCert, err := crypto.LoadCertificate([]byte(publicPEM))
+		So(err, ShouldBeNil)
+
+		token, err := pkiverifier.NewPKIIssuer(remoteKey).CreateTokenFromCertificate(clientCert, []string{"$namespace=/apps", "app=web"})
+		So(err, ShouldBeNil)
+
+		Convey("The tokens of the federated domain should be rejected until it is set", func() {
+			_, _, _, _, err := p.KeyAndClaims(token)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("When I set the federated domain", func() {
+			So(p.SetFederatedDomains([]*secrets.FederatedDomain{domain}), ShouldBeNil)
+
+			Convey("The tokens of the federated domain should be accepted and rewritten", func() {
+				_, tags, _, controller, err := p.KeyAndClaims(token)
+				So(err, ShouldBeNil)
+				So(tags, ShouldResemble, []string{"$namespace=/cluster-b/apps", "remote:app=web"})
+				So(controller.Controller, ShouldEqual, "cluster-b")
+				So(controller.SameController, ShouldBeFalse)
+			})
+
+			Convey("The tokens of the trusted controllers should still be accepted", func() {
+				_, _, _, _, err := p.KeyAndClaims(txKey)
+				So(err, ShouldBeNil)
+			})
+
+			Convey("The tokens of the federated domain should be accepted with fail closed revocation", func() {
+				caKey, err := crypto.LoadEllipticCurveKey([]byte(caKeyPEM))
+				So(err, ShouldBeNil)
+				caCert, err := crypto.LoadCertificate([]byte(caPEM))
+				So(err, ShouldBeNil)
+				crl, err := caCert.CreateCRL(rand.Reader, caKey, nil, time.Now(), time.Now().Add(time.Hour))
+				So(err, ShouldBeNil)
+
+				So(p.SetRevocation([][]byte{crl}, revocation.FailClosed), ShouldBeNil)
+				_, tags, _, _, err := p.KeyAndClaims(token)
+				So(err, ShouldBeNil)
+				So(tags, ShouldResemble, []string{"$namespace=/cluster-b/apps", "remote:app=web"})
+			})
+
+			Convey("The federated domain should be part of the RPC secrets", func() {
+				So(p.RPCSecrets().FederatedDomains, ShouldResemble, []*secrets.FederatedDomain{domain})
+			})
+		})
+
+		Convey("When the bundle of the federated domain is invalid, it should fail", func() {
+			domain.Bundle = []byte("invalid")
+			So(p.SetFederatedDomains([]*secrets.FederatedDomain{domain}), ShouldNotBeNil)
+		})
+	})
+}
+
+func TestEd25519Secrets(t *testing.T) {
+	Convey("Given an ed25519 CA, an ed25519 certificate and its token", t, func() {
+		caPublicKey, caKey, err := ed25519.GenerateKey(rand.Reader)
+		So(err, ShouldBeNil)
+
+		caTemplate := &x509.Certificate{
+			SerialNumber:          big.NewInt(1),
+			Subject:               pkix.Name{CommonName: "ed25519 ca"},
+			NotBefore:             time.Now().Add(-time.Hour),
+			NotAfter:              time.Now().Add(time.Hour),
+			KeyUsage:              x509.KeyUsageCertSign,
+			BasicConstraintsValid: true,
+			IsCA:                  true,
+		}
+		caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, caPublicKey, caKey)
+		So(err, ShouldBeNil)
+		edCAPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER})
+		caCert, err := x509.ParseCertificate(caDER)
+		So(err, ShouldBeNil)
+
+		publicKey, key, err := ed25519.GenerateKey(rand.Reader)
+		So(err, ShouldBeNil)
+
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(2),
+			Subject:      pkix.Name{CommonName: "enforcer"},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, caCert, publicKey, caKey)
+		So(err, ShouldBeNil)
+		edCertPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+		cert, err := x509.ParseCertificate(der)
+		So(err, ShouldBeNil)
+
+		keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+		So(err, ShouldBeNil)
+		edKeyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+
+		txKey, err := pkiverifier.NewPKIIssuer(caKey).CreateTokenFromCertificate(cert, []string{"app=web"})
+		So(err, ShouldBeNil)
+
+		controllerInfo := []*secrets.ControllerInfo{{PublicKey: edCAPEM, Controller: &pkiverifier.PKIControllerInfo{Controller: "local"}}}
+
+		Convey("When I create a new compact PKI with the key, it should succeed", func() {
+			p, err := NewCompactPKIWithTokenCA(edKeyPEM, edCertPEM, edCAPEM, controllerInfo, txKey, claimsheader.CompressionTypeV1)
+			So(err, ShouldBeNil)
+			So(p.EncodingKey(), ShouldResemble, key)
+
+			Convey("The token should be verified and carry the ed25519 public key", func() {
+				pub, tags, expiration, controller, err := p.KeyAndClaims(txKey)
+				So(err, ShouldBeNil)
+				So(pub, ShouldResemble, publicKey)
+				So(tags, ShouldResemble, []string{"app=web"})
+				So(expiration.Unix(), ShouldEqual, cert.NotAfter.Unix())
+				So(controller.Controller, ShouldEqual, "local")
+			})
+
+			Convey("The tokens signed by the ecdsa CA should be rejected", func() {
+				_, _, _, _, err := p.KeyAndClaims(createTxtToken())
+				So(err, ShouldNotBeNil)
+			})
+
+			Convey("The tokens of an ed25519 federated domain should be accepted", func() {
+				remotePublicKey, remoteKey, err := ed25519.GenerateKey(rand.Reader)
+				So(err, ShouldBeNil)
+
+				remoteTemplate := &x509.Certificate{
+					SerialNumber:          big.NewInt(3),
+					Subject:               pkix.Name{CommonName: "cluster-b"},
+					NotBefore:             time.Now().Add(-time.Hour),
+					NotAfter:              time.Now().Add(time.Hour),
+					KeyUsage:              x509.KeyUsageCertSign,
+					BasicConstraintsValid: true,
+					IsCA:                  true,
+				}
+				remoteDER, err := x509.CreateCertificate(rand.Reader, remoteTemplate, remoteTemplate, remotePublicKey, remoteKey)
+				So(err, ShouldBeNil)
+
+				So(p.SetFederatedDomains([]*secrets.FederatedDomain{{
+					Name:        "cluster-b",
+					Bundle:      pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: remoteDER}),
+					TagRewrites: map[string]string{"app": "remote:app"},
+				}}), ShouldBeNil)
+
+				token, err := pkiverifier.NewPKIIssuer(remoteKey).CreateTokenFromCertificate(cert, []string{"app=web"})
+				So(err, ShouldBeNil)
+
+				pub, tags, _, controller, err := p.KeyAndClaims(token)
+				So(err, ShouldBeNil)
+				So(pub, ShouldResemble, publicKey)
+				So(tags, ShouldResemble, []string{"remote:app=web"})
+				So(controller.Controller, ShouldEqual, "cluster-b")
+			})
+		})
+
+		Convey("When I create a new compact PKI with a signer, it should succeed", func() {
+			p, err := NewCompactPKIWithSigner(key, edCertPEM, edCAPEM, controllerInfo, txKey, claimsheader.CompressionTypeV1)
+			So(err, ShouldBeNil)
+
+			pub, _, _, _, err := p.KeyAndClaims(txKey)
+			So(err, ShouldBeNil)
+			So(pub, ShouldResemble, publicKey)
+		})
+	})
+}
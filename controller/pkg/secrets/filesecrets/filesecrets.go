@@ -0,0 +1,476 @@
+package filesecrets
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"go.aporeto.io/enforcerd/trireme-lib/collector"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/claimsheader"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/pkiverifier"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/secrets"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/secrets/compactpki"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/secrets/revocation"
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultPollInterval is the default interval between two reads of the files.
+	DefaultPollInterval = 10 * time.Second
+
+	// DefaultCAOverlap is the default time the previous CAs are trusted after
+	// a rotation.
+	DefaultCAOverlap = 24 * time.Hour
+
+	// DefaultExpiryWarning is the default time before the expiration of a
+	// certificate when it is reported.
+	DefaultExpiryWarning = 7 * 24 * time.Hour
+)
+
+// Updater takes the new secrets when they are rebuilt. The TriremeController
+// implements it and pushes the secrets to all its enforcers, including the
+// remote enforcers.
+type Updater interface {
+	UpdateSecrets(secrets secrets.Secrets) error
+}
+
+// Config is the configuration of the file secrets.
+type Config struct {
+	// KeyPath is the path of the PEM private key of the enforcer.
+	KeyPath string
+	// CertPath is the path of the PEM certificate of the enforcer.
+	CertPath string
+	// CAPath is the path of the PEM CA bundle.
+	CAPath string
+	// TokenPath is the path of the token transmitted on the wire.
+	TokenPath string
+	// TrustedControllers are the controllers trusted to sign the tokens. The
+	// certificates of the CA bundle are trusted if none is given.
+	TrustedControllers []*secrets.ControllerInfo
+	// Compressed is the compression of the tags.
+	Compressed claimsheader.CompressionType
+	// CAOverlap is the time the previous CA bundle is trusted along with the
+	// new one after a rotation.
+	CAOverlap time.Duration
+	// PollInterval is the interval between two reads of the files.
+	PollInterval time.Duration
+	// ExpiryWarning is the time before the expiration of a certificate when
+	// it is reported to the collector, if it collects the certificate events.
+	ExpiryWarning time.Duration
+	// CRLPaths are the paths of the PEM or DER CRLs of the CA. They are read
+	// again every poll interval like the other files.
+	CRLPaths []string
+	// RevocationMode is the behavior when the revocation status of a peer
+	// certificate is unknown, like when a CRL has expired.
+	RevocationMode revocation.Mode
+	// FederatedDomains are the trust domains of other clusters whose tokens
+	// are accepted. Their bundles are read again every poll interval like the
+	// other files.
+	FederatedDomains []FederatedDomain
+}
+
+// FederatedDomain is the configuration of a federated trust domain.
+type FederatedDomain struct {
+	// Name is the name of the trust domain. It is reported as the controller
+	// of the flows from the domain.
+	Name string
+	// BundlePath is the path of the PEM CA bundle of the trust domain.
+	BundlePath string
+	// NamespacePrefix is prepended to the namespace tags of the trust domain.
+	NamespacePrefix string
+	// TagRewrites maps the tag keys of the trust domain to local tag keys.
+	// The tags that are not mapped, or mapped to an empty key, are dropped.
+	TagRewrites map[string]string
+}
+
+// previousCA is a CA bundle that is still trusted after a rotation.
+type previousCA struct {
+	pem   []byte
+	until time.Time
+}
+
+// FileSecrets implements the Secrets interface with PEM files on disk. The
+// files are read again every poll interval, and the secrets are rebuilt and
+// pushed to the updater when they change. After a rotation of the CA bundle,
+// the previous bundle stays trusted for the overlap period so that the peers
+// that have not received the new bundle yet keep working.
+type FileSecrets struct {
+	cfg       Config
+	updater   Updater
+	collector collector.EventCollector
+
+	current     *compactpki.CompactPKI
+	hash        []byte
+	caPEM       []byte
+	previousCAs []previousCA
+	reported    map[string]string
+
+	now func() time.Time
+
+	sync.RWMutex
+}
+
+// New reads the files of the configuration and creates the secrets. The
+// updater and the collector are optional.
+func New(cfg Config, updater Updater, c collector.EventCollector) (*FileSecrets, error) {
+
+	if cfg.KeyPath == "" || cfg.CertPath == "" || cfg.CAPath == "" || cfg.TokenPath == "" {
+		return nil, errors.New("key, certificate, ca and token paths are required")
+	}
+
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = DefaultPollInterval
+	}
+
+	if cfg.CAOverlap <= 0 {
+		cfg.CAOverlap = DefaultCAOverlap
+	}
+
+	if cfg.ExpiryWarning <= 0 {
+		cfg.ExpiryWarning = DefaultExpiryWarning
+	}
+
+	if c == nil {
+		c = collector.NewDefaultCollector()
+	}
+
+	f := &FileSecrets{
+		cfg:       cfg,
+		updater:   updater,
+		collector: c,
+		reported:  map[string]string{},
+		now:       time.Now,
+	}
+
+	if _, err := f.reload(); err != nil {
+		return nil, err
+	}
+
+	f.checkExpiration()
+
+	return f, nil
+}
+
+// Run reads the files every poll interval until the context is done.
+func (f *FileSecrets) Run(ctx context.Context) {
+
+	ticker := time.NewTicker(f.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			f.Refresh()
+		}
+	}
+}
+
+// Refresh rebuilds the secrets if the files have changed or if a previous CA
+// bundle is not trusted anymore, and pushes them to the updater. The current
+// secrets are kept if the files can not be loaded, like when they are being
+// written.
+func (f *FileSecrets) Refresh() {
+
+	changed, err := f.reload()
+	if err != nil {
+		zap.L().Warn("Unable to reload the secrets", zap.Error(err))
+	}
+
+	if changed && f.updater != nil {
+		if err := f.updater.UpdateSecrets(f.Current()); err != nil {
+			zap.L().Error("Unable to update the secrets", zap.Error(err))
+		}
+	}
+
+	f.checkExpiration()
+}
+
+// Current returns the current secrets. They are not updated in place, the
+// updater receives new secrets instead.
+func (f *FileSecrets) Current() secrets.Secrets {
+
+	f.RLock()
+	defer f.RUnlock()
+
+	return f.current
+}
+
+// EncodingKey implements the Secrets interface.
+func (f *FileSecrets) EncodingKey() interface{} {
+	return f.Current().EncodingKey()
+}
+
+// PublicKey implements the Secrets interface.
+func (f *FileSecrets) PublicKey() interface{} {
+	return f.Current().PublicKey()
+}
+
+// CertAuthority implements the Secrets interface.
+func (f *FileSecrets) CertAuthority() []byte {
+	return f.Current().CertAuthority()
+}
+
+// TransmittedKey implements the Secrets interface.
+func (f *FileSecrets) TransmittedKey() []byte {
+	return f.Current().TransmittedKey()
+}
+
+// KeyAndClaims implements the Secrets interface.
+func (f *FileSecrets) KeyAndClaims(pkey []byte) (interface{}, []string, time.Time, *pkiverifier.PKIControllerInfo, error) {
+	return f.Current().KeyAndClaims(pkey)
+}
+
+// AckSize implements the Secrets interface.
+func (f *FileSecrets) AckSize() uint32 {
+	return f.Current().AckSize()
+}
+
+// RPCSecrets implements the Secrets interface.
+func (f *FileSecrets) RPCSecrets() secrets.RPCSecrets {
+	return f.Current().RPCSecrets()
+}
+
+// Revocation implements the Secrets interface.
+func (f *FileSecrets) Revocation() *revocation.Checker {
+	return f.Current().Revocation()
+}
+
+// reload reads the files and rebuilds the secrets if needed. It returns true
+// if the secrets have been rebuilt.
+func (f *FileSecrets) reload() (bool, error) {
+
+	keyPEM, err := ioutil.ReadFile(f.cfg.KeyPath)
+	if err != nil {
+		return false, fmt.Errorf("unable to read key: %s", err)
+	}
+
+	certPEM, err := ioutil.ReadFile(f.cfg.CertPath)
+	if err != nil {
+		return false, fmt.Errorf("unable to read certificate: %s", err)
+	}
+
+	caPEM, err := ioutil.ReadFile(f.cfg.CAPath)
+	if err != nil {
+		return false, fmt.Errorf("unable to read ca: %s", err)
+	}
+
+	token, err := ioutil.ReadFile(f.cfg.TokenPath)
+	if err != nil {
+		return false, fmt.Errorf("unable to read token: %s", err)
+	}
+	token = bytes.TrimSpace(token)
+
+	crls := make([][]byte, 0, len(f.cfg.CRLPaths))
+	for _, path := range f.cfg.CRLPaths {
+		crl, err := ioutil.ReadFile(path)
+		if err != nil {
+			return false, fmt.Errorf("unable to read crl: %s", err)
+		}
+		crls = append(crls, crl)
+	}
+
+	domains := make([]*secrets.FederatedDomain, 0, len(f.cfg.FederatedDomains))
+	for _, d := range f.cfg.FederatedDomains {
+		bundle, err := ioutil.ReadFile(d.BundlePath)
+		if err != nil {
+			return false, fmt.Errorf("unable to read bundle of federated domain %s: %s", d.Name, err)
+		}
+		domains = append(domains, &secrets.FederatedDomain{
+			Name:            d.Name,
+			Bundle:          bundle,
+			NamespacePrefix: d.NamespacePrefix,
+			TagRewrites:     d.TagRewrites,
+		})
+	}
+
+	h := sha256.New()
+	for _, b := range append([][]byte{keyPEM, certPEM, caPEM, token}, crls...) {
+		h.Write(b) // nolint: errcheck
+	}
+	for _, d := range domains {
+		h.Write(d.Bundle) // nolint: errcheck
+	}
+	hash := h.Sum(nil)
+
+	f.Lock()
+	defer f.Unlock()
+
+	now := f.now()
+
+	// Drop the previous CA bundles that have outlived the overlap.
+	previousCAs := []previousCA{}
+	for _, p := range f.previousCAs {
+		if now.Before(p.until) {
+			previousCAs = append(previousCAs, p)
+		}
+	}
+
+	if bytes.Equal(hash, f.hash) && len(previousCAs) == len(f.previousCAs) {
+		return false, nil
+	}
+
+	if f.caPEM != nil && !bytes.Equal(caPEM, f.caPEM) {
+		previousCAs = append(previousCAs, previousCA{pem: f.caPEM, until: now.Add(f.cfg.CAOverlap)})
+	}
+
+	bundle := append([]byte{}, caPEM...)
+	for _, p := range previousCAs {
+		bundle = append(bundle, '\n')
+		bundle = append(bundle, p.pem...)
+	}
+
+	trustedControllers := f.cfg.TrustedControllers
+	if len(trustedControllers) == 0 {
+		trustedControllers = controllersFromBundle(bundle)
+	}
+
+	s, err := compactpki.NewCompactPKIWithTokenCA(keyPEM, certPEM, bundle, trustedControllers, token, f.cfg.Compressed)
+	if err != nil {
+		return false, fmt.Errorf("unable to create secrets: %s", err)
+	}
+
+	if len(crls) > 0 {
+		if err := s.SetRevocation(crls, f.cfg.RevocationMode); err != nil {
+			return false, fmt.Errorf("unable to load crls: %s", err)
+		}
+	}
+
+	if len(domains) > 0 {
+		if err := s.SetFederatedDomains(domains); err != nil {
+			return false, fmt.Errorf("unable to load federated domains: %s", err)
+		}
+	}
+
+	f.current = s
+	f.hash = hash
+	f.caPEM = caPEM
+	f.previousCAs = previousCAs
+
+	zap.L().Info("Secrets loaded",
+		zap.String("certificate", f.cfg.CertPath),
+		zap.Int("previousCAs", len(previousCAs)),
+		zap.Int("crls", len(crls)),
+		zap.Int("federatedDomains", len(domains)),
+	)
+
+	return true, nil
+}
+
+// checkExpiration reports the certificates of the enforcer and of the CA
+// bundle that expire within the warning period. A certificate is reported once
+// when it is about to expire and once when it has expired. The events are sent
+// to the collector if it implements collector.CertificateEventCollector.
+func (f *FileSecrets) checkExpiration() {
+
+	f.Lock()
+	defer f.Unlock()
+
+	if f.current == nil {
+		return
+	}
+
+	now := f.now()
+	certs := map[string][]*x509.Certificate{
+		f.cfg.CertPath: parseCertificates(f.current.RPCSecrets().Certificate),
+		f.cfg.CAPath:   parseCertificates(f.caPEM),
+	}
+
+	for path, list := range certs {
+		for _, cert := range list {
+
+			reason := ""
+			switch {
+			case now.After(cert.NotAfter):
+				reason = collector.CertificateExpired
+			case now.Add(f.cfg.ExpiryWarning).After(cert.NotAfter):
+				reason = collector.CertificateExpiring
+			default:
+				continue
+			}
+
+			key := path + "/" + cert.SerialNumber.String()
+			if f.reported[key] == reason {
+				continue
+			}
+			f.reported[key] = reason
+
+			zap.L().Warn("Certificate expiration",
+				zap.String("path", path),
+				zap.String("subject", cert.Subject.String()),
+				zap.Time("expiration", cert.NotAfter),
+				zap.String("reason", reason),
+			)
+
+			c, ok := f.collector.(collector.CertificateEventCollector)
+			if !ok {
+				continue
+			}
+
+			c.CollectCertificateEvent(&collector.CertificateReport{
+				Timestamp:  now,
+				Path:       path,
+				Subject:    cert.Subject.String(),
+				Serial:     cert.SerialNumber.String(),
+				Expiration: cert.NotAfter,
+				Reason:     reason,
+			})
+		}
+	}
+}
+
+// controllersFromBundle returns the certificates of a CA bundle as trusted
+// controllers.
+func controllersFromBundle(bundle []byte) []*secrets.ControllerInfo {
+
+	controllers := []*secrets.ControllerInfo{}
+
+	for {
+		var block *pem.Block
+		block, bundle = pem.Decode(bundle)
+		if block == nil {
+			return controllers
+		}
+
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		controllers = append(controllers, &secrets.ControllerInfo{
+			PublicKey: pem.EncodeToMemory(block),
+		})
+	}
+}
+
+// parseCertificates returns the certificates of a PEM bundle.
+func parseCertificates(bundle []byte) []*x509.Certificate {
+
+	certs := []*x509.Certificate{}
+
+	for {
+		var block *pem.Block
+		block, bundle = pem.Decode(bundle)
+		if block == nil {
+			return certs
+		}
+
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			continue
+		}
+
+		certs = append(certs, cert)
+	}
+}
@@ -0,0 +1,297 @@
+package filesecrets
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.aporeto.io/enforcerd/trireme-lib/collector"
+	"go.aporeto.io/enforcerd/trireme-lib/collector/mockcollector"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/secrets"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/secrets/revocation"
+)
+
+type testUpdater struct {
+	updates int
+	secrets secrets.Secrets
+}
+
+func (u *testUpdater) UpdateSecrets(s secrets.Secrets) error {
+	u.updates++
+	u.secrets = s
+	return nil
+}
+
+// certificateCollector is an event collector that collects the certificate
+// events.
+type certificateCollector struct {
+	*mockcollector.MockEventCollector
+	*mockcollector.MockCertificateEventCollector
+}
+
+var serial int64
+
+func createCertificate(name string, notAfter time.Time, isCA bool, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey, []byte, []byte) {
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	So(err, ShouldBeNil)
+
+	serial++
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              notAfter,
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		SubjectKeyId:          []byte(name),
+	}
+
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	So(err, ShouldBeNil)
+
+	cert, err := x509.ParseCertificate(der)
+	So(err, ShouldBeNil)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	So(err, ShouldBeNil)
+
+	return cert, key,
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func writeFile(path string, data []byte) {
+	So(ioutil.WriteFile(path, data, 0600), ShouldBeNil)
+}
+
+func TestFileSecrets(t *testing.T) {
+
+	Convey("Given the secrets files of an enforcer", t, func() {
+
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		dir, err := ioutil.TempDir("", "filesecrets")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir) // nolint
+
+		cfg := Config{
+			KeyPath:   filepath.Join(dir, "key.pem"),
+			CertPath:  filepath.Join(dir, "cert.pem"),
+			CAPath:    filepath.Join(dir, "ca.pem"),
+			TokenPath: filepath.Join(dir, "token"),
+			CAOverlap: time.Hour,
+		}
+
+		expiration := time.Now().Add(365 * 24 * time.Hour)
+
+		ca1, ca1Key, ca1PEM, _ := createCertificate("ca1", expiration, true, nil, nil)
+		_, _, certPEM, keyPEM := createCertificate("enforcer", expiration, false, ca1, ca1Key)
+
+		writeFile(cfg.KeyPath, keyPEM)
+		writeFile(cfg.CertPath, certPEM)
+		writeFile(cfg.CAPath, ca1PEM)
+		writeFile(cfg.TokenPath, []byte("token\n"))
+
+		updater := &testUpdater{}
+		c := mockcollector.NewMockCertificateEventCollector(ctrl)
+		ec := &certificateCollector{mockcollector.NewMockEventCollector(ctrl), c}
+
+		Convey("When a path is missing, I should get an error", func() {
+			cfg.TokenPath = ""
+			_, err := New(cfg, updater, ec)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("When the files are invalid, I should get an error", func() {
+			writeFile(cfg.CertPath, []byte("invalid"))
+			_, err := New(cfg, updater, ec)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("When I create the secrets", func() {
+			f, err := New(cfg, updater, ec)
+			So(err, ShouldBeNil)
+
+			now := time.Now()
+			f.now = func() time.Time { return now }
+
+			Convey("They should be loaded from the files", func() {
+				So(f.CertAuthority(), ShouldResemble, ca1PEM)
+				So(f.TransmittedKey(), ShouldResemble, []byte("token"))
+				So(f.RPCSecrets().Certificate, ShouldResemble, certPEM)
+				So(f.RPCSecrets().TrustedControllers, ShouldHaveLength, 1)
+			})
+
+			Convey("When the files do not change, the secrets should not be updated", func() {
+				f.Refresh()
+				So(updater.updates, ShouldEqual, 0)
+			})
+
+			Convey("When the certificate is renewed, the secrets should be updated", func() {
+				_, _, newCertPEM, newKeyPEM := createCertificate("enforcer", expiration, false, ca1, ca1Key)
+				writeFile(cfg.KeyPath, newKeyPEM)
+				writeFile(cfg.CertPath, newCertPEM)
+
+				f.Refresh()
+				So(updater.updates, ShouldEqual, 1)
+				So(updater.secrets.RPCSecrets().Certificate, ShouldResemble, newCertPEM)
+				So(f.RPCSecrets().Key, ShouldResemble, newKeyPEM)
+			})
+
+			Convey("When the files are partially written, the secrets should be kept", func() {
+				writeFile(cfg.KeyPath, []byte("partial"))
+
+				f.Refresh()
+				So(updater.updates, ShouldEqual, 0)
+				So(f.RPCSecrets().Key, ShouldResemble, keyPEM)
+			})
+
+			Convey("When a CRL is configured", func() {
+				crlDER, err := ca1.CreateCRL(rand.Reader, ca1Key, []pkix.RevokedCertificate{
+					{SerialNumber: big.NewInt(1000), RevocationTime: time.Now()},
+				}, time.Now(), expiration)
+				So(err, ShouldBeNil)
+
+				f.cfg.CRLPaths = []string{filepath.Join(dir, "ca.crl")}
+				f.cfg.RevocationMode = revocation.FailClosed
+
+				Convey("The secrets should not be updated until the CRL is written", func() {
+					f.Refresh()
+					So(updater.updates, ShouldEqual, 0)
+					So(f.Revocation(), ShouldBeNil)
+				})
+
+				Convey("The secrets should be updated with the CRL", func() {
+					writeFile(f.cfg.CRLPaths[0], crlDER)
+					f.Refresh()
+					So(updater.updates, ShouldEqual, 1)
+					So(f.Revocation(), ShouldNotBeNil)
+					So(f.Revocation().CheckSerial(big.NewInt(1000), ca1.SubjectKeyId), ShouldEqual, revocation.ErrRevoked)
+					So(f.RPCSecrets().CRLs, ShouldResemble, [][]byte{crlDER})
+					So(f.RPCSecrets().RevocationMode, ShouldEqual, revocation.FailClosed)
+				})
+
+				Convey("The secrets should be kept if the CRL is not signed by the CA", func() {
+					other, otherKey, _, _ := createCertificate("other", expiration, true, nil, nil)
+					otherDER, err := other.CreateCRL(rand.Reader, otherKey, nil, time.Now(), expiration)
+					So(err, ShouldBeNil)
+
+					writeFile(f.cfg.CRLPaths[0], otherDER)
+					f.Refresh()
+					So(updater.updates, ShouldEqual, 0)
+					So(f.Revocation(), ShouldBeNil)
+				})
+			})
+
+			Convey("When a federated domain is configured", func() {
+				_, _, remotePEM, _ := createCertificate("cluster-b", expiration, true, nil, nil)
+
+				f.cfg.FederatedDomains = []FederatedDomain{
+					{
+						Name:            "cluster-b",
+						BundlePath:      filepath.Join(dir, "cluster-b.pem"),
+						NamespacePrefix: "/cluster-b",
+					},
+				}
+
+				Convey("The secrets should not be updated until the bundle is written", func() {
+					f.Refresh()
+					So(updater.updates, ShouldEqual, 0)
+					So(f.RPCSecrets().FederatedDomains, ShouldBeEmpty)
+				})
+
+				Convey("The secrets should be updated with the federated domain", func() {
+					writeFile(f.cfg.FederatedDomains[0].BundlePath, remotePEM)
+					f.Refresh()
+					So(updater.updates, ShouldEqual, 1)
+					So(f.RPCSecrets().FederatedDomains, ShouldHaveLength, 1)
+					So(f.RPCSecrets().FederatedDomains[0].Name, ShouldEqual, "cluster-b")
+					So(f.RPCSecrets().FederatedDomains[0].Bundle, ShouldResemble, remotePEM)
+				})
+			})
+
+			Convey("When the CA is rotated", func() {
+				ca2, ca2Key, ca2PEM, _ := createCertificate("ca2", expiration, true, nil, nil)
+				_, _, newCertPEM, newKeyPEM := createCertificate("enforcer", expiration, false, ca2, ca2Key)
+
+				writeFile(cfg.KeyPath, newKeyPEM)
+				writeFile(cfg.CertPath, newCertPEM)
+
+				Convey("The new certificate should not be loaded until the CA is written", func() {
+					f.Refresh()
+					So(updater.updates, ShouldEqual, 0)
+					So(f.CertAuthority(), ShouldResemble, ca1PEM)
+				})
+
+				writeFile(cfg.CAPath, ca2PEM)
+				f.Refresh()
+
+				Convey("The old and new CAs should be trusted", func() {
+					So(updater.updates, ShouldEqual, 1)
+					So(bytes.Contains(f.CertAuthority(), ca1PEM), ShouldBeTrue)
+					So(bytes.Contains(f.CertAuthority(), ca2PEM), ShouldBeTrue)
+					So(f.RPCSecrets().TrustedControllers, ShouldHaveLength, 2)
+				})
+
+				Convey("The old CA should be trusted during the overlap", func() {
+					now = now.Add(30 * time.Minute)
+					f.Refresh()
+					So(updater.updates, ShouldEqual, 1)
+					So(bytes.Contains(f.CertAuthority(), ca1PEM), ShouldBeTrue)
+				})
+
+				Convey("The old CA should not be trusted after the overlap", func() {
+					now = now.Add(2 * time.Hour)
+					f.Refresh()
+					So(updater.updates, ShouldEqual, 2)
+					So(updater.secrets.CertAuthority(), ShouldResemble, ca2PEM)
+					So(f.RPCSecrets().TrustedControllers, ShouldHaveLength, 1)
+				})
+			})
+
+			Convey("When the certificate expires, it should be reported once", func() {
+				c.EXPECT().CollectCertificateEvent(gomock.Any()).Times(1).Do(func(r *collector.CertificateReport) {
+					So(r.Path, ShouldEqual, cfg.CertPath)
+					So(r.Subject, ShouldEqual, "CN=enforcer")
+					So(r.Reason, ShouldEqual, collector.CertificateExpiring)
+				})
+				c.EXPECT().CollectCertificateEvent(gomock.Any()).Times(1).Do(func(r *collector.CertificateReport) {
+					So(r.Path, ShouldEqual, cfg.CAPath)
+					So(r.Reason, ShouldEqual, collector.CertificateExpiring)
+				})
+
+				now = expiration.Add(-24 * time.Hour)
+				f.Refresh()
+				f.Refresh()
+
+				c.EXPECT().CollectCertificateEvent(gomock.Any()).Times(2).Do(func(r *collector.CertificateReport) {
+					So(r.Reason, ShouldEqual, collector.CertificateExpired)
+				})
+
+				now = expiration.Add(time.Hour)
+				f.Refresh()
+				f.Refresh()
+			})
+		})
+	})
+}
@@ -8,6 +8,7 @@ import (
 	gomock "github.com/golang/mock/gomock"
 	pkiverifier "go.aporeto.io/enforcerd/trireme-lib/controller/pkg/pkiverifier"
 	secrets "go.aporeto.io/enforcerd/trireme-lib/controller/pkg/secrets"
+	revocation "go.aporeto.io/enforcerd/trireme-lib/controller/pkg/secrets/revocation"
 	reflect "reflect"
 	time "time"
 )
@@ -174,3 +175,17 @@ func (mr *MockSecretsMockRecorder) RPCSecrets() *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RPCSecrets", reflect.TypeOf((*MockSecrets)(nil).RPCSecrets))
 }
+
+// Revocation mocks base method
+func (m *MockSecrets) Revocation() *revocation.Checker {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Revocation")
+	ret0, _ := ret[0].(*revocation.Checker)
+	return ret0
+}
+
+// Revocation indicates an expected call of Revocation
+func (mr *MockSecretsMockRecorder) Revocation() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Revocation", reflect.TypeOf((*MockSecrets)(nil).Revocation))
+}
@@ -0,0 +1,306 @@
+package revocation
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// Mode is the behavior of the checks when the revocation status of a
+// certificate is unknown.
+type Mode int
+
+const (
+	// FailOpen accepts the certificates with an unknown revocation status.
+	FailOpen Mode = iota
+	// FailClosed rejects the certificates with an unknown revocation status.
+	FailClosed
+)
+
+const (
+	crlBlockType = "X509 CRL"
+)
+
+var (
+	// ErrRevoked is returned when a certificate is revoked.
+	ErrRevoked = errors.New("certificate revoked")
+	// ErrUnknown is returned when the revocation status of a certificate is
+	// unknown in fail closed mode.
+	ErrUnknown = errors.New("certificate revocation status unknown")
+)
+
+// crl holds the revoked serial numbers of a CRL. The next update is zero if
+// none of the CRLs of the issuer has one, since it is optional.
+type crl struct {
+	revoked    map[string]struct{}
+	nextUpdate time.Time
+}
+
+// expired returns true if the CRL must have been updated at the given time.
+func (e *crl) expired(now time.Time) bool {
+	return !e.nextUpdate.IsZero() && now.After(e.nextUpdate)
+}
+
+// Checker checks the revocation of certificates against CRLs issued by the
+// trusted authorities. The CRLs are loaded locally, they are never fetched.
+// A nil Checker accepts all the certificates.
+type Checker struct {
+	crls        map[string]*crl
+	keyIDs      map[string]*crl
+	raw         [][]byte
+	authorities []*x509.Certificate
+	mode        Mode
+	now         func() time.Time
+}
+
+// NewChecker parses the PEM or DER encoded CRLs and verifies that they are
+// signed by one of the authorities.
+func NewChecker(crls [][]byte, authorities []*x509.Certificate, mode Mode) (*Checker, error) {
+
+	c := &Checker{
+		crls:        map[string]*crl{},
+		keyIDs:      map[string]*crl{},
+		raw:         crls,
+		authorities: authorities,
+		mode:        mode,
+		now:         time.Now,
+	}
+
+	for _, data := range crls {
+		for _, der := range decodeCRLs(data) {
+			if err := c.add(der); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return c, nil
+}
+
+// add parses a DER encoded CRL and adds its revoked serial numbers to the
+// ones of its issuer.
+func (c *Checker) add(der []byte) error {
+
+	list, err := x509.ParseCRL(der)
+	if err != nil {
+		return fmt.Errorf("unable to parse crl: %s", err)
+	}
+
+	issuer, err := c.issuer(list)
+	if err != nil {
+		return err
+	}
+
+	key := string(issuer.RawSubject)
+	entry, ok := c.crls[key]
+	if !ok {
+		entry = &crl{
+			revoked:    map[string]struct{}{},
+			nextUpdate: list.TBSCertList.NextUpdate,
+		}
+		c.crls[key] = entry
+		if len(issuer.SubjectKeyId) > 0 {
+			c.keyIDs[string(issuer.SubjectKeyId)] = entry
+		}
+	}
+
+	// The earliest next update of the CRLs of the issuer applies.
+	if nextUpdate := list.TBSCertList.NextUpdate; !nextUpdate.IsZero() && (entry.nextUpdate.IsZero() || nextUpdate.Before(entry.nextUpdate)) {
+		entry.nextUpdate = nextUpdate
+	}
+
+	for _, r := range list.TBSCertList.RevokedCertificates {
+		entry.revoked[r.SerialNumber.String()] = struct{}{}
+	}
+
+	return nil
+}
+
+// issuer returns the authority that signed the CRL.
+func (c *Checker) issuer(list *pkix.CertificateList) (*x509.Certificate, error) {
+
+	for _, authority := range c.authorities {
+		if authority.CheckCRLSignature(list) == nil {
+			return authority, nil
+		}
+	}
+
+	return nil, fmt.Errorf("crl of %s is not signed by a trusted authority", list.TBSCertList.Issuer.String())
+}
+
+// Mode returns the mode of the checker.
+func (c *Checker) Mode() Mode {
+
+	if c == nil {
+		return FailOpen
+	}
+
+	return c.mode
+}
+
+// CRLs returns the CRLs of the checker as they were loaded.
+func (c *Checker) CRLs() [][]byte {
+
+	if c == nil {
+		return nil
+	}
+
+	return c.raw
+}
+
+// Authorities returns the authorities of the checker.
+func (c *Checker) Authorities() []*x509.Certificate {
+
+	if c == nil {
+		return nil
+	}
+
+	return c.authorities
+}
+
+// Check checks the revocation of a certificate against the CRL of its
+// issuer. It returns ErrRevoked if the certificate is revoked. It returns
+// ErrUnknown in fail closed mode if there is no valid CRL for its issuer.
+func (c *Checker) Check(cert *x509.Certificate) error {
+
+	if c == nil {
+		return nil
+	}
+
+	entry, ok := c.crls[string(cert.RawIssuer)]
+	if !ok || entry.expired(c.now()) {
+		return c.unknown()
+	}
+
+	if _, ok := entry.revoked[cert.SerialNumber.String()]; ok {
+		return ErrRevoked
+	}
+
+	return nil
+}
+
+// CheckSerial checks the revocation of a certificate of which only the
+// serial number and the key identifier of its issuer are known, like the
+// certificates of the peers of the datapath. The serial number is only checked
+// against the CRL of the authority with this key identifier. It returns
+// ErrUnknown in fail closed mode if the serial number or the key identifier is
+// missing, or if there is no valid CRL for the issuer.
+func (c *Checker) CheckSerial(serial *big.Int, authorityKeyID []byte) error {
+
+	if c == nil {
+		return nil
+	}
+
+	if serial == nil || len(authorityKeyID) == 0 {
+		return c.unknown()
+	}
+
+	entry, ok := c.keyIDs[string(authorityKeyID)]
+	if !ok || entry.expired(c.now()) {
+		return c.unknown()
+	}
+
+	if _, ok := entry.revoked[serial.String()]; ok {
+		return ErrRevoked
+	}
+
+	return nil
+}
+
+// VerifyChains checks the revocation of the certificates of the verified
+// chains of a TLS connection. The roots are not checked. The connection is
+// accepted if one of the chains is accepted.
+func (c *Checker) VerifyChains(verifiedChains [][]*x509.Certificate) error {
+
+	if c == nil || len(verifiedChains) == 0 {
+		return nil
+	}
+
+	var err error
+	for _, chain := range verifiedChains {
+		if err = c.verifyChain(chain); err == nil {
+			return nil
+		}
+	}
+
+	return err
+}
+
+// verifyChain checks the revocation of the certificates of a chain.
+func (c *Checker) verifyChain(chain []*x509.Certificate) error {
+
+	for i := 0; i < len(chain)-1; i++ {
+		if err := c.Check(chain[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CheckOCSP checks the revocation of a certificate with a stapled OCSP
+// response signed by its issuer. A nil Checker still rejects the certificates
+// that are revoked by their responder.
+func (c *Checker) CheckOCSP(response []byte, cert *x509.Certificate, issuer *x509.Certificate) error {
+
+	now := time.Now()
+	if c != nil {
+		now = c.now()
+	}
+
+	resp, err := ocsp.ParseResponseForCert(response, cert, issuer)
+	if err != nil || (!resp.NextUpdate.IsZero() && now.After(resp.NextUpdate)) {
+		return c.unknown()
+	}
+
+	switch resp.Status {
+	case ocsp.Good:
+		return nil
+	case ocsp.Revoked:
+		return ErrRevoked
+	default:
+		return c.unknown()
+	}
+}
+
+// unknown returns the error of an unknown revocation status.
+func (c *Checker) unknown() error {
+
+	if c.Mode() == FailClosed {
+		return ErrUnknown
+	}
+
+	return nil
+}
+
+// decodeCRLs returns the DER encoded CRLs of a PEM bundle, or the data itself
+// if it is not PEM encoded.
+func decodeCRLs(data []byte) [][]byte {
+
+	ders := [][]byte{}
+
+	rest := data
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+
+		if block.Type == crlBlockType {
+			ders = append(ders, block.Bytes)
+		}
+	}
+
+	if len(ders) == 0 && len(data) > 0 {
+		ders = append(ders, data)
+	}
+
+	return ders
+}
@@ -0,0 +1,329 @@
+package revocation
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"golang.org/x/crypto/ocsp"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		SubjectKeyId:          []byte(name),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testCA{cert: cert, key: key}
+}
+
+func (ca *testCA) issue(t *testing.T, serial int64, ocspServer string) (*x509.Certificate, crypto.Signer) {
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "enforcer"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	if ocspServer != "" {
+		template.OCSPServer = []string{ocspServer}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cert, key
+}
+
+func (ca *testCA) crl(t *testing.T, nextUpdate time.Time, serials ...int64) []byte {
+
+	revoked := []pkix.RevokedCertificate{}
+	for _, s := range serials {
+		revoked = append(revoked, pkix.RevokedCertificate{
+			SerialNumber:   big.NewInt(s),
+			RevocationTime: time.Now(),
+		})
+	}
+
+	der, err := ca.cert.CreateCRL(rand.Reader, ca.key, revoked, time.Now(), nextUpdate)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: crlBlockType, Bytes: der})
+}
+
+func (ca *testCA) ocsp(t *testing.T, cert *x509.Certificate, status int) []byte {
+
+	resp, err := ocsp.CreateResponse(ca.cert, ca.cert, ocsp.Response{
+		Status:       status,
+		SerialNumber: cert.SerialNumber,
+		ThisUpdate:   time.Now().Add(-time.Minute),
+		NextUpdate:   time.Now().Add(time.Hour),
+		RevokedAt:    time.Now().Add(-time.Minute),
+	}, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return resp
+}
+
+func TestNewChecker(t *testing.T) {
+
+	Convey("Given a CA and its CRL", t, func() {
+
+		ca := newTestCA(t, "ca")
+		crl := ca.crl(t, time.Now().Add(time.Hour), 10)
+
+		Convey("When I create a checker with the CA, I should get no error", func() {
+			c, err := NewChecker([][]byte{crl}, []*x509.Certificate{ca.cert}, FailClosed)
+			So(err, ShouldBeNil)
+			So(c.Mode(), ShouldEqual, FailClosed)
+			So(c.CRLs(), ShouldResemble, [][]byte{crl})
+		})
+
+		Convey("When I create a checker with a DER CRL, I should get no error", func() {
+			block, _ := pem.Decode(crl)
+			c, err := NewChecker([][]byte{block.Bytes}, []*x509.Certificate{ca.cert}, FailOpen)
+			So(err, ShouldBeNil)
+			So(c.crls, ShouldHaveLength, 1)
+		})
+
+		Convey("When I create a checker with another CA, I should get an error", func() {
+			_, err := NewChecker([][]byte{crl}, []*x509.Certificate{newTestCA(t, "other").cert}, FailOpen)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("When I create a checker with an invalid CRL, I should get an error", func() {
+			_, err := NewChecker([][]byte{[]byte("invalid")}, []*x509.Certificate{ca.cert}, FailOpen)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestCheck(t *testing.T) {
+
+	Convey("Given a checker with the CRL of a CA", t, func() {
+
+		ca := newTestCA(t, "ca")
+		valid, _ := ca.issue(t, 11, "")
+		revoked, _ := ca.issue(t, 10, "")
+		other, _ := newTestCA(t, "other").issue(t, 12, "")
+
+		c, err := NewChecker([][]byte{ca.crl(t, time.Now().Add(time.Hour), 10)}, []*x509.Certificate{ca.cert}, FailClosed)
+		So(err, ShouldBeNil)
+
+		Convey("A valid certificate should be accepted", func() {
+			So(c.Check(valid), ShouldBeNil)
+			So(c.CheckSerial(valid.SerialNumber, valid.AuthorityKeyId), ShouldBeNil)
+			So(c.VerifyChains([][]*x509.Certificate{{valid, ca.cert}}), ShouldBeNil)
+		})
+
+		Convey("A revoked certificate should be rejected", func() {
+			So(c.Check(revoked), ShouldEqual, ErrRevoked)
+			So(c.CheckSerial(revoked.SerialNumber, revoked.AuthorityKeyId), ShouldEqual, ErrRevoked)
+			So(c.VerifyChains([][]*x509.Certificate{{revoked, ca.cert}}), ShouldEqual, ErrRevoked)
+		})
+
+		Convey("A serial number should only be checked against the CRL of its issuer", func() {
+			So(c.CheckSerial(revoked.SerialNumber, other.AuthorityKeyId), ShouldEqual, ErrUnknown)
+		})
+
+		Convey("A certificate without CRL should be unknown in fail closed mode", func() {
+			So(c.Check(other), ShouldEqual, ErrUnknown)
+			So(c.CheckSerial(other.SerialNumber, other.AuthorityKeyId), ShouldEqual, ErrUnknown)
+			So(c.CheckSerial(valid.SerialNumber, nil), ShouldEqual, ErrUnknown)
+			So(c.CheckSerial(nil, valid.AuthorityKeyId), ShouldEqual, ErrUnknown)
+		})
+
+		Convey("A certificate without CRL should be accepted in fail open mode", func() {
+			c.mode = FailOpen
+			So(c.Check(other), ShouldBeNil)
+			So(c.CheckSerial(revoked.SerialNumber, other.AuthorityKeyId), ShouldBeNil)
+			So(c.CheckSerial(nil, nil), ShouldBeNil)
+		})
+
+		Convey("When the CRL has expired, the status should be unknown", func() {
+			c.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+			So(c.Check(valid), ShouldEqual, ErrUnknown)
+			So(c.CheckSerial(valid.SerialNumber, valid.AuthorityKeyId), ShouldEqual, ErrUnknown)
+		})
+
+		Convey("When another CRL has no next update, the first one should still expire", func() {
+			c, err := NewChecker([][]byte{ca.crl(t, time.Now().Add(time.Hour), 10), ca.crl(t, time.Time{})}, []*x509.Certificate{ca.cert}, FailClosed)
+			So(err, ShouldBeNil)
+			So(c.Check(valid), ShouldBeNil)
+			c.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+			So(c.Check(valid), ShouldEqual, ErrUnknown)
+		})
+	})
+
+	Convey("Given a checker with a CRL without next update", t, func() {
+
+		ca := newTestCA(t, "ca")
+		valid, _ := ca.issue(t, 11, "")
+		revoked, _ := ca.issue(t, 10, "")
+
+		c, err := NewChecker([][]byte{ca.crl(t, time.Time{}, 10)}, []*x509.Certificate{ca.cert}, FailClosed)
+		So(err, ShouldBeNil)
+		c.now = func() time.Time { return time.Now().Add(24 * time.Hour) }
+
+		Convey("The CRL should never expire", func() {
+			So(c.Check(valid), ShouldBeNil)
+			So(c.CheckSerial(valid.SerialNumber, valid.AuthorityKeyId), ShouldBeNil)
+			So(c.Check(revoked), ShouldEqual, ErrRevoked)
+			So(c.CheckSerial(revoked.SerialNumber, revoked.AuthorityKeyId), ShouldEqual, ErrRevoked)
+		})
+	})
+
+	Convey("Given a nil checker", t, func() {
+
+		var c *Checker
+		cert, _ := newTestCA(t, "ca").issue(t, 10, "")
+
+		Convey("All the certificates should be accepted", func() {
+			So(c.Check(cert), ShouldBeNil)
+			So(c.CheckSerial(cert.SerialNumber, cert.AuthorityKeyId), ShouldBeNil)
+			So(c.VerifyChains([][]*x509.Certificate{{cert}}), ShouldBeNil)
+			So(c.Mode(), ShouldEqual, FailOpen)
+			So(c.CRLs(), ShouldBeNil)
+		})
+	})
+}
+
+func TestCheckOCSP(t *testing.T) {
+
+	Convey("Given a certificate and its issuer", t, func() {
+
+		ca := newTestCA(t, "ca")
+		cert, _ := ca.issue(t, 10, "")
+
+		c, err := NewChecker(nil, []*x509.Certificate{ca.cert}, FailClosed)
+		So(err, ShouldBeNil)
+
+		Convey("A good response should be accepted", func() {
+			So(c.CheckOCSP(ca.ocsp(t, cert, ocsp.Good), cert, ca.cert), ShouldBeNil)
+		})
+
+		Convey("A revoked response should be rejected", func() {
+			So(c.CheckOCSP(ca.ocsp(t, cert, ocsp.Revoked), cert, ca.cert), ShouldEqual, ErrRevoked)
+			So((*Checker)(nil).CheckOCSP(ca.ocsp(t, cert, ocsp.Revoked), cert, ca.cert), ShouldEqual, ErrRevoked)
+		})
+
+		Convey("An invalid response should be unknown", func() {
+			So(c.CheckOCSP([]byte("invalid"), cert, ca.cert), ShouldEqual, ErrUnknown)
+			So((*Checker)(nil).CheckOCSP([]byte("invalid"), cert, ca.cert), ShouldBeNil)
+		})
+	})
+}
+
+func TestStapler(t *testing.T) {
+
+	Convey("Given a certificate with an OCSP responder", t, func() {
+
+		ca := newTestCA(t, "ca")
+
+		var cert *x509.Certificate
+		status := ocsp.Good
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			if _, err := ocsp.ParseRequest(body); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.Write(ca.ocsp(t, cert, status)) // nolint: errcheck
+		}))
+		defer server.Close()
+
+		cert, key := ca.issue(t, 10, server.URL)
+		tlsCert := &tls.Certificate{Certificate: [][]byte{cert.Raw}, PrivateKey: key}
+
+		s := NewStapler()
+
+		staple := func() []byte {
+			var stapled *tls.Certificate
+			for i := 0; i < 100; i++ {
+				stapled = s.Staple(tlsCert, []*x509.Certificate{ca.cert})
+				if len(stapled.OCSPStaple) > 0 {
+					break
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+			return stapled.OCSPStaple
+		}
+
+		Convey("The good response should be stapled", func() {
+			resp, err := ocsp.ParseResponseForCert(staple(), cert, ca.cert)
+			So(err, ShouldBeNil)
+			So(resp.Status, ShouldEqual, ocsp.Good)
+			So(tlsCert.OCSPStaple, ShouldBeEmpty)
+		})
+
+		Convey("A revoked response should not be stapled", func() {
+			status = ocsp.Revoked
+			So(s.Staple(tlsCert, []*x509.Certificate{ca.cert}).OCSPStaple, ShouldBeEmpty)
+			time.Sleep(50 * time.Millisecond)
+			So(s.Staple(tlsCert, []*x509.Certificate{ca.cert}).OCSPStaple, ShouldBeEmpty)
+		})
+
+		Convey("A certificate without responder should not be stapled", func() {
+			other, key := ca.issue(t, 11, "")
+			otherCert := &tls.Certificate{Certificate: [][]byte{other.Raw}, PrivateKey: key}
+			So(s.Staple(otherCert, nil), ShouldEqual, otherCert)
+		})
+	})
+}
@@ -0,0 +1,255 @@
+package revocation
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/ocsp"
+)
+
+const (
+	// defaultStapleValidity is the validity of the OCSP responses that do not
+	// have a next update.
+	defaultStapleValidity = time.Hour
+
+	// retryInterval is the interval between two requests to a responder that
+	// failed.
+	retryInterval = time.Minute
+
+	// maxResponseSize is the maximum size of an OCSP response.
+	maxResponseSize = 1 << 20
+
+	ocspRequestContentType = "application/ocsp-request"
+)
+
+// staple is the OCSP response of a certificate.
+type staple struct {
+	leaf       *x509.Certificate
+	response   []byte
+	nextUpdate time.Time
+	refreshAt  time.Time
+	pending    bool
+}
+
+// Stapler staples the OCSP responses of the certificates of the TLS
+// listeners. The responses are requested to the responders of the
+// certificates and cached until half of their validity, then they are
+// refreshed in the background. The certificates are served without staple
+// until a good response is received.
+type Stapler struct {
+	client  *http.Client
+	staples map[string]*staple
+	now     func() time.Time
+
+	sync.Mutex
+}
+
+// NewStapler returns a new Stapler.
+func NewStapler() *Stapler {
+
+	return &Stapler{
+		client:  &http.Client{Timeout: 10 * time.Second},
+		staples: map[string]*staple{},
+		now:     time.Now,
+	}
+}
+
+// Staple returns a copy of the certificate with its OCSP response stapled if
+// there is a valid one. It returns the certificate itself otherwise. The
+// issuer of the certificate is looked up in its chain, then in the issuers.
+func (s *Stapler) Staple(cert *tls.Certificate, issuers []*x509.Certificate) *tls.Certificate {
+
+	if s == nil || cert == nil || len(cert.Certificate) == 0 {
+		return cert
+	}
+
+	key := string(cert.Certificate[0])
+	now := s.now()
+
+	s.Lock()
+	entry, ok := s.staples[key]
+	if !ok {
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			s.Unlock()
+			return cert
+		}
+		// Drop the certificates that have expired, like the ones that have
+		// been rotated.
+		for k, e := range s.staples {
+			if now.After(e.leaf.NotAfter) {
+				delete(s.staples, k)
+			}
+		}
+		entry = &staple{leaf: leaf}
+		s.staples[key] = entry
+	}
+
+	refresh := len(entry.leaf.OCSPServer) > 0 && !entry.pending && !now.Before(entry.refreshAt)
+	if refresh {
+		entry.pending = true
+	}
+
+	response := entry.response
+	if now.After(entry.nextUpdate) {
+		response = nil
+	}
+	s.Unlock()
+
+	if refresh {
+		go s.refresh(key, entry.leaf, findIssuer(cert, entry.leaf, issuers))
+	}
+
+	if len(response) == 0 {
+		return cert
+	}
+
+	stapled := *cert
+	stapled.OCSPStaple = response
+
+	return &stapled
+}
+
+// refresh requests the OCSP response of a certificate and caches it.
+func (s *Stapler) refresh(key string, leaf *x509.Certificate, issuer *x509.Certificate) {
+
+	response, nextUpdate, err := s.fetch(leaf, issuer)
+
+	s.Lock()
+	defer s.Unlock()
+
+	entry, ok := s.staples[key]
+	if !ok {
+		return
+	}
+	entry.pending = false
+
+	now := s.now()
+	if err != nil {
+		zap.L().Warn("Unable to get the OCSP response of the certificate",
+			zap.String("subject", leaf.Subject.String()),
+			zap.Error(err),
+		)
+		entry.refreshAt = now.Add(retryInterval)
+		return
+	}
+
+	entry.response = response
+	entry.nextUpdate = nextUpdate
+	entry.refreshAt = now.Add(nextUpdate.Sub(now) / 2)
+}
+
+// fetch requests the OCSP response of a certificate to its responders. Only
+// the good responses are returned.
+func (s *Stapler) fetch(leaf *x509.Certificate, issuer *x509.Certificate) ([]byte, time.Time, error) {
+
+	if issuer == nil {
+		return nil, time.Time{}, fmt.Errorf("issuer of %s not found", leaf.Subject.String())
+	}
+
+	request, err := ocsp.CreateRequest(leaf, issuer, nil)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("unable to create ocsp request: %s", err)
+	}
+
+	var lastErr error
+	for _, server := range leaf.OCSPServer {
+
+		raw, err := s.post(server, request)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		resp, err := ocsp.ParseResponseForCert(raw, leaf, issuer)
+		if err != nil {
+			lastErr = fmt.Errorf("invalid ocsp response from %s: %s", server, err)
+			continue
+		}
+
+		if resp.Status != ocsp.Good {
+			return nil, time.Time{}, fmt.Errorf("ocsp status of the certificate is %d", resp.Status)
+		}
+
+		nextUpdate := resp.NextUpdate
+		if nextUpdate.IsZero() {
+			nextUpdate = s.now().Add(defaultStapleValidity)
+		}
+
+		return raw, nextUpdate, nil
+	}
+
+	return nil, time.Time{}, lastErr
+}
+
+// post sends an OCSP request to a responder.
+func (s *Stapler) post(server string, request []byte) ([]byte, error) {
+
+	resp, err := s.client.Post(server, ocspRequestContentType, bytes.NewReader(request))
+	if err != nil {
+		return nil, fmt.Errorf("unable to reach ocsp responder %s: %s", server, err)
+	}
+	defer resp.Body.Close() // nolint: errcheck
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("ocsp responder %s returned %s", server, resp.Status)
+	}
+
+	return ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+}
+
+// findIssuer returns the issuer of the leaf from the chain of the certificate
+// or from the issuers.
+func findIssuer(cert *tls.Certificate, leaf *x509.Certificate, issuers []*x509.Certificate) *x509.Certificate {
+
+	for _, der := range cert.Certificate[1:] {
+		c, err := x509.ParseCertificate(der)
+		if err != nil {
+			continue
+		}
+		issuers = append([]*x509.Certificate{c}, issuers...)
+	}
+
+	for _, issuer := range issuers {
+		if leaf.CheckSignatureFrom(issuer) == nil {
+			return issuer
+		}
+	}
+
+	return nil
+}
+
+// ParseCertificates returns the certificates of a PEM bundle. The blocks that
+// are not certificates are ignored.
+func ParseCertificates(bundle []byte) []*x509.Certificate {
+
+	certs := []*x509.Certificate{}
+
+	for {
+		var block *pem.Block
+		block, bundle = pem.Decode(bundle)
+		if block == nil {
+			return certs
+		}
+
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			continue
+		}
+
+		certs = append(certs, cert)
+	}
+}
@@ -1,6 +1,8 @@
 package rpc
 
 import (
+	"crypto"
+
 	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/secrets"
 	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/secrets/compactpki"
 )
@@ -8,5 +10,42 @@ import (
 // NewSecrets creates a new set of secrets based on the RPCSecrets.
 // We support only one type for now, CompactPKI.
 func NewSecrets(r secrets.RPCSecrets) (secrets.Secrets, error) {
-	return compactpki.NewCompactPKIWithTokenCA(r.Key, r.Certificate, r.CA, r.TrustedControllers, r.Token, r.Compressed)
+
+	p, err := compactpki.NewCompactPKIWithTokenCA(r.Key, r.Certificate, r.CA, r.TrustedControllers, r.Token, r.Compressed)
+	if err != nil {
+		return nil, err
+	}
+
+	return withOptions(p, r)
+}
+
+// NewSecretsWithSigner creates a new set of secrets based on the RPCSecrets
+// that signs with the given signer instead of the key.
+func NewSecretsWithSigner(r secrets.RPCSecrets, signer crypto.Signer) (secrets.Secrets, error) {
+
+	p, err := compactpki.NewCompactPKIWithSigner(signer, r.Certificate, r.CA, r.TrustedControllers, r.Token, r.Compressed)
+	if err != nil {
+		return nil, err
+	}
+
+	return withOptions(p, r)
+}
+
+// withOptions loads the CRLs and the federated trust domains of the
+// RPCSecrets if there are any.
+func withOptions(p *compactpki.CompactPKI, r secrets.RPCSecrets) (secrets.Secrets, error) {
+
+	if len(r.CRLs) > 0 {
+		if err := p.SetRevocation(r.CRLs, r.RevocationMode); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(r.FederatedDomains) > 0 {
+		if err := p.SetFederatedDomains(r.FederatedDomains); err != nil {
+			return nil, err
+		}
+	}
+
+	return p, nil
 }
@@ -5,6 +5,7 @@ import (
 
 	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/claimsheader"
 	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/pkiverifier"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/secrets/revocation"
 )
 
 // LockedSecrets provides a way to use secrets where shared read access is required. The user becomes
@@ -31,6 +32,9 @@ type Secrets interface {
 	AckSize() uint32
 	// RPCSecrets returns the PEM formated secrets to be transmitted over the RPC interface.
 	RPCSecrets() RPCSecrets
+	// Revocation returns the revocation checker of the certificates. It is nil
+	// when no CRL is configured.
+	Revocation() *revocation.Checker
 }
 
 // ControllerInfo holds information about public keys
@@ -42,6 +46,23 @@ type ControllerInfo struct {
 	Controller *pkiverifier.PKIControllerInfo
 }
 
+// FederatedDomain is the trust domain of another cluster, with its own
+// controllers and CA, whose tokens are accepted. The tags of its tokens are
+// rewritten so that they can not be mistaken for the local ones, and the flows
+// from the domain are reported with its name as controller.
+type FederatedDomain struct {
+	// Name is the name of the trust domain.
+	Name string
+	// Bundle is the PEM CA bundle of the controllers of the trust domain that
+	// sign its tokens.
+	Bundle []byte
+	// NamespacePrefix is prepended to the namespace tags of the trust domain.
+	NamespacePrefix string
+	// TagRewrites maps the tag keys of the trust domain to local tag keys.
+	// The tags that are not mapped, or mapped to an empty key, are dropped.
+	TagRewrites map[string]string
+}
+
 // RPCSecrets includes all the secrets that can be transmitted over
 // the RPC interface.
 type RPCSecrets struct {
@@ -51,4 +72,14 @@ type RPCSecrets struct {
 	TrustedControllers []*ControllerInfo
 	Token              []byte
 	Compressed         claimsheader.CompressionType
+	// RemoteSigner is set when the key is not transmitted and the signatures
+	// must be requested over the RPC interface.
+	RemoteSigner bool
+	// CRLs are the certificate revocation lists of the CA and RevocationMode
+	// is the behavior when the revocation status is unknown.
+	CRLs           [][]byte
+	RevocationMode revocation.Mode
+	// FederatedDomains are the trust domains of other clusters whose tokens
+	// are accepted.
+	FederatedDomains []*FederatedDomain
 }
@@ -0,0 +1,216 @@
+package signer
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/rpc"
+	"os"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// agentService is the name of the RPC service of the agent.
+	agentService = "SignerAgent"
+
+	agentPublicKeyCommand = agentService + ".PublicKey"
+	agentSignCommand      = agentService + ".Sign"
+)
+
+// AgentRequest is the request sent to the agent.
+type AgentRequest struct {
+	Digest []byte
+	Hash   crypto.Hash
+}
+
+// AgentResponse is the response of the agent.
+type AgentResponse struct {
+	PublicKey []byte
+	Signature []byte
+}
+
+// Agent holds a crypto.Signer and signs the digests received over a unix
+// socket, so that the processes that use the key never load it.
+type Agent struct {
+	signer crypto.Signer
+}
+
+// NewAgent returns an agent that signs with the given signer.
+func NewAgent(signer crypto.Signer) *Agent {
+	return &Agent{
+		signer: signer,
+	}
+}
+
+// PublicKey returns the PKIX encoded public key of the signer.
+func (a *Agent) PublicKey(req AgentRequest, resp *AgentResponse) error {
+
+	pub, err := x509.MarshalPKIXPublicKey(a.signer.Public())
+	if err != nil {
+		return fmt.Errorf("unable to marshal public key: %s", err)
+	}
+
+	resp.PublicKey = pub
+
+	return nil
+}
+
+// Sign signs the digest of the request with the signer.
+func (a *Agent) Sign(req AgentRequest, resp *AgentResponse) error {
+
+	sig, err := a.signer.Sign(rand.Reader, req.Digest, req.Hash)
+	if err != nil {
+		return fmt.Errorf("unable to sign: %s", err)
+	}
+
+	resp.Signature = sig
+
+	return nil
+}
+
+// Serve serves the signatures on the unix socket at socketPath until the
+// context is done. The socket is only accessible by the owner of the process.
+func (a *Agent) Serve(ctx context.Context, socketPath string) error {
+
+	server := rpc.NewServer()
+	if err := server.RegisterName(agentService, a); err != nil {
+		return err
+	}
+
+	if err := os.Remove(socketPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("unable to remove socket: %s", err)
+	}
+
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Chmod(socketPath, 0600); err != nil {
+		listener.Close() // nolint: errcheck
+		return fmt.Errorf("unable to set socket permissions: %s", err)
+	}
+
+	go func() {
+		<-ctx.Done()
+		listener.Close() // nolint: errcheck
+	}()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		go server.ServeConn(conn)
+	}
+}
+
+// AgentSigner is a crypto.Signer that requests the signatures to an agent
+// over a unix socket.
+type AgentSigner struct {
+	socketPath string
+	public     crypto.PublicKey
+	client     *rpc.Client
+
+	sync.Mutex
+}
+
+// NewAgentSigner connects to the agent listening at socketPath and retrieves
+// its public key.
+func NewAgentSigner(socketPath string) (*AgentSigner, error) {
+
+	a := &AgentSigner{
+		socketPath: socketPath,
+	}
+
+	resp := &AgentResponse{}
+	if err := a.call(agentPublicKeyCommand, AgentRequest{}, resp); err != nil {
+		return nil, fmt.Errorf("unable to retrieve public key from agent: %s", err)
+	}
+
+	pub, err := x509.ParsePKIXPublicKey(resp.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key from agent: %s", err)
+	}
+
+	a.public = pub
+
+	return a, nil
+}
+
+// Public implements the crypto.Signer interface.
+func (a *AgentSigner) Public() crypto.PublicKey {
+	return a.public
+}
+
+// Sign implements the crypto.Signer interface. The agent uses its own source
+// of randomness.
+func (a *AgentSigner) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+
+	resp := &AgentResponse{}
+	if err := a.call(agentSignCommand, AgentRequest{Digest: digest, Hash: opts.HashFunc()}, resp); err != nil {
+		return nil, err
+	}
+
+	if len(resp.Signature) == 0 {
+		return nil, errors.New("empty signature from agent")
+	}
+
+	return resp.Signature, nil
+}
+
+// Close closes the connection to the agent.
+func (a *AgentSigner) Close() error {
+
+	a.Lock()
+	defer a.Unlock()
+
+	if a.client == nil {
+		return nil
+	}
+
+	err := a.client.Close()
+	a.client = nil
+
+	return err
+}
+
+// call calls the agent. The connection is opened again on the next call if
+// it is broken, like when the agent restarts.
+func (a *AgentSigner) call(method string, req AgentRequest, resp *AgentResponse) error {
+
+	a.Lock()
+	defer a.Unlock()
+
+	if a.client == nil {
+		client, err := rpc.Dial("unix", a.socketPath)
+		if err != nil {
+			return fmt.Errorf("unable to connect to agent: %s", err)
+		}
+		a.client = client
+	}
+
+	err := a.client.Call(method, req, resp)
+	if err == nil {
+		return nil
+	}
+
+	if _, ok := err.(rpc.ServerError); !ok {
+		zap.L().Debug("Connection to signer agent lost", zap.String("socket", a.socketPath), zap.Error(err))
+		a.client.Close() // nolint: errcheck
+		a.client = nil
+	}
+
+	return err
+}
@@ -0,0 +1,59 @@
+// +build pkcs11
+
+package signer
+
+import (
+	"crypto"
+	"errors"
+	"fmt"
+
+	"github.com/ThalesIgnite/crypto11"
+)
+
+// PKCS11Signer is a crypto.Signer backed by a key of a PKCS#11 module.
+type PKCS11Signer struct {
+	crypto.Signer
+	ctx *crypto11.Context
+}
+
+// NewPKCS11Signer loads the module and finds the key of the configuration.
+func NewPKCS11Signer(cfg PKCS11Config) (*PKCS11Signer, error) {
+
+	if cfg.Path == "" {
+		return nil, errors.New("pkcs11 module path is required")
+	}
+
+	if len(cfg.KeyID) == 0 && len(cfg.KeyLabel) == 0 {
+		return nil, errors.New("pkcs11 key id or label is required")
+	}
+
+	ctx, err := crypto11.Configure(&crypto11.Config{
+		Path:       cfg.Path,
+		TokenLabel: cfg.TokenLabel,
+		Pin:        cfg.Pin,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to configure pkcs11 module: %s", err)
+	}
+
+	signer, err := ctx.FindKeyPair(cfg.KeyID, cfg.KeyLabel)
+	if err != nil {
+		ctx.Close() // nolint: errcheck
+		return nil, fmt.Errorf("unable to find pkcs11 key: %s", err)
+	}
+
+	if signer == nil {
+		ctx.Close() // nolint: errcheck
+		return nil, errors.New("pkcs11 key not found")
+	}
+
+	return &PKCS11Signer{
+		Signer: signer,
+		ctx:    ctx,
+	}, nil
+}
+
+// Close releases the module.
+func (p *PKCS11Signer) Close() error {
+	return p.ctx.Close()
+}
@@ -0,0 +1,24 @@
+// +build !pkcs11
+
+package signer
+
+import (
+	"crypto"
+	"errors"
+)
+
+// PKCS11Signer is a crypto.Signer backed by a key of a PKCS#11 module.
+type PKCS11Signer struct {
+	crypto.Signer
+}
+
+// NewPKCS11Signer returns an error as the PKCS#11 support requires the
+// pkcs11 build tag.
+func NewPKCS11Signer(cfg PKCS11Config) (*PKCS11Signer, error) {
+	return nil, errors.New("pkcs11 is not supported by this build")
+}
+
+// Close implements the io.Closer interface.
+func (p *PKCS11Signer) Close() error {
+	return nil
+}
@@ -0,0 +1,52 @@
+// +build pkcs11
+
+package signer
+
+import (
+	"crypto/ecdsa"
+	"os"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// TestPKCS11Signer requires a token with a P-256 key pair, like one created
+// with SoftHSM:
+//    softhsm2-util --init-token --free --label test --pin 1234 --so-pin 1234
+//    pkcs11-tool --module $PKCS11_MODULE --token-label test --login --pin 1234 \
+//        --keypairgen --key-type EC:prime256v1 --label enforcer
+func TestPKCS11Signer(t *testing.T) {
+
+	module := os.Getenv("PKCS11_MODULE")
+	if module == "" {
+		t.Skip("PKCS11_MODULE is not set")
+	}
+
+	Convey("Given a key pair of a PKCS#11 token", t, func() {
+
+		s, err := NewPKCS11Signer(PKCS11Config{
+			Path:       module,
+			TokenLabel: "test",
+			Pin:        "1234",
+			KeyLabel:   []byte("enforcer"),
+		})
+		So(err, ShouldBeNil)
+		defer s.Close() // nolint
+
+		Convey("The signatures should be verified with the public key", func() {
+			sig, err := Sign(s, []byte("token"))
+			So(err, ShouldBeNil)
+			So(verifyRaw(s.Public().(*ecdsa.PublicKey), []byte("token"), sig), ShouldBeTrue)
+		})
+
+		Convey("When the key does not exist, I should get an error", func() {
+			_, err := NewPKCS11Signer(PKCS11Config{
+				Path:       module,
+				TokenLabel: "test",
+				Pin:        "1234",
+				KeyLabel:   []byte("unknown"),
+			})
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
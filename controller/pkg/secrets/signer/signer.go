@@ -0,0 +1,186 @@
+package signer
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+// SigningMethodES256 is the ES256 signing method of the JWT with any
+// crypto.Signer holding a P-256 key as the signing key. The signatures are
+// the same as the ones of jwt.SigningMethodES256, which verifies them.
+var SigningMethodES256 jwt.SigningMethod = &signingMethodES256{}
+
+// SigningMethodEdDSA is the EdDSA signing method of the JWT with Ed25519
+// keys. The signing key is an ed25519.PrivateKey or any crypto.Signer
+// holding an Ed25519 key, and the verifying key is an ed25519.PublicKey.
+var SigningMethodEdDSA jwt.SigningMethod = &signingMethodEdDSA{}
+
+func init() {
+	jwt.RegisterSigningMethod(SigningMethodEdDSA.Alg(), func() jwt.SigningMethod {
+		return SigningMethodEdDSA
+	})
+}
+
+// PKCS11Config is the configuration of a key of a PKCS#11 module. The key is
+// found by its id, its label or both.
+type PKCS11Config struct {
+	// Path is the path of the module library.
+	Path string
+	// TokenLabel is the label of the token holding the key.
+	TokenLabel string
+	// Pin is the user pin of the token.
+	Pin string
+	// KeyID is the CKA_ID of the key.
+	KeyID []byte
+	// KeyLabel is the CKA_LABEL of the key.
+	KeyLabel []byte
+}
+
+// ecdsaSignature is the ASN.1 structure of the ECDSA signatures returned by
+// the signers.
+type ecdsaSignature struct {
+	R, S *big.Int
+}
+
+// Sign signs buf with the signer. The ECDSA signatures are computed on the
+// SHA256 hash of buf and are returned as the concatenation of r and s, each
+// padded to the size of the curve. The Ed25519 signatures are computed on buf.
+func Sign(signer crypto.Signer, buf []byte) ([]byte, error) {
+
+	switch pub := signer.Public().(type) {
+	case *ecdsa.PublicKey:
+		h := sha256.Sum256(buf)
+		der, err := signer.Sign(rand.Reader, h[:], crypto.SHA256)
+		if err != nil {
+			return nil, err
+		}
+		return rawSignature(der, pub)
+
+	case ed25519.PublicKey:
+		// Ed25519 hashes the message itself.
+		return signer.Sign(rand.Reader, buf, crypto.Hash(0))
+
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T", pub)
+	}
+}
+
+// rawSignature converts an ASN.1 ECDSA signature to the concatenation of r
+// and s, each padded to the size of the curve of the key.
+func rawSignature(der []byte, pub *ecdsa.PublicKey) ([]byte, error) {
+
+	sig := &ecdsaSignature{}
+	rest, err := asn1.Unmarshal(der, sig)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ecdsa signature: %s", err)
+	}
+
+	if len(rest) != 0 || sig.R == nil || sig.S == nil {
+		return nil, errors.New("invalid ecdsa signature")
+	}
+
+	keyBytes := (pub.Curve.Params().BitSize + 7) / 8
+
+	rBytes := sig.R.Bytes()
+	sBytes := sig.S.Bytes()
+	if len(rBytes) > keyBytes || len(sBytes) > keyBytes {
+		return nil, errors.New("invalid ecdsa signature size")
+	}
+
+	raw := make([]byte, 2*keyBytes)
+	copy(raw[keyBytes-len(rBytes):], rBytes)
+	copy(raw[2*keyBytes-len(sBytes):], sBytes)
+
+	return raw, nil
+}
+
+// signingMethodES256 implements the jwt.SigningMethod interface.
+type signingMethodES256 struct{}
+
+// Alg implements the jwt.SigningMethod interface.
+func (m *signingMethodES256) Alg() string {
+	return jwt.SigningMethodES256.Alg()
+}
+
+// Verify implements the jwt.SigningMethod interface.
+func (m *signingMethodES256) Verify(signingString, signature string, key interface{}) error {
+	return jwt.SigningMethodES256.Verify(signingString, signature, key)
+}
+
+// Sign implements the jwt.SigningMethod interface.
+func (m *signingMethodES256) Sign(signingString string, key interface{}) (string, error) {
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return "", jwt.ErrInvalidKeyType
+	}
+
+	pub, ok := signer.Public().(*ecdsa.PublicKey)
+	if !ok || pub.Curve.Params().BitSize != 256 {
+		return "", jwt.ErrInvalidKeyType
+	}
+
+	sig, err := Sign(signer, []byte(signingString))
+	if err != nil {
+		return "", err
+	}
+
+	return jwt.EncodeSegment(sig), nil
+}
+
+// signingMethodEdDSA implements the jwt.SigningMethod interface.
+type signingMethodEdDSA struct{}
+
+// Alg implements the jwt.SigningMethod interface.
+func (m *signingMethodEdDSA) Alg() string {
+	return "EdDSA"
+}
+
+// Verify implements the jwt.SigningMethod interface.
+func (m *signingMethodEdDSA) Verify(signingString, signature string, key interface{}) error {
+
+	pub, ok := key.(ed25519.PublicKey)
+	if !ok || len(pub) != ed25519.PublicKeySize {
+		return jwt.ErrInvalidKeyType
+	}
+
+	sig, err := jwt.DecodeSegment(signature)
+	if err != nil {
+		return err
+	}
+
+	if !ed25519.Verify(pub, []byte(signingString), sig) {
+		return jwt.ErrSignatureInvalid
+	}
+
+	return nil
+}
+
+// Sign implements the jwt.SigningMethod interface.
+func (m *signingMethodEdDSA) Sign(signingString string, key interface{}) (string, error) {
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return "", jwt.ErrInvalidKeyType
+	}
+
+	if _, ok := signer.Public().(ed25519.PublicKey); !ok {
+		return "", jwt.ErrInvalidKeyType
+	}
+
+	sig, err := Sign(signer, []byte(signingString))
+	if err != nil {
+		return "", err
+	}
+
+	return jwt.EncodeSegment(sig), nil
+}
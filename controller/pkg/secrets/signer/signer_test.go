@@ -0,0 +1,197 @@
+package signer
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func verifyRaw(pub *ecdsa.PublicKey, buf []byte, sig []byte) bool {
+	h := sha256.Sum256(buf)
+	r := big.NewInt(0).SetBytes(sig[:32])
+	s := big.NewInt(0).SetBytes(sig[32:])
+	return ecdsa.Verify(pub, h[:], r, s)
+}
+
+func TestSign(t *testing.T) {
+
+	Convey("Given a message", t, func() {
+
+		buf := []byte("token")
+
+		Convey("When I sign it with an ecdsa key, I should get a raw signature", func() {
+			key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+			So(err, ShouldBeNil)
+
+			sig, err := Sign(key, buf)
+			So(err, ShouldBeNil)
+			So(sig, ShouldHaveLength, 64)
+			So(verifyRaw(&key.PublicKey, buf, sig), ShouldBeTrue)
+			So(verifyRaw(&key.PublicKey, []byte("other"), sig), ShouldBeFalse)
+		})
+
+		Convey("When I sign it with an ed25519 key, I should get an ed25519 signature", func() {
+			pub, key, err := ed25519.GenerateKey(rand.Reader)
+			So(err, ShouldBeNil)
+
+			sig, err := Sign(key, buf)
+			So(err, ShouldBeNil)
+			So(ed25519.Verify(pub, buf, sig), ShouldBeTrue)
+		})
+
+		Convey("When I sign it with a rsa key, I should get an error", func() {
+			key, err := rsa.GenerateKey(rand.Reader, 1024)
+			So(err, ShouldBeNil)
+
+			_, err = Sign(key, buf)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestSigningMethodES256(t *testing.T) {
+
+	Convey("Given a signer holding a P-256 key", t, func() {
+
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		So(err, ShouldBeNil)
+
+		Convey("When I sign a JWT, it should be verified with the public key", func() {
+			token, err := jwt.NewWithClaims(SigningMethodES256, &jwt.StandardClaims{Subject: "test"}).SignedString(crypto.Signer(key))
+			So(err, ShouldBeNil)
+
+			claims := &jwt.StandardClaims{}
+			parsed, err := jwt.ParseWithClaims(token, claims, func(*jwt.Token) (interface{}, error) {
+				return &key.PublicKey, nil
+			})
+			So(err, ShouldBeNil)
+			So(parsed.Valid, ShouldBeTrue)
+			So(claims.Subject, ShouldEqual, "test")
+		})
+
+		Convey("When I sign a JWT with a key that is not a signer, I should get an error", func() {
+			_, err := jwt.NewWithClaims(SigningMethodES256, &jwt.StandardClaims{}).SignedString([]byte("secret"))
+			So(err, ShouldEqual, jwt.ErrInvalidKeyType)
+		})
+
+		Convey("When I sign a JWT with a P-384 key, I should get an error", func() {
+			key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+			So(err, ShouldBeNil)
+
+			_, err = jwt.NewWithClaims(SigningMethodES256, &jwt.StandardClaims{}).SignedString(key)
+			So(err, ShouldEqual, jwt.ErrInvalidKeyType)
+		})
+	})
+}
+
+func TestSigningMethodEdDSA(t *testing.T) {
+
+	Convey("Given a signer holding an ed25519 key", t, func() {
+
+		pub, key, err := ed25519.GenerateKey(rand.Reader)
+		So(err, ShouldBeNil)
+
+		Convey("When I sign a JWT, it should be verified with the public key", func() {
+			token, err := jwt.NewWithClaims(SigningMethodEdDSA, &jwt.StandardClaims{Subject: "test"}).SignedString(crypto.Signer(key))
+			So(err, ShouldBeNil)
+
+			claims := &jwt.StandardClaims{}
+			parsed, err := jwt.ParseWithClaims(token, claims, func(*jwt.Token) (interface{}, error) {
+				return pub, nil
+			})
+			So(err, ShouldBeNil)
+			So(parsed.Valid, ShouldBeTrue)
+			So(parsed.Method, ShouldEqual, SigningMethodEdDSA)
+			So(claims.Subject, ShouldEqual, "test")
+		})
+
+		Convey("When I verify a JWT with another key, I should get an error", func() {
+			token, err := jwt.NewWithClaims(SigningMethodEdDSA, &jwt.StandardClaims{}).SignedString(key)
+			So(err, ShouldBeNil)
+
+			other, _, err := ed25519.GenerateKey(rand.Reader)
+			So(err, ShouldBeNil)
+
+			_, err = jwt.Parse(token, func(*jwt.Token) (interface{}, error) {
+				return other, nil
+			})
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("When I sign a JWT with an ecdsa key, I should get an error", func() {
+			key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+			So(err, ShouldBeNil)
+
+			_, err = jwt.NewWithClaims(SigningMethodEdDSA, &jwt.StandardClaims{}).SignedString(key)
+			So(err, ShouldEqual, jwt.ErrInvalidKeyType)
+		})
+	})
+}
+
+func TestAgent(t *testing.T) {
+
+	Convey("Given an agent serving a key on a unix socket", t, func() {
+
+		dir, err := ioutil.TempDir("", "signer")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir) // nolint
+
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		So(err, ShouldBeNil)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		socketPath := filepath.Join(dir, "agent.sock")
+		errCh := make(chan error, 1)
+		go func() {
+			errCh <- NewAgent(key).Serve(ctx, socketPath)
+		}()
+
+		var s *AgentSigner
+		for i := 0; i < 100; i++ {
+			if s, err = NewAgentSigner(socketPath); err == nil {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		So(err, ShouldBeNil)
+		defer s.Close() // nolint
+
+		Convey("The signer should have the public key of the agent", func() {
+			pub, ok := s.Public().(*ecdsa.PublicKey)
+			So(ok, ShouldBeTrue)
+			So(pub.X.Cmp(key.PublicKey.X), ShouldEqual, 0)
+			So(pub.Y.Cmp(key.PublicKey.Y), ShouldEqual, 0)
+		})
+
+		Convey("The signatures of the signer should be verified with the public key", func() {
+			sig, err := Sign(s, []byte("token"))
+			So(err, ShouldBeNil)
+			So(verifyRaw(&key.PublicKey, []byte("token"), sig), ShouldBeTrue)
+		})
+
+		Convey("When the agent stops, I should get an error", func() {
+			cancel()
+			So(<-errCh, ShouldBeNil)
+
+			So(s.Close(), ShouldBeNil)
+			_, err := Sign(s, []byte("token"))
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
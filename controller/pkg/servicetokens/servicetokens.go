@@ -1,6 +1,7 @@
 package servicetokens
 
 import (
+	"crypto"
 	"crypto/ecdsa"
 	"crypto/x509"
 	"fmt"
@@ -10,6 +11,7 @@ import (
 	"github.com/bluele/gcache"
 	jwt "github.com/dgrijalva/jwt-go"
 	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/secrets"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/secrets/signer"
 	"go.aporeto.io/enforcerd/trireme-lib/policy"
 	"go.aporeto.io/enforcerd/trireme-lib/utils/cache"
 	"go.uber.org/zap"
@@ -115,9 +117,10 @@ func (p *Verifier) UpdateSecrets(s secrets.Secrets, globalCert *x509.Certificate
 	p.globalCert = globalCert
 }
 
-// CreateAndSign creates a new JWT token based on the Aporeto identities.
+// CreateAndSign creates a new JWT token based on the Aporeto identities. The
+// key can be any crypto.Signer holding a P-256 key.
 func CreateAndSign(server string, profile, scopes []string, id string, validity time.Duration, gkey interface{}, pingPayload *policy.PingPayload) (string, error) {
-	key, ok := gkey.(*ecdsa.PrivateKey)
+	key, ok := gkey.(crypto.Signer)
 	if !ok {
 		return "", fmt.Errorf("Not a valid private key format")
 	}
@@ -135,7 +138,7 @@ func CreateAndSign(server string, profile, scopes []string, id string, validity
 		PingPayload: pingPayload,
 	}
 
-	token, err := jwt.NewWithClaims(jwt.SigningMethodES256, claims).SignedString(key)
+	token, err := jwt.NewWithClaims(signer.SigningMethodES256, claims).SignedString(key)
 	if err != nil {
 		return "", err
 	}
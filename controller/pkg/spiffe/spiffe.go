@@ -0,0 +1,223 @@
+package spiffe
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+const (
+	// Scheme is the URI scheme of the SPIFFE IDs.
+	Scheme = "spiffe"
+
+	// IDClaim is the claim key of the SPIFFE ID of a peer.
+	IDClaim = "spiffeid"
+
+	// TrustDomainClaim is the claim key of the trust domain of a peer.
+	TrustDomainClaim = "spiffetrustdomain"
+)
+
+var (
+	// ErrNoID is returned when a certificate does not hold a SPIFFE ID.
+	ErrNoID = errors.New("no spiffe id found")
+)
+
+// ID is a SPIFFE ID as defined by the SPIFFE specification, that is
+// spiffe://<trust domain>/<path>.
+type ID struct {
+	TrustDomain string
+	Path        string
+}
+
+// NewID creates a SPIFFE ID in the trust domain with the path made of the
+// segments.
+func NewID(trustDomain string, segments ...string) (ID, error) {
+
+	path := ""
+	for _, s := range segments {
+		if s == "" || strings.Contains(s, "/") {
+			return ID{}, fmt.Errorf("invalid spiffe id path segment '%s'", s)
+		}
+		path = path + "/" + s
+	}
+
+	return ParseID(Scheme + "://" + trustDomain + path)
+}
+
+// ParseID parses and validates a SPIFFE ID.
+func ParseID(s string) (ID, error) {
+
+	u, err := url.Parse(s)
+	if err != nil {
+		return ID{}, fmt.Errorf("invalid spiffe id '%s': %s", s, err)
+	}
+
+	return idFromURL(u)
+}
+
+// idFromURL validates a SPIFFE ID parsed as an URL.
+func idFromURL(u *url.URL) (ID, error) {
+
+	switch {
+	case !strings.EqualFold(u.Scheme, Scheme):
+		return ID{}, fmt.Errorf("invalid spiffe id '%s': scheme must be %s", u.String(), Scheme)
+	case u.Host == "":
+		return ID{}, fmt.Errorf("invalid spiffe id '%s': missing trust domain", u.String())
+	case u.Port() != "" || u.User != nil:
+		return ID{}, fmt.Errorf("invalid spiffe id '%s': trust domain must not have a port or user info", u.String())
+	case u.RawQuery != "" || u.Fragment != "":
+		return ID{}, fmt.Errorf("invalid spiffe id '%s': query and fragment are not allowed", u.String())
+	case strings.HasSuffix(u.Path, "/") || strings.Contains(u.Path, "//"):
+		return ID{}, fmt.Errorf("invalid spiffe id '%s': empty path segment", u.String())
+	}
+
+	return ID{
+		TrustDomain: strings.ToLower(u.Host),
+		Path:        u.Path,
+	}, nil
+}
+
+// String returns the URI of the SPIFFE ID.
+func (id ID) String() string {
+
+	if id.IsZero() {
+		return ""
+	}
+
+	return Scheme + "://" + id.TrustDomain + id.Path
+}
+
+// IsZero returns true if the SPIFFE ID is empty.
+func (id ID) IsZero() bool {
+	return id.TrustDomain == ""
+}
+
+// Claims returns the claims of the SPIFFE ID that can be matched by the
+// claim matching rules of the API policies.
+func (id ID) Claims() []string {
+
+	if id.IsZero() {
+		return []string{}
+	}
+
+	return []string{
+		IDClaim + "=" + id.String(),
+		TrustDomainClaim + "=" + id.TrustDomain,
+	}
+}
+
+// IDFromCertificate returns the SPIFFE ID of an X.509-SVID. The SPIFFE ID is
+// the only URI SAN of the certificate with the spiffe scheme.
+func IDFromCertificate(cert *x509.Certificate) (ID, error) {
+
+	if cert == nil {
+		return ID{}, ErrNoID
+	}
+
+	var id ID
+	for _, u := range cert.URIs {
+		if !strings.EqualFold(u.Scheme, Scheme) {
+			continue
+		}
+		if !id.IsZero() {
+			return ID{}, fmt.Errorf("certificate %s has more than one spiffe id", cert.Subject.String())
+		}
+		parsed, err := idFromURL(u)
+		if err != nil {
+			return ID{}, err
+		}
+		id = parsed
+	}
+
+	if id.IsZero() {
+		return ID{}, ErrNoID
+	}
+
+	return id, nil
+}
+
+// IDFromCertificatePEM returns the SPIFFE ID of a PEM encoded X.509-SVID.
+// Only the first certificate of the PEM data is considered, the others are
+// the intermediates of the chain.
+func IDFromCertificatePEM(certPEM []byte) (ID, error) {
+
+	for {
+		var block *pem.Block
+		block, certPEM = pem.Decode(certPEM)
+		if block == nil {
+			return ID{}, ErrNoID
+		}
+
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return ID{}, fmt.Errorf("unable to parse certificate: %s", err)
+		}
+
+		return IDFromCertificate(cert)
+	}
+}
+
+// PeerID returns the SPIFFE ID of the peer of a TLS connection. Only the
+// certificates that have been verified are considered.
+func PeerID(state *tls.ConnectionState) (ID, error) {
+
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return ID{}, ErrNoID
+	}
+
+	return IDFromCertificate(state.VerifiedChains[0][0])
+}
+
+// Verify verifies that the certificate holds the expected SPIFFE ID. Any
+// certificate is accepted if the expected SPIFFE ID is empty.
+func Verify(cert *x509.Certificate, expected string) error {
+
+	if expected == "" {
+		return nil
+	}
+
+	want, err := ParseID(expected)
+	if err != nil {
+		return err
+	}
+
+	got, err := IDFromCertificate(cert)
+	if err != nil {
+		return err
+	}
+
+	if got != want {
+		return fmt.Errorf("certificate has spiffe id '%s' instead of '%s'", got.String(), want.String())
+	}
+
+	return nil
+}
+
+// VerifyTLSCertificate verifies that the leaf of the TLS certificate holds the
+// expected SPIFFE ID. Any certificate is accepted if the expected SPIFFE ID
+// is empty.
+func VerifyTLSCertificate(cert *tls.Certificate, expected string) error {
+
+	if expected == "" {
+		return nil
+	}
+
+	if cert == nil || len(cert.Certificate) == 0 {
+		return ErrNoID
+	}
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return fmt.Errorf("unable to parse certificate: %s", err)
+	}
+
+	return Verify(leaf, expected)
+}
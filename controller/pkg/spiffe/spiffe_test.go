@@ -0,0 +1,167 @@
+package spiffe
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/url"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func createCertificate(t *testing.T, uris ...string) (*x509.Certificate, []byte) {
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "workload"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	for _, s := range uris {
+		u, err := url.Parse(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		template.URIs = append(template.URIs, u)
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func TestParseID(t *testing.T) {
+
+	Convey("Given SPIFFE IDs", t, func() {
+
+		Convey("A valid ID should be parsed", func() {
+			id, err := ParseID("spiffe://Example.org/ns/default/sa/web")
+			So(err, ShouldBeNil)
+			So(id.TrustDomain, ShouldEqual, "example.org")
+			So(id.Path, ShouldEqual, "/ns/default/sa/web")
+			So(id.String(), ShouldEqual, "spiffe://example.org/ns/default/sa/web")
+			So(id.Claims(), ShouldResemble, []string{
+				"spiffeid=spiffe://example.org/ns/default/sa/web",
+				"spiffetrustdomain=example.org",
+			})
+		})
+
+		Convey("An ID of a trust domain should be parsed", func() {
+			id, err := ParseID("spiffe://example.org")
+			So(err, ShouldBeNil)
+			So(id.Path, ShouldEqual, "")
+		})
+
+		Convey("Invalid IDs should be rejected", func() {
+			for _, s := range []string{
+				"",
+				"https://example.org/web",
+				"spiffe:///web",
+				"spiffe://example.org:8080/web",
+				"spiffe://user@example.org/web",
+				"spiffe://example.org/web?a=b",
+				"spiffe://example.org/web#a",
+				"spiffe://example.org/web/",
+				"spiffe://example.org//web",
+			} {
+				_, err := ParseID(s)
+				So(err, ShouldNotBeNil)
+			}
+		})
+
+		Convey("An ID should be created from segments", func() {
+			id, err := NewID("example.org", "ns", "default")
+			So(err, ShouldBeNil)
+			So(id.String(), ShouldEqual, "spiffe://example.org/ns/default")
+
+			_, err = NewID("example.org", "ns/default")
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("An empty ID should have no claims", func() {
+			So(ID{}.IsZero(), ShouldBeTrue)
+			So(ID{}.String(), ShouldEqual, "")
+			So(ID{}.Claims(), ShouldBeEmpty)
+		})
+	})
+}
+
+func TestIDFromCertificate(t *testing.T) {
+
+	Convey("Given certificates", t, func() {
+
+		Convey("The SPIFFE ID of an SVID should be returned", func() {
+			cert, certPEM := createCertificate(t, "https://example.org", "spiffe://example.org/web")
+
+			id, err := IDFromCertificate(cert)
+			So(err, ShouldBeNil)
+			So(id.String(), ShouldEqual, "spiffe://example.org/web")
+
+			id, err = IDFromCertificatePEM(certPEM)
+			So(err, ShouldBeNil)
+			So(id.String(), ShouldEqual, "spiffe://example.org/web")
+
+			So(Verify(cert, "spiffe://example.org/web"), ShouldBeNil)
+			So(Verify(cert, "spiffe://example.org/db"), ShouldNotBeNil)
+			So(Verify(cert, ""), ShouldBeNil)
+
+			tlsCert := &tls.Certificate{Certificate: [][]byte{cert.Raw}}
+			So(VerifyTLSCertificate(tlsCert, "spiffe://example.org/web"), ShouldBeNil)
+			So(VerifyTLSCertificate(tlsCert, "spiffe://example.org/db"), ShouldNotBeNil)
+			So(VerifyTLSCertificate(&tls.Certificate{}, "spiffe://example.org/web"), ShouldEqual, ErrNoID)
+		})
+
+		Convey("A certificate without SPIFFE ID should be rejected", func() {
+			cert, certPEM := createCertificate(t)
+
+			_, err := IDFromCertificate(cert)
+			So(err, ShouldEqual, ErrNoID)
+
+			_, err = IDFromCertificatePEM(certPEM)
+			So(err, ShouldEqual, ErrNoID)
+
+			So(Verify(cert, "spiffe://example.org/web"), ShouldEqual, ErrNoID)
+		})
+
+		Convey("A certificate with two SPIFFE IDs should be rejected", func() {
+			cert, _ := createCertificate(t, "spiffe://example.org/web", "spiffe://example.org/db")
+
+			_, err := IDFromCertificate(cert)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("The SPIFFE ID of a verified peer should be returned", func() {
+			cert, _ := createCertificate(t, "spiffe://example.org/web")
+
+			id, err := PeerID(&tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}})
+			So(err, ShouldBeNil)
+			So(id.String(), ShouldEqual, "spiffe://example.org/web")
+
+			_, err = PeerID(&tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}})
+			So(err, ShouldEqual, ErrNoID)
+
+			_, err = PeerID(nil)
+			So(err, ShouldEqual, ErrNoID)
+		})
+	})
+}
@@ -1,7 +1,9 @@
 package tokens
 
 import (
+	"crypto"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/elliptic"
 	"crypto/rand"
 	"encoding/binary"
@@ -16,8 +18,10 @@ import (
 	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/claimsheader"
 	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/pkiverifier"
 	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/secrets"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/secrets/signer"
 	"go.aporeto.io/enforcerd/trireme-lib/utils/cache"
 	localcrypto "go.aporeto.io/enforcerd/trireme-lib/utils/crypto"
+	"golang.org/x/crypto/curve25519"
 )
 
 // To generate the codecs,
@@ -142,6 +146,13 @@ func (c *BinaryJWTConfig) DecodeSyn(isSynAck bool, data []byte, privateKey *ephe
 		return nil, nil, nil, nil, false, err
 	}
 
+	// Process the version 2 protocol. Only peers that have advertised
+	// it send version 2 tokens.
+	if claimsHeader.DatapathVersion() == claimsheader.DatapathVersion2 {
+		secretKey, controller, err := c.processV2Protocol(isSynAck, token, privateKey, secrets, connClaims, binaryClaims, sig)
+		return secretKey, claimsHeader, nonce, controller, false, err
+	}
+
 	//Process 314 Protocol
 	if len(binaryClaims.DEK) == 0 {
 		secretKey, controller, err := c.process314Protocol(isSynAck, token, secrets, connClaims, binaryClaims, sig)
@@ -196,7 +207,8 @@ func (c *BinaryJWTConfig) DecodeAck(proto314 bool, secretKey []byte, data []byte
 func (c *BinaryJWTConfig) CreateSynToken(claims *ConnectionClaims, encodedBuf []byte, nonce []byte, header *claimsheader.ClaimsHeader, secrets secrets.Secrets) ([]byte, error) {
 	// Set the appropriate claims header
 	header.SetCompressionType(claimsheader.CompressionTypeV1)
-	header.SetDatapathVersion(claimsheader.DatapathVersion1)
+	header.SetDatapathVersion(datapathVersion(claims))
+	header.SetMaxDatapathVersion(claimsheader.DatapathVersion2)
 
 	// Combine the application claims with the standard claims.
 	// In all cases for Syn/SynAck packets we also transmit our
@@ -214,7 +226,7 @@ func (c *BinaryJWTConfig) CreateSynToken(claims *ConnectionClaims, encodedBuf []
 
 	encodedBuf = append(encodedBuf, AckPattern...)
 
-	sig, err = c.sign(encodedBuf, secrets.EncodingKey().(*ecdsa.PrivateKey))
+	sig, err = c.sign(encodedBuf, secrets.EncodingKey())
 
 	if err != nil {
 		return nil, err
@@ -229,7 +241,8 @@ func (c *BinaryJWTConfig) CreateSynAckToken(proto314 bool, claims *ConnectionCla
 
 	// Set the appropriate claims header
 	header.SetCompressionType(claimsheader.CompressionTypeV1)
-	header.SetDatapathVersion(claimsheader.DatapathVersion1)
+	header.SetDatapathVersion(datapathVersion(claims))
+	header.SetMaxDatapathVersion(claimsheader.DatapathVersion2)
 
 	// Combine the application claims with the standard claims.
 	// In all cases for Syn/SynAck packets we also transmit our
@@ -317,19 +330,40 @@ func (c *BinaryJWTConfig) verifyClaimsHeader(h *claimsheader.ClaimsHeader) error
 
 	}
 
-	if h.DatapathVersion() != claimsheader.DatapathVersion1 {
+	if h.DatapathVersion() != claimsheader.DatapathVersion1 && h.DatapathVersion() != claimsheader.DatapathVersion2 {
 		return ErrDatapathVersionMismatch
 	}
 
 	return nil
 }
 
-// Sign takes in a slice of bytes and a private key, and returns a ecdsa signature.
-func (c *BinaryJWTConfig) Sign(buf []byte, key *ecdsa.PrivateKey) ([]byte, error) {
+// Sign takes in a slice of bytes and a private key, and returns a ecdsa or
+// an ed25519 signature depending on the key. The key can also be any
+// crypto.Signer, like a key held by an agent or a PKCS#11 module.
+func (c *BinaryJWTConfig) Sign(buf []byte, key interface{}) ([]byte, error) {
 	return c.sign(buf, key)
 }
 
-func (c *BinaryJWTConfig) sign(buf []byte, key *ecdsa.PrivateKey) ([]byte, error) {
+func (c *BinaryJWTConfig) sign(buf []byte, key interface{}) ([]byte, error) {
+
+	switch k := key.(type) {
+	case *ecdsa.PrivateKey:
+		return c.signECDSA(buf, k)
+	case ed25519.PrivateKey:
+		// Ed25519 hashes the message itself.
+		return ed25519.Sign(k, buf), nil
+	case crypto.Signer:
+		sig, err := signer.Sign(k, buf)
+		if err != nil {
+			return nil, logError(ErrTokenSignFailed, err.Error())
+		}
+		return sig, nil
+	default:
+		return nil, logError(ErrTokenSignFailed, fmt.Sprintf("unsupported key type %T", key))
+	}
+}
+
+func (c *BinaryJWTConfig) signECDSA(buf []byte, key *ecdsa.PrivateKey) ([]byte, error) {
 
 	// Create the hash and use this for the signature. This is a SHA256 hash
 	// of the token.
@@ -365,7 +399,22 @@ func (c *BinaryJWTConfig) sign(buf []byte, key *ecdsa.PrivateKey) ([]byte, error
 	return tokenBytes, nil
 }
 
-func (c *BinaryJWTConfig) verify(buf []byte, sig []byte, key *ecdsa.PublicKey) error {
+func (c *BinaryJWTConfig) verify(buf []byte, sig []byte, key interface{}) error {
+
+	switch k := key.(type) {
+	case *ecdsa.PublicKey:
+		return c.verifyECDSA(buf, sig, k)
+	case ed25519.PublicKey:
+		if len(sig) != ed25519.SignatureSize || !ed25519.Verify(k, buf, sig) {
+			return ErrInvalidSignature
+		}
+		return nil
+	default:
+		return ErrInvalidSignature
+	}
+}
+
+func (c *BinaryJWTConfig) verifyECDSA(buf []byte, sig []byte, key *ecdsa.PublicKey) error {
 
 	if len(sig) != 64 {
 		return ErrInvalidSignature
@@ -422,6 +471,24 @@ func (c *BinaryJWTConfig) getSecretKey(privateKey *ephemeralkeys.PrivateKey, rem
 	return secretKey, nil
 }
 
+func (c *BinaryJWTConfig) getSecretKeyX25519(privateKey *ephemeralkeys.PrivateKey, remotePublicKeyString string) ([]byte, error) {
+
+	hashKey := string(privateKey.X25519) + remotePublicKeyString
+
+	if secretKey := c.sharedKeys.Get(hashKey); secretKey != nil {
+		return secretKey, nil
+	}
+
+	secretKey, err := symmetricKeyX25519(privateKey.X25519, []byte(remotePublicKeyString))
+	if err != nil {
+		return nil, err
+	}
+
+	c.sharedKeys.Put(hashKey, secretKey)
+
+	return secretKey, nil
+}
+
 func encode(c *BinaryJWTClaims, buf *[]byte) error {
 	// Encode and sign the token
 	if cap(*buf) != ClaimsEncodedBufSize {
@@ -483,6 +550,19 @@ func packToken(header, nonce, token, sig []byte) []byte {
 	return data
 }
 
+// SignedData returns the claims of a syn or syn/ack token that are covered by
+// its signature. Unlike the nonce, which is inserted in the token after it is
+// signed, they can not be changed without invalidating the token.
+func SignedData(data []byte) ([]byte, error) {
+
+	_, _, token, _, err := unpackToken(false, data)
+	if err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
 // unpackToken returns nonce, token, signature or error if something fails
 func unpackToken(isAck bool, data []byte) ([]byte, []byte, []byte, []byte, error) {
 
@@ -525,9 +605,45 @@ func symmetricKey(privateKey *ecdsa.PrivateKey, remotePublic *ecdsa.PublicKey) (
 	return hash500(x.Bytes(), nil)
 }
 
-func uncompressTags(binaryClaims *BinaryJWTClaims, publicKeyClaims []string) {
+// symmetricKeyX25519 returns a symmetric key for encryption derived with X25519.
+// It fails for low order public keys.
+func symmetricKeyX25519(privateKey []byte, remotePublic []byte) ([]byte, error) {
+
+	if len(remotePublic) != curve25519.PointSize {
+		return nil, ErrInvalidSecret
+	}
+
+	x, err := curve25519.X25519(privateKey, remotePublic)
+	if err != nil {
+		return nil, logError(ErrInvalidSecret, err.Error())
+	}
+
+	return hash500(x, nil)
+}
+
+// datapathVersion returns the datapath version of a token with the claims.
+// Only version 2 tokens carry the X25519 ephemeral key.
+func datapathVersion(claims *ConnectionClaims) claimsheader.DatapathVersion {
+
+	if len(claims.DEKV3) != 0 {
+		return claimsheader.DatapathVersion2
+	}
+
+	return claimsheader.DatapathVersion1
+}
+
+// uncompressTags sets the tags of the claims from the tags carried by the token
+// and the claims of its public key. The tags carried by the tokens of a
+// federated trust domain are rewritten with the policy of the domain, like the
+// claims of its public keys.
+func uncompressTags(binaryClaims *BinaryJWTClaims, publicKeyClaims []string, controller *pkiverifier.PKIControllerInfo) {
+
+	tags := binaryClaims.CT
+	if controller != nil && controller.Federation != nil {
+		tags = controller.Federation.Rewrite(tags)
+	}
 
-	binaryClaims.T = append(binaryClaims.CT, enforcerconstants.TransmitterLabel+"="+binaryClaims.ID)
+	binaryClaims.T = append(tags, enforcerconstants.TransmitterLabel+"="+binaryClaims.ID)
 
 	for _, pc := range publicKeyClaims {
 
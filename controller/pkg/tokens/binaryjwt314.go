@@ -13,8 +13,17 @@ import (
 
 func (c *BinaryJWTConfig) getSharedKey314(pub interface{}, priv interface{}) ([]byte, error) {
 
-	publicKey := pub.(*ecdsa.PublicKey)
-	privateKey := priv.(*ecdsa.PrivateKey)
+	publicKey, ok := pub.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, logError(ErrSharedKeyHashFailed, fmt.Sprintf("unsupported public key type %T", pub))
+	}
+
+	// The shared key of the 314 protocol requires the private key itself, it
+	// can not be derived with a crypto.Signer.
+	privateKey, ok := priv.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, logError(ErrSharedKeyHashFailed, fmt.Sprintf("unsupported private key type %T", priv))
+	}
 
 	hashKey := string(localcrypto.EncodePublicKeyV2(publicKey)) + string(localcrypto.EncodePrivateKey(privateKey))
 
@@ -63,7 +72,7 @@ func (c *BinaryJWTConfig) process314Protocol(isSynAck bool, token []byte, secret
 	var secretKey []byte
 	publicKey, publicKeyClaims, _, controller, err := secrets.KeyAndClaims(binaryClaims.SignerKey)
 	if err != nil || publicKey == nil {
-		return nil, nil, ErrPublicKeyFailed
+		return nil, nil, publicKeyError(err)
 	}
 
 	// Since we know that the signature is valid, we check if the token is already in
@@ -83,7 +92,7 @@ func (c *BinaryJWTConfig) process314Protocol(isSynAck bool, token []byte, secret
 
 	// Uncommpress the tags and add the public key claims to the tags that
 	// we return.
-	uncompressTags(binaryClaims, publicKeyClaims)
+	uncompressTags(binaryClaims, publicKeyClaims, controller)
 	CopyToConnectionClaims(binaryClaims, connClaims)
 
 	if isSynAck {
@@ -102,7 +111,7 @@ func (c *BinaryJWTConfig) process314Protocol(isSynAck bool, token []byte, secret
 		// provided and validated public key. We will then add it in the
 		// cache for future reference.
 
-		if err := c.verify(token, sig, publicKey.(*ecdsa.PublicKey)); err != nil {
+		if err := c.verify(token, sig, publicKey); err != nil {
 			return nil, nil, err
 		}
 
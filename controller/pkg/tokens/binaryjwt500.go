@@ -3,7 +3,6 @@ package tokens
 import (
 	"bytes"
 	"crypto"
-	"crypto/ecdsa"
 	"fmt"
 
 	"go.aporeto.io/enforcerd/trireme-lib/controller/internal/enforcer/utils/ephemeralkeys"
@@ -16,7 +15,7 @@ func (c *BinaryJWTConfig) process500Protocol(isSynAck bool, token []byte, privat
 
 	publicKey, publicKeyClaims, _, controller, err := secrets.KeyAndClaims(binaryClaims.SignerKey)
 	if err != nil || publicKey == nil {
-		return nil, nil, ErrPublicKeyFailed
+		return nil, nil, publicKeyError(err)
 	}
 
 	var remotePublicKeyString, remotePublicKeySig string
@@ -46,7 +45,7 @@ func (c *BinaryJWTConfig) process500Protocol(isSynAck bool, token []byte, privat
 
 	// Uncommpress the tags and add the public key claims to the tags that
 	// we return.
-	uncompressTags(binaryClaims, publicKeyClaims)
+	uncompressTags(binaryClaims, publicKeyClaims, controller)
 	CopyToConnectionClaims(binaryClaims, connClaims)
 
 	if len(connClaims.DEKV2) == 0 {
@@ -72,7 +71,7 @@ func (c *BinaryJWTConfig) process500Protocol(isSynAck bool, token []byte, privat
 
 		// We don't need to verify the ephemeral key if we have done it already.
 		if _, cerr := c.tokenCache.Get(remotePublicKeyString); cerr != nil {
-			if err := c.verify([]byte(remotePublicKeyString), []byte(remotePublicKeySig), publicKey.(*ecdsa.PublicKey)); err != nil {
+			if err := c.verify([]byte(remotePublicKeyString), []byte(remotePublicKeySig), publicKey); err != nil {
 				zap.L().Error("Ephemeral key can not be verified", zap.Error(err))
 				return nil, nil, err
 			}
@@ -84,7 +83,7 @@ func (c *BinaryJWTConfig) process500Protocol(isSynAck bool, token []byte, privat
 		// provided and validated public key. We will then add it in the
 		// cache for future reference.
 
-		if err := c.verify(token, sig, publicKey.(*ecdsa.PublicKey)); err != nil {
+		if err := c.verify(token, sig, publicKey); err != nil {
 			return nil, nil, err
 		}
 	}
@@ -5,6 +5,7 @@ package tokens
 import (
 	"bytes"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/elliptic"
 	"crypto/rand"
 	"encoding/gob"
@@ -14,11 +15,15 @@ import (
 	"testing"
 	"time"
 
+	"github.com/golang/mock/gomock"
 	enforcerconstants "go.aporeto.io/enforcerd/trireme-lib/controller/internal/enforcer/constants"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/internal/enforcer/lookup"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/internal/enforcer/utils/ephemeralkeys"
 	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/claimsheader"
 	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/pkiverifier"
 	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/secrets"
 	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/secrets/compactpki"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/secrets/mocksecrets"
 	"go.aporeto.io/enforcerd/trireme-lib/utils/crypto"
 	"gotest.tools/assert"
 
@@ -401,3 +406,364 @@ func Test_EncDecClaims(t *testing.T) {
 
 	assert.Equal(t, eq, true, "decoded claims should be equal to original claims which was encoded")
 }
+
+func createMockSecrets(ctrl *gomock.Controller, privateKey, publicKey interface{}) secrets.Secrets {
+
+	scrts := mocksecrets.NewMockSecrets(ctrl)
+	scrts.EXPECT().EncodingKey().Return(privateKey).AnyTimes()
+	scrts.EXPECT().TransmittedKey().Return([]byte("transmittedkey")).AnyTimes()
+	scrts.EXPECT().KeyAndClaims(gomock.Any()).Return(publicKey, []string{}, time.Now(), nil, nil).AnyTimes()
+
+	return scrts
+}
+
+func Test_DatapathVersion2(t *testing.T) {
+	Convey("Given two JWT engines with ed25519 secrets and X25519 ephemeral keys", t, func() {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+		So(err, ShouldBeNil)
+		scrts := createMockSecrets(ctrl, privateKey, publicKey)
+
+		client, err := NewBinaryJWT(bvalidity, "client")
+		So(err, ShouldBeNil)
+		server, err := NewBinaryJWT(bvalidity, "server")
+		So(err, ShouldBeNil)
+
+		clientKeys, err := ephemeralkeys.New()
+		So(err, ShouldBeNil)
+		serverKeys, err := ephemeralkeys.New()
+		So(err, ShouldBeNil)
+
+		synClaims := &ConnectionClaims{
+			ID:    "5c5baa93d5f54a3019bede4e",
+			LCL:   []byte(lcl),
+			DEKV3: clientKeys.DecodingKeyX25519(),
+			CT:    createCompressedTagArray(),
+		}
+
+		var encodedBuf [ClaimsEncodedBufSize]byte
+		synHeader := claimsheader.NewClaimsHeader()
+		synToken, err := client.CreateSynToken(synClaims, encodedBuf[:], []byte(rmt), synHeader, scrts)
+		So(err, ShouldBeNil)
+
+		Convey("Then the syn token should advertise and use version 2", func() {
+			So(synHeader.DatapathVersion(), ShouldEqual, claimsheader.DatapathVersion2)
+			So(synHeader.MaxDatapathVersion(), ShouldEqual, claimsheader.DatapathVersion2)
+		})
+
+		Convey("Then the signed data of the syn token should not depend on its nonce", func() {
+			signed, err := SignedData(synToken)
+			So(err, ShouldBeNil)
+			signed = append([]byte{}, signed...)
+
+			So(client.Randomize(synToken, []byte("fedcba9876543210")), ShouldBeNil)
+			randomized, err := SignedData(synToken)
+			So(err, ShouldBeNil)
+			So(randomized, ShouldResemble, signed)
+
+			_, err = SignedData(synToken[:4])
+			So(err, ShouldEqual, ErrInvalidTokenLength)
+		})
+
+		Convey("When the server decodes the syn token", func() {
+			serverClaims := &ConnectionClaims{}
+			serverSecret, header, nonce, _, proto314, err := server.DecodeSyn(false, synToken, serverKeys.PrivateKey(), scrts, serverClaims)
+			So(err, ShouldBeNil)
+			So(proto314, ShouldBeFalse)
+			So(header.DatapathVersion(), ShouldEqual, claimsheader.DatapathVersion2)
+			So(nonce, ShouldResemble, []byte(rmt))
+			So(serverClaims.DEKV3, ShouldResemble, clientKeys.DecodingKeyX25519())
+			So(serverClaims.DEKV1, ShouldBeNil)
+
+			sdek, err := server.Sign(serverKeys.DecodingKeyX25519(), privateKey)
+			So(err, ShouldBeNil)
+
+			synAckClaims := &ConnectionClaims{
+				ID:     "5c5baa93d5f54a3019bede4f",
+				LCL:    []byte(rmt),
+				RMT:    []byte(lcl),
+				DEKV3:  serverKeys.DecodingKeyX25519(),
+				SDEKV3: sdek,
+				CT:     createCompressedTagArray(),
+			}
+
+			var synAckBuf [ClaimsEncodedBufSize]byte
+			synAckToken, err := server.CreateSynAckToken(false, synAckClaims, synAckBuf[:], []byte(rmt), claimsheader.NewClaimsHeader(), scrts, serverSecret)
+			So(err, ShouldBeNil)
+
+			Convey("Then the client should derive the same secret from the syn/ack token", func() {
+				clientClaims := &ConnectionClaims{}
+				clientSecret, header, _, _, _, err := client.DecodeSyn(true, synAckToken, clientKeys.PrivateKey(), scrts, clientClaims)
+				So(err, ShouldBeNil)
+				So(header.DatapathVersion(), ShouldEqual, claimsheader.DatapathVersion2)
+				So(clientSecret, ShouldResemble, serverSecret)
+			})
+
+			Convey("Then the client should reject an ephemeral key with a bad signature", func() {
+				synAckClaims.SDEKV3 = append([]byte{}, sdek...)
+				synAckClaims.SDEKV3[0] ^= 0xFF
+
+				var badBuf [ClaimsEncodedBufSize]byte
+				badToken, err := server.CreateSynAckToken(false, synAckClaims, badBuf[:], []byte(rmt), claimsheader.NewClaimsHeader(), scrts, serverSecret)
+				So(err, ShouldBeNil)
+
+				_, _, _, _, _, err = client.DecodeSyn(true, badToken, clientKeys.PrivateKey(), scrts, &ConnectionClaims{})
+				So(err, ShouldEqual, ErrInvalidSignature)
+			})
+		})
+
+		Convey("When the syn token is tampered with", func() {
+			synToken[len(synToken)-1] ^= 0xFF
+
+			Convey("Then the server should reject it", func() {
+				_, _, _, _, _, err := server.DecodeSyn(false, synToken, serverKeys.PrivateKey(), scrts, &ConnectionClaims{})
+				So(err, ShouldEqual, ErrInvalidSignature)
+			})
+		})
+	})
+
+	Convey("Given a JWT engine with ecdsa secrets and a version 1 syn token", t, func() {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		So(err, ShouldBeNil)
+		scrts := createMockSecrets(ctrl, privateKey, &privateKey.PublicKey)
+
+		engine, err := NewBinaryJWT(bvalidity, "engine")
+		So(err, ShouldBeNil)
+
+		clientKeys, err := ephemeralkeys.New()
+		So(err, ShouldBeNil)
+		serverKeys, err := ephemeralkeys.New()
+		So(err, ShouldBeNil)
+
+		synClaims := &ConnectionClaims{
+			ID:    "5c5baa93d5f54a3019bede4e",
+			LCL:   []byte(lcl),
+			DEKV1: clientKeys.DecodingKeyV1(),
+			DEKV2: clientKeys.DecodingKeyV2(),
+			CT:    createCompressedTagArray(),
+		}
+
+		var encodedBuf [ClaimsEncodedBufSize]byte
+		synHeader := claimsheader.NewClaimsHeader()
+		synToken, err := engine.CreateSynToken(synClaims, encodedBuf[:], []byte(rmt), synHeader, scrts)
+		So(err, ShouldBeNil)
+
+		Convey("Then the token should use version 1 and advertise version 2", func() {
+			So(synHeader.DatapathVersion(), ShouldEqual, claimsheader.DatapathVersion1)
+			So(synHeader.MaxDatapathVersion(), ShouldEqual, claimsheader.DatapathVersion2)
+
+			serverClaims := &ConnectionClaims{}
+			secret, header, _, _, proto314, err := engine.DecodeSyn(false, synToken, serverKeys.PrivateKey(), scrts, serverClaims)
+			So(err, ShouldBeNil)
+			So(secret, ShouldNotBeNil)
+			So(proto314, ShouldBeFalse)
+			So(header.DatapathVersion(), ShouldEqual, claimsheader.DatapathVersion1)
+			So(header.MaxDatapathVersion(), ShouldEqual, claimsheader.DatapathVersion2)
+			So(serverClaims.DEKV2, ShouldResemble, clientKeys.DecodingKeyV2())
+		})
+	})
+}
+
+func BenchmarkSign(b *testing.B) {
+
+	buf := make([]byte, 512)
+	rand.Read(buf) // nolint
+
+	ecdsaKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	_, ed25519Key, _ := ed25519.GenerateKey(rand.Reader)
+
+	c, _ := NewBinaryJWT(bvalidity, "bench")
+
+	b.Run("ECDSA-P256", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := c.sign(buf, ecdsaKey); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("Ed25519", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := c.sign(buf, ed25519Key); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkVerify(b *testing.B) {
+
+	buf := make([]byte, 512)
+	rand.Read(buf) // nolint
+
+	ecdsaKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ed25519Public, ed25519Key, _ := ed25519.GenerateKey(rand.Reader)
+
+	c, _ := NewBinaryJWT(bvalidity, "bench")
+	ecdsaSig, _ := c.sign(buf, ecdsaKey)
+	ed25519Sig, _ := c.sign(buf, ed25519Key)
+
+	b.Run("ECDSA-P256", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if err := c.verify(buf, ecdsaSig, &ecdsaKey.PublicKey); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("Ed25519", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if err := c.verify(buf, ed25519Sig, ed25519Public); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkSharedKey(b *testing.B) {
+
+	local, _ := ephemeralkeys.New()
+	remote, _ := ephemeralkeys.New()
+
+	b.Run("ECDH-P256", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			remotePublicKey, err := crypto.DecodePublicKeyV2(remote.DecodingKeyV2())
+			if err != nil {
+				b.Fatal(err)
+			}
+			if _, err := symmetricKey(local.PrivateKey().PrivateKey, remotePublicKey); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("X25519", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := symmetricKeyX25519(local.PrivateKey().X25519, remote.DecodingKeyX25519()); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkSynTokenSize(b *testing.B) {
+
+	ecdsaKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	_, ed25519Key, _ := ed25519.GenerateKey(rand.Reader)
+	keys, _ := ephemeralkeys.New()
+
+	ctrl := gomock.NewController(b)
+	defer ctrl.Finish()
+
+	c, _ := NewBinaryJWT(bvalidity, "bench")
+
+	run := func(b *testing.B, claims *ConnectionClaims, scrts secrets.Secrets) {
+		var size int
+		for i := 0; i < b.N; i++ {
+			var encodedBuf [ClaimsEncodedBufSize]byte
+			token, err := c.CreateSynToken(claims, encodedBuf[:], []byte(lcl), claimsheader.NewClaimsHeader(), scrts)
+			if err != nil {
+				b.Fatal(err)
+			}
+			size = len(token)
+		}
+		b.ReportMetric(float64(size), "bytes/token")
+	}
+
+	b.Run("Version1", func(b *testing.B) {
+		run(b, &ConnectionClaims{
+			LCL:   []byte(lcl),
+			DEKV1: keys.DecodingKeyV1(),
+			DEKV2: keys.DecodingKeyV2(),
+			CT:    createCompressedTagArray(),
+		}, createMockSecrets(ctrl, ecdsaKey, &ecdsaKey.PublicKey))
+	})
+
+	b.Run("Version2", func(b *testing.B) {
+		run(b, &ConnectionClaims{
+			LCL:   []byte(lcl),
+			DEKV3: keys.DecodingKeyX25519(),
+			CT:    createCompressedTagArray(),
+		}, createMockSecrets(ctrl, ed25519Key, ed25519Key.Public()))
+	})
+}
+
+func Test_FederatedTags(t *testing.T) {
+	Convey("Given a syn token signed by a federated trust domain", t, func() {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+		So(err, ShouldBeNil)
+
+		federation := &pkiverifier.PKIFederation{
+			TrustDomain:     "cluster-b",
+			NamespacePrefix: "/cluster-b",
+			TagRewrites:     map[string]string{"env": "remote:env"},
+		}
+
+		scrts := mocksecrets.NewMockSecrets(ctrl)
+		scrts.EXPECT().EncodingKey().Return(privateKey).AnyTimes()
+		scrts.EXPECT().TransmittedKey().Return([]byte("transmittedkey")).AnyTimes()
+		scrts.EXPECT().KeyAndClaims(gomock.Any()).Return(publicKey, []string{}, time.Now(), &pkiverifier.PKIControllerInfo{
+			Namespace:  "/cluster-b",
+			Controller: "cluster-b",
+			Federation: federation,
+		}, nil).AnyTimes()
+
+		jwtConfig, err := NewBinaryJWT(bvalidity, "engine")
+		So(err, ShouldBeNil)
+
+		keys, err := ephemeralkeys.New()
+		So(err, ShouldBeNil)
+
+		claims := &ConnectionClaims{
+			ID:    "5c5baa93d5f54a3019bede4e",
+			LCL:   []byte(lcl),
+			DEKV3: keys.DecodingKeyX25519(),
+			CT:    policy.NewTagStoreFromSlice([]string{"$namespace=/apps", "app=web", "env=prod"}),
+		}
+
+		var encodedBuf [ClaimsEncodedBufSize]byte
+		token, err := jwtConfig.CreateSynToken(claims, encodedBuf[:], []byte(rmt), claimsheader.NewClaimsHeader(), scrts)
+		So(err, ShouldBeNil)
+
+		Convey("Then the tags carried by the token should be rewritten", func() {
+			decoded := &ConnectionClaims{}
+			_, _, _, controller, _, err := jwtConfig.DecodeSyn(false, token, keys.PrivateKey(), scrts, decoded)
+			So(err, ShouldBeNil)
+			So(controller.Controller, ShouldEqual, "cluster-b")
+			So(decoded.T.GetSlice(), ShouldResemble, []string{
+				"$namespace=/cluster-b/apps",
+				"remote:env=prod",
+				enforcerconstants.TransmitterLabel + "=5c5baa93d5f54a3019bede4e",
+			})
+
+			Convey("Then a local-looking tag should not match a local policy", func() {
+				db := lookup.NewPolicyDB()
+				db.AddPolicy(policy.TagSelector{
+					Clause: []policy.KeyValueOperator{{Key: "app", Value: []string{"web"}, Operator: policy.Equal}},
+				})
+				index, _ := db.Search(decoded.T)
+				So(index, ShouldEqual, -1)
+
+				db.AddPolicy(policy.TagSelector{
+					Clause: []policy.KeyValueOperator{{Key: "$namespace", Value: []string{"/apps"}, Operator: policy.Equal}},
+				})
+				index, _ = db.Search(decoded.T)
+				So(index, ShouldEqual, -1)
+
+				db.AddPolicy(policy.TagSelector{
+					Clause: []policy.KeyValueOperator{{Key: "remote:env", Value: []string{"prod"}, Operator: policy.Equal}},
+				})
+				index, _ = db.Search(decoded.T)
+				So(index, ShouldEqual, 3)
+			})
+		})
+	})
+}
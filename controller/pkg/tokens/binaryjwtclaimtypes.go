@@ -91,6 +91,14 @@ func ConvertToBinaryClaims(j *ConnectionClaims, validity time.Duration) *BinaryJ
 		ExpiresAt: time.Now().Add(validity).Unix(),
 		P:         j.P,
 	}
+
+	// Version 2 tokens only carry the X25519 ephemeral key.
+	if len(j.DEKV3) != 0 {
+		b.DEK = j.DEKV3
+		b.SDEK = j.SDEKV3
+		b.DEKV2 = nil
+		b.SDEKV2 = nil
+	}
 	if j.T != nil {
 		b.T = j.T.GetSlice()
 	}
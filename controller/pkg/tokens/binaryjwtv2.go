@@ -0,0 +1,77 @@
+package tokens
+
+import (
+	"go.aporeto.io/enforcerd/trireme-lib/controller/internal/enforcer/utils/ephemeralkeys"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/pkiverifier"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/secrets"
+	"go.uber.org/zap"
+)
+
+// processV2Protocol processes the tokens of the datapath version 2. They carry a
+// single X25519 ephemeral key in the DEK claim and the shared key is derived
+// with X25519. Tokens and ephemeral keys are signed with the key of the
+// secrets, which is an ed25519 key when the secrets provide one.
+func (c *BinaryJWTConfig) processV2Protocol(isSynAck bool, token []byte, privateKey *ephemeralkeys.PrivateKey, secrets secrets.Secrets, connClaims *ConnectionClaims, binaryClaims *BinaryJWTClaims, sig []byte) ([]byte, *pkiverifier.PKIControllerInfo, error) {
+
+	if privateKey == nil || len(privateKey.X25519) == 0 {
+		return nil, nil, ErrSharedSecretMissing
+	}
+
+	publicKey, publicKeyClaims, _, controller, err := secrets.KeyAndClaims(binaryClaims.SignerKey)
+	if err != nil || publicKey == nil {
+		return nil, nil, publicKeyError(err)
+	}
+
+	// The syn token is cached once it has been verified.
+	if !isSynAck {
+		if cachedClaims, cerr := c.tokenCache.Get(string(token)); cerr == nil {
+			*connClaims = *cachedClaims.(*ConnectionClaims)
+
+			secretKey, err := c.getSecretKeyX25519(privateKey, string(connClaims.DEKV3))
+			if err != nil {
+				return nil, nil, err
+			}
+			return secretKey, controller, nil
+		}
+	}
+
+	uncompressTags(binaryClaims, publicKeyClaims, controller)
+	CopyToConnectionClaims(binaryClaims, connClaims)
+
+	// The DEK claim of a version 2 token is the X25519 key.
+	connClaims.DEKV3, connClaims.SDEKV3 = connClaims.DEKV1, connClaims.SDEKV1
+	connClaims.DEKV1, connClaims.SDEKV1 = nil, nil
+
+	remotePublicKeyString := string(connClaims.DEKV3)
+
+	if isSynAck {
+		binaryClaims.RMT = nil
+
+		// We don't need to verify the ephemeral key if we have done it already.
+		if _, cerr := c.tokenCache.Get(remotePublicKeyString); cerr != nil {
+			if err := c.verify(connClaims.DEKV3, connClaims.SDEKV3, publicKey); err != nil {
+				zap.L().Error("Ephemeral key can not be verified", zap.Error(err))
+				return nil, nil, err
+			}
+
+			c.tokenCache.AddOrUpdate(remotePublicKeyString, "")
+		}
+	} else {
+		if err := c.verify(token, sig, publicKey); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	secretKey, err := c.getSecretKeyX25519(privateKey, remotePublicKeyString)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !isSynAck {
+		connClaimsCopy := new(ConnectionClaims)
+		*connClaimsCopy = *connClaims
+		c.tokenCache.AddOrUpdate(string(token), connClaimsCopy)
+	}
+
+	return secretKey, controller, nil
+}
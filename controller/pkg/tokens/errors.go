@@ -3,6 +3,8 @@ package tokens
 import (
 	"errors"
 	"fmt"
+
+	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/secrets/revocation"
 )
 
 // Custom errors used by this package.
@@ -23,8 +25,24 @@ var (
 	ErrSignatureMismatch       = errors.New("signature mismatch")
 	ErrSharedKeyHashFailed     = errors.New("unable to hash shared key")
 	ErrPublicKeyFailed         = errors.New("unable to verify public key")
+	ErrPublicKeyRevoked        = errors.New("public key revoked")
+	ErrRevocationUnknown       = errors.New("public key revocation status unknown")
 )
 
+// publicKeyError returns the error of a public key that can not be verified.
+// The revocation errors are kept apart so that they are reported as such.
+func publicKeyError(err error) error {
+
+	switch {
+	case errors.Is(err, revocation.ErrRevoked):
+		return ErrPublicKeyRevoked
+	case errors.Is(err, revocation.ErrUnknown):
+		return ErrRevocationUnknown
+	default:
+		return ErrPublicKeyFailed
+	}
+}
+
 // logError is a convinience function which logs the err:msg and returns the error.
 func logError(err error, msg string) error {
 
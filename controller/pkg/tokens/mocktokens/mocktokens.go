@@ -113,7 +113,7 @@ func (mr *MockTokenEngineMockRecorder) Randomize(arg0, arg1 interface{}) *gomock
 
 // Sign mocks base method
 // nolint
-func (m *MockTokenEngine) Sign(arg0 []byte, arg1 *ecdsa.PrivateKey) ([]byte, error) {
+func (m *MockTokenEngine) Sign(arg0 []byte, arg1 interface{}) ([]byte, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "Sign", arg0, arg1)
 	ret0, _ := ret[0].([]byte)
@@ -1,8 +1,6 @@
 package tokens
 
 import (
-	"crypto/ecdsa"
-
 	"go.aporeto.io/enforcerd/trireme-lib/controller/internal/enforcer/utils/ephemeralkeys"
 	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/claimsheader"
 	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/pkiverifier"
@@ -35,6 +33,10 @@ type ConnectionClaims struct {
 	DEKV2 []byte `json:",omitempty"`
 	// SDEKV2 is the signature of the ephemeral key
 	SDEKV2 []byte `json:",omitempty"`
+	// DEKV3 is the datapath X25519 ephemeral key used to derive shared keys during a version 2 handshake
+	DEKV3 []byte `json:",omitempty"`
+	// SDEKV3 is the signature of the X25519 ephemeral key
+	SDEKV3 []byte `json:",omitempty"`
 }
 
 // TokenEngine is the interface to the different implementations of tokens
@@ -52,7 +54,7 @@ type TokenEngine interface {
 	// even when the token is cached. There should be space in the token already.
 	// Returns an error if there is no space
 	Randomize([]byte, []byte) (err error)
-	Sign([]byte, *ecdsa.PrivateKey) ([]byte, error)
+	Sign([]byte, interface{}) ([]byte, error)
 }
 
 const (
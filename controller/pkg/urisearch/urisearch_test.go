@@ -375,3 +375,35 @@ func TestFindAndMachScope(t *testing.T) {
 		})
 	})
 }
+
+func TestGRPCMethods(t *testing.T) {
+	Convey("Given an API cache with gRPC methods", t, func() {
+		c := NewAPICache([]*policy.HTTPRule{
+			{
+				Methods:            []string{"POST"},
+				URIs:               []string{"/helloworld.Greeter/SayHello"},
+				ClaimMatchingRules: [][]string{{"policy1"}},
+			},
+			{
+				Methods:            []string{"POST"},
+				URIs:               []string{"/routeguide.RouteGuide/*"},
+				ClaimMatchingRules: [][]string{{"policy2"}},
+			},
+		}, "id", false)
+
+		Convey("When I search for a gRPC method, I should get its rule", func() {
+			found, rule := c.FindRule("POST", "/helloworld.Greeter/SayHello")
+			So(found, ShouldBeTrue)
+			So(rule.ClaimMatchingRules, ShouldContain, []string{"policy1"})
+
+			found, _ = c.FindRule("POST", "/helloworld.Greeter/SayGoodbye")
+			So(found, ShouldBeFalse)
+		})
+
+		Convey("When I search for a method of a gRPC service, I should get the rule of the service", func() {
+			found, rule := c.FindRule("POST", "/routeguide.RouteGuide/RouteChat")
+			So(found, ShouldBeTrue)
+			So(rule.ClaimMatchingRules, ShouldContain, []string{"policy2"})
+		})
+	})
+}
@@ -20,6 +20,9 @@ const (
 	LinuxHost
 	K8s
 	Windows
+	Containerd
+	Podman
+	Systemd
 )
 
 // MonitorConfig specifies the configs for monitors.
@@ -27,6 +30,9 @@ type MonitorConfig struct {
 	Common    *ProcessorConfig
 	MergeTags []string
 	Monitors  map[Type]interface{}
+
+	// Err is the error of an option that cannot be applied to the monitors.
+	Err error
 }
 
 // String returns the configuration in string
@@ -8,6 +8,19 @@ const (
 	// DefaultDockerSocketType is unix
 	DefaultDockerSocketType = "unix"
 
+	// DefaultContainerdSocket is the default socket to use to communicate with containerd
+	DefaultContainerdSocket = "/run/containerd/containerd.sock"
+
+	// DefaultContainerdNamespace is the default containerd namespace that is monitored
+	DefaultContainerdNamespace = "default"
+
+	// ContainerdKubernetesNamespace is the containerd namespace used by the CRI plugin.
+	// The containers in this namespace are handled by the Kubernetes monitors.
+	ContainerdKubernetesNamespace = "k8s.io"
+
+	// DefaultPodmanSocket is the default socket of the rootful podman service
+	DefaultPodmanSocket = "/run/podman/podman.sock"
+
 	// K8sPodName is pod name of K8s pod.
 	K8sPodName = "io.kubernetes.pod.name"
 
@@ -21,6 +34,11 @@ const (
 	// DockerLinkedMode is the string of the network mode that indicates shared network namespace
 	DockerLinkedMode = "container:"
 
+	// PodmanHostMode is the string of the podman network mode that indicates a host namespace
+	PodmanHostMode = "host"
+	// PodmanLinkedMode is the prefix of the podman network mode that indicates a shared network namespace
+	PodmanLinkedMode = "container:"
+
 	// DockerHostPUID represents the PUID of the host network container.
 	DockerHostPUID = "HostPUID"
 
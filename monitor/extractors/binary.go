@@ -0,0 +1,403 @@
+package extractors
+
+import (
+	"bufio"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"go.aporeto.io/enforcerd/trireme-lib/common"
+	"go.aporeto.io/enforcerd/trireme-lib/policy"
+	"go.uber.org/zap"
+)
+
+// The results of the verification of a binary.
+const (
+	// BinaryTrustedHash is set when the digest of the binary is in the allowlist.
+	BinaryTrustedHash = "trusted-hash"
+	// BinarySignature is set when the detached signature of the binary is valid.
+	BinarySignature = "signature"
+	// BinaryFailed is set when the binary could not be verified.
+	BinaryFailed = "failed"
+)
+
+// DefaultSignatureSuffix is the suffix of the detached signature of a binary.
+const DefaultSignatureSuffix = ".sig"
+
+// libraryPaths are the directories where the libraries of a binary are
+// searched when the process is not running anymore.
+var libraryPaths = []string{
+	"/lib",
+	"/lib64",
+	"/usr/lib",
+	"/usr/lib64",
+	"/lib/x86_64-linux-gnu",
+	"/usr/lib/x86_64-linux-gnu",
+	"/lib/aarch64-linux-gnu",
+	"/usr/lib/aarch64-linux-gnu",
+	"/usr/local/lib",
+}
+
+// procRoot is the root of the proc filesystem.
+var procRoot = "/proc"
+
+// ComputeFileSha256 computes the SHA-256 of a file
+func ComputeFileSha256(filePath string) ([]byte, error) {
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close() // nolint: errcheck
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return nil, err
+	}
+
+	return hash.Sum(nil), nil
+}
+
+// BinaryVerifierConfig is the configuration of the verification of the binaries.
+// A binary is verified if its SHA-256 is one of the trusted hashes, or if it has
+// a detached signature of its SHA-256 made by one of the public keys. The binaries
+// are not verified if there is no trusted hash and no public key.
+type BinaryVerifierConfig struct {
+	// TrustedHashes are the hex encoded SHA-256 of the trusted binaries.
+	TrustedHashes []string
+
+	// PublicKeys are the ECDSA, RSA or Ed25519 keys of the signatures.
+	PublicKeys []crypto.PublicKey
+
+	// SignatureSuffix is appended to the path of a binary to find its detached
+	// signature. The signature is raw or base64 encoded. It defaults to .sig.
+	SignatureSuffix string
+
+	// VerifyLibraries requires the libraries of the binary to be verified too.
+	VerifyLibraries bool
+}
+
+// BinaryVerification is the identity of a binary.
+type BinaryVerification struct {
+	// Executable is the path of the binary.
+	Executable string
+
+	// Digest is the hex encoded SHA-256 of the binary.
+	Digest string
+
+	// Libraries maps the libraries of the binary to their hex encoded SHA-256.
+	Libraries map[string]string
+
+	// Result is the result of the verification. It is empty if the binaries
+	// are not verified.
+	Result string
+}
+
+// Failed returns true if the verification failed.
+func (b *BinaryVerification) Failed() bool {
+	return b.Result == BinaryFailed
+}
+
+// Tags returns the identity tags of the binary.
+func (b *BinaryVerification) Tags() []string {
+
+	tags := []string{}
+
+	if b.Digest != "" {
+		tags = append(tags, fmt.Sprintf("@app:%s:filechecksum:sha256=%s", OSHostString, b.Digest))
+	}
+
+	for lib, digest := range b.Libraries {
+		tags = append(tags, fmt.Sprintf("@app:%s:lib:%s:sha256=%s", OSHostString, lib, digest))
+	}
+
+	if b.Result != "" {
+		tags = append(tags,
+			fmt.Sprintf("@app:%s:verification=%s", OSHostString, b.Result),
+			fmt.Sprintf("@app:%s:verified=%t", OSHostString, !b.Failed()),
+		)
+	}
+
+	return tags
+}
+
+// BinaryVerifier computes the identity of the binaries of the processes and
+// verifies them.
+type BinaryVerifier struct {
+	trusted map[string]struct{}
+	keys    []crypto.PublicKey
+	suffix  string
+	libs    bool
+}
+
+// NewBinaryVerifier returns a verifier for the given configuration.
+func NewBinaryVerifier(cfg BinaryVerifierConfig) (*BinaryVerifier, error) {
+
+	v := &BinaryVerifier{
+		trusted: map[string]struct{}{},
+		suffix:  cfg.SignatureSuffix,
+		libs:    cfg.VerifyLibraries,
+	}
+
+	if v.suffix == "" {
+		v.suffix = DefaultSignatureSuffix
+	}
+
+	for _, h := range cfg.TrustedHashes {
+		digest, err := hex.DecodeString(strings.TrimSpace(h))
+		if err != nil || len(digest) != sha256.Size {
+			return nil, fmt.Errorf("invalid trusted hash %s: expected a hex encoded sha256", h)
+		}
+		v.trusted[hex.EncodeToString(digest)] = struct{}{}
+	}
+
+	for _, key := range cfg.PublicKeys {
+		switch key.(type) {
+		case *ecdsa.PublicKey, *rsa.PublicKey, ed25519.PublicKey:
+		default:
+			return nil, fmt.Errorf("unsupported public key type %T", key)
+		}
+		v.keys = append(v.keys, key)
+	}
+
+	return v, nil
+}
+
+// Verify computes the identity of a binary and of the libraries of the process.
+// The pid can be 0. When it is not, the binary that the process runs is read
+// from /proc/<pid>/exe, because the file at the path can be replaced after the
+// process started. The path is only read if the process is gone, and it is
+// always used to find the detached signature.
+func (v *BinaryVerifier) Verify(executable string, pid int32) (*BinaryVerification, error) {
+
+	var digest []byte
+	var err error
+
+	file := executable
+	if pid > 0 {
+		file = filepath.Join(procRoot, strconv.Itoa(int(pid)), "exe")
+		if digest, err = ComputeFileSha256(file); err != nil {
+			file = executable
+		}
+	}
+
+	if file == executable {
+		if digest, err = ComputeFileSha256(executable); err != nil {
+			return nil, fmt.Errorf("unable to compute the digest of %s: %s", executable, err)
+		}
+	}
+
+	b := &BinaryVerification{
+		Executable: executable,
+		Digest:     hex.EncodeToString(digest),
+		Libraries:  map[string]string{},
+	}
+
+	verify := len(v.trusted) > 0 || len(v.keys) > 0
+	if verify {
+		b.Result = v.verify(executable, digest)
+	}
+
+	for lib, path := range libraryFiles(file, pid) {
+		libDigest, err := ComputeFileSha256(path)
+		if err != nil {
+			if verify && v.libs {
+				b.Result = BinaryFailed
+			}
+			continue
+		}
+		b.Libraries[lib] = hex.EncodeToString(libDigest)
+
+		if verify && v.libs && v.verify(path, libDigest) == BinaryFailed {
+			b.Result = BinaryFailed
+		}
+	}
+
+	return b, nil
+}
+
+// EventMetadataExtractor wraps the extractor of the process PUs. The identity
+// tags of the binary are added to the runtime, and the PU is quarantined if the
+// verification of its binary failed.
+func (v *BinaryVerifier) EventMetadataExtractor(fallback EventMetadataExtractor) EventMetadataExtractor {
+
+	return func(event *common.EventInfo) (*policy.PURuntime, error) {
+
+		runtime, err := fallback(event)
+		if err != nil {
+			return nil, err
+		}
+
+		executable := event.Executable
+		if executable == "" && event.PID > 0 {
+			executable, _ = os.Readlink(filepath.Join(procRoot, strconv.Itoa(int(event.PID)), "exe"))
+		}
+		if executable == "" {
+			return runtime, nil
+		}
+
+		b, err := v.Verify(executable, event.PID)
+		if err != nil {
+			zap.L().Warn("Unable to verify binary", zap.String("puID", event.PUID), zap.Error(err))
+			if len(v.trusted) == 0 && len(v.keys) == 0 {
+				return runtime, nil
+			}
+			b = &BinaryVerification{Executable: executable, Result: BinaryFailed}
+		}
+
+		tags := runtime.Tags()
+		tags.MergeSlice(b.Tags())
+		runtime.SetTags(tags)
+
+		if b.Failed() {
+			zap.L().Warn("Binary verification failed, the PU is quarantined",
+				zap.String("puID", event.PUID),
+				zap.String("executable", executable),
+			)
+			options := runtime.Options()
+			options.Quarantined = true
+			runtime.SetOptions(options)
+		}
+
+		return runtime, nil
+	}
+}
+
+// verify returns the result of the verification of a file.
+func (v *BinaryVerifier) verify(path string, digest []byte) string {
+
+	if _, ok := v.trusted[hex.EncodeToString(digest)]; ok {
+		return BinaryTrustedHash
+	}
+
+	if len(v.keys) == 0 {
+		return BinaryFailed
+	}
+
+	signature, err := readSignature(path + v.suffix)
+	if err != nil {
+		return BinaryFailed
+	}
+
+	for _, key := range v.keys {
+		if verifySignature(key, digest, signature) == nil {
+			return BinarySignature
+		}
+	}
+
+	return BinaryFailed
+}
+
+// readSignature reads a raw or base64 encoded detached signature.
+func readSignature(path string) ([]byte, error) {
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data))); err == nil {
+		return decoded, nil
+	}
+
+	return data, nil
+}
+
+// verifySignature verifies the signature of a SHA-256 digest.
+func verifySignature(key crypto.PublicKey, digest, signature []byte) error {
+
+	switch k := key.(type) {
+	case *ecdsa.PublicKey:
+		var sig struct {
+			R, S *big.Int
+		}
+		if rest, err := asn1.Unmarshal(signature, &sig); err != nil || len(rest) != 0 || sig.R == nil || sig.S == nil {
+			return errors.New("invalid ecdsa signature")
+		}
+		if !ecdsa.Verify(k, digest, sig.R, sig.S) {
+			return errors.New("invalid ecdsa signature")
+		}
+		return nil
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(k, crypto.SHA256, digest, signature)
+	case ed25519.PublicKey:
+		if !ed25519.Verify(k, digest, signature) {
+			return errors.New("invalid ed25519 signature")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported public key type %T", key)
+	}
+}
+
+// libraryFiles returns the files of the libraries of a binary. The libraries
+// loaded by the process are used first, and the others are searched in the
+// library paths.
+func libraryFiles(executable string, pid int32) map[string]string {
+
+	files := map[string]string{}
+
+	libs := Libs(executable)
+	if len(libs) == 0 {
+		return files
+	}
+
+	loaded := map[string]string{}
+	if pid > 0 {
+		loaded = mappedFiles(pid)
+	}
+
+	for _, lib := range libs {
+		if path, ok := loaded[lib]; ok {
+			files[lib] = path
+			continue
+		}
+		for _, dir := range libraryPaths {
+			path := filepath.Join(dir, lib)
+			if _, err := os.Stat(path); err == nil {
+				files[lib] = path
+				break
+			}
+		}
+	}
+
+	return files
+}
+
+// mappedFiles returns the files mapped by a process, by base name.
+func mappedFiles(pid int32) map[string]string {
+
+	files := map[string]string{}
+
+	f, err := os.Open(filepath.Join(procRoot, strconv.Itoa(int(pid)), "maps"))
+	if err != nil {
+		return files
+	}
+	defer f.Close() // nolint: errcheck
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 6 || !strings.HasPrefix(fields[5], "/") {
+			continue
+		}
+		path := strings.Join(fields[5:], " ")
+		files[filepath.Base(path)] = path
+	}
+
+	return files
+}
@@ -0,0 +1,168 @@
+// +build linux
+
+package extractors
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"go.aporeto.io/enforcerd/trireme-lib/common"
+	"go.aporeto.io/enforcerd/trireme-lib/policy"
+)
+
+const curlSha256 = "cf846b7f3f11fc8af6cf79a2bbad3c8314eec72c1425b49bc9e34cf85a5090bb"
+
+func TestComputeFileSha256(t *testing.T) {
+
+	Convey("When I calculate the SHA-256 of a bad file", t, func() {
+		_, err := ComputeFileSha256("testdata/nofile")
+		Convey("I should get an error", func() {
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("When I calculate the SHA-256 of a good file", t, func() {
+		hash, err := ComputeFileSha256("testdata/curl")
+		Convey("I should get no error and the right value", func() {
+			So(err, ShouldBeNil)
+			So(hex.EncodeToString(hash), ShouldEqual, curlSha256)
+		})
+	})
+}
+
+func TestNewBinaryVerifier(t *testing.T) {
+
+	Convey("When I create a verifier with an invalid trusted hash", t, func() {
+		_, err := NewBinaryVerifier(BinaryVerifierConfig{TrustedHashes: []string{"abcd"}})
+		Convey("I should get an error", func() {
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("When I create a verifier with an unsupported key", t, func() {
+		_, err := NewBinaryVerifier(BinaryVerifierConfig{PublicKeys: []crypto.PublicKey{"key"}})
+		Convey("I should get an error", func() {
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestBinaryVerifier(t *testing.T) {
+
+	Convey("Given a signed binary", t, func() {
+		dir, err := ioutil.TempDir("", "binary")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir) // nolint: errcheck
+
+		data, err := ioutil.ReadFile("testdata/curl")
+		So(err, ShouldBeNil)
+		binary := filepath.Join(dir, "curl")
+		So(ioutil.WriteFile(binary, data, 0755), ShouldBeNil)
+
+		public, private, err := ed25519.GenerateKey(rand.Reader)
+		So(err, ShouldBeNil)
+		digest, _ := hex.DecodeString(curlSha256)
+		signature := base64.StdEncoding.EncodeToString(ed25519.Sign(private, digest))
+		So(ioutil.WriteFile(binary+DefaultSignatureSuffix, []byte(signature), 0644), ShouldBeNil)
+
+		Convey("Without trusted hashes and keys, only the digest should be computed", func() {
+			v, err := NewBinaryVerifier(BinaryVerifierConfig{})
+			So(err, ShouldBeNil)
+
+			b, err := v.Verify(binary, 0)
+			So(err, ShouldBeNil)
+			So(b.Digest, ShouldEqual, curlSha256)
+			So(b.Result, ShouldBeEmpty)
+			So(b.Tags(), ShouldContain, "@app:linux:filechecksum:sha256="+curlSha256)
+			So(b.Tags(), ShouldNotContain, "@app:linux:verified=false")
+		})
+
+		Convey("A trusted hash should verify the binary", func() {
+			v, err := NewBinaryVerifier(BinaryVerifierConfig{TrustedHashes: []string{curlSha256}})
+			So(err, ShouldBeNil)
+
+			b, err := v.Verify(binary, 0)
+			So(err, ShouldBeNil)
+			So(b.Result, ShouldEqual, BinaryTrustedHash)
+			So(b.Tags(), ShouldContain, "@app:linux:verified=true")
+		})
+
+		Convey("A valid signature should verify the binary", func() {
+			v, err := NewBinaryVerifier(BinaryVerifierConfig{PublicKeys: []crypto.PublicKey{public}})
+			So(err, ShouldBeNil)
+
+			b, err := v.Verify(binary, 0)
+			So(err, ShouldBeNil)
+			So(b.Result, ShouldEqual, BinarySignature)
+			So(b.Tags(), ShouldContain, "@app:linux:verification=signature")
+		})
+
+		Convey("A signature of another key should fail and quarantine the PU", func() {
+			other, _, err := ed25519.GenerateKey(rand.Reader)
+			So(err, ShouldBeNil)
+			v, err := NewBinaryVerifier(BinaryVerifierConfig{PublicKeys: []crypto.PublicKey{other}})
+			So(err, ShouldBeNil)
+
+			b, err := v.Verify(binary, 0)
+			So(err, ShouldBeNil)
+			So(b.Result, ShouldEqual, BinaryFailed)
+
+			extractor := v.EventMetadataExtractor(func(event *common.EventInfo) (*policy.PURuntime, error) {
+				return policy.NewPURuntime(event.Name, 0, "", nil, nil, common.LinuxProcessPU, policy.None, nil), nil
+			})
+			runtime, err := extractor(&common.EventInfo{Name: "curl", Executable: binary})
+			So(err, ShouldBeNil)
+			So(runtime.Options().Quarantined, ShouldBeTrue)
+			verified, _ := runtime.Tag("@app:linux:verified")
+			So(verified, ShouldEqual, "false")
+		})
+
+		Convey("The binary of a running process should be read from proc", func() {
+			root := procRoot
+			defer func() { procRoot = root }()
+			procRoot = filepath.Join(dir, "proc")
+			So(os.MkdirAll(filepath.Join(procRoot, "42"), 0755), ShouldBeNil)
+			So(os.Symlink(binary, filepath.Join(procRoot, "42", "exe")), ShouldBeNil)
+
+			replaced := filepath.Join(dir, "replaced")
+			So(ioutil.WriteFile(replaced, []byte("replaced"), 0755), ShouldBeNil)
+			So(ioutil.WriteFile(replaced+DefaultSignatureSuffix, []byte(signature), 0644), ShouldBeNil)
+
+			v, err := NewBinaryVerifier(BinaryVerifierConfig{PublicKeys: []crypto.PublicKey{public}})
+			So(err, ShouldBeNil)
+
+			b, err := v.Verify(replaced, 42)
+			So(err, ShouldBeNil)
+			So(b.Executable, ShouldEqual, replaced)
+			So(b.Digest, ShouldEqual, curlSha256)
+			So(b.Result, ShouldEqual, BinarySignature)
+
+			Convey("And the path should be read when the process is gone", func() {
+				b, err := v.Verify(replaced, 43)
+				So(err, ShouldBeNil)
+				So(b.Digest, ShouldNotEqual, curlSha256)
+				So(b.Result, ShouldEqual, BinaryFailed)
+			})
+		})
+
+		Convey("A missing binary should quarantine the PU when the binaries are verified", func() {
+			v, err := NewBinaryVerifier(BinaryVerifierConfig{TrustedHashes: []string{curlSha256}})
+			So(err, ShouldBeNil)
+
+			extractor := v.EventMetadataExtractor(func(event *common.EventInfo) (*policy.PURuntime, error) {
+				return policy.NewPURuntime(event.Name, 0, "", nil, nil, common.LinuxProcessPU, policy.None, nil), nil
+			})
+			runtime, err := extractor(&common.EventInfo{Name: "curl", Executable: filepath.Join(dir, "missing")})
+			So(err, ShouldBeNil)
+			So(runtime.Options().Quarantined, ShouldBeTrue)
+		})
+	})
+}
@@ -0,0 +1,120 @@
+package extractors
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go.aporeto.io/enforcerd/trireme-lib/common"
+	"go.aporeto.io/enforcerd/trireme-lib/monitor/constants"
+	"go.aporeto.io/enforcerd/trireme-lib/policy"
+	"go.aporeto.io/enforcerd/trireme-lib/utils/cgnetcls"
+)
+
+// ContainerdInfo is the information about a containerd container that is
+// passed to the containerd metadata extractors. It is built from the
+// container record and its OCI runtime spec.
+type ContainerdInfo struct {
+	// ID is the containerd container ID.
+	ID string `json:"id"`
+
+	// Namespace is the containerd namespace of the container.
+	Namespace string `json:"namespace"`
+
+	// Image is the image reference of the container.
+	Image string `json:"image,omitempty"`
+
+	// Labels are the containerd labels of the container.
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Annotations are the annotations of the OCI runtime spec.
+	Annotations map[string]string `json:"annotations,omitempty"`
+
+	// Pid is the pid of the task of the container. It is 0 if there is no running task.
+	Pid int `json:"pid,omitempty"`
+
+	// NetNSPath is the network namespace path set in the OCI runtime spec, if any.
+	NetNSPath string `json:"netnspath,omitempty"`
+
+	// HostNetwork is true if the container shares the network namespace of the host.
+	HostNetwork bool `json:"hostnetwork,omitempty"`
+}
+
+// A ContainerdMetadataExtractor is a function used to extract a *policy.PURuntime from a given
+// containerd container.
+type ContainerdMetadataExtractor func(*ContainerdInfo) (*policy.PURuntime, error)
+
+// DefaultContainerdMetadataExtractor is the default metadata extractor for containerd.
+// Container labels and OCI annotations are both added as user tags. A label takes
+// precedence over an annotation with the same key.
+func DefaultContainerdMetadataExtractor(info *ContainerdInfo) (*policy.PURuntime, error) {
+
+	if info == nil {
+		return nil, fmt.Errorf("empty containerd info")
+	}
+
+	tags := policy.NewTagStore()
+	tags.AppendKeyValue("@app:image", info.Image)
+	tags.AppendKeyValue("@app:extractor", "containerd")
+	tags.AppendKeyValue("@app:containerd:name", info.ID)
+	tags.AppendKeyValue("@app:containerd:namespace", info.Namespace)
+
+	for k, v := range info.Annotations {
+		if _, ok := info.Labels[k]; ok {
+			continue
+		}
+		appendUserTag(tags, k, v)
+	}
+
+	for k, v := range info.Labels {
+		appendUserTag(tags, k, v)
+	}
+
+	if info.HostNetwork {
+		options := &policy.OptionsType{
+			CgroupName: strconv.Itoa(info.Pid),
+			CgroupMark: strconv.FormatUint(cgnetcls.MarkVal(), 10),
+			AutoPort:   true,
+		}
+		return policy.NewPURuntime(info.ID, info.Pid, "", tags, nil, common.LinuxProcessPU, policy.None, options), nil
+	}
+
+	return policy.NewPURuntime(info.ID, info.Pid, ContainerdNetNSPath(info), tags, nil, common.ContainerPU, policy.None, nil), nil
+}
+
+// ContainerdNetNSPath returns the path of the network namespace of the container.
+// The path from the OCI runtime spec is used if it is set, otherwise the namespace
+// is entered through the pid of the task.
+func ContainerdNetNSPath(info *ContainerdInfo) string {
+
+	if info.HostNetwork {
+		return ""
+	}
+
+	if info.NetNSPath != "" {
+		return info.NetNSPath
+	}
+
+	if info.Pid == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf("/proc/%d/ns/net", info.Pid)
+}
+
+func appendUserTag(tags *policy.TagStore, k, v string) {
+
+	if len(strings.TrimSpace(k)) == 0 {
+		return
+	}
+
+	if len(v) == 0 {
+		v = "<empty>"
+	}
+
+	if !strings.HasPrefix(k, constants.UserLabelPrefix) {
+		k = constants.UserLabelPrefix + k
+	}
+
+	tags.AppendKeyValue(k, v)
+}
@@ -0,0 +1,123 @@
+// +build !windows
+
+package extractors
+
+import (
+	"testing"
+
+	"go.aporeto.io/enforcerd/trireme-lib/common"
+)
+
+func TestDefaultContainerdMetadataExtractor(t *testing.T) {
+
+	if _, err := DefaultContainerdMetadataExtractor(nil); err == nil {
+		t.Error("expected an error for empty info")
+	}
+
+	info := &ContainerdInfo{
+		ID:        "redis",
+		Namespace: "default",
+		Image:     "docker.io/library/redis:latest",
+		Labels: map[string]string{
+			"   ":         "remove me",
+			"empty-label": "",
+			"app":         "label",
+		},
+		Annotations: map[string]string{
+			"app":   "annotation",
+			"owner": "team",
+		},
+		Pid: 1234,
+	}
+
+	pu, err := DefaultContainerdMetadataExtractor(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		"@app:image":                "docker.io/library/redis:latest",
+		"@app:extractor":            "containerd",
+		"@app:containerd:name":      "redis",
+		"@app:containerd:namespace": "default",
+		"@usr:empty-label":          "<empty>",
+		"@usr:app":                  "label",
+		"@usr:owner":                "team",
+	}
+	for k, v := range expected {
+		if value, ok := pu.Tag(k); !ok || value != v {
+			t.Errorf("tag %s: expected %s, got %s", k, v, value)
+		}
+	}
+	if len(pu.Tags().GetSlice()) != len(expected) {
+		t.Errorf("unexpected tags %v", pu.Tags().GetSlice())
+	}
+
+	if pu.PUType() != common.ContainerPU {
+		t.Errorf("expected container pu, got %d", pu.PUType())
+	}
+	if pu.NSPath() != "/proc/1234/ns/net" {
+		t.Errorf("unexpected netns path %s", pu.NSPath())
+	}
+}
+
+func TestDefaultContainerdMetadataExtractorHostNetwork(t *testing.T) {
+
+	pu, err := DefaultContainerdMetadataExtractor(&ContainerdInfo{
+		ID:          "host",
+		Namespace:   "default",
+		Pid:         1234,
+		HostNetwork: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if pu.PUType() != common.LinuxProcessPU {
+		t.Errorf("expected linux process pu, got %d", pu.PUType())
+	}
+	if pu.NSPath() != "" {
+		t.Errorf("unexpected netns path %s", pu.NSPath())
+	}
+	if pu.Options().CgroupMark == "" || !pu.Options().AutoPort {
+		t.Errorf("unexpected options %+v", pu.Options())
+	}
+}
+
+func TestContainerdNetNSPath(t *testing.T) {
+
+	tests := []struct {
+		name string
+		info *ContainerdInfo
+		want string
+	}{
+		{
+			name: "spec path",
+			info: &ContainerdInfo{Pid: 10, NetNSPath: "/var/run/netns/cni-1"},
+			want: "/var/run/netns/cni-1",
+		},
+		{
+			name: "pid path",
+			info: &ContainerdInfo{Pid: 10},
+			want: "/proc/10/ns/net",
+		},
+		{
+			name: "no task",
+			info: &ContainerdInfo{},
+			want: "",
+		},
+		{
+			name: "host network",
+			info: &ContainerdInfo{Pid: 10, HostNetwork: true},
+			want: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ContainerdNetNSPath(tt.info); got != tt.want {
+				t.Errorf("ContainerdNetNSPath() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,444 @@
+package extractors
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"sort"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"go.aporeto.io/enforcerd/trireme-lib/common"
+	"go.aporeto.io/enforcerd/trireme-lib/policy"
+	"go.aporeto.io/enforcerd/trireme-lib/utils/cache"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// ExternalExtractorProtocolVersion is the version of the protocol spoken with
+// the external metadata extractors.
+const ExternalExtractorProtocolVersion = 1
+
+// The monitors that send requests to an external metadata extractor.
+const (
+	ExternalExtractorMonitorEvent      = "event"
+	ExternalExtractorMonitorDocker     = "docker"
+	ExternalExtractorMonitorContainerd = "containerd"
+	ExternalExtractorMonitorPodman     = "podman"
+	ExternalExtractorMonitorSystemd    = "systemd"
+	ExternalExtractorMonitorPod        = "pod"
+)
+
+const (
+	defaultExternalExtractorTimeout = 5 * time.Second
+	maxExternalExtractorResponse    = 1 << 20
+)
+
+// ExternalExtractorConfig is the configuration of an external metadata extractor.
+// Exactly one of Command and Socket must be set.
+type ExternalExtractorConfig struct {
+	// Command is the executable of the extractor. It is run for every request:
+	// the request is written on its standard input and the response is read
+	// from its standard output.
+	Command string
+
+	// Socket is the path of the unix socket of a long running extractor. Every
+	// request uses its own connection: the request is sent as one JSON document
+	// followed by a new line, and the extractor answers with one JSON document.
+	Socket string
+
+	// Timeout is the time given to the extractor to answer. It defaults to 5s.
+	Timeout time.Duration
+
+	// CacheTTL is the time the responses are cached. The same request, like
+	// the one of an update event, is not sent again before it expires. The
+	// responses are not cached if it is 0.
+	CacheTTL time.Duration
+}
+
+// ExternalExtractorRuntime is the runtime computed by the default extractor
+// of the monitor. It is sent to the external extractor as a starting point.
+type ExternalExtractorRuntime struct {
+	Name   string        `json:"name"`
+	PID    int           `json:"pid,omitempty"`
+	PUType common.PUType `json:"putype"`
+	Tags   []string      `json:"tags,omitempty"`
+}
+
+// ExternalExtractorRequest is the request sent to an external extractor. Only
+// the data of the monitor that sends the request is set.
+type ExternalExtractorRequest struct {
+	// Version is the version of the protocol.
+	Version int `json:"version"`
+
+	// Monitor is the kind of monitor that sends the request.
+	Monitor string `json:"monitor"`
+
+	// Event is the event of the event based monitors: linux, uid, ssh, windows.
+	Event *common.EventInfo `json:"event,omitempty"`
+
+	// Container is the inspect data of a container: a docker ContainerJSON, a
+	// ContainerdInfo or a PodmanContainerJSON.
+	Container interface{} `json:"container,omitempty"`
+
+	// Pod is the Kubernetes pod of the pod monitors, or the podman pod.
+	Pod interface{} `json:"pod,omitempty"`
+
+	// Unit is the systemd unit of the systemd monitor.
+	Unit *SystemdUnitInfo `json:"unit,omitempty"`
+
+	// Runtime is the runtime computed by the default extractor.
+	Runtime *ExternalExtractorRuntime `json:"runtime"`
+}
+
+// ExternalExtractorResponse is the response of an external extractor. It is
+// merged into the runtime computed by the default extractor.
+type ExternalExtractorResponse struct {
+	// Tags are key=value tags that are added to the tags of the PU.
+	Tags []string `json:"tags,omitempty"`
+
+	// Ports are the services of the PU, e.g. 80 or 8085/udp. They are added
+	// to the services of the PU.
+	Ports []string `json:"ports,omitempty"`
+
+	// Options overrides the options of the PU.
+	Options *ExternalExtractorOptions `json:"options,omitempty"`
+
+	// Error is set when the extractor failed. The runtime of the default
+	// extractor is used instead.
+	Error string `json:"error,omitempty"`
+}
+
+// ExternalExtractorOptions are the options of the PU that an external extractor
+// can override. The empty options are left unchanged.
+type ExternalExtractorOptions struct {
+	CgroupName string `json:"cgroupname,omitempty"`
+	CgroupMark string `json:"cgroupmark,omitempty"`
+	UserID     string `json:"userid,omitempty"`
+	AutoPort   *bool  `json:"autoport,omitempty"`
+}
+
+// ExternalExtractor sends the data of the PUs to an external program that
+// decides on their tags, services and options. It wraps the extractor of any
+// monitor: the runtime of the wrapped extractor is sent with the request, and
+// it is used as is if the external extractor fails or times out.
+type ExternalExtractor struct {
+	call      func(ctx context.Context, request []byte) ([]byte, error)
+	timeout   time.Duration
+	responses *cache.Cache
+}
+
+// NewExternalMetadataExtractor returns an external extractor for the given
+// configuration.
+func NewExternalMetadataExtractor(cfg ExternalExtractorConfig) (*ExternalExtractor, error) {
+
+	e := &ExternalExtractor{
+		timeout: cfg.Timeout,
+	}
+
+	if e.timeout <= 0 {
+		e.timeout = defaultExternalExtractorTimeout
+	}
+
+	if cfg.CacheTTL > 0 {
+		e.responses = cache.NewCacheWithExpiration("externalExtractorResponses", cfg.CacheTTL)
+	}
+
+	switch {
+	case cfg.Command != "" && cfg.Socket != "":
+		return nil, errors.New("external extractor: only one of command and socket can be set")
+
+	case cfg.Command != "":
+		path, err := exec.LookPath(cfg.Command)
+		if err != nil {
+			return nil, fmt.Errorf("external extractor: exec file not found %s: %s", cfg.Command, err)
+		}
+		e.call = func(ctx context.Context, request []byte) ([]byte, error) {
+			return callCommand(ctx, path, request)
+		}
+
+	case cfg.Socket != "":
+		if _, err := os.Stat(cfg.Socket); err != nil {
+			return nil, fmt.Errorf("external extractor: socket not found %s: %s", cfg.Socket, err)
+		}
+		e.call = func(ctx context.Context, request []byte) ([]byte, error) {
+			return callSocket(ctx, cfg.Socket, request)
+		}
+
+	default:
+		return nil, errors.New("external extractor: command or socket is required")
+	}
+
+	return e, nil
+}
+
+// EventMetadataExtractor wraps the extractor of the event based monitors.
+func (e *ExternalExtractor) EventMetadataExtractor(fallback EventMetadataExtractor) EventMetadataExtractor {
+
+	return func(event *common.EventInfo) (*policy.PURuntime, error) {
+
+		runtime, err := fallback(event)
+		if err != nil {
+			return nil, err
+		}
+
+		return e.extract(context.Background(), &ExternalExtractorRequest{
+			Monitor: ExternalExtractorMonitorEvent,
+			Event:   event,
+		}, runtime), nil
+	}
+}
+
+// DockerMetadataExtractor wraps the extractor of the docker monitor.
+func (e *ExternalExtractor) DockerMetadataExtractor(fallback DockerMetadataExtractor) DockerMetadataExtractor {
+
+	return func(info *types.ContainerJSON) (*policy.PURuntime, error) {
+
+		runtime, err := fallback(info)
+		if err != nil {
+			return nil, err
+		}
+
+		return e.extract(context.Background(), &ExternalExtractorRequest{
+			Monitor:   ExternalExtractorMonitorDocker,
+			Container: info,
+		}, runtime), nil
+	}
+}
+
+// ContainerdMetadataExtractor wraps the extractor of the containerd monitor.
+func (e *ExternalExtractor) ContainerdMetadataExtractor(fallback ContainerdMetadataExtractor) ContainerdMetadataExtractor {
+
+	return func(info *ContainerdInfo) (*policy.PURuntime, error) {
+
+		runtime, err := fallback(info)
+		if err != nil {
+			return nil, err
+		}
+
+		return e.extract(context.Background(), &ExternalExtractorRequest{
+			Monitor:   ExternalExtractorMonitorContainerd,
+			Container: info,
+		}, runtime), nil
+	}
+}
+
+// PodmanMetadataExtractor wraps the extractor of the podman monitor.
+func (e *ExternalExtractor) PodmanMetadataExtractor(fallback PodmanMetadataExtractor) PodmanMetadataExtractor {
+
+	return func(info *PodmanContainerJSON, pod *PodmanPodJSON) (*policy.PURuntime, error) {
+
+		runtime, err := fallback(info, pod)
+		if err != nil {
+			return nil, err
+		}
+
+		request := &ExternalExtractorRequest{
+			Monitor:   ExternalExtractorMonitorPodman,
+			Container: info,
+		}
+		if pod != nil {
+			request.Pod = pod
+		}
+
+		return e.extract(context.Background(), request, runtime), nil
+	}
+}
+
+// SystemdUnitMetadataExtractor wraps the extractor of the systemd monitor.
+func (e *ExternalExtractor) SystemdUnitMetadataExtractor(fallback SystemdUnitMetadataExtractor) SystemdUnitMetadataExtractor {
+
+	return func(info *SystemdUnitInfo) (*policy.PURuntime, error) {
+
+		runtime, err := fallback(info)
+		if err != nil {
+			return nil, err
+		}
+
+		return e.extract(context.Background(), &ExternalExtractorRequest{
+			Monitor: ExternalExtractorMonitorSystemd,
+			Unit:    info,
+		}, runtime), nil
+	}
+}
+
+// PodMetadataExtractor wraps the extractor of the Kubernetes monitors.
+func (e *ExternalExtractor) PodMetadataExtractor(fallback PodMetadataExtractor) PodMetadataExtractor {
+
+	return func(ctx context.Context, pod *corev1.Pod, nsPath string) (*policy.PURuntime, error) {
+
+		runtime, err := fallback(ctx, pod, nsPath)
+		if err != nil {
+			return nil, err
+		}
+
+		return e.extract(ctx, &ExternalExtractorRequest{
+			Monitor: ExternalExtractorMonitorPod,
+			Pod:     pod,
+		}, runtime), nil
+	}
+}
+
+// extract sends the request to the external extractor and merges its response
+// into the runtime. The runtime is returned unchanged if the extractor fails.
+func (e *ExternalExtractor) extract(ctx context.Context, request *ExternalExtractorRequest, runtime *policy.PURuntime) *policy.PURuntime {
+
+	if runtime == nil {
+		return nil
+	}
+
+	// the tags are sorted, so that the same runtime is always the same request
+	tags := runtime.Tags().GetSlice()
+	sort.Strings(tags)
+
+	request.Version = ExternalExtractorProtocolVersion
+	request.Runtime = &ExternalExtractorRuntime{
+		Name:   runtime.Name(),
+		PID:    runtime.Pid(),
+		PUType: runtime.PUType(),
+		Tags:   tags,
+	}
+
+	response, err := e.response(ctx, request)
+	if err != nil {
+		zap.L().Warn("External extractor failed, using the default metadata",
+			zap.String("monitor", request.Monitor),
+			zap.String("name", runtime.Name()),
+			zap.Error(err),
+		)
+		return runtime
+	}
+
+	services, err := SystemdUnitServices(response.Ports)
+	if err != nil {
+		zap.L().Warn("External extractor returned invalid ports, using the default metadata",
+			zap.String("monitor", request.Monitor),
+			zap.String("name", runtime.Name()),
+			zap.Error(err),
+		)
+		return runtime
+	}
+
+	merged := runtime.Tags()
+	merged.MergeSlice(response.Tags)
+	runtime.SetTags(merged)
+
+	options := runtime.Options()
+	options.Services = append(options.Services, services...)
+	if o := response.Options; o != nil {
+		if o.CgroupName != "" {
+			options.CgroupName = o.CgroupName
+		}
+		if o.CgroupMark != "" {
+			options.CgroupMark = o.CgroupMark
+		}
+		if o.UserID != "" {
+			options.UserID = o.UserID
+		}
+		if o.AutoPort != nil {
+			options.AutoPort = *o.AutoPort
+		}
+	}
+	runtime.SetOptions(options)
+
+	return runtime
+}
+
+// response returns the response of the extractor for a request, from the
+// cache if possible.
+func (e *ExternalExtractor) response(ctx context.Context, request *ExternalExtractorRequest) (*ExternalExtractorResponse, error) {
+
+	data, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal request: %s", err)
+	}
+
+	var key string
+	if e.responses != nil {
+		sum := sha256.Sum256(data)
+		key = hex.EncodeToString(sum[:])
+		if cached, err := e.responses.Get(key); err == nil {
+			return cached.(*ExternalExtractorResponse), nil
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, e.timeout)
+	defer cancel()
+
+	output, err := e.call(ctx, data)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &ExternalExtractorResponse{}
+	if err := json.Unmarshal(output, response); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal response: %s", err)
+	}
+
+	if response.Error != "" {
+		return nil, fmt.Errorf("extractor error: %s", response.Error)
+	}
+
+	if e.responses != nil {
+		e.responses.AddOrUpdate(key, response)
+	}
+
+	return response, nil
+}
+
+// callCommand runs the extractor with the request on its standard input.
+func callCommand(ctx context.Context, path string, request []byte) ([]byte, error) {
+
+	var stderr bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, path)
+	cmd.Stdin = bytes.NewReader(request)
+	cmd.Stderr = &stderr
+
+	output, err := cmd.Output()
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("unable to run extractor: %s", ctx.Err())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to run extractor: %s: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+
+	return output, nil
+}
+
+// callSocket sends the request to the extractor listening on a unix socket.
+func callSocket(ctx context.Context, socket string, request []byte) ([]byte, error) {
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "unix", socket)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to extractor: %s", err)
+	}
+	defer conn.Close() // nolint: errcheck
+
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return nil, fmt.Errorf("unable to set deadline: %s", err)
+		}
+	}
+
+	if _, err := conn.Write(append(request, '\n')); err != nil {
+		return nil, fmt.Errorf("unable to send request to extractor: %s", err)
+	}
+
+	var response json.RawMessage
+	decoder := json.NewDecoder(io.LimitReader(conn, maxExternalExtractorResponse))
+	if err := decoder.Decode(&response); err != nil {
+		return nil, fmt.Errorf("unable to read response of extractor: %s", err)
+	}
+
+	return response, nil
+}
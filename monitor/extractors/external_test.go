@@ -0,0 +1,225 @@
+// +build !windows
+
+package extractors
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.aporeto.io/enforcerd/trireme-lib/common"
+	"go.aporeto.io/enforcerd/trireme-lib/policy"
+)
+
+func testExternalCommand(t *testing.T, dir, name, script string) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte("#!/bin/sh\n"+script+"\n"), 0755); err != nil {
+		t.Fatalf("unable to write extractor: %s", err)
+	}
+	return path
+}
+
+func testFallbackExtractor(event *common.EventInfo) (*policy.PURuntime, error) {
+	tags := policy.NewTagStoreFromSlice([]string{"@app:name=" + event.Name})
+	return policy.NewPURuntime(event.Name, int(event.PID), "", tags, nil, common.LinuxProcessPU, policy.None, nil), nil
+}
+
+func sortedTags(runtime *policy.PURuntime) []string {
+	tags := runtime.Tags().GetSlice()
+	sort.Strings(tags)
+	return tags
+}
+
+func TestNewExternalMetadataExtractor(t *testing.T) {
+	dir, err := ioutil.TempDir("", "external")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir) // nolint: errcheck
+
+	command := testExternalCommand(t, dir, "extractor", "cat")
+
+	tests := []struct {
+		name    string
+		cfg     ExternalExtractorConfig
+		wantErr bool
+	}{
+		{
+			name:    "empty configuration",
+			cfg:     ExternalExtractorConfig{},
+			wantErr: true,
+		},
+		{
+			name:    "command and socket",
+			cfg:     ExternalExtractorConfig{Command: command, Socket: filepath.Join(dir, "sock")},
+			wantErr: true,
+		},
+		{
+			name:    "unknown command",
+			cfg:     ExternalExtractorConfig{Command: filepath.Join(dir, "unknown")},
+			wantErr: true,
+		},
+		{
+			name:    "unknown socket",
+			cfg:     ExternalExtractorConfig{Socket: filepath.Join(dir, "unknown")},
+			wantErr: true,
+		},
+		{
+			name:    "command",
+			cfg:     ExternalExtractorConfig{Command: command},
+			wantErr: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewExternalMetadataExtractor(tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewExternalMetadataExtractor() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestExternalExtractorCommand(t *testing.T) {
+	dir, err := ioutil.TempDir("", "external")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir) // nolint: errcheck
+
+	tests := []struct {
+		name         string
+		script       string
+		wantTags     []string
+		wantServices int
+		wantUserID   string
+	}{
+		{
+			name:         "tags, ports and options are merged",
+			script:       `cat > /dev/null; echo '{"tags":["team=blue"],"ports":["80","53/udp"],"options":{"userid":"1000"}}'`,
+			wantTags:     []string{"@app:name=web", "team=blue"},
+			wantServices: 2,
+			wantUserID:   "1000",
+		},
+		{
+			name:     "extractor error falls back to the default runtime",
+			script:   `cat > /dev/null; echo '{"error":"unknown pu"}'`,
+			wantTags: []string{"@app:name=web"},
+		},
+		{
+			name:     "invalid ports fall back to the default runtime",
+			script:   `cat > /dev/null; echo '{"tags":["team=blue"],"ports":["80/sctp"]}'`,
+			wantTags: []string{"@app:name=web"},
+		},
+		{
+			name:     "failed command falls back to the default runtime",
+			script:   `exit 1`,
+			wantTags: []string{"@app:name=web"},
+		},
+		{
+			name:     "timeout falls back to the default runtime",
+			script:   `exec sleep 5`,
+			wantTags: []string{"@app:name=web"},
+		},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			command := testExternalCommand(t, dir, "extractor"+string(rune('a'+i)), tt.script)
+
+			e, err := NewExternalMetadataExtractor(ExternalExtractorConfig{
+				Command: command,
+				Timeout: 500 * time.Millisecond,
+			})
+			if err != nil {
+				t.Fatalf("NewExternalMetadataExtractor() error = %v", err)
+			}
+
+			extractor := e.EventMetadataExtractor(testFallbackExtractor)
+			runtime, err := extractor(&common.EventInfo{Name: "web", PID: 1})
+			if err != nil {
+				t.Fatalf("extractor() error = %v", err)
+			}
+
+			if got := sortedTags(runtime); !reflect.DeepEqual(got, tt.wantTags) {
+				t.Errorf("tags = %v, want %v", got, tt.wantTags)
+			}
+			if got := len(runtime.Options().Services); got != tt.wantServices {
+				t.Errorf("services = %d, want %d", got, tt.wantServices)
+			}
+			if got := runtime.Options().UserID; got != tt.wantUserID {
+				t.Errorf("user ID = %s, want %s", got, tt.wantUserID)
+			}
+		})
+	}
+}
+
+func TestExternalExtractorSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "external")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir) // nolint: errcheck
+
+	socket := filepath.Join(dir, "extractor.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close() // nolint: errcheck
+
+	var requests int32
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			atomic.AddInt32(&requests, 1)
+
+			request := &ExternalExtractorRequest{}
+			if err := json.NewDecoder(bufio.NewReader(conn)).Decode(request); err != nil {
+				conn.Close() // nolint: errcheck
+				continue
+			}
+
+			response := &ExternalExtractorResponse{
+				Tags: []string{"monitor=" + request.Monitor, "runtime=" + request.Runtime.Name},
+			}
+			json.NewEncoder(conn).Encode(response) // nolint: errcheck
+			conn.Close()                           // nolint: errcheck
+		}
+	}()
+
+	e, err := NewExternalMetadataExtractor(ExternalExtractorConfig{
+		Socket:   socket,
+		CacheTTL: time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("NewExternalMetadataExtractor() error = %v", err)
+	}
+
+	extractor := e.EventMetadataExtractor(testFallbackExtractor)
+	for i := 0; i < 2; i++ {
+		runtime, err := extractor(&common.EventInfo{Name: "web", PID: 1})
+		if err != nil {
+			t.Fatalf("extractor() error = %v", err)
+		}
+
+		want := []string{"@app:name=web", "monitor=event", "runtime=web"}
+		if got := sortedTags(runtime); !reflect.DeepEqual(got, want) {
+			t.Errorf("tags = %v, want %v", got, want)
+		}
+	}
+
+	if got := atomic.LoadInt32(&requests); got != 1 {
+		t.Errorf("requests = %d, want 1: the second response should be cached", got)
+	}
+}
@@ -0,0 +1,134 @@
+package extractors
+
+import (
+	"fmt"
+	"strconv"
+
+	"go.aporeto.io/enforcerd/trireme-lib/common"
+	"go.aporeto.io/enforcerd/trireme-lib/monitor/constants"
+	"go.aporeto.io/enforcerd/trireme-lib/policy"
+	"go.aporeto.io/enforcerd/trireme-lib/utils/cgnetcls"
+)
+
+// PodmanContainerJSON is the subset of the libpod container inspect
+// response that is used by the podman metadata extractors.
+type PodmanContainerJSON struct {
+	ID        string `json:"Id"`
+	Name      string `json:"Name"`
+	ImageName string `json:"ImageName"`
+	Pod       string `json:"Pod"`
+	IsInfra   bool   `json:"IsInfra"`
+	State     struct {
+		Status  string `json:"Status"`
+		Running bool   `json:"Running"`
+		Paused  bool   `json:"Paused"`
+		Pid     int    `json:"Pid"`
+	} `json:"State"`
+	Config struct {
+		Labels      map[string]string `json:"Labels"`
+		Annotations map[string]string `json:"Annotations"`
+	} `json:"Config"`
+	HostConfig struct {
+		NetworkMode string `json:"NetworkMode"`
+	} `json:"HostConfig"`
+	NetworkSettings struct {
+		IPAddress  string `json:"IPAddress"`
+		SandboxKey string `json:"SandboxKey"`
+	} `json:"NetworkSettings"`
+}
+
+// PodmanPodJSON is the subset of the libpod pod inspect response that is
+// used by the podman metadata extractors.
+type PodmanPodJSON struct {
+	ID               string            `json:"Id"`
+	Name             string            `json:"Name"`
+	Labels           map[string]string `json:"Labels"`
+	InfraContainerID string            `json:"InfraContainerID"`
+	SharedNamespaces []string          `json:"SharedNamespaces"`
+}
+
+// SharesNetwork returns true if the containers of the pod share the network
+// namespace of the infra container.
+func (p *PodmanPodJSON) SharesNetwork() bool {
+
+	if p.InfraContainerID == "" {
+		return false
+	}
+
+	for _, ns := range p.SharedNamespaces {
+		if ns == "net" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// A PodmanMetadataExtractor is a function used to extract a *policy.PURuntime from a given
+// libpod container. The pod is nil if the container is not part of a pod.
+type PodmanMetadataExtractor func(*PodmanContainerJSON, *PodmanPodJSON) (*policy.PURuntime, error)
+
+// DefaultPodmanMetadataExtractor is the default metadata extractor for podman. It
+// works like the docker extractor. The labels of the pod are added to the labels of
+// the container, the container labels taking precedence.
+func DefaultPodmanMetadataExtractor(info *PodmanContainerJSON, pod *PodmanPodJSON) (*policy.PURuntime, error) {
+
+	if info == nil {
+		return nil, fmt.Errorf("empty podman info")
+	}
+
+	tags := policy.NewTagStore()
+	tags.AppendKeyValue("@app:image", info.ImageName)
+	tags.AppendKeyValue("@app:extractor", "podman")
+	tags.AppendKeyValue("@app:podman:name", info.Name)
+
+	if pod != nil {
+		tags.AppendKeyValue("@app:podman:pod", pod.Name)
+		for k, v := range pod.Labels {
+			if _, ok := info.Config.Labels[k]; ok {
+				continue
+			}
+			appendUserTag(tags, k, v)
+		}
+	}
+
+	for k, v := range info.Config.Labels {
+		appendUserTag(tags, k, v)
+	}
+
+	ipa := policy.ExtendedMap{}
+	if info.NetworkSettings.IPAddress != "" {
+		ipa["bridge"] = info.NetworkSettings.IPAddress
+	}
+
+	if info.HostConfig.NetworkMode == constants.PodmanHostMode {
+		options := &policy.OptionsType{
+			CgroupName: strconv.Itoa(info.State.Pid),
+			CgroupMark: strconv.FormatUint(cgnetcls.MarkVal(), 10),
+			AutoPort:   true,
+		}
+		return policy.NewPURuntime(info.Name, info.State.Pid, "", tags, ipa, common.LinuxProcessPU, policy.None, options), nil
+	}
+
+	return policy.NewPURuntime(info.Name, info.State.Pid, PodmanNetNSPath(info), tags, ipa, common.ContainerPU, policy.None, nil), nil
+}
+
+// PodmanNetNSPath returns the path of the network namespace of the container.
+// The sandbox key is used if it is set, otherwise the namespace is entered
+// through the pid of the container.
+func PodmanNetNSPath(info *PodmanContainerJSON) string {
+
+	if info.HostConfig.NetworkMode == constants.PodmanHostMode {
+		return ""
+	}
+
+	if info.NetworkSettings.SandboxKey != "" {
+		return info.NetworkSettings.SandboxKey
+	}
+
+	if info.State.Pid == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf("/proc/%d/ns/net", info.State.Pid)
+}
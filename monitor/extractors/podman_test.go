@@ -0,0 +1,113 @@
+// +build !windows
+
+package extractors
+
+import (
+	"testing"
+
+	"go.aporeto.io/enforcerd/trireme-lib/common"
+)
+
+func TestDefaultPodmanMetadataExtractor(t *testing.T) {
+
+	if _, err := DefaultPodmanMetadataExtractor(nil, nil); err == nil {
+		t.Error("expected an error for empty info")
+	}
+
+	info := &PodmanContainerJSON{
+		ID:        "0123456789abcdef",
+		Name:      "web",
+		ImageName: "docker.io/library/nginx:latest",
+	}
+	info.State.Pid = 100
+	info.Config.Labels = map[string]string{
+		"app":         "container",
+		"empty-label": "",
+	}
+	info.NetworkSettings.IPAddress = "10.88.0.2"
+	info.NetworkSettings.SandboxKey = "/run/netns/cni-1"
+
+	pod := &PodmanPodJSON{
+		Name: "frontend",
+		Labels: map[string]string{
+			"app":  "pod",
+			"tier": "web",
+		},
+	}
+
+	pu, err := DefaultPodmanMetadataExtractor(info, pod)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		"@app:image":       "docker.io/library/nginx:latest",
+		"@app:extractor":   "podman",
+		"@app:podman:name": "web",
+		"@app:podman:pod":  "frontend",
+		"@usr:app":         "container",
+		"@usr:tier":        "web",
+		"@usr:empty-label": "<empty>",
+	}
+	for k, v := range expected {
+		if value, ok := pu.Tag(k); !ok || value != v {
+			t.Errorf("tag %s: expected %s, got %s", k, v, value)
+		}
+	}
+	if len(pu.Tags().GetSlice()) != len(expected) {
+		t.Errorf("unexpected tags %v", pu.Tags().GetSlice())
+	}
+
+	if pu.PUType() != common.ContainerPU {
+		t.Errorf("expected container pu, got %d", pu.PUType())
+	}
+	if pu.NSPath() != "/run/netns/cni-1" {
+		t.Errorf("unexpected netns path %s", pu.NSPath())
+	}
+	if ip, ok := pu.IPAddresses()["bridge"]; !ok || ip != "10.88.0.2" {
+		t.Errorf("unexpected ip addresses %v", pu.IPAddresses())
+	}
+
+	info.HostConfig.NetworkMode = "host"
+	pu, err = DefaultPodmanMetadataExtractor(info, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pu.PUType() != common.LinuxProcessPU || pu.NSPath() != "" {
+		t.Errorf("unexpected host mode runtime %d %s", pu.PUType(), pu.NSPath())
+	}
+	if _, ok := pu.Tag("@app:podman:pod"); ok {
+		t.Error("unexpected pod tag")
+	}
+}
+
+func TestPodmanPodSharesNetwork(t *testing.T) {
+
+	tests := []struct {
+		name string
+		pod  *PodmanPodJSON
+		want bool
+	}{
+		{
+			name: "shared network",
+			pod:  &PodmanPodJSON{InfraContainerID: "infra", SharedNamespaces: []string{"ipc", "net", "uts"}},
+			want: true,
+		},
+		{
+			name: "network not shared",
+			pod:  &PodmanPodJSON{InfraContainerID: "infra", SharedNamespaces: []string{"ipc", "uts"}},
+		},
+		{
+			name: "no infra container",
+			pod:  &PodmanPodJSON{SharedNamespaces: []string{"net"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.pod.SharesNetwork(); got != tt.want {
+				t.Errorf("SharesNetwork() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
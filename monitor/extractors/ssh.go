@@ -4,13 +4,37 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
-	"go.aporeto.io/trireme-lib/common"
-	"go.aporeto.io/trireme-lib/policy"
-	"go.aporeto.io/trireme-lib/utils/cgnetcls"
+	"go.aporeto.io/enforcerd/trireme-lib/common"
+	"go.aporeto.io/enforcerd/trireme-lib/policy"
+	"go.aporeto.io/enforcerd/trireme-lib/utils/cgnetcls"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/ssh"
 )
 
-// SSHMetadataExtractor is a metadata extractor for ssh.
+// sshNow returns the time the SSH certificates are checked against.
+var sshNow = time.Now
+
+// sshReservedTags are the keys of the tags derived from the SSH certificate of
+// the session. The tags sent with the event cannot set them.
+var sshReservedTags = map[string]struct{}{
+	"principal":   {},
+	"keyid":       {},
+	"serial":      {},
+	"certificate": {},
+}
+
+// sshReservedTag returns true if the key is derived from the SSH certificate.
+func sshReservedTag(key string) bool {
+	if _, ok := sshReservedTags[key]; ok {
+		return true
+	}
+	return strings.HasPrefix(key, "option:")
+}
+
+// SSHMetadataExtractor is a metadata extractor for ssh. The identity tags of the
+// session only come from its SSH certificate.
 func SSHMetadataExtractor(event *common.EventInfo) (*policy.PURuntime, error) {
 
 	runtimeTags := policy.NewTagStore()
@@ -28,9 +52,21 @@ func SSHMetadataExtractor(event *common.EventInfo) (*policy.PURuntime, error) {
 			continue
 		}
 
+		if sshReservedTag(parts[0]) {
+			zap.L().Warn("Ignoring reserved ssh tag", zap.String("tag", tag))
+			continue
+		}
+
 		runtimeTags.AppendKeyValue("@user:ssh:"+parts[0], parts[1])
 	}
 
+	if cert := event.SSHCertificate; cert != nil {
+		for _, tag := range SSHCertificateTags(cert, sshNow()) {
+			parts := strings.SplitN(tag, "=", 2)
+			runtimeTags.AppendKeyValue(parts[0], parts[1])
+		}
+	}
+
 	options := &policy.OptionsType{
 		CgroupName: event.PUID,
 		CgroupMark: strconv.FormatUint(cgnetcls.MarkVal(), 10),
@@ -38,5 +74,91 @@ func SSHMetadataExtractor(event *common.EventInfo) (*policy.PURuntime, error) {
 
 	runtimeIps := policy.ExtendedMap{"bridge": "0.0.0.0/0"}
 
-	return policy.NewPURuntime(event.Name, int(event.PID), "", runtimeTags, runtimeIps, event.PUType, options), nil
+	return policy.NewPURuntime(event.Name, int(event.PID), "", runtimeTags, runtimeIps, event.PUType, policy.None, options), nil
+}
+
+// SSHCertificateTags returns the identity tags of an SSH certificate. A
+// certificate that is not valid at the given time only gets the
+// @user:ssh:certificate=expired tag, so that the policies written for its
+// principals do not apply anymore.
+func SSHCertificateTags(cert *common.SSHCertificateInfo, now time.Time) []string {
+
+	if !cert.Valid(now) {
+		return []string{"@user:ssh:certificate=expired"}
+	}
+
+	tags := []string{"@user:ssh:certificate=valid"}
+
+	for _, principal := range cert.Principals {
+		tags = append(tags, "@user:ssh:principal="+principal)
+	}
+
+	if cert.KeyID != "" {
+		tags = append(tags, "@user:ssh:keyid="+cert.KeyID)
+	}
+
+	tags = append(tags, "@user:ssh:serial="+strconv.FormatUint(cert.Serial, 10))
+
+	for name, value := range cert.CriticalOptions {
+		if value == "" {
+			value = "true"
+		}
+		tags = append(tags, "@user:ssh:option:"+name+"="+value)
+	}
+
+	return tags
+}
+
+// SSHCertificateFromAuthInfo returns the certificate of an SSH session from the
+// authentication information exposed by sshd with ExposeAuthInfo, like in the
+// SSH_AUTH_INFO_0 PAM variable. Every line is a method followed by its data,
+// e.g. "publickey ssh-ed25519-cert-v01@openssh.com AAAA...". It returns nil if
+// the session was not authenticated with a certificate.
+func SSHCertificateFromAuthInfo(authInfo string) (*common.SSHCertificateInfo, error) {
+
+	for _, line := range strings.Split(authInfo, "\n") {
+		method := strings.SplitN(strings.TrimSpace(line), " ", 2)
+		if len(method) != 2 || method[0] != "publickey" {
+			continue
+		}
+
+		key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(method[1]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid public key: %s", err)
+		}
+
+		cert, ok := key.(*ssh.Certificate)
+		if !ok || cert.CertType != ssh.UserCert {
+			continue
+		}
+
+		return SSHCertificateInfo(cert), nil
+	}
+
+	return nil, nil
+}
+
+// SSHCertificateInfo returns the attributes of an OpenSSH user certificate.
+func SSHCertificateInfo(cert *ssh.Certificate) *common.SSHCertificateInfo {
+
+	info := &common.SSHCertificateInfo{
+		KeyID:           cert.KeyId,
+		Serial:          cert.Serial,
+		Principals:      append([]string{}, cert.ValidPrincipals...),
+		CriticalOptions: map[string]string{},
+	}
+
+	for name, value := range cert.CriticalOptions {
+		info.CriticalOptions[name] = value
+	}
+
+	if cert.ValidAfter != 0 {
+		info.ValidAfter = time.Unix(int64(cert.ValidAfter), 0)
+	}
+
+	if cert.ValidBefore != ssh.CertTimeInfinity {
+		info.ValidBefore = time.Unix(int64(cert.ValidBefore), 0)
+	}
+
+	return info
 }
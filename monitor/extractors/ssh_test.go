@@ -3,15 +3,18 @@
 package extractors
 
 import (
-	"strconv"
+	"crypto/ed25519"
+	"crypto/rand"
 	"testing"
+	"time"
 
 	. "github.com/smartystreets/goconvey/convey"
-	"go.aporeto.io/trireme-lib/common"
-	"go.aporeto.io/trireme-lib/policy"
+	"go.aporeto.io/enforcerd/trireme-lib/common"
+	"go.aporeto.io/enforcerd/trireme-lib/policy"
+	"golang.org/x/crypto/ssh"
 )
 
-func testRuntime() *policy.PURuntime {
+func testRuntime(mark string) *policy.PURuntime {
 
 	tags := policy.NewTagStore()
 	tags.AppendKeyValue("@user:ssh:app", "web")
@@ -20,10 +23,10 @@ func testRuntime() *policy.PURuntime {
 	runtimeIps := policy.ExtendedMap{"bridge": "0.0.0.0/0"}
 	options := &policy.OptionsType{
 		CgroupName: "/1234",
-		CgroupMark: strconv.FormatUint(104, 10),
+		CgroupMark: mark,
 	}
 
-	return policy.NewPURuntime("curl", 1234, "", tags, runtimeIps, common.SSHSessionPU, options)
+	return policy.NewPURuntime("curl", 1234, "", tags, runtimeIps, common.LinuxProcessPU, policy.None, options)
 }
 
 func TestSSHMetadataExtractor(t *testing.T) {
@@ -35,15 +38,134 @@ func TestSSHMetadataExtractor(t *testing.T) {
 				Name:   "curl",
 				PID:    1234,
 				PUID:   "/1234",
-				PUType: common.SSHSessionPU,
+				PUType: common.LinuxProcessPU,
 				Tags:   []string{"app=web", "$cert=ss"},
 			}
 
 			pu, err := SSHMetadataExtractor(event)
 			Convey("I should get no error and a valid PU runtime", func() {
 				So(err, ShouldBeNil)
-				So(pu, ShouldResemble, testRuntime())
+				So(pu.Options().CgroupMark, ShouldNotBeEmpty)
+				So(pu, ShouldResemble, testRuntime(pu.Options().CgroupMark))
 			})
 		})
+
+		Convey("If the tags try to set the identity of the session", func() {
+			event := &common.EventInfo{
+				Name:   "curl",
+				PID:    1234,
+				PUID:   "/1234",
+				PUType: common.LinuxProcessPU,
+				Tags:   []string{"app=web", "principal=admin", "keyid=admin", "serial=1", "certificate=valid", "option:force-command=sh"},
+			}
+
+			pu, err := SSHMetadataExtractor(event)
+			Convey("I should get no identity tags", func() {
+				So(err, ShouldBeNil)
+				tags := pu.Tags().GetSlice()
+				So(tags, ShouldContain, "@user:ssh:app=web")
+				So(tags, ShouldNotContain, "@user:ssh:principal=admin")
+				So(tags, ShouldNotContain, "@user:ssh:keyid=admin")
+				So(tags, ShouldNotContain, "@user:ssh:serial=1")
+				So(tags, ShouldNotContain, "@user:ssh:certificate=valid")
+				So(tags, ShouldNotContain, "@user:ssh:option:force-command=sh")
+			})
+		})
+
+		Convey("If the session has a certificate", func() {
+			now := time.Now()
+			event := &common.EventInfo{
+				Name:   "curl",
+				PID:    1234,
+				PUID:   "/1234",
+				PUType: common.LinuxProcessPU,
+				SSHCertificate: &common.SSHCertificateInfo{
+					KeyID:           "alice@example.com",
+					Serial:          42,
+					Principals:      []string{"alice", "admins"},
+					CriticalOptions: map[string]string{"force-command": "/usr/bin/env a=b"},
+					ValidAfter:      now.Add(-time.Hour),
+					ValidBefore:     now.Add(time.Hour),
+				},
+			}
+
+			pu, err := SSHMetadataExtractor(event)
+			Convey("I should get the identity tags of the certificate", func() {
+				So(err, ShouldBeNil)
+				tags := pu.Tags().GetSlice()
+				So(tags, ShouldContain, "@user:ssh:certificate=valid")
+				So(tags, ShouldContain, "@user:ssh:principal=alice")
+				So(tags, ShouldContain, "@user:ssh:principal=admins")
+				So(tags, ShouldContain, "@user:ssh:keyid=alice@example.com")
+				So(tags, ShouldContain, "@user:ssh:serial=42")
+				So(tags, ShouldContain, "@user:ssh:option:force-command=/usr/bin/env a=b")
+			})
+
+			Convey("When the certificate expired, I should not get its attributes", func() {
+				sshNow = func() time.Time { return now.Add(2 * time.Hour) }
+				defer func() { sshNow = time.Now }()
+
+				pu, err := SSHMetadataExtractor(event)
+				So(err, ShouldBeNil)
+				tags := pu.Tags().GetSlice()
+				So(tags, ShouldContain, "@user:ssh:certificate=expired")
+				So(tags, ShouldNotContain, "@user:ssh:principal=alice")
+				So(tags, ShouldNotContain, "@user:ssh:keyid=alice@example.com")
+			})
+		})
+	})
+}
+
+func TestSSHCertificateFromAuthInfo(t *testing.T) {
+
+	Convey("Given an OpenSSH user certificate", t, func() {
+		_, caKey, err := ed25519.GenerateKey(rand.Reader)
+		So(err, ShouldBeNil)
+		ca, err := ssh.NewSignerFromKey(caKey)
+		So(err, ShouldBeNil)
+
+		userKey, _, err := ed25519.GenerateKey(rand.Reader)
+		So(err, ShouldBeNil)
+		userPublic, err := ssh.NewPublicKey(userKey)
+		So(err, ShouldBeNil)
+
+		cert := &ssh.Certificate{
+			Key:             userPublic,
+			Serial:          7,
+			CertType:        ssh.UserCert,
+			KeyId:           "bob",
+			ValidPrincipals: []string{"bob", "ops"},
+			ValidAfter:      1000,
+			ValidBefore:     ssh.CertTimeInfinity,
+			Permissions: ssh.Permissions{
+				CriticalOptions: map[string]string{"source-address": "10.0.0.0/8"},
+			},
+		}
+		So(cert.SignCert(rand.Reader, ca), ShouldBeNil)
+
+		authInfo := "publickey " + string(ssh.MarshalAuthorizedKey(cert))
+
+		Convey("I should get its attributes from the auth info of the session", func() {
+			info, err := SSHCertificateFromAuthInfo(authInfo)
+			So(err, ShouldBeNil)
+			So(info, ShouldNotBeNil)
+			So(info.KeyID, ShouldEqual, "bob")
+			So(info.Serial, ShouldEqual, 7)
+			So(info.Principals, ShouldResemble, []string{"bob", "ops"})
+			So(info.CriticalOptions, ShouldResemble, map[string]string{"source-address": "10.0.0.0/8"})
+			So(info.ValidAfter.Unix(), ShouldEqual, 1000)
+			So(info.ValidBefore.IsZero(), ShouldBeTrue)
+		})
+
+		Convey("I should get nothing if the session used a plain key", func() {
+			info, err := SSHCertificateFromAuthInfo("publickey " + string(ssh.MarshalAuthorizedKey(userPublic)))
+			So(err, ShouldBeNil)
+			So(info, ShouldBeNil)
+		})
+
+		Convey("I should get an error for an invalid key", func() {
+			_, err := SSHCertificateFromAuthInfo("publickey ssh-ed25519 invalid")
+			So(err, ShouldNotBeNil)
+		})
 	})
 }
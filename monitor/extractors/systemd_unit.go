@@ -0,0 +1,155 @@
+package extractors
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.aporeto.io/enforcerd/trireme-lib/common"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/packet"
+	"go.aporeto.io/enforcerd/trireme-lib/policy"
+	"go.aporeto.io/enforcerd/trireme-lib/utils/cgnetcls"
+	"go.aporeto.io/enforcerd/trireme-lib/utils/portspec"
+)
+
+// SystemdUnitInfo is the information about a systemd unit that is passed
+// to the systemd unit metadata extractors. It is built from the unit
+// properties exposed over D-Bus and from the X-Trireme-* settings of the
+// unit files.
+type SystemdUnitInfo struct {
+	// PUID is the ID of the PU of the unit.
+	PUID string `json:"puid"`
+
+	// Name is the name of the unit, e.g. nginx.service.
+	Name string `json:"name"`
+
+	// Description is the description of the unit.
+	Description string `json:"description,omitempty"`
+
+	// Slice is the slice the unit belongs to.
+	Slice string `json:"slice,omitempty"`
+
+	// User is the user the unit runs as, if any.
+	User string `json:"user,omitempty"`
+
+	// MainPID is the main process of the unit.
+	MainPID int `json:"mainpid,omitempty"`
+
+	// ControlGroup is the cgroup of the unit, relative to the root of the hierarchy.
+	ControlGroup string `json:"controlgroup,omitempty"`
+
+	// Labels are the labels of the X-Trireme-Labels settings.
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Ports are the ports of the X-Trireme-Ports settings, e.g. 80 or 8085/udp.
+	Ports []string `json:"ports,omitempty"`
+
+	// AutoPort is the value of the X-Trireme-AutoPort setting.
+	AutoPort bool `json:"autoport,omitempty"`
+}
+
+// A SystemdUnitMetadataExtractor is a function used to extract a *policy.PURuntime from a given
+// systemd unit.
+type SystemdUnitMetadataExtractor func(*SystemdUnitInfo) (*policy.PURuntime, error)
+
+// DefaultSystemdUnitMetadataExtractor is the default metadata extractor for systemd units.
+// The labels of the unit are added as user tags, and the main process of the unit
+// provides the same @app:linux tags as the processes started with the systemd wrapper.
+func DefaultSystemdUnitMetadataExtractor(info *SystemdUnitInfo) (*policy.PURuntime, error) {
+
+	if info == nil {
+		return nil, fmt.Errorf("empty systemd unit info")
+	}
+
+	services, err := SystemdUnitServices(info.Ports)
+	if err != nil {
+		return nil, fmt.Errorf("unit %s: %s", info.Name, err)
+	}
+
+	tags := policy.NewTagStore()
+	tags.AppendKeyValue("@app:extractor", "systemd")
+	tags.AppendKeyValue("@app:systemd:unit", info.Name)
+	if info.Description != "" {
+		tags.AppendKeyValue("@app:systemd:description", info.Description)
+	}
+	if info.Slice != "" {
+		tags.AppendKeyValue("@app:systemd:slice", info.Slice)
+	}
+	if info.User != "" {
+		tags.AppendKeyValue("@app:systemd:user", info.User)
+	}
+
+	keys := make([]string, 0, len(info.Labels))
+	for k := range info.Labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		appendUserTag(tags, k, info.Labels[k])
+	}
+
+	if info.MainPID > 0 {
+		for _, u := range ProcessInfo(int32(info.MainPID)) {
+			tags.AppendKeyValue("@app:linux:"+u, "true")
+		}
+	}
+
+	tags.AppendKeyValue("@os:hostname", findFQDN(time.Second))
+
+	options := &policy.OptionsType{
+		CgroupName: info.PUID,
+		CgroupMark: strconv.FormatUint(cgnetcls.MarkVal(), 10),
+		Services:   services,
+		AutoPort:   info.AutoPort,
+	}
+
+	// With cgroup v2 the processes stay in the cgroup of the unit, which is
+	// managed by systemd.
+	if cgnetcls.IsCgroupV2() {
+		options.CgroupPath = info.ControlGroup
+	}
+
+	ips := policy.ExtendedMap{"bridge": "0.0.0.0/0"}
+
+	return policy.NewPURuntime(info.Name, info.MainPID, "", tags, ips, common.LinuxProcessPU, policy.None, options), nil
+}
+
+// SystemdUnitServices parses the ports of the X-Trireme-Ports settings of
+// a unit. A port without protocol is a TCP port.
+func SystemdUnitServices(ports []string) ([]common.Service, error) {
+
+	services := []common.Service{}
+
+	for _, p := range ports {
+		protocol := packet.IPProtocolTCP
+
+		parts := strings.Split(p, "/")
+		if len(parts) > 2 {
+			return nil, fmt.Errorf("invalid port %s: expected format is 80 or 8085/udp", p)
+		}
+
+		if len(parts) == 2 {
+			switch parts[1] {
+			case "tcp":
+			case "udp":
+				protocol = packet.IPProtocolUDP
+			default:
+				return nil, fmt.Errorf("invalid protocol %s: only tcp and udp are accepted", parts[1])
+			}
+		}
+
+		spec, err := portspec.NewPortSpecFromString(parts[0], nil)
+		if err != nil {
+			return nil, fmt.Errorf("invalid port %s: %s", p, err)
+		}
+
+		services = append(services, common.Service{
+			Protocol: uint8(protocol),
+			Ports:    spec,
+		})
+	}
+
+	return services, nil
+}
@@ -0,0 +1,105 @@
+// +build linux
+
+package extractors
+
+import (
+	"testing"
+
+	"go.aporeto.io/enforcerd/trireme-lib/common"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/packet"
+	"go.aporeto.io/enforcerd/trireme-lib/utils/cgnetcls"
+)
+
+func TestDefaultSystemdUnitMetadataExtractor(t *testing.T) {
+
+	if _, err := DefaultSystemdUnitMetadataExtractor(nil); err == nil {
+		t.Error("expected an error for empty info")
+	}
+
+	info := &SystemdUnitInfo{
+		PUID:         "0123456789ab",
+		Name:         "nginx.service",
+		Description:  "A high performance web server",
+		Slice:        "system.slice",
+		User:         "www-data",
+		ControlGroup: "/system.slice/nginx.service",
+		Labels: map[string]string{
+			"app":  "web",
+			"tier": "",
+		},
+		Ports:    []string{"80", "8000:8080", "53/udp"},
+		AutoPort: true,
+	}
+
+	pu, err := DefaultSystemdUnitMetadataExtractor(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		"@app:extractor":           "systemd",
+		"@app:systemd:unit":        "nginx.service",
+		"@app:systemd:description": "A high performance web server",
+		"@app:systemd:slice":       "system.slice",
+		"@app:systemd:user":        "www-data",
+		"@usr:app":                 "web",
+		"@usr:tier":                "<empty>",
+	}
+	for k, v := range expected {
+		if value, ok := pu.Tag(k); !ok || value != v {
+			t.Errorf("tag %s: expected %s, got %s", k, v, value)
+		}
+	}
+	if _, ok := pu.Tag("@os:hostname"); !ok {
+		t.Error("expected a hostname tag")
+	}
+
+	if pu.Name() != "nginx.service" || pu.PUType() != common.LinuxProcessPU {
+		t.Errorf("unexpected runtime %s %s", pu.Name(), pu.PUType())
+	}
+
+	options := pu.Options()
+	if options.CgroupName != "0123456789ab" || options.CgroupMark == "" || !options.AutoPort {
+		t.Errorf("unexpected options %+v", options)
+	}
+	if cgnetcls.IsCgroupV2() != (options.CgroupPath == "/system.slice/nginx.service") {
+		t.Errorf("unexpected cgroup path %s", options.CgroupPath)
+	}
+	if len(options.Services) != 3 {
+		t.Fatalf("unexpected services %v", options.Services)
+	}
+	if options.Services[1].Ports.Min != 8000 || options.Services[1].Ports.Max != 8080 {
+		t.Errorf("unexpected port range %v", options.Services[1].Ports)
+	}
+	if options.Services[2].Protocol != packet.IPProtocolUDP {
+		t.Errorf("expected udp service, got %d", options.Services[2].Protocol)
+	}
+}
+
+func TestSystemdUnitServices(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		ports   []string
+		want    int
+		wantErr bool
+	}{
+		{"no ports", nil, 0, false},
+		{"tcp and udp ports", []string{"80/tcp", "53/udp", "443"}, 3, false},
+		{"bad protocol", []string{"80/sctp"}, 0, true},
+		{"bad format", []string{"80/tcp/udp"}, 0, true},
+		{"bad port", []string{"http"}, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			services, err := SystemdUnitServices(tt.ports)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SystemdUnitServices() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && len(services) != tt.want {
+				t.Errorf("SystemdUnitServices() = %v, want %d services", services, tt.want)
+			}
+		})
+	}
+}
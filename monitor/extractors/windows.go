@@ -52,6 +52,10 @@ func WindowsServiceEventMetadataExtractor(event *common.EventInfo) (*policy.PURu
 		runtimeTags.AppendKeyValue("@app:windows:filechecksum", hex.EncodeToString(fileMd5))
 	}
 
+	if fileSha256, err := ComputeFileSha256(event.Executable); err == nil {
+		runtimeTags.AppendKeyValue("@app:windows:filechecksum:sha256", hex.EncodeToString(fileSha256))
+	}
+
 	depends := getDllImports(event.Name)
 	for _, lib := range depends {
 		runtimeTags.AppendKeyValue("@app:windows:lib:"+lib, "true")
@@ -0,0 +1,247 @@
+package containerdmonitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/containerd/containerd"
+	apievents "github.com/containerd/containerd/api/events"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/events"
+	"github.com/containerd/containerd/namespaces"
+	"github.com/containerd/typeurl"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"go.aporeto.io/enforcerd/trireme-lib/monitor/extractors"
+	"go.uber.org/zap"
+)
+
+// containerdClient implements ContainerdClientInterface on top of the
+// containerd client.
+type containerdClient struct {
+	client *containerd.Client
+}
+
+// newContainerdClient connects to containerd on the given socket.
+func newContainerdClient(socketAddress string) (ContainerdClientInterface, error) {
+
+	client, err := containerd.New(socketAddress)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create containerd client: %s", err)
+	}
+
+	return &containerdClient{client: client}, nil
+}
+
+// Subscribe returns the task events of the given namespace. The events
+// that do not concern the init process of a container are dropped.
+func (c *containerdClient) Subscribe(ctx context.Context, namespace string) (<-chan *Event, <-chan error) {
+
+	eventCh := make(chan *Event)
+	errCh := make(chan error, 1)
+
+	envelopes, errs := c.client.Subscribe(ctx, fmt.Sprintf(`namespace==%s,topic~="^/tasks/"`, namespace))
+
+	go func() {
+		for {
+			select {
+			case envelope, ok := <-envelopes:
+				if !ok {
+					errCh <- io.EOF
+					return
+				}
+				event, err := eventFromEnvelope(envelope)
+				if err != nil {
+					zap.L().Debug("Ignoring containerd event", zap.Error(err))
+					continue
+				}
+				select {
+				case eventCh <- event:
+				case <-ctx.Done():
+					return
+				}
+
+			case err := <-errs:
+				if err == nil {
+					err = io.EOF
+				}
+				errCh <- err
+				return
+
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return eventCh, errCh
+}
+
+// ListContainers returns all the containers of the given namespace.
+func (c *containerdClient) ListContainers(ctx context.Context, namespace string) ([]*Container, error) {
+
+	ctx = namespaces.WithNamespace(ctx, namespace)
+
+	containers, err := c.client.Containers(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list containers: %s", err)
+	}
+
+	list := make([]*Container, 0, len(containers))
+	for _, container := range containers {
+		ct, err := containerFromClient(ctx, namespace, container)
+		if err != nil {
+			zap.L().Warn("Unable to read containerd container",
+				zap.String("id", container.ID()),
+				zap.Error(err),
+			)
+			continue
+		}
+		list = append(list, ct)
+	}
+
+	return list, nil
+}
+
+// GetContainer returns the container with the given ID.
+func (c *containerdClient) GetContainer(ctx context.Context, namespace string, id string) (*Container, error) {
+
+	ctx = namespaces.WithNamespace(ctx, namespace)
+
+	container, err := c.client.LoadContainer(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load container %s: %s", id, err)
+	}
+
+	return containerFromClient(ctx, namespace, container)
+}
+
+// Close closes the connection to containerd.
+func (c *containerdClient) Close() error {
+	return c.client.Close()
+}
+
+// containerFromClient builds the container information from the container
+// record, its OCI runtime spec and its task.
+func containerFromClient(ctx context.Context, namespace string, container containerd.Container) (*Container, error) {
+
+	info, err := container.Info(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	spec, err := container.Spec(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	hostNetwork, netnsPath := networkNamespace(spec)
+
+	ct := &Container{
+		Info: &extractors.ContainerdInfo{
+			ID:          info.ID,
+			Namespace:   namespace,
+			Image:       info.Image,
+			Labels:      info.Labels,
+			Annotations: spec.Annotations,
+			NetNSPath:   netnsPath,
+			HostNetwork: hostNetwork,
+		},
+		Status: StatusStopped,
+	}
+
+	task, err := container.Task(ctx, nil)
+	if err != nil {
+		if errdefs.IsNotFound(err) {
+			return ct, nil
+		}
+		return nil, err
+	}
+
+	status, err := task.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ct.Info.Pid = int(task.Pid())
+	ct.Status = taskStatus(status.Status)
+
+	return ct, nil
+}
+
+// networkNamespace returns true if the spec does not create a network namespace.
+// Otherwise it returns the path of the network namespace if the spec joins one.
+func networkNamespace(spec *specs.Spec) (bool, string) {
+
+	if spec == nil || spec.Linux == nil {
+		return true, ""
+	}
+
+	for _, ns := range spec.Linux.Namespaces {
+		if ns.Type == specs.NetworkNamespace {
+			return false, ns.Path
+		}
+	}
+
+	return true, ""
+}
+
+func taskStatus(status containerd.ProcessStatus) Status {
+
+	switch status {
+	case containerd.Running:
+		return StatusRunning
+	case containerd.Paused, containerd.Pausing:
+		return StatusPaused
+	case containerd.Created, containerd.Stopped:
+		return StatusStopped
+	default:
+		return StatusUnknown
+	}
+}
+
+// eventFromEnvelope decodes a task event. The events of exec processes
+// are rejected.
+func eventFromEnvelope(envelope *events.Envelope) (*Event, error) {
+
+	if envelope == nil || envelope.Event == nil {
+		return nil, errors.New("empty event")
+	}
+
+	v, err := typeurl.UnmarshalAny(envelope.Event)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode event %s: %s", envelope.Topic, err)
+	}
+
+	event := &Event{
+		Topic:     Topic(envelope.Topic),
+		Namespace: envelope.Namespace,
+	}
+
+	switch e := v.(type) {
+	case *apievents.TaskStart:
+		event.ContainerID = e.ContainerID
+		event.Pid = e.Pid
+	case *apievents.TaskExit:
+		if e.ID != e.ContainerID {
+			return nil, fmt.Errorf("exit of exec process %s in container %s", e.ID, e.ContainerID)
+		}
+		event.ContainerID = e.ContainerID
+		event.Pid = e.Pid
+	case *apievents.TaskDelete:
+		if e.ID != "" && e.ID != e.ContainerID {
+			return nil, fmt.Errorf("delete of exec process %s in container %s", e.ID, e.ContainerID)
+		}
+		event.ContainerID = e.ContainerID
+		event.Pid = e.Pid
+	case *apievents.TaskPaused:
+		event.ContainerID = e.ContainerID
+	case *apievents.TaskResumed:
+		event.ContainerID = e.ContainerID
+	default:
+		return nil, fmt.Errorf("unsupported event %s", envelope.Topic)
+	}
+
+	return event, nil
+}
@@ -0,0 +1,143 @@
+// +build linux
+
+package containerdmonitor
+
+import (
+	"testing"
+
+	apievents "github.com/containerd/containerd/api/events"
+	"github.com/containerd/containerd/events"
+	"github.com/containerd/typeurl"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+func testEnvelope(t *testing.T, topic string, v interface{}) *events.Envelope {
+
+	a, err := typeurl.MarshalAny(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &events.Envelope{
+		Namespace: "default",
+		Topic:     topic,
+		Event:     a,
+	}
+}
+
+func TestEventFromEnvelope(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		envelope *events.Envelope
+		want     *Event
+		wantErr  bool
+	}{
+		{
+			name:     "empty envelope",
+			envelope: &events.Envelope{Topic: "/tasks/start"},
+			wantErr:  true,
+		},
+		{
+			name:     "start",
+			envelope: testEnvelope(t, "/tasks/start", &apievents.TaskStart{ContainerID: "web", Pid: 10}),
+			want:     &Event{Topic: TopicTaskStart, Namespace: "default", ContainerID: "web", Pid: 10},
+		},
+		{
+			name:     "exit",
+			envelope: testEnvelope(t, "/tasks/exit", &apievents.TaskExit{ContainerID: "web", ID: "web", Pid: 10}),
+			want:     &Event{Topic: TopicTaskExit, Namespace: "default", ContainerID: "web", Pid: 10},
+		},
+		{
+			name:     "exec exit",
+			envelope: testEnvelope(t, "/tasks/exit", &apievents.TaskExit{ContainerID: "web", ID: "exec1", Pid: 11}),
+			wantErr:  true,
+		},
+		{
+			name:     "delete",
+			envelope: testEnvelope(t, "/tasks/delete", &apievents.TaskDelete{ContainerID: "web", Pid: 10}),
+			want:     &Event{Topic: TopicTaskDelete, Namespace: "default", ContainerID: "web", Pid: 10},
+		},
+		{
+			name:     "exec delete",
+			envelope: testEnvelope(t, "/tasks/delete", &apievents.TaskDelete{ContainerID: "web", ID: "exec1"}),
+			wantErr:  true,
+		},
+		{
+			name:     "paused",
+			envelope: testEnvelope(t, "/tasks/paused", &apievents.TaskPaused{ContainerID: "web"}),
+			want:     &Event{Topic: TopicTaskPaused, Namespace: "default", ContainerID: "web"},
+		},
+		{
+			name:     "resumed",
+			envelope: testEnvelope(t, "/tasks/resumed", &apievents.TaskResumed{ContainerID: "web"}),
+			want:     &Event{Topic: TopicTaskResumed, Namespace: "default", ContainerID: "web"},
+		},
+		{
+			name:     "unsupported",
+			envelope: testEnvelope(t, "/tasks/oom", &apievents.TaskOOM{ContainerID: "web"}),
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := eventFromEnvelope(tt.envelope)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("eventFromEnvelope() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if *got != *tt.want {
+				t.Errorf("eventFromEnvelope() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNetworkNamespace(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		spec        *specs.Spec
+		hostNetwork bool
+		path        string
+	}{
+		{
+			name:        "no linux spec",
+			spec:        &specs.Spec{},
+			hostNetwork: true,
+		},
+		{
+			name: "new namespace",
+			spec: &specs.Spec{Linux: &specs.Linux{Namespaces: []specs.LinuxNamespace{
+				{Type: specs.PIDNamespace},
+				{Type: specs.NetworkNamespace},
+			}}},
+		},
+		{
+			name: "joined namespace",
+			spec: &specs.Spec{Linux: &specs.Linux{Namespaces: []specs.LinuxNamespace{
+				{Type: specs.NetworkNamespace, Path: "/var/run/netns/cni-1"},
+			}}},
+			path: "/var/run/netns/cni-1",
+		},
+		{
+			name: "host network",
+			spec: &specs.Spec{Linux: &specs.Linux{Namespaces: []specs.LinuxNamespace{
+				{Type: specs.PIDNamespace},
+			}}},
+			hostNetwork: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hostNetwork, path := networkNamespace(tt.spec)
+			if hostNetwork != tt.hostNetwork || path != tt.path {
+				t.Errorf("networkNamespace() = %t %s, want %t %s", hostNetwork, path, tt.hostNetwork, tt.path)
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package containerdmonitor
+
+import (
+	"go.aporeto.io/enforcerd/trireme-lib/monitor/constants"
+	"go.aporeto.io/enforcerd/trireme-lib/monitor/extractors"
+)
+
+// Config is the configuration options to start a containerd monitor
+type Config struct {
+	EventMetadataExtractor   extractors.ContainerdMetadataExtractor
+	SocketAddress            string
+	Namespace                string
+	SyncAtStart              bool
+	DestroyStoppedContainers bool
+	IgnoreHostNetwork        bool
+}
+
+// DefaultConfig provides a default configuration
+func DefaultConfig() *Config {
+	return &Config{
+		EventMetadataExtractor: extractors.DefaultContainerdMetadataExtractor,
+		SocketAddress:          constants.DefaultContainerdSocket,
+		Namespace:              constants.DefaultContainerdNamespace,
+		SyncAtStart:            true,
+		IgnoreHostNetwork:      true,
+	}
+}
+
+// SetupDefaultConfig adds defaults to a partial configuration
+func SetupDefaultConfig(containerdConfig *Config) *Config {
+
+	defaultConfig := DefaultConfig()
+
+	if containerdConfig.EventMetadataExtractor == nil {
+		containerdConfig.EventMetadataExtractor = defaultConfig.EventMetadataExtractor
+	}
+	if containerdConfig.SocketAddress == "" {
+		containerdConfig.SocketAddress = defaultConfig.SocketAddress
+	}
+	if containerdConfig.Namespace == "" {
+		containerdConfig.Namespace = defaultConfig.Namespace
+	}
+	return containerdConfig
+}
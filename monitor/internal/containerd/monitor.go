@@ -0,0 +1,258 @@
+package containerdmonitor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"runtime"
+	"time"
+
+	"github.com/dchest/siphash"
+	"go.aporeto.io/enforcerd/trireme-lib/common"
+	"go.aporeto.io/enforcerd/trireme-lib/monitor/config"
+	"go.aporeto.io/enforcerd/trireme-lib/monitor/registerer"
+	"go.aporeto.io/enforcerd/trireme-lib/utils/cgnetcls"
+	"go.uber.org/zap"
+)
+
+// ContainerdMonitor implements the connection to containerd and monitoring
+// based on the task events of a containerd namespace.
+type ContainerdMonitor struct {
+	proc               *containerdProcessor
+	socketAddress      string
+	newClient          func(socketAddress string) (ContainerdClientInterface, error)
+	handlers           map[Topic]EventHandler
+	eventnotifications []chan *Event
+	numberOfQueues     int
+}
+
+// New returns a new containerd monitor.
+func New(context.Context) *ContainerdMonitor {
+	return &ContainerdMonitor{
+		proc:      &containerdProcessor{},
+		newClient: newContainerdClient,
+	}
+}
+
+// SetupConfig provides a configuration to implmentations. Every implementation
+// can have its own config type.
+func (c *ContainerdMonitor) SetupConfig(registerer registerer.Registerer, cfg interface{}) error {
+
+	if cfg == nil {
+		cfg = DefaultConfig()
+	}
+
+	containerdConfig, ok := cfg.(*Config)
+	if !ok {
+		return fmt.Errorf("Invalid configuration specified")
+	}
+
+	if registerer != nil {
+		if err := registerer.RegisterProcessor(common.ContainerPU, c.proc); err != nil {
+			return err
+		}
+	}
+
+	// Setup defaults
+	containerdConfig = SetupDefaultConfig(containerdConfig)
+
+	c.socketAddress = containerdConfig.SocketAddress
+	c.proc.metadataExtractor = containerdConfig.EventMetadataExtractor
+	c.proc.namespace = containerdConfig.Namespace
+	c.proc.syncAtStart = containerdConfig.SyncAtStart
+	c.proc.destroyStoppedContainers = containerdConfig.DestroyStoppedContainers
+	c.proc.ignoreHostNetwork = containerdConfig.IgnoreHostNetwork
+	// Host network containers are activated in the same cgroup
+	// hierarchy as the docker host network containers.
+	c.proc.netcls = cgnetcls.NewDockerCgroupNetController()
+
+	c.numberOfQueues = runtime.NumCPU()
+	c.eventnotifications = make([]chan *Event, c.numberOfQueues)
+	for i := 0; i < c.numberOfQueues; i++ {
+		c.eventnotifications[i] = make(chan *Event, 1000)
+	}
+
+	c.handlers = map[Topic]EventHandler{
+		TopicTaskStart:   c.eventHandler(c.proc.Start),
+		TopicTaskExit:    c.eventHandler(c.proc.Stop),
+		TopicTaskDelete:  c.eventHandler(c.proc.Destroy),
+		TopicTaskPaused:  c.eventHandler(c.proc.Pause),
+		TopicTaskResumed: c.eventHandler(c.proc.unpause),
+	}
+
+	return nil
+}
+
+// SetupHandlers sets up handlers for monitors to invoke for various events such as
+// processing unit events and synchronization events. This will be called before Start()
+// by the consumer of the monitor
+func (c *ContainerdMonitor) SetupHandlers(m *config.ProcessorConfig) {
+
+	c.proc.config = m
+}
+
+// Run starts listening to the containerd events. It returns once the
+// existing containers have been synced, or right away if containerd is not
+// reachable, in which case periodic retries are attempted.
+func (c *ContainerdMonitor) Run(ctx context.Context) error {
+
+	if err := c.proc.config.IsComplete(); err != nil {
+		return fmt.Errorf("containerd config issue: %s", err)
+	}
+
+	c.eventProcessors(ctx)
+
+	listenerReady := make(chan struct{})
+	go c.eventListener(ctx, listenerReady)
+	<-listenerReady
+
+	return nil
+}
+
+// Resync resyncs all the existing containers of the namespace.
+func (c *ContainerdMonitor) Resync(ctx context.Context) error {
+	return c.proc.Resync(ctx, nil)
+}
+
+// eventHandler converts a containerd event to the event of a processor
+// function.
+func (c *ContainerdMonitor) eventHandler(f func(context.Context, *common.EventInfo) error) EventHandler {
+	return func(ctx context.Context, event *Event) error {
+		return f(ctx, &common.EventInfo{
+			PUType: common.ContainerPU,
+			PUID:   event.ContainerID,
+			PID:    int32(event.Pid),
+		})
+	}
+}
+
+func (c *ContainerdMonitor) setupClient() error {
+
+	client, err := c.newClient(c.socketAddress)
+	if err != nil {
+		return err
+	}
+
+	c.proc.setContainerdClient(client)
+	return nil
+}
+
+// sendRequestToQueue sends a request to a channel based on a hash function.
+// This ensures that all the events of a container fall onto the same queue.
+func (c *ContainerdMonitor) sendRequestToQueue(event *Event) {
+
+	key0 := uint64(256203161)
+	key1 := uint64(982451653)
+
+	h := siphash.Hash(key0, key1, []byte(event.ContainerID))
+
+	c.eventnotifications[int(h%uint64(c.numberOfQueues))] <- event
+}
+
+// eventProcessors processes the containerd events. The queues are
+// processed in parallel.
+func (c *ContainerdMonitor) eventProcessors(ctx context.Context) {
+
+	for i := 0; i < c.numberOfQueues; i++ {
+		go func(i int) {
+			for {
+				select {
+				case event := <-c.eventnotifications[i]:
+					if f, ok := c.handlers[event.Topic]; ok {
+						if err := f(ctx, event); err != nil {
+							zap.L().Error("Unable to handle containerd event",
+								zap.String("topic", string(event.Topic)),
+								zap.String("id", event.ContainerID),
+								zap.Error(err),
+							)
+						}
+					}
+				case <-ctx.Done():
+					return
+				}
+			}
+		}(i)
+	}
+}
+
+// eventListener subscribes to the containerd events and passes them to the
+// processors. The containers are resynced every time a subscription is
+// established, since events may have been missed while disconnected.
+// listenerReady is closed after the first attempt to subscribe.
+func (c *ContainerdMonitor) eventListener(ctx context.Context, listenerReady chan struct{}) {
+
+	ready := listenerReady
+	signalReady := func() {
+		if ready != nil {
+			close(ready)
+			ready = nil
+		}
+	}
+	defer signalReady()
+
+	for {
+		if c.proc.containerdClient() == nil {
+			if err := c.setupClient(); err != nil {
+				zap.L().Debug("Unable to connect to containerd",
+					zap.String("socket", c.socketAddress),
+					zap.Error(err),
+				)
+				signalReady()
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(containerdRetryTimer):
+					continue
+				}
+			}
+		}
+
+		events, errs := c.proc.containerdClient().Subscribe(ctx, c.proc.namespace)
+
+		if err := c.Resync(ctx); err != nil {
+			zap.L().Error("Unable to resync containerd containers", zap.Error(err))
+		}
+		signalReady()
+
+		if !c.listener(ctx, events, errs) {
+			c.proc.setContainerdClient(nil)
+			return
+		}
+
+		c.proc.setContainerdClient(nil)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(containerdRetryTimer):
+		}
+	}
+}
+
+// listener dispatches the events until the stream fails. It returns
+// false if the context is done.
+func (c *ContainerdMonitor) listener(ctx context.Context, events <-chan *Event, errs <-chan error) bool {
+
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return true
+			}
+			zap.L().Debug("Got event from containerd",
+				zap.String("topic", string(event.Topic)),
+				zap.String("id", event.ContainerID),
+			)
+			c.sendRequestToQueue(event)
+
+		case err := <-errs:
+			if err != nil && err != io.EOF {
+				zap.L().Warn("Received containerd event error", zap.Error(err))
+			}
+			return true
+
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
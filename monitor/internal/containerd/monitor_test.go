@@ -0,0 +1,358 @@
+// +build linux
+
+package containerdmonitor
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.aporeto.io/enforcerd/trireme-lib/collector"
+	"go.aporeto.io/enforcerd/trireme-lib/common"
+	"go.aporeto.io/enforcerd/trireme-lib/monitor/config"
+	"go.aporeto.io/enforcerd/trireme-lib/monitor/extractors"
+	"go.aporeto.io/enforcerd/trireme-lib/monitor/registerer"
+	"go.aporeto.io/enforcerd/trireme-lib/policy"
+	"go.aporeto.io/enforcerd/trireme-lib/policy/mockpolicy"
+	"go.aporeto.io/enforcerd/trireme-lib/utils/cgnetcls/mockcgnetcls"
+)
+
+// fakeClient is a containerd client with a fake event stream.
+type fakeClient struct {
+	events     chan *Event
+	errs       chan error
+	containers map[string]*Container
+	subscribed chan struct{}
+	sync.Mutex
+}
+
+func newFakeClient(containers ...*Container) *fakeClient {
+
+	f := &fakeClient{
+		events:     make(chan *Event),
+		errs:       make(chan error, 1),
+		containers: map[string]*Container{},
+		subscribed: make(chan struct{}, 10),
+	}
+
+	for _, c := range containers {
+		f.containers[c.Info.ID] = c
+	}
+
+	return f
+}
+
+func (f *fakeClient) Subscribe(ctx context.Context, namespace string) (<-chan *Event, <-chan error) {
+	f.subscribed <- struct{}{}
+	return f.events, f.errs
+}
+
+func (f *fakeClient) ListContainers(ctx context.Context, namespace string) ([]*Container, error) {
+
+	f.Lock()
+	defer f.Unlock()
+
+	list := []*Container{}
+	for _, c := range f.containers {
+		if c.Info.Namespace == namespace {
+			list = append(list, c)
+		}
+	}
+
+	return list, nil
+}
+
+func (f *fakeClient) GetContainer(ctx context.Context, namespace string, id string) (*Container, error) {
+
+	f.Lock()
+	defer f.Unlock()
+
+	c, ok := f.containers[id]
+	if !ok || c.Info.Namespace != namespace {
+		return nil, errors.New("not found")
+	}
+
+	return c, nil
+}
+
+func (f *fakeClient) Close() error {
+	return nil
+}
+
+func testContainer(id string, status Status, hostNetwork bool) *Container {
+	return &Container{
+		Info: &extractors.ContainerdInfo{
+			ID:          id,
+			Namespace:   "default",
+			Image:       "docker.io/library/nginx:latest",
+			Labels:      map[string]string{"app": "web"},
+			Pid:         4242,
+			HostNetwork: hostNetwork,
+		},
+		Status: status,
+	}
+}
+
+func testMonitor(puHandler policy.Resolver, client ContainerdClientInterface, cfg *Config) *ContainerdMonitor {
+
+	c := New(context.Background())
+	c.newClient = func(string) (ContainerdClientInterface, error) {
+		if client == nil {
+			return nil, errors.New("containerd is down")
+		}
+		return client, nil
+	}
+	c.SetupHandlers(&config.ProcessorConfig{
+		Collector:  &collector.DefaultCollector{},
+		Policy:     puHandler,
+		ResyncLock: &sync.RWMutex{},
+	})
+	if err := c.SetupConfig(nil, cfg); err != nil {
+		return nil
+	}
+
+	return c
+}
+
+func TestSetupConfig(t *testing.T) {
+
+	Convey("Given a containerd monitor", t, func() {
+		c := New(context.Background())
+
+		Convey("When I provide an invalid config, I should get an error", func() {
+			So(c.SetupConfig(nil, "invalid"), ShouldNotBeNil)
+		})
+
+		Convey("When I provide no config, the defaults should be used", func() {
+			So(c.SetupConfig(nil, nil), ShouldBeNil)
+			So(c.socketAddress, ShouldEqual, "/run/containerd/containerd.sock")
+			So(c.proc.namespace, ShouldEqual, "default")
+			So(c.proc.syncAtStart, ShouldBeTrue)
+			So(c.proc.ignoreHostNetwork, ShouldBeTrue)
+			So(c.proc.metadataExtractor, ShouldNotBeNil)
+		})
+
+		Convey("When I provide a registerer, the processor should be registered for containers", func() {
+			r := registerer.New()
+			So(c.SetupConfig(r, &Config{Namespace: "apps"}), ShouldBeNil)
+			So(c.proc.namespace, ShouldEqual, "apps")
+
+			_, err := r.GetHandler(common.ContainerPU, common.EventStart)
+			So(err, ShouldBeNil)
+
+			Convey("A second registration should fail", func() {
+				So(New(context.Background()).SetupConfig(r, nil), ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestEventStream(t *testing.T) {
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	Convey("Given a running containerd monitor with a fake event stream", t, func() {
+		puHandler := mockpolicy.NewMockResolver(ctrl)
+		client := newFakeClient(testContainer("web", StatusRunning, false))
+
+		c := testMonitor(puHandler, client, &Config{SyncAtStart: false})
+		So(c, ShouldNotBeNil)
+
+		netcls := mockcgnetcls.NewMockCgroupnetcls(ctrl)
+		c.proc.netcls = netcls
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		So(c.Run(ctx), ShouldBeNil)
+		<-client.subscribed
+
+		puID, _ := puIDFromContainerID("default", "web")
+
+		done := make(chan common.Event, 10)
+		record := func(_ context.Context, _ string, event common.Event, _ policy.RuntimeReader) error {
+			done <- event
+			return nil
+		}
+
+		Convey("A start event should create and start the PU in its network namespace", func() {
+			var runtime policy.RuntimeReader
+			puHandler.EXPECT().HandlePUEvent(gomock.Any(), puID, common.EventCreate, gomock.Any()).DoAndReturn(record)
+			puHandler.EXPECT().HandlePUEvent(gomock.Any(), puID, common.EventStart, gomock.Any()).DoAndReturn(
+				func(ctx context.Context, id string, event common.Event, r policy.RuntimeReader) error {
+					runtime = r
+					return record(ctx, id, event, r)
+				})
+
+			client.events <- &Event{Topic: TopicTaskStart, Namespace: "default", ContainerID: "web", Pid: 4242}
+
+			So(<-done, ShouldEqual, common.EventCreate)
+			So(<-done, ShouldEqual, common.EventStart)
+			So(runtime.NSPath(), ShouldEqual, "/proc/4242/ns/net")
+			So(runtime.PUType(), ShouldEqual, common.ContainerPU)
+			tag, _ := runtime.Tag("@usr:app")
+			So(tag, ShouldEqual, "web")
+		})
+
+		Convey("Exit, pause, resume and delete events should be forwarded in order", func() {
+			gomock.InOrder(
+				puHandler.EXPECT().HandlePUEvent(gomock.Any(), puID, common.EventPause, gomock.Any()).DoAndReturn(record),
+				puHandler.EXPECT().HandlePUEvent(gomock.Any(), puID, common.EventUnpause, gomock.Any()).DoAndReturn(record),
+				puHandler.EXPECT().HandlePUEvent(gomock.Any(), puID, common.EventStop, gomock.Any()).DoAndReturn(record),
+				puHandler.EXPECT().HandlePUEvent(gomock.Any(), puID, common.EventDestroy, gomock.Any()).DoAndReturn(record),
+			)
+			netcls.EXPECT().DeleteCgroup(puID).Return(nil)
+
+			client.events <- &Event{Topic: TopicTaskPaused, Namespace: "default", ContainerID: "web"}
+			client.events <- &Event{Topic: TopicTaskResumed, Namespace: "default", ContainerID: "web"}
+			client.events <- &Event{Topic: TopicTaskExit, Namespace: "default", ContainerID: "web", Pid: 4242}
+			client.events <- &Event{Topic: TopicTaskDelete, Namespace: "default", ContainerID: "web", Pid: 4242}
+
+			So(<-done, ShouldEqual, common.EventPause)
+			So(<-done, ShouldEqual, common.EventUnpause)
+			So(<-done, ShouldEqual, common.EventStop)
+			So(<-done, ShouldEqual, common.EventDestroy)
+		})
+
+		Convey("A stream error should resubscribe", func() {
+			client.errs <- errors.New("stream broken")
+
+			select {
+			case <-client.subscribed:
+			case <-time.After(2 * containerdRetryTimer):
+				So("no resubscription", ShouldBeNil)
+			}
+		})
+	})
+}
+
+func TestResync(t *testing.T) {
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	Convey("Given containers in different states", t, func() {
+		puHandler := mockpolicy.NewMockResolver(ctrl)
+
+		running := testContainer("running", StatusRunning, false)
+		paused := testContainer("paused", StatusPaused, false)
+		stopped := testContainer("stopped", StatusStopped, false)
+		host := testContainer("host", StatusRunning, true)
+		other := testContainer("other", StatusRunning, false)
+		other.Info.Namespace = "k8s.io"
+
+		client := newFakeClient(running, paused, stopped, host, other)
+
+		runningID, _ := puIDFromContainerID("default", "running")
+		pausedID, _ := puIDFromContainerID("default", "paused")
+		stoppedID, _ := puIDFromContainerID("default", "stopped")
+		hostID, _ := puIDFromContainerID("default", "host")
+
+		Convey("When the monitor starts, the containers of the namespace should be synced", func() {
+			c := testMonitor(puHandler, client, nil)
+			So(c, ShouldNotBeNil)
+
+			puHandler.EXPECT().HandlePUEvent(gomock.Any(), runningID, common.EventStart, gomock.Any()).Return(nil)
+			puHandler.EXPECT().HandlePUEvent(gomock.Any(), pausedID, common.EventPause, gomock.Any()).Return(nil)
+			puHandler.EXPECT().HandlePUEvent(gomock.Any(), stoppedID, common.EventStop, gomock.Any()).Return(nil)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			So(c.Run(ctx), ShouldBeNil)
+		})
+
+		Convey("When host network containers are not ignored, their cgroup should be programmed", func() {
+			c := testMonitor(puHandler, client, &Config{SyncAtStart: true, DestroyStoppedContainers: true})
+			So(c, ShouldNotBeNil)
+
+			netcls := mockcgnetcls.NewMockCgroupnetcls(ctrl)
+			c.proc.netcls = netcls
+			c.proc.setContainerdClient(client)
+
+			puHandler.EXPECT().HandlePUEvent(gomock.Any(), runningID, common.EventStart, gomock.Any()).Return(nil)
+			puHandler.EXPECT().HandlePUEvent(gomock.Any(), pausedID, common.EventPause, gomock.Any()).Return(nil)
+			puHandler.EXPECT().HandlePUEvent(gomock.Any(), hostID, common.EventStart, gomock.Any()).DoAndReturn(
+				func(_ context.Context, _ string, _ common.Event, r policy.RuntimeReader) error {
+					So(r.PUType(), ShouldEqual, common.LinuxProcessPU)
+					return nil
+				})
+			netcls.EXPECT().Creategroup(hostID).Return(nil)
+			netcls.EXPECT().AssignMark(hostID, gomock.Any()).Return(nil)
+			netcls.EXPECT().AddProcess(hostID, 4242).Return(nil)
+
+			So(c.Resync(context.Background()), ShouldBeNil)
+		})
+
+		Convey("When there is no client, resync should fail", func() {
+			c := testMonitor(puHandler, nil, nil)
+			So(c, ShouldNotBeNil)
+			So(c.Resync(context.Background()), ShouldNotBeNil)
+		})
+	})
+}
+
+func TestProcessorStart(t *testing.T) {
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	Convey("Given a containerd processor", t, func() {
+		puHandler := mockpolicy.NewMockResolver(ctrl)
+		client := newFakeClient(
+			testContainer("stopped", StatusStopped, false),
+			testContainer("host", StatusRunning, true),
+		)
+
+		c := testMonitor(puHandler, client, nil)
+		So(c, ShouldNotBeNil)
+		c.proc.setContainerdClient(client)
+
+		Convey("A start event for an unknown container should fail", func() {
+			So(c.proc.Start(context.Background(), &common.EventInfo{PUID: "unknown"}), ShouldNotBeNil)
+		})
+
+		Convey("A start event for a container that is not running should be ignored", func() {
+			So(c.proc.Start(context.Background(), &common.EventInfo{PUID: "stopped"}), ShouldBeNil)
+		})
+
+		Convey("A start event for an ignored host network container should be ignored", func() {
+			So(c.proc.Start(context.Background(), &common.EventInfo{PUID: "host"}), ShouldBeNil)
+		})
+
+		Convey("A policy error should be returned", func() {
+			client.containers["web"] = testContainer("web", StatusRunning, false)
+			puHandler.EXPECT().HandlePUEvent(gomock.Any(), gomock.Any(), common.EventCreate, gomock.Any()).Return(nil)
+			puHandler.EXPECT().HandlePUEvent(gomock.Any(), gomock.Any(), common.EventStart, gomock.Any()).Return(errors.New("policy"))
+			So(c.proc.Start(context.Background(), &common.EventInfo{PUID: "web"}), ShouldNotBeNil)
+		})
+	})
+}
+
+func TestPUIDFromContainerID(t *testing.T) {
+
+	Convey("Given container IDs", t, func() {
+
+		Convey("An empty ID should fail", func() {
+			_, err := puIDFromContainerID("default", "")
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("The same ID in different namespaces should give different PUIDs", func() {
+			id1, err := puIDFromContainerID("default", "web")
+			So(err, ShouldBeNil)
+			id2, err := puIDFromContainerID("other", "web")
+			So(err, ShouldBeNil)
+			So(len(id1), ShouldEqual, 12)
+			So(id1, ShouldNotEqual, id2)
+
+			id3, _ := puIDFromContainerID("default", "web")
+			So(id3, ShouldEqual, id1)
+		})
+	})
+}
@@ -0,0 +1,354 @@
+package containerdmonitor
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"go.aporeto.io/enforcerd/trireme-lib/common"
+	"go.aporeto.io/enforcerd/trireme-lib/monitor/config"
+	"go.aporeto.io/enforcerd/trireme-lib/monitor/extractors"
+	"go.aporeto.io/enforcerd/trireme-lib/policy"
+	"go.aporeto.io/enforcerd/trireme-lib/utils/cgnetcls"
+	"go.uber.org/zap"
+)
+
+// containerdProcessor processes the events of the containers of a containerd
+// namespace. It implements the processor interface so that container events
+// can also be received over the rpc monitor. The PUID of these events is the
+// containerd container ID.
+type containerdProcessor struct {
+	config                   *config.ProcessorConfig
+	metadataExtractor        extractors.ContainerdMetadataExtractor
+	netcls                   cgnetcls.Cgroupnetcls
+	namespace                string
+	syncAtStart              bool
+	destroyStoppedContainers bool
+	ignoreHostNetwork        bool
+
+	client     ContainerdClientInterface
+	clientLock sync.Mutex
+}
+
+func (p *containerdProcessor) containerdClient() ContainerdClientInterface {
+	p.clientLock.Lock()
+	defer p.clientLock.Unlock()
+	return p.client
+}
+
+func (p *containerdProcessor) setContainerdClient(client ContainerdClientInterface) {
+	p.clientLock.Lock()
+	defer p.clientLock.Unlock()
+
+	if p.client != nil && p.client != client {
+		if err := p.client.Close(); err != nil {
+			zap.L().Debug("Unable to close containerd client", zap.Error(err))
+		}
+	}
+	p.client = client
+}
+
+// Create handles create events
+func (p *containerdProcessor) Create(ctx context.Context, eventInfo *common.EventInfo) error {
+
+	container, runtime, err := p.retrieveContainer(ctx, eventInfo.PUID)
+	if err != nil {
+		return err
+	}
+
+	if container.Info.HostNetwork && p.ignoreHostNetwork {
+		return nil
+	}
+
+	puID, err := puIDFromContainerID(p.namespace, eventInfo.PUID)
+	if err != nil {
+		return err
+	}
+
+	return p.config.Policy.HandlePUEvent(ctx, puID, common.EventCreate, runtime)
+}
+
+// Start handles start events. The task of the container must be running.
+func (p *containerdProcessor) Start(ctx context.Context, eventInfo *common.EventInfo) error {
+
+	container, runtime, err := p.retrieveContainer(ctx, eventInfo.PUID)
+	if err != nil {
+		return err
+	}
+
+	if container.Status != StatusRunning {
+		return nil
+	}
+
+	if container.Info.HostNetwork && p.ignoreHostNetwork {
+		zap.L().Debug("Ignoring host network container", zap.String("id", eventInfo.PUID))
+		return nil
+	}
+
+	puID, err := puIDFromContainerID(p.namespace, eventInfo.PUID)
+	if err != nil {
+		return err
+	}
+
+	if err = p.config.Policy.HandlePUEvent(ctx, puID, common.EventCreate, runtime); err != nil {
+		return fmt.Errorf("unable to create pu for container %s: %s", eventInfo.PUID, err)
+	}
+
+	if err = p.config.Policy.HandlePUEvent(ctx, puID, common.EventStart, runtime); err != nil {
+		return fmt.Errorf("unable to set policy: container %s kept alive per policy: %s", eventInfo.PUID, err)
+	}
+
+	if container.Info.HostNetwork {
+		if err = p.setupHostMode(puID, runtime, container.Info.Pid); err != nil {
+			return fmt.Errorf("unable to setup host mode for container %s: %s", eventInfo.PUID, err)
+		}
+	}
+
+	return nil
+}
+
+// Stop handles stop events
+func (p *containerdProcessor) Stop(ctx context.Context, eventInfo *common.EventInfo) error {
+
+	puID, err := puIDFromContainerID(p.namespace, eventInfo.PUID)
+	if err != nil {
+		return err
+	}
+
+	runtime := policy.NewPURuntimeWithDefaults()
+
+	if err := p.config.Policy.HandlePUEvent(ctx, puID, common.EventStop, runtime); err != nil && !p.destroyStoppedContainers {
+		return err
+	}
+
+	if p.destroyStoppedContainers {
+		return p.Destroy(ctx, eventInfo)
+	}
+
+	return nil
+}
+
+// Destroy handles destroy events
+func (p *containerdProcessor) Destroy(ctx context.Context, eventInfo *common.EventInfo) error {
+
+	puID, err := puIDFromContainerID(p.namespace, eventInfo.PUID)
+	if err != nil {
+		return err
+	}
+
+	runtime := policy.NewPURuntimeWithDefaults()
+
+	if err := p.config.Policy.HandlePUEvent(ctx, puID, common.EventDestroy, runtime); err != nil {
+		zap.L().Error("Failed to handle delete event",
+			zap.String("id", eventInfo.PUID),
+			zap.Error(err),
+		)
+	}
+
+	if err := p.netcls.DeleteCgroup(puID); err != nil {
+		zap.L().Warn("Failed to clean netcls group",
+			zap.String("puID", puID),
+			zap.Error(err),
+		)
+	}
+
+	return nil
+}
+
+// Pause handles pause events
+func (p *containerdProcessor) Pause(ctx context.Context, eventInfo *common.EventInfo) error {
+
+	puID, err := puIDFromContainerID(p.namespace, eventInfo.PUID)
+	if err != nil {
+		return err
+	}
+
+	return p.config.Policy.HandlePUEvent(ctx, puID, common.EventPause, policy.NewPURuntimeWithDefaults())
+}
+
+// unpause handles resume events. They are not part of the processor interface.
+func (p *containerdProcessor) unpause(ctx context.Context, eventInfo *common.EventInfo) error {
+
+	puID, err := puIDFromContainerID(p.namespace, eventInfo.PUID)
+	if err != nil {
+		return err
+	}
+
+	return p.config.Policy.HandlePUEvent(ctx, puID, common.EventUnpause, policy.NewPURuntimeWithDefaults())
+}
+
+// Resync resyncs all the existing containers of the namespace, using the
+// same process as when a container is initially started.
+func (p *containerdProcessor) Resync(ctx context.Context, e *common.EventInfo) error {
+
+	if !p.syncAtStart || p.config.Policy == nil {
+		zap.L().Debug("No synchronization of containerd containers performed")
+		return nil
+	}
+
+	client := p.containerdClient()
+	if client == nil {
+		return errors.New("unable to resync: nil containerd client")
+	}
+
+	subctx, cancel := context.WithTimeout(ctx, containerdRequestTimeout)
+	containers, err := client.ListContainers(subctx, p.namespace)
+	cancel()
+	if err != nil {
+		return fmt.Errorf("unable to get container list: %s", err)
+	}
+
+	p.config.ResyncLock.RLock()
+	defer p.config.ResyncLock.RUnlock()
+
+	for _, container := range containers {
+		if err := p.resyncContainer(ctx, container); err != nil {
+			zap.L().Error("Unable to sync existing container",
+				zap.String("id", container.Info.ID),
+				zap.Error(err),
+			)
+		}
+	}
+
+	return nil
+}
+
+func (p *containerdProcessor) resyncContainer(ctx context.Context, container *Container) error {
+
+	if container.Info.HostNetwork && p.ignoreHostNetwork {
+		return nil
+	}
+
+	event := common.EventStop
+	switch container.Status {
+	case StatusRunning:
+		event = common.EventStart
+	case StatusPaused:
+		event = common.EventPause
+	default:
+		if p.destroyStoppedContainers {
+			return nil
+		}
+	}
+
+	puID, err := puIDFromContainerID(p.namespace, container.Info.ID)
+	if err != nil {
+		return err
+	}
+
+	runtime, err := p.metadataExtractor(container.Info)
+	if err != nil {
+		return err
+	}
+
+	if container.Info.HostNetwork {
+		setHostModeCgroupPath(puID, runtime)
+	}
+
+	if err := p.config.Policy.HandlePUEvent(ctx, puID, event, runtime); err != nil {
+		return err
+	}
+
+	if container.Info.HostNetwork && event == common.EventStart {
+		return p.setupHostMode(puID, runtime, container.Info.Pid)
+	}
+
+	return nil
+}
+
+// retrieveContainer reads the container from containerd and extracts its metadata.
+func (p *containerdProcessor) retrieveContainer(ctx context.Context, id string) (*Container, *policy.PURuntime, error) {
+
+	client := p.containerdClient()
+	if client == nil {
+		return nil, nil, errors.New("unable to get container info: nil containerd client")
+	}
+
+	subctx, cancel := context.WithTimeout(ctx, containerdRequestTimeout)
+	defer cancel()
+
+	container, err := client.GetContainer(subctx, p.namespace, id)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to read container information: container %s kept alive per policy: %s", id, err)
+	}
+
+	runtime, err := p.metadataExtractor(container.Info)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if container.Info.HostNetwork {
+		puID, err := puIDFromContainerID(p.namespace, id)
+		if err != nil {
+			return nil, nil, err
+		}
+		setHostModeCgroupPath(puID, runtime)
+	}
+
+	return container, runtime, nil
+}
+
+// setHostModeCgroupPath sets the path of the cgroup that setupHostMode
+// creates for a host network container. The PU is matched on this path with
+// cgroup v2.
+func setHostModeCgroupPath(puID string, runtime *policy.PURuntime) {
+
+	if !cgnetcls.IsCgroupV2() {
+		return
+	}
+
+	options := runtime.Options()
+	options.CgroupPath = cgnetcls.CgroupV2Path(common.TriremeDockerHostNetwork, puID)
+	runtime.SetOptions(options)
+}
+
+// setupHostMode sets up the net_cls cgroup for the host network containers
+func (p *containerdProcessor) setupHostMode(puID string, runtimeInfo policy.RuntimeReader, pid int) (err error) {
+
+	if err = p.netcls.Creategroup(puID); err != nil {
+		return err
+	}
+
+	// Clean the cgroup on exit, if we have failed to activate.
+	defer func() {
+		if err != nil {
+			if derr := p.netcls.DeleteCgroup(puID); derr != nil {
+				zap.L().Warn("Failed to clean cgroup",
+					zap.String("puID", puID),
+					zap.Error(derr),
+					zap.Error(err),
+				)
+			}
+		}
+	}()
+
+	markval := runtimeInfo.Options().CgroupMark
+	if markval == "" {
+		return errors.New("mark value not found")
+	}
+
+	mark, _ := strconv.ParseUint(markval, 10, 32)
+	if err = p.netcls.AssignMark(puID, mark); err != nil {
+		return err
+	}
+
+	return p.netcls.AddProcess(puID, pid)
+}
+
+// puIDFromContainerID generates the PUID of a container. Containerd IDs are
+// only unique within a namespace and can be long, so the PUID is derived
+// from a hash of the namespace and the ID.
+func puIDFromContainerID(namespace, id string) (string, error) {
+
+	if id == "" {
+		return "", errors.New("unable to generate context id: empty container id")
+	}
+
+	hash := sha256.Sum256([]byte(namespace + "/" + id))
+
+	return hex.EncodeToString(hash[:])[:12], nil
+}
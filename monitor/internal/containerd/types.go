@@ -0,0 +1,78 @@
+package containerdmonitor
+
+import (
+	"context"
+	"time"
+
+	"go.aporeto.io/enforcerd/trireme-lib/monitor/extractors"
+)
+
+// Topic is the topic of a containerd event.
+type Topic string
+
+const (
+	// TopicTaskStart represents the containerd "/tasks/start" event.
+	TopicTaskStart Topic = "/tasks/start"
+
+	// TopicTaskExit represents the containerd "/tasks/exit" event.
+	TopicTaskExit Topic = "/tasks/exit"
+
+	// TopicTaskDelete represents the containerd "/tasks/delete" event.
+	TopicTaskDelete Topic = "/tasks/delete"
+
+	// TopicTaskPaused represents the containerd "/tasks/paused" event.
+	TopicTaskPaused Topic = "/tasks/paused"
+
+	// TopicTaskResumed represents the containerd "/tasks/resumed" event.
+	TopicTaskResumed Topic = "/tasks/resumed"
+
+	// containerdRetryTimer is the time after which we will retry to connect to containerd.
+	containerdRetryTimer = 2 * time.Second
+
+	// containerdRequestTimeout is the timeout of the requests to containerd.
+	containerdRequestTimeout = 5 * time.Second
+)
+
+// Status is the status of the task of a container.
+type Status string
+
+// Values of the task status.
+const (
+	StatusRunning Status = "running"
+	StatusPaused  Status = "paused"
+	StatusStopped Status = "stopped"
+	StatusUnknown Status = "unknown"
+)
+
+// Event is a decoded containerd task event.
+type Event struct {
+	Topic       Topic
+	Namespace   string
+	ContainerID string
+	Pid         uint32
+}
+
+// Container is a containerd container with the status of its task.
+type Container struct {
+	Info   *extractors.ContainerdInfo
+	Status Status
+}
+
+// A EventHandler is type of containerd event handler functions.
+type EventHandler func(ctx context.Context, event *Event) error
+
+// ContainerdClientInterface is the interface to containerd used by the monitor,
+// so that we can do tests with a fake event stream.
+type ContainerdClientInterface interface {
+	// Subscribe returns the task events of the given namespace.
+	Subscribe(ctx context.Context, namespace string) (<-chan *Event, <-chan error)
+
+	// ListContainers returns all the containers of the given namespace.
+	ListContainers(ctx context.Context, namespace string) ([]*Container, error)
+
+	// GetContainer returns the container with the given ID.
+	GetContainer(ctx context.Context, namespace string, id string) (*Container, error)
+
+	// Close closes the connection to containerd.
+	Close() error
+}
@@ -379,7 +379,7 @@ func (d *DockerMonitor) resyncContainersByOrder(ctx context.Context, containers
 		// If it is a host container, we need to activate it as a Linux process. We will
 		// override the options that the metadata extractor provided.
 		if container.HostConfig.NetworkMode == constants.DockerHostMode {
-			options := hostModeOptions(&container)
+			options := hostModeOptions(puID, &container)
 			options.PolicyExtensions = runtime.Options().PolicyExtensions
 			runtime.SetOptions(*options)
 			runtime.SetPUType(common.LinuxProcessPU)
@@ -498,7 +498,7 @@ func (d *DockerMonitor) handleCreateEvent(ctx context.Context, event *events.Mes
 	// override the options that the metadata extractor provided. We will maintain
 	// any policy extensions in the object.
 	if container.HostConfig.NetworkMode == constants.DockerHostMode {
-		options := hostModeOptions(container)
+		options := hostModeOptions(puID, container)
 		options.PolicyExtensions = runtime.Options().PolicyExtensions
 		runtime.SetOptions(*options)
 		runtime.SetPUType(common.LinuxProcessPU)
@@ -536,7 +536,7 @@ func (d *DockerMonitor) handleStartEvent(ctx context.Context, event *events.Mess
 	// If it is a host container, we need to activate it as a Linux process. We will
 	// override the options that the metadata extractor provided.
 	if container.HostConfig.NetworkMode == constants.DockerHostMode {
-		options := hostModeOptions(container)
+		options := hostModeOptions(puID, container)
 		options.PolicyExtensions = runtime.Options().PolicyExtensions
 		runtime.SetOptions(*options)
 		runtime.SetPUType(common.LinuxProcessPU)
@@ -740,8 +740,9 @@ func (d *DockerMonitor) waitForDockerDaemon(ctx context.Context) (err error) {
 }
 
 // hostModeOptions creates the default options for a host-mode container. The
-// container must be activated as a Linux Process.
-func hostModeOptions(dockerInfo *types.ContainerJSON) *policy.OptionsType {
+// container must be activated as a Linux Process. With cgroup v2 it is matched
+// on the path of the cgroup that is created for it by setupHostMode.
+func hostModeOptions(puID string, dockerInfo *types.ContainerJSON) *policy.OptionsType {
 
 	options := policy.OptionsType{
 		CgroupName:        strconv.Itoa(dockerInfo.State.Pid),
@@ -750,6 +751,10 @@ func hostModeOptions(dockerInfo *types.ContainerJSON) *policy.OptionsType {
 		AutoPort:          true,
 	}
 
+	if cgnetcls.IsCgroupV2() {
+		options.CgroupPath = cgnetcls.CgroupV2Path(common.TriremeDockerHostNetwork, puID)
+	}
+
 	for p := range dockerInfo.Config.ExposedPorts {
 		if p.Proto() == "tcp" {
 			s, err := portspec.NewPortSpecFromString(p.Port(), nil)
@@ -11,6 +11,10 @@ type Config struct { // nolint
 	Kubeconfig string
 	Nodename   string
 
+	// WatchServices adds the ClusterIP services of the cluster to the
+	// dependent services of the PUs.
+	WatchServices bool
+
 	CRIRuntimeService criapi.RuntimeService
 
 	MetadataExtractor extractors.PodMetadataExtractor
@@ -23,6 +27,7 @@ func DefaultConfig() *Config {
 		CRIRuntimeService: nil,
 		Kubeconfig:        "",
 		Nodename:          "",
+		WatchServices:     false,
 	}
 }
 
@@ -3,10 +3,12 @@ package k8smonitor
 import (
 	"context"
 	"fmt"
+	"reflect"
 
 	"go.aporeto.io/enforcerd/internal/extractors/containermetadata"
 	"go.aporeto.io/enforcerd/trireme-lib/common"
 	"go.aporeto.io/enforcerd/trireme-lib/monitor/external"
+	"go.aporeto.io/enforcerd/trireme-lib/policy"
 
 	"go.uber.org/zap"
 
@@ -85,6 +87,7 @@ func (m *K8sMonitor) startEvent(ctx context.Context, kmd containermetadata.Commo
 		if err != nil {
 			return err
 		}
+		m.decorateRuntime(runtime)
 		if err := m.runtimeCache.Set(kmd.ID(), runtime); err != nil {
 			return err
 		}
@@ -167,6 +170,7 @@ func (m *K8sMonitor) updateEvent(ctx context.Context, sandboxID string) error {
 	if err != nil {
 		return err
 	}
+	m.decorateRuntime(runtime)
 	if err := m.runtimeCache.Set(sandboxID, runtime); err != nil {
 		return err
 	}
@@ -175,6 +179,39 @@ func (m *K8sMonitor) updateEvent(ctx context.Context, sandboxID string) error {
 	return m.handlers.Policy.HandlePUEvent(ctx, sandboxID, common.EventUpdate, runtime)
 }
 
+// servicesEvent sends an update event with the current dependent services.
+// Unlike the updateEvent, it does not need to run the metadata extraction.
+// No event is sent if the services of the PU did not change.
+func (m *K8sMonitor) servicesEvent(ctx context.Context, sandboxID string) error {
+	zap.L().Debug("K8sMonitor: servicesEvent", zap.String("sandboxID", sandboxID))
+	cached := m.runtimeCache.Get(sandboxID)
+	if cached == nil {
+		// destroy event had been sent already, not a problem, simply return
+		zap.L().Debug("K8sMonitor: servicesEvent: sandbox not in runtime cache")
+		return nil
+	}
+
+	puRuntime, ok := cached.(*policy.PURuntime)
+	if !ok {
+		return fmt.Errorf("K8sMonitor: servicesEvent: unexpected runtime type: %T", cached)
+	}
+
+	// never modify the runtime that has been sent to the policy engine
+	runtime := puRuntime.Clone()
+	m.decorateRuntime(runtime)
+
+	previous, current := puRuntime.Options(), runtime.Options()
+	if reflect.DeepEqual(previous.DependentServices, current.DependentServices) && reflect.DeepEqual(previous.ServiceAddresses, current.ServiceAddresses) {
+		return nil
+	}
+
+	if err := m.runtimeCache.Set(sandboxID, runtime); err != nil {
+		return err
+	}
+
+	return m.handlers.Policy.HandlePUEvent(ctx, sandboxID, common.EventUpdate, runtime)
+}
+
 // getPod tries to get the pod from the internal informer cache first, and falls back to the Kubernetes API if that fails
 // the cache is being kept up-to-date by Kubernetes internals, we don't need to care about this
 // NOTE: do not confuse the informer cache with the podCache from this package!
@@ -142,6 +142,70 @@ func TestK8sMonitor_updateEvent(t *testing.T) {
 	}
 }
 
+func TestK8sMonitor_servicesEvent(t *testing.T) {
+	services := newServiceCache(nil)
+	services.setService(testService("web", "10.96.0.10", tcpPort(80, 8080)))
+
+	decorated := policy.NewPURuntimeWithDefaults()
+	services.Decorate(decorated)
+
+	tests := []struct {
+		name    string
+		wantErr bool
+		prepare func(t *testing.T, mocks *unitTestMonitorMocks)
+	}{
+		{
+			name:    "runtime not found for sandbox ID",
+			wantErr: false,
+			prepare: func(t *testing.T, mocks *unitTestMonitorMocks) {
+				mocks.runtimeCache.EXPECT().Get(gomock.Eq("sandboxID")).Return(nil).Times(1)
+			},
+		},
+		{
+			name:    "services of the PU did not change",
+			wantErr: false,
+			prepare: func(t *testing.T, mocks *unitTestMonitorMocks) {
+				mocks.runtimeCache.EXPECT().Get(gomock.Eq("sandboxID")).Return(decorated).Times(1)
+			},
+		},
+		{
+			name:    "services of the PU changed",
+			wantErr: false,
+			prepare: func(t *testing.T, mocks *unitTestMonitorMocks) {
+				mocks.runtimeCache.EXPECT().Get(gomock.Eq("sandboxID")).Return(policy.NewPURuntimeWithDefaults()).Times(1)
+				mocks.runtimeCache.EXPECT().Set(gomock.Eq("sandboxID"), gomock.Eq(decorated)).Return(nil).Times(1)
+				mocks.policy.EXPECT().HandlePUEvent(
+					gomock.Any(),
+					gomock.Eq("sandboxID"),
+					gomock.Eq(common.EventUpdate),
+					gomock.Eq(decorated),
+				).Return(nil).Times(1)
+			},
+		},
+		{
+			name:    "internal update failed",
+			wantErr: true,
+			prepare: func(t *testing.T, mocks *unitTestMonitorMocks) {
+				mocks.runtimeCache.EXPECT().Get(gomock.Eq("sandboxID")).Return(policy.NewPURuntimeWithDefaults()).Times(1)
+				mocks.runtimeCache.EXPECT().Set(gomock.Eq("sandboxID"), gomock.Eq(decorated)).Return(fmt.Errorf("error")).Times(1)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			m, mocks := newUnitTestMonitor(ctrl)
+			m.watchServices = true
+			m.serviceCache = services
+			tt.prepare(t, mocks)
+			if err := m.servicesEvent(context.Background(), "sandboxID"); (err != nil) != tt.wantErr {
+				t.Errorf("K8sMonitor.servicesEvent() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			ctrl.Finish()
+		})
+	}
+}
+
 func TestK8sMonitor_stopEvent(t *testing.T) {
 	type args struct {
 		ctx       context.Context
@@ -72,3 +72,17 @@ func (mr *MockruntimeCacheInterfaceMockRecorder) Set(sandboxID, runtime interfac
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Set", reflect.TypeOf((*MockruntimeCacheInterface)(nil).Set), sandboxID, runtime)
 }
+
+// List mocks base method
+func (m *MockruntimeCacheInterface) List() []string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "List")
+	ret0, _ := ret[0].([]string)
+	return ret0
+}
+
+// List indicates an expected call of List
+func (mr *MockruntimeCacheInterfaceMockRecorder) List() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockruntimeCacheInterface)(nil).List))
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"sync"
+	"time"
 
 	criapi "k8s.io/cri-api/pkg/apis"
 
@@ -13,6 +14,8 @@ import (
 	"go.aporeto.io/enforcerd/trireme-lib/monitor/constants"
 	"go.aporeto.io/enforcerd/trireme-lib/monitor/extractors"
 	"go.aporeto.io/enforcerd/trireme-lib/monitor/registerer"
+	"go.aporeto.io/enforcerd/trireme-lib/policy"
+	"go.uber.org/zap"
 	"k8s.io/client-go/kubernetes"
 	listersv1 "k8s.io/client-go/listers/core/v1"
 	"k8s.io/client-go/rest"
@@ -29,6 +32,9 @@ type K8sMonitor struct {
 	criRuntimeService                criapi.RuntimeService
 	podCache                         podCacheInterface
 	runtimeCache                     runtimeCacheInterface
+	serviceCache                     serviceCacheInterface
+	servicesChangedCh                chan struct{}
+	watchServices                    bool
 	startEventRetry                  startEventRetryFunc
 	cniInstalledOrRuncProxyStartedCh chan struct{}
 	cniInstalledOrRuncProxyStarted   bool
@@ -40,6 +46,8 @@ func New(ctx context.Context) *K8sMonitor {
 	m := &K8sMonitor{}
 	m.podCache = newPodCache(m.updateEvent)
 	m.runtimeCache = newRuntimeCache(ctx, m.stopEvent)
+	m.servicesChangedCh = make(chan struct{}, 1)
+	m.serviceCache = newServiceCache(m.servicesChanged)
 	m.cniInstalledOrRuncProxyStartedCh = make(chan struct{})
 	return m
 }
@@ -73,6 +81,7 @@ func (m *K8sMonitor) SetupConfig(_ registerer.Registerer, cfg interface{}) error
 	m.nodename = kubernetesconfig.Nodename
 	m.metadataExtractor = kubernetesconfig.MetadataExtractor
 	m.criRuntimeService = kubernetesconfig.CRIRuntimeService
+	m.watchServices = kubernetesconfig.WatchServices
 
 	// build kubernetes client config
 	var kubeCfg *rest.Config
@@ -122,6 +131,13 @@ func (m *K8sMonitor) Run(ctx context.Context) error {
 	// this also returns a pod lister which uses the same underlying cache as the informer
 	m.podLister = m.podCache.SetupInformer(ctx, m.kubeClient, m.nodename, defaultNeedsUpdate)
 
+	// setup the informers of the services before the first PU is started,
+	// so that it gets the dependent services right away
+	if m.watchServices {
+		m.serviceCache.SetupInformer(ctx, m.kubeClient)
+		go m.servicesLoop(ctx)
+	}
+
 	// register ourselves with the gRPC server to receive events
 	var registered bool
 	for _, evs := range m.handlers.ExternalEventSender {
@@ -145,6 +161,50 @@ func (m *K8sMonitor) Run(ctx context.Context) error {
 	return nil
 }
 
+// servicesSettleTime is the time the services loop waits for more changes
+// before it updates the PUs.
+var servicesSettleTime = time.Second
+
+// servicesChanged is called by the service cache when the dependent services
+// changed. It never blocks: the changes are coalesced by the services loop.
+func (m *K8sMonitor) servicesChanged() {
+	select {
+	case m.servicesChangedCh <- struct{}{}:
+	default:
+	}
+}
+
+// servicesLoop sends update events to the PUs when the dependent services
+// changed. Endpoints change often, so the changes are coalesced.
+func (m *K8sMonitor) servicesLoop(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-m.servicesChangedCh:
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(servicesSettleTime):
+		}
+
+		for _, sandboxID := range m.runtimeCache.List() {
+			if err := m.servicesEvent(ctx, sandboxID); err != nil {
+				zap.L().Error("K8sMonitor: failed to send services update event to policy engine", zap.String("sandboxID", sandboxID), zap.Error(err))
+			}
+		}
+	}
+}
+
+// decorateRuntime adds the dependent services to the runtime.
+func (m *K8sMonitor) decorateRuntime(runtime *policy.PURuntime) {
+	if m.watchServices && m.serviceCache != nil {
+		m.serviceCache.Decorate(runtime)
+	}
+}
+
 // Resync should resynchronize PUs. This should be done while starting up.
 func (m *K8sMonitor) Resync(ctx context.Context) error {
 	return nil
@@ -18,6 +18,7 @@ type runtimeCacheInterface interface {
 	Delete(sandboxID string)
 	Get(sandboxID string) policy.RuntimeReader
 	Set(sandboxID string, runtime policy.RuntimeReader) error
+	List() []string
 }
 
 var _ runtimeCacheInterface = &runtimeCache{}
@@ -159,6 +160,22 @@ func (c *runtimeCache) Set(sandboxID string, runtime policy.RuntimeReader) error
 	return nil
 }
 
+// List returns the sandbox IDs of the running runtimes.
+func (c *runtimeCache) List() []string {
+	if c == nil {
+		return nil
+	}
+	c.RLock()
+	defer c.RUnlock()
+	ids := make([]string, 0, len(c.runtimes))
+	for id, entry := range c.runtimes {
+		if entry.running {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
 func (c *runtimeCache) Delete(sandboxID string) {
 	if c == nil {
 		return
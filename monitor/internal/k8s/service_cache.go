@@ -0,0 +1,380 @@
+package k8smonitor
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"go.aporeto.io/enforcerd/trireme-lib/common"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/pkg/packet"
+	"go.aporeto.io/enforcerd/trireme-lib/policy"
+	"go.aporeto.io/enforcerd/trireme-lib/utils/portspec"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1beta1 "k8s.io/api/discovery/v1beta1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+type serviceCacheInterface interface {
+	SetupInformer(ctx context.Context, kubeClient kubernetes.Interface)
+	Decorate(runtime *policy.PURuntime)
+}
+
+var _ serviceCacheInterface = &serviceCache{}
+
+// serviceCache keeps the ClusterIP services of the cluster together with the
+// endpoints of their EndpointSlices. Every TCP port of a service becomes a
+// dependent service of the PUs: its network info is the ClusterIP and the
+// port of the service, and its private network info are the addresses and
+// the ports of its ready endpoints. The ID of the dependent services is the
+// namespace and the name of the Kubernetes service.
+//
+// The cache is updated incrementally: an event only recomputes the service
+// it belongs to, and changed is only called if the dependent services of this
+// service changed.
+type serviceCache struct {
+	services map[string]*serviceEntry
+	sync.RWMutex
+	changed func()
+}
+
+// serviceEntry is a service and its EndpointSlices. The slices can be known
+// before the service.
+type serviceEntry struct {
+	service   *corev1.Service
+	slices    map[string]*discoveryv1beta1.EndpointSlice
+	dependent policy.ApplicationServicesList
+	addresses []string
+}
+
+func newServiceCache(changed func()) *serviceCache {
+
+	return &serviceCache{
+		services: make(map[string]*serviceEntry),
+		changed:  changed,
+	}
+}
+
+func serviceKey(namespace, name string) string {
+	return namespace + "/" + name
+}
+
+// SetupInformer starts the informers of the services and of the EndpointSlices
+// and waits for their caches to sync.
+func (c *serviceCache) SetupInformer(ctx context.Context, kubeClient kubernetes.Interface) {
+
+	factory := informers.NewSharedInformerFactory(kubeClient, time.Hour*24)
+
+	servicesInformer := factory.Core().V1().Services().Informer()
+	servicesInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if svc, ok := obj.(*corev1.Service); ok {
+				c.setService(svc)
+			}
+		},
+		UpdateFunc: func(_, obj interface{}) {
+			if svc, ok := obj.(*corev1.Service); ok {
+				c.setService(svc)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if svc, ok := obj.(*corev1.Service); ok {
+				c.deleteService(svc)
+			}
+		},
+	})
+
+	slicesInformer := factory.Discovery().V1beta1().EndpointSlices().Informer()
+	slicesInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if slice, ok := obj.(*discoveryv1beta1.EndpointSlice); ok {
+				c.setSlice(slice)
+			}
+		},
+		UpdateFunc: func(_, obj interface{}) {
+			if slice, ok := obj.(*discoveryv1beta1.EndpointSlice); ok {
+				c.setSlice(slice)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if slice, ok := obj.(*discoveryv1beta1.EndpointSlice); ok {
+				c.deleteSlice(slice)
+			}
+		},
+	})
+
+	factory.Start(ctx.Done())
+
+	if !cache.WaitForNamedCacheSync("services", ctx.Done(), servicesInformer.HasSynced, slicesInformer.HasSynced) {
+		zap.L().Warn("K8sMonitor: serviceCache: waiting for caches timed out")
+	}
+}
+
+// Decorate sets the dependent services and the service addresses in the
+// options of the runtime. Every runtime gets its own copy of the services,
+// because the enforcer adds the addresses it learns to them.
+func (c *serviceCache) Decorate(runtime *policy.PURuntime) {
+
+	if c == nil || runtime == nil {
+		return
+	}
+
+	c.RLock()
+	keys := make([]string, 0, len(c.services))
+	for key := range c.services {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	dependent := policy.ApplicationServicesList{}
+	addresses := map[string][]string{}
+	for _, key := range keys {
+		entry := c.services[key]
+		for _, s := range entry.dependent {
+			dependent = append(dependent, copyApplicationService(s))
+		}
+		if len(entry.addresses) > 0 {
+			addresses[key] = append([]string{}, entry.addresses...)
+		}
+	}
+	c.RUnlock()
+
+	options := runtime.Options()
+	options.DependentServices = dependent
+	options.ServiceAddresses = addresses
+	runtime.SetOptions(options)
+}
+
+func (c *serviceCache) setService(svc *corev1.Service) {
+	c.update(serviceKey(svc.Namespace, svc.Name), func(entry *serviceEntry) {
+		entry.service = svc.DeepCopy()
+	})
+}
+
+func (c *serviceCache) deleteService(svc *corev1.Service) {
+	c.update(serviceKey(svc.Namespace, svc.Name), func(entry *serviceEntry) {
+		entry.service = nil
+	})
+}
+
+func (c *serviceCache) setSlice(slice *discoveryv1beta1.EndpointSlice) {
+	name, ok := slice.Labels[discoveryv1beta1.LabelServiceName]
+	if !ok {
+		return
+	}
+	c.update(serviceKey(slice.Namespace, name), func(entry *serviceEntry) {
+		entry.slices[slice.Name] = slice.DeepCopy()
+	})
+}
+
+func (c *serviceCache) deleteSlice(slice *discoveryv1beta1.EndpointSlice) {
+	name, ok := slice.Labels[discoveryv1beta1.LabelServiceName]
+	if !ok {
+		return
+	}
+	c.update(serviceKey(slice.Namespace, name), func(entry *serviceEntry) {
+		delete(entry.slices, slice.Name)
+	})
+}
+
+// update applies a change to the entry of a service and recomputes its
+// dependent services. changed is called if they changed.
+func (c *serviceCache) update(key string, change func(*serviceEntry)) {
+
+	c.Lock()
+
+	entry, ok := c.services[key]
+	if !ok {
+		entry = &serviceEntry{slices: map[string]*discoveryv1beta1.EndpointSlice{}}
+		c.services[key] = entry
+	}
+
+	change(entry)
+
+	dependent, addresses := entry.compute(key)
+	updated := !reflect.DeepEqual(dependent, entry.dependent) || !reflect.DeepEqual(addresses, entry.addresses)
+	entry.dependent, entry.addresses = dependent, addresses
+
+	if entry.service == nil && len(entry.slices) == 0 {
+		delete(c.services, key)
+	}
+
+	c.Unlock()
+
+	if updated && c.changed != nil {
+		c.changed()
+	}
+}
+
+// compute returns the dependent services and the endpoint addresses of a
+// service. Headless and ExternalName services have none.
+func (e *serviceEntry) compute(key string) (policy.ApplicationServicesList, []string) {
+
+	svc := e.service
+	if svc == nil || svc.Spec.Type == corev1.ServiceTypeExternalName || svc.Spec.ClusterIP == "" || svc.Spec.ClusterIP == corev1.ClusterIPNone {
+		return nil, nil
+	}
+
+	clusterIP := hostNetwork(svc.Spec.ClusterIP)
+	if clusterIP == "" {
+		return nil, nil
+	}
+
+	addresses := e.endpointAddresses()
+
+	var dependent policy.ApplicationServicesList
+	for _, port := range svc.Spec.Ports {
+		// The dependent services are handled by the TCP proxy.
+		if port.Protocol != "" && port.Protocol != corev1.ProtocolTCP {
+			continue
+		}
+
+		ports, err := portspec.NewPortSpec(uint16(port.Port), uint16(port.Port), nil)
+		if err != nil {
+			continue
+		}
+
+		s := &policy.ApplicationService{
+			ID:   key,
+			Type: policy.ServiceTCP,
+			NetworkInfo: &common.Service{
+				Ports:     ports,
+				Protocol:  packet.IPProtocolTCP,
+				Addresses: map[string]struct{}{clusterIP: {}},
+			},
+		}
+
+		if targetPorts := e.targetPorts(port); targetPorts != nil && len(addresses) > 0 {
+			s.PrivateNetworkInfo = &common.Service{
+				Ports:     targetPorts,
+				Protocol:  packet.IPProtocolTCP,
+				Addresses: map[string]struct{}{},
+			}
+			for _, addr := range addresses {
+				s.PrivateNetworkInfo.Addresses[hostNetwork(addr)] = struct{}{}
+			}
+		}
+
+		dependent = append(dependent, s)
+	}
+
+	return dependent, addresses
+}
+
+// endpointAddresses returns the sorted addresses of the ready endpoints.
+func (e *serviceEntry) endpointAddresses() []string {
+
+	found := map[string]struct{}{}
+
+	for _, slice := range e.slices {
+		if slice.AddressType != discoveryv1beta1.AddressTypeIPv4 && slice.AddressType != discoveryv1beta1.AddressTypeIPv6 {
+			continue
+		}
+		for _, endpoint := range slice.Endpoints {
+			if endpoint.Conditions.Ready != nil && !*endpoint.Conditions.Ready {
+				continue
+			}
+			for _, addr := range endpoint.Addresses {
+				if net.ParseIP(addr) != nil {
+					found[addr] = struct{}{}
+				}
+			}
+		}
+	}
+
+	if len(found) == 0 {
+		return nil
+	}
+
+	addresses := make([]string, 0, len(found))
+	for addr := range found {
+		addresses = append(addresses, addr)
+	}
+	sort.Strings(addresses)
+
+	return addresses
+}
+
+// targetPorts returns the range of the ports of the endpoints for a port of
+// the service. The named target ports can be different for every endpoint.
+func (e *serviceEntry) targetPorts(port corev1.ServicePort) *portspec.PortSpec {
+
+	var min, max int32
+
+	for _, slice := range e.slices {
+		for _, p := range slice.Ports {
+			if p.Port == nil || (p.Name != nil && *p.Name != port.Name) || (p.Name == nil && port.Name != "") {
+				continue
+			}
+			if p.Protocol != nil && *p.Protocol != corev1.ProtocolTCP {
+				continue
+			}
+			if min == 0 || *p.Port < min {
+				min = *p.Port
+			}
+			if *p.Port > max {
+				max = *p.Port
+			}
+		}
+	}
+
+	if min == 0 {
+		return nil
+	}
+
+	ports, err := portspec.NewPortSpec(uint16(min), uint16(max), nil)
+	if err != nil {
+		return nil
+	}
+
+	return ports
+}
+
+// hostNetwork returns the host network of an IP address.
+func hostNetwork(addr string) string {
+
+	ip := net.ParseIP(addr)
+	switch {
+	case ip == nil:
+		return ""
+	case ip.To4() != nil:
+		return ip.String() + "/32"
+	default:
+		return ip.String() + "/128"
+	}
+}
+
+func copyApplicationService(s *policy.ApplicationService) *policy.ApplicationService {
+
+	c := *s
+	c.NetworkInfo = copyCommonService(s.NetworkInfo)
+	c.PrivateNetworkInfo = copyCommonService(s.PrivateNetworkInfo)
+
+	return &c
+}
+
+func copyCommonService(s *common.Service) *common.Service {
+
+	if s == nil {
+		return nil
+	}
+
+	c := *s
+	c.Addresses = make(map[string]struct{}, len(s.Addresses))
+	for addr := range s.Addresses {
+		c.Addresses[addr] = struct{}{}
+	}
+
+	return &c
+}
@@ -0,0 +1,220 @@
+package k8smonitor
+
+import (
+	"reflect"
+	"testing"
+
+	"go.aporeto.io/enforcerd/trireme-lib/policy"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1beta1 "k8s.io/api/discovery/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func testService(name, clusterIP string, ports ...corev1.ServicePort) *corev1.Service {
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "default",
+		},
+		Spec: corev1.ServiceSpec{
+			Type:      corev1.ServiceTypeClusterIP,
+			ClusterIP: clusterIP,
+			Ports:     ports,
+		},
+	}
+}
+
+func testSlice(name, service string, port int32, ready bool, addresses ...string) *discoveryv1beta1.EndpointSlice {
+	protocol := corev1.ProtocolTCP
+	portName := ""
+	return &discoveryv1beta1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "default",
+			Labels:    map[string]string{discoveryv1beta1.LabelServiceName: service},
+		},
+		AddressType: discoveryv1beta1.AddressTypeIPv4,
+		Endpoints: []discoveryv1beta1.Endpoint{
+			{
+				Addresses:  addresses,
+				Conditions: discoveryv1beta1.EndpointConditions{Ready: &ready},
+			},
+		},
+		Ports: []discoveryv1beta1.EndpointPort{
+			{
+				Name:     &portName,
+				Protocol: &protocol,
+				Port:     &port,
+			},
+		},
+	}
+}
+
+func tcpPort(port int32, targetPort int) corev1.ServicePort {
+	return corev1.ServicePort{
+		Protocol:   corev1.ProtocolTCP,
+		Port:       port,
+		TargetPort: intstr.FromInt(targetPort),
+	}
+}
+
+type serviceSummary struct {
+	id          string
+	network     string
+	privateNets []string
+}
+
+func summarize(list policy.ApplicationServicesList) []serviceSummary {
+	var summaries []serviceSummary
+	for _, s := range list {
+		summary := serviceSummary{id: s.ID}
+		for addr := range s.NetworkInfo.Addresses {
+			summary.network = addr + ":" + s.NetworkInfo.Ports.String()
+		}
+		if s.PrivateNetworkInfo != nil {
+			for addr := range s.PrivateNetworkInfo.Addresses {
+				summary.privateNets = append(summary.privateNets, addr+":"+s.PrivateNetworkInfo.Ports.String())
+			}
+		}
+		summaries = append(summaries, summary)
+	}
+	return summaries
+}
+
+func Test_serviceCache_update(t *testing.T) {
+	tests := []struct {
+		name        string
+		events      func(c *serviceCache)
+		wantChanged int
+		want        []serviceSummary
+		wantAddrs   map[string][]string
+	}{
+		{
+			name: "service without endpoints",
+			events: func(c *serviceCache) {
+				c.setService(testService("web", "10.96.0.10", tcpPort(80, 8080)))
+			},
+			wantChanged: 1,
+			want: []serviceSummary{
+				{id: "default/web", network: "10.96.0.10/32:80"},
+			},
+			wantAddrs: map[string][]string{},
+		},
+		{
+			name: "endpoints known before the service",
+			events: func(c *serviceCache) {
+				c.setSlice(testSlice("web-1", "web", 8080, true, "172.17.0.2"))
+				c.setService(testService("web", "10.96.0.10", tcpPort(80, 8080)))
+			},
+			wantChanged: 1,
+			want: []serviceSummary{
+				{id: "default/web", network: "10.96.0.10/32:80", privateNets: []string{"172.17.0.2/32:8080"}},
+			},
+			wantAddrs: map[string][]string{"default/web": {"172.17.0.2"}},
+		},
+		{
+			name: "endpoints changes are incremental",
+			events: func(c *serviceCache) {
+				c.setService(testService("web", "10.96.0.10", tcpPort(80, 8080)))
+				c.setSlice(testSlice("web-1", "web", 8080, true, "172.17.0.2"))
+				c.setSlice(testSlice("web-1", "web", 8080, true, "172.17.0.2"))
+				c.setSlice(testSlice("web-2", "web", 8080, false, "172.17.0.3"))
+			},
+			wantChanged: 2,
+			want: []serviceSummary{
+				{id: "default/web", network: "10.96.0.10/32:80", privateNets: []string{"172.17.0.2/32:8080"}},
+			},
+			wantAddrs: map[string][]string{"default/web": {"172.17.0.2"}},
+		},
+		{
+			name: "deleted endpoints",
+			events: func(c *serviceCache) {
+				c.setService(testService("web", "10.96.0.10", tcpPort(80, 8080)))
+				c.setSlice(testSlice("web-1", "web", 8080, true, "172.17.0.2"))
+				c.deleteSlice(testSlice("web-1", "web", 8080, true, "172.17.0.2"))
+			},
+			wantChanged: 3,
+			want: []serviceSummary{
+				{id: "default/web", network: "10.96.0.10/32:80"},
+			},
+			wantAddrs: map[string][]string{},
+		},
+		{
+			name: "deleted service",
+			events: func(c *serviceCache) {
+				c.setService(testService("web", "10.96.0.10", tcpPort(80, 8080)))
+				c.deleteService(testService("web", "10.96.0.10", tcpPort(80, 8080)))
+			},
+			wantChanged: 2,
+			want:        nil,
+			wantAddrs:   map[string][]string{},
+		},
+		{
+			name: "headless service and UDP ports are skipped",
+			events: func(c *serviceCache) {
+				c.setService(testService("headless", corev1.ClusterIPNone, tcpPort(80, 8080)))
+				c.setService(testService("dns", "10.96.0.10", corev1.ServicePort{Protocol: corev1.ProtocolUDP, Port: 53}))
+			},
+			wantChanged: 0,
+			want:        nil,
+			wantAddrs:   map[string][]string{},
+		},
+		{
+			name: "slices without service name are ignored",
+			events: func(c *serviceCache) {
+				slice := testSlice("other", "", 8080, true, "172.17.0.2")
+				slice.Labels = nil
+				c.setSlice(slice)
+			},
+			wantChanged: 0,
+			want:        nil,
+			wantAddrs:   map[string][]string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changed := 0
+			c := newServiceCache(func() { changed++ })
+			tt.events(c)
+
+			if changed != tt.wantChanged {
+				t.Errorf("changed = %v, want %v", changed, tt.wantChanged)
+			}
+
+			runtime := policy.NewPURuntimeWithDefaults()
+			c.Decorate(runtime)
+			options := runtime.Options()
+			if got := summarize(options.DependentServices); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DependentServices = %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(options.ServiceAddresses, tt.wantAddrs) {
+				t.Errorf("ServiceAddresses = %v, want %v", options.ServiceAddresses, tt.wantAddrs)
+			}
+		})
+	}
+}
+
+func Test_serviceCache_Decorate(t *testing.T) {
+	c := newServiceCache(nil)
+	c.setService(testService("web", "10.96.0.10", tcpPort(80, 8080)))
+
+	first := policy.NewPURuntimeWithDefaults()
+	second := policy.NewPURuntimeWithDefaults()
+	c.Decorate(first)
+	c.Decorate(second)
+
+	// the enforcer adds the addresses it learns to the dependent services
+	first.Options().DependentServices[0].NetworkInfo.Addresses["10.96.0.11/32"] = struct{}{}
+
+	if got := len(second.Options().DependentServices[0].NetworkInfo.Addresses); got != 1 {
+		t.Errorf("the runtimes share their dependent services: got %d addresses, want 1", got)
+	}
+	if got := len(c.services["default/web"].dependent[0].NetworkInfo.Addresses); got != 1 {
+		t.Errorf("the runtime shares the dependent services of the cache: got %d addresses, want 1", got)
+	}
+
+	// a nil cache must be safe to use
+	var nilCache *serviceCache
+	nilCache.Decorate(first)
+}
@@ -18,10 +18,10 @@ type LinuxMonitor struct {
 }
 
 // New returns a new implmentation of a monitor implmentation
-func New(context.Context) *LinuxMonitor {
+func New(ctx context.Context) *LinuxMonitor {
 
 	return &LinuxMonitor{
-		proc: &linuxProcessor{},
+		proc: &linuxProcessor{ctx: ctx},
 	}
 }
 
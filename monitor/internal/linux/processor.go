@@ -7,6 +7,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"go.aporeto.io/enforcerd/trireme-lib/buildflags"
 	"go.aporeto.io/enforcerd/trireme-lib/collector"
@@ -31,12 +32,17 @@ var ignoreNames = map[string]*struct{}{
 // linuxProcessor captures all the monitor processor information
 // It implements the EventProcessor interface of the rpc monitor
 type linuxProcessor struct {
+	// ctx is the context of the monitor. The events of the PUs that are not
+	// sent in reply to a request use it, since the contexts of the requests
+	// end when they return.
+	ctx               context.Context
 	host              bool
 	config            *config.ProcessorConfig
 	metadataExtractor extractors.EventMetadataExtractor
 	netcls            cgnetcls.Cgroupnetcls
 	regStart          *regexp.Regexp
 	regStop           *regexp.Regexp
+	rekeyTimers       map[string]*time.Timer
 	sync.Mutex
 }
 
@@ -89,6 +95,14 @@ func (l *linuxProcessor) Start(ctx context.Context, eventInfo *common.EventInfo)
 		return err
 	}
 
+	// With cgroup v2 the PU is matched on the path of its cgroup, unless the
+	// extractor found an existing one.
+	if !eventInfo.HostService && cgnetcls.IsCgroupV2() && runtime.Options().CgroupPath == "" {
+		options := runtime.Options()
+		options.CgroupPath = cgnetcls.CgroupV2Path(common.TriremeCgroupPath, nativeID)
+		runtime.SetOptions(options)
+	}
+
 	// We need to send a create event to the policy engine.
 	if err = l.config.Policy.HandlePUEvent(ctx, nativeID, common.EventCreate, runtime); err != nil {
 		return fmt.Errorf("Unable to create PU: %s", err)
@@ -111,6 +125,8 @@ func (l *linuxProcessor) Start(ctx context.Context, eventInfo *common.EventInfo)
 		return fmt.Errorf("Failed to program cgroups: %s", err)
 	}
 
+	l.scheduleRekey(nativeID, eventInfo)
+
 	// Send the event to the collector.
 	l.config.Collector.CollectContainerEvent(&collector.ContainerRecord{
 		ContextID: eventInfo.PUID,
@@ -154,6 +170,8 @@ func (l *linuxProcessor) Destroy(ctx context.Context, eventInfo *common.EventInf
 		return err
 	}
 
+	l.cancelRekey(puID)
+
 	if puID == "/trireme" {
 		puID = strings.TrimLeft(puID, "/")
 		l.netcls.Deletebasepath(puID)
@@ -200,6 +218,71 @@ func (l *linuxProcessor) Destroy(ctx context.Context, eventInfo *common.EventInf
 	return nil
 }
 
+// scheduleRekey updates a PU when its SSH certificate expires, so that its
+// identity and its tokens do not carry the attributes of the certificate anymore.
+func (l *linuxProcessor) scheduleRekey(puID string, eventInfo *common.EventInfo) {
+
+	cert := eventInfo.SSHCertificate
+	if cert == nil || cert.ValidBefore.IsZero() {
+		return
+	}
+
+	l.Lock()
+	defer l.Unlock()
+
+	if l.rekeyTimers == nil {
+		l.rekeyTimers = map[string]*time.Timer{}
+	}
+
+	if timer, ok := l.rekeyTimers[puID]; ok {
+		timer.Stop()
+	}
+
+	l.rekeyTimers[puID] = time.AfterFunc(time.Until(cert.ValidBefore), func() {
+		l.rekey(puID, eventInfo)
+	})
+}
+
+// cancelRekey cancels the update of a PU when its SSH certificate expires.
+func (l *linuxProcessor) cancelRekey(puID string) {
+
+	l.Lock()
+	defer l.Unlock()
+
+	if timer, ok := l.rekeyTimers[puID]; ok {
+		timer.Stop()
+		delete(l.rekeyTimers, puID)
+	}
+}
+
+// rekey extracts the metadata of a PU again and sends an update event. It runs
+// with the context of the monitor, the context of the start event is gone.
+func (l *linuxProcessor) rekey(puID string, eventInfo *common.EventInfo) {
+
+	l.Lock()
+	delete(l.rekeyTimers, puID)
+	l.Unlock()
+
+	ctx := l.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	if ctx.Err() != nil {
+		return
+	}
+
+	runtime, err := l.metadataExtractor(eventInfo)
+	if err != nil {
+		zap.L().Warn("Unable to extract metadata of PU with expired SSH certificate", zap.String("puID", puID), zap.Error(err))
+		return
+	}
+
+	if err := l.config.Policy.HandlePUEvent(ctx, puID, common.EventUpdate, runtime); err != nil {
+		zap.L().Warn("Unable to update PU with expired SSH certificate", zap.String("puID", puID), zap.Error(err))
+	}
+}
+
 // Pause handles a pause event
 func (l *linuxProcessor) Pause(ctx context.Context, eventInfo *common.EventInfo) error {
 
@@ -271,10 +354,14 @@ func (l *linuxProcessor) Resync(ctx context.Context, e *common.EventInfo) error
 		puType := common.LinuxProcessPU
 
 		runtime.SetPUType(puType)
-		runtime.SetOptions(policy.OptionsType{
+		options := policy.OptionsType{
 			CgroupMark: strconv.FormatUint(cgnetcls.MarkVal(), 10),
 			CgroupName: cgroup,
-		})
+		}
+		if cgnetcls.IsCgroupV2() {
+			options.CgroupPath = cgnetcls.CgroupV2Path(common.TriremeCgroupPath, cgroup)
+		}
+		runtime.SetOptions(options)
 
 		// Processes are still alive. We should enforce policy.
 		if err := l.config.Policy.HandlePUEvent(ctx, cgroup, common.EventStart, runtime); err != nil {
@@ -9,6 +9,7 @@ import (
 	"os"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
 	. "github.com/smartystreets/goconvey/convey"
@@ -337,3 +338,65 @@ func TestResync(t *testing.T) {
 		})
 	})
 }
+
+func TestRekey(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	Convey("Given a valid processor", t, func() {
+		puHandler := mockpolicy.NewMockResolver(ctrl)
+		p := testLinuxProcessor(puHandler)
+
+		event := &common.EventInfo{
+			Name:   "PU",
+			PID:    1,
+			PUID:   "/pu",
+			PUType: common.LinuxProcessPU,
+			SSHCertificate: &common.SSHCertificateInfo{
+				Principals:  []string{"alice"},
+				ValidBefore: time.Now().Add(50 * time.Millisecond),
+			},
+		}
+
+		Convey("When the SSH certificate of the PU expires, I should get an update event", func() {
+			updated := make(chan struct{})
+			puHandler.EXPECT().HandlePUEvent(gomock.Any(), "/pu", common.EventUpdate, gomock.Any()).DoAndReturn(
+				func(ctx context.Context, puID string, event common.Event, runtime policy.RuntimeReader) error {
+					close(updated)
+					return nil
+				},
+			)
+
+			p.scheduleRekey("/pu", event)
+
+			select {
+			case <-updated:
+			case <-time.After(5 * time.Second):
+				t.Error("no update event")
+			}
+		})
+
+		Convey("When the monitor is stopped before the certificate expires, I should not get an update event", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			p.ctx = ctx
+			cancel()
+
+			p.scheduleRekey("/pu", event)
+
+			time.Sleep(100 * time.Millisecond)
+			p.Lock()
+			So(p.rekeyTimers, ShouldBeEmpty)
+			p.Unlock()
+		})
+
+		Convey("When the PU is destroyed before its certificate expires, I should not get an update event", func() {
+			p.scheduleRekey("/pu", event)
+			p.cancelRekey("/pu")
+
+			time.Sleep(100 * time.Millisecond)
+			p.Lock()
+			So(p.rekeyTimers, ShouldBeEmpty)
+			p.Unlock()
+		})
+	})
+}
@@ -0,0 +1,191 @@
+package podmanmonitor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"go.aporeto.io/enforcerd/trireme-lib/monitor/extractors"
+)
+
+// apiError is an error returned by the libpod API.
+type apiError struct {
+	StatusCode int
+	Message    string `json:"message"`
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("libpod api error %d: %s", e.StatusCode, e.Message)
+}
+
+// isNotFound returns true if the error is a libpod not found error.
+func isNotFound(err error) bool {
+	apiErr, ok := err.(*apiError)
+	return ok && apiErr.StatusCode == http.StatusNotFound
+}
+
+// podmanClient is a client of the libpod REST API over a unix socket.
+type podmanClient struct {
+	client *http.Client
+}
+
+// newPodmanClient returns a client of the podman service listening on the
+// given unix socket.
+func newPodmanClient(socketAddress string) *podmanClient {
+
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socketAddress)
+		},
+	}
+
+	return &podmanClient{
+		client: &http.Client{Transport: transport},
+	}
+}
+
+// do sends a GET request to the libpod API and returns the response if the
+// request succeeded. The caller must close the body of the response.
+func (c *podmanClient) do(ctx context.Context, path string, query url.Values) (*http.Response, error) {
+
+	u := url.URL{
+		Scheme:   "http",
+		Host:     "podman",
+		Path:     libpodAPIPrefix + path,
+		RawQuery: query.Encode(),
+	}
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close() // nolint: errcheck
+
+		apiErr := &apiError{}
+		data, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+		if err := json.Unmarshal(data, apiErr); err != nil || apiErr.Message == "" {
+			apiErr.Message = strings.TrimSpace(string(data))
+		}
+		apiErr.StatusCode = resp.StatusCode
+
+		return nil, apiErr
+	}
+
+	return resp, nil
+}
+
+// get sends a GET request to the libpod API and decodes the response in v.
+func (c *podmanClient) get(ctx context.Context, path string, query url.Values, v interface{}) error {
+
+	resp, err := c.do(ctx, path, query)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close() // nolint: errcheck
+
+	if v == nil {
+		_, err = io.Copy(ioutil.Discard, resp.Body)
+		return err
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("unable to decode response of %s: %s", path, err)
+	}
+
+	return nil
+}
+
+// Ping checks that the podman service is reachable.
+func (c *podmanClient) Ping(ctx context.Context) error {
+	return c.get(ctx, "/_ping", nil, nil)
+}
+
+// Events streams the container events. The error channel receives an error
+// when the stream ends.
+func (c *podmanClient) Events(ctx context.Context) (<-chan *Event, <-chan error) {
+
+	eventCh := make(chan *Event)
+	errCh := make(chan error, 1)
+
+	query := url.Values{
+		"stream":  []string{"true"},
+		"filters": []string{`{"type":["container"]}`},
+	}
+
+	go func() {
+		resp, err := c.do(ctx, "/events", query)
+		if err != nil {
+			errCh <- err
+			return
+		}
+		defer resp.Body.Close() // nolint: errcheck
+
+		decoder := json.NewDecoder(resp.Body)
+		for {
+			event := &Event{}
+			if err := decoder.Decode(event); err != nil {
+				errCh <- err
+				return
+			}
+
+			if event.Type != "container" {
+				continue
+			}
+
+			select {
+			case eventCh <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return eventCh, errCh
+}
+
+// ListContainers lists all the containers.
+func (c *podmanClient) ListContainers(ctx context.Context) ([]listContainer, error) {
+
+	containers := []listContainer{}
+	if err := c.get(ctx, "/containers/json", url.Values{"all": []string{"true"}}, &containers); err != nil {
+		return nil, err
+	}
+
+	return containers, nil
+}
+
+// InspectContainer returns the inspect information of a container.
+func (c *podmanClient) InspectContainer(ctx context.Context, id string) (*extractors.PodmanContainerJSON, error) {
+
+	info := &extractors.PodmanContainerJSON{}
+	if err := c.get(ctx, "/containers/"+url.PathEscape(id)+"/json", nil, info); err != nil {
+		return nil, err
+	}
+
+	return info, nil
+}
+
+// InspectPod returns the inspect information of a pod.
+func (c *podmanClient) InspectPod(ctx context.Context, id string) (*extractors.PodmanPodJSON, error) {
+
+	pod := &extractors.PodmanPodJSON{}
+	if err := c.get(ctx, "/pods/"+url.PathEscape(id)+"/json", nil, pod); err != nil {
+		return nil, err
+	}
+
+	return pod, nil
+}
@@ -0,0 +1,238 @@
+// +build linux
+
+package podmanmonitor
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.aporeto.io/enforcerd/trireme-lib/monitor/extractors"
+)
+
+// stubPodman is a stub of the libpod API served over a unix socket.
+type stubPodman struct {
+	server     *httptest.Server
+	socket     string
+	dir        string
+	containers map[string]*extractors.PodmanContainerJSON
+	pods       map[string]*extractors.PodmanPodJSON
+	events     chan *Event
+	streams    chan struct{}
+	sync.Mutex
+}
+
+func newStubPodman(t *testing.T) *stubPodman {
+
+	dir, err := ioutil.TempDir("", "podman")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &stubPodman{
+		socket:     filepath.Join(dir, "podman.sock"),
+		dir:        dir,
+		containers: map[string]*extractors.PodmanContainerJSON{},
+		pods:       map[string]*extractors.PodmanPodJSON{},
+		events:     make(chan *Event),
+		streams:    make(chan struct{}, 10),
+	}
+
+	l, err := net.Listen("unix", s.socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.server = httptest.NewUnstartedServer(http.HandlerFunc(s.serveHTTP))
+	s.server.Listener = l
+	s.server.Start()
+
+	return s
+}
+
+func (s *stubPodman) close() {
+	s.server.CloseClientConnections()
+	s.server.Close()
+	os.RemoveAll(s.dir) // nolint: errcheck
+}
+
+func (s *stubPodman) addContainer(c *extractors.PodmanContainerJSON) {
+	s.Lock()
+	defer s.Unlock()
+	s.containers[c.ID] = c
+}
+
+func (s *stubPodman) addPod(p *extractors.PodmanPodJSON) {
+	s.Lock()
+	defer s.Unlock()
+	s.pods[p.ID] = p
+}
+
+func (s *stubPodman) notFound(w http.ResponseWriter, what string) {
+	w.WriteHeader(http.StatusNotFound)
+	json.NewEncoder(w).Encode(map[string]interface{}{ // nolint: errcheck
+		"cause":    "no such " + what,
+		"message":  "no such " + what,
+		"response": http.StatusNotFound,
+	})
+}
+
+func (s *stubPodman) serveHTTP(w http.ResponseWriter, r *http.Request) {
+
+	path := strings.TrimPrefix(r.URL.Path, libpodAPIPrefix)
+
+	if path == "/events" {
+		if r.URL.Query().Get("filters") != `{"type":["container"]}` {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		s.streamEvents(w, r)
+		return
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	switch {
+	case path == "/_ping":
+		w.Write([]byte("OK")) // nolint: errcheck
+
+	case path == "/containers/json":
+		list := []listContainer{}
+		for id, c := range s.containers {
+			list = append(list, listContainer{ID: id, State: c.State.Status})
+		}
+		json.NewEncoder(w).Encode(list) // nolint: errcheck
+
+	case strings.HasPrefix(path, "/containers/") && strings.HasSuffix(path, "/json"):
+		c, ok := s.containers[strings.TrimSuffix(strings.TrimPrefix(path, "/containers/"), "/json")]
+		if !ok {
+			s.notFound(w, "container")
+			return
+		}
+		json.NewEncoder(w).Encode(c) // nolint: errcheck
+
+	case strings.HasPrefix(path, "/pods/") && strings.HasSuffix(path, "/json"):
+		p, ok := s.pods[strings.TrimSuffix(strings.TrimPrefix(path, "/pods/"), "/json")]
+		if !ok {
+			s.notFound(w, "pod")
+			return
+		}
+		json.NewEncoder(w).Encode(p) // nolint: errcheck
+
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (s *stubPodman) streamEvents(w http.ResponseWriter, r *http.Request) {
+
+	w.WriteHeader(http.StatusOK)
+	w.(http.Flusher).Flush()
+	s.streams <- struct{}{}
+
+	encoder := json.NewEncoder(w)
+	for {
+		select {
+		case event := <-s.events:
+			if event == nil {
+				return
+			}
+			encoder.Encode(event) // nolint: errcheck
+			w.(http.Flusher).Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func testPodmanEvent(action EventAction, id string) *Event {
+	e := &Event{Type: "container", Action: action}
+	e.Actor.ID = id
+	return e
+}
+
+func TestPodmanClient(t *testing.T) {
+
+	s := newStubPodman(t)
+	defer s.close()
+
+	c := &extractors.PodmanContainerJSON{ID: "0123456789abcdef", Name: "web", Pod: "pod1"}
+	c.State.Running = true
+	c.State.Pid = 100
+	c.Config.Labels = map[string]string{"app": "web"}
+	s.addContainer(c)
+	s.addPod(&extractors.PodmanPodJSON{ID: "pod1", Name: "frontend", InfraContainerID: "infra", SharedNamespaces: []string{"net"}})
+
+	client := newPodmanClient(s.socket)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := client.Ping(ctx); err != nil {
+		t.Fatalf("ping failed: %s", err)
+	}
+
+	list, err := client.ListContainers(ctx)
+	if err != nil || len(list) != 1 || list[0].ID != c.ID {
+		t.Fatalf("unexpected container list %v: %v", list, err)
+	}
+
+	info, err := client.InspectContainer(ctx, c.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Name != "web" || info.State.Pid != 100 || !info.State.Running || info.Config.Labels["app"] != "web" {
+		t.Errorf("unexpected container %+v", info)
+	}
+
+	if _, err = client.InspectContainer(ctx, "unknown"); !isNotFound(err) {
+		t.Errorf("expected not found error, got %v", err)
+	}
+
+	pod, err := client.InspectPod(ctx, "pod1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pod.Name != "frontend" || !pod.SharesNetwork() {
+		t.Errorf("unexpected pod %+v", pod)
+	}
+
+	events, errs := client.Events(ctx)
+	<-s.streams
+
+	s.events <- testPodmanEvent(EventStart, c.ID)
+	s.events <- &Event{Type: "image", Action: "pull"}
+	s.events <- testPodmanEvent(EventDied, c.ID)
+
+	for _, action := range []EventAction{EventStart, EventDied} {
+		select {
+		case e := <-events:
+			if e.Action != action || e.Actor.ID != c.ID {
+				t.Errorf("unexpected event %+v", e)
+			}
+		case err := <-errs:
+			t.Fatalf("unexpected error %s", err)
+		case <-ctx.Done():
+			t.Fatal("timeout waiting for events")
+		}
+	}
+
+	s.events <- nil
+	select {
+	case err := <-errs:
+		if err == nil {
+			t.Error("expected an error at the end of the stream")
+		}
+	case <-ctx.Done():
+		t.Fatal("timeout waiting for the end of the stream")
+	}
+}
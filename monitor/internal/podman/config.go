@@ -0,0 +1,39 @@
+package podmanmonitor
+
+import (
+	"go.aporeto.io/enforcerd/trireme-lib/monitor/constants"
+	"go.aporeto.io/enforcerd/trireme-lib/monitor/extractors"
+)
+
+// Config is the configuration options to start a podman monitor
+type Config struct {
+	EventMetadataExtractor   extractors.PodmanMetadataExtractor
+	SocketAddress            string
+	SyncAtStart              bool
+	DestroyStoppedContainers bool
+	IgnoreHostNetwork        bool
+}
+
+// DefaultConfig provides a default configuration
+func DefaultConfig() *Config {
+	return &Config{
+		EventMetadataExtractor: extractors.DefaultPodmanMetadataExtractor,
+		SocketAddress:          constants.DefaultPodmanSocket,
+		SyncAtStart:            true,
+		IgnoreHostNetwork:      true,
+	}
+}
+
+// SetupDefaultConfig adds defaults to a partial configuration
+func SetupDefaultConfig(podmanConfig *Config) *Config {
+
+	defaultConfig := DefaultConfig()
+
+	if podmanConfig.EventMetadataExtractor == nil {
+		podmanConfig.EventMetadataExtractor = defaultConfig.EventMetadataExtractor
+	}
+	if podmanConfig.SocketAddress == "" {
+		podmanConfig.SocketAddress = defaultConfig.SocketAddress
+	}
+	return podmanConfig
+}
@@ -0,0 +1,566 @@
+package podmanmonitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dchest/siphash"
+	"go.aporeto.io/enforcerd/trireme-lib/common"
+	"go.aporeto.io/enforcerd/trireme-lib/monitor/config"
+	"go.aporeto.io/enforcerd/trireme-lib/monitor/constants"
+	"go.aporeto.io/enforcerd/trireme-lib/monitor/extractors"
+	"go.aporeto.io/enforcerd/trireme-lib/monitor/registerer"
+	"go.aporeto.io/enforcerd/trireme-lib/policy"
+	"go.aporeto.io/enforcerd/trireme-lib/utils/cgnetcls"
+	"go.uber.org/zap"
+)
+
+// PodmanMonitor implements the connection to the podman service and
+// monitoring based on the libpod events.
+//
+// A PU is created for every network namespace. The containers of a pod
+// that share the network namespace of the infra container are activated
+// through the infra container, and the containers that join the network
+// namespace of another container are not activated.
+type PodmanMonitor struct {
+	client                   *podmanClient
+	socketAddress            string
+	metadataExtractor        extractors.PodmanMetadataExtractor
+	handlers                 map[EventAction]EventHandler
+	eventnotifications       []chan *Event
+	numberOfQueues           int
+	config                   *config.ProcessorConfig
+	netcls                   cgnetcls.Cgroupnetcls
+	syncAtStart              bool
+	destroyStoppedContainers bool
+	ignoreHostNetwork        bool
+
+	// activated are the IDs of the containers that have been activated as PUs.
+	activated     map[string]struct{}
+	activatedLock sync.Mutex
+}
+
+// New returns a new podman monitor.
+func New(context.Context) *PodmanMonitor {
+	return &PodmanMonitor{}
+}
+
+// SetupConfig provides a configuration to implmentations. Every implementation
+// can have its own config type.
+func (p *PodmanMonitor) SetupConfig(_ registerer.Registerer, cfg interface{}) error {
+
+	if cfg == nil {
+		cfg = DefaultConfig()
+	}
+
+	podmanConfig, ok := cfg.(*Config)
+	if !ok {
+		return fmt.Errorf("Invalid configuration specified")
+	}
+
+	// Setup defaults
+	podmanConfig = SetupDefaultConfig(podmanConfig)
+
+	p.socketAddress = podmanConfig.SocketAddress
+	p.client = newPodmanClient(p.socketAddress)
+	p.metadataExtractor = podmanConfig.EventMetadataExtractor
+	p.syncAtStart = podmanConfig.SyncAtStart
+	p.destroyStoppedContainers = podmanConfig.DestroyStoppedContainers
+	p.ignoreHostNetwork = podmanConfig.IgnoreHostNetwork
+	// Host network containers are activated in the same cgroup
+	// hierarchy as the docker host network containers.
+	p.netcls = cgnetcls.NewDockerCgroupNetController()
+	p.activated = map[string]struct{}{}
+
+	p.numberOfQueues = runtime.NumCPU()
+	p.eventnotifications = make([]chan *Event, p.numberOfQueues)
+	for i := 0; i < p.numberOfQueues; i++ {
+		p.eventnotifications[i] = make(chan *Event, 1000)
+	}
+
+	p.handlers = map[EventAction]EventHandler{
+		EventStart:   p.handleStartEvent,
+		EventDied:    p.handleDiedEvent,
+		EventRemove:  p.handleRemoveEvent,
+		EventPause:   p.handlePauseEvent,
+		EventUnpause: p.handleUnpauseEvent,
+	}
+
+	return nil
+}
+
+// SetupHandlers sets up handlers for monitors to invoke for various events such as
+// processing unit events and synchronization events. This will be called before Start()
+// by the consumer of the monitor
+func (p *PodmanMonitor) SetupHandlers(c *config.ProcessorConfig) {
+
+	p.config = c
+}
+
+// Run starts listening to the podman events. It returns once the existing
+// containers have been synced, or right away if podman is not reachable, in
+// which case periodic retries are attempted.
+func (p *PodmanMonitor) Run(ctx context.Context) error {
+
+	if err := p.config.IsComplete(); err != nil {
+		return fmt.Errorf("podman config issue: %s", err)
+	}
+
+	p.eventProcessors(ctx)
+
+	listenerReady := make(chan struct{})
+	go p.eventListener(ctx, listenerReady)
+	<-listenerReady
+
+	return nil
+}
+
+// Resync resyncs all the existing containers, using the same process as
+// when a container is initially started.
+func (p *PodmanMonitor) Resync(ctx context.Context) error {
+
+	if !p.syncAtStart || p.config.Policy == nil {
+		zap.L().Debug("No synchronization of podman containers performed")
+		return nil
+	}
+
+	subctx, cancel := context.WithTimeout(ctx, podmanRequestTimeout)
+	containers, err := p.client.ListContainers(subctx)
+	cancel()
+	if err != nil {
+		return fmt.Errorf("unable to get container list: %s", err)
+	}
+
+	p.config.ResyncLock.RLock()
+	defer p.config.ResyncLock.RUnlock()
+
+	for _, c := range containers {
+		if err := p.resyncContainer(ctx, c.ID); err != nil {
+			zap.L().Error("Unable to sync existing container",
+				zap.String("id", c.ID),
+				zap.Error(err),
+			)
+		}
+	}
+
+	return nil
+}
+
+func (p *PodmanMonitor) resyncContainer(ctx context.Context, id string) error {
+
+	info, pod, err := p.retrieveContainer(ctx, id)
+	if err != nil || info == nil {
+		return err
+	}
+
+	if !p.isPU(info, pod) {
+		return nil
+	}
+
+	event := common.EventStop
+	switch {
+	case info.State.Paused:
+		event = common.EventPause
+	case info.State.Running:
+		event = common.EventStart
+	case p.destroyStoppedContainers:
+		return nil
+	}
+
+	puID, err := puIDFromContainerID(info.ID)
+	if err != nil {
+		return err
+	}
+
+	runtime, err := p.metadataExtractor(info, pod)
+	if err != nil {
+		return err
+	}
+
+	if isHostNetwork(info) {
+		setHostModeCgroupPath(puID, runtime)
+	}
+
+	if err := p.config.Policy.HandlePUEvent(ctx, puID, event, runtime); err != nil {
+		return err
+	}
+	p.setActivated(info.ID, true)
+
+	if event == common.EventStart && isHostNetwork(info) {
+		return p.setupHostMode(puID, runtime, info.State.Pid)
+	}
+
+	return nil
+}
+
+// setHostModeCgroupPath sets the path of the cgroup that setupHostMode
+// creates for a host network container. The PU is matched on this path with
+// cgroup v2.
+func setHostModeCgroupPath(puID string, runtime *policy.PURuntime) {
+
+	if !cgnetcls.IsCgroupV2() {
+		return
+	}
+
+	options := runtime.Options()
+	options.CgroupPath = cgnetcls.CgroupV2Path(common.TriremeDockerHostNetwork, puID)
+	runtime.SetOptions(options)
+}
+
+// isPU returns true if the container must be activated as a PU.
+func (p *PodmanMonitor) isPU(info *extractors.PodmanContainerJSON, pod *extractors.PodmanPodJSON) bool {
+
+	if pod != nil {
+		if pod.SharesNetwork() != info.IsInfra {
+			return false
+		}
+	}
+
+	if isHostNetwork(info) {
+		return !p.ignoreHostNetwork
+	}
+
+	return !strings.HasPrefix(info.HostConfig.NetworkMode, constants.PodmanLinkedMode)
+}
+
+func isHostNetwork(info *extractors.PodmanContainerJSON) bool {
+	return info.HostConfig.NetworkMode == constants.PodmanHostMode
+}
+
+func (p *PodmanMonitor) isActivated(id string) bool {
+	p.activatedLock.Lock()
+	defer p.activatedLock.Unlock()
+
+	_, ok := p.activated[id]
+	return ok
+}
+
+func (p *PodmanMonitor) setActivated(id string, activated bool) {
+	p.activatedLock.Lock()
+	defer p.activatedLock.Unlock()
+
+	if activated {
+		p.activated[id] = struct{}{}
+	} else {
+		delete(p.activated, id)
+	}
+}
+
+// retrieveContainer inspects a container and its pod. It returns a nil
+// container if the container does not exist anymore.
+func (p *PodmanMonitor) retrieveContainer(ctx context.Context, id string) (*extractors.PodmanContainerJSON, *extractors.PodmanPodJSON, error) {
+
+	subctx, cancel := context.WithTimeout(ctx, podmanRequestTimeout)
+	defer cancel()
+
+	info, err := p.client.InspectContainer(subctx, id)
+	if isNotFound(err) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to read container information: container %s kept alive per policy: %s", id, err)
+	}
+
+	if info.Pod == "" {
+		return info, nil, nil
+	}
+
+	pod, err := p.client.InspectPod(subctx, info.Pod)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to read pod information of container %s: %s", id, err)
+	}
+
+	return info, pod, nil
+}
+
+// handleStartEvent activates the container if it owns its network namespace.
+func (p *PodmanMonitor) handleStartEvent(ctx context.Context, event *Event) error {
+
+	info, pod, err := p.retrieveContainer(ctx, event.Actor.ID)
+	if err != nil || info == nil {
+		return err
+	}
+
+	if !info.State.Running || !p.isPU(info, pod) {
+		return nil
+	}
+
+	puID, err := puIDFromContainerID(info.ID)
+	if err != nil {
+		return err
+	}
+
+	runtime, err := p.metadataExtractor(info, pod)
+	if err != nil {
+		return err
+	}
+
+	if isHostNetwork(info) {
+		setHostModeCgroupPath(puID, runtime)
+	}
+
+	if err = p.config.Policy.HandlePUEvent(ctx, puID, common.EventCreate, runtime); err != nil {
+		return fmt.Errorf("unable to create pu for container %s: %s", puID, err)
+	}
+
+	if err = p.config.Policy.HandlePUEvent(ctx, puID, common.EventStart, runtime); err != nil {
+		return fmt.Errorf("unable to set policy: container %s kept alive per policy: %s", puID, err)
+	}
+	p.setActivated(info.ID, true)
+
+	if isHostNetwork(info) {
+		if err = p.setupHostMode(puID, runtime, info.State.Pid); err != nil {
+			return fmt.Errorf("unable to setup host mode for container %s: %s", puID, err)
+		}
+	}
+
+	return nil
+}
+
+// handleDiedEvent generates a stop event.
+func (p *PodmanMonitor) handleDiedEvent(ctx context.Context, event *Event) error {
+
+	if !p.isActivated(event.Actor.ID) {
+		return nil
+	}
+
+	puID, err := puIDFromContainerID(event.Actor.ID)
+	if err != nil {
+		return err
+	}
+
+	runtime := policy.NewPURuntimeWithDefaults()
+
+	if err := p.config.Policy.HandlePUEvent(ctx, puID, common.EventStop, runtime); err != nil && !p.destroyStoppedContainers {
+		return err
+	}
+
+	if p.destroyStoppedContainers {
+		return p.handleRemoveEvent(ctx, event)
+	}
+
+	return nil
+}
+
+// handleRemoveEvent generates a destroy event.
+func (p *PodmanMonitor) handleRemoveEvent(ctx context.Context, event *Event) error {
+
+	if !p.isActivated(event.Actor.ID) {
+		return nil
+	}
+	p.setActivated(event.Actor.ID, false)
+
+	puID, err := puIDFromContainerID(event.Actor.ID)
+	if err != nil {
+		return err
+	}
+
+	if err := p.config.Policy.HandlePUEvent(ctx, puID, common.EventDestroy, policy.NewPURuntimeWithDefaults()); err != nil {
+		zap.L().Error("Failed to handle delete event",
+			zap.String("puID", puID),
+			zap.Error(err),
+		)
+	}
+
+	if err := p.netcls.DeleteCgroup(puID); err != nil {
+		zap.L().Warn("Failed to clean netcls group",
+			zap.String("puID", puID),
+			zap.Error(err),
+		)
+	}
+
+	return nil
+}
+
+// handlePauseEvent generates a pause event.
+func (p *PodmanMonitor) handlePauseEvent(ctx context.Context, event *Event) error {
+
+	if !p.isActivated(event.Actor.ID) {
+		return nil
+	}
+
+	puID, err := puIDFromContainerID(event.Actor.ID)
+	if err != nil {
+		return err
+	}
+
+	return p.config.Policy.HandlePUEvent(ctx, puID, common.EventPause, policy.NewPURuntimeWithDefaults())
+}
+
+// handleUnpauseEvent generates an unpause event.
+func (p *PodmanMonitor) handleUnpauseEvent(ctx context.Context, event *Event) error {
+
+	if !p.isActivated(event.Actor.ID) {
+		return nil
+	}
+
+	puID, err := puIDFromContainerID(event.Actor.ID)
+	if err != nil {
+		return err
+	}
+
+	return p.config.Policy.HandlePUEvent(ctx, puID, common.EventUnpause, policy.NewPURuntimeWithDefaults())
+}
+
+// setupHostMode sets up the net_cls cgroup for the host network containers
+func (p *PodmanMonitor) setupHostMode(puID string, runtimeInfo policy.RuntimeReader, pid int) (err error) {
+
+	if err = p.netcls.Creategroup(puID); err != nil {
+		return err
+	}
+
+	// Clean the cgroup on exit, if we have failed to activate.
+	defer func() {
+		if err != nil {
+			if derr := p.netcls.DeleteCgroup(puID); derr != nil {
+				zap.L().Warn("Failed to clean cgroup",
+					zap.String("puID", puID),
+					zap.Error(derr),
+					zap.Error(err),
+				)
+			}
+		}
+	}()
+
+	markval := runtimeInfo.Options().CgroupMark
+	if markval == "" {
+		return errors.New("mark value not found")
+	}
+
+	mark, _ := strconv.ParseUint(markval, 10, 32)
+	if err = p.netcls.AssignMark(puID, mark); err != nil {
+		return err
+	}
+
+	return p.netcls.AddProcess(puID, pid)
+}
+
+// sendRequestToQueue sends a request to a channel based on a hash function.
+// This ensures that all the events of a container fall onto the same queue.
+func (p *PodmanMonitor) sendRequestToQueue(event *Event) {
+
+	key0 := uint64(256203161)
+	key1 := uint64(982451653)
+
+	h := siphash.Hash(key0, key1, []byte(event.Actor.ID))
+
+	p.eventnotifications[int(h%uint64(p.numberOfQueues))] <- event
+}
+
+// eventProcessors processes the podman events. The queues are processed
+// in parallel.
+func (p *PodmanMonitor) eventProcessors(ctx context.Context) {
+
+	for i := 0; i < p.numberOfQueues; i++ {
+		go func(i int) {
+			for {
+				select {
+				case event := <-p.eventnotifications[i]:
+					if f, ok := p.handlers[event.Action]; ok {
+						if err := f(ctx, event); err != nil {
+							zap.L().Error("Unable to handle podman event",
+								zap.String("action", string(event.Action)),
+								zap.String("id", event.Actor.ID),
+								zap.Error(err),
+							)
+						}
+					}
+				case <-ctx.Done():
+					return
+				}
+			}
+		}(i)
+	}
+}
+
+// eventListener streams the podman events and passes them to the
+// processors. The containers are resynced every time the stream is
+// established, since events may have been missed while disconnected.
+// listenerReady is closed after the first attempt to stream the events.
+func (p *PodmanMonitor) eventListener(ctx context.Context, listenerReady chan struct{}) {
+
+	ready := listenerReady
+	signalReady := func() {
+		if ready != nil {
+			close(ready)
+			ready = nil
+		}
+	}
+	defer signalReady()
+
+	for {
+		subctx, cancel := context.WithTimeout(ctx, podmanPingTimeout)
+		err := p.client.Ping(subctx)
+		cancel()
+
+		if err == nil {
+			events, errs := p.client.Events(ctx)
+
+			if err := p.Resync(ctx); err != nil {
+				zap.L().Error("Unable to resync podman containers", zap.Error(err))
+			}
+			signalReady()
+
+			if !p.listener(ctx, events, errs) {
+				return
+			}
+		} else {
+			zap.L().Debug("Unable to reach podman",
+				zap.String("socket", p.socketAddress),
+				zap.Error(err),
+			)
+			signalReady()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(podmanRetryTimer):
+		}
+	}
+}
+
+// listener dispatches the events until the stream fails. It returns
+// false if the context is done.
+func (p *PodmanMonitor) listener(ctx context.Context, events <-chan *Event, errs <-chan error) bool {
+
+	for {
+		select {
+		case event := <-events:
+			zap.L().Debug("Got event from podman",
+				zap.String("action", string(event.Action)),
+				zap.String("id", event.Actor.ID),
+			)
+			p.sendRequestToQueue(event)
+
+		case err := <-errs:
+			if err != nil && err != io.EOF {
+				zap.L().Warn("Received podman event error", zap.Error(err))
+			}
+			return true
+
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+func puIDFromContainerID(id string) (string, error) {
+
+	if id == "" {
+		return "", errors.New("unable to generate context id: empty container id")
+	}
+
+	if len(id) < 12 {
+		return "", fmt.Errorf("unable to generate context id: container id smaller than 12 characters: %s", id)
+	}
+
+	return id[:12], nil
+}
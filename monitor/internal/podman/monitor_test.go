@@ -0,0 +1,346 @@
+// +build linux
+
+package podmanmonitor
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.aporeto.io/enforcerd/trireme-lib/collector"
+	"go.aporeto.io/enforcerd/trireme-lib/common"
+	"go.aporeto.io/enforcerd/trireme-lib/monitor/config"
+	"go.aporeto.io/enforcerd/trireme-lib/monitor/extractors"
+	"go.aporeto.io/enforcerd/trireme-lib/policy"
+	"go.aporeto.io/enforcerd/trireme-lib/policy/mockpolicy"
+	"go.aporeto.io/enforcerd/trireme-lib/utils/cgnetcls/mockcgnetcls"
+)
+
+const (
+	standaloneID = "1111111111111111"
+	pausedID     = "2222222222222222"
+	stoppedID    = "3333333333333333"
+	infraID      = "4444444444444444"
+	memberID     = "5555555555555555"
+	linkedID     = "6666666666666666"
+	hostID       = "7777777777777777"
+)
+
+func testPodmanContainer(id, name string, running bool) *extractors.PodmanContainerJSON {
+	c := &extractors.PodmanContainerJSON{ID: id, Name: name, ImageName: "docker.io/library/nginx:latest"}
+	c.State.Running = running
+	c.State.Pid = 100
+	c.Config.Labels = map[string]string{"app": name}
+	c.HostConfig.NetworkMode = "bridge"
+	c.NetworkSettings.SandboxKey = "/run/netns/cni-" + name
+	return c
+}
+
+// addTestContainers adds a standalone container, a paused and a stopped
+// container, a pod sharing its network namespace with a member container,
+// a container linked to the network of another one and a host network
+// container.
+func addTestContainers(s *stubPodman) {
+
+	s.addContainer(testPodmanContainer(standaloneID, "standalone", true))
+
+	paused := testPodmanContainer(pausedID, "paused", false)
+	paused.State.Paused = true
+	s.addContainer(paused)
+
+	s.addContainer(testPodmanContainer(stoppedID, "stopped", false))
+
+	infra := testPodmanContainer(infraID, "pod-infra", true)
+	infra.Pod = "pod1"
+	infra.IsInfra = true
+	s.addContainer(infra)
+
+	member := testPodmanContainer(memberID, "member", true)
+	member.Pod = "pod1"
+	member.HostConfig.NetworkMode = "container:" + infraID
+	s.addContainer(member)
+
+	s.addPod(&extractors.PodmanPodJSON{
+		ID:               "pod1",
+		Name:             "frontend",
+		Labels:           map[string]string{"tier": "web"},
+		InfraContainerID: infraID,
+		SharedNamespaces: []string{"ipc", "net", "uts"},
+	})
+
+	linked := testPodmanContainer(linkedID, "linked", true)
+	linked.HostConfig.NetworkMode = "container:" + standaloneID
+	s.addContainer(linked)
+
+	host := testPodmanContainer(hostID, "host", true)
+	host.HostConfig.NetworkMode = "host"
+	host.NetworkSettings.SandboxKey = ""
+	s.addContainer(host)
+}
+
+func testPodmanMonitor(puHandler policy.Resolver, socket string, cfg *Config) *PodmanMonitor {
+
+	p := New(context.Background())
+	p.SetupHandlers(&config.ProcessorConfig{
+		Collector:  &collector.DefaultCollector{},
+		Policy:     puHandler,
+		ResyncLock: &sync.RWMutex{},
+	})
+
+	if cfg == nil {
+		cfg = DefaultConfig()
+	}
+	cfg.SocketAddress = socket
+
+	if err := p.SetupConfig(nil, cfg); err != nil {
+		return nil
+	}
+
+	return p
+}
+
+func TestSetupConfig(t *testing.T) {
+
+	Convey("Given a podman monitor", t, func() {
+		p := New(context.Background())
+
+		Convey("When I provide an invalid config, I should get an error", func() {
+			So(p.SetupConfig(nil, "invalid"), ShouldNotBeNil)
+		})
+
+		Convey("When I provide no config, the defaults should be used", func() {
+			So(p.SetupConfig(nil, nil), ShouldBeNil)
+			So(p.socketAddress, ShouldEqual, "/run/podman/podman.sock")
+			So(p.syncAtStart, ShouldBeTrue)
+			So(p.ignoreHostNetwork, ShouldBeTrue)
+			So(p.metadataExtractor, ShouldNotBeNil)
+			So(len(p.handlers), ShouldEqual, 5)
+		})
+	})
+}
+
+func TestIsPU(t *testing.T) {
+
+	Convey("Given a podman monitor and the test containers", t, func() {
+		s := newStubPodman(t)
+		defer s.close()
+		addTestContainers(s)
+
+		p := testPodmanMonitor(nil, s.socket, nil)
+		So(p, ShouldNotBeNil)
+
+		isPU := func(id string) bool {
+			info, pod, err := p.retrieveContainer(context.Background(), id)
+			So(err, ShouldBeNil)
+			So(info, ShouldNotBeNil)
+			return p.isPU(info, pod)
+		}
+
+		Convey("Containers owning their network namespace should be PUs", func() {
+			So(isPU(standaloneID), ShouldBeTrue)
+			So(isPU(stoppedID), ShouldBeTrue)
+		})
+
+		Convey("The infra container of a pod sharing its network should be the only PU of the pod", func() {
+			So(isPU(infraID), ShouldBeTrue)
+			So(isPU(memberID), ShouldBeFalse)
+		})
+
+		Convey("The containers of a pod not sharing its network should be PUs", func() {
+			s.addPod(&extractors.PodmanPodJSON{ID: "pod1", Name: "frontend", InfraContainerID: infraID, SharedNamespaces: []string{"ipc"}})
+			So(isPU(infraID), ShouldBeFalse)
+			So(isPU(memberID), ShouldBeFalse)
+
+			member := testPodmanContainer(memberID, "member", true)
+			member.Pod = "pod1"
+			s.addContainer(member)
+			So(isPU(memberID), ShouldBeTrue)
+		})
+
+		Convey("Containers joining the network of another container should not be PUs", func() {
+			So(isPU(linkedID), ShouldBeFalse)
+		})
+
+		Convey("Host network containers should be PUs only if they are not ignored", func() {
+			So(isPU(hostID), ShouldBeFalse)
+			p.ignoreHostNetwork = false
+			So(isPU(hostID), ShouldBeTrue)
+		})
+
+		Convey("A removed container should not be returned", func() {
+			info, pod, err := p.retrieveContainer(context.Background(), "8888888888888888")
+			So(err, ShouldBeNil)
+			So(info, ShouldBeNil)
+			So(pod, ShouldBeNil)
+		})
+	})
+}
+
+func TestResync(t *testing.T) {
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	Convey("Given a podman service with containers", t, func() {
+		s := newStubPodman(t)
+		defer s.close()
+		addTestContainers(s)
+
+		puHandler := mockpolicy.NewMockResolver(ctrl)
+
+		Convey("When the monitor starts, the PUs should be synced", func() {
+			p := testPodmanMonitor(puHandler, s.socket, nil)
+			So(p, ShouldNotBeNil)
+
+			// The resync runs in the listener, the runtimes are checked once
+			// the monitor is running.
+			var standalone, infra policy.RuntimeReader
+			puHandler.EXPECT().HandlePUEvent(gomock.Any(), standaloneID[:12], common.EventStart, gomock.Any()).DoAndReturn(
+				func(_ context.Context, _ string, _ common.Event, r policy.RuntimeReader) error {
+					standalone = r
+					return nil
+				})
+			puHandler.EXPECT().HandlePUEvent(gomock.Any(), pausedID[:12], common.EventPause, gomock.Any()).Return(nil)
+			puHandler.EXPECT().HandlePUEvent(gomock.Any(), stoppedID[:12], common.EventStop, gomock.Any()).Return(nil)
+			puHandler.EXPECT().HandlePUEvent(gomock.Any(), infraID[:12], common.EventStart, gomock.Any()).DoAndReturn(
+				func(_ context.Context, _ string, _ common.Event, r policy.RuntimeReader) error {
+					infra = r
+					return nil
+				})
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			So(p.Run(ctx), ShouldBeNil)
+
+			So(standalone, ShouldNotBeNil)
+			So(standalone.NSPath(), ShouldEqual, "/run/netns/cni-standalone")
+			So(standalone.PUType(), ShouldEqual, common.ContainerPU)
+
+			So(infra, ShouldNotBeNil)
+			pod, _ := infra.Tag("@app:podman:pod")
+			So(pod, ShouldEqual, "frontend")
+			tier, _ := infra.Tag("@usr:tier")
+			So(tier, ShouldEqual, "web")
+
+			So(p.isActivated(standaloneID), ShouldBeTrue)
+			So(p.isActivated(memberID), ShouldBeFalse)
+		})
+
+		Convey("When host network containers are activated, their cgroup should be programmed", func() {
+			p := testPodmanMonitor(puHandler, s.socket, &Config{SyncAtStart: true, DestroyStoppedContainers: true})
+			So(p, ShouldNotBeNil)
+
+			netcls := mockcgnetcls.NewMockCgroupnetcls(ctrl)
+			p.netcls = netcls
+
+			puHandler.EXPECT().HandlePUEvent(gomock.Any(), standaloneID[:12], common.EventStart, gomock.Any()).Return(nil)
+			puHandler.EXPECT().HandlePUEvent(gomock.Any(), pausedID[:12], common.EventPause, gomock.Any()).Return(nil)
+			puHandler.EXPECT().HandlePUEvent(gomock.Any(), infraID[:12], common.EventStart, gomock.Any()).Return(nil)
+			puHandler.EXPECT().HandlePUEvent(gomock.Any(), hostID[:12], common.EventStart, gomock.Any()).Return(nil)
+			netcls.EXPECT().Creategroup(hostID[:12]).Return(nil)
+			netcls.EXPECT().AssignMark(hostID[:12], gomock.Any()).Return(nil)
+			netcls.EXPECT().AddProcess(hostID[:12], 100).Return(nil)
+
+			So(p.Resync(context.Background()), ShouldBeNil)
+		})
+
+		Convey("When podman is not reachable, resync should fail", func() {
+			p := testPodmanMonitor(puHandler, s.socket+".missing", nil)
+			So(p, ShouldNotBeNil)
+			So(p.Resync(context.Background()), ShouldNotBeNil)
+		})
+	})
+}
+
+func TestEvents(t *testing.T) {
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	Convey("Given a running podman monitor", t, func() {
+		s := newStubPodman(t)
+		defer s.close()
+		addTestContainers(s)
+
+		puHandler := mockpolicy.NewMockResolver(ctrl)
+
+		p := testPodmanMonitor(puHandler, s.socket, &Config{SyncAtStart: false})
+		So(p, ShouldNotBeNil)
+
+		netcls := mockcgnetcls.NewMockCgroupnetcls(ctrl)
+		p.netcls = netcls
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		So(p.Run(ctx), ShouldBeNil)
+		<-s.streams
+
+		done := make(chan common.Event, 10)
+		record := func(_ context.Context, _ string, event common.Event, _ policy.RuntimeReader) error {
+			done <- event
+			return nil
+		}
+
+		Convey("A start event should activate the containers owning a network namespace", func() {
+			puHandler.EXPECT().HandlePUEvent(gomock.Any(), infraID[:12], common.EventCreate, gomock.Any()).DoAndReturn(record)
+			puHandler.EXPECT().HandlePUEvent(gomock.Any(), infraID[:12], common.EventStart, gomock.Any()).DoAndReturn(record)
+			puHandler.EXPECT().HandlePUEvent(gomock.Any(), standaloneID[:12], common.EventCreate, gomock.Any()).DoAndReturn(record)
+			puHandler.EXPECT().HandlePUEvent(gomock.Any(), standaloneID[:12], common.EventStart, gomock.Any()).DoAndReturn(record)
+
+			s.events <- testPodmanEvent(EventStart, memberID)
+			s.events <- testPodmanEvent(EventStart, linkedID)
+			s.events <- testPodmanEvent(EventStart, infraID)
+			s.events <- testPodmanEvent(EventStart, standaloneID)
+
+			for i := 0; i < 4; i++ {
+				<-done
+			}
+			So(p.isActivated(infraID), ShouldBeTrue)
+			So(p.isActivated(standaloneID), ShouldBeTrue)
+			So(p.isActivated(memberID), ShouldBeFalse)
+		})
+
+		Convey("The events of an activated container should be forwarded in order", func() {
+			p.setActivated(standaloneID, true)
+
+			gomock.InOrder(
+				puHandler.EXPECT().HandlePUEvent(gomock.Any(), standaloneID[:12], common.EventPause, gomock.Any()).DoAndReturn(record),
+				puHandler.EXPECT().HandlePUEvent(gomock.Any(), standaloneID[:12], common.EventUnpause, gomock.Any()).DoAndReturn(record),
+				puHandler.EXPECT().HandlePUEvent(gomock.Any(), standaloneID[:12], common.EventStop, gomock.Any()).DoAndReturn(record),
+				puHandler.EXPECT().HandlePUEvent(gomock.Any(), standaloneID[:12], common.EventDestroy, gomock.Any()).DoAndReturn(record),
+			)
+			netcls.EXPECT().DeleteCgroup(standaloneID[:12]).Return(nil)
+
+			s.events <- testPodmanEvent(EventPause, standaloneID)
+			s.events <- testPodmanEvent(EventUnpause, standaloneID)
+			s.events <- testPodmanEvent(EventDied, standaloneID)
+			s.events <- testPodmanEvent(EventRemove, standaloneID)
+
+			So(<-done, ShouldEqual, common.EventPause)
+			So(<-done, ShouldEqual, common.EventUnpause)
+			So(<-done, ShouldEqual, common.EventStop)
+			So(<-done, ShouldEqual, common.EventDestroy)
+			So(p.isActivated(standaloneID), ShouldBeFalse)
+		})
+
+		Convey("The events of containers that are not activated should be ignored", func() {
+			p.setActivated(standaloneID, true)
+			puHandler.EXPECT().HandlePUEvent(gomock.Any(), standaloneID[:12], common.EventStop, gomock.Any()).DoAndReturn(record)
+
+			s.events <- testPodmanEvent(EventDied, memberID)
+			s.events <- testPodmanEvent(EventRemove, memberID)
+			s.events <- testPodmanEvent(EventDied, standaloneID)
+
+			So(<-done, ShouldEqual, common.EventStop)
+		})
+
+		Convey("When the stream ends, the monitor should stream the events again", func() {
+			s.events <- nil
+			<-s.streams
+		})
+	})
+}
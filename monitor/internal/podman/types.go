@@ -0,0 +1,57 @@
+package podmanmonitor
+
+import (
+	"context"
+	"time"
+)
+
+// EventAction is the action of a libpod container event.
+type EventAction string
+
+const (
+	// EventStart represents the libpod "start" event.
+	EventStart EventAction = "start"
+
+	// EventDied represents the libpod "died" event.
+	EventDied EventAction = "died"
+
+	// EventRemove represents the libpod "remove" event.
+	EventRemove EventAction = "remove"
+
+	// EventPause represents the libpod "pause" event.
+	EventPause EventAction = "pause"
+
+	// EventUnpause represents the libpod "unpause" event.
+	EventUnpause EventAction = "unpause"
+
+	// libpodAPIPrefix is the prefix of the libpod API endpoints.
+	libpodAPIPrefix = "/v3.0.0/libpod"
+
+	// podmanPingTimeout is the time to wait for a ping to succeed.
+	podmanPingTimeout = 2 * time.Second
+
+	// podmanRequestTimeout is the timeout of the requests to podman.
+	podmanRequestTimeout = 5 * time.Second
+
+	// podmanRetryTimer is the time after which we will retry to connect to podman.
+	podmanRetryTimer = 2 * time.Second
+)
+
+// Event is a libpod event.
+type Event struct {
+	Type   string      `json:"Type"`
+	Action EventAction `json:"Action"`
+	Actor  struct {
+		ID         string            `json:"ID"`
+		Attributes map[string]string `json:"Attributes"`
+	} `json:"Actor"`
+}
+
+// listContainer is an entry of the libpod container list.
+type listContainer struct {
+	ID    string `json:"Id"`
+	State string `json:"State"`
+}
+
+// A EventHandler is type of podman event handler functions.
+type EventHandler func(ctx context.Context, event *Event) error
@@ -0,0 +1,161 @@
+package systemdmonitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-systemd/dbus"
+)
+
+// systemdClient is the connection to systemd over the system bus.
+type systemdClient struct {
+	conn *dbus.Conn
+}
+
+// newSystemdClient connects to systemd over the system bus.
+func newSystemdClient() (SystemdClientInterface, error) {
+
+	conn, err := dbus.NewSystemConnection()
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to systemd: %s", err)
+	}
+
+	return &systemdClient{conn: conn}, nil
+}
+
+// Subscribe returns the property changes of the service units. systemd
+// only sends the signals once the connection is subscribed. There is no
+// signal when the bus goes away, so the connection is checked periodically.
+func (c *systemdClient) Subscribe(ctx context.Context) (<-chan *UnitEvent, <-chan error) {
+
+	eventCh := make(chan *UnitEvent)
+	errCh := make(chan error, 1)
+
+	if err := c.conn.Subscribe(); err != nil {
+		errCh <- fmt.Errorf("unable to subscribe to systemd: %s", err)
+		return eventCh, errCh
+	}
+
+	updates := make(chan *dbus.PropertiesUpdate, 256)
+	errs := make(chan error, 1)
+	c.conn.SetPropertiesSubscriber(updates, errs)
+
+	go func() {
+		defer c.conn.Unsubscribe() // nolint: errcheck
+
+		ticker := time.NewTicker(systemdRetryTimer)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case update := <-updates:
+				if !strings.HasSuffix(update.UnitName, ".service") {
+					continue
+				}
+
+				event := &UnitEvent{Name: update.UnitName}
+				for property := range update.Changed {
+					event.Properties = append(event.Properties, property)
+				}
+				sort.Strings(event.Properties)
+
+				select {
+				case eventCh <- event:
+				case <-ctx.Done():
+					return
+				}
+
+			case err := <-errs:
+				errCh <- err
+				return
+
+			case <-ticker.C:
+				if !c.conn.Connected() {
+					errCh <- errors.New("lost connection to systemd")
+					return
+				}
+
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return eventCh, errCh
+}
+
+// ListUnits returns the names of the loaded service units.
+func (c *systemdClient) ListUnits() ([]string, error) {
+
+	units, err := c.conn.ListUnits()
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, u := range units {
+		if u.LoadState == "loaded" && strings.HasSuffix(u.Name, ".service") {
+			names = append(names, u.Name)
+		}
+	}
+
+	return names, nil
+}
+
+// GetUnit returns the unit with the given name.
+func (c *systemdClient) GetUnit(name string) (*Unit, error) {
+
+	properties, err := c.conn.GetUnitProperties(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if stringProperty(properties, "LoadState") != "loaded" {
+		return nil, nil
+	}
+
+	serviceProperties, err := c.conn.GetUnitTypeProperties(name, "Service")
+	if err != nil {
+		return nil, err
+	}
+
+	unit := &Unit{
+		Name:         name,
+		Description:  stringProperty(properties, "Description"),
+		ActiveState:  stringProperty(properties, "ActiveState"),
+		SubState:     stringProperty(properties, "SubState"),
+		FragmentPath: stringProperty(properties, "FragmentPath"),
+		Slice:        stringProperty(serviceProperties, "Slice"),
+		User:         stringProperty(serviceProperties, "User"),
+		ControlGroup: stringProperty(serviceProperties, "ControlGroup"),
+	}
+
+	if dropIns, ok := properties["DropInPaths"].([]string); ok {
+		unit.DropInPaths = dropIns
+	}
+
+	if pid, ok := serviceProperties["MainPID"].(uint32); ok {
+		unit.MainPID = int(pid)
+	}
+
+	return unit, nil
+}
+
+// Close closes the connection to systemd.
+func (c *systemdClient) Close() error {
+	c.conn.Close()
+	return nil
+}
+
+func stringProperty(properties map[string]interface{}, name string) string {
+
+	if value, ok := properties[name].(string); ok {
+		return value
+	}
+
+	return ""
+}
@@ -0,0 +1,39 @@
+package systemdmonitor
+
+import (
+	"go.aporeto.io/enforcerd/trireme-lib/monitor/extractors"
+)
+
+// Config is the configuration options to start a systemd monitor
+type Config struct {
+	EventMetadataExtractor extractors.SystemdUnitMetadataExtractor
+	// Allowlist are the patterns of the names of the units that are protected
+	// even if they have no X-Trireme-* setting, e.g. nginx.service or *.service.
+	Allowlist   []string
+	SyncAtStart bool
+	// Connect opens the connection to systemd. It defaults to the system bus.
+	Connect ConnectFunc
+}
+
+// DefaultConfig provides a default configuration
+func DefaultConfig() *Config {
+	return &Config{
+		EventMetadataExtractor: extractors.DefaultSystemdUnitMetadataExtractor,
+		SyncAtStart:            true,
+		Connect:                newSystemdClient,
+	}
+}
+
+// SetupDefaultConfig adds defaults to a partial configuration
+func SetupDefaultConfig(systemdConfig *Config) *Config {
+
+	defaultConfig := DefaultConfig()
+
+	if systemdConfig.EventMetadataExtractor == nil {
+		systemdConfig.EventMetadataExtractor = defaultConfig.EventMetadataExtractor
+	}
+	if systemdConfig.Connect == nil {
+		systemdConfig.Connect = defaultConfig.Connect
+	}
+	return systemdConfig
+}
@@ -0,0 +1,605 @@
+package systemdmonitor
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dchest/siphash"
+	"go.aporeto.io/enforcerd/trireme-lib/common"
+	"go.aporeto.io/enforcerd/trireme-lib/monitor/config"
+	"go.aporeto.io/enforcerd/trireme-lib/monitor/extractors"
+	"go.aporeto.io/enforcerd/trireme-lib/monitor/registerer"
+	"go.aporeto.io/enforcerd/trireme-lib/policy"
+	"go.aporeto.io/enforcerd/trireme-lib/utils/cgnetcls"
+	"go.uber.org/zap"
+)
+
+// cgroupProcsRoots are the roots of the hierarchies where systemd keeps the
+// cgroups of the units when the net_cls controller is in use.
+var cgroupProcsRoots = []string{
+	"/sys/fs/cgroup/systemd",
+	"/sys/fs/cgroup/unified",
+}
+
+// unitState is the state of a unit activated as a PU.
+type unitState struct {
+	puID string
+	mark string
+	tags []string
+}
+
+// SystemdMonitor monitors the service units of systemd over D-Bus and
+// activates the units that are protected as Linux process PUs.
+//
+// A unit is protected if one of its files carries a X-Trireme-* setting
+// or if its name matches the allowlist. The units are reconciled every
+// time their properties change: a protected unit is a PU as long as it
+// is active.
+type SystemdMonitor struct {
+	connect            ConnectFunc
+	client             SystemdClientInterface
+	clientLock         sync.RWMutex
+	metadataExtractor  extractors.SystemdUnitMetadataExtractor
+	allowlist          []string
+	syncAtStart        bool
+	config             *config.ProcessorConfig
+	netcls             cgnetcls.Cgroupnetcls
+	eventnotifications []chan *UnitEvent
+	numberOfQueues     int
+
+	// activated are the units that have been activated as PUs.
+	activated     map[string]*unitState
+	activatedLock sync.Mutex
+}
+
+// New returns a new systemd monitor.
+func New(context.Context) *SystemdMonitor {
+	return &SystemdMonitor{}
+}
+
+// SetupConfig provides a configuration to implmentations. Every implementation
+// can have its own config type.
+func (s *SystemdMonitor) SetupConfig(_ registerer.Registerer, cfg interface{}) error {
+
+	if cfg == nil {
+		cfg = DefaultConfig()
+	}
+
+	systemdConfig, ok := cfg.(*Config)
+	if !ok {
+		return fmt.Errorf("Invalid configuration specified")
+	}
+
+	// Setup defaults
+	systemdConfig = SetupDefaultConfig(systemdConfig)
+
+	for _, pattern := range systemdConfig.Allowlist {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid unit pattern %s: %s", pattern, err)
+		}
+	}
+
+	s.connect = systemdConfig.Connect
+	s.metadataExtractor = systemdConfig.EventMetadataExtractor
+	s.allowlist = systemdConfig.Allowlist
+	s.syncAtStart = systemdConfig.SyncAtStart
+	s.activated = map[string]*unitState{}
+
+	// With cgroup v2 the units are matched on their own cgroup. Otherwise
+	// the processes of the units are also placed in a net_cls cgroup, in
+	// the same hierarchy as the docker host network containers so that no
+	// release agent is involved.
+	if !cgnetcls.IsCgroupV2() {
+		s.netcls = cgnetcls.NewDockerCgroupNetController()
+	}
+
+	s.numberOfQueues = runtime.NumCPU()
+	s.eventnotifications = make([]chan *UnitEvent, s.numberOfQueues)
+	for i := 0; i < s.numberOfQueues; i++ {
+		s.eventnotifications[i] = make(chan *UnitEvent, 1000)
+	}
+
+	return nil
+}
+
+// SetupHandlers sets up handlers for monitors to invoke for various events such as
+// processing unit events and synchronization events. This will be called before Start()
+// by the consumer of the monitor
+func (s *SystemdMonitor) SetupHandlers(c *config.ProcessorConfig) {
+
+	s.config = c
+}
+
+// Run starts listening to the systemd signals. It returns once the existing
+// units have been synced, or right away if systemd is not reachable, in
+// which case periodic retries are attempted.
+func (s *SystemdMonitor) Run(ctx context.Context) error {
+
+	if err := s.config.IsComplete(); err != nil {
+		return fmt.Errorf("systemd config issue: %s", err)
+	}
+
+	s.eventProcessors(ctx)
+
+	listenerReady := make(chan struct{})
+	go s.eventListener(ctx, listenerReady)
+	<-listenerReady
+
+	return nil
+}
+
+// Resync reconciles all the loaded service units and the units that have
+// been activated.
+func (s *SystemdMonitor) Resync(ctx context.Context) error {
+
+	if !s.syncAtStart || s.config.Policy == nil {
+		zap.L().Debug("No synchronization of systemd units performed")
+		return nil
+	}
+
+	client := s.getClient()
+	if client == nil {
+		return errors.New("unable to sync systemd units: not connected to systemd")
+	}
+
+	units, err := client.ListUnits()
+	if err != nil {
+		return fmt.Errorf("unable to get unit list: %s", err)
+	}
+
+	s.activatedLock.Lock()
+	for name := range s.activated {
+		units = append(units, name)
+	}
+	s.activatedLock.Unlock()
+
+	s.config.ResyncLock.RLock()
+	defer s.config.ResyncLock.RUnlock()
+
+	seen := map[string]struct{}{}
+	for _, name := range units {
+		if _, ok := seen[name]; ok {
+			continue
+		}
+		seen[name] = struct{}{}
+
+		if err := s.reconcile(ctx, client, name); err != nil {
+			zap.L().Error("Unable to sync existing unit",
+				zap.String("unit", name),
+				zap.Error(err),
+			)
+		}
+	}
+
+	return nil
+}
+
+func (s *SystemdMonitor) getClient() SystemdClientInterface {
+	s.clientLock.RLock()
+	defer s.clientLock.RUnlock()
+
+	return s.client
+}
+
+func (s *SystemdMonitor) setClient(client SystemdClientInterface) {
+	s.clientLock.Lock()
+	defer s.clientLock.Unlock()
+
+	s.client = client
+}
+
+func (s *SystemdMonitor) getActivated(name string) *unitState {
+	s.activatedLock.Lock()
+	defer s.activatedLock.Unlock()
+
+	return s.activated[name]
+}
+
+func (s *SystemdMonitor) setActivated(name string, state *unitState) {
+	s.activatedLock.Lock()
+	defer s.activatedLock.Unlock()
+
+	if state != nil {
+		s.activated[name] = state
+	} else {
+		delete(s.activated, name)
+	}
+}
+
+// reconcile brings the PU of a unit in line with the current state of
+// the unit.
+func (s *SystemdMonitor) reconcile(ctx context.Context, client SystemdClientInterface, name string) error {
+
+	unit, err := client.GetUnit(name)
+	if err != nil {
+		return fmt.Errorf("unable to read unit properties: %s", err)
+	}
+
+	var settings *unitSettings
+	if unit != nil && isRunning(unit) {
+		settings, err = readUnitSettings(append([]string{unit.FragmentPath}, unit.DropInPaths...))
+		if err != nil {
+			return err
+		}
+	}
+
+	state := s.getActivated(name)
+	protected := settings != nil && s.isProtected(unit, settings)
+
+	switch {
+	case protected && state == nil:
+		return s.activate(ctx, unit, settings)
+	case protected:
+		return s.update(ctx, unit, settings, state)
+	case state != nil:
+		return s.deactivate(ctx, name, state)
+	}
+
+	return nil
+}
+
+// isRunning returns true if the unit is active and has processes.
+func isRunning(unit *Unit) bool {
+	return unit.ActiveState == activeStateActive && unit.MainPID > 0 && unit.ControlGroup != ""
+}
+
+// isProtected returns true if the unit must be activated as a PU. The
+// X-Trireme-* settings of a unit take precedence over the allowlist. The
+// unit of the enforcer is never protected.
+func (s *SystemdMonitor) isProtected(unit *Unit, settings *unitSettings) bool {
+
+	if unit.MainPID == os.Getpid() {
+		return false
+	}
+
+	if settings.found {
+		return settings.protect
+	}
+
+	for _, pattern := range s.allowlist {
+		if matched, _ := path.Match(pattern, unit.Name); matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// unitRuntime extracts the runtime of a unit.
+func (s *SystemdMonitor) unitRuntime(unit *Unit, settings *unitSettings) (*policy.PURuntime, error) {
+
+	return s.metadataExtractor(&extractors.SystemdUnitInfo{
+		PUID:         puIDFromUnitName(unit.Name),
+		Name:         unit.Name,
+		Description:  unit.Description,
+		Slice:        unit.Slice,
+		User:         unit.User,
+		MainPID:      unit.MainPID,
+		ControlGroup: unit.ControlGroup,
+		Labels:       settings.labels,
+		Ports:        settings.ports,
+		AutoPort:     settings.autoPort,
+	})
+}
+
+// activate creates the PU of a unit.
+func (s *SystemdMonitor) activate(ctx context.Context, unit *Unit, settings *unitSettings) error {
+
+	puID := puIDFromUnitName(unit.Name)
+
+	runtime, err := s.unitRuntime(unit, settings)
+	if err != nil {
+		return err
+	}
+
+	if err = s.config.Policy.HandlePUEvent(ctx, puID, common.EventCreate, runtime); err != nil {
+		return fmt.Errorf("unable to create pu for unit %s: %s", unit.Name, err)
+	}
+
+	if err = s.config.Policy.HandlePUEvent(ctx, puID, common.EventStart, runtime); err != nil {
+		return fmt.Errorf("unable to set policy: unit %s kept alive per policy: %s", unit.Name, err)
+	}
+
+	s.setActivated(unit.Name, &unitState{
+		puID: puID,
+		mark: runtime.Options().CgroupMark,
+		tags: runtime.Tags().GetSlice(),
+	})
+
+	if s.netcls != nil {
+		if err = s.setupNetcls(puID, runtime.Options().CgroupMark, unit); err != nil {
+			return fmt.Errorf("unable to setup net_cls cgroup for unit %s: %s", unit.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// update updates the PU of an active unit if its metadata have changed.
+// The processes started since the activation are also added to the net_cls
+// cgroup.
+func (s *SystemdMonitor) update(ctx context.Context, unit *Unit, settings *unitSettings, state *unitState) error {
+
+	runtime, err := s.unitRuntime(unit, settings)
+	if err != nil {
+		return err
+	}
+
+	// The mark of the PU cannot change.
+	options := runtime.Options()
+	options.CgroupMark = state.mark
+	runtime.SetOptions(options)
+
+	if s.netcls != nil {
+		for _, pid := range unitPIDs(unit) {
+			if err := s.netcls.AddProcess(state.puID, pid); err != nil {
+				zap.L().Debug("Unable to add process to net_cls cgroup",
+					zap.String("unit", unit.Name),
+					zap.Int("pid", pid),
+					zap.Error(err),
+				)
+			}
+		}
+	}
+
+	tags := runtime.Tags().GetSlice()
+	if equalTags(tags, state.tags) {
+		return nil
+	}
+
+	if err := s.config.Policy.HandlePUEvent(ctx, state.puID, common.EventUpdate, runtime); err != nil {
+		return fmt.Errorf("unable to update pu for unit %s: %s", unit.Name, err)
+	}
+
+	s.setActivated(unit.Name, &unitState{
+		puID: state.puID,
+		mark: state.mark,
+		tags: tags,
+	})
+
+	return nil
+}
+
+// deactivate stops and destroys the PU of a unit.
+func (s *SystemdMonitor) deactivate(ctx context.Context, name string, state *unitState) error {
+
+	s.setActivated(name, nil)
+
+	runtime := policy.NewPURuntimeWithDefaults()
+
+	if err := s.config.Policy.HandlePUEvent(ctx, state.puID, common.EventStop, runtime); err != nil {
+		zap.L().Warn("Failed to handle stop event",
+			zap.String("unit", name),
+			zap.Error(err),
+		)
+	}
+
+	if err := s.config.Policy.HandlePUEvent(ctx, state.puID, common.EventDestroy, runtime); err != nil {
+		zap.L().Error("Failed to handle delete event",
+			zap.String("unit", name),
+			zap.Error(err),
+		)
+	}
+
+	if s.netcls != nil {
+		if err := s.netcls.DeleteCgroup(state.puID); err != nil {
+			zap.L().Warn("Failed to clean netcls group",
+				zap.String("unit", name),
+				zap.Error(err),
+			)
+		}
+	}
+
+	return nil
+}
+
+// setupNetcls places the processes of the unit in a net_cls cgroup. The
+// processes stay in the cgroups of the unit in the other hierarchies, so
+// that systemd keeps track of them.
+func (s *SystemdMonitor) setupNetcls(puID string, markval string, unit *Unit) (err error) {
+
+	if err = s.netcls.Creategroup(puID); err != nil {
+		return err
+	}
+
+	// Clean the cgroup on exit, if we have failed to activate.
+	defer func() {
+		if err != nil {
+			if derr := s.netcls.DeleteCgroup(puID); derr != nil {
+				zap.L().Warn("Failed to clean cgroup",
+					zap.String("puID", puID),
+					zap.Error(derr),
+					zap.Error(err),
+				)
+			}
+		}
+	}()
+
+	if markval == "" {
+		return errors.New("mark value not found")
+	}
+
+	mark, _ := strconv.ParseUint(markval, 10, 32)
+	if err = s.netcls.AssignMark(puID, mark); err != nil {
+		return err
+	}
+
+	for _, pid := range unitPIDs(unit) {
+		if err = s.netcls.AddProcess(puID, pid); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// unitPIDs returns the processes in the cgroup of the unit. It falls back
+// to the main process if the cgroup cannot be read.
+func unitPIDs(unit *Unit) []int {
+
+	for _, root := range cgroupProcsRoots {
+		data, err := ioutil.ReadFile(filepath.Join(root, unit.ControlGroup, "cgroup.procs"))
+		if err != nil {
+			continue
+		}
+
+		pids := []int{}
+		for _, line := range strings.Fields(string(data)) {
+			if pid, err := strconv.Atoi(line); err == nil {
+				pids = append(pids, pid)
+			}
+		}
+
+		if len(pids) > 0 {
+			return pids
+		}
+	}
+
+	return []int{unit.MainPID}
+}
+
+func equalTags(a, b []string) bool {
+
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// sendRequestToQueue sends a request to a channel based on a hash function.
+// This ensures that all the events of a unit fall onto the same queue.
+func (s *SystemdMonitor) sendRequestToQueue(event *UnitEvent) {
+
+	key0 := uint64(256203161)
+	key1 := uint64(982451653)
+
+	h := siphash.Hash(key0, key1, []byte(event.Name))
+
+	s.eventnotifications[int(h%uint64(s.numberOfQueues))] <- event
+}
+
+// eventProcessors reconciles the units of the events. The queues are
+// processed in parallel.
+func (s *SystemdMonitor) eventProcessors(ctx context.Context) {
+
+	for i := 0; i < s.numberOfQueues; i++ {
+		go func(i int) {
+			for {
+				select {
+				case event := <-s.eventnotifications[i]:
+					client := s.getClient()
+					if client == nil {
+						continue
+					}
+					if err := s.reconcile(ctx, client, event.Name); err != nil {
+						zap.L().Error("Unable to handle systemd event",
+							zap.String("unit", event.Name),
+							zap.Strings("properties", event.Properties),
+							zap.Error(err),
+						)
+					}
+				case <-ctx.Done():
+					return
+				}
+			}
+		}(i)
+	}
+}
+
+// eventListener connects to systemd and passes the property changes to
+// the processors. The units are resynced every time the connection is
+// established, since changes may have been missed while disconnected.
+// listenerReady is closed after the first attempt to connect.
+func (s *SystemdMonitor) eventListener(ctx context.Context, listenerReady chan struct{}) {
+
+	ready := listenerReady
+	signalReady := func() {
+		if ready != nil {
+			close(ready)
+			ready = nil
+		}
+	}
+	defer signalReady()
+
+	for {
+		client, err := s.connect()
+		if err == nil {
+			events, errs := client.Subscribe(ctx)
+			s.setClient(client)
+
+			if err := s.Resync(ctx); err != nil {
+				zap.L().Error("Unable to resync systemd units", zap.Error(err))
+			}
+			signalReady()
+
+			done := !s.listener(ctx, events, errs)
+
+			s.setClient(nil)
+			client.Close() // nolint: errcheck
+
+			if done {
+				return
+			}
+		} else {
+			zap.L().Debug("Unable to reach systemd", zap.Error(err))
+			signalReady()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(systemdRetryTimer):
+		}
+	}
+}
+
+// listener dispatches the events until the subscription fails. It returns
+// false if the context is done.
+func (s *SystemdMonitor) listener(ctx context.Context, events <-chan *UnitEvent, errs <-chan error) bool {
+
+	for {
+		select {
+		case event := <-events:
+			zap.L().Debug("Got event from systemd",
+				zap.String("unit", event.Name),
+				zap.Strings("properties", event.Properties),
+			)
+			s.sendRequestToQueue(event)
+
+		case err := <-errs:
+			zap.L().Warn("Received systemd subscription error", zap.Error(err))
+			return true
+
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// puIDFromUnitName returns the PU ID of a unit. The names of the units are
+// hashed since they do not fit in the names of the cgroups and ipsets.
+func puIDFromUnitName(name string) string {
+
+	hash := sha256.Sum256([]byte("systemd/" + name))
+
+	return hex.EncodeToString(hash[:])[:12]
+}
@@ -0,0 +1,408 @@
+// +build linux
+
+package systemdmonitor
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.aporeto.io/enforcerd/trireme-lib/collector"
+	"go.aporeto.io/enforcerd/trireme-lib/common"
+	"go.aporeto.io/enforcerd/trireme-lib/monitor/config"
+	"go.aporeto.io/enforcerd/trireme-lib/policy"
+	"go.aporeto.io/enforcerd/trireme-lib/policy/mockpolicy"
+	"go.aporeto.io/enforcerd/trireme-lib/utils/cgnetcls/mockcgnetcls"
+)
+
+// fakeSystemd is a fake D-Bus connection to systemd.
+type fakeSystemd struct {
+	units      map[string]*Unit
+	events     chan *UnitEvent
+	errs       chan error
+	subscribed chan struct{}
+	down       bool
+	sync.Mutex
+}
+
+func newFakeSystemd() *fakeSystemd {
+	return &fakeSystemd{
+		units:      map[string]*Unit{},
+		events:     make(chan *UnitEvent),
+		errs:       make(chan error),
+		subscribed: make(chan struct{}, 10),
+	}
+}
+
+func (f *fakeSystemd) connect() (SystemdClientInterface, error) {
+	f.Lock()
+	defer f.Unlock()
+
+	if f.down {
+		return nil, errors.New("no system bus")
+	}
+
+	return f, nil
+}
+
+func (f *fakeSystemd) Subscribe(ctx context.Context) (<-chan *UnitEvent, <-chan error) {
+	f.subscribed <- struct{}{}
+	return f.events, f.errs
+}
+
+func (f *fakeSystemd) ListUnits() ([]string, error) {
+	f.Lock()
+	defer f.Unlock()
+
+	names := []string{}
+	for name := range f.units {
+		names = append(names, name)
+	}
+
+	return names, nil
+}
+
+func (f *fakeSystemd) GetUnit(name string) (*Unit, error) {
+	f.Lock()
+	defer f.Unlock()
+
+	u, ok := f.units[name]
+	if !ok {
+		return nil, nil
+	}
+
+	unit := *u
+	return &unit, nil
+}
+
+func (f *fakeSystemd) Close() error {
+	return nil
+}
+
+func (f *fakeSystemd) setUnit(unit *Unit) {
+	f.Lock()
+	defer f.Unlock()
+
+	f.units[unit.Name] = unit
+}
+
+func (f *fakeSystemd) setActiveState(name string, state string) {
+	f.Lock()
+	defer f.Unlock()
+
+	f.units[name].ActiveState = state
+}
+
+type testUnits struct {
+	dir       string
+	fake      *fakeSystemd
+	webDropIn string
+}
+
+// newTestUnits creates a unit with a drop-in, a unit matching the
+// allowlist, a unit opting out of the allowlist, a unit without settings
+// and a stopped unit. The cgroups of the units are created in the test
+// directory.
+func newTestUnits(t *testing.T) *testUnits {
+
+	dir, err := ioutil.TempDir("", "systemd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cgroupProcsRoots = []string{dir}
+
+	u := &testUnits{dir: dir, fake: newFakeSystemd()}
+
+	u.webDropIn = u.writeFile("web.service.d/trireme.conf", "[Unit]\nX-Trireme-Labels=app=web\nX-Trireme-Ports=80\n")
+	u.addUnit("web.service", 100, u.webDropIn)
+	u.addUnit("db.service", 200)
+	u.addUnit("dbtool.service", 300, u.writeFile("dbtool.service.d/trireme.conf", "[Unit]\nX-Trireme-Protect=no\n"))
+	u.addUnit("cron.service", 400)
+	u.addUnit("stopped.service", 0, u.writeFile("stopped.service.d/trireme.conf", "[Unit]\nX-Trireme-Labels=app=stopped\n"))
+	u.fake.setActiveState("stopped.service", "inactive")
+	u.addUnit("enforcerd.service", os.Getpid())
+
+	return u
+}
+
+func (u *testUnits) writeFile(name, content string) string {
+	p := filepath.Join(u.dir, name)
+	os.MkdirAll(filepath.Dir(p), 0755)         // nolint: errcheck
+	ioutil.WriteFile(p, []byte(content), 0644) // nolint: errcheck
+	return p
+}
+
+func (u *testUnits) addUnit(name string, pid int, dropIns ...string) {
+	cgroup := "/system.slice/" + name
+	if pid > 0 {
+		u.writeFile(filepath.Join(cgroup, "cgroup.procs"), "")
+	}
+	u.fake.setUnit(&Unit{
+		Name:         name,
+		Description:  name,
+		ActiveState:  activeStateActive,
+		SubState:     "running",
+		Slice:        "system.slice",
+		MainPID:      pid,
+		ControlGroup: cgroup,
+		DropInPaths:  dropIns,
+	})
+}
+
+func (u *testUnits) setProcesses(name string, procs string) {
+	u.writeFile(filepath.Join("/system.slice", name, "cgroup.procs"), procs)
+}
+
+func (u *testUnits) close() {
+	os.RemoveAll(u.dir) // nolint: errcheck
+}
+
+func testSystemdMonitor(puHandler policy.Resolver, cfg *Config) *SystemdMonitor {
+
+	s := New(context.Background())
+	s.SetupHandlers(&config.ProcessorConfig{
+		Collector:  &collector.DefaultCollector{},
+		Policy:     puHandler,
+		ResyncLock: &sync.RWMutex{},
+	})
+
+	if err := s.SetupConfig(nil, cfg); err != nil {
+		return nil
+	}
+
+	return s
+}
+
+func TestSetupConfig(t *testing.T) {
+
+	Convey("Given a systemd monitor", t, func() {
+		s := New(context.Background())
+
+		Convey("When I provide an invalid config, I should get an error", func() {
+			So(s.SetupConfig(nil, "invalid"), ShouldNotBeNil)
+		})
+
+		Convey("When I provide an invalid allowlist, I should get an error", func() {
+			So(s.SetupConfig(nil, &Config{Allowlist: []string{"[web"}}), ShouldNotBeNil)
+		})
+
+		Convey("When I provide no config, the defaults should be used", func() {
+			So(s.SetupConfig(nil, nil), ShouldBeNil)
+			So(s.syncAtStart, ShouldBeTrue)
+			So(s.allowlist, ShouldBeEmpty)
+			So(s.metadataExtractor, ShouldNotBeNil)
+			So(s.connect, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestResync(t *testing.T) {
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	Convey("Given systemd with service units", t, func() {
+		u := newTestUnits(t)
+		defer u.close()
+		u.setProcesses("web.service", "100\n101\n")
+
+		puHandler := mockpolicy.NewMockResolver(ctrl)
+		netcls := mockcgnetcls.NewMockCgroupnetcls(ctrl)
+
+		s := testSystemdMonitor(puHandler, &Config{
+			SyncAtStart: true,
+			Allowlist:   []string{"db*.service", "enforcerd.service"},
+			Connect:     u.fake.connect,
+		})
+		So(s, ShouldNotBeNil)
+		s.netcls = netcls
+
+		webID := puIDFromUnitName("web.service")
+		dbID := puIDFromUnitName("db.service")
+
+		Convey("When the monitor starts, the protected units should be activated", func() {
+			// The resync runs in the listener, the runtimes are checked once
+			// the monitor is running.
+			var web, db policy.RuntimeReader
+			puHandler.EXPECT().HandlePUEvent(gomock.Any(), webID, common.EventCreate, gomock.Any()).Return(nil)
+			puHandler.EXPECT().HandlePUEvent(gomock.Any(), webID, common.EventStart, gomock.Any()).DoAndReturn(
+				func(_ context.Context, _ string, _ common.Event, r policy.RuntimeReader) error {
+					web = r
+					return nil
+				})
+			puHandler.EXPECT().HandlePUEvent(gomock.Any(), dbID, common.EventCreate, gomock.Any()).Return(nil)
+			puHandler.EXPECT().HandlePUEvent(gomock.Any(), dbID, common.EventStart, gomock.Any()).DoAndReturn(
+				func(_ context.Context, _ string, _ common.Event, r policy.RuntimeReader) error {
+					db = r
+					return nil
+				})
+
+			netcls.EXPECT().Creategroup(webID).Return(nil)
+			netcls.EXPECT().AssignMark(webID, gomock.Any()).Return(nil)
+			netcls.EXPECT().AddProcess(webID, 100).Return(nil)
+			netcls.EXPECT().AddProcess(webID, 101).Return(nil)
+			netcls.EXPECT().Creategroup(dbID).Return(nil)
+			netcls.EXPECT().AssignMark(dbID, gomock.Any()).Return(nil)
+			netcls.EXPECT().AddProcess(dbID, 200).Return(nil)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			So(s.Run(ctx), ShouldBeNil)
+
+			So(web, ShouldNotBeNil)
+			So(web.PUType(), ShouldEqual, common.LinuxProcessPU)
+			So(web.Options().CgroupName, ShouldEqual, webID)
+			So(web.Options().Services, ShouldHaveLength, 1)
+			app, _ := web.Tag("@usr:app")
+			So(app, ShouldEqual, "web")
+			unit, _ := web.Tag("@app:systemd:unit")
+			So(unit, ShouldEqual, "web.service")
+
+			So(db, ShouldNotBeNil)
+			So(db.Options().Services, ShouldBeEmpty)
+
+			So(s.getActivated("web.service"), ShouldNotBeNil)
+			So(s.getActivated("db.service"), ShouldNotBeNil)
+			So(s.getActivated("dbtool.service"), ShouldBeNil)
+			So(s.getActivated("cron.service"), ShouldBeNil)
+			So(s.getActivated("stopped.service"), ShouldBeNil)
+			So(s.getActivated("enforcerd.service"), ShouldBeNil)
+		})
+
+		Convey("When an activated unit has disappeared, its PU should be destroyed", func() {
+			s.setClient(u.fake)
+			s.setActivated("gone.service", &unitState{puID: "gone"})
+
+			puHandler.EXPECT().HandlePUEvent(gomock.Any(), webID, gomock.Any(), gomock.Any()).Times(2).Return(nil)
+			puHandler.EXPECT().HandlePUEvent(gomock.Any(), dbID, gomock.Any(), gomock.Any()).Times(2).Return(nil)
+			puHandler.EXPECT().HandlePUEvent(gomock.Any(), "gone", common.EventStop, gomock.Any()).Return(nil)
+			puHandler.EXPECT().HandlePUEvent(gomock.Any(), "gone", common.EventDestroy, gomock.Any()).Return(nil)
+			netcls.EXPECT().Creategroup(gomock.Any()).Times(2).Return(nil)
+			netcls.EXPECT().AssignMark(gomock.Any(), gomock.Any()).Times(2).Return(nil)
+			netcls.EXPECT().AddProcess(gomock.Any(), gomock.Any()).Times(3).Return(nil)
+			netcls.EXPECT().DeleteCgroup("gone").Return(nil)
+
+			So(s.Resync(context.Background()), ShouldBeNil)
+			So(s.getActivated("gone.service"), ShouldBeNil)
+		})
+
+		Convey("When systemd is not reachable, resync should fail", func() {
+			So(s.Resync(context.Background()), ShouldNotBeNil)
+		})
+	})
+}
+
+func TestEvents(t *testing.T) {
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	Convey("Given a running systemd monitor", t, func() {
+		u := newTestUnits(t)
+		defer u.close()
+		u.fake.setActiveState("web.service", "inactive")
+
+		puHandler := mockpolicy.NewMockResolver(ctrl)
+		netcls := mockcgnetcls.NewMockCgroupnetcls(ctrl)
+
+		s := testSystemdMonitor(puHandler, &Config{
+			SyncAtStart: false,
+			Connect:     u.fake.connect,
+		})
+		So(s, ShouldNotBeNil)
+		s.netcls = netcls
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		So(s.Run(ctx), ShouldBeNil)
+		<-u.fake.subscribed
+
+		webID := puIDFromUnitName("web.service")
+
+		done := make(chan common.Event, 10)
+		record := func(_ context.Context, _ string, event common.Event, _ policy.RuntimeReader) error {
+			done <- event
+			return nil
+		}
+		added := make(chan int, 10)
+		addProcess := func(_ string, pid int) error {
+			added <- pid
+			return nil
+		}
+
+		Convey("The PU of a unit should follow the state and the settings of the unit", func() {
+			var mark string
+			puHandler.EXPECT().HandlePUEvent(gomock.Any(), webID, common.EventCreate, gomock.Any()).DoAndReturn(record)
+			puHandler.EXPECT().HandlePUEvent(gomock.Any(), webID, common.EventStart, gomock.Any()).DoAndReturn(
+				func(_ context.Context, _ string, event common.Event, r policy.RuntimeReader) error {
+					mark = r.Options().CgroupMark
+					done <- event
+					return nil
+				})
+			netcls.EXPECT().Creategroup(webID).Return(nil)
+			netcls.EXPECT().AssignMark(webID, gomock.Any()).Return(nil)
+			netcls.EXPECT().AddProcess(webID, 100).DoAndReturn(addProcess)
+
+			// The unit of the enforcer and the units without settings are ignored.
+			u.fake.events <- &UnitEvent{Name: "cron.service", Properties: []string{"ActiveState"}}
+			u.fake.events <- &UnitEvent{Name: "enforcerd.service", Properties: []string{"ActiveState"}}
+
+			u.fake.setActiveState("web.service", activeStateActive)
+			u.fake.events <- &UnitEvent{Name: "web.service", Properties: []string{"ActiveState", "SubState"}}
+
+			So(<-done, ShouldEqual, common.EventCreate)
+			So(<-done, ShouldEqual, common.EventStart)
+			So(<-added, ShouldEqual, 100)
+
+			// A change of the labels updates the PU and keeps its mark.
+			var updatedMark, app string
+			puHandler.EXPECT().HandlePUEvent(gomock.Any(), webID, common.EventUpdate, gomock.Any()).DoAndReturn(
+				func(_ context.Context, _ string, event common.Event, r policy.RuntimeReader) error {
+					updatedMark = r.Options().CgroupMark
+					app, _ = r.Tag("@usr:app")
+					done <- event
+					return nil
+				})
+			netcls.EXPECT().AddProcess(webID, 100).Return(nil)
+			netcls.EXPECT().AddProcess(webID, 102).DoAndReturn(addProcess)
+
+			u.writeFile("web.service.d/trireme.conf", "[Unit]\nX-Trireme-Labels=app=frontend\n")
+			u.setProcesses("web.service", "100\n102\n")
+			u.fake.events <- &UnitEvent{Name: "web.service", Properties: []string{"DropInPaths"}}
+
+			So(<-added, ShouldEqual, 102)
+			So(<-done, ShouldEqual, common.EventUpdate)
+			So(updatedMark, ShouldEqual, mark)
+			So(app, ShouldEqual, "frontend")
+
+			// A stopped unit is deactivated.
+			puHandler.EXPECT().HandlePUEvent(gomock.Any(), webID, common.EventStop, gomock.Any()).DoAndReturn(record)
+			puHandler.EXPECT().HandlePUEvent(gomock.Any(), webID, common.EventDestroy, gomock.Any()).DoAndReturn(record)
+			netcls.EXPECT().DeleteCgroup(webID).DoAndReturn(func(string) error {
+				added <- 0
+				return nil
+			})
+
+			u.fake.setActiveState("web.service", "inactive")
+			u.fake.events <- &UnitEvent{Name: "web.service", Properties: []string{"ActiveState"}}
+
+			So(<-done, ShouldEqual, common.EventStop)
+			So(<-done, ShouldEqual, common.EventDestroy)
+			<-added
+			So(s.getActivated("web.service"), ShouldBeNil)
+		})
+
+		Convey("When the subscription fails, the monitor should subscribe again", func() {
+			u.fake.errs <- errors.New("disconnected")
+			<-u.fake.subscribed
+		})
+	})
+}
@@ -0,0 +1,59 @@
+package systemdmonitor
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	// activeStateActive is the active state of a running unit.
+	activeStateActive = "active"
+
+	// settingPrefix is the prefix of the unit file settings read by the monitor.
+	settingPrefix = "X-Trireme-"
+
+	// systemdRetryTimer is the time after which we will retry to connect to systemd.
+	systemdRetryTimer = 2 * time.Second
+)
+
+// Unit is the subset of the properties of a systemd service unit used
+// by the monitor.
+type Unit struct {
+	Name         string
+	Description  string
+	ActiveState  string
+	SubState     string
+	Slice        string
+	User         string
+	MainPID      int
+	ControlGroup string
+	FragmentPath string
+	DropInPaths  []string
+}
+
+// UnitEvent is a change of the properties of a unit.
+type UnitEvent struct {
+	Name       string
+	Properties []string
+}
+
+// SystemdClientInterface is the interface to the systemd D-Bus API used by
+// the monitor, so that we can do tests with a fake connection.
+type SystemdClientInterface interface {
+	// Subscribe returns the property changes of the service units. The
+	// error channel receives an error when the subscription ends.
+	Subscribe(ctx context.Context) (<-chan *UnitEvent, <-chan error)
+
+	// ListUnits returns the names of the loaded service units.
+	ListUnits() ([]string, error)
+
+	// GetUnit returns the unit with the given name. It returns a nil unit
+	// if the unit is not loaded.
+	GetUnit(name string) (*Unit, error)
+
+	// Close closes the connection to systemd.
+	Close() error
+}
+
+// ConnectFunc opens a new connection to systemd.
+type ConnectFunc func() (SystemdClientInterface, error)
@@ -0,0 +1,166 @@
+package systemdmonitor
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// unitSettings are the X-Trireme-* settings of the files of a unit. systemd
+// ignores the settings prefixed with X- so they can be added to any unit,
+// usually with a drop-in:
+//
+//	[Unit]
+//	X-Trireme-Labels=app=web env=prod
+//	X-Trireme-Ports=80 443 53/udp
+//
+// A unit with any X-Trireme-* setting is protected, unless X-Trireme-Protect
+// is false.
+type unitSettings struct {
+	found    bool
+	protect  bool
+	labels   map[string]string
+	ports    []string
+	autoPort bool
+}
+
+func newUnitSettings() *unitSettings {
+	return &unitSettings{
+		protect: true,
+		labels:  map[string]string{},
+	}
+}
+
+// readUnitSettings reads the X-Trireme-* settings of the given unit files.
+// The files are read in order, so that the drop-ins override the unit file.
+// The files that do not exist anymore are ignored.
+func readUnitSettings(paths []string) (*unitSettings, error) {
+
+	settings := newUnitSettings()
+
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+
+		f, err := os.Open(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to open unit file: %s", err)
+		}
+
+		err = settings.parse(f)
+		f.Close() // nolint: errcheck
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse unit file %s: %s", path, err)
+		}
+	}
+
+	return settings, nil
+}
+
+// parse reads the X-Trireme-* settings of the [Unit] and [Service] sections
+// of a unit file. An empty X-Trireme-Labels or X-Trireme-Ports resets the
+// list, like the list settings of systemd.
+func (s *unitSettings) parse(r io.Reader) error {
+
+	section := ""
+	line := ""
+
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		text := strings.TrimSpace(sc.Text())
+
+		// Lines ending with a backslash are continued on the next line.
+		if strings.HasSuffix(text, "\\") {
+			line += strings.TrimSuffix(text, "\\") + " "
+			continue
+		}
+		line, text = "", line+text
+
+		if text == "" || text[0] == '#' || text[0] == ';' {
+			continue
+		}
+
+		if text[0] == '[' && text[len(text)-1] == ']' {
+			section = text[1 : len(text)-1]
+			continue
+		}
+
+		if section != "Unit" && section != "Service" {
+			continue
+		}
+
+		parts := strings.SplitN(text, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		key := strings.TrimSpace(parts[0])
+		value := strings.TrimSpace(parts[1])
+
+		if !strings.HasPrefix(key, settingPrefix) {
+			continue
+		}
+		s.found = true
+
+		if err := s.set(strings.TrimPrefix(key, settingPrefix), value); err != nil {
+			return fmt.Errorf("%s: %s", key, err)
+		}
+	}
+
+	return sc.Err()
+}
+
+func (s *unitSettings) set(key, value string) (err error) {
+
+	switch key {
+	case "Protect":
+		s.protect, err = parseBoolean(value)
+
+	case "AutoPort":
+		s.autoPort, err = parseBoolean(value)
+
+	case "Labels":
+		if value == "" {
+			s.labels = map[string]string{}
+		}
+		for _, label := range strings.Fields(value) {
+			parts := strings.SplitN(label, "=", 2)
+			if len(parts) == 1 {
+				parts = append(parts, "")
+			}
+			s.labels[parts[0]] = parts[1]
+		}
+
+	case "Ports":
+		if value == "" {
+			s.ports = nil
+		}
+		s.ports = append(s.ports, strings.Fields(value)...)
+
+	default:
+		zap.L().Warn("Ignoring unknown unit setting", zap.String("setting", settingPrefix+key))
+	}
+
+	return err
+}
+
+// parseBoolean parses a boolean the way systemd does.
+func parseBoolean(value string) (bool, error) {
+
+	switch strings.ToLower(value) {
+	case "1", "yes", "y", "true", "t", "on":
+		return true, nil
+	case "0", "no", "n", "false", "f", "off":
+		return false, nil
+	}
+
+	return false, fmt.Errorf("invalid boolean %q", value)
+}
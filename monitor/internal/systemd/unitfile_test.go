@@ -0,0 +1,75 @@
+// +build linux
+
+package systemdmonitor
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUnitSettings(t *testing.T) {
+
+	Convey("Given unit files", t, func() {
+		dir, err := ioutil.TempDir("", "systemd")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir) // nolint: errcheck
+
+		write := func(name, content string) string {
+			p := filepath.Join(dir, name)
+			So(ioutil.WriteFile(p, []byte(content), 0644), ShouldBeNil)
+			return p
+		}
+
+		Convey("A unit without X-Trireme-* setting should not be found", func() {
+			s, err := readUnitSettings([]string{write("plain.service", "[Service]\nExecStart=/bin/true\n")})
+			So(err, ShouldBeNil)
+			So(s.found, ShouldBeFalse)
+		})
+
+		Convey("The settings of the drop-ins should override the unit file", func() {
+			unit := write("web.service", strings.Join([]string{
+				"[Unit]",
+				"Description=web",
+				"X-Trireme-Labels=app=web \\",
+				"  env=prod",
+				"X-Trireme-Ports=80",
+				"",
+				"[Install]",
+				"X-Trireme-Ports=8080",
+			}, "\n"))
+			dropIn := write("trireme.conf", strings.Join([]string{
+				"# Trireme settings",
+				"[Service]",
+				"X-Trireme-Labels=",
+				"X-Trireme-Labels=tier=front flag",
+				"X-Trireme-Ports=443 53/udp",
+				"X-Trireme-AutoPort=yes",
+			}, "\n"))
+
+			s, err := readUnitSettings([]string{unit, dropIn, filepath.Join(dir, "missing.conf")})
+			So(err, ShouldBeNil)
+			So(s.found, ShouldBeTrue)
+			So(s.protect, ShouldBeTrue)
+			So(s.autoPort, ShouldBeTrue)
+			So(s.labels, ShouldResemble, map[string]string{"tier": "front", "flag": ""})
+			So(s.ports, ShouldResemble, []string{"80", "443", "53/udp"})
+		})
+
+		Convey("A unit should be able to opt out", func() {
+			s, err := readUnitSettings([]string{write("optout.conf", "[Unit]\nX-Trireme-Protect=off\n")})
+			So(err, ShouldBeNil)
+			So(s.found, ShouldBeTrue)
+			So(s.protect, ShouldBeFalse)
+		})
+
+		Convey("An invalid boolean should be an error", func() {
+			_, err := readUnitSettings([]string{write("bad.conf", "[Unit]\nX-Trireme-Protect=maybe\n")})
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
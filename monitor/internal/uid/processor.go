@@ -235,6 +235,15 @@ func (u *uidProcessor) createAndStart(ctx context.Context, eventInfo *common.Eve
 			return err
 		}
 
+		// The processes of the user are in the cgroups of their pids, under
+		// the cgroup of the user. With cgroup v2 the PU is matched on the
+		// cgroup of the user, which also matches its descendants.
+		if cgnetcls.IsCgroupV2() {
+			options := runtimeInfo.Options()
+			options.CgroupPath = cgnetcls.CgroupV2Path(common.TriremeUIDCgroupPath, puID)
+			runtimeInfo.SetOptions(options)
+		}
+
 		publishedContextID := puID
 		// Setup the run time
 		if !startOnly {
@@ -8,9 +8,12 @@ import (
 
 	"go.aporeto.io/enforcerd/trireme-lib/common"
 	"go.aporeto.io/enforcerd/trireme-lib/monitor/config"
+	containerdmonitor "go.aporeto.io/enforcerd/trireme-lib/monitor/internal/containerd"
 	dockermonitor "go.aporeto.io/enforcerd/trireme-lib/monitor/internal/docker"
 	k8smonitor "go.aporeto.io/enforcerd/trireme-lib/monitor/internal/k8s"
 	linuxmonitor "go.aporeto.io/enforcerd/trireme-lib/monitor/internal/linux"
+	podmanmonitor "go.aporeto.io/enforcerd/trireme-lib/monitor/internal/podman"
+	systemdmonitor "go.aporeto.io/enforcerd/trireme-lib/monitor/internal/systemd"
 	"go.aporeto.io/enforcerd/trireme-lib/monitor/registerer"
 	"go.aporeto.io/enforcerd/trireme-lib/monitor/remoteapi/server"
 	"go.uber.org/zap"
@@ -38,6 +41,10 @@ func NewMonitors(ctx context.Context, opts ...Options) (Monitor, error) {
 		opt(c)
 	}
 
+	if c.Err != nil {
+		return nil, c.Err
+	}
+
 	if err = c.Common.IsComplete(); err != nil {
 		return nil, err
 	}
@@ -64,6 +71,30 @@ func NewMonitors(ctx context.Context, opts ...Options) (Monitor, error) {
 			}
 			m.monitors[config.Docker] = mon
 
+		case config.Containerd:
+			mon := containerdmonitor.New(ctx)
+			mon.SetupHandlers(c.Common)
+			if err := mon.SetupConfig(m.registerer, v); err != nil {
+				return nil, fmt.Errorf("Containerd: %s", err.Error())
+			}
+			m.monitors[config.Containerd] = mon
+
+		case config.Podman:
+			mon := podmanmonitor.New(ctx)
+			mon.SetupHandlers(c.Common)
+			if err := mon.SetupConfig(nil, v); err != nil {
+				return nil, fmt.Errorf("Podman: %s", err.Error())
+			}
+			m.monitors[config.Podman] = mon
+
+		case config.Systemd:
+			mon := systemdmonitor.New(ctx)
+			mon.SetupHandlers(c.Common)
+			if err := mon.SetupConfig(nil, v); err != nil {
+				return nil, fmt.Errorf("Systemd: %s", err.Error())
+			}
+			m.monitors[config.Systemd] = mon
+
 		case config.K8s:
 			mon := k8smonitor.New(ctx)
 			mon.SetupHandlers(c.Common)
@@ -74,6 +74,10 @@ func NewMonitors(ctx context.Context, opts ...Options) (Monitor, error) {
 		opt(c)
 	}
 
+	if c.Err != nil {
+		return nil, c.Err
+	}
+
 	if err = c.Common.IsComplete(); err != nil {
 		return nil, err
 	}
@@ -1,15 +1,19 @@
 package monitor
 
 import (
+	"fmt"
 	"sync"
 
 	"go.aporeto.io/enforcerd/trireme-lib/collector"
 	"go.aporeto.io/enforcerd/trireme-lib/monitor/config"
 	"go.aporeto.io/enforcerd/trireme-lib/monitor/external"
 	"go.aporeto.io/enforcerd/trireme-lib/monitor/extractors"
+	containerdmonitor "go.aporeto.io/enforcerd/trireme-lib/monitor/internal/containerd"
 	dockermonitor "go.aporeto.io/enforcerd/trireme-lib/monitor/internal/docker"
 	k8smonitor "go.aporeto.io/enforcerd/trireme-lib/monitor/internal/k8s"
 	linuxmonitor "go.aporeto.io/enforcerd/trireme-lib/monitor/internal/linux"
+	podmanmonitor "go.aporeto.io/enforcerd/trireme-lib/monitor/internal/podman"
+	systemdmonitor "go.aporeto.io/enforcerd/trireme-lib/monitor/internal/systemd"
 	"go.aporeto.io/enforcerd/trireme-lib/policy"
 	criapi "k8s.io/cri-api/pkg/apis"
 )
@@ -20,6 +24,15 @@ type Options func(*config.MonitorConfig)
 // DockerMonitorOption is provided using functional arguments.
 type DockerMonitorOption func(*dockermonitor.Config)
 
+// ContainerdMonitorOption is provided using functional arguments.
+type ContainerdMonitorOption func(*containerdmonitor.Config)
+
+// PodmanMonitorOption is provided using functional arguments.
+type PodmanMonitorOption func(*podmanmonitor.Config)
+
+// SystemdMonitorOption is provided using functional arguments.
+type SystemdMonitorOption func(*systemdmonitor.Config)
+
 // K8smonitorOption is provided using functional arguments.
 type K8smonitorOption func(*k8smonitor.Config)
 
@@ -33,6 +46,16 @@ func SubOptionMonitorLinuxExtractor(extractor extractors.EventMetadataExtractor)
 	}
 }
 
+// SubOptionMonitorLinuxBinaryVerifier provides a way to verify the binaries of the linux processes.
+// It wraps the metadata extractor, so it must be given after SubOptionMonitorLinuxExtractor.
+func SubOptionMonitorLinuxBinaryVerifier(verifier *extractors.BinaryVerifier) LinuxMonitorOption {
+	return func(cfg *linuxmonitor.Config) {
+		if cfg.EventMetadataExtractor != nil {
+			cfg.EventMetadataExtractor = verifier.EventMetadataExtractor(cfg.EventMetadataExtractor)
+		}
+	}
+}
+
 // SubOptionMonitorLinuxRealeaseAgentPath specifies the path to release agent programmed in cgroup
 func SubOptionMonitorLinuxRealeaseAgentPath(releasePath string) LinuxMonitorOption {
 	return func(cfg *linuxmonitor.Config) {
@@ -116,6 +139,123 @@ func OptionMonitorDocker(opts ...DockerMonitorOption) Options {
 	}
 }
 
+// SubOptionMonitorContainerdExtractor provides a way to specify metadata extractor for containerd.
+func SubOptionMonitorContainerdExtractor(extractor extractors.ContainerdMetadataExtractor) ContainerdMonitorOption {
+	return func(cfg *containerdmonitor.Config) {
+		cfg.EventMetadataExtractor = extractor
+	}
+}
+
+// SubOptionMonitorContainerdSocket provides a way to specify the socket address of containerd.
+func SubOptionMonitorContainerdSocket(socketAddress string) ContainerdMonitorOption {
+	return func(cfg *containerdmonitor.Config) {
+		cfg.SocketAddress = socketAddress
+	}
+}
+
+// SubOptionMonitorContainerdNamespace provides a way to specify the containerd namespace to monitor.
+func SubOptionMonitorContainerdNamespace(namespace string) ContainerdMonitorOption {
+	return func(cfg *containerdmonitor.Config) {
+		cfg.Namespace = namespace
+	}
+}
+
+// SubOptionMonitorContainerdFlags provides a way to specify configuration flags info for containerd.
+func SubOptionMonitorContainerdFlags(syncAtStart, destroyStoppedContainers, ignoreHostNetwork bool) ContainerdMonitorOption {
+	return func(cfg *containerdmonitor.Config) {
+		cfg.SyncAtStart = syncAtStart
+		cfg.DestroyStoppedContainers = destroyStoppedContainers
+		cfg.IgnoreHostNetwork = ignoreHostNetwork
+	}
+}
+
+// OptionMonitorContainerd provides a way to add a containerd monitor and related configuration to be used with New().
+func OptionMonitorContainerd(opts ...ContainerdMonitorOption) Options {
+
+	cc := containerdmonitor.DefaultConfig()
+	// Collect all containerd options
+	for _, opt := range opts {
+		opt(cc)
+	}
+
+	return func(cfg *config.MonitorConfig) {
+		cfg.Monitors[config.Containerd] = cc
+	}
+}
+
+// SubOptionMonitorPodmanExtractor provides a way to specify metadata extractor for podman.
+func SubOptionMonitorPodmanExtractor(extractor extractors.PodmanMetadataExtractor) PodmanMonitorOption {
+	return func(cfg *podmanmonitor.Config) {
+		cfg.EventMetadataExtractor = extractor
+	}
+}
+
+// SubOptionMonitorPodmanSocket provides a way to specify the socket address of the podman service.
+func SubOptionMonitorPodmanSocket(socketAddress string) PodmanMonitorOption {
+	return func(cfg *podmanmonitor.Config) {
+		cfg.SocketAddress = socketAddress
+	}
+}
+
+// SubOptionMonitorPodmanFlags provides a way to specify configuration flags info for podman.
+func SubOptionMonitorPodmanFlags(syncAtStart, destroyStoppedContainers, ignoreHostNetwork bool) PodmanMonitorOption {
+	return func(cfg *podmanmonitor.Config) {
+		cfg.SyncAtStart = syncAtStart
+		cfg.DestroyStoppedContainers = destroyStoppedContainers
+		cfg.IgnoreHostNetwork = ignoreHostNetwork
+	}
+}
+
+// OptionMonitorPodman provides a way to add a podman monitor and related configuration to be used with New().
+func OptionMonitorPodman(opts ...PodmanMonitorOption) Options {
+
+	pc := podmanmonitor.DefaultConfig()
+	// Collect all podman options
+	for _, opt := range opts {
+		opt(pc)
+	}
+
+	return func(cfg *config.MonitorConfig) {
+		cfg.Monitors[config.Podman] = pc
+	}
+}
+
+// SubOptionMonitorSystemdExtractor provides a way to specify metadata extractor for systemd units.
+func SubOptionMonitorSystemdExtractor(extractor extractors.SystemdUnitMetadataExtractor) SystemdMonitorOption {
+	return func(cfg *systemdmonitor.Config) {
+		cfg.EventMetadataExtractor = extractor
+	}
+}
+
+// SubOptionMonitorSystemdAllowlist provides a way to specify the patterns of the names of
+// the units that are protected without X-Trireme-* settings.
+func SubOptionMonitorSystemdAllowlist(patterns []string) SystemdMonitorOption {
+	return func(cfg *systemdmonitor.Config) {
+		cfg.Allowlist = patterns
+	}
+}
+
+// SubOptionMonitorSystemdSyncAtStart provides a way to specify if the units are synced at start.
+func SubOptionMonitorSystemdSyncAtStart(syncAtStart bool) SystemdMonitorOption {
+	return func(cfg *systemdmonitor.Config) {
+		cfg.SyncAtStart = syncAtStart
+	}
+}
+
+// OptionMonitorSystemd provides a way to add a systemd unit monitor and related configuration to be used with New().
+func OptionMonitorSystemd(opts ...SystemdMonitorOption) Options {
+
+	sc := systemdmonitor.DefaultConfig()
+	// Collect all systemd options
+	for _, opt := range opts {
+		opt(sc)
+	}
+
+	return func(cfg *config.MonitorConfig) {
+		cfg.Monitors[config.Systemd] = sc
+	}
+}
+
 // OptionMonitorK8s provides a way to add a K8s monitor and related configuration to be used with New().
 func OptionMonitorK8s(opts ...K8smonitorOption) Options {
 	kc := k8smonitor.DefaultConfig()
@@ -158,6 +298,54 @@ func SubOptionMonitorK8sCRIRuntimeService(criRuntimeService criapi.RuntimeServic
 	}
 }
 
+// SubOptionMonitorK8sWatchServices provides a way to add the Kubernetes services to the dependent services of the PUs
+func SubOptionMonitorK8sWatchServices(enable bool) K8smonitorOption {
+	return func(cfg *k8smonitor.Config) {
+		cfg.WatchServices = enable
+	}
+}
+
+// OptionExternalExtractor provides a way to send the metadata of the PUs of all the monitors
+// to an external extractor. It wraps the extractors of the monitors, so it must be given
+// after the options of the monitors. Only the monitors created by NewMonitors are supported,
+// the pod, UID and CNI monitors are not, and NewMonitors fails if another monitor is configured.
+func OptionExternalExtractor(e *extractors.ExternalExtractor) Options {
+	return func(cfg *config.MonitorConfig) {
+		for _, m := range cfg.Monitors {
+			switch c := m.(type) {
+			case *linuxmonitor.Config:
+				if c.EventMetadataExtractor != nil {
+					c.EventMetadataExtractor = e.EventMetadataExtractor(c.EventMetadataExtractor)
+				}
+			case *dockermonitor.Config:
+				if c.EventMetadataExtractor != nil {
+					c.EventMetadataExtractor = e.DockerMetadataExtractor(c.EventMetadataExtractor)
+				}
+			case *containerdmonitor.Config:
+				if c.EventMetadataExtractor != nil {
+					c.EventMetadataExtractor = e.ContainerdMetadataExtractor(c.EventMetadataExtractor)
+				}
+			case *podmanmonitor.Config:
+				if c.EventMetadataExtractor != nil {
+					c.EventMetadataExtractor = e.PodmanMetadataExtractor(c.EventMetadataExtractor)
+				}
+			case *systemdmonitor.Config:
+				if c.EventMetadataExtractor != nil {
+					c.EventMetadataExtractor = e.SystemdUnitMetadataExtractor(c.EventMetadataExtractor)
+				}
+			case *k8smonitor.Config:
+				if c.MetadataExtractor != nil {
+					c.MetadataExtractor = e.PodMetadataExtractor(c.MetadataExtractor)
+				}
+			default:
+				if !platformExternalExtractor(e, m) {
+					cfg.Err = fmt.Errorf("external extractor is not supported by the monitor %T", m)
+				}
+			}
+		}
+	}
+}
+
 // OptionMergeTags provides a way to add merge tags to be used with New().
 func OptionMergeTags(tags []string) Options {
 	return func(cfg *config.MonitorConfig) {
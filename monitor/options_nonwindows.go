@@ -0,0 +1,14 @@
+// +build !windows
+
+package monitor
+
+import (
+	"go.aporeto.io/enforcerd/trireme-lib/monitor/extractors"
+)
+
+// platformExternalExtractor wraps the extractor of the platform specific monitors and
+// returns false if the monitor is not supported. All the supported monitors are handled
+// by OptionExternalExtractor outside of windows.
+func platformExternalExtractor(e *extractors.ExternalExtractor, m interface{}) bool {
+	return false
+}
@@ -56,3 +56,19 @@ func SubOptionWindowsHostMode(host bool) WindowsMonitorOption {
 		cfg.Host = host
 	}
 }
+
+// platformExternalExtractor wraps the extractor of the windows monitors and returns
+// false if the monitor is not supported.
+func platformExternalExtractor(e *extractors.ExternalExtractor, m interface{}) bool {
+
+	c, ok := m.(*windowsmonitor.Config)
+	if !ok {
+		return false
+	}
+
+	if c.EventMetadataExtractor != nil {
+		c.EventMetadataExtractor = e.EventMetadataExtractor(c.EventMetadataExtractor)
+	}
+
+	return true
+}
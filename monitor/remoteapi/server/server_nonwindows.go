@@ -44,7 +44,8 @@ func (e *EventServer) makePipe() (net.Listener, error) {
 
 // validateUser validates that the originating user is not sending a request
 // for a process that they don't own. Root users are allowed to send
-// any event.
+// any event. Only root users can send the SSH certificate of a session,
+// since it grants identity tags to the process.
 func validateUser(r *http.Request, event *common.EventInfo) error {
 
 	// Find the calling user.
@@ -58,6 +59,10 @@ func validateUser(r *http.Request, event *common.EventInfo) error {
 		return nil
 	}
 
+	if event.SSHCertificate != nil {
+		return fmt.Errorf("Only root users can send an SSH certificate")
+	}
+
 	// The target process must be valid.
 	p, err := process.NewProcess(event.PID)
 	if err != nil {
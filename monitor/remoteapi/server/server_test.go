@@ -90,6 +90,30 @@ func TestValidateUser(t *testing.T) {
 			So(err, ShouldBeNil)
 		})
 
+		Convey("When I issue the request as a regular user with an SSH certificate it should fail", func() {
+
+			r := &http.Request{}
+			r.RemoteAddr = "1000:1000:" + strconv.Itoa(os.Getpid())
+			event := &common.EventInfo{
+				PID:            int32(os.Getpid()),
+				SSHCertificate: &common.SSHCertificateInfo{Principals: []string{"admin"}},
+			}
+
+			err := validateUser(r, event)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("When I issue the request as a superuser with an SSH certificate it should succeed", func() {
+			r := &http.Request{}
+			r.RemoteAddr = "0:0:1000"
+			event := &common.EventInfo{
+				SSHCertificate: &common.SSHCertificateInfo{Principals: []string{"admin"}},
+			}
+
+			err := validateUser(r, event)
+			So(err, ShouldBeNil)
+		})
+
 	})
 }
 
@@ -3,6 +3,7 @@
 package server
 
 import (
+	"fmt"
 	"net"
 	"net/http"
 
@@ -26,5 +27,9 @@ func (e *EventServer) makePipe() (net.Listener, error) {
 
 // TODO(windows): Uids() not impl currently in Windows
 func validateUser(r *http.Request, event *common.EventInfo) error {
+	// The caller cannot be identified, so it cannot send an SSH certificate.
+	if event.SSHCertificate != nil {
+		return fmt.Errorf("SSH certificates are not supported")
+	}
 	return nil
 }
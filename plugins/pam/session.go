@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+
+	"go.aporeto.io/enforcerd/trireme-lib/common"
+	"go.aporeto.io/enforcerd/trireme-lib/monitor/extractors"
+)
+
+// sessionEvent returns the start event of the session of a user. The session
+// is a linux process PU, so that the SSH metadata extractor of the linux monitor
+// turns its tags and its certificate into identity tags. The certificate is
+// extracted from the authentication information that sshd exposes in the
+// SSH_AUTH_INFO_0 PAM variable, when the session was authenticated with one.
+func sessionEvent(username, service string, groups []string, authInfo string, pid int32) (*common.EventInfo, error) {
+
+	tags := []string{"user=" + username}
+	tags = append(tags, groups...)
+
+	if service != "" {
+		tags = append(tags, "SessionType="+service)
+	} else {
+		tags = append(tags, "SessionType=login")
+	}
+
+	cert, err := extractors.SSHCertificateFromAuthInfo(authInfo)
+	if err != nil {
+		return nil, fmt.Errorf("unable to extract ssh certificate: %s", err)
+	}
+
+	return &common.EventInfo{
+		PUType:         common.LinuxProcessPU,
+		Name:           "login-" + username,
+		PID:            pid,
+		Tags:           tags,
+		EventType:      common.EventStart,
+		SSHCertificate: cert,
+	}, nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"go.aporeto.io/enforcerd/trireme-lib/common"
+	"go.aporeto.io/enforcerd/trireme-lib/monitor/extractors"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestSessionEvent(t *testing.T) {
+
+	Convey("Given an OpenSSH user certificate", t, func() {
+		_, caKey, err := ed25519.GenerateKey(rand.Reader)
+		So(err, ShouldBeNil)
+		ca, err := ssh.NewSignerFromKey(caKey)
+		So(err, ShouldBeNil)
+
+		userKey, _, err := ed25519.GenerateKey(rand.Reader)
+		So(err, ShouldBeNil)
+		userPublic, err := ssh.NewPublicKey(userKey)
+		So(err, ShouldBeNil)
+
+		cert := &ssh.Certificate{
+			Key:             userPublic,
+			Serial:          7,
+			CertType:        ssh.UserCert,
+			KeyId:           "bob",
+			ValidPrincipals: []string{"bob", "ops"},
+			ValidBefore:     ssh.CertTimeInfinity,
+		}
+		So(cert.SignCert(rand.Reader, ca), ShouldBeNil)
+
+		authInfo := "publickey " + string(ssh.MarshalAuthorizedKey(cert))
+
+		Convey("The session event should carry the certificate and get its identity tags", func() {
+			event, err := sessionEvent("bob", "sshd", []string{"groupname=ops"}, authInfo, 1234)
+			So(err, ShouldBeNil)
+			So(event.PUType, ShouldEqual, common.LinuxProcessPU)
+			So(event.EventType, ShouldEqual, common.EventStart)
+			So(event.Tags, ShouldResemble, []string{"user=bob", "groupname=ops", "SessionType=sshd"})
+			So(event.SSHCertificate, ShouldNotBeNil)
+
+			runtime, err := extractors.SSHMetadataExtractor(event)
+			So(err, ShouldBeNil)
+
+			tags := runtime.Tags().GetSlice()
+			So(tags, ShouldContain, "@user:ssh:user=bob")
+			So(tags, ShouldContain, "@user:ssh:SessionType=sshd")
+			So(tags, ShouldContain, "@user:ssh:certificate=valid")
+			So(tags, ShouldContain, "@user:ssh:principal=bob")
+			So(tags, ShouldContain, "@user:ssh:principal=ops")
+			So(tags, ShouldContain, "@user:ssh:keyid=bob")
+			So(tags, ShouldContain, "@user:ssh:serial=7")
+		})
+
+		Convey("The session event of a plain key should not have a certificate", func() {
+			event, err := sessionEvent("bob", "", nil, "publickey "+string(ssh.MarshalAuthorizedKey(userPublic)), 1234)
+			So(err, ShouldBeNil)
+			So(event.Tags, ShouldResemble, []string{"user=bob", "SessionType=login"})
+			So(event.SSHCertificate, ShouldBeNil)
+
+			runtime, err := extractors.SSHMetadataExtractor(event)
+			So(err, ShouldBeNil)
+			So(runtime.Tags().GetSlice(), ShouldNotContain, "@user:ssh:certificate=valid")
+		})
+
+		Convey("An invalid certificate should fail the session", func() {
+			_, err := sessionEvent("bob", "sshd", nil, "publickey ssh-ed25519 invalid", 1234)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
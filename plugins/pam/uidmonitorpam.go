@@ -8,6 +8,7 @@ char *get_user(pam_handle_t *pamh);
 char *get_ruser(pam_handle_t *pamh);
 char *get_rhost(pam_handle_t *pamh);
 char *get_service(pam_handle_t *pam_h);
+char *get_auth_info(pam_handle_t *pamh);
 void initLog() ;
 int is_system_user(char *user);
 int is_root(char *user);
@@ -18,9 +19,10 @@ import (
 	"log/syslog"
 	"os"
 	"os/user"
+	"unsafe"
 
-	"go.aporeto.io/trireme-lib/common"
-	"go.aporeto.io/trireme-lib/monitor/remoteapi/client"
+	"go.aporeto.io/enforcerd/trireme-lib/common"
+	"go.aporeto.io/enforcerd/trireme-lib/monitor/remoteapi/client"
 )
 
 func getGroupList(username string) ([]string, error) {
@@ -56,26 +58,22 @@ func pam_sm_open_session(pamh *C.pam_handle_t, flags, argc int, argv **C.char) C
 	C.initLog()
 	user := C.get_user(pamh)
 	service := C.get_service(pamh)
-	metadatamap := []string{}
-	userstring := "user=" + C.GoString(user)
-	metadatamap = append(metadatamap, userstring)
-	if groups, err := getGroupList(C.GoString(user)); err == nil {
-		metadatamap = append(metadatamap, groups...)
-	}
+	groups, _ := getGroupList(C.GoString(user))
 
-	if service != nil {
-		metadatamap = append(metadatamap, "SessionType="+C.GoString(service))
-	} else {
-		metadatamap = append(metadatamap, "SessionType=login")
+	var authInfo string
+	if info := C.get_auth_info(pamh); info != nil {
+		authInfo = C.GoString(info)
+		C.free(unsafe.Pointer(info))
 	}
 
-	request := &common.EventInfo{
-		PUType:    common.UIDLoginPU,
-		PUID:      C.GoString(user),
-		Name:      "login-" + C.GoString(user),
-		PID:       int32(os.Getpid()),
-		Tags:      metadatamap,
-		EventType: "start",
+	request, err := sessionEvent(C.GoString(user), C.GoString(service), groups, authInfo, int32(os.Getpid()))
+	if err != nil {
+		slog, _ := syslog.New(syslog.LOG_ALERT|syslog.LOG_AUTH, "mypam")
+		defer func() {
+			_ = slog.Close()
+		}()
+		_ = slog.Alert(err.Error())
+		return C.PAM_SESSION_ERR
 	}
 
 	if C.is_root(user) == 1 {
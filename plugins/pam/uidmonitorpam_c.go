@@ -50,6 +50,16 @@ char *get_service(pam_handle_t *pamh){
   return strdup(service);
 }
 
+// get_auth_info pulls the authentication information exposed by sshd out of the pam environment.
+char *get_auth_info(pam_handle_t *pamh) {
+  if (!pamh)
+    return NULL;
+  const char *info = pam_getenv(pamh, "SSH_AUTH_INFO_0");
+  if (!info)
+    return NULL;
+  return strdup(info);
+}
+
 void initLog() {
    openlog(NULL,LOG_PID,LOG_AUTH);
 }
@@ -137,10 +137,12 @@ type ApplicationService struct {
 
 // HTTPRule holds a rule for a particular HTTPService. The rule
 // relates a set of URIs defined as regular expressions with associated
-// verbs. The * VERB indicates all actions.
+// verbs. The * VERB indicates all actions. The gRPC methods are matched
+// by their path, /package.Service/Method, with the POST verb.
 type HTTPRule struct {
 	// URIs is a list of regular expressions that describe the URIs that
-	// a service is exposing.
+	// a service is exposing. The methods of a gRPC service are selected with
+	// /package.Service/Method or all together with /package.Service/*.
 	URIs []string
 
 	// Methods is a list of the allowed verbs for the given list of URIs.
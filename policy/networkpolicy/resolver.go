@@ -0,0 +1,327 @@
+package networkpolicy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"go.aporeto.io/enforcerd/trireme-lib/common"
+	"go.aporeto.io/enforcerd/trireme-lib/controller"
+	"go.aporeto.io/enforcerd/trireme-lib/monitor/extractors"
+	"go.aporeto.io/enforcerd/trireme-lib/policy"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// puState is a PU known by the resolver.
+type puState struct {
+	runtime   *policy.PURuntime
+	namespace string
+	name      string
+	enforced  bool
+}
+
+// Resolver is a policy.Resolver that enforces the Kubernetes NetworkPolicies
+// on the pods, without any other policy source. The PUs of the pods are
+// identified by their extractors.UpstreamNamespaceIdentifier and
+// extractors.UpstreamNameIdentifier tags. The other PUs are allowed everything.
+//
+// The policies of the PUs are recomputed when the NetworkPolicies, the labels
+// of the namespaces or the pods change.
+type Resolver struct {
+	controller controller.TriremeController
+	clientset  kubernetes.Interface
+	factory    informers.SharedInformerFactory
+	synced     []cache.InformerSynced
+	translator *translator
+
+	pus map[string]*puState
+	sync.Mutex
+}
+
+// NewResolver returns a NetworkPolicy resolver that enforces the policies
+// with the given controller. The informers are resynced with the given period.
+func NewResolver(c controller.TriremeController, clientset kubernetes.Interface, resync time.Duration) *Resolver {
+
+	factory := informers.NewSharedInformerFactory(clientset, resync)
+
+	policies := factory.Networking().V1().NetworkPolicies()
+	namespaces := factory.Core().V1().Namespaces()
+	pods := factory.Core().V1().Pods()
+
+	r := &Resolver{
+		controller: c,
+		clientset:  clientset,
+		factory:    factory,
+		synced: []cache.InformerSynced{
+			policies.Informer().HasSynced,
+			namespaces.Informer().HasSynced,
+			pods.Informer().HasSynced,
+		},
+		translator: &translator{
+			policies:   policies.Lister(),
+			namespaces: namespaces.Lister(),
+			pods:       pods.Lister(),
+		},
+		pus: map[string]*puState{},
+	}
+
+	policies.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    r.policyChanged,
+		UpdateFunc: func(_, obj interface{}) { r.policyChanged(obj) },
+		DeleteFunc: r.policyChanged,
+	})
+
+	namespaces.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(interface{}) { r.recompute(nil) },
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldNs, ok1 := oldObj.(*corev1.Namespace)
+			newNs, ok2 := newObj.(*corev1.Namespace)
+			if ok1 && ok2 && reflect.DeepEqual(oldNs.Labels, newNs.Labels) {
+				return
+			}
+			r.recompute(nil)
+		},
+		DeleteFunc: func(interface{}) { r.recompute(nil) },
+	})
+
+	pods.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { r.podChanged(nil, obj) },
+		UpdateFunc: r.podChanged,
+		DeleteFunc: func(obj interface{}) { r.podChanged(obj, nil) },
+	})
+
+	return r
+}
+
+// Run starts the informers and waits for their caches to be synced.
+func (r *Resolver) Run(ctx context.Context) error {
+
+	r.factory.Start(ctx.Done())
+
+	if !cache.WaitForCacheSync(ctx.Done(), r.synced...) {
+		return errors.New("unable to sync the network policy caches")
+	}
+
+	return nil
+}
+
+// HandlePUEvent implements the policy.Resolver interface.
+func (r *Resolver) HandlePUEvent(ctx context.Context, puID string, event common.Event, runtime policy.RuntimeReader) error {
+
+	r.Lock()
+	defer r.Unlock()
+
+	switch event {
+	case common.EventCreate:
+		state, err := newPUState(runtime)
+		if err != nil {
+			return err
+		}
+		r.pus[puID] = state
+
+	case common.EventStart:
+		state, ok := r.pus[puID]
+		if !ok {
+			var err error
+			if state, err = newPUState(runtime); err != nil {
+				return err
+			}
+			r.pus[puID] = state
+		}
+
+		p, err := r.resolve(puID, state)
+		if err != nil {
+			return err
+		}
+
+		if err := r.controller.Enforce(ctx, puID, p, state.runtime); err != nil {
+			return err
+		}
+		state.enforced = true
+
+	case common.EventUpdate:
+		state, ok := r.pus[puID]
+		if !ok {
+			return fmt.Errorf("unknown pu %s", puID)
+		}
+
+		updated, err := newPUState(runtime)
+		if err != nil {
+			return err
+		}
+		state.runtime, state.namespace, state.name = updated.runtime, updated.namespace, updated.name
+
+		if !state.enforced {
+			return nil
+		}
+
+		p, err := r.resolve(puID, state)
+		if err != nil {
+			return err
+		}
+
+		return r.controller.UpdatePolicy(ctx, puID, p, state.runtime)
+
+	case common.EventStop:
+		state, ok := r.pus[puID]
+		if !ok || !state.enforced {
+			return nil
+		}
+		state.enforced = false
+
+		return r.controller.UnEnforce(ctx, puID, nil, state.runtime)
+
+	case common.EventDestroy:
+		delete(r.pus, puID)
+	}
+
+	return nil
+}
+
+// resolve returns the policy of a PU. It must be called with the lock held.
+func (r *Resolver) resolve(puID string, state *puState) (*policy.PUPolicy, error) {
+
+	if state.namespace == "" {
+		return policy.NewPUPolicy(puID, "", policy.AllowAll, nil, nil, nil, nil, nil, state.runtime.Tags(), nil, nil, state.runtime.IPAddresses(), 0, 0, nil, nil, []string{}, policy.EnforcerMapping, policy.Reject|policy.Log, policy.Reject|policy.Log), nil
+	}
+
+	pod, err := r.translator.pods.Pods(state.namespace).Get(state.name)
+	if err != nil {
+		// The pod monitor may know the pod before the informer.
+		if pod, err = r.clientset.CoreV1().Pods(state.namespace).Get(state.name, metav1.GetOptions{}); err != nil {
+			return nil, fmt.Errorf("unable to get pod %s/%s: %s", state.namespace, state.name, err)
+		}
+	}
+
+	return r.translator.translate(puID, pod, state.runtime)
+}
+
+// recompute updates the policies of the enforced PUs that match the filter.
+// A nil filter matches all the PUs.
+func (r *Resolver) recompute(filter func(*puState) bool) {
+
+	r.Lock()
+	defer r.Unlock()
+
+	for puID, state := range r.pus {
+		if !state.enforced || (filter != nil && !filter(state)) {
+			continue
+		}
+
+		p, err := r.resolve(puID, state)
+		if err != nil {
+			zap.L().Error("Unable to resolve network policy", zap.String("puID", puID), zap.Error(err))
+			continue
+		}
+
+		if err := r.controller.UpdatePolicy(context.Background(), puID, p, state.runtime); err != nil {
+			zap.L().Error("Unable to update network policy", zap.String("puID", puID), zap.Error(err))
+		}
+	}
+}
+
+// policyChanged recomputes the PUs of the namespace of a NetworkPolicy.
+func (r *Resolver) policyChanged(obj interface{}) {
+
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+
+	np, ok := obj.(*networkingv1.NetworkPolicy)
+	if !ok {
+		return
+	}
+
+	r.recompute(func(state *puState) bool { return state.namespace == np.Namespace })
+}
+
+// podChanged recomputes the PU of a pod when its labels or ports change. The
+// named ports of a pod may be used by the egress rules of any PU, so all the
+// PUs are recomputed when a pod with named ports changes.
+func (r *Resolver) podChanged(oldObj, newObj interface{}) {
+
+	if tombstone, ok := oldObj.(cache.DeletedFinalStateUnknown); ok {
+		oldObj = tombstone.Obj
+	}
+
+	oldPod, _ := oldObj.(*corev1.Pod)
+	newPod, _ := newObj.(*corev1.Pod)
+
+	if oldPod != nil && newPod != nil &&
+		reflect.DeepEqual(oldPod.Labels, newPod.Labels) &&
+		reflect.DeepEqual(containerPorts(oldPod), containerPorts(newPod)) {
+		return
+	}
+
+	if hasNamedPorts(oldPod) || hasNamedPorts(newPod) {
+		r.recompute(nil)
+		return
+	}
+
+	pod := newPod
+	if pod == nil {
+		pod = oldPod
+	}
+	if pod == nil {
+		return
+	}
+
+	r.recompute(func(state *puState) bool {
+		return state.namespace == pod.Namespace && state.name == pod.Name
+	})
+}
+
+// newPUState returns the state of a PU from its runtime.
+func newPUState(runtime policy.RuntimeReader) (*puState, error) {
+
+	puRuntime, ok := runtime.(*policy.PURuntime)
+	if !ok {
+		return nil, fmt.Errorf("unsupported runtime %T", runtime)
+	}
+
+	state := &puState{runtime: puRuntime}
+
+	if namespace, ok := runtime.Tag(extractors.UpstreamNamespaceIdentifier); ok {
+		if name, ok := runtime.Tag(extractors.UpstreamNameIdentifier); ok {
+			state.namespace, state.name = namespace, name
+		}
+	}
+
+	return state, nil
+}
+
+func containerPorts(pod *corev1.Pod) [][]corev1.ContainerPort {
+
+	ports := [][]corev1.ContainerPort{}
+	for _, c := range pod.Spec.Containers {
+		ports = append(ports, c.Ports)
+	}
+
+	return ports
+}
+
+func hasNamedPorts(pod *corev1.Pod) bool {
+
+	if pod == nil {
+		return false
+	}
+
+	for _, c := range pod.Spec.Containers {
+		for _, port := range c.Ports {
+			if port.Name != "" {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,102 @@
+package networkpolicy
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.aporeto.io/enforcerd/trireme-lib/common"
+	"go.aporeto.io/enforcerd/trireme-lib/controller/mockcontroller"
+	"go.aporeto.io/enforcerd/trireme-lib/monitor/extractors"
+	"go.aporeto.io/enforcerd/trireme-lib/policy"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestResolver(t *testing.T) {
+
+	Convey("Given a resolver", t, func() {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "web",
+				Namespace: "default",
+				Labels:    map[string]string{"app": "web"},
+			},
+		}
+
+		clientset := fake.NewSimpleClientset(pod, namespace("default", nil))
+		controller := mockcontroller.NewMockTriremeController(ctrl)
+
+		r := NewResolver(controller, clientset, 0)
+		So(r.Run(ctx), ShouldBeNil)
+
+		podRuntime := policy.NewPURuntime("web", 0, "", policy.NewTagStoreFromSlice([]string{
+			"app=web",
+			extractors.UpstreamNamespaceIdentifier + "=default",
+			extractors.UpstreamNameIdentifier + "=web",
+		}), nil, common.ContainerPU, policy.None, nil)
+
+		Convey("A PU that is not a pod should be allowed everything", func() {
+			hostRuntime := policy.NewPURuntime("host", 1, "", nil, nil, common.LinuxProcessPU, policy.None, nil)
+
+			controller.EXPECT().Enforce(gomock.Any(), "host", gomock.Any(), hostRuntime).
+				Do(func(_ context.Context, _ string, p *policy.PUPolicy, _ *policy.PURuntime) {
+					So(p.TriremeAction(), ShouldEqual, policy.AllowAll)
+				})
+
+			So(r.HandlePUEvent(ctx, "host", common.EventCreate, hostRuntime), ShouldBeNil)
+			So(r.HandlePUEvent(ctx, "host", common.EventStart, hostRuntime), ShouldBeNil)
+		})
+
+		Convey("A pod should be policed and updated when a network policy changes", func() {
+			controller.EXPECT().Enforce(gomock.Any(), "pu", gomock.Any(), podRuntime).
+				Do(func(_ context.Context, _ string, p *policy.PUPolicy, _ *policy.PURuntime) {
+					So(p.TriremeAction(), ShouldEqual, policy.Police)
+					So(p.ReceiverRules(), ShouldResemble, allowAllSelectors)
+				})
+
+			So(r.HandlePUEvent(ctx, "pu", common.EventCreate, podRuntime), ShouldBeNil)
+			So(r.HandlePUEvent(ctx, "pu", common.EventStart, podRuntime), ShouldBeNil)
+
+			updated := make(chan *policy.PUPolicy, 1)
+			controller.EXPECT().UpdatePolicy(gomock.Any(), "pu", gomock.Any(), podRuntime).
+				Do(func(_ context.Context, _ string, p *policy.PUPolicy, _ *policy.PURuntime) {
+					updated <- p
+				})
+
+			_, err := clientset.NetworkingV1().NetworkPolicies("default").Create(networkPolicy("deny", networkingv1.NetworkPolicySpec{}))
+			So(err, ShouldBeNil)
+
+			var p *policy.PUPolicy
+			select {
+			case p = <-updated:
+			case <-time.After(5 * time.Second):
+			}
+			So(p, ShouldNotBeNil)
+			So(p.ReceiverRules(), ShouldBeEmpty)
+			So(p.TransmitterRules(), ShouldResemble, allowAllSelectors)
+
+			Convey("It should be unenforced when it stops", func() {
+				controller.EXPECT().UnEnforce(gomock.Any(), "pu", nil, podRuntime)
+
+				So(r.HandlePUEvent(ctx, "pu", common.EventStop, podRuntime), ShouldBeNil)
+				So(r.HandlePUEvent(ctx, "pu", common.EventDestroy, podRuntime), ShouldBeNil)
+				So(r.pus, ShouldBeEmpty)
+			})
+		})
+
+		Convey("An update of an unknown PU should be an error", func() {
+			So(r.HandlePUEvent(ctx, "unknown", common.EventUpdate, podRuntime), ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,585 @@
+package networkpolicy
+
+import (
+	"fmt"
+	"net"
+	"sort"
+
+	"go.aporeto.io/enforcerd/trireme-lib/controller/constants"
+	"go.aporeto.io/enforcerd/trireme-lib/monitor/extractors"
+	"go.aporeto.io/enforcerd/trireme-lib/policy"
+	"go.aporeto.io/enforcerd/trireme-lib/utils/portspec"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	networkinglisters "k8s.io/client-go/listers/networking/v1"
+)
+
+// The networks used for the rules that allow any address.
+var anyNetworks = []string{"0.0.0.0/0", "::/0"}
+
+// portMatch is a port range of a protocol.
+type portMatch struct {
+	protocol string
+	ports    *portspec.PortSpec
+}
+
+// rules are the tag selectors and the ACLs of a direction.
+type rules struct {
+	selectors policy.TagSelectorList
+	acls      policy.IPRuleList
+}
+
+// translator translates the NetworkPolicies that select a pod into the rules
+// of the PU policy of the pod. The pod labels are used as is for the tags of
+// the PUs, like the DefaultKubernetesMetadataExtractor does, and the namespace
+// of a pod is matched with the extractors.UpstreamNamespaceIdentifier tag.
+//
+// Limitations:
+//   - NotIn is translated to a NotEqual clause, which also matches the peers
+//     without the label.
+//   - The SCTP ports are ignored.
+type translator struct {
+	policies   networkinglisters.NetworkPolicyLister
+	namespaces corelisters.NamespaceLister
+	pods       corelisters.PodLister
+}
+
+// translate returns the policy of the PU of the given pod. A direction that
+// is not isolated by any NetworkPolicy allows everything, the Kubernetes way.
+func (t *translator) translate(puID string, pod *corev1.Pod, runtime *policy.PURuntime) (*policy.PUPolicy, error) {
+
+	nps, err := t.policies.NetworkPolicies(pod.Namespace).List(labels.Everything())
+	if err != nil {
+		return nil, fmt.Errorf("unable to list network policies: %s", err)
+	}
+
+	// The order of the lister is random.
+	sort.Slice(nps, func(i, j int) bool { return nps[i].Name < nps[j].Name })
+
+	ingressIsolated, egressIsolated := false, false
+	ingress, egress := &rules{}, &rules{}
+
+	for _, np := range nps {
+		selector, err := metav1.LabelSelectorAsSelector(&np.Spec.PodSelector)
+		if err != nil {
+			zap.L().Warn("Ignoring network policy with invalid pod selector",
+				zap.String("namespace", np.Namespace),
+				zap.String("name", np.Name),
+				zap.Error(err),
+			)
+			continue
+		}
+
+		if !selector.Matches(labels.Set(pod.Labels)) {
+			continue
+		}
+
+		isolatesIngress, isolatesEgress := policyTypes(np)
+
+		if isolatesIngress {
+			ingressIsolated = true
+			for _, rule := range np.Spec.Ingress {
+				t.ingressRule(np, rule, pod, ingress)
+			}
+		}
+
+		if isolatesEgress {
+			egressIsolated = true
+			for _, rule := range np.Spec.Egress {
+				t.egressRule(np, rule, egress)
+			}
+		}
+	}
+
+	if !ingressIsolated {
+		allowAll(ingress)
+	}
+
+	if !egressIsolated {
+		allowAll(egress)
+	}
+
+	return policy.NewPUPolicy(
+		puID,
+		pod.Namespace,
+		policy.Police,
+		egress.acls,
+		ingress.acls,
+		nil,
+		egress.selectors,
+		ingress.selectors,
+		runtime.Tags(),
+		nil,
+		nil,
+		runtime.IPAddresses(),
+		0,
+		0,
+		nil,
+		runtime.Options().DependentServices,
+		[]string{},
+		policy.EnforcerMapping,
+		policy.Reject|policy.Log,
+		policy.Reject|policy.Log,
+	), nil
+}
+
+// policyTypes returns the directions isolated by a NetworkPolicy. Without
+// policyTypes, a NetworkPolicy always isolates the ingress, and the egress
+// only when it has egress rules.
+func policyTypes(np *networkingv1.NetworkPolicy) (ingress bool, egress bool) {
+
+	if len(np.Spec.PolicyTypes) == 0 {
+		return true, len(np.Spec.Egress) > 0
+	}
+
+	for _, t := range np.Spec.PolicyTypes {
+		switch t {
+		case networkingv1.PolicyTypeIngress:
+			ingress = true
+		case networkingv1.PolicyTypeEgress:
+			egress = true
+		}
+	}
+
+	return ingress, egress
+}
+
+// ingressRule adds the rules of an ingress rule of a NetworkPolicy. The named
+// ports are the ports of the pod itself.
+func (t *translator) ingressRule(np *networkingv1.NetworkPolicy, rule networkingv1.NetworkPolicyIngressRule, pod *corev1.Pod, r *rules) {
+
+	ports, ok := t.ports(rule.Ports, []*corev1.Pod{pod})
+	if !ok {
+		return
+	}
+
+	t.peerRules(np, rule.From, ports, r)
+}
+
+// egressRule adds the rules of an egress rule of a NetworkPolicy. The named
+// ports are the ports of the pods selected by the rule.
+func (t *translator) egressRule(np *networkingv1.NetworkPolicy, rule networkingv1.NetworkPolicyEgressRule, r *rules) {
+
+	ports, ok := t.ports(rule.Ports, t.peerPods(np, rule.To))
+	if !ok {
+		return
+	}
+
+	t.peerRules(np, rule.To, ports, r)
+}
+
+// peerRules adds a tag selector per peer and port, and an ACL per ipBlock
+// and port. The except networks of an ipBlock are removed from the networks
+// of its ACLs, so that they do not reject the addresses that other rules
+// accept. A rule without peers matches every address.
+func (t *translator) peerRules(np *networkingv1.NetworkPolicy, peers []networkingv1.NetworkPolicyPeer, ports []portMatch, r *rules) {
+
+	flowPolicy := &policy.FlowPolicy{
+		Action:   policy.Accept,
+		PolicyID: np.Namespace + "/" + np.Name,
+	}
+
+	if len(peers) == 0 {
+		r.selectors = append(r.selectors, tagSelectors(nil, ports, flowPolicy)...)
+		r.acls = append(r.acls, ipRules(anyNetworks, ports, flowPolicy)...)
+		return
+	}
+
+	for _, peer := range peers {
+		if peer.IPBlock != nil {
+			networks := subtractNetworks(peer.IPBlock.CIDR, peer.IPBlock.Except)
+			r.acls = append(r.acls, ipRules(networks, ports, flowPolicy)...)
+			continue
+		}
+
+		clauses, ok := t.peerClauses(np.Namespace, peer)
+		if !ok {
+			continue
+		}
+
+		r.selectors = append(r.selectors, tagSelectors(clauses, ports, flowPolicy)...)
+	}
+}
+
+// peerClauses returns the clauses that match the pods of a peer. It returns
+// false when the peer cannot match any pod.
+func (t *translator) peerClauses(namespace string, peer networkingv1.NetworkPolicyPeer) ([]policy.KeyValueOperator, bool) {
+
+	clauses := []policy.KeyValueOperator{}
+
+	switch {
+	case peer.NamespaceSelector == nil:
+		clauses = append(clauses, policy.KeyValueOperator{
+			Key:      extractors.UpstreamNamespaceIdentifier,
+			Value:    []string{namespace},
+			Operator: policy.Equal,
+		})
+
+	case len(peer.NamespaceSelector.MatchLabels) == 0 && len(peer.NamespaceSelector.MatchExpressions) == 0:
+		clauses = append(clauses, policy.KeyValueOperator{
+			Key:      extractors.UpstreamNamespaceIdentifier,
+			Operator: policy.KeyExists,
+		})
+
+	default:
+		names, err := t.namespaceNames(peer.NamespaceSelector)
+		if err != nil {
+			zap.L().Warn("Ignoring network policy peer with invalid namespace selector", zap.Error(err))
+			return nil, false
+		}
+		if len(names) == 0 {
+			return nil, false
+		}
+		clauses = append(clauses, policy.KeyValueOperator{
+			Key:      extractors.UpstreamNamespaceIdentifier,
+			Value:    names,
+			Operator: policy.Equal,
+		})
+	}
+
+	if peer.PodSelector != nil {
+		clauses = append(clauses, selectorClauses(peer.PodSelector)...)
+	}
+
+	return clauses, true
+}
+
+// namespaceNames returns the sorted names of the namespaces matching a selector.
+func (t *translator) namespaceNames(s *metav1.LabelSelector) ([]string, error) {
+
+	selector, err := metav1.LabelSelectorAsSelector(s)
+	if err != nil {
+		return nil, err
+	}
+
+	namespaces, err := t.namespaces.List(selector)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(namespaces))
+	for _, ns := range namespaces {
+		names = append(names, ns.Name)
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// peerPods returns the pods matched by the peers of an egress rule. They are
+// only used to resolve the named ports.
+func (t *translator) peerPods(np *networkingv1.NetworkPolicy, peers []networkingv1.NetworkPolicyPeer) []*corev1.Pod {
+
+	if len(peers) == 0 {
+		pods, _ := t.pods.List(labels.Everything()) // nolint: errcheck
+		return pods
+	}
+
+	pods := []*corev1.Pod{}
+
+	for _, peer := range peers {
+		if peer.IPBlock != nil {
+			continue
+		}
+
+		namespaces := []string{np.Namespace}
+		if peer.NamespaceSelector != nil {
+			names, err := t.namespaceNames(peer.NamespaceSelector)
+			if err != nil {
+				continue
+			}
+			namespaces = names
+		}
+
+		podSelector := labels.Everything()
+		if peer.PodSelector != nil {
+			selector, err := metav1.LabelSelectorAsSelector(peer.PodSelector)
+			if err != nil {
+				continue
+			}
+			podSelector = selector
+		}
+
+		for _, ns := range namespaces {
+			list, err := t.pods.Pods(ns).List(podSelector)
+			if err != nil {
+				continue
+			}
+			pods = append(pods, list...)
+		}
+	}
+
+	return pods
+}
+
+// ports returns the port ranges of the ports of a rule. It returns nil when
+// the rule matches all the ports, and false when none of its ports can be
+// matched.
+func (t *translator) ports(ports []networkingv1.NetworkPolicyPort, pods []*corev1.Pod) ([]portMatch, bool) {
+
+	if len(ports) == 0 {
+		return nil, true
+	}
+
+	matches := []portMatch{}
+
+	for _, p := range ports {
+		protocol := corev1.ProtocolTCP
+		if p.Protocol != nil {
+			protocol = *p.Protocol
+		}
+
+		var proto string
+		switch protocol {
+		case corev1.ProtocolTCP:
+			proto = constants.TCPProtoString
+		case corev1.ProtocolUDP:
+			proto = constants.UDPProtoString
+		default:
+			zap.L().Debug("Ignoring network policy port with unsupported protocol", zap.String("protocol", string(protocol)))
+			continue
+		}
+
+		var numbers []int32
+		switch {
+		case p.Port == nil:
+			spec, _ := portspec.NewPortSpec(1, 65535, nil) // nolint: errcheck
+			matches = append(matches, portMatch{protocol: proto, ports: spec})
+			continue
+		case p.Port.Type == intstr.String:
+			numbers = namedPorts(pods, p.Port.StrVal, protocol)
+		default:
+			numbers = []int32{p.Port.IntVal}
+		}
+
+		for _, n := range numbers {
+			if n <= 0 || n > 65535 {
+				continue
+			}
+			spec, err := portspec.NewPortSpec(uint16(n), uint16(n), nil)
+			if err != nil {
+				continue
+			}
+			matches = append(matches, portMatch{protocol: proto, ports: spec})
+		}
+	}
+
+	return matches, len(matches) > 0
+}
+
+// namedPorts returns the sorted numbers of the container ports with the given
+// name and protocol.
+func namedPorts(pods []*corev1.Pod, name string, protocol corev1.Protocol) []int32 {
+
+	found := map[int32]struct{}{}
+
+	for _, pod := range pods {
+		for _, c := range pod.Spec.Containers {
+			for _, port := range c.Ports {
+				portProtocol := port.Protocol
+				if portProtocol == "" {
+					portProtocol = corev1.ProtocolTCP
+				}
+				if port.Name == name && portProtocol == protocol {
+					found[port.ContainerPort] = struct{}{}
+				}
+			}
+		}
+	}
+
+	numbers := make([]int32, 0, len(found))
+	for n := range found {
+		numbers = append(numbers, n)
+	}
+	sort.Slice(numbers, func(i, j int) bool { return numbers[i] < numbers[j] })
+
+	return numbers
+}
+
+// selectorClauses translates a label selector into clauses.
+func selectorClauses(s *metav1.LabelSelector) []policy.KeyValueOperator {
+
+	clauses := []policy.KeyValueOperator{}
+
+	keys := make([]string, 0, len(s.MatchLabels))
+	for k := range s.MatchLabels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		clauses = append(clauses, policy.KeyValueOperator{
+			Key:      k,
+			Value:    []string{s.MatchLabels[k]},
+			Operator: policy.Equal,
+		})
+	}
+
+	for _, e := range s.MatchExpressions {
+		clause := policy.KeyValueOperator{
+			Key:   e.Key,
+			Value: e.Values,
+		}
+
+		switch e.Operator {
+		case metav1.LabelSelectorOpIn:
+			clause.Operator = policy.Equal
+		case metav1.LabelSelectorOpNotIn:
+			clause.Operator = policy.NotEqual
+		case metav1.LabelSelectorOpExists:
+			clause.Operator = policy.KeyExists
+			clause.Value = nil
+		case metav1.LabelSelectorOpDoesNotExist:
+			clause.Operator = policy.KeyNotExists
+			clause.Value = nil
+		default:
+			continue
+		}
+
+		clauses = append(clauses, clause)
+	}
+
+	return clauses
+}
+
+// tagSelectors returns a tag selector per port for the given clauses.
+func tagSelectors(clauses []policy.KeyValueOperator, ports []portMatch, flowPolicy *policy.FlowPolicy) policy.TagSelectorList {
+
+	if len(ports) == 0 {
+		if len(clauses) == 0 {
+			clauses = []policy.KeyValueOperator{anyPortClause()}
+		}
+		return policy.TagSelectorList{{Clause: clauses, Policy: flowPolicy}}
+	}
+
+	selectors := policy.TagSelectorList{}
+
+	for _, p := range ports {
+		clause := make([]policy.KeyValueOperator, 0, len(clauses)+1)
+		clause = append(clause, clauses...)
+		clause = append(clause, policy.KeyValueOperator{
+			Key:       constants.PortNumberLabelString,
+			Value:     []string{p.protocol},
+			Operator:  policy.Equal,
+			PortRange: p.ports,
+		})
+
+		selectors = append(selectors, policy.TagSelector{Clause: clause, Policy: flowPolicy})
+	}
+
+	return selectors
+}
+
+// ipRules returns an ACL per port for the given networks.
+func ipRules(networks []string, ports []portMatch, flowPolicy *policy.FlowPolicy) policy.IPRuleList {
+
+	if len(networks) == 0 {
+		return nil
+	}
+
+	if len(ports) == 0 {
+		return policy.IPRuleList{{
+			Addresses: networks,
+			Protocols: []string{constants.AllProtoString},
+			Policy:    flowPolicy,
+		}}
+	}
+
+	acls := policy.IPRuleList{}
+
+	for _, p := range ports {
+		acls = append(acls, policy.IPRule{
+			Addresses: networks,
+			Ports:     []string{p.ports.String()},
+			Protocols: []string{p.protocol},
+			Policy:    flowPolicy,
+		})
+	}
+
+	return acls
+}
+
+// subtractNetworks returns the smallest sorted list of networks that covers a
+// network without the except networks. The except networks that are invalid
+// or of another family are ignored.
+func subtractNetworks(network string, except []string) []string {
+
+	_, ipnet, err := net.ParseCIDR(network)
+	if err != nil {
+		return []string{network}
+	}
+
+	excluded := []*net.IPNet{}
+	for _, e := range except {
+		_, exceptNet, err := net.ParseCIDR(e)
+		if err != nil || len(exceptNet.IP) != len(ipnet.IP) {
+			zap.L().Debug("Ignoring invalid ipBlock except", zap.String("cidr", network), zap.String("except", e))
+			continue
+		}
+		excluded = append(excluded, exceptNet)
+	}
+
+	networks := []string{}
+
+	var split func(n *net.IPNet)
+	split = func(n *net.IPNet) {
+
+		ones, bits := n.Mask.Size()
+		overlaps := false
+
+		for _, e := range excluded {
+			exceptOnes, _ := e.Mask.Size()
+			if exceptOnes <= ones && e.Contains(n.IP) {
+				return
+			}
+			if n.Contains(e.IP) {
+				overlaps = true
+			}
+		}
+
+		if !overlaps {
+			networks = append(networks, n.String())
+			return
+		}
+
+		// An except network is strictly inside n. Split n in its two halves.
+		mask := net.CIDRMask(ones+1, bits)
+		high := make(net.IP, len(n.IP))
+		copy(high, n.IP)
+		high[ones/8] |= 0x80 >> uint(ones%8)
+
+		split(&net.IPNet{IP: n.IP, Mask: mask})
+		split(&net.IPNet{IP: high, Mask: mask})
+	}
+
+	split(ipnet)
+
+	return networks
+}
+
+// allowAll sets the rules of a direction that is not isolated.
+func allowAll(r *rules) {
+
+	flowPolicy := &policy.FlowPolicy{Action: policy.Accept}
+
+	r.selectors = policy.TagSelectorList{{
+		Clause: []policy.KeyValueOperator{anyPortClause()},
+		Policy: flowPolicy,
+	}}
+
+	r.acls = ipRules(anyNetworks, nil, flowPolicy)
+}
+
+// anyPortClause is a clause that matches any peer.
+func anyPortClause() policy.KeyValueOperator {
+
+	return policy.KeyValueOperator{
+		Key:      constants.PortNumberLabelString,
+		Operator: policy.KeyExists,
+	}
+}
@@ -0,0 +1,504 @@
+package networkpolicy
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"go.aporeto.io/enforcerd/trireme-lib/controller/constants"
+	"go.aporeto.io/enforcerd/trireme-lib/monitor/extractors"
+	"go.aporeto.io/enforcerd/trireme-lib/policy"
+	"go.aporeto.io/enforcerd/trireme-lib/utils/portspec"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func namespace(name string, labels map[string]string) *corev1.Namespace {
+	return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}
+}
+
+func networkPolicy(name string, spec networkingv1.NetworkPolicySpec) *networkingv1.NetworkPolicy {
+	return &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Spec:       spec,
+	}
+}
+
+func tcpPort(port int) networkingv1.NetworkPolicyPort {
+	p := intstr.FromInt(port)
+	return networkingv1.NetworkPolicyPort{Port: &p}
+}
+
+func namedPort(name string) networkingv1.NetworkPolicyPort {
+	p := intstr.FromString(name)
+	return networkingv1.NetworkPolicyPort{Port: &p}
+}
+
+func udpPort(port int) networkingv1.NetworkPolicyPort {
+	p := intstr.FromInt(port)
+	proto := corev1.ProtocolUDP
+	return networkingv1.NetworkPolicyPort{Port: &p, Protocol: &proto}
+}
+
+func portClause(proto string, port uint16) policy.KeyValueOperator {
+	spec, _ := portspec.NewPortSpec(port, port, nil) // nolint: errcheck
+	return policy.KeyValueOperator{
+		Key:       constants.PortNumberLabelString,
+		Value:     []string{proto},
+		Operator:  policy.Equal,
+		PortRange: spec,
+	}
+}
+
+func namespaceClause(names ...string) policy.KeyValueOperator {
+	return policy.KeyValueOperator{
+		Key:      extractors.UpstreamNamespaceIdentifier,
+		Value:    names,
+		Operator: policy.Equal,
+	}
+}
+
+func accept(id string) *policy.FlowPolicy {
+	return &policy.FlowPolicy{Action: policy.Accept, PolicyID: "default/" + id}
+}
+
+var (
+	allowAllSelectors = policy.TagSelectorList{{
+		Clause: []policy.KeyValueOperator{{Key: constants.PortNumberLabelString, Operator: policy.KeyExists}},
+		Policy: &policy.FlowPolicy{Action: policy.Accept},
+	}}
+	allowAllACLs = policy.IPRuleList{{
+		Addresses: anyNetworks,
+		Protocols: []string{constants.AllProtoString},
+		Policy:    &policy.FlowPolicy{Action: policy.Accept},
+	}}
+)
+
+func TestTranslate(t *testing.T) {
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "web",
+			Namespace: "default",
+			Labels:    map[string]string{"app": "web", "tier": "front"},
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{
+				Name:  "nginx",
+				Ports: []corev1.ContainerPort{{Name: "http", ContainerPort: 8080}},
+			}},
+		},
+	}
+
+	db := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "db",
+			Namespace: "storage",
+			Labels:    map[string]string{"app": "db"},
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{
+				Name:  "postgres",
+				Ports: []corev1.ContainerPort{{Name: "sql", ContainerPort: 5432, Protocol: corev1.ProtocolTCP}},
+			}},
+		},
+	}
+
+	namespaces := []runtime.Object{
+		namespace("default", map[string]string{"team": "web"}),
+		namespace("storage", map[string]string{"team": "data"}),
+		namespace("monitoring", map[string]string{"team": "ops"}),
+		namespace("kube-system", nil),
+	}
+
+	tests := []struct {
+		name        string
+		policies    []runtime.Object
+		wantRx      policy.TagSelectorList
+		wantTx      policy.TagSelectorList
+		wantNetACLs policy.IPRuleList
+		wantAppACLs policy.IPRuleList
+	}{
+		{
+			name:        "no policy allows everything",
+			wantRx:      allowAllSelectors,
+			wantTx:      allowAllSelectors,
+			wantNetACLs: allowAllACLs,
+			wantAppACLs: allowAllACLs,
+		},
+		{
+			name: "policy that does not select the pod",
+			policies: []runtime.Object{
+				networkPolicy("other", networkingv1.NetworkPolicySpec{
+					PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{"app": "other"}},
+				}),
+			},
+			wantRx:      allowAllSelectors,
+			wantTx:      allowAllSelectors,
+			wantNetACLs: allowAllACLs,
+			wantAppACLs: allowAllACLs,
+		},
+		{
+			name: "default deny ingress",
+			policies: []runtime.Object{
+				networkPolicy("deny", networkingv1.NetworkPolicySpec{}),
+			},
+			wantRx:      policy.TagSelectorList{},
+			wantTx:      allowAllSelectors,
+			wantNetACLs: policy.IPRuleList{},
+			wantAppACLs: allowAllACLs,
+		},
+		{
+			name: "default deny all",
+			policies: []runtime.Object{
+				networkPolicy("deny", networkingv1.NetworkPolicySpec{
+					PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress, networkingv1.PolicyTypeEgress},
+				}),
+			},
+			wantRx:      policy.TagSelectorList{},
+			wantTx:      policy.TagSelectorList{},
+			wantNetACLs: policy.IPRuleList{},
+			wantAppACLs: policy.IPRuleList{},
+		},
+		{
+			name: "allow all ingress",
+			policies: []runtime.Object{
+				networkPolicy("allow", networkingv1.NetworkPolicySpec{
+					Ingress: []networkingv1.NetworkPolicyIngressRule{{}},
+				}),
+			},
+			wantRx: policy.TagSelectorList{{
+				Clause: []policy.KeyValueOperator{{Key: constants.PortNumberLabelString, Operator: policy.KeyExists}},
+				Policy: accept("allow"),
+			}},
+			wantTx: allowAllSelectors,
+			wantNetACLs: policy.IPRuleList{{
+				Addresses: anyNetworks,
+				Protocols: []string{constants.AllProtoString},
+				Policy:    accept("allow"),
+			}},
+			wantAppACLs: allowAllACLs,
+		},
+		{
+			name: "ingress from pods of the namespace on a port",
+			policies: []runtime.Object{
+				networkPolicy("clients", networkingv1.NetworkPolicySpec{
+					PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+					Ingress: []networkingv1.NetworkPolicyIngressRule{{
+						Ports: []networkingv1.NetworkPolicyPort{tcpPort(80), tcpPort(443)},
+						From: []networkingv1.NetworkPolicyPeer{{
+							PodSelector: &metav1.LabelSelector{
+								MatchLabels: map[string]string{"role": "client"},
+								MatchExpressions: []metav1.LabelSelectorRequirement{
+									{Key: "env", Operator: metav1.LabelSelectorOpIn, Values: []string{"prod", "staging"}},
+									{Key: "debug", Operator: metav1.LabelSelectorOpDoesNotExist},
+								},
+							},
+						}},
+					}},
+				}),
+			},
+			wantRx: policy.TagSelectorList{
+				{
+					Clause: []policy.KeyValueOperator{
+						namespaceClause("default"),
+						{Key: "role", Value: []string{"client"}, Operator: policy.Equal},
+						{Key: "env", Value: []string{"prod", "staging"}, Operator: policy.Equal},
+						{Key: "debug", Operator: policy.KeyNotExists},
+						portClause(constants.TCPProtoString, 80),
+					},
+					Policy: accept("clients"),
+				},
+				{
+					Clause: []policy.KeyValueOperator{
+						namespaceClause("default"),
+						{Key: "role", Value: []string{"client"}, Operator: policy.Equal},
+						{Key: "env", Value: []string{"prod", "staging"}, Operator: policy.Equal},
+						{Key: "debug", Operator: policy.KeyNotExists},
+						portClause(constants.TCPProtoString, 443),
+					},
+					Policy: accept("clients"),
+				},
+			},
+			wantTx:      allowAllSelectors,
+			wantNetACLs: policy.IPRuleList{},
+			wantAppACLs: allowAllACLs,
+		},
+		{
+			name: "ingress from selected namespaces on a named port",
+			policies: []runtime.Object{
+				networkPolicy("namespaces", networkingv1.NetworkPolicySpec{
+					Ingress: []networkingv1.NetworkPolicyIngressRule{{
+						Ports: []networkingv1.NetworkPolicyPort{namedPort("http"), namedPort("missing")},
+						From: []networkingv1.NetworkPolicyPeer{
+							{
+								NamespaceSelector: &metav1.LabelSelector{
+									MatchExpressions: []metav1.LabelSelectorRequirement{
+										{Key: "team", Operator: metav1.LabelSelectorOpIn, Values: []string{"ops", "data"}},
+									},
+								},
+								PodSelector: &metav1.LabelSelector{
+									MatchExpressions: []metav1.LabelSelectorRequirement{
+										{Key: "scraper", Operator: metav1.LabelSelectorOpExists},
+										{Key: "env", Operator: metav1.LabelSelectorOpNotIn, Values: []string{"dev"}},
+									},
+								},
+							},
+							{
+								NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"team": "none"}},
+							},
+							{
+								NamespaceSelector: &metav1.LabelSelector{},
+							},
+						},
+					}},
+				}),
+			},
+			wantRx: policy.TagSelectorList{
+				{
+					Clause: []policy.KeyValueOperator{
+						namespaceClause("monitoring", "storage"),
+						{Key: "scraper", Operator: policy.KeyExists},
+						{Key: "env", Value: []string{"dev"}, Operator: policy.NotEqual},
+						portClause(constants.TCPProtoString, 8080),
+					},
+					Policy: accept("namespaces"),
+				},
+				{
+					Clause: []policy.KeyValueOperator{
+						{Key: extractors.UpstreamNamespaceIdentifier, Operator: policy.KeyExists},
+						portClause(constants.TCPProtoString, 8080),
+					},
+					Policy: accept("namespaces"),
+				},
+			},
+			wantTx:      allowAllSelectors,
+			wantNetACLs: policy.IPRuleList{},
+			wantAppACLs: allowAllACLs,
+		},
+		{
+			name: "ingress rule with unresolved named port only",
+			policies: []runtime.Object{
+				networkPolicy("missing", networkingv1.NetworkPolicySpec{
+					Ingress: []networkingv1.NetworkPolicyIngressRule{{
+						Ports: []networkingv1.NetworkPolicyPort{namedPort("missing")},
+					}},
+				}),
+			},
+			wantRx:      policy.TagSelectorList{},
+			wantTx:      allowAllSelectors,
+			wantNetACLs: policy.IPRuleList{},
+			wantAppACLs: allowAllACLs,
+		},
+		{
+			name: "egress to ipBlock with except",
+			policies: []runtime.Object{
+				networkPolicy("dns", networkingv1.NetworkPolicySpec{
+					PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeEgress},
+					Egress: []networkingv1.NetworkPolicyEgressRule{{
+						Ports: []networkingv1.NetworkPolicyPort{udpPort(53)},
+						To: []networkingv1.NetworkPolicyPeer{{
+							IPBlock: &networkingv1.IPBlock{CIDR: "10.0.0.0/8", Except: []string{"10.1.0.0/16"}},
+						}},
+					}},
+				}),
+			},
+			wantRx:      allowAllSelectors,
+			wantTx:      policy.TagSelectorList{},
+			wantNetACLs: allowAllACLs,
+			wantAppACLs: policy.IPRuleList{{
+				Addresses: []string{"10.0.0.0/16", "10.2.0.0/15", "10.4.0.0/14", "10.8.0.0/13", "10.16.0.0/12", "10.32.0.0/11", "10.64.0.0/10", "10.128.0.0/9"},
+				Ports:     []string{"53"},
+				Protocols: []string{constants.UDPProtoString},
+				Policy:    accept("dns"),
+			}},
+		},
+		{
+			name: "except of a policy does not reject the networks allowed by another policy",
+			policies: []runtime.Object{
+				networkPolicy("b-external", networkingv1.NetworkPolicySpec{
+					PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeEgress},
+					Egress: []networkingv1.NetworkPolicyEgressRule{{
+						To: []networkingv1.NetworkPolicyPeer{{
+							IPBlock: &networkingv1.IPBlock{CIDR: "192.168.0.0/16", Except: []string{"192.168.0.0/17", "192.168.128.0/24"}},
+						}},
+					}},
+				}),
+				networkPolicy("a-internal", networkingv1.NetworkPolicySpec{
+					PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeEgress},
+					Egress: []networkingv1.NetworkPolicyEgressRule{{
+						To: []networkingv1.NetworkPolicyPeer{{
+							IPBlock: &networkingv1.IPBlock{CIDR: "192.168.1.0/24"},
+						}},
+					}},
+				}),
+			},
+			wantRx:      allowAllSelectors,
+			wantTx:      policy.TagSelectorList{},
+			wantNetACLs: allowAllACLs,
+			wantAppACLs: policy.IPRuleList{
+				{
+					Addresses: []string{"192.168.1.0/24"},
+					Protocols: []string{constants.AllProtoString},
+					Policy:    accept("a-internal"),
+				},
+				{
+					Addresses: []string{"192.168.129.0/24", "192.168.130.0/23", "192.168.132.0/22", "192.168.136.0/21", "192.168.144.0/20", "192.168.160.0/19", "192.168.192.0/18"},
+					Protocols: []string{constants.AllProtoString},
+					Policy:    accept("b-external"),
+				},
+			},
+		},
+		{
+			name: "egress to pods of other namespaces on a named port",
+			policies: []runtime.Object{
+				networkPolicy("db", networkingv1.NetworkPolicySpec{
+					PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeEgress},
+					Egress: []networkingv1.NetworkPolicyEgressRule{{
+						Ports: []networkingv1.NetworkPolicyPort{namedPort("sql")},
+						To: []networkingv1.NetworkPolicyPeer{{
+							NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"team": "data"}},
+							PodSelector:       &metav1.LabelSelector{MatchLabels: map[string]string{"app": "db"}},
+						}},
+					}},
+				}),
+			},
+			wantRx: allowAllSelectors,
+			wantTx: policy.TagSelectorList{{
+				Clause: []policy.KeyValueOperator{
+					namespaceClause("storage"),
+					{Key: "app", Value: []string{"db"}, Operator: policy.Equal},
+					portClause(constants.TCPProtoString, 5432),
+				},
+				Policy: accept("db"),
+			}},
+			wantNetACLs: allowAllACLs,
+			wantAppACLs: policy.IPRuleList{},
+		},
+		{
+			name: "rules of several policies are merged",
+			policies: []runtime.Object{
+				networkPolicy("b-https", networkingv1.NetworkPolicySpec{
+					PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{"tier": "front"}},
+					Ingress: []networkingv1.NetworkPolicyIngressRule{{
+						Ports: []networkingv1.NetworkPolicyPort{tcpPort(443)},
+					}},
+				}),
+				networkPolicy("a-deny-egress", networkingv1.NetworkPolicySpec{
+					PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeEgress},
+				}),
+			},
+			wantRx: policy.TagSelectorList{{
+				Clause: []policy.KeyValueOperator{portClause(constants.TCPProtoString, 443)},
+				Policy: accept("b-https"),
+			}},
+			wantTx: policy.TagSelectorList{},
+			wantNetACLs: policy.IPRuleList{{
+				Addresses: anyNetworks,
+				Ports:     []string{"443"},
+				Protocols: []string{constants.TCPProtoString},
+				Policy:    accept("b-https"),
+			}},
+			wantAppACLs: policy.IPRuleList{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objects := append([]runtime.Object{pod, db}, namespaces...)
+			objects = append(objects, tt.policies...)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			r := NewResolver(nil, fake.NewSimpleClientset(objects...), 0)
+			if err := r.Run(ctx); err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+
+			tags := policy.NewTagStoreFromSlice([]string{"app=web", extractors.UpstreamNamespaceIdentifier + "=default"})
+			puRuntime := policy.NewPURuntime("web", 0, "", tags, nil, 0, policy.None, nil)
+
+			p, err := r.translator.translate("pu", pod, puRuntime)
+			if err != nil {
+				t.Fatalf("translate() error = %v", err)
+			}
+
+			if p.TriremeAction() != policy.Police {
+				t.Errorf("translate() action = %v, want %v", p.TriremeAction(), policy.Police)
+			}
+			if !reflect.DeepEqual(p.Identity(), tags) {
+				t.Errorf("translate() identity = %v, want %v", p.Identity(), tags)
+			}
+			if got := p.ReceiverRules(); !reflect.DeepEqual(got, tt.wantRx) {
+				t.Errorf("translate() receiver rules = %+v, want %+v", got, tt.wantRx)
+			}
+			if got := p.TransmitterRules(); !reflect.DeepEqual(got, tt.wantTx) {
+				t.Errorf("translate() transmitter rules = %+v, want %+v", got, tt.wantTx)
+			}
+			if got := p.NetworkACLs(); !reflect.DeepEqual(got, tt.wantNetACLs) {
+				t.Errorf("translate() network ACLs = %+v, want %+v", got, tt.wantNetACLs)
+			}
+			if got := p.ApplicationACLs(); !reflect.DeepEqual(got, tt.wantAppACLs) {
+				t.Errorf("translate() application ACLs = %+v, want %+v", got, tt.wantAppACLs)
+			}
+		})
+	}
+}
+
+func TestSubtractNetworks(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		network string
+		except  []string
+		want    []string
+	}{
+		{
+			name:    "no except",
+			network: "10.0.0.0/8",
+			want:    []string{"10.0.0.0/8"},
+		},
+		{
+			name:    "except at the end of the network",
+			network: "10.0.0.0/24",
+			except:  []string{"10.0.0.192/26"},
+			want:    []string{"10.0.0.0/25", "10.0.0.128/26"},
+		},
+		{
+			name:    "except covering the network",
+			network: "10.1.0.0/16",
+			except:  []string{"10.0.0.0/8"},
+			want:    []string{},
+		},
+		{
+			name:    "except outside the network",
+			network: "10.0.0.0/8",
+			except:  []string{"192.168.0.0/16"},
+			want:    []string{"10.0.0.0/8"},
+		},
+		{
+			name:    "ipv6 network",
+			network: "2001:db8::/32",
+			except:  []string{"2001:db8:8000::/33"},
+			want:    []string{"2001:db8::/33"},
+		},
+		{
+			name:    "invalid and other family excepts are ignored",
+			network: "10.0.0.0/8",
+			except:  []string{"invalid", "::/0"},
+			want:    []string{"10.0.0.0/8"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := subtractNetworks(tt.network, tt.except); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("subtractNetworks() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
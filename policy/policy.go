@@ -112,6 +112,10 @@ type PUPolicy struct {
 	logPrefixMapping map[string]string
 	// logPrefixMappingCalculated is used to no when to calculate the log mapping
 	logPrefixMappingCalculated bool
+	// replayProtection enables the detection of replayed syn and synack tokens
+	replayProtection bool
+	// spiffeID is the SPIFFE ID of the PU that the service certificates must hold
+	spiffeID string
 
 	sync.Mutex
 }
@@ -249,9 +253,43 @@ func (p *PUPolicy) Clone() *PUPolicy {
 		p.netDefaultPolicyAction,
 	)
 
+	np.replayProtection = p.replayProtection
+	np.spiffeID = p.spiffeID
+
 	return np
 }
 
+// Quarantine returns a copy of the policy that rejects all the traffic of
+// the PU. The identity of the PU is kept, so that the rejected flows are
+// still reported for the PU.
+func (p *PUPolicy) Quarantine() *PUPolicy {
+	p.Lock()
+	defer p.Unlock()
+
+	return NewPUPolicy(
+		p.managementID,
+		p.managementNamespace,
+		Police,
+		nil,
+		nil,
+		nil,
+		nil,
+		nil,
+		p.identity.Copy(),
+		p.annotations.Copy(),
+		p.compressedTags.Copy(),
+		p.ips.Copy(),
+		p.servicesListeningPort,
+		p.dnsProxyPort,
+		nil,
+		nil,
+		p.scopes,
+		p.enforcerType,
+		Reject|Log,
+		Reject|Log,
+	)
+}
+
 // ManagementID returns the management ID
 func (p *PUPolicy) ManagementID() string {
 	p.Lock()
@@ -430,7 +468,8 @@ func (p *PUPolicy) UpdateDNSNetworks(networks DNSRuleList) {
 	}
 }
 
-// UpdateServiceCertificates updates the certificate and private key of the policy
+// UpdateServiceCertificates updates the certificate and private key of the policy.
+// When the PU has a SPIFFE ID, the certificate must be an X.509-SVID of it.
 func (p *PUPolicy) UpdateServiceCertificates(cert, key string) {
 	p.Lock()
 	defer p.Unlock()
@@ -479,6 +518,39 @@ func (p *PUPolicy) NetDefaultPolicyAction() ActionType {
 	return p.netDefaultPolicyAction
 }
 
+// ReplayProtection returns true if the replayed tokens of the PU must be detected.
+func (p *PUPolicy) ReplayProtection() bool {
+	p.Lock()
+	defer p.Unlock()
+
+	return p.replayProtection
+}
+
+// SetReplayProtection enables or disables the detection of replayed tokens.
+func (p *PUPolicy) SetReplayProtection(enabled bool) {
+	p.Lock()
+	defer p.Unlock()
+
+	p.replayProtection = enabled
+}
+
+// SPIFFEID returns the SPIFFE ID of the PU. The service certificates of the
+// PU must hold it as URI SAN.
+func (p *PUPolicy) SPIFFEID() string {
+	p.Lock()
+	defer p.Unlock()
+
+	return p.spiffeID
+}
+
+// SetSPIFFEID sets the SPIFFE ID of the PU.
+func (p *PUPolicy) SetSPIFFEID(id string) {
+	p.Lock()
+	defer p.Unlock()
+
+	p.spiffeID = id
+}
+
 // ToPublicPolicy converts the object to a marshallable object.
 func (p *PUPolicy) ToPublicPolicy() *PUPolicyPublic {
 	p.Lock()
@@ -508,6 +580,8 @@ func (p *PUPolicy) ToPublicPolicy() *PUPolicyPublic {
 		EnforcerType:           p.enforcerType,
 		AppDefaultPolicyAction: p.appDefaultPolicyAction,
 		NetDefaultPolicyAction: p.netDefaultPolicyAction,
+		ReplayProtection:       p.replayProtection,
+		SPIFFEID:               p.spiffeID,
 	}
 }
 
@@ -602,6 +676,8 @@ type PUPolicyPublic struct {
 	EnforcerType           EnforcerType            `json:"enforcerTypes,omitempty"`
 	AppDefaultPolicyAction ActionType              `json:"appDefaultPolicyAction,omitempty"`
 	NetDefaultPolicyAction ActionType              `json:"netDefaultPolicyAction,omitempty"`
+	ReplayProtection       bool                    `json:"replayProtection,omitempty"`
+	SPIFFEID               string                  `json:"spiffeID,omitempty"`
 }
 
 // ToPrivatePolicy converts the object to a private object.
@@ -643,5 +719,7 @@ func (p *PUPolicyPublic) ToPrivatePolicy(ctx context.Context, convert bool) (*PU
 		servicesPrivateKey:     p.ServicesPrivateKey,
 		appDefaultPolicyAction: p.AppDefaultPolicyAction,
 		netDefaultPolicyAction: p.NetDefaultPolicyAction,
+		replayProtection:       p.ReplayProtection,
+		spiffeID:               p.SPIFFEID,
 	}, nil
 }
@@ -3,6 +3,7 @@
 package policy
 
 import (
+	"context"
 	"testing"
 
 	. "github.com/smartystreets/goconvey/convey"
@@ -131,6 +132,37 @@ func TestNewPolicyWithDefaults(t *testing.T) {
 	})
 }
 
+func TestQuarantine(t *testing.T) {
+	Convey("When I quarantine a policy", t, func() {
+		p := NewPUPolicy("id", "/ns", AllowAll,
+			IPRuleList{{Addresses: []string{"0.0.0.0/0"}, Policy: &FlowPolicy{Action: Accept}}},
+			IPRuleList{{Addresses: []string{"0.0.0.0/0"}, Policy: &FlowPolicy{Action: Accept}}},
+			nil,
+			TagSelectorList{{Policy: &FlowPolicy{Action: Accept}}},
+			TagSelectorList{{Policy: &FlowPolicy{Action: Accept}}},
+			NewTagStoreFromSlice([]string{"app=web"}),
+			nil, nil, ExtendedMap{"bridge": "10.0.0.1"}, 0, 0, nil, nil, []string{}, EnforcerMapping, Accept, Accept,
+		)
+		q := p.Quarantine()
+		Convey("It should reject all the traffic and keep the identity", func() {
+			So(q.TriremeAction(), ShouldEqual, Police)
+			So(q.ApplicationACLs(), ShouldBeEmpty)
+			So(q.NetworkACLs(), ShouldBeEmpty)
+			So(q.TransmitterRules(), ShouldBeEmpty)
+			So(q.ReceiverRules(), ShouldBeEmpty)
+			So(q.AppDefaultPolicyAction(), ShouldEqual, Reject|Log)
+			So(q.NetDefaultPolicyAction(), ShouldEqual, Reject|Log)
+			So(q.ManagementID(), ShouldEqual, "id")
+			So(q.Identity().GetSlice(), ShouldResemble, []string{"app=web"})
+			So(q.IPAddresses(), ShouldResemble, ExtendedMap{"bridge": "10.0.0.1"})
+		})
+		Convey("The original policy should not change", func() {
+			So(p.TriremeAction(), ShouldEqual, AllowAll)
+			So(len(p.ApplicationACLs()), ShouldEqual, 1)
+		})
+	})
+}
+
 func TestFuncClone(t *testing.T) {
 	Convey("When I have a default policy", t, func() {
 		appACL := IPRule{
@@ -312,6 +344,28 @@ func TestAllLockedSetGet(t *testing.T) {
 			So(p.triremeAction, ShouldEqual, Police)
 		})
 
+		Convey("I should be able to enable the replay protection", func() {
+			So(p.ReplayProtection(), ShouldBeFalse)
+			p.SetReplayProtection(true)
+			So(p.ReplayProtection(), ShouldBeTrue)
+			So(p.Clone().ReplayProtection(), ShouldBeTrue)
+
+			pp, err := p.ToPublicPolicy().ToPrivatePolicy(context.Background(), false)
+			So(err, ShouldBeNil)
+			So(pp.ReplayProtection(), ShouldBeTrue)
+		})
+
+		Convey("I should be able to set the SPIFFE ID", func() {
+			So(p.SPIFFEID(), ShouldEqual, "")
+			p.SetSPIFFEID("spiffe://example.org/web")
+			So(p.SPIFFEID(), ShouldEqual, "spiffe://example.org/web")
+			So(p.Clone().SPIFFEID(), ShouldEqual, "spiffe://example.org/web")
+
+			pp, err := p.ToPublicPolicy().ToPrivatePolicy(context.Background(), false)
+			So(err, ShouldBeNil)
+			So(pp.SPIFFEID(), ShouldEqual, "spiffe://example.org/web")
+		})
+
 		Convey("I should be able to retrieve the APP acls ", func() {
 			So(p.ApplicationACLs(), ShouldResemble, IPRuleList{appACL})
 		})
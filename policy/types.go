@@ -6,6 +6,7 @@ import (
 	"hash/fnv"
 	"net"
 	"strings"
+	"time"
 
 	"github.com/docker/go-connections/nat"
 	"go.aporeto.io/enforcerd/trireme-lib/common"
@@ -471,6 +472,11 @@ type OptionsType struct {
 	// CgroupMark is the tag of the cgroup
 	CgroupMark string
 
+	// CgroupPath is the path of an existing cgroup v2 of the PU, relative to
+	// the root of the hierarchy. If set, the PU is matched on this cgroup
+	// instead of its Trireme cgroup.
+	CgroupPath string
+
 	// UserID is the user ID if it exists
 	UserID string
 
@@ -480,6 +486,15 @@ type OptionsType struct {
 	// Services is the list of services of interest
 	Services []common.Service
 
+	// DependentServices are the services discovered by the monitor that the
+	// PU can reach, like the Kubernetes services. The resolver decides if they
+	// are added to the dependent services of the policy.
+	DependentServices ApplicationServicesList
+
+	// ServiceAddresses maps the ID of the dependent services to the addresses
+	// of their endpoints.
+	ServiceAddresses map[string][]string
+
 	// PolicyExtensions is policy resolution extensions
 	PolicyExtensions interface{}
 
@@ -489,6 +504,10 @@ type OptionsType struct {
 	// ConvertedDockerPU is set when a docker PU is converted to LinuxProcess
 	// in order to implement host network containers.
 	ConvertedDockerPU bool
+
+	// Quarantined is set when the PU must reject all its traffic, whatever its
+	// policy is, like when the verification of its binary failed.
+	Quarantined bool
 }
 
 // RuntimeError is an error detected by the TriremeController that has to be
@@ -505,6 +524,16 @@ type DebugConfigInput struct {
 	FilePath    string
 	PcapFilter  string
 	CommandExec string
+
+	// PcapNative captures the packets of the PU in the datapath instead of
+	// running tcpdump. The capture stops after PcapDuration or when PcapMaxSize
+	// bytes are written. Its files rotate every PcapFileSize bytes in a ring of
+	// PcapFiles files.
+	PcapNative   bool
+	PcapDuration time.Duration
+	PcapMaxSize  int64
+	PcapFileSize int64
+	PcapFiles    int
 }
 
 // DebugConfigResult holds results from a debug collect.
@@ -258,7 +258,8 @@ func CgroupMemberCount(cgroupName string) int {
 	return len(data)
 }
 
-// NewDockerCgroupNetController returns a handle to call functions on the cgroup net_cls controller
+// NewDockerCgroupNetController returns a handle to call functions on the cgroup net_cls controller.
+// The cgroup v2 implementation is returned if the net_cls controller is not available.
 func NewDockerCgroupNetController() Cgroupnetcls {
 
 	controller := &netCls{
@@ -267,10 +268,15 @@ func NewDockerCgroupNetController() Cgroupnetcls {
 		TriremePath:      common.TriremeDockerHostNetwork,
 	}
 
+	if IsCgroupV2() {
+		return newNetClsV2(cgroupV2Root, controller.TriremePath, "")
+	}
+
 	return controller
 }
 
-//NewCgroupNetController returns a handle to call functions on the cgroup net_cls controller
+//NewCgroupNetController returns a handle to call functions on the cgroup net_cls controller.
+//The cgroup v2 implementation is returned if the net_cls controller is not available.
 func NewCgroupNetController(triremepath string, releasePath string) Cgroupnetcls {
 
 	binpath, _ := osext.Executable()
@@ -288,6 +294,10 @@ func NewCgroupNetController(triremepath string, releasePath string) Cgroupnetcls
 		controller.TriremePath = triremepath
 	}
 
+	if IsCgroupV2() {
+		return newNetClsV2(cgroupV2Root, controller.TriremePath, controller.ReleaseAgentPath)
+	}
+
 	return controller
 }
 
@@ -67,3 +67,23 @@ func NewDockerCgroupNetController() Cgroupnetcls {
 func MarkVal() uint64 {
 	return 103
 }
+
+// IsCgroupV2 is always false on this platform
+func IsCgroupV2() bool {
+	return false
+}
+
+// CgroupV2Path is not supported on this platform
+func CgroupV2Path(triremePath string, cgroupName string) string {
+	return ""
+}
+
+// EnsureCgroupV2Path is not supported on this platform
+func EnsureCgroupV2Path(path string) error {
+	return nil
+}
+
+// EnforcerCgroupV2Path is not supported on this platform
+func EnforcerCgroupV2Path() (string, error) {
+	return "", nil
+}
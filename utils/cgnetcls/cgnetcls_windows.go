@@ -81,3 +81,23 @@ func NewDockerCgroupNetController() Cgroupnetcls {
 // ConfigureNetClsPath does nothing for windows
 func ConfigureNetClsPath(path string) {
 }
+
+// IsCgroupV2 is always false on this platform
+func IsCgroupV2() bool {
+	return false
+}
+
+// CgroupV2Path is not supported on this platform
+func CgroupV2Path(triremePath string, cgroupName string) string {
+	return ""
+}
+
+// EnsureCgroupV2Path is not supported on this platform
+func EnsureCgroupV2Path(path string) error {
+	return nil
+}
+
+// EnforcerCgroupV2Path is not supported on this platform
+func EnforcerCgroupV2Path() (string, error) {
+	return "", nil
+}
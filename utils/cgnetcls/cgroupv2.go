@@ -0,0 +1,507 @@
+// +build linux
+
+package cgnetcls
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"unsafe"
+
+	"go.uber.org/zap"
+)
+
+const (
+	eventsFile = "/cgroup.events"
+)
+
+var cgroupV2Once sync.Once
+
+// netClsV2 implements Cgroupnetcls on top of the unified cgroup v2 hierarchy.
+// There is no net_cls classid in cgroup v2. The processes are still placed
+// in the Trireme hierarchy and the packets are matched on the path of the
+// cgroup with the iptables cgroup match. The marks are only kept for the
+// callers that read them back.
+type netClsV2 struct {
+	root             string
+	ReleaseAgentPath string
+	TriremePath      string
+	marks            map[string]uint64
+	notifier         *releaseNotifier
+	sync.Mutex
+}
+
+// IsCgroupV2 returns true if the net_cls controller of cgroup v1 is not
+// available on the host and a cgroup v2 hierarchy is mounted.
+func IsCgroupV2() bool {
+
+	cgroupV2Once.Do(func() {
+		mounts, err := os.Open("/proc/mounts")
+		if err != nil {
+			return
+		}
+		defer mounts.Close() // nolint: errcheck
+
+		controllers, err := os.Open("/proc/cgroups")
+		if err != nil {
+			return
+		}
+		defer controllers.Close() // nolint: errcheck
+
+		cgroupV2Root = detectCgroupV2(mounts, controllers)
+	})
+
+	return cgroupV2Root != ""
+}
+
+// detectCgroupV2 returns the mount point of the cgroup v2 hierarchy if the
+// net_cls controller is neither mounted nor enabled in the kernel.
+func detectCgroupV2(mounts io.Reader, controllers io.Reader) string {
+
+	root := ""
+
+	sc := bufio.NewScanner(mounts)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 4 {
+			continue
+		}
+
+		switch fields[2] {
+		case "cgroup":
+			for _, option := range strings.Split(fields[3], ",") {
+				if option == "net_cls" {
+					return ""
+				}
+			}
+		case "cgroup2":
+			if root == "" {
+				root = fields[1]
+			}
+		}
+	}
+
+	if root == "" {
+		return ""
+	}
+
+	// The controller can still be mounted by mountCgroupController if the
+	// kernel has it.
+	sc = bufio.NewScanner(controllers)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 4 && fields[0] == "net_cls" && fields[3] == "1" {
+			return ""
+		}
+	}
+
+	return root
+}
+
+// CgroupV2Path returns the path of a cgroup created by a controller with the
+// given Trireme path, relative to the root of the cgroup v2 hierarchy. Every
+// monitor creates the cgroups of its PUs under its own Trireme path, like
+// TriremeCgroupPath for the linux processes or TriremeDockerHostNetwork for
+// the host network containers. This is the path used by the iptables cgroup
+// match.
+func CgroupV2Path(triremePath string, cgroupName string) string {
+	return filepath.Join("/", triremePath, cgroupName)
+}
+
+// EnsureCgroupV2Path creates the cgroup at the given path relative to the
+// root of the cgroup v2 hierarchy. The iptables cgroup match fails if the
+// cgroup does not exist when the rules are installed.
+func EnsureCgroupV2Path(path string) error {
+
+	if !IsCgroupV2() {
+		return fmt.Errorf("cgroup v2 is not in use")
+	}
+
+	if err := os.MkdirAll(filepath.Join(cgroupV2Root, path), 0700); err != nil {
+		return fmt.Errorf("unable to create cgroup %s: %s", path, err)
+	}
+
+	return nil
+}
+
+// EnforcerCgroupV2Path returns the cgroup v2 path of the current process.
+func EnforcerCgroupV2Path() (string, error) {
+
+	data, err := ioutil.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		return "", fmt.Errorf("unable to read cgroup of the enforcer: %s", err)
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.HasPrefix(line, "0::") {
+			return line[3:], nil
+		}
+	}
+
+	return "", fmt.Errorf("enforcer is not in a cgroup v2 hierarchy")
+}
+
+func newNetClsV2(root string, triremepath string, releasePath string) *netClsV2 {
+
+	s := &netClsV2{
+		root:             root,
+		ReleaseAgentPath: releasePath,
+		TriremePath:      triremepath,
+		marks:            map[string]uint64{},
+	}
+
+	if releasePath != "" {
+		s.notifier = newReleaseNotifier(releasePath)
+	}
+
+	return s
+}
+
+func (s *netClsV2) path(cgroupname string) string {
+	return filepath.Join(s.root, s.TriremePath, cgroupname)
+}
+
+// Creategroup creates the cgroup. There is no release agent in cgroup v2.
+// If a release agent is configured, it is invoked by the notifier once the
+// cgroup becomes empty.
+func (s *netClsV2) Creategroup(cgroupname string) error {
+
+	cgroupPath := s.path(cgroupname)
+	if _, err := os.Stat(cgroupPath); err == nil {
+		return s.watch(cgroupname)
+	}
+
+	if err := os.MkdirAll(cgroupPath, 0700); err != nil {
+		return err
+	}
+
+	return s.watch(cgroupname)
+}
+
+func (s *netClsV2) watch(cgroupname string) error {
+
+	if s.notifier == nil {
+		return nil
+	}
+
+	if err := s.notifier.watch(s.path(cgroupname), filepath.Join(s.TriremePath, cgroupname)); err != nil {
+		return fmt.Errorf("unable to watch cgroup %s: %s", cgroupname, err)
+	}
+
+	return nil
+}
+
+// AssignRootMark is a no-op. The host PUs are matched on the cgroup of
+// the enforcer.
+func (s *netClsV2) AssignRootMark(mark uint64) error {
+	return nil
+}
+
+// AssignMark records the mark of the cgroup.
+func (s *netClsV2) AssignMark(cgroupname string, mark uint64) error {
+
+	if _, err := os.Stat(s.path(cgroupname)); os.IsNotExist(err) {
+		return fmt.Errorf("cgroup does not exist: %s", err)
+	}
+
+	s.Lock()
+	s.marks[cgroupname] = mark
+	s.Unlock()
+
+	return nil
+}
+
+// AddProcess adds the process to the cgroup
+func (s *netClsV2) AddProcess(cgroupname string, pid int) error {
+
+	if _, err := os.Stat(s.path(cgroupname)); os.IsNotExist(err) {
+		return fmt.Errorf("cannot add process. cgroup does not exist: %s", err)
+	}
+
+	if err := syscall.Kill(pid, 0); err != nil {
+		return nil
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(s.path(cgroupname), procs), []byte(strconv.Itoa(pid)), 0644); err != nil {
+		return fmt.Errorf("cannot add process: %s", err)
+	}
+
+	return nil
+}
+
+// RemoveProcess moves the process back to the root cgroup.
+func (s *netClsV2) RemoveProcess(cgroupname string, pid int) error {
+
+	if _, err := os.Stat(s.path(cgroupname)); os.IsNotExist(err) {
+		return fmt.Errorf("cannot clean up process. cgroup does not exist: %s", err)
+	}
+
+	processes, err := s.ListCgroupProcesses(cgroupname)
+	if err != nil {
+		return fmt.Errorf("cannot cleanup process: %s", err)
+	}
+
+	found := false
+	for _, p := range processes {
+		if p == strconv.Itoa(pid) {
+			found = true
+			break
+		}
+	}
+
+	if !found {
+		return fmt.Errorf("cannot cleanup process. process is not a part of this cgroup")
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(s.root, procs), []byte(strconv.Itoa(pid)), 0644); err != nil {
+		return fmt.Errorf("cannot clean up process: %s", err)
+	}
+
+	return nil
+}
+
+// DeleteCgroup removes the cgroup. It will return an error if the cgroup
+// is not empty.
+func (s *netClsV2) DeleteCgroup(cgroupname string) error {
+
+	if _, err := os.Stat(s.path(cgroupname)); os.IsNotExist(err) {
+		zap.L().Debug("Group already deleted", zap.Error(err))
+		return nil
+	}
+
+	if s.notifier != nil {
+		s.notifier.unwatch(s.path(cgroupname))
+	}
+
+	if err := os.Remove(s.path(cgroupname)); err != nil {
+		return fmt.Errorf("unable to delete cgroup %s: %s", cgroupname, err)
+	}
+
+	s.Lock()
+	delete(s.marks, cgroupname)
+	s.Unlock()
+
+	return nil
+}
+
+// Deletebasepath removes the base Trireme cgroup
+func (s *netClsV2) Deletebasepath(cgroupName string) bool {
+
+	if cgroupName == s.TriremePath {
+		if err := os.Remove(filepath.Join(s.root, cgroupName)); err != nil {
+			zap.L().Error("Error when removing Trireme Base Path", zap.Error(err))
+		}
+		return true
+	}
+
+	return false
+}
+
+// ListCgroupProcesses returns lists of processes in the cgroup
+func (s *netClsV2) ListCgroupProcesses(cgroupname string) ([]string, error) {
+
+	if _, err := os.Stat(s.path(cgroupname)); os.IsNotExist(err) {
+		return []string{}, fmt.Errorf("cgroup %s does not exist: %s", cgroupname, err)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(s.path(cgroupname), procs))
+	if err != nil {
+		return []string{}, fmt.Errorf("cannot read procs file: %s", err)
+	}
+
+	processes := []string{}
+	for _, line := range strings.Split(string(data), "\n") {
+		if len(line) > 0 {
+			processes = append(processes, line)
+		}
+	}
+
+	return processes, nil
+}
+
+// ListAllCgroups returns a list of the cgroups that are managed in the
+// Trireme path. The interface files of cgroup v2 are skipped.
+func (s *netClsV2) ListAllCgroups(path string) []string {
+
+	cgroups, err := ioutil.ReadDir(filepath.Join(s.root, s.TriremePath, path))
+	if err != nil {
+		return []string{}
+	}
+
+	names := []string{}
+	for _, c := range cgroups {
+		if c.IsDir() {
+			names = append(names, c.Name())
+		}
+	}
+
+	return names
+}
+
+// releaseNotifier emulates the release agent of cgroup v1. It watches the
+// cgroup.events file of the cgroups and invokes the release agent with the
+// cgroup path once a cgroup that had processes becomes empty.
+type releaseNotifier struct {
+	agent     string
+	fd        int
+	watches   map[int]*releaseWatch
+	paths     map[string]int
+	startOnce sync.Once
+	sync.Mutex
+}
+
+type releaseWatch struct {
+	path      string
+	cgroup    string
+	populated bool
+}
+
+func newReleaseNotifier(agent string) *releaseNotifier {
+	return &releaseNotifier{
+		agent:   agent,
+		fd:      -1,
+		watches: map[int]*releaseWatch{},
+		paths:   map[string]int{},
+	}
+}
+
+func (r *releaseNotifier) start() error {
+
+	var err error
+
+	r.startOnce.Do(func() {
+		var fd int
+		if fd, err = syscall.InotifyInit1(syscall.IN_CLOEXEC); err != nil {
+			return
+		}
+		r.fd = fd
+		go r.run()
+	})
+
+	if r.fd < 0 {
+		return fmt.Errorf("unable to initialize inotify: %v", err)
+	}
+
+	return nil
+}
+
+func (r *releaseNotifier) watch(path string, cgroup string) error {
+
+	if err := r.start(); err != nil {
+		return err
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	if _, ok := r.paths[path]; ok {
+		return nil
+	}
+
+	wd, err := syscall.InotifyAddWatch(r.fd, path+eventsFile, syscall.IN_MODIFY)
+	if err != nil {
+		return err
+	}
+
+	r.paths[path] = wd
+	r.watches[wd] = &releaseWatch{
+		path:      path,
+		cgroup:    cgroup,
+		populated: populated(path),
+	}
+
+	return nil
+}
+
+func (r *releaseNotifier) unwatch(path string) {
+
+	r.Lock()
+	defer r.Unlock()
+
+	wd, ok := r.paths[path]
+	if !ok {
+		return
+	}
+
+	delete(r.paths, path)
+	delete(r.watches, wd)
+	syscall.InotifyRmWatch(r.fd, uint32(wd)) // nolint: errcheck
+}
+
+func (r *releaseNotifier) run() {
+
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+
+	for {
+		n, err := syscall.Read(r.fd, buf)
+		if err != nil {
+			if err == syscall.EINTR {
+				continue
+			}
+			zap.L().Error("Unable to read cgroup events", zap.Error(err))
+			return
+		}
+
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			offset += syscall.SizeofInotifyEvent + int(event.Len)
+			r.handle(int(event.Wd))
+		}
+	}
+}
+
+func (r *releaseNotifier) handle(wd int) {
+
+	r.Lock()
+	w, ok := r.watches[wd]
+	if !ok {
+		r.Unlock()
+		return
+	}
+
+	wasPopulated := w.populated
+	w.populated = populated(w.path)
+	release := wasPopulated && !w.populated
+	r.Unlock()
+
+	if !release {
+		return
+	}
+
+	// The kernel invokes the release agent of cgroup v1 with the path of
+	// the cgroup as the only argument.
+	go func(cgroup string) {
+		if out, err := exec.Command(r.agent, cgroup).CombinedOutput(); err != nil {
+			zap.L().Warn("Release agent failed",
+				zap.String("cgroup", cgroup),
+				zap.String("output", string(out)),
+				zap.Error(err),
+			)
+		}
+	}(w.cgroup)
+}
+
+// populated returns true if the cgroup or its descendants have processes.
+func populated(path string) bool {
+
+	data, err := ioutil.ReadFile(path + eventsFile)
+	if err != nil {
+		return false
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		if line == "populated 1" {
+			return true
+		}
+	}
+
+	return false
+}
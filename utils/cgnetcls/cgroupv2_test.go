@@ -0,0 +1,205 @@
+// +build linux
+
+package cgnetcls
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"go.aporeto.io/enforcerd/trireme-lib/common"
+)
+
+func TestDetectCgroupV2(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		mounts      string
+		controllers string
+		want        string
+	}{
+		{
+			name:        "unified hierarchy only",
+			mounts:      "cgroup2 /sys/fs/cgroup cgroup2 rw,nosuid,nodev,noexec,relatime 0 0\n",
+			controllers: "#subsys_name\thierarchy\tnum_cgroups\tenabled\ncpu\t0\t1\t1\n",
+			want:        "/sys/fs/cgroup",
+		},
+		{
+			name:        "unified hierarchy with net_cls disabled",
+			mounts:      "cgroup2 /sys/fs/cgroup cgroup2 rw 0 0\n",
+			controllers: "#subsys_name\thierarchy\tnum_cgroups\tenabled\nnet_cls\t0\t1\t0\n",
+			want:        "/sys/fs/cgroup",
+		},
+		{
+			name:        "hybrid hierarchy with net_cls mounted",
+			mounts:      "cgroup /sys/fs/cgroup/net_cls,net_prio cgroup rw,net_cls,net_prio 0 0\ncgroup2 /sys/fs/cgroup/unified cgroup2 rw 0 0\n",
+			controllers: "#subsys_name\thierarchy\tnum_cgroups\tenabled\nnet_cls\t3\t1\t1\n",
+			want:        "",
+		},
+		{
+			name:        "hybrid hierarchy with net_cls available",
+			mounts:      "cgroup2 /sys/fs/cgroup/unified cgroup2 rw 0 0\n",
+			controllers: "#subsys_name\thierarchy\tnum_cgroups\tenabled\nnet_cls\t0\t1\t1\n",
+			want:        "",
+		},
+		{
+			name:        "no cgroup",
+			mounts:      "proc /proc proc rw 0 0\n",
+			controllers: "",
+			want:        "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := detectCgroupV2(strings.NewReader(tt.mounts), strings.NewReader(tt.controllers)); got != tt.want {
+				t.Errorf("detectCgroupV2() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNetClsV2(t *testing.T) {
+
+	root, err := ioutil.TempDir("", "cgroupv2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root) // nolint: errcheck
+
+	cg := newNetClsV2(root, "/trireme", "")
+
+	if err := cg.AssignMark("pu", 100); err == nil {
+		t.Errorf("AssignMark() succeeded without a cgroup")
+	}
+
+	if err := cg.Creategroup("pu"); err != nil {
+		t.Fatalf("Creategroup() error = %s", err)
+	}
+
+	if err := cg.AssignMark("pu", 100); err != nil {
+		t.Errorf("AssignMark() error = %s", err)
+	}
+
+	if err := cg.AddProcess("pu", os.Getpid()); err != nil {
+		t.Errorf("AddProcess() error = %s", err)
+	}
+
+	// cgroup v2 interface files must not be reported as cgroups
+	if err := ioutil.WriteFile(filepath.Join(root, "trireme", "cgroup.procs"), []byte{}, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := cg.ListAllCgroups(""); !reflect.DeepEqual(got, []string{"pu"}) {
+		t.Errorf("ListAllCgroups() = %v, want [pu]", got)
+	}
+
+	processes, err := cg.ListCgroupProcesses("pu")
+	if err != nil {
+		t.Fatalf("ListCgroupProcesses() error = %s", err)
+	}
+
+	if want := []string{strconv.Itoa(os.Getpid())}; !reflect.DeepEqual(processes, want) {
+		t.Errorf("ListCgroupProcesses() = %v, want %v", processes, want)
+	}
+
+	if err := cg.RemoveProcess("pu", os.Getpid()+1); err == nil {
+		t.Errorf("RemoveProcess() succeeded for a process outside of the cgroup")
+	}
+
+	if err := os.Remove(filepath.Join(root, "trireme", "pu", "cgroup.procs")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cg.DeleteCgroup("pu"); err != nil {
+		t.Errorf("DeleteCgroup() error = %s", err)
+	}
+
+	if err := cg.DeleteCgroup("pu"); err != nil {
+		t.Errorf("DeleteCgroup() of a deleted cgroup error = %s", err)
+	}
+}
+
+func TestCgroupV2Path(t *testing.T) {
+
+	root, err := ioutil.TempDir("", "cgroupv2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root) // nolint: errcheck
+
+	tests := []struct {
+		name        string
+		triremePath string
+		cgroupName  string
+		want        string
+	}{
+		{
+			name:        "linux process",
+			triremePath: common.TriremeCgroupPath,
+			cgroupName:  "pu",
+			want:        "/trireme/pu",
+		},
+		{
+			name:        "host network container",
+			triremePath: common.TriremeDockerHostNetwork,
+			cgroupName:  "abcdef123456",
+			want:        "/trireme_docker_hostnet/abcdef123456",
+		},
+		{
+			name:        "user session",
+			triremePath: common.TriremeUIDCgroupPath,
+			cgroupName:  "1000/4242",
+			want:        "/trireme_uid/1000/4242",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := CgroupV2Path(tt.triremePath, tt.cgroupName)
+			if path != tt.want {
+				t.Errorf("CgroupV2Path() = %s, want %s", path, tt.want)
+			}
+
+			// The path must be the one of the cgroup created by the controller.
+			if err := newNetClsV2(root, tt.triremePath, "").Creategroup(tt.cgroupName); err != nil {
+				t.Fatalf("Creategroup() error = %s", err)
+			}
+			if _, err := os.Stat(filepath.Join(root, path)); err != nil {
+				t.Errorf("cgroup %s does not exist: %s", path, err)
+			}
+		})
+	}
+}
+
+func TestPopulated(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "cgroupv2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir) // nolint: errcheck
+
+	if populated(dir) {
+		t.Errorf("populated() = true without an events file")
+	}
+
+	if err := ioutil.WriteFile(dir+eventsFile, []byte("populated 1\nfrozen 0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if !populated(dir) {
+		t.Errorf("populated() = false, want true")
+	}
+
+	if err := ioutil.WriteFile(dir+eventsFile, []byte("populated 0\nfrozen 0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if populated(dir) {
+		t.Errorf("populated() = true, want false")
+	}
+}
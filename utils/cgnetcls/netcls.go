@@ -23,6 +23,7 @@ type netCls struct {
 
 var (
 	cgroupNetClsPath string
+	cgroupV2Root     string
 	markval          uint64 = constants.Initialmarkval // nolint: varcheck
 )
 
@@ -31,6 +32,14 @@ func ConfigureNetClsPath(path string) {
 	cgroupNetClsPath = path
 }
 
+// cgroupRoot returns the root of the hierarchy of the Trireme cgroups
+func cgroupRoot() string {
+	if IsCgroupV2() {
+		return cgroupV2Root
+	}
+	return cgroupNetClsPath
+}
+
 // GetCgroupList geta list of all cgroup names
 // TODO: only used in autoport detection, and a bad usage as well
 func GetCgroupList() []string {
@@ -38,7 +47,7 @@ func GetCgroupList() []string {
 
 	// iterate over our different base paths from the different cgroup base paths
 	for _, baseCgroupPath := range []string{common.TriremeCgroupPath, common.TriremeDockerHostNetwork} {
-		filelist, err := ioutil.ReadDir(filepath.Join(cgroupNetClsPath, baseCgroupPath))
+		filelist, err := ioutil.ReadDir(filepath.Join(cgroupRoot(), baseCgroupPath))
 		if err == nil {
 			for _, file := range filelist {
 				if file.IsDir() {
@@ -54,11 +63,11 @@ func GetCgroupList() []string {
 // TODO: only used in autoport detection, and a bad usage as well
 func ListCgroupProcesses(cgroupname string) ([]string, error) {
 
-	if _, err := os.Stat(filepath.Join(cgroupNetClsPath, cgroupname)); os.IsNotExist(err) {
+	if _, err := os.Stat(filepath.Join(cgroupRoot(), cgroupname)); os.IsNotExist(err) {
 		return []string{}, fmt.Errorf("cgroup %s does not exist: %s", cgroupname, err)
 	}
 
-	data, err := ioutil.ReadFile(filepath.Join(cgroupNetClsPath, cgroupname, "cgroup.procs"))
+	data, err := ioutil.ReadFile(filepath.Join(cgroupRoot(), cgroupname, "cgroup.procs"))
 	if err != nil {
 		return []string{}, fmt.Errorf("cannot read procs file: %s", err)
 	}
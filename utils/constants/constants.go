@@ -19,6 +19,8 @@ const (
 	DropConnmark = uint32(0xEEED)
 	// HandshakeConnmark is used to drop response packets
 	HandshakeConnmark = uint32(0xEEEC)
+	// EncryptConnmark is used to keep the packets of encrypted connections in the datapath
+	EncryptConnmark = uint32(0xEEEB)
 	// IstioPacketMark is a mark that we use so that we don't loop in the Istio Chain forever.
 	IstioPacketMark = 0x44
 )
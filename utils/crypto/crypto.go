@@ -2,7 +2,9 @@ package crypto
 
 import (
 	"bytes"
+	"crypto"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/elliptic"
 	"crypto/hmac"
 	"crypto/rand"
@@ -164,6 +166,34 @@ func LoadEllipticCurveKey(keyPEM []byte) (*ecdsa.PrivateKey, error) {
 	return key, nil
 }
 
+// LoadPrivateKey parses a private key that can sign the tokens. It is an EC
+// private key, or a PKCS#8 private key holding an ECDSA or an Ed25519 key.
+func LoadPrivateKey(keyPEM []byte) (crypto.Signer, error) {
+
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, fmt.Errorf("LoadPrivateKey bad pem block: %s", string(keyPEM))
+	}
+
+	if block.Type == "EC PRIVATE KEY" {
+		return x509.ParseECPrivateKey(block.Bytes)
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	switch k := key.(type) {
+	case *ecdsa.PrivateKey:
+		return k, nil
+	case ed25519.PrivateKey:
+		return k, nil
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+}
+
 // LoadAndVerifyCertificate parses, validates, and creates a certificate structure from a PEM buffer
 // It must be provided with the a CertPool
 func LoadAndVerifyCertificate(certPEM []byte, roots *x509.CertPool) (*x509.Certificate, error) {
@@ -208,6 +238,29 @@ func LoadAndVerifyECSecrets(keyPEM, certPEM, caCertPEM []byte) (key *ecdsa.Priva
 
 }
 
+// LoadAndVerifySecrets loads all the certificates and keys to memory in the right data structures.
+// The key is an ECDSA or an Ed25519 key.
+func LoadAndVerifySecrets(keyPEM, certPEM, caCertPEM []byte) (key crypto.Signer, cert *x509.Certificate, rootCertPool *x509.CertPool, err error) {
+
+	// Parse the key
+	key, err = LoadPrivateKey(keyPEM)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	rootCertPool = LoadRootCertificates(caCertPEM)
+	if rootCertPool == nil {
+		return nil, nil, nil, errors.New("unable to load root certificate pool")
+	}
+
+	cert, err = LoadAndVerifyCertificate(certPEM, rootCertPool)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return key, cert, rootCertPool, nil
+}
+
 // LoadCertificate loads a certificate from a PEM file without verifying
 // Should only be used for loading a root CA certificate. It will only read
 // the first certificate